@@ -0,0 +1,76 @@
+package access
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"time"
+)
+
+const (
+	DefaultAccessTokenPayloadLength = 32
+
+	// The default lifetime of access tokens. Unlike ID tokens, access tokens
+	// are meant to be short lived; clients that need access for longer should
+	// use refresh tokens.
+	DefaultAccessTokenValidityWindow = time.Hour
+)
+
+var (
+	ErrorInvalidUserID   = errors.New("invalid user ID")
+	ErrorInvalidClientID = errors.New("invalid client ID")
+
+	ErrorInvalidToken = errors.New("invalid token")
+)
+
+// AccessToken holds what an opaque access token grants.
+type AccessToken struct {
+	UserID   string
+	ClientID string
+
+	// Scope is the scope the token was issued for.
+	Scope []string
+
+	// Claims lists the claims requested individually for the UserInfo
+	// endpoint, on top of those requested by Scope.
+	Claims []string
+
+	// Audience is the intended audience of the token, which is distinct
+	// from the audience of ID tokens (the client).
+	Audience string
+
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+type AccessTokenGenerator func() (string, error)
+
+func (g AccessTokenGenerator) Generate() (string, error) {
+	return g()
+}
+
+func DefaultAccessTokenGenerator() (string, error) {
+	b := make([]byte, DefaultAccessTokenPayloadLength)
+	n, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	if n != DefaultAccessTokenPayloadLength {
+		return "", errors.New("unable to read enough random bytes")
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+type AccessTokenRepo interface {
+	// Create generates and stores a new opaque access token granting what's
+	// described by the given AccessToken. On success the token will be returned.
+	Create(at AccessToken) (string, error)
+
+	// Get returns what the given access token grants, or ErrorInvalidToken
+	// if the token is unknown or has expired.
+	Get(token string) (*AccessToken, error)
+
+	// Revoke deletes the access token, or returns ErrorInvalidToken if the
+	// token is unknown.
+	Revoke(token string) error
+}
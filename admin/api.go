@@ -2,39 +2,63 @@
 package admin
 
 import (
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/coreos/dex/audit"
 	"github.com/coreos/dex/client"
 	clientmanager "github.com/coreos/dex/client/manager"
 	"github.com/coreos/dex/connector"
+	"github.com/coreos/dex/lockout"
+	"github.com/coreos/dex/mfa"
 	"github.com/coreos/dex/schema/adminschema"
 	"github.com/coreos/dex/user"
 	usermanager "github.com/coreos/dex/user/manager"
+	"github.com/coreos/go-oidc/oidc"
 )
 
+// MaxAuditEventsPerPage is the most audit events ListAuditEvents returns at
+// once.
+const MaxAuditEventsPerPage = 100
+
 // AdminAPI provides the logic necessary to implement the Admin API.
 type AdminAPI struct {
-	userManager         *usermanager.UserManager
-	userRepo            user.UserRepo
-	passwordInfoRepo    user.PasswordInfoRepo
-	connectorConfigRepo connector.ConnectorConfigRepo
-	clientRepo          client.ClientRepo
-	clientManager       *clientmanager.ClientManager
-	localConnectorID    string
+	userManager            *usermanager.UserManager
+	userRepo               user.UserRepo
+	passwordInfoRepo       user.PasswordInfoRepo
+	connectorConfigRepo    connector.ConnectorConfigRepo
+	clientRepo             client.ClientRepo
+	clientManager          *clientmanager.ClientManager
+	groupManager           *usermanager.GroupManager
+	loginAttemptRepo       lockout.LoginAttemptRepo
+	mfaEnrollmentRepo      mfa.EnrollmentRepo
+	initialAccessTokenRepo client.InitialAccessTokenRepo
+	auditLogger            *audit.Logger
+	auditEventRepo         audit.EventRepo
+	localConnectorID       string
 }
 
-func NewAdminAPI(userRepo user.UserRepo, pwiRepo user.PasswordInfoRepo, clientRepo client.ClientRepo, connectorConfigRepo connector.ConnectorConfigRepo, userManager *usermanager.UserManager, clientManager *clientmanager.ClientManager, localConnectorID string) *AdminAPI {
+func NewAdminAPI(userRepo user.UserRepo, pwiRepo user.PasswordInfoRepo, clientRepo client.ClientRepo, connectorConfigRepo connector.ConnectorConfigRepo, userManager *usermanager.UserManager, clientManager *clientmanager.ClientManager, groupManager *usermanager.GroupManager, loginAttemptRepo lockout.LoginAttemptRepo, mfaEnrollmentRepo mfa.EnrollmentRepo, initialAccessTokenRepo client.InitialAccessTokenRepo, auditLogger *audit.Logger, auditEventRepo audit.EventRepo, localConnectorID string) *AdminAPI {
 	if localConnectorID == "" {
 		panic("must specify non-blank localConnectorID")
 	}
 	return &AdminAPI{
-		userManager:         userManager,
-		userRepo:            userRepo,
-		passwordInfoRepo:    pwiRepo,
-		clientRepo:          clientRepo,
-		clientManager:       clientManager,
-		connectorConfigRepo: connectorConfigRepo,
-		localConnectorID:    localConnectorID,
+		userManager:            userManager,
+		userRepo:               userRepo,
+		passwordInfoRepo:       pwiRepo,
+		clientRepo:             clientRepo,
+		clientManager:          clientManager,
+		groupManager:           groupManager,
+		loginAttemptRepo:       loginAttemptRepo,
+		mfaEnrollmentRepo:      mfaEnrollmentRepo,
+		initialAccessTokenRepo: initialAccessTokenRepo,
+		auditLogger:            auditLogger,
+		auditEventRepo:         auditEventRepo,
+		connectorConfigRepo:    connectorConfigRepo,
+		localConnectorID:       localConnectorID,
 	}
 }
 
@@ -69,18 +93,39 @@ func errorMaker(typ string, desc string, code int) func(internal error) Error {
 var (
 	ErrorMissingClient = errorMaker("bad_request", "The 'client' cannot be empty", http.StatusBadRequest)(nil)
 
+	ErrorInvalidSecretOverlap = errorMaker("bad_request", "The 'overlapSeconds' cannot be negative", http.StatusBadRequest)(nil)
+
+	ErrorInvalidInitialAccessTokenRequest = errorMaker("bad_request", "The 'expiresInSeconds' and 'maxUses' cannot be negative", http.StatusBadRequest)(nil)
+
+	ErrorInvalidMaxResults = errorMaker("bad_request", fmt.Sprintf("The 'maxResults' must be between 1 and %d", MaxAuditEventsPerPage), http.StatusBadRequest)(nil)
+
+	ErrorInvalidNextPageToken = errorMaker("bad_request", "The 'nextPageToken' is invalid", http.StatusBadRequest)(nil)
+
 	// Called when oidc.ClientMetadata.Valid() fails.
 	ErrorInvalidClientFunc = errorMaker("bad_request", "Your client could not be validated.", http.StatusBadRequest)
 
 	errorMap = map[error]func(error) Error{
-		user.ErrorNotFound:       errorMaker("resource_not_found", "Resource could not be found.", http.StatusNotFound),
-		user.ErrorDuplicateEmail: errorMaker("bad_request", "Email already in use.", http.StatusBadRequest),
-		user.ErrorInvalidEmail:   errorMaker("bad_request", "invalid email.", http.StatusBadRequest),
+		user.ErrorNotFound:                errorMaker("resource_not_found", "Resource could not be found.", http.StatusNotFound),
+		user.ErrorDuplicateEmail:          errorMaker("bad_request", "Email already in use.", http.StatusBadRequest),
+		user.ErrorInvalidEmail:            errorMaker("bad_request", "invalid email.", http.StatusBadRequest),
+		user.ErrorInvalidID:               errorMaker("bad_request", "invalid ID.", http.StatusBadRequest),
+		user.ErrorDuplicateRemoteIdentity: errorMaker("bad_request", "Remote identity already linked to another user.", http.StatusBadRequest),
+
+		user.ErrorGroupNotFound:      errorMaker("resource_not_found", "Resource could not be found.", http.StatusNotFound),
+		user.ErrorNotGroupMember:     errorMaker("resource_not_found", "Resource could not be found.", http.StatusNotFound),
+		user.ErrorDuplicateGroupName: errorMaker("bad_request", "Group name already in use.", http.StatusBadRequest),
+		user.ErrorInvalidGroupName:   errorMaker("bad_request", "invalid group name.", http.StatusBadRequest),
+
+		lockout.ErrorNotFound:   errorMaker("resource_not_found", "Resource could not be found.", http.StatusNotFound),
+		mfa.ErrorNotFound:       errorMaker("resource_not_found", "Resource could not be found.", http.StatusNotFound),
+		client.ErrorNotFound:    errorMaker("resource_not_found", "Resource could not be found.", http.StatusNotFound),
+		connector.ErrorNotFound: errorMaker("bad_request", "Connector could not be found.", http.StatusBadRequest),
 
 		adminschema.ErrorInvalidRedirectURI: errorMaker("bad_request", "invalid redirectURI.", http.StatusBadRequest),
 		adminschema.ErrorInvalidLogoURI:     errorMaker("bad_request", "invalid logoURI.", http.StatusBadRequest),
 		adminschema.ErrorInvalidClientURI:   errorMaker("bad_request", "invalid clientURI.", http.StatusBadRequest),
 		adminschema.ErrorNoRedirectURI:      errorMaker("bad_request", "invalid redirectURI.", http.StatusBadRequest),
+		adminschema.ErrorInvalidLogoutURI:   errorMaker("bad_request", "invalid logout URI.", http.StatusBadRequest),
 	}
 )
 
@@ -110,6 +155,7 @@ func (a *AdminAPI) CreateAdmin(admn adminschema.Admin) (string, error) {
 	if err != nil {
 		return "", mapError(err)
 	}
+	a.auditLogger.Record(audit.Event{Type: audit.EventAdminCreated, UserID: userID})
 	return userID, nil
 }
 
@@ -145,6 +191,7 @@ func (a *AdminAPI) CreateClient(req adminschema.ClientCreateRequest) (adminschem
 	if err != nil {
 		return adminschema.ClientCreateResponse{}, mapError(err)
 	}
+	a.auditLogger.Record(audit.Event{Type: audit.EventAdminClientCreated, ClientID: creds.ID})
 
 	req.Client.Id = creds.ID
 	req.Client.Secret = creds.Secret
@@ -153,14 +200,395 @@ func (a *AdminAPI) CreateClient(req adminschema.ClientCreateRequest) (adminschem
 	}, nil
 }
 
+// ListClients returns all clients, without their secrets.
+func (a *AdminAPI) ListClients() (adminschema.ClientsResponse, error) {
+	clients, err := a.clientManager.All()
+	if err != nil {
+		return adminschema.ClientsResponse{}, mapError(err)
+	}
+
+	resp := adminschema.ClientsResponse{
+		Clients: make([]*adminschema.Client, len(clients)),
+	}
+	for i, c := range clients {
+		c.Credentials.Secret = ""
+		sc := adminschema.MapClientToSchemaClient(c)
+		resp.Clients[i] = &sc
+	}
+	return resp, nil
+}
+
+// GetClient returns a client, without its secret.
+func (a *AdminAPI) GetClient(id string) (adminschema.Client, error) {
+	c, err := a.clientManager.Get(id)
+	if err != nil {
+		return adminschema.Client{}, mapError(err)
+	}
+	c.Credentials.Secret = ""
+	return adminschema.MapClientToSchemaClient(c), nil
+}
+
+// UpdateClient replaces the metadata and settings of a client. Its ID and
+// secret can't be changed.
+func (a *AdminAPI) UpdateClient(id string, sc adminschema.Client) (adminschema.Client, error) {
+	cli, err := adminschema.MapSchemaClientToClient(sc)
+	if err != nil {
+		return adminschema.Client{}, mapError(err)
+	}
+
+	if err := cli.Metadata.Valid(); err != nil {
+		return adminschema.Client{}, ErrorInvalidClientFunc(err)
+	}
+
+	cli.Credentials = oidc.ClientCredentials{ID: id}
+	if err := a.clientManager.Update(cli); err != nil {
+		return adminschema.Client{}, mapError(err)
+	}
+	a.auditLogger.Record(audit.Event{Type: audit.EventAdminClientUpdated, ClientID: id})
+	return adminschema.MapClientToSchemaClient(cli), nil
+}
+
+// DeleteClient deletes a client, and revokes the access and refresh tokens
+// issued to it.
+func (a *AdminAPI) DeleteClient(id string) error {
+	if err := a.clientManager.Delete(id); err != nil {
+		return mapError(err)
+	}
+	a.auditLogger.Record(audit.Event{Type: audit.EventAdminClientDeleted, ClientID: id})
+	return nil
+}
+
+// RotateClientSecret replaces the secret of a client. The replaced secret
+// keeps working for the requested overlap.
+func (a *AdminAPI) RotateClientSecret(id string, req adminschema.ClientSecretRotateRequest) (adminschema.ClientSecretRotateResponse, error) {
+	if req.OverlapSeconds < 0 {
+		return adminschema.ClientSecretRotateResponse{}, ErrorInvalidSecretOverlap
+	}
+
+	creds, err := a.clientManager.RotateSecret(id, time.Duration(req.OverlapSeconds)*time.Second)
+	if err != nil {
+		return adminschema.ClientSecretRotateResponse{}, mapError(err)
+	}
+	a.auditLogger.Record(audit.Event{
+		Type:     audit.EventAdminClientSecretRotated,
+		ClientID: id,
+		Details:  map[string]string{"overlap_seconds": strconv.FormatInt(req.OverlapSeconds, 10)},
+	})
+
+	resp := adminschema.ClientSecretRotateResponse{
+		Id:     creds.ID,
+		Secret: creds.Secret,
+	}
+	previous, expiresAt, err := a.clientRepo.GetPreviousSecret(nil, id)
+	if err != nil {
+		return adminschema.ClientSecretRotateResponse{}, mapError(err)
+	}
+	if previous != nil {
+		resp.PreviousSecretExpiresAt = expiresAt.UTC().Format(time.RFC3339)
+	}
+	return resp, nil
+}
+
+// ListInitialAccessTokens returns all initial access tokens. The tokens
+// themselves are only known to whoever they were issued to.
+func (a *AdminAPI) ListInitialAccessTokens() (adminschema.InitialAccessTokensResponse, error) {
+	iats, err := a.initialAccessTokenRepo.All()
+	if err != nil {
+		return adminschema.InitialAccessTokensResponse{}, mapError(err)
+	}
+
+	resp := adminschema.InitialAccessTokensResponse{
+		InitialAccessTokens: make([]*adminschema.InitialAccessToken, len(iats)),
+	}
+	for i, iat := range iats {
+		siat := mapInitialAccessToken(iat)
+		resp.InitialAccessTokens[i] = &siat
+	}
+	return resp, nil
+}
+
+// CreateInitialAccessToken issues an initial access token, which allows
+// registering clients dynamically when the registration endpoint requires
+// one.
+func (a *AdminAPI) CreateInitialAccessToken(req adminschema.InitialAccessTokenCreateRequest) (adminschema.InitialAccessTokenCreateResponse, error) {
+	if req.ExpiresInSeconds < 0 || req.MaxUses < 0 {
+		return adminschema.InitialAccessTokenCreateResponse{}, ErrorInvalidInitialAccessTokenRequest
+	}
+
+	validity := client.DefaultInitialAccessTokenValidityWindow
+	if req.ExpiresInSeconds > 0 {
+		validity = time.Duration(req.ExpiresInSeconds) * time.Second
+	}
+	now := time.Now()
+	iat := client.InitialAccessToken{
+		CreatedAt: now,
+		ExpiresAt: now.Add(validity),
+		MaxUses:   int(req.MaxUses),
+	}
+	token, id, err := a.initialAccessTokenRepo.Create(iat)
+	if err != nil {
+		return adminschema.InitialAccessTokenCreateResponse{}, mapError(err)
+	}
+	iat.ID = id
+	a.auditLogger.Record(audit.Event{
+		Type:    audit.EventAdminInitialAccessTokenCreated,
+		Details: map[string]string{"initial_access_token": id},
+	})
+
+	siat := mapInitialAccessToken(iat)
+	return adminschema.InitialAccessTokenCreateResponse{
+		Token:              token,
+		InitialAccessToken: &siat,
+	}, nil
+}
+
+// DeleteInitialAccessToken revokes an initial access token. Clients it
+// registered are left alone.
+func (a *AdminAPI) DeleteInitialAccessToken(id string) error {
+	if err := a.initialAccessTokenRepo.Delete(id); err != nil {
+		return mapError(err)
+	}
+	a.auditLogger.Record(audit.Event{
+		Type:    audit.EventAdminInitialAccessTokenDeleted,
+		Details: map[string]string{"initial_access_token": id},
+	})
+	return nil
+}
+
+func mapInitialAccessToken(iat client.InitialAccessToken) adminschema.InitialAccessToken {
+	return adminschema.InitialAccessToken{
+		Id:        iat.ID,
+		CreatedAt: iat.CreatedAt.UTC().Format(time.RFC3339),
+		ExpiresAt: iat.ExpiresAt.UTC().Format(time.RFC3339),
+		MaxUses:   int64(iat.MaxUses),
+		Uses:      int64(iat.Uses),
+	}
+}
+
 func (a *AdminAPI) SetConnectors(connectorConfigs []connector.ConnectorConfig) error {
-	return a.connectorConfigRepo.Set(connectorConfigs)
+	if err := a.connectorConfigRepo.Set(connectorConfigs); err != nil {
+		return err
+	}
+	ids := make([]string, len(connectorConfigs))
+	for i, cfg := range connectorConfigs {
+		ids[i] = cfg.ConnectorID()
+	}
+	a.auditLogger.Record(audit.Event{
+		Type:    audit.EventAdminConnectorsUpdated,
+		Details: map[string]string{"connectors": strings.Join(ids, ",")},
+	})
+	return nil
 }
 
 func (a *AdminAPI) GetConnectors() ([]connector.ConnectorConfig, error) {
 	return a.connectorConfigRepo.All()
 }
 
+func (a *AdminAPI) ListGroups() (adminschema.GroupsResponse, error) {
+	groups, err := a.groupManager.List()
+	if err != nil {
+		return adminschema.GroupsResponse{}, mapError(err)
+	}
+
+	resp := adminschema.GroupsResponse{
+		Groups: make([]*adminschema.Group, len(groups)),
+	}
+	for i, g := range groups {
+		resp.Groups[i] = &adminschema.Group{
+			Id:   g.ID,
+			Name: g.Name,
+		}
+	}
+	return resp, nil
+}
+
+func (a *AdminAPI) GetGroup(id string) (adminschema.Group, error) {
+	g, err := a.groupManager.Get(id)
+	if err != nil {
+		return adminschema.Group{}, mapError(err)
+	}
+
+	return adminschema.Group{
+		Id:   g.ID,
+		Name: g.Name,
+	}, nil
+}
+
+func (a *AdminAPI) CreateGroup(grp adminschema.Group) (string, error) {
+	id, err := a.groupManager.CreateGroup(grp.Name)
+	if err != nil {
+		return "", mapError(err)
+	}
+	return id, nil
+}
+
+func (a *AdminAPI) DeleteGroup(id string) error {
+	if err := a.groupManager.DeleteGroup(id); err != nil {
+		return mapError(err)
+	}
+	return nil
+}
+
+func (a *AdminAPI) ListGroupMembers(id string) (adminschema.GroupMembersResponse, error) {
+	members, err := a.groupManager.GetMembers(id)
+	if err != nil {
+		return adminschema.GroupMembersResponse{}, mapError(err)
+	}
+	return adminschema.GroupMembersResponse{
+		Members: members,
+	}, nil
+}
+
+func (a *AdminAPI) AddGroupMember(id, userID string) error {
+	if err := a.groupManager.AddMember(id, userID); err != nil {
+		return mapError(err)
+	}
+	return nil
+}
+
+func (a *AdminAPI) RemoveGroupMember(id, userID string) error {
+	if err := a.groupManager.RemoveMember(id, userID); err != nil {
+		return mapError(err)
+	}
+	return nil
+}
+
+func (a *AdminAPI) ListLockouts() (adminschema.LockoutsResponse, error) {
+	locked, err := a.loginAttemptRepo.Locked(time.Now())
+	if err != nil {
+		return adminschema.LockoutsResponse{}, mapError(err)
+	}
+
+	resp := adminschema.LockoutsResponse{
+		Lockouts: make([]*adminschema.Lockout, len(locked)),
+	}
+	for i, l := range locked {
+		resp.Lockouts[i] = &adminschema.Lockout{
+			Id:          l.ID,
+			Kind:        l.Kind,
+			ConnectorID: l.ConnectorID,
+			Subject:     l.Subject,
+			Failures:    int64(l.Failures),
+			LockedUntil: l.LockedUntil.UTC().Format(time.RFC3339),
+		}
+	}
+	return resp, nil
+}
+
+// Unlock clears the failed logins of an account or IP, lifting its lockout.
+func (a *AdminAPI) Unlock(id string) error {
+	l, err := a.loginAttemptRepo.Get(id)
+	if err != nil {
+		return mapError(err)
+	}
+	if err := a.loginAttemptRepo.Delete(id); err != nil {
+		return mapError(err)
+	}
+	a.auditLogger.Record(audit.Event{
+		Type:        audit.EventAdminLockoutCleared,
+		ConnectorID: l.ConnectorID,
+		Details:     map[string]string{l.Kind: l.Subject},
+	})
+	return nil
+}
+
+// ResetMFA removes the second factor enrollment of a user.
+func (a *AdminAPI) ResetMFA(userID string) error {
+	if err := a.mfaEnrollmentRepo.Delete(userID); err != nil {
+		return mapError(err)
+	}
+	a.auditLogger.Record(audit.Event{Type: audit.EventAdminMFAReset, UserID: userID})
+	return nil
+}
+
+// ListRemoteIdentities returns the remote identities a user can log in with.
+func (a *AdminAPI) ListRemoteIdentities(userID string) (adminschema.RemoteIdentitiesResponse, error) {
+	if _, err := a.userRepo.Get(nil, userID); err != nil {
+		return adminschema.RemoteIdentitiesResponse{}, mapError(err)
+	}
+	rids, err := a.userRepo.GetRemoteIdentities(nil, userID)
+	if err != nil {
+		return adminschema.RemoteIdentitiesResponse{}, mapError(err)
+	}
+
+	resp := adminschema.RemoteIdentitiesResponse{
+		RemoteIdentities: make([]*adminschema.RemoteIdentity, len(rids)),
+	}
+	for i, rid := range rids {
+		resp.RemoteIdentities[i] = &adminschema.RemoteIdentity{
+			ConnectorID: rid.ConnectorID,
+			Id:          rid.ID,
+		}
+	}
+	return resp, nil
+}
+
+// LinkRemoteIdentity lets a user log in with a remote identity, which
+// mustn't belong to another user.
+func (a *AdminAPI) LinkRemoteIdentity(userID string, rid user.RemoteIdentity) error {
+	if rid.ConnectorID == "" || rid.ID == "" {
+		return mapError(user.ErrorInvalidID)
+	}
+	if err := a.userManager.LinkRemoteIdentity(userID, rid); err != nil {
+		return mapError(err)
+	}
+	a.auditLogger.Record(audit.Event{
+		Type:        audit.EventAdminRemoteIdentityLinked,
+		UserID:      userID,
+		ConnectorID: rid.ConnectorID,
+	})
+	return nil
+}
+
+// UnlinkRemoteIdentity stops a user from logging in with a remote identity.
+func (a *AdminAPI) UnlinkRemoteIdentity(userID string, rid user.RemoteIdentity) error {
+	if err := a.userManager.UnlinkRemoteIdentity(userID, rid); err != nil {
+		return mapError(err)
+	}
+	a.auditLogger.Record(audit.Event{
+		Type:        audit.EventAdminRemoteIdentityUnlinked,
+		UserID:      userID,
+		ConnectorID: rid.ConnectorID,
+	})
+	return nil
+}
+
+// ListAuditEvents returns a page of the audit events matching the filter,
+// newest first.
+func (a *AdminAPI) ListAuditEvents(filter audit.EventFilter, maxResults int, nextPageToken string) (adminschema.AuditEventsResponse, error) {
+	if nextPageToken == "" && (maxResults < 1 || maxResults > MaxAuditEventsPerPage) {
+		return adminschema.AuditEventsResponse{}, ErrorInvalidMaxResults
+	}
+	if nextPageToken != "" {
+		if _, _, _, err := audit.DecodeNextPageToken(nextPageToken); err != nil {
+			return adminschema.AuditEventsResponse{}, ErrorInvalidNextPageToken
+		}
+	}
+
+	events, tok, err := a.auditEventRepo.List(filter, maxResults, nextPageToken)
+	if err != nil {
+		return adminschema.AuditEventsResponse{}, mapError(err)
+	}
+
+	resp := adminschema.AuditEventsResponse{
+		AuditEvents:   make([]*adminschema.AuditEvent, len(events)),
+		NextPageToken: tok,
+	}
+	for i, e := range events {
+		resp.AuditEvents[i] = &adminschema.AuditEvent{
+			Id:          e.ID,
+			Type:        e.Type,
+			Time:        e.Time.UTC().Format(time.RFC3339),
+			UserID:      e.UserID,
+			ClientID:    e.ClientID,
+			ConnectorID: e.ConnectorID,
+			Ip:          e.IP,
+			Details:     e.Details,
+		}
+	}
+	return resp, nil
+}
+
 func mapError(e error) error {
 	if mapped, ok := errorMap[e]; ok {
 		return mapped(e)
@@ -1,12 +1,18 @@
 package admin
 
 import (
+	"net/http"
+	"sort"
 	"testing"
+	"time"
 
+	"github.com/coreos/dex/audit"
 	"github.com/coreos/dex/client"
 	clientmanager "github.com/coreos/dex/client/manager"
 	"github.com/coreos/dex/connector"
 	"github.com/coreos/dex/db"
+	"github.com/coreos/dex/lockout"
+	"github.com/coreos/dex/mfa"
 	"github.com/coreos/dex/schema/adminschema"
 	"github.com/coreos/dex/user"
 	"github.com/coreos/dex/user/manager"
@@ -21,6 +27,11 @@ type testFixtures struct {
 	cr    client.ClientRepo
 	cm    *clientmanager.ClientManager
 	mgr   *manager.UserManager
+	gm    *manager.GroupManager
+	lar   lockout.LoginAttemptRepo
+	mer   mfa.EnrollmentRepo
+	iatr  client.InitialAccessTokenRepo
+	aer   audit.EventRepo
 	adAPI *AdminAPI
 }
 
@@ -74,8 +85,20 @@ func makeTestFixtures() *testFixtures {
 	}()
 
 	f.mgr = manager.NewUserManager(f.ur, f.pwr, f.ccr, db.TransactionFactory(dbMap), manager.ManagerOptions{})
+	f.cr = db.NewClientRepo(dbMap)
 	f.cm = clientmanager.NewClientManager(f.cr, db.TransactionFactory(dbMap), clientmanager.ManagerOptions{})
-	f.adAPI = NewAdminAPI(f.ur, f.pwr, f.cr, f.ccr, f.mgr, f.cm, "local")
+	f.gm = manager.NewGroupManager(db.NewGroupRepo(dbMap), f.ur, db.TransactionFactory(dbMap))
+	f.lar = db.NewLoginAttemptRepo(dbMap)
+	f.mer = func() mfa.EnrollmentRepo {
+		repo, err := db.NewMFAEnrollmentRepo(dbMap, make([]byte, 32))
+		if err != nil {
+			panic("Failed to create MFA enrollment repo: " + err.Error())
+		}
+		return repo
+	}()
+	f.iatr = db.NewInitialAccessTokenRepo(dbMap)
+	f.aer = db.NewAuditEventRepo(dbMap)
+	f.adAPI = NewAdminAPI(f.ur, f.pwr, f.cr, f.ccr, f.mgr, f.cm, f.gm, f.lar, f.mer, f.iatr, audit.NewLogger(f.aer), f.aer, "local")
 
 	return f
 }
@@ -301,3 +324,300 @@ func TestSetConnectors(t *testing.T) {
 		}
 	}
 }
+
+func TestGroups(t *testing.T) {
+	f := makeTestFixtures()
+
+	id, err := f.adAPI.CreateGroup(adminschema.Group{Name: "admins"})
+	if err != nil {
+		t.Fatalf("Unable to create group: %v", err)
+	}
+
+	_, err = f.adAPI.CreateGroup(adminschema.Group{Name: "admins"})
+	if aErr, ok := err.(Error); !ok || aErr.Internal != user.ErrorDuplicateGroupName {
+		t.Errorf("want err=%v, got=%v", user.ErrorDuplicateGroupName, err)
+	}
+
+	grp, err := f.adAPI.GetGroup(id)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := pretty.Compare(adminschema.Group{Id: id, Name: "admins"}, grp); diff != "" {
+		t.Errorf("Compare(want, got) = %v", diff)
+	}
+
+	if err := f.adAPI.AddGroupMember(id, "ID-1"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := f.adAPI.AddGroupMember(id, "ID-3"); err == nil || err.(Error).Code != http.StatusNotFound {
+		t.Errorf("want not found adding unknown user, got=%v", err)
+	}
+
+	members, err := f.adAPI.ListGroupMembers(id)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := pretty.Compare(adminschema.GroupMembersResponse{Members: []string{"ID-1"}}, members); diff != "" {
+		t.Errorf("Compare(want, got) = %v", diff)
+	}
+
+	if err := f.adAPI.RemoveGroupMember(id, "ID-1"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := f.adAPI.DeleteGroup(id); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := f.adAPI.GetGroup(id); err == nil || err.(Error).Code != http.StatusNotFound {
+		t.Errorf("want not found after delete, got=%v", err)
+	}
+
+	groups, err := f.adAPI.ListGroups()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(groups.Groups) != 0 {
+		t.Errorf("want no groups, got %v", groups.Groups)
+	}
+}
+
+func TestLockouts(t *testing.T) {
+	f := makeTestFixtures()
+
+	lockedUntil := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	locked := lockout.Attempts{
+		ID:            lockout.AttemptsID(lockout.KindAccount, "local", "elroy@example.com"),
+		Kind:          lockout.KindAccount,
+		ConnectorID:   "local",
+		Subject:       "elroy@example.com",
+		Failures:      5,
+		LastFailureAt: time.Now().UTC(),
+		LockedUntil:   lockedUntil,
+	}
+	unlocked := lockout.Attempts{
+		ID:            lockout.AttemptsID(lockout.KindIP, "", "10.0.0.1"),
+		Kind:          lockout.KindIP,
+		Subject:       "10.0.0.1",
+		Failures:      1,
+		LastFailureAt: time.Now().UTC(),
+	}
+	for _, a := range []lockout.Attempts{locked, unlocked} {
+		if err := f.lar.Set(a); err != nil {
+			t.Fatalf("Unable to set login attempts: %v", err)
+		}
+	}
+
+	resp, err := f.adAPI.ListLockouts()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := adminschema.LockoutsResponse{
+		Lockouts: []*adminschema.Lockout{
+			{
+				Id:          locked.ID,
+				Kind:        lockout.KindAccount,
+				ConnectorID: "local",
+				Subject:     "elroy@example.com",
+				Failures:    5,
+				LockedUntil: lockedUntil.Format(time.RFC3339),
+			},
+		},
+	}
+	if diff := pretty.Compare(want, resp); diff != "" {
+		t.Errorf("Compare(want, got) = %v", diff)
+	}
+
+	if err := f.adAPI.Unlock(locked.ID); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := f.adAPI.Unlock(locked.ID); err == nil || err.(Error).Code != http.StatusNotFound {
+		t.Errorf("want not found unlocking twice, got=%v", err)
+	}
+
+	resp, err = f.adAPI.ListLockouts()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(resp.Lockouts) != 0 {
+		t.Errorf("want no lockouts, got %v", resp.Lockouts)
+	}
+}
+
+func TestResetMFA(t *testing.T) {
+	f := makeTestFixtures()
+
+	if err := f.mer.Set(mfa.Enrollment{UserID: "ID-1", Secret: []byte("secret")}); err != nil {
+		t.Fatalf("Unable to set MFA enrollment: %v", err)
+	}
+
+	if err := f.adAPI.ResetMFA("ID-1"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := f.mer.Get("ID-1"); err != mfa.ErrorNotFound {
+		t.Errorf("want err=%v, got=%v", mfa.ErrorNotFound, err)
+	}
+	if err := f.adAPI.ResetMFA("ID-1"); err == nil || err.(Error).Code != http.StatusNotFound {
+		t.Errorf("want not found resetting twice, got=%v", err)
+	}
+}
+
+func TestRemoteIdentities(t *testing.T) {
+	f := makeTestFixtures()
+	rid := user.RemoteIdentity{ConnectorID: "local", ID: "uid=jane,ou=people/1"}
+
+	if err := f.adAPI.LinkRemoteIdentity("ID-1", rid); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp, err := f.adAPI.ListRemoteIdentities("ID-1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := []*adminschema.RemoteIdentity{{ConnectorID: "local", Id: "uid=jane,ou=people/1"}}
+	if diff := pretty.Compare(want, resp.RemoteIdentities); diff != "" {
+		t.Errorf("Compare(want, got) = %v", diff)
+	}
+
+	tests := []struct {
+		userID   string
+		rid      user.RemoteIdentity
+		wantCode int
+	}{
+		// The identity belongs to ID-1 already.
+		{userID: "ID-2", rid: rid, wantCode: http.StatusBadRequest},
+		{userID: "ID-2", rid: user.RemoteIdentity{ConnectorID: "bogus", ID: "1"}, wantCode: http.StatusBadRequest},
+		{userID: "ID-2", rid: user.RemoteIdentity{ConnectorID: "local"}, wantCode: http.StatusBadRequest},
+		{userID: "ID-3", rid: user.RemoteIdentity{ConnectorID: "local", ID: "3"}, wantCode: http.StatusNotFound},
+	}
+	for i, tt := range tests {
+		if err := f.adAPI.LinkRemoteIdentity(tt.userID, tt.rid); err == nil || err.(Error).Code != tt.wantCode {
+			t.Errorf("case %d: want HTTP %d, got=%v", i, tt.wantCode, err)
+		}
+	}
+
+	if err := f.adAPI.UnlinkRemoteIdentity("ID-2", rid); err == nil || err.(Error).Code != http.StatusNotFound {
+		t.Errorf("want not found unlinking another user's identity, got=%v", err)
+	}
+	if err := f.adAPI.UnlinkRemoteIdentity("ID-1", rid); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if resp, err = f.adAPI.ListRemoteIdentities("ID-1"); err != nil || len(resp.RemoteIdentities) != 0 {
+		t.Errorf("want no remote identities, got=%v, %v", resp.RemoteIdentities, err)
+	}
+	if _, err := f.adAPI.ListRemoteIdentities("ID-3"); err == nil || err.(Error).Code != http.StatusNotFound {
+		t.Errorf("want not found for an unknown user, got=%v", err)
+	}
+
+	events, _, err := f.aer.List(audit.EventFilter{UserID: "ID-1"}, 10, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var types []string
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	sort.Strings(types)
+	if diff := pretty.Compare([]string{audit.EventAdminRemoteIdentityLinked, audit.EventAdminRemoteIdentityUnlinked}, types); diff != "" {
+		t.Errorf("Compare(want, got) = %v", diff)
+	}
+}
+
+func TestInitialAccessTokens(t *testing.T) {
+	f := makeTestFixtures()
+
+	if _, err := f.adAPI.CreateInitialAccessToken(adminschema.InitialAccessTokenCreateRequest{MaxUses: -1}); err != ErrorInvalidInitialAccessTokenRequest {
+		t.Errorf("want err=%v, got=%v", ErrorInvalidInitialAccessTokenRequest, err)
+	}
+
+	created, err := f.adAPI.CreateInitialAccessToken(adminschema.InitialAccessTokenCreateRequest{
+		ExpiresInSeconds: 3600,
+		MaxUses:          1,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if created.Token == "" || created.InitialAccessToken.Id == "" {
+		t.Fatalf("want token and ID, got %#v", created)
+	}
+
+	if err := f.iatr.Use(created.Token); err != nil {
+		t.Fatalf("Unexpected error using token: %v", err)
+	}
+
+	resp, err := f.adAPI.ListInitialAccessTokens()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	created.InitialAccessToken.Uses = 1
+	want := adminschema.InitialAccessTokensResponse{
+		InitialAccessTokens: []*adminschema.InitialAccessToken{created.InitialAccessToken},
+	}
+	if diff := pretty.Compare(want, resp); diff != "" {
+		t.Errorf("Compare(want, got) = %v", diff)
+	}
+
+	if err := f.adAPI.DeleteInitialAccessToken(created.InitialAccessToken.Id); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := f.adAPI.DeleteInitialAccessToken(created.InitialAccessToken.Id); err == nil || err.(Error).Code != http.StatusNotFound {
+		t.Errorf("want not found deleting twice, got=%v", err)
+	}
+}
+
+func TestListAuditEvents(t *testing.T) {
+	f := makeTestFixtures()
+
+	created, err := f.adAPI.CreateClient(adminschema.ClientCreateRequest{
+		Client: &adminschema.Client{RedirectURIs: []string{"https://client.example.com/callback"}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	clientID := created.Client.Id
+	if err := f.adAPI.DeleteClient(clientID); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := f.adAPI.ResetMFA("ID-1"); err != mapError(mfa.ErrorNotFound) {
+		t.Fatalf("want err=%v, got=%v", mapError(mfa.ErrorNotFound), err)
+	}
+
+	resp, err := f.adAPI.ListAuditEvents(audit.EventFilter{ClientID: clientID}, 10, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var types []string
+	for _, e := range resp.AuditEvents {
+		if e.ClientID != clientID || e.Id == "" || e.Time == "" {
+			t.Errorf("unexpected event: %#v", e)
+		}
+		types = append(types, e.Type)
+	}
+	sort.Strings(types)
+	// Failed actions aren't recorded.
+	want := []string{audit.EventAdminClientCreated, audit.EventAdminClientDeleted}
+	if diff := pretty.Compare(want, types); diff != "" {
+		t.Errorf("Compare(want, got) = %v", diff)
+	}
+
+	resp, err = f.adAPI.ListAuditEvents(audit.EventFilter{}, 1, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(resp.AuditEvents) != 1 || resp.NextPageToken == "" {
+		t.Fatalf("want one event and a next page, got %#v", resp)
+	}
+	resp, err = f.adAPI.ListAuditEvents(audit.EventFilter{}, 0, resp.NextPageToken)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(resp.AuditEvents) != 1 || resp.NextPageToken != "" {
+		t.Errorf("want one event and no next page, got %#v", resp)
+	}
+
+	for _, maxResults := range []int{0, MaxAuditEventsPerPage + 1} {
+		if _, err := f.adAPI.ListAuditEvents(audit.EventFilter{}, maxResults, ""); err != ErrorInvalidMaxResults {
+			t.Errorf("maxResults=%d: want err=%v, got=%v", maxResults, ErrorInvalidMaxResults, err)
+		}
+	}
+	if _, err := f.adAPI.ListAuditEvents(audit.EventFilter{}, 10, "not a token"); err != ErrorInvalidNextPageToken {
+		t.Errorf("want err=%v, got=%v", ErrorInvalidNextPageToken, err)
+	}
+}
@@ -0,0 +1,204 @@
+// Package audit records security-relevant events, such as logins, token
+// issuance and changes made by admins, as typed events.
+//
+// Events are written to one or more sinks: the process log, a JSON-lines
+// file, syslog or the database, from where they can be listed through the
+// admin API.
+package audit
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/pborman/uuid"
+
+	"github.com/coreos/dex/pkg/log"
+)
+
+// The types of events.
+const (
+	EventLoginSucceeded = "login.succeeded"
+	EventLoginFailed    = "login.failed"
+	EventLoginLockedOut = "login.locked_out"
+	EventLogout         = "logout"
+
+	EventConsentGranted = "consent.granted"
+	EventConsentDenied  = "consent.denied"
+
+	EventMFAEnrolled         = "mfa.enrolled"
+	EventMFARecoveryCodeUsed = "mfa.recovery_code_used"
+
+	EventTokenIssued    = "token.issued"
+	EventTokenRefreshed = "token.refreshed"
+
+	EventUserPasswordReset         = "user.password_reset"
+	EventUserPasswordChanged       = "user.password_changed"
+	EventUserUpdated               = "user.updated"
+	EventUserRemoteIdentityLinked  = "user.remote_identity_linked"
+	EventUserRemoteIdentityRemoved = "user.remote_identity_removed"
+	EventUserClientRevoked         = "user.client_revoked"
+	EventUserDisabled              = "user.disabled"
+	EventUserEnabled               = "user.enabled"
+
+	EventAdminCreated                   = "admin.created"
+	EventAdminClientCreated             = "admin.client_created"
+	EventAdminClientUpdated             = "admin.client_updated"
+	EventAdminClientDeleted             = "admin.client_deleted"
+	EventAdminClientSecretRotated       = "admin.client_secret_rotated"
+	EventAdminInitialAccessTokenCreated = "admin.initial_access_token_created"
+	EventAdminInitialAccessTokenDeleted = "admin.initial_access_token_deleted"
+	EventAdminConnectorsUpdated         = "admin.connectors_updated"
+	EventAdminLockoutCleared            = "admin.lockout_cleared"
+	EventAdminMFAReset                  = "admin.mfa_reset"
+	EventAdminRemoteIdentityLinked      = "admin.remote_identity_linked"
+	EventAdminRemoteIdentityUnlinked    = "admin.remote_identity_unlinked"
+	EventClientRegistered               = "client.registered"
+	EventClientRegistrationUpdated      = "client.registration_updated"
+	EventClientRegistrationDeleted      = "client.registration_deleted"
+)
+
+// Event describes something security-relevant which happened. Fields which
+// don't apply to the type of event are empty.
+type Event struct {
+	ID   string    `json:"id"`
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+
+	// UserID is the dex user the event concerns, ClientID the client and
+	// ConnectorID the connector.
+	UserID      string `json:"userID,omitempty"`
+	ClientID    string `json:"clientID,omitempty"`
+	ConnectorID string `json:"connectorID,omitempty"`
+
+	// IP is the address the request causing the event came from, if known.
+	IP string `json:"ip,omitempty"`
+
+	// Details holds further information depending on the type, such as the
+	// account name of a failed login or the grant type of an issued token.
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// String formats the event for log lines.
+func (e Event) String() string {
+	fields := []string{e.Type}
+	add := func(name, value string) {
+		if value != "" {
+			fields = append(fields, fmt.Sprintf("%s=%q", name, value))
+		}
+	}
+	add("user", e.UserID)
+	add("client", e.ClientID)
+	add("connector", e.ConnectorID)
+	add("ip", e.IP)
+
+	names := make([]string, 0, len(e.Details))
+	for name := range e.Details {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		add(name, e.Details[name])
+	}
+	return strings.Join(fields, " ")
+}
+
+// Sink stores or forwards events.
+type Sink interface {
+	Write(e Event) error
+}
+
+// EventFilter selects events to list. Empty fields match any event.
+type EventFilter struct {
+	Type     string
+	UserID   string
+	ClientID string
+}
+
+// EventRepo is a Sink which stores events so they can be listed.
+type EventRepo interface {
+	Sink
+
+	// List returns the events matching the filter, newest first. If there
+	// are more than maxResults, a token for listing the next page is
+	// returned; the filter and maxResults are ignored when a token is
+	// given.
+	List(filter EventFilter, maxResults int, nextPageToken string) ([]Event, string, error)
+}
+
+// Logger records events to its sinks. A nil *Logger discards events, so that
+// components can record events whether or not auditing is configured.
+type Logger struct {
+	Sinks []Sink
+	Clock clockwork.Clock
+
+	// mu serializes writes, so that sinks needn't be safe for concurrent
+	// use.
+	mu sync.Mutex
+}
+
+func NewLogger(sinks ...Sink) *Logger {
+	return &Logger{
+		Sinks: sinks,
+		Clock: clockwork.NewRealClock(),
+	}
+}
+
+// Record assigns the event an ID and, unless set, the current time, and
+// writes it to all sinks. Failing sinks are logged rather than failing the
+// action being audited.
+func (l *Logger) Record(e Event) {
+	if l == nil {
+		return
+	}
+	e.ID = uuid.New()
+	if e.Time.IsZero() {
+		e.Time = l.Clock.Now().UTC()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, s := range l.Sinks {
+		if err := s.Write(e); err != nil {
+			log.Errorf("Failed to write audit event %s: %v", e, err)
+		}
+	}
+}
+
+// nextPageToken is the opaque token EventRepo implementations return for
+// listing the next page of events.
+type nextPageToken struct {
+	Filter     EventFilter
+	MaxResults int
+	Offset     int
+}
+
+func EncodeNextPageToken(filter EventFilter, maxResults int, offset int) (string, error) {
+	b, err := json.Marshal(&nextPageToken{
+		Filter:     filter,
+		MaxResults: maxResults,
+		Offset:     offset,
+	})
+	if err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(b), nil
+}
+
+func DecodeNextPageToken(tok string) (EventFilter, int, int, error) {
+	b, err := base64.URLEncoding.DecodeString(tok)
+	if err != nil {
+		return EventFilter{}, 0, 0, err
+	}
+
+	var npt nextPageToken
+	if err := json.Unmarshal(b, &npt); err != nil {
+		return EventFilter{}, 0, 0, err
+	}
+	return npt.Filter, npt.MaxResults, npt.Offset, nil
+}
@@ -0,0 +1,161 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+type memSink []Event
+
+func (s *memSink) Write(e Event) error {
+	*s = append(*s, e)
+	return nil
+}
+
+type failingSink struct{}
+
+func (failingSink) Write(e Event) error {
+	return errors.New("sink unavailable")
+}
+
+func TestLoggerRecord(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	var a, b memSink
+	l := NewLogger(&a, failingSink{}, &b)
+	l.Clock = clock
+
+	l.Record(Event{Type: EventLoginSucceeded, UserID: "elroy", IP: "10.0.0.1"})
+	then := time.Unix(1460000000, 0).UTC()
+	l.Record(Event{Type: EventTokenIssued, Time: then})
+
+	if len(a) != 2 {
+		t.Fatalf("want 2 events, got %d", len(a))
+	}
+	// A failing sink doesn't keep the event from the others.
+	if diff := pretty.Compare(a, b); diff != "" {
+		t.Errorf("Compare(a, b) = %v", diff)
+	}
+
+	if a[0].ID == "" || a[0].ID == a[1].ID {
+		t.Errorf("want distinct IDs, got %q and %q", a[0].ID, a[1].ID)
+	}
+	if !a[0].Time.Equal(clock.Now()) {
+		t.Errorf("want time=%v, got %v", clock.Now(), a[0].Time)
+	}
+	if !a[1].Time.Equal(then) {
+		t.Errorf("want time=%v, got %v", then, a[1].Time)
+	}
+}
+
+func TestNilLoggerRecord(t *testing.T) {
+	var l *Logger
+	l.Record(Event{Type: EventLoginFailed})
+}
+
+func TestEventString(t *testing.T) {
+	e := Event{
+		Type:        EventLoginFailed,
+		ConnectorID: "local",
+		IP:          "10.0.0.1",
+		Details:     map[string]string{"reason": "bad password", "account": "elroy@example.com"},
+	}
+	want := `login.failed connector="local" ip="10.0.0.1" account="elroy@example.com" reason="bad password"`
+	if got := e.String(); got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+}
+
+func TestWriterSink(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewWriterSink(&buf)
+	events := []Event{
+		{ID: "1", Type: EventAdminClientDeleted, Time: time.Unix(1460000000, 0).UTC(), ClientID: "XXX"},
+		{ID: "2", Type: EventTokenIssued, Time: time.Unix(1460000001, 0).UTC(), Details: map[string]string{"grant_type": "authorization_code"}},
+	}
+	for _, e := range events {
+		if err := s.Write(e); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	var got []Event
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var e Event
+		if err := dec.Decode(&e); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got = append(got, e)
+	}
+	if diff := pretty.Compare(events, got); diff != "" {
+		t.Errorf("Compare(want, got) = %v", diff)
+	}
+}
+
+func TestConfigLogger(t *testing.T) {
+	tests := []struct {
+		cfg       Config
+		repo      EventRepo
+		wantSinks int
+		wantErr   bool
+	}{
+		{cfg: Config{}, wantSinks: 0},
+		{cfg: Config{Sinks: []string{SinkLog}}, wantSinks: 1},
+		{cfg: Config{Sinks: []string{SinkLog, SinkDB}}, repo: memRepo{}, wantSinks: 2},
+		{cfg: Config{Sinks: []string{SinkDB}}, wantErr: true},
+		{cfg: Config{Sinks: []string{SinkFile}}, wantErr: true},
+		{cfg: Config{Sinks: []string{"kafka"}}, wantErr: true},
+	}
+
+	for i, tt := range tests {
+		l, err := tt.cfg.Logger(tt.repo)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("case %d: want non-nil error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if len(l.Sinks) != tt.wantSinks {
+			t.Errorf("case %d: want %d sinks, got %d", i, tt.wantSinks, len(l.Sinks))
+		}
+	}
+}
+
+type memRepo struct{}
+
+func (memRepo) Write(e Event) error {
+	return nil
+}
+
+func (memRepo) List(filter EventFilter, maxResults int, nextPageToken string) ([]Event, string, error) {
+	return nil, "", nil
+}
+
+func TestNextPageToken(t *testing.T) {
+	filter := EventFilter{Type: EventLoginFailed, UserID: "elroy"}
+	tok, err := EncodeNextPageToken(filter, 10, 20)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	gotFilter, maxResults, offset, err := DecodeNextPageToken(tok)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotFilter != filter || maxResults != 10 || offset != 20 {
+		t.Errorf("want %v, 10, 20, got %v, %d, %d", filter, gotFilter, maxResults, offset)
+	}
+
+	if _, _, _, err := DecodeNextPageToken("not a token"); err == nil {
+		t.Errorf("want non-nil error for invalid token")
+	}
+}
@@ -0,0 +1,100 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/coreos/dex/pkg/log"
+)
+
+// The names of the sinks a Config can choose.
+const (
+	SinkLog    = "log"
+	SinkFile   = "file"
+	SinkSyslog = "syslog"
+	SinkDB     = "db"
+)
+
+// LogSink writes events to the process log as "audit:" lines.
+type LogSink struct{}
+
+func (LogSink) Write(e Event) error {
+	log.Infof("audit: %s", e)
+	return nil
+}
+
+// WriterSink writes events as JSON, one per line.
+type WriterSink struct {
+	w io.Writer
+}
+
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+func (s *WriterSink) Write(e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = s.w.Write(append(b, '\n'))
+	return err
+}
+
+// NewFileSink returns a WriterSink appending to the file at path, which is
+// created if it doesn't exist.
+func NewFileSink(path string) (*WriterSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return NewWriterSink(f), nil
+}
+
+// Config chooses the sinks of a Logger.
+type Config struct {
+	// Sinks names the sinks to write events to, see SinkLog, SinkFile,
+	// SinkSyslog and SinkDB.
+	Sinks []string
+
+	// File is the path of the JSON-lines file SinkFile appends to.
+	File string
+}
+
+// Logger returns a Logger writing to the configured sinks. The repo is used
+// as SinkDB, and may be nil if that sink isn't chosen.
+func (c Config) Logger(repo EventRepo) (*Logger, error) {
+	var sinks []Sink
+	for _, name := range c.Sinks {
+		switch name {
+		case SinkLog:
+			sinks = append(sinks, LogSink{})
+		case SinkFile:
+			if c.File == "" {
+				return nil, errors.New("missing file for audit sink \"file\"")
+			}
+			s, err := NewFileSink(c.File)
+			if err != nil {
+				return nil, fmt.Errorf("opening audit log file: %v", err)
+			}
+			sinks = append(sinks, s)
+		case SinkSyslog:
+			s, err := NewSyslogSink()
+			if err != nil {
+				return nil, fmt.Errorf("connecting to syslog: %v", err)
+			}
+			sinks = append(sinks, s)
+		case SinkDB:
+			if repo == nil {
+				return nil, errors.New("audit sink \"db\" requires a database")
+			}
+			sinks = append(sinks, repo)
+		default:
+			return nil, fmt.Errorf("unknown audit sink %q", name)
+		}
+	}
+	return NewLogger(sinks...), nil
+}
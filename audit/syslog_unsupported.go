@@ -0,0 +1,17 @@
+// +build windows plan9
+
+package audit
+
+import (
+	"errors"
+)
+
+type SyslogSink struct{}
+
+func NewSyslogSink() (*SyslogSink, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
+
+func (s *SyslogSink) Write(e Event) error {
+	return errors.New("syslog is not supported on this platform")
+}
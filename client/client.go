@@ -1,12 +1,14 @@
 package client
 
 import (
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"io"
 	"net/url"
 	"reflect"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 
@@ -39,10 +41,41 @@ func HashSecret(creds oidc.ClientCredentials) ([]byte, error) {
 	return hashed, nil
 }
 
+// HashRegistrationToken hashes a registration access token for storage.
+// Registration access tokens carry enough entropy that a fast hash will do.
+func HashRegistrationToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
+
 type Client struct {
 	Credentials oidc.ClientCredentials
 	Metadata    oidc.ClientMetadata
 	Admin       bool
+
+	// Public indicates a client that can't keep its secret confidential,
+	// such as a native or mobile app. Public clients may exchange codes at
+	// the token endpoint without a secret, provided PKCE is used.
+	Public bool
+
+	// RequireMFA requires users logging in to the client with a password to
+	// use a second factor.
+	RequireMFA bool
+
+	// FirstParty clients are trusted by the operator: their users aren't
+	// asked to consent to the scopes they request.
+	FirstParty bool
+
+	// PostLogoutRedirectURIs are the URLs the client may ask the user-agent
+	// to be sent back to once the user logged out.
+	PostLogoutRedirectURIs []url.URL
+
+	// FrontChannelLogoutURI is loaded in an iframe of the logout page, so
+	// that the client can clear the user's session with it.
+	FrontChannelLogoutURI *url.URL
+
+	// BackChannelLogoutURI is sent a logout token when the user logs out.
+	BackChannelLogoutURI *url.URL
 }
 
 type ClientRepo interface {
@@ -59,7 +92,32 @@ type ClientRepo interface {
 	// in a ClientCredentials struct along with the provided ID.
 	New(tx repo.Transaction, client Client) (*oidc.ClientCredentials, error)
 
+	// Update changes the metadata and settings of a Client. Its secret is
+	// left alone.
 	Update(tx repo.Transaction, client Client) error
+
+	// Delete removes a Client from the repo, and revokes the access and
+	// refresh tokens issued to it.
+	Delete(tx repo.Transaction, clientID string) error
+
+	// SetSecret replaces the (base64 encoded) secret of a Client. The
+	// replaced secret stays valid until previousExpiresAt; if that's the
+	// zero time, it's invalid at once.
+	SetSecret(tx repo.Transaction, clientID, secret string, previousExpiresAt time.Time) error
+
+	// GetPreviousSecret returns the hashed secret replaced by the last
+	// SetSecret, and until when it stays valid. The hash is nil if there's
+	// none.
+	GetPreviousSecret(tx repo.Transaction, clientID string) ([]byte, time.Time, error)
+
+	// SetRegistrationToken replaces the registration access token a Client
+	// manages its own registration with, see RFC 7592. Only its hash is
+	// stored. If token is empty, the Client can't manage its registration.
+	SetRegistrationToken(tx repo.Transaction, clientID, token string) error
+
+	// GetRegistrationToken returns the hashed registration access token of
+	// a Client, or nil if it has none.
+	GetRegistrationToken(tx repo.Transaction, clientID string) ([]byte, error)
 }
 
 // ValidRedirectURL returns the passed in URL if it is present in the redirectURLs list, and returns an error otherwise.
@@ -87,11 +145,25 @@ func ValidRedirectURL(rURL *url.URL, redirectURLs []url.URL) (url.URL, error) {
 	return url.URL{}, ErrorInvalidRedirectURL
 }
 
+// ValidLogoutURI reports whether u can be registered as a logout URI or post
+// logout redirect URI of a client: it must be an absolute http or https URL
+// without a fragment.
+func ValidLogoutURI(u url.URL) bool {
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && u.Fragment == ""
+}
+
 func ClientsFromReader(r io.Reader) ([]Client, error) {
 	var c []struct {
 		ID           string   `json:"id"`
 		Secret       string   `json:"secret"`
 		RedirectURLs []string `json:"redirectURLs"`
+		Public       bool     `json:"public"`
+		RequireMFA   bool     `json:"requireMFA"`
+		FirstParty   bool     `json:"firstParty"`
+
+		PostLogoutRedirectURLs []string `json:"postLogoutRedirectURLs"`
+		FrontChannelLogoutURL  string   `json:"frontChannelLogoutURL"`
+		BackChannelLogoutURL   string   `json:"backChannelLogoutURL"`
 	}
 	if err := json.NewDecoder(r).Decode(&c); err != nil {
 		return nil, err
@@ -112,6 +184,22 @@ func ClientsFromReader(r io.Reader) ([]Client, error) {
 			}
 			redirectURIs[j] = *uri
 		}
+		var postLogoutRedirectURIs []url.URL
+		for _, u := range client.PostLogoutRedirectURLs {
+			uri, err := url.Parse(u)
+			if err != nil {
+				return nil, err
+			}
+			postLogoutRedirectURIs = append(postLogoutRedirectURIs, *uri)
+		}
+		frontChannelLogoutURI, err := parseOptionalURL(client.FrontChannelLogoutURL)
+		if err != nil {
+			return nil, err
+		}
+		backChannelLogoutURI, err := parseOptionalURL(client.BackChannelLogoutURL)
+		if err != nil {
+			return nil, err
+		}
 
 		clients[i] = Client{
 			Credentials: oidc.ClientCredentials{
@@ -121,7 +209,21 @@ func ClientsFromReader(r io.Reader) ([]Client, error) {
 			Metadata: oidc.ClientMetadata{
 				RedirectURIs: redirectURIs,
 			},
+			Public:     client.Public,
+			RequireMFA: client.RequireMFA,
+			FirstParty: client.FirstParty,
+
+			PostLogoutRedirectURIs: postLogoutRedirectURIs,
+			FrontChannelLogoutURI:  frontChannelLogoutURI,
+			BackChannelLogoutURI:   backChannelLogoutURI,
 		}
 	}
 	return clients, nil
 }
+
+func parseOptionalURL(s string) (*url.URL, error) {
+	if s == "" {
+		return nil, nil
+	}
+	return url.Parse(s)
+}
@@ -26,6 +26,15 @@ var (
   "redirectURLs": ["https://client2.example.com","https://client2_a.example.com"]
 }`
 
+	logoutClient = `{
+  "id": "my_id",
+  "secret": "` + goodSecret1 + `",
+  "redirectURLs": ["https://client.example.com"],
+  "postLogoutRedirectURLs": ["https://client.example.com/logged-out"],
+  "frontChannelLogoutURL": "https://client.example.com/frontchannel-logout",
+  "backChannelLogoutURL": "https://client.example.com/backchannel-logout"
+}`
+
 	badURLClient = `{ 
   "id": "my_id",
   "secret": "` + goodSecret1 + `",
@@ -102,6 +111,27 @@ func TestClientsFromReader(t *testing.T) {
 				},
 			},
 		},
+		{
+			json: "[" + logoutClient + "]",
+			want: []Client{
+				{
+					Credentials: oidc.ClientCredentials{
+						ID:     "my_id",
+						Secret: goodSecret1,
+					},
+					Metadata: oidc.ClientMetadata{
+						RedirectURIs: []url.URL{
+							mustParseURL(t, "https://client.example.com"),
+						},
+					},
+					PostLogoutRedirectURIs: []url.URL{
+						mustParseURL(t, "https://client.example.com/logged-out"),
+					},
+					FrontChannelLogoutURI: mustParseURLPtr(t, "https://client.example.com/frontchannel-logout"),
+					BackChannelLogoutURI:  mustParseURLPtr(t, "https://client.example.com/backchannel-logout"),
+				},
+			},
+		},
 		{
 			json:    "[" + badURLClient + "]",
 			wantErr: true,
@@ -148,3 +178,8 @@ func mustParseURL(t *testing.T, s string) url.URL {
 	}
 	return *u
 }
+
+func mustParseURLPtr(t *testing.T, s string) *url.URL {
+	u := mustParseURL(t, s)
+	return &u
+}
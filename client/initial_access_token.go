@@ -0,0 +1,74 @@
+package client
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"time"
+)
+
+const (
+	DefaultInitialAccessTokenPayloadLength = 32
+
+	// The default lifetime of initial access tokens.
+	DefaultInitialAccessTokenValidityWindow = 24 * time.Hour
+)
+
+var (
+	ErrorInvalidInitialAccessToken = errors.New("invalid initial access token")
+)
+
+// InitialAccessToken allows registering clients dynamically when the
+// registration endpoint is closed to the public, see RFC 7591 Section 3.
+// Admins hand them out to the developers they trust.
+type InitialAccessToken struct {
+	// ID identifies the token without revealing it.
+	ID string
+
+	CreatedAt time.Time
+	ExpiresAt time.Time
+
+	// MaxUses is the number of clients the token can register. If zero,
+	// it can register any number of clients until it expires.
+	MaxUses int
+
+	// Uses is the number of clients the token has registered.
+	Uses int
+}
+
+type InitialAccessTokenGenerator func() (string, error)
+
+func (g InitialAccessTokenGenerator) Generate() (string, error) {
+	return g()
+}
+
+func DefaultInitialAccessTokenGenerator() (string, error) {
+	b := make([]byte, DefaultInitialAccessTokenPayloadLength)
+	n, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	if n != DefaultInitialAccessTokenPayloadLength {
+		return "", errors.New("unable to read enough random bytes")
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+type InitialAccessTokenRepo interface {
+	// Create generates and stores a new initial access token with the
+	// expiry and maximum uses of the given InitialAccessToken. On success
+	// the token will be returned along with its ID.
+	Create(iat InitialAccessToken) (token string, id string, err error)
+
+	// All returns all initial access tokens, in order of creation.
+	All() ([]InitialAccessToken, error)
+
+	// Use counts the registration of a client with the given token, or
+	// returns ErrorInvalidInitialAccessToken if the token is unknown,
+	// expired or used up.
+	Use(token string) error
+
+	// Delete revokes the initial access token with the given ID, or returns
+	// ErrorNotFound if there's none.
+	Delete(id string) error
+}
@@ -1,8 +1,10 @@
 package manager
 
 import (
+	"crypto/subtle"
 	"encoding/base64"
 	"fmt"
+	"time"
 
 	"errors"
 
@@ -11,6 +13,7 @@ import (
 	"github.com/coreos/dex/pkg/log"
 	"github.com/coreos/dex/repo"
 	"github.com/coreos/go-oidc/oidc"
+	"github.com/jonboulle/clockwork"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -42,11 +45,13 @@ type ClientManager struct {
 	begin             repo.TransactionFactory
 	secretGenerator   SecretGenerator
 	clientIDGenerator func(string) (string, error)
+	clock             clockwork.Clock
 }
 
 type ManagerOptions struct {
 	SecretGenerator   func() ([]byte, error)
 	ClientIDGenerator func(string) (string, error)
+	Clock             clockwork.Clock
 }
 
 func NewClientManager(clientRepo client.ClientRepo, txnFactory repo.TransactionFactory, options ManagerOptions) *ClientManager {
@@ -56,11 +61,15 @@ func NewClientManager(clientRepo client.ClientRepo, txnFactory repo.TransactionF
 	if options.ClientIDGenerator == nil {
 		options.ClientIDGenerator = oidc.GenClientID
 	}
+	if options.Clock == nil {
+		options.Clock = clockwork.NewRealClock()
+	}
 	return &ClientManager{
 		clientRepo:        clientRepo,
 		begin:             txnFactory,
 		secretGenerator:   options.SecretGenerator,
 		clientIDGenerator: options.ClientIDGenerator,
+		clock:             options.Clock,
 	}
 }
 
@@ -122,6 +131,62 @@ func (m *ClientManager) New(cli client.Client) (*oidc.ClientCredentials, error)
 	return &creds, nil
 }
 
+// Register creates a client like New does, and a registration access token
+// the client can read, update and delete its own registration with, see
+// RFC 7592. It's meant for dynamically registered clients.
+func (m *ClientManager) Register(cli client.Client) (*oidc.ClientCredentials, string, error) {
+	tx, err := m.begin()
+	if err != nil {
+		return nil, "", err
+	}
+	defer tx.Rollback()
+
+	c, err := m.generateClientCredentials(cli)
+	if err != nil {
+		return nil, "", err
+	}
+	creds := c.Credentials
+
+	if _, err := m.clientRepo.New(tx, c); err != nil {
+		return nil, "", err
+	}
+
+	b, err := m.secretGenerator()
+	if err != nil {
+		return nil, "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	if err := m.clientRepo.SetRegistrationToken(tx, creds.ID, token); err != nil {
+		return nil, "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, "", err
+	}
+	return &creds, token, nil
+}
+
+// AuthenticateRegistrationToken checks the registration access token of a
+// client. Clients which weren't registered dynamically have none, and never
+// authenticate.
+func (m *ClientManager) AuthenticateRegistrationToken(clientID, token string) (bool, error) {
+	if token == "" {
+		return false, nil
+	}
+	hashed, err := m.clientRepo.GetRegistrationToken(nil, clientID)
+	if err != nil {
+		if err == client.ErrorNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	if hashed == nil {
+		return false, nil
+	}
+	ok := subtle.ConstantTimeCompare(hashed, client.HashRegistrationToken(token)) == 1
+	return ok, nil
+}
+
 func (m *ClientManager) Get(id string) (client.Client, error) {
 	return m.clientRepo.Get(nil, id)
 }
@@ -173,6 +238,73 @@ func (m *ClientManager) SetDexAdmin(clientID string, isAdmin bool) error {
 	return nil
 }
 
+// Update replaces the metadata and settings of a client with those of cli.
+// The client's secret is left alone.
+func (m *ClientManager) Update(cli client.Client) error {
+	tx, err := m.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := m.clientRepo.Update(tx, cli); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (m *ClientManager) Delete(clientID string) error {
+	tx, err := m.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := m.clientRepo.Delete(tx, clientID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RotateSecret generates a new secret for a client and returns its
+// credentials. The replaced secret keeps working for the overlap, giving
+// the client's operators time to roll out the new one; if the overlap is
+// zero it stops working at once.
+func (m *ClientManager) RotateSecret(clientID string, overlap time.Duration) (*oidc.ClientCredentials, error) {
+	if overlap < 0 {
+		return nil, errors.New("negative secret overlap")
+	}
+
+	tx, err := m.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	secret, err := m.secretGenerator()
+	if err != nil {
+		return nil, err
+	}
+	creds := oidc.ClientCredentials{
+		ID:     clientID,
+		Secret: base64.URLEncoding.EncodeToString(secret),
+	}
+
+	var previousExpiresAt time.Time
+	if overlap > 0 {
+		previousExpiresAt = m.clock.Now().Add(overlap)
+	}
+	if err := m.clientRepo.SetSecret(tx, clientID, creds.Secret, previousExpiresAt); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &creds, nil
+}
+
+// Authenticate checks the secret of a client. While a rotated secret's
+// overlap lasts, the replaced secret is accepted as well.
 func (m *ClientManager) Authenticate(creds oidc.ClientCredentials) (bool, error) {
 	clientSecret, err := m.clientRepo.GetSecret(nil, creds.ID)
 	if err != nil || clientSecret == nil {
@@ -185,7 +317,15 @@ func (m *ClientManager) Authenticate(creds oidc.ClientCredentials) (bool, error)
 		return false, nil
 	}
 
-	ok := CompareHashAndPassword(clientSecret, dec) == nil
+	if CompareHashAndPassword(clientSecret, dec) == nil {
+		return true, nil
+	}
+
+	previous, expiresAt, err := m.clientRepo.GetPreviousSecret(nil, creds.ID)
+	if err != nil || previous == nil || !m.clock.Now().Before(expiresAt) {
+		return false, nil
+	}
+	ok := CompareHashAndPassword(previous, dec) == nil
 	return ok, nil
 }
 
@@ -5,10 +5,12 @@ import (
 	"fmt"
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/coreos/dex/client"
 	"github.com/coreos/dex/db"
 	"github.com/coreos/go-oidc/oidc"
+	"github.com/jonboulle/clockwork"
 )
 
 type testFixtures struct {
@@ -163,3 +165,173 @@ func TestAuthenticate(t *testing.T) {
 		}
 	}
 }
+
+func TestUpdate(t *testing.T) {
+	f := makeTestFixtures()
+	cli, err := f.mgr.Get("client.example.com")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	cli.Metadata.RedirectURIs = []url.URL{
+		{Scheme: "https", Host: "client.example.com", Path: "/callback"},
+	}
+	cli.Credentials.Secret = ""
+	if err := f.mgr.Update(cli); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	md, err := f.mgr.Metadata("client.example.com")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if got := md.RedirectURIs[0].String(); got != "https://client.example.com/callback" {
+		t.Errorf("want updated redirect URI, got=%q", got)
+	}
+
+	// The secret must survive the update.
+	ok, err := f.mgr.Authenticate(oidc.ClientCredentials{ID: "client.example.com", Secret: goodSecret})
+	if err != nil || !ok {
+		t.Errorf("want authentication with the original secret, got ok=%t err=%v", ok, err)
+	}
+
+	cli.Credentials.ID = "nonexistent"
+	if err := f.mgr.Update(cli); err != client.ErrorNotFound {
+		t.Errorf("want err=%v, got=%v", client.ErrorNotFound, err)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	f := makeTestFixtures()
+	if err := f.mgr.Delete("client.example.com"); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if _, err := f.mgr.Get("client.example.com"); err != client.ErrorNotFound {
+		t.Errorf("want err=%v, got=%v", client.ErrorNotFound, err)
+	}
+	if err := f.mgr.Delete("client.example.com"); err != client.ErrorNotFound {
+		t.Errorf("want err=%v, got=%v", client.ErrorNotFound, err)
+	}
+}
+
+func TestRotateSecret(t *testing.T) {
+	dbMap := db.NewMemDB()
+	clock := clockwork.NewFakeClock()
+	n := 0
+	secGen := func() ([]byte, error) {
+		n++
+		return []byte(fmt.Sprintf("secret-%d", n)), nil
+	}
+	mgr := NewClientManager(db.NewClientRepo(dbMap), db.TransactionFactory(dbMap), ManagerOptions{SecretGenerator: secGen, Clock: clock})
+	original, err := mgr.New(client.Client{
+		Metadata: oidc.ClientMetadata{
+			RedirectURIs: []url.URL{
+				{Scheme: "http", Host: "example.com", Path: "/cb"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	authenticates := func(creds oidc.ClientCredentials) bool {
+		ok, err := mgr.Authenticate(creds)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		return ok
+	}
+
+	rotated, err := mgr.RotateSecret(original.ID, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if rotated.ID != original.ID || rotated.Secret == original.Secret {
+		t.Fatalf("want a new secret for the same client, got %#v", rotated)
+	}
+	if !authenticates(*rotated) {
+		t.Errorf("want new secret valid")
+	}
+	if !authenticates(*original) {
+		t.Errorf("want old secret valid during the overlap")
+	}
+
+	clock.Advance(time.Hour)
+	if !authenticates(*rotated) {
+		t.Errorf("want new secret valid")
+	}
+	if authenticates(*original) {
+		t.Errorf("want old secret invalid after the overlap")
+	}
+
+	// Without an overlap, the replaced secret is invalid at once.
+	again, err := mgr.RotateSecret(original.ID, 0)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if !authenticates(*again) {
+		t.Errorf("want new secret valid")
+	}
+	if authenticates(*rotated) {
+		t.Errorf("want replaced secret invalid")
+	}
+
+	if _, err := mgr.RotateSecret("nonexistent", time.Hour); err != client.ErrorNotFound {
+		t.Errorf("want err=%v, got=%v", client.ErrorNotFound, err)
+	}
+	if _, err := mgr.RotateSecret(original.ID, -time.Hour); err == nil {
+		t.Errorf("want non-nil error for a negative overlap")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	f := makeTestFixtures()
+	creds, token, err := f.mgr.Register(client.Client{
+		Metadata: oidc.ClientMetadata{
+			RedirectURIs: []url.URL{
+				{Scheme: "https", Host: "registered.example.com", Path: "/cb"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if token == "" {
+		t.Fatalf("want a registration access token")
+	}
+
+	ok, err := f.mgr.Authenticate(*creds)
+	if err != nil || !ok {
+		t.Errorf("want authentication with the issued secret, got ok=%t err=%v", ok, err)
+	}
+
+	tests := []struct {
+		clientID string
+		token    string
+		want     bool
+	}{
+		{creds.ID, token, true},
+		{creds.ID, token + "x", false},
+		{creds.ID, "", false},
+		// Clients which weren't registered dynamically have no token.
+		{"client.example.com", token, false},
+		{"nonexistent", token, false},
+	}
+	for i, tt := range tests {
+		got, err := f.mgr.AuthenticateRegistrationToken(tt.clientID, tt.token)
+		if err != nil {
+			t.Errorf("case %d: unexpected err: %v", i, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("case %d: want=%t got=%t", i, tt.want, got)
+		}
+	}
+
+	// Deleting the client invalidates its token.
+	if err := f.mgr.Delete(creds.ID); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if ok, _ := f.mgr.AuthenticateRegistrationToken(creds.ID, token); ok {
+		t.Errorf("want registration access token of deleted client invalid")
+	}
+}
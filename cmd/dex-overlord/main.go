@@ -12,14 +12,17 @@ import (
 	"time"
 
 	"github.com/coreos/go-oidc/key"
+	"github.com/coreos/pkg/flagutil"
 	"github.com/go-gorp/gorp"
 
 	"github.com/coreos/dex/admin"
+	"github.com/coreos/dex/audit"
 	clientmanager "github.com/coreos/dex/client/manager"
 	"github.com/coreos/dex/db"
 	pflag "github.com/coreos/dex/pkg/flag"
 	"github.com/coreos/dex/pkg/log"
 	ptime "github.com/coreos/dex/pkg/time"
+	"github.com/coreos/dex/refresh"
 	"github.com/coreos/dex/server"
 	"github.com/coreos/dex/user/manager"
 )
@@ -45,6 +48,14 @@ func main() {
 	keyPeriod := fs.Duration("key-period", 24*time.Hour, "length of time for-which a given key will be valid")
 	gcInterval := fs.Duration("gc-interval", time.Hour, "length of time between garbage collection runs")
 
+	auditSinks := flagutil.StringSliceFlag{audit.SinkLog}
+	fs.Var(&auditSinks, "audit-sinks", "comma separated list of where audit events of admin actions are written to: log, file, syslog or db")
+	auditFile := fs.String("audit-file", "", "the file the \"file\" audit sink appends events to, as JSON lines")
+	auditEventRetention := fs.Duration("audit-event-retention", db.DefaultAuditEventRetention, "how long audit events are kept in the database")
+
+	refreshTokenLifetime := fs.Duration("refresh-token-lifetime", 0, "the --refresh-token-lifetime of the workers; refresh tokens which have expired are garbage collected")
+	refreshTokenIdleTimeout := fs.Duration("refresh-token-idle-timeout", 0, "the --refresh-token-idle-timeout of the workers; refresh tokens which have expired are garbage collected")
+
 	adminListen := fs.String("admin-listen", "http://127.0.0.1:5557", "scheme, host and port for listening for administrative operation requests ")
 
 	adminAPISecret := pflag.NewBase64(server.AdminAPISecretLength)
@@ -99,6 +110,7 @@ func main() {
 	if _, ok := dbc.Dialect.(gorp.PostgresDialect); !ok {
 		log.Fatal("only postgres backend supported for multi server configurations")
 	}
+	db.RegisterPoolMetrics(dbc)
 
 	if *dbMigrate {
 		var sleep time.Duration
@@ -122,8 +134,19 @@ func main() {
 		pwiRepo, connCfgRepo, db.TransactionFactory(dbc), manager.ManagerOptions{})
 	clientManager := clientmanager.NewClientManager(clientRepo, db.TransactionFactory(dbc), clientmanager.ManagerOptions{})
 	connectorConfigRepo := db.NewConnectorConfigRepo(dbc)
-
-	adminAPI := admin.NewAdminAPI(userRepo, pwiRepo, clientRepo, connectorConfigRepo, userManager, clientManager, *localConnectorID)
+	groupManager := manager.NewGroupManager(db.NewGroupRepo(dbc), userRepo, db.TransactionFactory(dbc))
+	loginAttemptRepo := db.NewLoginAttemptRepo(dbc)
+	mfaEnrollmentRepo, err := db.NewMFAEnrollmentRepo(dbc, keySecrets.BytesSlice()...)
+	if err != nil {
+		log.Fatalf(err.Error())
+	}
+	auditEventRepo := db.NewAuditEventRepo(dbc)
+	auditCfg := audit.Config{Sinks: auditSinks, File: *auditFile}
+	auditLogger, err := auditCfg.Logger(auditEventRepo)
+	if err != nil {
+		log.Fatalf("Unable to configure audit sinks: %v", err)
+	}
+	adminAPI := admin.NewAdminAPI(userRepo, pwiRepo, clientRepo, connectorConfigRepo, userManager, clientManager, groupManager, loginAttemptRepo, mfaEnrollmentRepo, db.NewInitialAccessTokenRepo(dbc), auditLogger, auditEventRepo, *localConnectorID)
 	kRepo, err := db.NewPrivateKeySetRepo(dbc, *useOldFormat, keySecrets.BytesSlice()...)
 	if err != nil {
 		log.Fatalf(err.Error())
@@ -158,7 +181,10 @@ func main() {
 		Handler: h,
 	}
 
-	gc := db.NewGarbageCollector(dbc, *gcInterval)
+	gc := db.NewGarbageCollector(dbc, *gcInterval, *auditEventRetention, refresh.RepoOptions{
+		AbsoluteLifetime: *refreshTokenLifetime,
+		IdleTimeout:      *refreshTokenIdleTimeout,
+	})
 
 	log.Infof("Binding to %s...", httpsrv.Addr)
 	go func() {
@@ -14,12 +14,17 @@ import (
 	"github.com/coreos/pkg/flagutil"
 	"github.com/gorilla/handlers"
 
+	"github.com/coreos/dex/access"
+	"github.com/coreos/dex/audit"
 	"github.com/coreos/dex/connector"
 	"github.com/coreos/dex/db"
+	"github.com/coreos/dex/lockout"
 	pflag "github.com/coreos/dex/pkg/flag"
 	"github.com/coreos/dex/pkg/log"
 	ptime "github.com/coreos/dex/pkg/time"
 	"github.com/coreos/dex/server"
+	"github.com/coreos/dex/session"
+	"github.com/coreos/dex/user"
 )
 
 var version = "DEV"
@@ -48,6 +53,36 @@ func main() {
 
 	enableRegistration := fs.Bool("enable-registration", false, "Allows users to self-register")
 	enableClientRegistration := fs.Bool("enable-client-registration", false, "Allow dynamic registration of clients")
+	clientRegistrationRequireToken := fs.Bool("client-registration-require-initial-access-token", false, "only allow dynamic registration of clients with an initial access token issued through the admin API")
+	var clientRegistrationSchemes, clientRegistrationHosts flagutil.StringSliceFlag
+	fs.Var(&clientRegistrationSchemes, "client-registration-redirect-uri-schemes", "comma separated list of the schemes redirect and logout URIs of dynamically registered clients may use; any scheme if empty")
+	fs.Var(&clientRegistrationHosts, "client-registration-redirect-uri-hosts", "comma separated list of the hosts redirect and logout URIs of dynamically registered clients may point to, where \"*.example.com\" matches any subdomain of example.com; any host if empty")
+
+	accessTokenLifetime := fs.Duration("access-token-lifetime", access.DefaultAccessTokenValidityWindow, "how long issued access tokens are valid for")
+	accessTokenAudience := fs.String("access-token-audience", "", "the audience access tokens are issued for; defaults to the issuer URL")
+	refreshTokenLifetime := fs.Duration("refresh-token-lifetime", 0, "how long a refresh token, and the tokens it is exchanged for, can be used after the user signed in; 0 means forever")
+	refreshTokenIdleTimeout := fs.Duration("refresh-token-idle-timeout", 0, "how long a refresh token stays valid if it isn't used; 0 means forever")
+	browserSessionLifetime := fs.Duration("browser-session-lifetime", session.DefaultBrowserSessionValidityWindow, "how long users stay signed in to dex, so that other clients can log them in without asking them to authenticate again")
+	accountClientID := fs.String("account-client-id", "", "the client the account portal at /account logs users in with; it must have <issuer>/account/callback as a redirect URI, and the portal is disabled if empty")
+	autoLinkTrustedEmails := fs.Bool("auto-link-trusted-emails", false, "link identities from connectors which are trusted email providers to existing users with the same verified email, without asking the users to prove they own those accounts")
+
+	loginMaxFailures := fs.Int("login-max-failures", lockout.DefaultMaxAccountFailures, "the number of consecutive failed password logins after which an account is locked out")
+	loginMaxIPFailures := fs.Int("login-max-ip-failures", lockout.DefaultMaxIPFailures, "the number of consecutive failed password logins after which an IP is locked out")
+	loginLockoutDuration := fs.Duration("login-lockout-duration", lockout.DefaultLockoutDuration, "how long accounts and IPs are locked out for after too many failed password logins")
+
+	requireMFA := fs.Bool("require-mfa", false, "require all local users to log in with a second factor, rather than only those of clients which require it")
+
+	passwordHash := fs.String("password-hash", "bcrypt", "the algorithm new passwords are hashed with, one of bcrypt, scrypt or argon2id, optionally followed by parameters, e.g. \"argon2id:t=3,m=65536,p=4\"; older hashes are replaced when their users log in")
+	passwordMinLength := fs.Int("password-min-length", user.DefaultPasswordPolicy.MinLength, "the minimum number of characters of passwords")
+	passwordMinCharClasses := fs.Int("password-min-char-classes", 0, "the number of kinds of characters passwords must use, out of lower case letters, upper case letters, digits and others")
+	passwordBreachedList := fs.String("password-breached-list", "", "a file of passwords, or of SHA-1 hashes of passwords, which may not be used, one per line")
+	passwordHistory := fs.Int("password-history", 0, "the number of a user's most recent passwords which may not be used again")
+
+	auditSinks := flagutil.StringSliceFlag{audit.SinkLog}
+	fs.Var(&auditSinks, "audit-sinks", "comma separated list of where audit events are written to: log, file, syslog or db")
+	auditFile := fs.String("audit-file", "", "the file the \"file\" audit sink appends events to, as JSON lines")
+
+	connectorReloadInterval := fs.Duration("connector-reload-interval", 30*time.Second, "how often to check the database for changed connectors, which are then loaded without a restart; 0 disables reloading")
 
 	noDB := fs.Bool("no-db", false, "manage entities in-process w/o any encryption, used only for single-node testing")
 
@@ -125,6 +160,30 @@ func main() {
 		log.Fatalf("Only 'http' and 'https' schemes are supported")
 	}
 
+	hashAlgorithm, err := user.NewHashAlgorithm(*passwordHash)
+	if err != nil {
+		log.Fatalf("Invalid password hash %q: %v", *passwordHash, err)
+	}
+	user.PasswordHashAlgorithm = hashAlgorithm
+
+	passwordPolicy := user.PasswordPolicy{
+		MinLength:      *passwordMinLength,
+		MinCharClasses: *passwordMinCharClasses,
+		HistorySize:    *passwordHistory,
+	}
+	if *passwordBreachedList != "" {
+		f, err := os.Open(*passwordBreachedList)
+		if err != nil {
+			log.Fatalf("Unable to open breached password list: %v", err)
+		}
+		passwordPolicy.Breached, err = user.BreachedPasswordsFromReader(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("Unable to read breached password list: %v", err)
+		}
+		log.Infof("Loaded %d breached passwords", len(passwordPolicy.Breached))
+	}
+
 	scfg := server.ServerConfig{
 		IssuerURL:                *issuer,
 		TemplateDir:              *templates,
@@ -135,6 +194,35 @@ func main() {
 		IssuerLogoURL:            *issuerLogoURL,
 		EnableRegistration:       *enableRegistration,
 		EnableClientRegistration: *enableClientRegistration,
+		ClientRegistrationPolicy: server.ClientRegistrationPolicy{
+			RequireInitialAccessToken: *clientRegistrationRequireToken,
+			RedirectURISchemes:        clientRegistrationSchemes,
+			RedirectURIHosts:          clientRegistrationHosts,
+		},
+
+		AccessTokenValidityWindow: *accessTokenLifetime,
+		AccessTokenAudience:       *accessTokenAudience,
+		RefreshTokenLifetime:      *refreshTokenLifetime,
+		RefreshTokenIdleTimeout:   *refreshTokenIdleTimeout,
+
+		BrowserSessionValidityWindow: *browserSessionLifetime,
+		AccountClientID:              *accountClientID,
+		AutoLinkTrustedEmails:        *autoLinkTrustedEmails,
+
+		LoginMaxFailures:     *loginMaxFailures,
+		LoginMaxIPFailures:   *loginMaxIPFailures,
+		LoginLockoutDuration: *loginLockoutDuration,
+
+		RequireMFA: *requireMFA,
+
+		PasswordPolicy: &passwordPolicy,
+
+		ConnectorReloadInterval: *connectorReloadInterval,
+
+		Audit: audit.Config{
+			Sinks: auditSinks,
+			File:  *auditFile,
+		},
 	}
 
 	if *noDB {
@@ -39,7 +39,7 @@ func (cfg *BitbucketConnectorConfig) ConnectorType() string {
 	return BitbucketConnectorType
 }
 
-func (cfg *BitbucketConnectorConfig) Connector(ns url.URL, lf oidc.LoginFunc, tpls *template.Template) (Connector, error) {
+func (cfg *BitbucketConnectorConfig) Connector(ns url.URL, lf LoginFunc, tpls *template.Template) (Connector, error) {
 	ns.Path = path.Join(ns.Path, httpPathCallback)
 	oauth2Conn, err := newBitbucketConnector(cfg.ClientID, cfg.ClientSecret, ns.String())
 	if err != nil {
@@ -84,14 +84,14 @@ func (c *bitbucketOAuth2Connector) Client() *oauth2.Client {
 	return c.client
 }
 
-func (c *bitbucketOAuth2Connector) Identity(cli chttp.Client) (oidc.Identity, error) {
+func (c *bitbucketOAuth2Connector) Identity(cli chttp.Client) (oidc.Identity, []string, error) {
 	var user struct {
 		UUID        string `json:"uuid"`
 		Username    string `json:"username"`
 		DisplayName string `json:"display_name"`
 	}
 	if err := getAndDecode(cli, bitbucketAPIUserURL, &user); err != nil {
-		return oidc.Identity{}, fmt.Errorf("getting user info: %v", err)
+		return oidc.Identity{}, nil, fmt.Errorf("getting user info: %v", err)
 	}
 
 	name := user.DisplayName
@@ -107,7 +107,7 @@ func (c *bitbucketOAuth2Connector) Identity(cli chttp.Client) (oidc.Identity, er
 		} `json:"values"`
 	}
 	if err := getAndDecode(cli, bitbucketAPIEmailURL, &emails); err != nil {
-		return oidc.Identity{}, fmt.Errorf("getting user email: %v", err)
+		return oidc.Identity{}, nil, fmt.Errorf("getting user email: %v", err)
 	}
 	email := ""
 	for _, val := range emails.Values {
@@ -126,7 +126,7 @@ func (c *bitbucketOAuth2Connector) Identity(cli chttp.Client) (oidc.Identity, er
 		ID:    user.UUID,
 		Name:  name,
 		Email: email,
-	}, nil
+	}, nil, nil
 }
 
 func getAndDecode(cli chttp.Client, url string, v interface{}) error {
@@ -0,0 +1,317 @@
+package connector
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	chttp "github.com/coreos/go-oidc/http"
+	"github.com/coreos/go-oidc/oauth2"
+	"github.com/coreos/go-oidc/oidc"
+)
+
+const (
+	GenericOAuth2ConnectorType = "generic-oauth2"
+)
+
+func init() {
+	RegisterConnectorConfigType(GenericOAuth2ConnectorType, func() ConnectorConfig { return &GenericOAuth2ConnectorConfig{} })
+}
+
+// GenericOAuth2ConnectorConfig configures a connector for any OAuth2
+// provider with an endpoint returning a JSON description of the user.
+type GenericOAuth2ConnectorConfig struct {
+	ID                   string `json:"id"`
+	ClientID             string `json:"clientID"`
+	ClientSecret         string `json:"clientSecret"`
+	TrustedEmailProvider bool   `json:"trustedEmailProvider"`
+
+	AuthURL     string   `json:"authURL"`
+	TokenURL    string   `json:"tokenURL"`
+	UserInfoURL string   `json:"userInfoURL"`
+	Scopes      []string `json:"scopes,omitempty"`
+
+	// AuthMethod is how dex authenticates to the token endpoint, either
+	// "client_secret_basic", the default, or "client_secret_post".
+	AuthMethod string `json:"authMethod,omitempty"`
+
+	// IDField, NameField and EmailField locate the user's ID, name and email
+	// in the user info, instead of "id", "name" and "email". Fields are
+	// written as a path of object keys separated by dots, each optionally
+	// followed by an array index, as in "data.emails[0].value". If
+	// GroupsField is set, the groups the field lists are released as the
+	// user's groups.
+	IDField     string `json:"idField,omitempty"`
+	NameField   string `json:"nameField,omitempty"`
+	EmailField  string `json:"emailField,omitempty"`
+	GroupsField string `json:"groupsField,omitempty"`
+}
+
+func (cfg *GenericOAuth2ConnectorConfig) ConnectorID() string {
+	return cfg.ID
+}
+
+func (cfg *GenericOAuth2ConnectorConfig) ConnectorType() string {
+	return GenericOAuth2ConnectorType
+}
+
+func (cfg *GenericOAuth2ConnectorConfig) Connector(ns url.URL, lf LoginFunc, tpls *template.Template) (Connector, error) {
+	ns.Path = path.Join(ns.Path, httpPathCallback)
+	oauth2Conn, err := newGenericOAuth2Connector(cfg, ns.String())
+	if err != nil {
+		return nil, err
+	}
+	return &OAuth2Connector{
+		id:        cfg.ID,
+		loginFunc: lf,
+		cbURL:     ns,
+		conn:      oauth2Conn,
+	}, nil
+}
+
+type genericOAuth2Connector struct {
+	client               *oauth2.Client
+	userInfoURL          string
+	trustedEmailProvider bool
+
+	idField     fieldPath
+	nameField   fieldPath
+	emailField  fieldPath
+	groupsField fieldPath
+}
+
+func newGenericOAuth2Connector(cfg *GenericOAuth2ConnectorConfig, cbURL string) (oauth2Connector, error) {
+	if cfg.AuthURL == "" || cfg.TokenURL == "" || cfg.UserInfoURL == "" {
+		return nil, errors.New("authURL, tokenURL and userInfoURL must be set")
+	}
+	if _, err := url.Parse(cfg.UserInfoURL); err != nil {
+		return nil, fmt.Errorf("invalid userInfoURL: %v", err)
+	}
+
+	c := &genericOAuth2Connector{
+		userInfoURL:          cfg.UserInfoURL,
+		trustedEmailProvider: cfg.TrustedEmailProvider,
+	}
+	fields := []struct {
+		name string
+		def  string
+		p    *fieldPath
+	}{
+		{cfg.IDField, "id", &c.idField},
+		{cfg.NameField, "name", &c.nameField},
+		{cfg.EmailField, "email", &c.emailField},
+		{cfg.GroupsField, "", &c.groupsField},
+	}
+	for _, f := range fields {
+		name := f.name
+		if name == "" {
+			name = f.def
+		}
+		if name == "" {
+			continue
+		}
+		p, err := parseFieldPath(name)
+		if err != nil {
+			return nil, err
+		}
+		*f.p = p
+	}
+
+	config := oauth2.Config{
+		Credentials: oauth2.ClientCredentials{ID: cfg.ClientID, Secret: cfg.ClientSecret},
+		AuthURL:     cfg.AuthURL,
+		TokenURL:    cfg.TokenURL,
+		Scope:       cfg.Scopes,
+		AuthMethod:  cfg.AuthMethod,
+		RedirectURL: cbURL,
+	}
+	cli, err := oauth2.NewClient(http.DefaultClient, config)
+	if err != nil {
+		return nil, err
+	}
+	c.client = cli
+	return c, nil
+}
+
+func (c *genericOAuth2Connector) Client() *oauth2.Client {
+	return c.client
+}
+
+// Identity returns the identity the user info describes, and the groups it
+// lists if a groups field is configured.
+func (c *genericOAuth2Connector) Identity(cli chttp.Client) (oidc.Identity, []string, error) {
+	var raw json.RawMessage
+	if err := getAndDecode(cli, c.userInfoURL, &raw); err != nil {
+		if _, ok := err.(*oauth2.Error); ok {
+			return oidc.Identity{}, nil, err
+		}
+		return oidc.Identity{}, nil, fmt.Errorf("getting user info: %v", err)
+	}
+	// Keep numbers as written, so large IDs don't lose precision.
+	var info interface{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&info); err != nil {
+		return oidc.Identity{}, nil, fmt.Errorf("decoding user info: %v", err)
+	}
+
+	var ident oidc.Identity
+	var err error
+	if ident.ID, err = c.idField.stringValue(info); err != nil {
+		return oidc.Identity{}, nil, err
+	}
+	if ident.ID == "" {
+		return oidc.Identity{}, nil, fmt.Errorf("user info is missing required field %s", c.idField)
+	}
+	if ident.Name, err = c.nameField.stringValue(info); err != nil {
+		return oidc.Identity{}, nil, err
+	}
+	if ident.Email, err = c.emailField.stringValue(info); err != nil {
+		return oidc.Identity{}, nil, err
+	}
+
+	if c.groupsField == nil {
+		return ident, nil, nil
+	}
+	groups, err := c.groupsField.stringsValue(info)
+	if err != nil {
+		return oidc.Identity{}, nil, err
+	}
+	return ident, groups, nil
+}
+
+func (c *genericOAuth2Connector) Healthy() error {
+	return nil
+}
+
+func (c *genericOAuth2Connector) TrustedEmailProvider() bool {
+	return c.trustedEmailProvider
+}
+
+// fieldPath locates a value in a decoded JSON document. Each element is
+// either an object key, or an array index.
+type fieldPath []fieldPathElem
+
+type fieldPathElem struct {
+	key   string
+	index int
+	isKey bool
+}
+
+// parseFieldPath parses paths such as "user.emails[0].value". A leading "$."
+// is allowed, in the manner of JSONPath.
+func parseFieldPath(s string) (fieldPath, error) {
+	invalid := fmt.Errorf("invalid field %q", s)
+	s = strings.TrimPrefix(s, "$.")
+	if s == "" {
+		return nil, invalid
+	}
+	var p fieldPath
+	for _, part := range strings.Split(s, ".") {
+		key := part
+		if i := strings.Index(part, "["); i >= 0 {
+			key = part[:i]
+			part = part[i:]
+		} else {
+			part = ""
+		}
+		if key != "" {
+			p = append(p, fieldPathElem{key: key, isKey: true})
+		} else if part == "" {
+			return nil, invalid
+		}
+		for part != "" {
+			end := strings.Index(part, "]")
+			if part[0] != '[' || end < 0 {
+				return nil, invalid
+			}
+			n, err := strconv.Atoi(part[1:end])
+			if err != nil || n < 0 {
+				return nil, invalid
+			}
+			p = append(p, fieldPathElem{index: n})
+			part = part[end+1:]
+		}
+	}
+	return p, nil
+}
+
+func (p fieldPath) String() string {
+	var s string
+	for _, e := range p {
+		if !e.isKey {
+			s += "[" + strconv.Itoa(e.index) + "]"
+			continue
+		}
+		if s != "" {
+			s += "."
+		}
+		s += e.key
+	}
+	return s
+}
+
+// lookup returns the value at the path, or nil if there is none.
+func (p fieldPath) lookup(v interface{}) interface{} {
+	for _, e := range p {
+		if e.isKey {
+			obj, ok := v.(map[string]interface{})
+			if !ok {
+				return nil
+			}
+			v = obj[e.key]
+			continue
+		}
+		arr, ok := v.([]interface{})
+		if !ok || e.index >= len(arr) {
+			return nil
+		}
+		v = arr[e.index]
+	}
+	return v
+}
+
+// stringValue returns the string or number at the path, or "" if there is
+// none.
+func (p fieldPath) stringValue(v interface{}) (string, error) {
+	switch v := p.lookup(v).(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	default:
+		return "", fmt.Errorf("user info field %s must be a string", p)
+	}
+}
+
+// stringsValue returns the strings listed at the path, which may also hold
+// a single string.
+func (p fieldPath) stringsValue(v interface{}) ([]string, error) {
+	switch v := p.lookup(v).(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		var ss []string
+		for _, e := range v {
+			s, ok := e.(string)
+			if !ok {
+				return nil, fmt.Errorf("user info field %s must be a list of strings", p)
+			}
+			ss = append(ss, s)
+		}
+		return ss, nil
+	default:
+		return nil, fmt.Errorf("user info field %s must be a list of strings", p)
+	}
+}
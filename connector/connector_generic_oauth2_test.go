@@ -0,0 +1,215 @@
+package connector
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/coreos/go-oidc/oauth2"
+	"github.com/coreos/go-oidc/oidc"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+const genericOAuth2UserInfoURL = "https://oauth2.example.com/api/user"
+
+var (
+	genericOAuth2ExampleUser   = `{"id":12345678901234567,"username":"elroy","name":"Elroy Jonez","email":"elroy@example.com"}`
+	genericOAuth2ExampleNested = `{"data":{"uid":"elroy-id","profile":{"displayName":"Elroy Jonez"},"emails":[{"value":"elroy@example.com"},{"value":"elroy@example.net"}]}}`
+	genericOAuth2ExampleGroups = `{"id":"elroy-id","groups":["admins","users"]}`
+)
+
+func TestGenericOAuth2Identity(t *testing.T) {
+	tests := []struct {
+		cfg        GenericOAuth2ConnectorConfig
+		body       string
+		statusCode int
+		want       oidc.Identity
+		wantGroups []string
+		wantErr    bool
+		wantDenied bool
+	}{
+		// Large numeric IDs are kept exactly.
+		{
+			body: genericOAuth2ExampleUser,
+			want: oidc.Identity{
+				ID:    "12345678901234567",
+				Name:  "Elroy Jonez",
+				Email: "elroy@example.com",
+			},
+		},
+		{
+			cfg: GenericOAuth2ConnectorConfig{
+				IDField:    "$.data.uid",
+				NameField:  "data.profile.displayName",
+				EmailField: "data.emails[1].value",
+			},
+			body: genericOAuth2ExampleNested,
+			want: oidc.Identity{
+				ID:    "elroy-id",
+				Name:  "Elroy Jonez",
+				Email: "elroy@example.net",
+			},
+		},
+		// Missing optional fields are left empty.
+		{
+			cfg: GenericOAuth2ConnectorConfig{
+				IDField:    "data.uid",
+				EmailField: "data.emails[5].value",
+			},
+			body: genericOAuth2ExampleNested,
+			want: oidc.Identity{ID: "elroy-id"},
+		},
+		{
+			cfg:        GenericOAuth2ConnectorConfig{GroupsField: "groups"},
+			body:       genericOAuth2ExampleGroups,
+			want:       oidc.Identity{ID: "elroy-id"},
+			wantGroups: []string{"admins", "users"},
+		},
+		{
+			cfg:        GenericOAuth2ConnectorConfig{GroupsField: "id"},
+			body:       genericOAuth2ExampleGroups,
+			want:       oidc.Identity{ID: "elroy-id"},
+			wantGroups: []string{"elroy-id"},
+		},
+		{
+			cfg:     GenericOAuth2ConnectorConfig{IDField: "username.first"},
+			body:    genericOAuth2ExampleUser,
+			wantErr: true,
+		},
+		{
+			cfg:     GenericOAuth2ConnectorConfig{IDField: "data"},
+			body:    genericOAuth2ExampleNested,
+			wantErr: true,
+		},
+		{
+			cfg:     GenericOAuth2ConnectorConfig{GroupsField: "id"},
+			body:    genericOAuth2ExampleUser,
+			wantErr: true,
+		},
+		{
+			body:    `not json`,
+			wantErr: true,
+		},
+		{
+			body:       `{"message":"401 Unauthorized"}`,
+			statusCode: http.StatusUnauthorized,
+			wantErr:    true,
+			wantDenied: true,
+		},
+	}
+
+	for i, tt := range tests {
+		cfg := tt.cfg
+		cfg.ClientID = "fakeclientid"
+		cfg.ClientSecret = "fakeclientsecret"
+		cfg.AuthURL = "https://oauth2.example.com/oauth/authorize"
+		cfg.TokenURL = "https://oauth2.example.com/oauth/token"
+		cfg.UserInfoURL = genericOAuth2UserInfoURL
+		conn, err := newGenericOAuth2Connector(&cfg, "http://example.com/auth/generic/callback")
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+
+		f := func(req *http.Request) (*http.Response, error) {
+			if req.URL.String() != genericOAuth2UserInfoURL {
+				return nil, fmt.Errorf("unexpected request URL: %s", req.URL.String())
+			}
+			status := tt.statusCode
+			if status == 0 {
+				status = http.StatusOK
+			}
+			return &http.Response{
+				StatusCode: status,
+				Body:       ioutil.NopCloser(strings.NewReader(tt.body)),
+			}, nil
+		}
+		ident, groups, err := conn.Identity(fakeClient(f))
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("case %d: want non-nil error", i)
+			}
+			if oerr, ok := err.(*oauth2.Error); tt.wantDenied && (!ok || oerr.Type != oauth2.ErrorAccessDenied) {
+				t.Errorf("case %d: want access denied, got err=%v", i, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: failed to get identity=%v", i, err)
+			continue
+		}
+		if diff := pretty.Compare(tt.want, ident); diff != "" {
+			t.Errorf("case %d: Compare(want, got) = %v", i, diff)
+		}
+
+		if diff := pretty.Compare(tt.wantGroups, groups); diff != "" {
+			t.Errorf("case %d: Compare(wantGroups, gotGroups) = %v", i, diff)
+		}
+	}
+}
+
+func TestParseFieldPath(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{path: "id", want: "id"},
+		{path: "$.user.id", want: "user.id"},
+		{path: "emails[0].value", want: "emails[0].value"},
+		{path: "matrix[1][2]", want: "matrix[1][2]"},
+		{path: "", wantErr: true},
+		{path: "$.", wantErr: true},
+		{path: "user..id", wantErr: true},
+		{path: "emails[", wantErr: true},
+		{path: "emails[x]", wantErr: true},
+		{path: "emails[-1]", wantErr: true},
+		{path: "emails[0]value", wantErr: true},
+	}
+
+	for i, tt := range tests {
+		p, err := parseFieldPath(tt.path)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("case %d: want non-nil error for %q", i, tt.path)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if got := p.String(); got != tt.want {
+			t.Errorf("case %d: want=%q, got=%q", i, tt.want, got)
+		}
+	}
+}
+
+func TestGenericOAuth2ConnectorConfigInvalid(t *testing.T) {
+	valid := GenericOAuth2ConnectorConfig{
+		ID:           "gitlab",
+		ClientID:     "fakeclientid",
+		ClientSecret: "fakeclientsecret",
+		AuthURL:      "https://gitlab.com/oauth/authorize",
+		TokenURL:     "https://gitlab.com/oauth/token",
+		UserInfoURL:  "https://gitlab.com/api/v4/user",
+	}
+	if _, err := valid.Connector(ns, lf, templates); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []func(cfg *GenericOAuth2ConnectorConfig){
+		func(cfg *GenericOAuth2ConnectorConfig) { cfg.AuthURL = "" },
+		func(cfg *GenericOAuth2ConnectorConfig) { cfg.UserInfoURL = "" },
+		func(cfg *GenericOAuth2ConnectorConfig) { cfg.AuthMethod = "private_key_jwt" },
+		func(cfg *GenericOAuth2ConnectorConfig) { cfg.EmailField = "emails[first]" },
+	}
+	for i, mutate := range tests {
+		cfg := valid
+		mutate(&cfg)
+		if _, err := cfg.Connector(ns, lf, templates); err == nil {
+			t.Errorf("case %d: want non-nil error", i)
+		}
+	}
+}
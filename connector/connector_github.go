@@ -7,7 +7,9 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"sort"
 	"strconv"
+	"strings"
 
 	chttp "github.com/coreos/go-oidc/http"
 	"github.com/coreos/go-oidc/oauth2"
@@ -15,10 +17,13 @@ import (
 )
 
 const (
-	GitHubConnectorType = "github"
-	githubAuthURL       = "https://github.com/login/oauth/authorize"
-	githubTokenURL      = "https://github.com/login/oauth/access_token"
-	githubAPIUserURL    = "https://api.github.com/user"
+	GitHubConnectorType    = "github"
+	githubAuthURL          = "https://github.com/login/oauth/authorize"
+	githubTokenURL         = "https://github.com/login/oauth/access_token"
+	githubAPIUserURL       = "https://api.github.com/user"
+	githubAPIUserEmailsURL = "https://api.github.com/user/emails"
+	githubAPIUserOrgsURL   = "https://api.github.com/user/orgs?per_page=100"
+	githubAPIUserTeamsURL  = "https://api.github.com/user/teams?per_page=100"
 )
 
 func init() {
@@ -29,6 +34,13 @@ type GitHubConnectorConfig struct {
 	ID           string `json:"id"`
 	ClientID     string `json:"clientID"`
 	ClientSecret string `json:"clientSecret"`
+
+	// Orgs and Teams restrict logging in to members of at least one of the
+	// given organizations, or of one of the given teams, written as
+	// "org/team-slug". If either is set, the user's teams in those
+	// organizations are released as groups.
+	Orgs  []string `json:"orgs,omitempty"`
+	Teams []string `json:"teams,omitempty"`
 }
 
 func (cfg *GitHubConnectorConfig) ConnectorID() string {
@@ -39,9 +51,14 @@ func (cfg *GitHubConnectorConfig) ConnectorType() string {
 	return GitHubConnectorType
 }
 
-func (cfg *GitHubConnectorConfig) Connector(ns url.URL, lf oidc.LoginFunc, tpls *template.Template) (Connector, error) {
+func (cfg *GitHubConnectorConfig) Connector(ns url.URL, lf LoginFunc, tpls *template.Template) (Connector, error) {
 	ns.Path = path.Join(ns.Path, httpPathCallback)
-	oauth2Conn, err := newGitHubConnector(cfg.ClientID, cfg.ClientSecret, ns.String())
+	for _, team := range cfg.Teams {
+		if _, _, ok := splitGitHubTeam(team); !ok {
+			return nil, fmt.Errorf("invalid team %q, must be of the form \"org/team-slug\"", team)
+		}
+	}
+	oauth2Conn, err := newGitHubConnector(cfg.ClientID, cfg.ClientSecret, ns.String(), cfg.Orgs, cfg.Teams)
 	if err != nil {
 		return nil, err
 	}
@@ -57,14 +74,20 @@ type githubOAuth2Connector struct {
 	clientID     string
 	clientSecret string
 	client       *oauth2.Client
+	orgs         []string
+	teams        []string
 }
 
-func newGitHubConnector(clientID, clientSecret, cbURL string) (oauth2Connector, error) {
+func newGitHubConnector(clientID, clientSecret, cbURL string, orgs, teams []string) (oauth2Connector, error) {
+	scope := []string{"user:email"}
+	if len(orgs) > 0 || len(teams) > 0 {
+		scope = append(scope, "read:org")
+	}
 	config := oauth2.Config{
 		Credentials: oauth2.ClientCredentials{ID: clientID, Secret: clientSecret},
 		AuthURL:     githubAuthURL,
 		TokenURL:    githubTokenURL,
-		Scope:       []string{"user:email"},
+		Scope:       scope,
 		AuthMethod:  oauth2.AuthMethodClientSecretPost,
 		RedirectURL: cbURL,
 	}
@@ -78,6 +101,8 @@ func newGitHubConnector(clientID, clientSecret, cbURL string) (oauth2Connector,
 		clientID:     clientID,
 		clientSecret: clientSecret,
 		client:       cli,
+		orgs:         orgs,
+		teams:        teams,
 	}, nil
 }
 
@@ -94,14 +119,137 @@ func (c *githubOAuth2Connector) Client() *oauth2.Client {
 	return c.client
 }
 
-func (c *githubOAuth2Connector) Identity(cli chttp.Client) (oidc.Identity, error) {
-	req, err := http.NewRequest("GET", githubAPIUserURL, nil)
+// Identity returns the identity of the user, and, if organizations or teams
+// are configured, the user's teams in them.
+func (c *githubOAuth2Connector) Identity(cli chttp.Client) (oidc.Identity, []string, error) {
+	var user struct {
+		Login string `json:"login"`
+		ID    int64  `json:"id"`
+		Name  string `json:"name"`
+	}
+	if _, err := githubGet(cli, githubAPIUserURL, &user); err != nil {
+		return oidc.Identity{}, nil, err
+	}
+
+	// The email on the profile is the public one, which may not be set, and
+	// which GitHub doesn't guarantee to be verified. Only the primary email
+	// is released, and only if it's verified.
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if _, err := githubGet(cli, githubAPIUserEmailsURL, &emails); err != nil {
+		return oidc.Identity{}, nil, err
+	}
+	var email string
+	for _, e := range emails {
+		if e.Primary && e.Verified {
+			email = e.Email
+			break
+		}
+	}
+
+	name := user.Name
+	if name == "" {
+		name = user.Login
+	}
+	ident := oidc.Identity{
+		ID:    strconv.FormatInt(user.ID, 10),
+		Name:  name,
+		Email: email,
+	}
+
+	if len(c.orgs) == 0 && len(c.teams) == 0 {
+		return ident, nil, nil
+	}
+
+	groups, err := c.authorize(cli)
 	if err != nil {
-		return oidc.Identity{}, err
+		return oidc.Identity{}, nil, err
+	}
+	return ident, groups, nil
+}
+
+// authorize checks that the user is a member of one of the configured
+// organizations or teams, and returns the user's teams in the organizations
+// concerned as "org/team-slug".
+func (c *githubOAuth2Connector) authorize(cli chttp.Client) ([]string, error) {
+	var userTeams []string
+	for next := githubAPIUserTeamsURL; next != ""; {
+		var teams []struct {
+			Slug string `json:"slug"`
+			Org  struct {
+				Login string `json:"login"`
+			} `json:"organization"`
+		}
+		var err error
+		if next, err = githubGet(cli, next, &teams); err != nil {
+			return nil, err
+		}
+		for _, t := range teams {
+			userTeams = append(userTeams, t.Org.Login+"/"+t.Slug)
+		}
+	}
+
+	var userOrgs []string
+	if len(c.orgs) > 0 {
+		for next := githubAPIUserOrgsURL; next != ""; {
+			var orgs []struct {
+				Login string `json:"login"`
+			}
+			var err error
+			if next, err = githubGet(cli, next, &orgs); err != nil {
+				return nil, err
+			}
+			for _, o := range orgs {
+				userOrgs = append(userOrgs, o.Login)
+			}
+		}
+	}
+
+	if !containsFold(c.orgs, userOrgs) && !containsFold(c.teams, userTeams) {
+		return nil, &oauth2.Error{
+			Type:        oauth2.ErrorAccessDenied,
+			Description: "not a member of the required organizations or teams",
+		}
+	}
+
+	// Only release the teams in the organizations dex is configured for.
+	orgs := append([]string{}, c.orgs...)
+	for _, team := range c.teams {
+		org, _, _ := splitGitHubTeam(team)
+		orgs = append(orgs, org)
+	}
+	var groups []string
+	for _, team := range userTeams {
+		org, _, _ := splitGitHubTeam(team)
+		if containsFold(orgs, []string{org}) {
+			groups = append(groups, team)
+		}
+	}
+	sort.Strings(groups)
+	return groups, nil
+}
+
+func (c *githubOAuth2Connector) Healthy() error {
+	return nil
+}
+
+func (c *githubOAuth2Connector) TrustedEmailProvider() bool {
+	return false
+}
+
+// githubGet fetches a resource of the GitHub API and decodes it into v. If the
+// resource is paginated, the URL of the next page is returned.
+func githubGet(cli chttp.Client, u string, v interface{}) (string, error) {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return "", err
 	}
 	resp, err := cli.Do(req)
 	if err != nil {
-		return oidc.Identity{}, fmt.Errorf("get: %v", err)
+		return "", fmt.Errorf("get: %v", err)
 	}
 	defer resp.Body.Close()
 	switch {
@@ -109,37 +257,53 @@ func (c *githubOAuth2Connector) Identity(cli chttp.Client) (oidc.Identity, error
 		// attempt to decode error from github
 		var authErr githubError
 		if err := json.NewDecoder(resp.Body).Decode(&authErr); err != nil {
-			return oidc.Identity{}, oauth2.NewError(oauth2.ErrorAccessDenied)
+			return "", oauth2.NewError(oauth2.ErrorAccessDenied)
 		}
-		return oidc.Identity{}, authErr
+		return "", authErr
 	case resp.StatusCode == http.StatusOK:
 	default:
-		return oidc.Identity{}, fmt.Errorf("unexpected status from providor %s", resp.Status)
+		return "", fmt.Errorf("unexpected status from providor %s", resp.Status)
 	}
-	var user struct {
-		Login string `json:"login"`
-		ID    int64  `json:"id"`
-		Email string `json:"email"`
-		Name  string `json:"name"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
-		return oidc.Identity{}, fmt.Errorf("getting user info: %v", err)
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return "", fmt.Errorf("getting %s: %v", u, err)
 	}
-	name := user.Name
-	if name == "" {
-		name = user.Login
+	return githubNextPage(resp.Header.Get("Link")), nil
+}
+
+// githubNextPage returns the "next" URL of a Link header, if any.
+// https://developer.github.com/v3/#pagination
+func githubNextPage(link string) string {
+	for _, l := range strings.Split(link, ",") {
+		parts := strings.Split(l, ";")
+		if len(parts) < 2 {
+			continue
+		}
+		for _, p := range parts[1:] {
+			if strings.TrimSpace(p) == `rel="next"` {
+				return strings.Trim(strings.TrimSpace(parts[0]), "<>")
+			}
+		}
 	}
-	return oidc.Identity{
-		ID:    strconv.FormatInt(user.ID, 10),
-		Name:  name,
-		Email: user.Email,
-	}, nil
+	return ""
 }
 
-func (c *githubOAuth2Connector) Healthy() error {
-	return nil
+func splitGitHubTeam(team string) (org, slug string, ok bool) {
+	parts := strings.Split(team, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
 }
 
-func (c *githubOAuth2Connector) TrustedEmailProvider() bool {
+// containsFold reports whether any of a is in b, ignoring case as GitHub does
+// for organization and team names.
+func containsFold(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if strings.EqualFold(x, y) {
+				return true
+			}
+		}
+	}
 	return false
 }
@@ -1,27 +1,61 @@
 package connector
 
 import (
+	"fmt"
+	"io/ioutil"
 	"net/http"
+	"strings"
 	"testing"
 
+	"github.com/coreos/go-oidc/oauth2"
 	"github.com/coreos/go-oidc/oidc"
+	"github.com/kylelemons/godebug/pretty"
 )
 
 var (
-	githubExampleUser  = `{"login":"octocat","id":1,"name": "monalisa octocat","email": "octocat@github.com"}`
-	githubExampleError = `{"message":"Bad credentials","documentation_url":"https://developer.github.com/v3"}`
+	githubExampleUser        = `{"login":"octocat","id":1,"name": "monalisa octocat","email": "octocat@github.com"}`
+	githubExamplePrivateUser = `{"login":"octocat","id":1,"name": "monalisa octocat","email": null}`
+	githubExampleEmails      = `[{"email":"octocat@example.com","primary":false,"verified":true},{"email":"monalisa@example.com","primary":true,"verified":true}]`
+	githubExampleNoEmails    = `[]`
+	githubExampleUnverified  = `[{"email":"octocat@github.com","primary":true,"verified":false}]`
+	githubExampleOrgs        = `[{"login":"github"},{"login":"coreos"}]`
+	githubExampleTeams       = `[{"slug":"justice-league","organization":{"login":"github"}},{"slug":"dex","organization":{"login":"coreos"}},{"slug":"owners","organization":{"login":"other"}}]`
+	githubExampleError       = `{"message":"Bad credentials","documentation_url":"https://developer.github.com/v3"}`
 )
 
 func TestGitHubIdentity(t *testing.T) {
 	tests := []oauth2IdentityTest{
+		// The public email on the profile isn't known to be verified.
 		{
 			urlResps: map[string]response{
-				githubAPIUserURL: {http.StatusOK, githubExampleUser},
+				githubAPIUserURL:       {http.StatusOK, githubExampleUser},
+				githubAPIUserEmailsURL: {http.StatusOK, githubExampleNoEmails},
+			},
+			want: oidc.Identity{
+				Name: "monalisa octocat",
+				ID:   "1",
+			},
+		},
+		{
+			urlResps: map[string]response{
+				githubAPIUserURL:       {http.StatusOK, githubExampleUser},
+				githubAPIUserEmailsURL: {http.StatusOK, githubExampleUnverified},
+			},
+			want: oidc.Identity{
+				Name: "monalisa octocat",
+				ID:   "1",
+			},
+		},
+		// The primary verified email is used, even if the profile has none.
+		{
+			urlResps: map[string]response{
+				githubAPIUserURL:       {http.StatusOK, githubExamplePrivateUser},
+				githubAPIUserEmailsURL: {http.StatusOK, githubExampleEmails},
 			},
 			want: oidc.Identity{
 				Name:  "monalisa octocat",
 				ID:    "1",
-				Email: "octocat@github.com",
+				Email: "monalisa@example.com",
 			},
 		},
 		{
@@ -33,9 +67,115 @@ func TestGitHubIdentity(t *testing.T) {
 			},
 		},
 	}
-	conn, err := newGitHubConnector("fakeclientid", "fakeclientsecret", "http://examle.com/auth/github/callback")
+	conn, err := newGitHubConnector("fakeclientid", "fakeclientsecret", "http://examle.com/auth/github/callback", nil, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 	runOAuth2IdentityTests(t, conn, tests)
 }
+
+func TestGitHubIdentityOrgsAndTeams(t *testing.T) {
+	urlResps := map[string]response{
+		githubAPIUserURL:       {http.StatusOK, githubExampleUser},
+		githubAPIUserEmailsURL: {http.StatusOK, githubExampleEmails},
+		githubAPIUserOrgsURL:   {http.StatusOK, githubExampleOrgs},
+		githubAPIUserTeamsURL:  {http.StatusOK, githubExampleTeams},
+	}
+	f := func(req *http.Request) (*http.Response, error) {
+		resp, ok := urlResps[req.URL.String()]
+		if !ok {
+			return nil, fmt.Errorf("unexpected request URL: %s", req.URL.String())
+		}
+		return &http.Response{
+			StatusCode: resp.statusCode,
+			Body:       ioutil.NopCloser(strings.NewReader(resp.body)),
+		}, nil
+	}
+
+	tests := []struct {
+		orgs       []string
+		teams      []string
+		wantDenied bool
+		wantGroups []string
+	}{
+		{
+			orgs:       []string{"CoreOS"},
+			wantGroups: []string{"coreos/dex"},
+		},
+		{
+			teams:      []string{"github/justice-league"},
+			wantGroups: []string{"github/justice-league"},
+		},
+		{
+			orgs:       []string{"coreos"},
+			teams:      []string{"github/justice-league"},
+			wantGroups: []string{"coreos/dex", "github/justice-league"},
+		},
+		{
+			orgs:       []string{"kubernetes"},
+			wantDenied: true,
+		},
+		{
+			teams:      []string{"coreos/owners"},
+			wantDenied: true,
+		},
+	}
+
+	for i, tt := range tests {
+		conn, err := newGitHubConnector("fakeclientid", "fakeclientsecret", "http://examle.com/auth/github/callback", tt.orgs, tt.teams)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, groups, err := conn.Identity(fakeClient(f))
+		if tt.wantDenied {
+			if oerr, ok := err.(*oauth2.Error); !ok || oerr.Type != oauth2.ErrorAccessDenied {
+				t.Errorf("case %d: want access denied, got err=%v", i, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: failed to get identity=%v", i, err)
+			continue
+		}
+
+		if diff := pretty.Compare(tt.wantGroups, groups); diff != "" {
+			t.Errorf("case %d: Compare(wantGroups, gotGroups) = %v", i, diff)
+		}
+	}
+}
+
+func TestGitHubConnectorConfigInvalidTeam(t *testing.T) {
+	cc := GitHubConnectorConfig{
+		ID:    "github",
+		Teams: []string{"justice-league"},
+	}
+
+	if _, err := cc.Connector(ns, lf, templates); err == nil {
+		t.Fatal("Expected GitHubConnector initialization to fail when a team is not of the form org/team-slug.")
+	}
+}
+
+func TestGitHubNextPage(t *testing.T) {
+	tests := []struct {
+		link string
+		want string
+	}{
+		{
+			link: `<https://api.github.com/user/teams?page=2>; rel="next", <https://api.github.com/user/teams?page=5>; rel="last"`,
+			want: "https://api.github.com/user/teams?page=2",
+		},
+		{
+			link: `<https://api.github.com/user/teams?page=1>; rel="first", <https://api.github.com/user/teams?page=4>; rel="prev"`,
+			want: "",
+		},
+		{
+			link: "",
+			want: "",
+		},
+	}
+	for i, tt := range tests {
+		if got := githubNextPage(tt.link); got != tt.want {
+			t.Errorf("case %d: want=%q, got=%q", i, tt.want, got)
+		}
+	}
+}
@@ -11,10 +11,12 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/coreos/dex/lockout"
 	"github.com/coreos/dex/pkg/log"
 	"github.com/coreos/go-oidc/oidc"
 
@@ -52,6 +54,14 @@ type LDAPConnectorConfig struct {
 	SearchBindPw         string        `json:"searchBindPw"`
 	BindTemplate         string        `json:"bindTemplate"`
 	TrustedEmailProvider bool          `json:"trustedEmailProvider"`
+	GroupSearchBaseDN    string        `json:"groupSearchBaseDN"`
+	GroupSearchFilter    string        `json:"groupSearchFilter"`
+	GroupSearchScope     string        `json:"groupSearchScope"`
+	GroupMemberAttribute string        `json:"groupMemberAttribute"`
+	GroupNameAttribute   string        `json:"groupNameAttribute"`
+	UserGroupsAttribute  string        `json:"userGroupsAttribute"`
+	NestedGroups         bool          `json:"nestedGroups"`
+	RequiredGroups       []string      `json:"requiredGroups"`
 }
 
 func (cfg *LDAPConnectorConfig) ConnectorID() string {
@@ -67,11 +77,12 @@ type LDAPConnector struct {
 	idp                  *LDAPIdentityProvider
 	namespace            url.URL
 	trustedEmailProvider bool
-	loginFunc            oidc.LoginFunc
+	loginFunc            LoginFunc
 	loginTpl             *template.Template
+	guard                *lockout.Guard
 }
 
-func (cfg *LDAPConnectorConfig) Connector(ns url.URL, lf oidc.LoginFunc, tpls *template.Template) (Connector, error) {
+func (cfg *LDAPConnectorConfig) Connector(ns url.URL, lf LoginFunc, tpls *template.Template) (Connector, error) {
 	ns.Path = path.Join(ns.Path, httpPathCallback)
 	tpl := tpls.Lookup(LDAPLoginPageTemplateName)
 	if tpl == nil {
@@ -83,6 +94,9 @@ func (cfg *LDAPConnectorConfig) Connector(ns url.URL, lf oidc.LoginFunc, tpls *t
 	const defaultEmailAttribute = "mail"
 	const defaultBindTemplate = "uid=%u,%b"
 	const defaultSearchScope = ldap.ScopeWholeSubtree
+	const defaultGroupSearchFilter = "(objectClass=groupOfNames)"
+	const defaultGroupMemberAttribute = "member"
+	const defaultGroupNameAttribute = "cn"
 	const defaultMaxIdleConns = 5
 	const defaultPoolCheckTimer = 7200 * time.Second
 
@@ -114,18 +128,43 @@ func (cfg *LDAPConnectorConfig) Connector(ns url.URL, lf oidc.LoginFunc, tpls *t
 
 	searchScope := defaultSearchScope
 	if len(cfg.SearchScope) > 0 {
-		switch {
-		case strings.EqualFold(cfg.SearchScope, "BASE"):
-			searchScope = ldap.ScopeBaseObject
-		case strings.EqualFold(cfg.SearchScope, "ONE"):
-			searchScope = ldap.ScopeSingleLevel
-		case strings.EqualFold(cfg.SearchScope, "SUB"):
-			searchScope = ldap.ScopeWholeSubtree
-		default:
+		var ok bool
+		if searchScope, ok = parseLDAPSearchScope(cfg.SearchScope); !ok {
 			return nil, fmt.Errorf("Invalid value for searchScope: '%v'. Must be one of 'base', 'one' or 'sub'.", cfg.SearchScope)
 		}
 	}
 
+	groupSearchScope := defaultSearchScope
+	if len(cfg.GroupSearchScope) > 0 {
+		var ok bool
+		if groupSearchScope, ok = parseLDAPSearchScope(cfg.GroupSearchScope); !ok {
+			return nil, fmt.Errorf("Invalid value for groupSearchScope: '%v'. Must be one of 'base', 'one' or 'sub'.", cfg.GroupSearchScope)
+		}
+	}
+
+	groupSearchFilter := defaultGroupSearchFilter
+	if len(cfg.GroupSearchFilter) > 0 {
+		groupSearchFilter = cfg.GroupSearchFilter
+	}
+
+	groupMemberAttribute := defaultGroupMemberAttribute
+	if len(cfg.GroupMemberAttribute) > 0 {
+		groupMemberAttribute = cfg.GroupMemberAttribute
+	}
+
+	groupNameAttribute := defaultGroupNameAttribute
+	if len(cfg.GroupNameAttribute) > 0 {
+		groupNameAttribute = cfg.GroupNameAttribute
+	}
+
+	if len(cfg.GroupSearchBaseDN) > 0 && len(cfg.UserGroupsAttribute) > 0 {
+		return nil, fmt.Errorf("Invalid configuration. groupSearchBaseDN and userGroupsAttribute are mutual exclusive.")
+	}
+
+	if len(cfg.RequiredGroups) > 0 && len(cfg.GroupSearchBaseDN) == 0 && len(cfg.UserGroupsAttribute) == 0 {
+		return nil, fmt.Errorf("Invalid configuration. requiredGroups needs either groupSearchBaseDN or userGroupsAttribute.")
+	}
+
 	if cfg.Timeout != 0 {
 		ldap.DefaultTimeout = cfg.Timeout * time.Millisecond
 	}
@@ -184,6 +223,15 @@ func (cfg *LDAPConnectorConfig) Connector(ns url.URL, lf oidc.LoginFunc, tpls *t
 		searchBindPw:     cfg.SearchBindPw,
 		bindTemplate:     bindTemplate,
 		ldapPool:         ldapPool,
+
+		groupSearchBaseDN:    cfg.GroupSearchBaseDN,
+		groupSearchFilter:    groupSearchFilter,
+		groupSearchScope:     groupSearchScope,
+		groupMemberAttribute: groupMemberAttribute,
+		groupNameAttribute:   groupNameAttribute,
+		userGroupsAttribute:  cfg.UserGroupsAttribute,
+		nestedGroups:         cfg.NestedGroups,
+		requiredGroups:       cfg.RequiredGroups,
 	}
 
 	idpc := &LDAPConnector{
@@ -219,9 +267,13 @@ func (c *LDAPConnector) LoginURL(sessionKey, prompt string) (string, error) {
 	return path.Join(c.namespace.Path, "login") + "?" + enc, nil
 }
 
+func (c *LDAPConnector) SetLoginGuard(g *lockout.Guard) {
+	c.guard = g
+}
+
 func (c *LDAPConnector) Register(mux *http.ServeMux, errorURL url.URL) {
 	route := path.Join(c.namespace.Path, "login")
-	mux.Handle(route, handleLoginFunc(c.loginFunc, c.loginTpl, c.idp, route, errorURL))
+	mux.Handle(route, handleLoginFunc(c.loginFunc, c.loginTpl, c.idp, c.guard, nil, nil, c.id, route, errorURL))
 }
 
 func (c *LDAPConnector) Sync() chan struct{} {
@@ -250,6 +302,18 @@ func (c *LDAPConnector) TrustedEmailProvider() bool {
 	return c.trustedEmailProvider
 }
 
+func parseLDAPSearchScope(scope string) (int, bool) {
+	switch {
+	case strings.EqualFold(scope, "BASE"):
+		return ldap.ScopeBaseObject, true
+	case strings.EqualFold(scope, "ONE"):
+		return ldap.ScopeSingleLevel, true
+	case strings.EqualFold(scope, "SUB"):
+		return ldap.ScopeWholeSubtree, true
+	}
+	return 0, false
+}
+
 // A LDAPPool is a Connection Pool for LDAP connections
 // Initialize exported fields and use Acquire() to get a connection.
 // Use Put() to put it back into the pool.
@@ -374,6 +438,15 @@ type LDAPIdentityProvider struct {
 	searchBindPw     string
 	bindTemplate     string
 	ldapPool         *LDAPPool
+
+	groupSearchBaseDN    string
+	groupSearchFilter    string
+	groupSearchScope     int
+	groupMemberAttribute string
+	groupNameAttribute   string
+	userGroupsAttribute  string
+	nestedGroups         bool
+	requiredGroups       []string
 }
 
 func (p *LDAPPool) ldapConnect() (*ldap.Conn, error) {
@@ -410,21 +483,24 @@ func (m *LDAPIdentityProvider) ParseString(template, username string) string {
 	return result
 }
 
-func (m *LDAPIdentityProvider) Identity(username, password string) (*oidc.Identity, error) {
+// Identity binds as the user, and returns the user's identity, whose ID is
+// the user's DN, and the names of the LDAP groups the user is a member of. If
+// no group lookup is configured, no groups are returned.
+func (m *LDAPIdentityProvider) Identity(username, password string) (*oidc.Identity, []string, error) {
 	var err error
 	var bindDN, ldapUid, ldapName, ldapEmail string
 	var ldapConn *ldap.Conn
 
 	ldapConn, err = m.ldapPool.Acquire()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer m.ldapPool.Put(ldapConn)
 
 	if m.searchBeforeAuth {
 		err = ldapConn.Bind(m.searchBindDN, m.searchBindPw)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		filter := m.ParseString(m.searchFilter, username)
@@ -438,11 +514,11 @@ func (m *LDAPIdentityProvider) Identity(username, password string) (*oidc.Identi
 
 		sr, err := ldapConn.Search(s)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		if len(sr.Entries) == 0 {
 			err = fmt.Errorf("Search returned no match. filter='%v' base='%v'", filter, m.baseDN)
-			return nil, err
+			return nil, nil, err
 		}
 
 		bindDN = sr.Entries[0].DN
@@ -453,7 +529,7 @@ func (m *LDAPIdentityProvider) Identity(username, password string) (*oidc.Identi
 		m.ldapPool.Put(ldapConn)
 		ldapConn, err = m.ldapPool.Acquire()
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 	} else {
 		bindDN = m.ParseString(m.bindTemplate, username)
@@ -462,14 +538,127 @@ func (m *LDAPIdentityProvider) Identity(username, password string) (*oidc.Identi
 	// authenticate user
 	err = ldapConn.Bind(bindDN, password)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	ldapUid = bindDN
 
+	var groups []string
+	if m.groupsEnabled() {
+		if groups, err = m.lookupGroups(bindDN); err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(m.requiredGroups) > 0 && !hasAnyGroup(groups, m.requiredGroups) {
+		return nil, nil, fmt.Errorf("%v is not a member of any of the required groups %v", bindDN, m.requiredGroups)
+	}
+
 	return &oidc.Identity{
 		ID:    ldapUid,
 		Name:  ldapName,
 		Email: ldapEmail,
-	}, nil
+	}, groups, nil
+}
+
+func (m *LDAPIdentityProvider) groupsEnabled() bool {
+	return len(m.groupSearchBaseDN) > 0 || len(m.userGroupsAttribute) > 0
+}
+
+// lookupGroups returns the sorted names of the groups the entry with the given
+// DN is a member of, binding as the search user if one is configured. With
+// nestedGroups, the groups those groups are members of are included as well.
+func (m *LDAPIdentityProvider) lookupGroups(dn string) ([]string, error) {
+	ldapConn, err := m.ldapPool.Acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer m.ldapPool.Put(ldapConn)
+
+	if len(m.searchBindDN) > 0 {
+		if err = ldapConn.Bind(m.searchBindDN, m.searchBindPw); err != nil {
+			return nil, err
+		}
+	}
+
+	var names []string
+	seen := map[string]bool{dn: true}
+	queue := []string{dn}
+	for len(queue) > 0 {
+		member := queue[0]
+		queue = queue[1:]
+
+		groups, err := m.memberOf(ldapConn, member)
+		if err != nil {
+			return nil, err
+		}
+		for _, g := range groups {
+			// Groups may be members of each other; visit each one once.
+			if seen[g.DN] {
+				continue
+			}
+			seen[g.DN] = true
+			if name := g.GetAttributeValue(m.groupNameAttribute); len(name) > 0 {
+				names = append(names, name)
+			}
+			if m.nestedGroups {
+				queue = append(queue, g.DN)
+			}
+		}
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+// memberOf returns the entries of the groups the entry with the given DN is a
+// direct member of. They're either found by searching for groups which list
+// the DN as a member, or read from the entry's userGroupsAttribute.
+func (m *LDAPIdentityProvider) memberOf(ldapConn *ldap.Conn, dn string) ([]*ldap.Entry, error) {
+	if len(m.userGroupsAttribute) == 0 {
+		filter := fmt.Sprintf("(&%s(%s=%s))", m.groupSearchFilter, m.groupMemberAttribute, ldap.EscapeFilter(dn))
+		s := ldap.NewSearchRequest(m.groupSearchBaseDN, m.groupSearchScope, ldap.NeverDerefAliases, 0, 0, false, filter, []string{m.groupNameAttribute}, nil)
+		sr, err := ldapConn.Search(s)
+		if err != nil {
+			return nil, err
+		}
+		return sr.Entries, nil
+	}
+
+	entry, err := ldapEntry(ldapConn, dn, m.userGroupsAttribute)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []*ldap.Entry
+	for _, groupDN := range entry.GetAttributeValues(m.userGroupsAttribute) {
+		g, err := ldapEntry(ldapConn, groupDN, m.groupNameAttribute)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	return groups, nil
+}
+
+func ldapEntry(ldapConn *ldap.Conn, dn string, attributes ...string) (*ldap.Entry, error) {
+	s := ldap.NewSearchRequest(dn, ldap.ScopeBaseObject, ldap.NeverDerefAliases, 0, 0, false, "(objectClass=*)", attributes, nil)
+	sr, err := ldapConn.Search(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(sr.Entries) == 0 {
+		return nil, fmt.Errorf("Search returned no match. base='%v'", dn)
+	}
+	return sr.Entries[0], nil
+}
+
+func hasAnyGroup(groups, wanted []string) bool {
+	for _, g := range groups {
+		for _, w := range wanted {
+			if g == w {
+				return true
+			}
+		}
+	}
+	return false
 }
@@ -5,12 +5,11 @@ import (
 	"net/url"
 	"testing"
 
-	"github.com/coreos/go-oidc/oidc"
 )
 
 var (
 	ns        url.URL
-	lf        oidc.LoginFunc
+	lf        LoginFunc
 	templates *template.Template
 )
 
@@ -92,3 +91,55 @@ func TestLDAPConnectorConfigValidCertFileAndKeyFile(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestLDAPConnectorConfigInvalidGroupSearchScope(t *testing.T) {
+	cc := LDAPConnectorConfig{
+		ID:                "ldap",
+		GroupSearchBaseDN: "ou=Groups,dc=example,dc=org",
+		GroupSearchScope:  "three",
+	}
+
+	_, err := cc.Connector(ns, lf, templates)
+	if err == nil {
+		t.Fatal("Expected LDAPConnector initialization to fail when invalid value provided for GroupSearchScope.")
+	}
+}
+
+func TestLDAPConnectorConfigGroupSearchAndUserGroupsAttribute(t *testing.T) {
+	cc := LDAPConnectorConfig{
+		ID:                  "ldap",
+		GroupSearchBaseDN:   "ou=Groups,dc=example,dc=org",
+		UserGroupsAttribute: "memberOf",
+	}
+
+	_, err := cc.Connector(ns, lf, templates)
+	if err == nil {
+		t.Fatal("Expected LDAPConnector initialization to fail when both GroupSearchBaseDN and UserGroupsAttribute specified.")
+	}
+}
+
+func TestLDAPConnectorConfigRequiredGroupsWithoutGroupLookup(t *testing.T) {
+	cc := LDAPConnectorConfig{
+		ID:             "ldap",
+		RequiredGroups: []string{"admins"},
+	}
+
+	_, err := cc.Connector(ns, lf, templates)
+	if err == nil {
+		t.Fatal("Expected LDAPConnector initialization to fail when RequiredGroups specified without a group lookup.")
+	}
+}
+
+func TestLDAPConnectorNoGroupLookup(t *testing.T) {
+	cc := LDAPConnectorConfig{
+		ID: "ldap",
+	}
+
+	c, err := cc.Connector(ns, lf, templates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.(*LDAPConnector).idp.groupsEnabled() {
+		t.Fatal("Expected no group lookup to be configured.")
+	}
+}
@@ -7,6 +7,9 @@ import (
 	"net/url"
 	"path"
 
+	"github.com/coreos/dex/lockout"
+	"github.com/coreos/dex/mfa"
+	"github.com/coreos/dex/pkg/log"
 	"github.com/coreos/dex/user"
 	"github.com/coreos/go-oidc/oidc"
 )
@@ -14,6 +17,7 @@ import (
 const (
 	LocalConnectorType    = "local"
 	LoginPageTemplateName = "local-login.html"
+	MFAPageTemplateName   = "local-mfa.html"
 )
 
 func init() {
@@ -32,17 +36,20 @@ func (cfg *LocalConnectorConfig) ConnectorType() string {
 	return LocalConnectorType
 }
 
-func (cfg *LocalConnectorConfig) Connector(ns url.URL, lf oidc.LoginFunc, tpls *template.Template) (Connector, error) {
+func (cfg *LocalConnectorConfig) Connector(ns url.URL, lf LoginFunc, tpls *template.Template) (Connector, error) {
 	tpl := tpls.Lookup(LoginPageTemplateName)
 	if tpl == nil {
 		return nil, fmt.Errorf("unable to find necessary HTML template")
 	}
 
+	// The MFA template is only needed once the server sets an
+	// authenticator.
 	idpc := &LocalConnector{
 		id:        cfg.ID,
 		namespace: ns,
 		loginFunc: lf,
 		loginTpl:  tpl,
+		mfaTpl:    tpls.Lookup(MFAPageTemplateName),
 	}
 
 	return idpc, nil
@@ -52,8 +59,11 @@ type LocalConnector struct {
 	id        string
 	idp       *LocalIdentityProvider
 	namespace url.URL
-	loginFunc oidc.LoginFunc
+	loginFunc LoginFunc
 	loginTpl  *template.Template
+	guard     *lockout.Guard
+	mfa       *mfa.Authenticator
+	mfaTpl    *template.Template
 }
 
 type Page struct {
@@ -62,6 +72,9 @@ type Page struct {
 	Error      bool
 	Message    string
 	SessionKey string
+
+	// MFA is set if users can choose to enroll a second factor.
+	MFA bool
 }
 
 func (c *LocalConnector) ID() string {
@@ -76,6 +89,14 @@ func (c *LocalConnector) SetLocalIdentityProvider(idp *LocalIdentityProvider) {
 	c.idp = idp
 }
 
+func (c *LocalConnector) SetLoginGuard(g *lockout.Guard) {
+	c.guard = g
+}
+
+func (c *LocalConnector) SetMFA(a *mfa.Authenticator) {
+	c.mfa = a
+}
+
 func (c *LocalConnector) LoginURL(sessionKey, prompt string) (string, error) {
 	q := url.Values{}
 	q.Set("session_key", sessionKey)
@@ -87,7 +108,7 @@ func (c *LocalConnector) LoginURL(sessionKey, prompt string) (string, error) {
 
 func (c *LocalConnector) Register(mux *http.ServeMux, errorURL url.URL) {
 	route := c.namespace.Path + "/login"
-	mux.Handle(route, handleLoginFunc(c.loginFunc, c.loginTpl, c.idp, route, errorURL))
+	mux.Handle(route, handleLoginFunc(c.loginFunc, c.loginTpl, c.idp, c.guard, c.mfa, c.mfaTpl, c.id, route, errorURL))
 }
 
 func (c *LocalConnector) Sync() chan struct{} {
@@ -103,18 +124,33 @@ type LocalIdentityProvider struct {
 	UserRepo         user.UserRepo
 }
 
-func (m *LocalIdentityProvider) Identity(email, password string) (*oidc.Identity, error) {
+func (m *LocalIdentityProvider) Identity(email, password string) (*oidc.Identity, []string, error) {
 	user, err := m.UserRepo.GetByEmail(nil, email)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	id := user.ID
 
 	pi, err := m.PasswordInfoRepo.Get(nil, id)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return pi.Authenticate(password)
+	ident, err := pi.Authenticate(password)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Upgrade outdated hashes while the plaintext is at hand. Failing to
+	// doesn't fail the login; it's tried again the next time.
+	rehashed, err := pi.Rehash(password)
+	if err != nil {
+		log.Errorf("Failed to rehash password of user %s: %v", id, err)
+	} else if rehashed {
+		if err := m.PasswordInfoRepo.Update(nil, pi); err != nil {
+			log.Errorf("Failed to store rehashed password of user %s: %v", id, err)
+		}
+	}
+	return ident, nil, nil
 }
@@ -15,8 +15,9 @@ type oauth2Connector interface {
 	Client() *oauth2.Client
 
 	// Identity uses a HTTP client authenticated as the end user to construct
-	// an OIDC identity for that user.
-	Identity(cli chttp.Client) (oidc.Identity, error)
+	// an OIDC identity for that user, and returns it along with the names of
+	// the user's upstream groups, if the connector knows them.
+	Identity(cli chttp.Client) (oidc.Identity, []string, error)
 
 	// Healthy it should attempt to determine if the connector's credientials
 	// are valid.
@@ -27,7 +28,7 @@ type oauth2Connector interface {
 
 type OAuth2Connector struct {
 	id        string
-	loginFunc oidc.LoginFunc
+	loginFunc LoginFunc
 	cbURL     url.URL
 	conn      oauth2Connector
 }
@@ -57,7 +58,7 @@ func (c *OAuth2Connector) Register(mux *http.ServeMux, errorURL url.URL) {
 	mux.Handle(c.cbURL.Path, c.handleCallbackFunc(c.loginFunc, errorURL))
 }
 
-func (c *OAuth2Connector) handleCallbackFunc(lf oidc.LoginFunc, errorURL url.URL) http.HandlerFunc {
+func (c *OAuth2Connector) handleCallbackFunc(lf LoginFunc, errorURL url.URL) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		q := r.URL.Query()
 
@@ -84,7 +85,18 @@ func (c *OAuth2Connector) handleCallbackFunc(lf oidc.LoginFunc, errorURL url.URL
 			redirectError(w, errorURL, q)
 			return
 		}
-		ident, err := c.conn.Identity(newAuthenticatedClient(token, http.DefaultClient))
+		ident, groups, err := c.conn.Identity(newAuthenticatedClient(token, http.DefaultClient))
+		if oerr, ok := err.(*oauth2.Error); ok && oerr.Type == oauth2.ErrorAccessDenied {
+			log.Errorf("Issuer denied access: %v", err)
+			desc := oerr.Description
+			if desc == "" {
+				desc = "access denied by issuer"
+			}
+			q.Set("error", oauth2.ErrorAccessDenied)
+			q.Set("error_description", desc)
+			redirectError(w, errorURL, q)
+			return
+		}
 		if err != nil {
 			log.Errorf("Unable to retrieve identity: %v", err)
 			q.Set("error", oauth2.ErrorUnsupportedResponseType)
@@ -92,7 +104,7 @@ func (c *OAuth2Connector) handleCallbackFunc(lf oidc.LoginFunc, errorURL url.URL
 			redirectError(w, errorURL, q)
 			return
 		}
-		redirectURL, err := lf(ident, sessionKey)
+		redirectURL, err := lf(ident, groups, sessionKey)
 		if err != nil {
 			log.Errorf("Unable to log in %#v: %v", ident, err)
 			q.Set("error", oauth2.ErrorAccessDenied)
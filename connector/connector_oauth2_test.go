@@ -41,7 +41,7 @@ func runOAuth2IdentityTests(t *testing.T, conn oauth2Connector, tests []oauth2Id
 				Body:       ioutil.NopCloser(strings.NewReader(resp.body)),
 			}, nil
 		}
-		got, err := conn.Identity(fakeClient(f))
+		got, _, err := conn.Identity(fakeClient(f))
 		if tt.wantErr == nil {
 			if err != nil {
 				t.Errorf("case %d: failed to get identity=%v", i, err)
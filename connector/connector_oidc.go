@@ -1,13 +1,17 @@
 package connector
 
 import (
+	"errors"
+	"fmt"
 	"html/template"
 	"net/http"
 	"net/url"
 	"path"
+	"strings"
 
 	phttp "github.com/coreos/dex/pkg/http"
 	"github.com/coreos/dex/pkg/log"
+	"github.com/coreos/go-oidc/jose"
 	"github.com/coreos/go-oidc/oauth2"
 	"github.com/coreos/go-oidc/oidc"
 )
@@ -17,6 +21,10 @@ const (
 	httpPathCallback  = "/callback"
 )
 
+// forwardableParams are the parameters of clients' authentication requests
+// the oidc connector can pass on to its provider.
+var forwardableParams = []string{"prompt", "login_hint", "acr_values"}
+
 func init() {
 	RegisterConnectorConfigType(OIDCConnectorType, func() ConnectorConfig { return &OIDCConnectorConfig{} })
 }
@@ -27,6 +35,31 @@ type OIDCConnectorConfig struct {
 	ClientID             string `json:"clientID"`
 	ClientSecret         string `json:"clientSecret"`
 	TrustedEmailProvider bool   `json:"trustedEmailProvider"`
+
+	// Scopes are requested from the provider instead of "openid", "email"
+	// and "profile". They must include "openid".
+	Scopes []string `json:"scopes,omitempty"`
+
+	// UserIDClaim, NameClaim and EmailClaim name the claims of the
+	// provider's ID tokens the user's identity is taken from, instead of
+	// "sub", "name" and "email". If GroupsClaim is set, the groups the
+	// claim lists are released as the user's groups.
+	UserIDClaim string `json:"userIDClaim,omitempty"`
+	NameClaim   string `json:"nameClaim,omitempty"`
+	EmailClaim  string `json:"emailClaim,omitempty"`
+	GroupsClaim string `json:"groupsClaim,omitempty"`
+
+	// HostedDomains restricts logging in to the users of the given G Suite
+	// domains, as told by the "hd" claim. EmailDomains restricts logging in
+	// to users with an email address in one of the given domains, which the
+	// provider must mark as verified with "email_verified".
+	HostedDomains []string `json:"hostedDomains,omitempty"`
+	EmailDomains  []string `json:"emailDomains,omitempty"`
+
+	// ForwardedParams are the parameters of clients' authentication
+	// requests, out of "prompt", "login_hint" and "acr_values", which are
+	// passed on to the provider.
+	ForwardedParams []string `json:"forwardedParams,omitempty"`
 }
 
 func (cfg *OIDCConnectorConfig) ConnectorID() string {
@@ -41,20 +74,38 @@ type OIDCConnector struct {
 	id                   string
 	issuerURL            string
 	cbURL                url.URL
-	loginFunc            oidc.LoginFunc
+	loginFunc            LoginFunc
 	client               *oidc.Client
 	trustedEmailProvider bool
+
+	userIDClaim     string
+	nameClaim       string
+	emailClaim      string
+	groupsClaim     string
+	hostedDomains   []string
+	emailDomains    []string
+	forwardedParams []string
 }
 
-func (cfg *OIDCConnectorConfig) Connector(ns url.URL, lf oidc.LoginFunc, tpls *template.Template) (Connector, error) {
+func (cfg *OIDCConnectorConfig) Connector(ns url.URL, lf LoginFunc, tpls *template.Template) (Connector, error) {
 	ns.Path = path.Join(ns.Path, httpPathCallback)
 
+	if len(cfg.Scopes) != 0 && !containsString(cfg.Scopes, "openid") {
+		return nil, errors.New("scopes must include \"openid\"")
+	}
+	for _, p := range cfg.ForwardedParams {
+		if !containsString(forwardableParams, p) {
+			return nil, fmt.Errorf("parameter %q can't be forwarded, must be one of %s", p, strings.Join(forwardableParams, ", "))
+		}
+	}
+
 	ccfg := oidc.ClientConfig{
 		RedirectURL: ns.String(),
 		Credentials: oidc.ClientCredentials{
 			ID:     cfg.ClientID,
 			Secret: cfg.ClientSecret,
 		},
+		Scope: cfg.Scopes,
 	}
 
 	cl, err := oidc.NewClient(ccfg)
@@ -69,6 +120,22 @@ func (cfg *OIDCConnectorConfig) Connector(ns url.URL, lf oidc.LoginFunc, tpls *t
 		loginFunc:            lf,
 		client:               cl,
 		trustedEmailProvider: cfg.TrustedEmailProvider,
+		userIDClaim:          cfg.UserIDClaim,
+		nameClaim:            cfg.NameClaim,
+		emailClaim:           cfg.EmailClaim,
+		groupsClaim:          cfg.GroupsClaim,
+		hostedDomains:        cfg.HostedDomains,
+		emailDomains:         cfg.EmailDomains,
+		forwardedParams:      cfg.ForwardedParams,
+	}
+	if idpc.userIDClaim == "" {
+		idpc.userIDClaim = "sub"
+	}
+	if idpc.nameClaim == "" {
+		idpc.nameClaim = "name"
+	}
+	if idpc.emailClaim == "" {
+		idpc.emailClaim = "email"
 	}
 	return idpc, nil
 }
@@ -82,12 +149,36 @@ func (c *OIDCConnector) Healthy() error {
 }
 
 func (c *OIDCConnector) LoginURL(sessionKey, prompt string) (string, error) {
+	return c.LoginURLWithParams(sessionKey, prompt, nil)
+}
+
+// LoginURLWithParams implements AuthParamsConnector. A prompt dex asks for
+// itself takes precedence over the client's.
+func (c *OIDCConnector) LoginURLWithParams(sessionKey, prompt string, params url.Values) (string, error) {
 	oac, err := c.client.OAuthClient()
 	if err != nil {
 		return "", err
 	}
 
-	return oac.AuthCodeURL(sessionKey, "", prompt), nil
+	if prompt == "" && containsString(c.forwardedParams, "prompt") {
+		prompt = params.Get("prompt")
+	}
+	u, err := url.Parse(oac.AuthCodeURL(sessionKey, "", prompt))
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	for _, p := range c.forwardedParams {
+		if v := params.Get(p); p != "prompt" && v != "" {
+			q.Set(p, v)
+		}
+	}
+	// Google only offers the accounts of a single domain if asked to.
+	if len(c.hostedDomains) == 1 {
+		q.Set("hd", c.hostedDomains[0])
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
 }
 
 func (c *OIDCConnector) Register(mux *http.ServeMux, errorURL url.URL) {
@@ -102,13 +193,81 @@ func (c *OIDCConnector) TrustedEmailProvider() bool {
 	return c.trustedEmailProvider
 }
 
+var errOIDCDomainNotAllowed = errors.New("user's domain is not allowed")
+
+// identity maps the claims of an ID token to an identity and groups, and
+// checks the user is of an allowed domain.
+func (c *OIDCConnector) identity(claims jose.Claims) (*oidc.Identity, []string, error) {
+	var ident oidc.Identity
+	var err error
+	var ok bool
+	if ident.ID, ok, err = claims.StringClaim(c.userIDClaim); err != nil {
+		return nil, nil, err
+	} else if !ok || ident.ID == "" {
+		return nil, nil, fmt.Errorf("missing required claim: %s", c.userIDClaim)
+	}
+	if ident.Name, _, err = claims.StringClaim(c.nameClaim); err != nil {
+		return nil, nil, err
+	}
+	if ident.Email, _, err = claims.StringClaim(c.emailClaim); err != nil {
+		return nil, nil, err
+	}
+	if exp, ok, err := claims.TimeClaim("exp"); err != nil {
+		return nil, nil, err
+	} else if ok {
+		ident.ExpiresAt = exp
+	}
+
+	if len(c.hostedDomains) != 0 {
+		hd, _, err := claims.StringClaim("hd")
+		if err != nil {
+			return nil, nil, err
+		}
+		if !containsFold(c.hostedDomains, []string{hd}) {
+			return nil, nil, errOIDCDomainNotAllowed
+		}
+	}
+	if len(c.emailDomains) != 0 {
+		// Only addresses the provider says are verified vouch for a domain.
+		// Some providers, such as Azure AD, let users set their address
+		// and don't send email_verified at all.
+		if verified, _ := claims["email_verified"].(bool); !verified {
+			return nil, nil, errOIDCDomainNotAllowed
+		}
+		i := strings.LastIndex(ident.Email, "@")
+		if i < 0 || !containsFold(c.emailDomains, []string{ident.Email[i+1:]}) {
+			return nil, nil, errOIDCDomainNotAllowed
+		}
+	}
+
+	var groups []string
+	if c.groupsClaim != "" {
+		switch v := claims[c.groupsClaim].(type) {
+		case nil:
+		case string:
+			groups = []string{v}
+		case []interface{}:
+			for _, g := range v {
+				s, ok := g.(string)
+				if !ok {
+					return nil, nil, fmt.Errorf("claim %s must be a list of strings", c.groupsClaim)
+				}
+				groups = append(groups, s)
+			}
+		default:
+			return nil, nil, fmt.Errorf("claim %s must be a list of strings", c.groupsClaim)
+		}
+	}
+	return &ident, groups, nil
+}
+
 func redirectError(w http.ResponseWriter, errorURL url.URL, q url.Values) {
 	redirectURL := phttp.MergeQuery(errorURL, q)
 	w.Header().Set("Location", redirectURL.String())
 	w.WriteHeader(http.StatusSeeOther)
 }
 
-func (c *OIDCConnector) handleCallbackFunc(lf oidc.LoginFunc, errorURL url.URL) http.HandlerFunc {
+func (c *OIDCConnector) handleCallbackFunc(lf LoginFunc, errorURL url.URL) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		q := r.URL.Query()
 
@@ -144,7 +303,14 @@ func (c *OIDCConnector) handleCallbackFunc(lf oidc.LoginFunc, errorURL url.URL)
 			return
 		}
 
-		ident, err := oidc.IdentityFromClaims(claims)
+		ident, groups, err := c.identity(claims)
+		if err == errOIDCDomainNotAllowed {
+			log.Errorf("Denied login of %v from outside the allowed domains", claims[c.userIDClaim])
+			q.Set("error", oauth2.ErrorAccessDenied)
+			q.Set("error_description", "not a user of an allowed domain")
+			redirectError(w, errorURL, q)
+			return
+		}
 		if err != nil {
 			log.Errorf("Failed parsing claims from remote provider: %v", err)
 			q.Set("error", oauth2.ErrorUnsupportedResponseType)
@@ -161,7 +327,7 @@ func (c *OIDCConnector) handleCallbackFunc(lf oidc.LoginFunc, errorURL url.URL)
 			return
 		}
 
-		redirectURL, err := lf(*ident, sessionKey)
+		redirectURL, err := lf(*ident, groups, sessionKey)
 		if err != nil {
 			log.Errorf("Unable to log in %#v: %v", *ident, err)
 			q.Set("error", oauth2.ErrorAccessDenied)
@@ -1,17 +1,21 @@
 package connector
 
 import (
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"reflect"
 	"testing"
 
+	"github.com/kylelemons/godebug/pretty"
+
+	"github.com/coreos/go-oidc/jose"
 	"github.com/coreos/go-oidc/oidc"
 )
 
 func TestLoginURL(t *testing.T) {
-	lf := func(ident oidc.Identity, sessionKey string) (redirectURL string, err error) { return }
+	lf := func(ident oidc.Identity, groups []string, sessionKey string) (redirectURL string, err error) { return }
 
 	tests := []struct {
 		cid    string
@@ -142,3 +146,219 @@ func TestRedirectError(t *testing.T) {
 		t.Errorf("Incorrect Location header: want=%s got=%s", wantLoc, gotLoc)
 	}
 }
+
+func TestLoginURLWithParams(t *testing.T) {
+	cl, err := oidc.NewClient(oidc.ClientConfig{
+		Credentials: oidc.ClientCredentials{ID: "fake-client-id", Secret: "fake-client-secret"},
+		RedirectURL: "http://example.com/oauth-redirect",
+		ProviderConfig: oidc.ProviderConfig{
+			AuthEndpoint:  &url.URL{Scheme: "http", Host: "example.com", Path: "/authorize"},
+			TokenEndpoint: &url.URL{Scheme: "http", Host: "example.com", Path: "/token"},
+		},
+		Scope: []string{"openid", "email"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	params := url.Values{
+		"prompt":     {"login"},
+		"login_hint": {"elroy@example.com"},
+		"acr_values": {"mfa"},
+	}
+
+	tests := []struct {
+		forwardedParams []string
+		hostedDomains   []string
+		prompt          string
+		want            url.Values
+	}{
+		// Nothing is forwarded unless configured.
+		{
+			want: url.Values{},
+		},
+		{
+			forwardedParams: []string{"prompt", "login_hint", "acr_values"},
+			want: url.Values{
+				"prompt":     {"login"},
+				"login_hint": {"elroy@example.com"},
+				"acr_values": {"mfa"},
+			},
+		},
+		// Dex's own prompt wins.
+		{
+			forwardedParams: []string{"prompt"},
+			prompt:          "select_account",
+			want:            url.Values{"prompt": {"select_account"}},
+		},
+		{
+			forwardedParams: []string{"login_hint"},
+			hostedDomains:   []string{"example.com"},
+			want: url.Values{
+				"login_hint": {"elroy@example.com"},
+				"hd":         {"example.com"},
+			},
+		},
+		// Google can't be told to offer several domains.
+		{
+			hostedDomains: []string{"example.com", "example.org"},
+			want:          url.Values{},
+		},
+	}
+
+	for i, tt := range tests {
+		cn := &OIDCConnector{
+			client:          cl,
+			forwardedParams: tt.forwardedParams,
+			hostedDomains:   tt.hostedDomains,
+		}
+		lu, err := cn.LoginURLWithParams("fake-session-id", tt.prompt, params)
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		u, err := url.Parse(lu)
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+
+		want := url.Values{
+			"response_type": {"code"},
+			"state":         {"fake-session-id"},
+			"redirect_uri":  {"http://example.com/oauth-redirect"},
+			"scope":         {"openid email"},
+			"client_id":     {"fake-client-id"},
+		}
+		for k, v := range tt.want {
+			want[k] = v
+		}
+		if got := u.Query(); !reflect.DeepEqual(want, got) {
+			t.Errorf("case %d:\nwant: %v\ngot:  %v", i, want, got)
+		}
+	}
+}
+
+func TestOIDCConnectorIdentity(t *testing.T) {
+	tests := []struct {
+		cfg        OIDCConnectorConfig
+		claims     jose.Claims
+		wantIdent  oidc.Identity
+		wantGroups []string
+		wantErr    error
+	}{
+		{
+			claims:    jose.Claims{"sub": "elroy-id", "name": "Elroy", "email": "elroy@example.com"},
+			wantIdent: oidc.Identity{ID: "elroy-id", Name: "Elroy", Email: "elroy@example.com"},
+		},
+		// Claims can be mapped, and groups released.
+		{
+			cfg: OIDCConnectorConfig{
+				UserIDClaim: "oid",
+				NameClaim:   "preferred_username",
+				EmailClaim:  "upn",
+				GroupsClaim: "groups",
+			},
+			claims: jose.Claims{
+				"sub":                "pairwise-id",
+				"oid":                "elroy-id",
+				"preferred_username": "elroy",
+				"upn":                "elroy@example.com",
+				"groups":             []interface{}{"admins", "users"},
+			},
+			wantIdent:  oidc.Identity{ID: "elroy-id", Name: "elroy", Email: "elroy@example.com"},
+			wantGroups: []string{"admins", "users"},
+		},
+		{
+			cfg:        OIDCConnectorConfig{GroupsClaim: "role"},
+			claims:     jose.Claims{"sub": "elroy-id", "role": "admin"},
+			wantIdent:  oidc.Identity{ID: "elroy-id"},
+			wantGroups: []string{"admin"},
+		},
+		{
+			cfg:     OIDCConnectorConfig{UserIDClaim: "oid"},
+			claims:  jose.Claims{"sub": "elroy-id"},
+			wantErr: errors.New("missing required claim: oid"),
+		},
+		// Hosted domains.
+		{
+			cfg:       OIDCConnectorConfig{HostedDomains: []string{"example.com"}},
+			claims:    jose.Claims{"sub": "elroy-id", "hd": "Example.com"},
+			wantIdent: oidc.Identity{ID: "elroy-id"},
+		},
+		{
+			cfg:     OIDCConnectorConfig{HostedDomains: []string{"example.com"}},
+			claims:  jose.Claims{"sub": "elroy-id", "hd": "example.org"},
+			wantErr: errOIDCDomainNotAllowed,
+		},
+		{
+			cfg:     OIDCConnectorConfig{HostedDomains: []string{"example.com"}},
+			claims:  jose.Claims{"sub": "elroy-id", "email": "elroy@example.com"},
+			wantErr: errOIDCDomainNotAllowed,
+		},
+		// Email domains.
+		{
+			cfg:       OIDCConnectorConfig{EmailDomains: []string{"example.com"}},
+			claims:    jose.Claims{"sub": "elroy-id", "email": "elroy@example.com", "email_verified": true},
+			wantIdent: oidc.Identity{ID: "elroy-id", Email: "elroy@example.com"},
+		},
+		{
+			cfg:     OIDCConnectorConfig{EmailDomains: []string{"example.com"}},
+			claims:  jose.Claims{"sub": "elroy-id", "email": "elroy@example.com", "email_verified": false},
+			wantErr: errOIDCDomainNotAllowed,
+		},
+		{
+			cfg:     OIDCConnectorConfig{EmailDomains: []string{"example.com"}},
+			claims:  jose.Claims{"sub": "elroy-id", "email": "elroy@example.com"},
+			wantErr: errOIDCDomainNotAllowed,
+		},
+		{
+			cfg:     OIDCConnectorConfig{EmailDomains: []string{"example.com"}},
+			claims:  jose.Claims{"sub": "elroy-id", "email": "elroy@evil.example.com"},
+			wantErr: errOIDCDomainNotAllowed,
+		},
+		{
+			cfg:     OIDCConnectorConfig{EmailDomains: []string{"example.com"}},
+			claims:  jose.Claims{"sub": "elroy-id"},
+			wantErr: errOIDCDomainNotAllowed,
+		},
+	}
+
+	for i, tt := range tests {
+		tt.cfg.IssuerURL = "https://accounts.example.com"
+		conn, err := tt.cfg.Connector(url.URL{Scheme: "http", Host: "dex.example.com"}, nil, nil)
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		ident, groups, err := conn.(*OIDCConnector).identity(tt.claims)
+		if tt.wantErr != nil {
+			if err == nil || err.Error() != tt.wantErr.Error() {
+				t.Errorf("case %d: want err=%v, got=%v", i, tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if diff := pretty.Compare(tt.wantIdent, *ident); diff != "" {
+			t.Errorf("case %d: Compare(want, got) = %v", i, diff)
+		}
+		if diff := pretty.Compare(tt.wantGroups, groups); diff != "" {
+			t.Errorf("case %d: Compare(want, got) = %v", i, diff)
+		}
+	}
+}
+
+func TestOIDCConnectorConfigInvalid(t *testing.T) {
+	tests := []OIDCConnectorConfig{
+		{Scopes: []string{"email", "profile"}},
+		{ForwardedParams: []string{"redirect_uri"}},
+	}
+
+	for i, cfg := range tests {
+		if _, err := cfg.Connector(url.URL{Scheme: "http", Host: "dex.example.com"}, nil, nil); err == nil {
+			t.Errorf("case %d: want non-nil error", i)
+		}
+	}
+}
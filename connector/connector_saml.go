@@ -0,0 +1,679 @@
+package connector
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coreos/dex/pkg/log"
+	"github.com/coreos/dex/pkg/xmldsig"
+	"github.com/coreos/go-oidc/oauth2"
+	"github.com/coreos/go-oidc/oidc"
+	"github.com/jonboulle/clockwork"
+)
+
+const (
+	SAMLConnectorType = "saml"
+
+	httpPathMetadata = "/metadata"
+
+	samlProtocolNamespace  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	samlAssertionNamespace = "urn:oasis:names:tc:SAML:2.0:assertion"
+
+	samlBindingHTTPRedirect = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	samlBindingHTTPPost     = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+
+	samlStatusSuccess         = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	samlSubjectConfirmBearer  = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+	samlNameIDFormatEmail     = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+	samlNameIDFormatTransient = "urn:oasis:names:tc:SAML:2.0:nameid-format:transient"
+	samlMetadataContentType   = "application/samlmetadata+xml"
+	samlAllowedClockSkew      = 3 * time.Minute
+)
+
+func init() {
+	RegisterConnectorConfigType(SAMLConnectorType, func() ConnectorConfig { return &SAMLConnectorConfig{} })
+}
+
+type SAMLConnectorConfig struct {
+	ID string `json:"id"`
+
+	// EntityID identifies dex to the IdP. It defaults to the URL of the
+	// connector's SP metadata.
+	EntityID string `json:"entityID"`
+
+	// IdPMetadataFile is a file with the SAML metadata of the IdP, from which
+	// the IdP's entity ID, single sign-on URL and signing certificates are
+	// read. Alternatively they can be set with IdPEntityID, IdPSSOURL and
+	// IdPCertFile, which take precedence.
+	IdPMetadataFile string `json:"idpMetadataFile"`
+	IdPEntityID     string `json:"idpEntityID"`
+	IdPSSOURL       string `json:"idpSSOURL"`
+	IdPCertFile     string `json:"idpCertFile"`
+
+	// NameIDFormat is the format of the NameID requested from the IdP. It
+	// should be persistent, since the NameID is used as the ID of the remote
+	// identity.
+	NameIDFormat string `json:"nameIDFormat"`
+
+	NameAttribute   string `json:"nameAttribute"`
+	EmailAttribute  string `json:"emailAttribute"`
+	GroupsAttribute string `json:"groupsAttribute"`
+
+	TrustedEmailProvider bool `json:"trustedEmailProvider"`
+}
+
+func (cfg *SAMLConnectorConfig) ConnectorID() string {
+	return cfg.ID
+}
+
+func (cfg *SAMLConnectorConfig) ConnectorType() string {
+	return SAMLConnectorType
+}
+
+type SAMLConnector struct {
+	id                   string
+	entityID             string
+	acsURL               url.URL
+	metadataURL          url.URL
+	loginFunc            LoginFunc
+	idpEntityID          string
+	idpSSOURL            string
+	idpCerts             []*x509.Certificate
+	nameIDFormat         string
+	nameAttribute        string
+	emailAttribute       string
+	groupsAttribute      string
+	trustedEmailProvider bool
+	clock                clockwork.Clock
+}
+
+func (cfg *SAMLConnectorConfig) Connector(ns url.URL, lf LoginFunc, tpls *template.Template) (Connector, error) {
+	idpEntityID, idpSSOURL, idpCerts := cfg.IdPEntityID, cfg.IdPSSOURL, []*x509.Certificate(nil)
+	if cfg.IdPMetadataFile != "" {
+		b, err := ioutil.ReadFile(cfg.IdPMetadataFile)
+		if err != nil {
+			return nil, err
+		}
+		md, err := parseSAMLIdPMetadata(b)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", cfg.IdPMetadataFile, err)
+		}
+		if idpEntityID == "" {
+			idpEntityID = md.entityID
+		}
+		if idpSSOURL == "" {
+			idpSSOURL = md.ssoURL
+		}
+		idpCerts = md.certs
+	}
+	if cfg.IdPCertFile != "" {
+		b, err := ioutil.ReadFile(cfg.IdPCertFile)
+		if err != nil {
+			return nil, err
+		}
+		if idpCerts, err = parsePEMCertificates(b); err != nil {
+			return nil, fmt.Errorf("%v: %v", cfg.IdPCertFile, err)
+		}
+	}
+
+	if idpEntityID == "" {
+		return nil, errors.New("SAML connector requires the entity ID of the IdP")
+	}
+	if idpSSOURL == "" {
+		return nil, errors.New("SAML connector requires the single sign-on URL of the IdP")
+	}
+	if len(idpCerts) == 0 {
+		return nil, errors.New("SAML connector requires the signing certificates of the IdP")
+	}
+
+	acsURL, metadataURL := ns, ns
+	acsURL.Path = path.Join(ns.Path, httpPathCallback)
+	metadataURL.Path = path.Join(ns.Path, httpPathMetadata)
+
+	entityID := cfg.EntityID
+	if entityID == "" {
+		entityID = metadataURL.String()
+	}
+
+	return &SAMLConnector{
+		id:                   cfg.ID,
+		entityID:             entityID,
+		acsURL:               acsURL,
+		metadataURL:          metadataURL,
+		loginFunc:            lf,
+		idpEntityID:          idpEntityID,
+		idpSSOURL:            idpSSOURL,
+		idpCerts:             idpCerts,
+		nameIDFormat:         cfg.NameIDFormat,
+		nameAttribute:        cfg.NameAttribute,
+		emailAttribute:       cfg.EmailAttribute,
+		groupsAttribute:      cfg.GroupsAttribute,
+		trustedEmailProvider: cfg.TrustedEmailProvider,
+		clock:                clockwork.NewRealClock(),
+	}, nil
+}
+
+func (c *SAMLConnector) ID() string {
+	return c.id
+}
+
+func (c *SAMLConnector) Healthy() error {
+	return nil
+}
+
+func (c *SAMLConnector) Sync() chan struct{} {
+	return make(chan struct{})
+}
+
+func (c *SAMLConnector) TrustedEmailProvider() bool {
+	return c.trustedEmailProvider
+}
+
+// LoginURL returns the URL of the IdP's single sign-on service with an
+// AuthnRequest, using the HTTP-Redirect binding. The session key is passed
+// as the RelayState, which the IdP posts back with its response.
+func (c *SAMLConnector) LoginURL(sessionKey, prompt string) (string, error) {
+	req := samlAuthnRequest{
+		ID:                          samlRequestID(sessionKey),
+		Version:                     "2.0",
+		IssueInstant:                c.clock.Now().UTC().Truncate(time.Second),
+		Destination:                 c.idpSSOURL,
+		ProtocolBinding:             samlBindingHTTPPost,
+		AssertionConsumerServiceURL: c.acsURL.String(),
+		ForceAuthn:                  prompt == "login",
+		Issuer:                      samlIssuer{Value: c.entityID},
+	}
+	if c.nameIDFormat != "" {
+		req.NameIDPolicy = &samlNameIDPolicy{Format: c.nameIDFormat, AllowCreate: true}
+	}
+
+	data, err := xml.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	fw, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		return "", err
+	}
+	fw.Write(data)
+	if err := fw.Close(); err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(c.idpSSOURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("SAMLRequest", base64.StdEncoding.EncodeToString(buf.Bytes()))
+	q.Set("RelayState", sessionKey)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+func (c *SAMLConnector) Register(mux *http.ServeMux, errorURL url.URL) {
+	mux.Handle(c.acsURL.Path, c.handleACSFunc(c.loginFunc, errorURL))
+	mux.Handle(c.metadataURL.Path, c.handleMetadataFunc())
+}
+
+func (c *SAMLConnector) handleMetadataFunc() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			w.Header().Set("Allow", "GET")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		md := samlSPMetadata{
+			EntityID: c.entityID,
+			SPSSODescriptor: samlSPSSODescriptor{
+				ProtocolSupportEnumeration: samlProtocolNamespace,
+				AuthnRequestsSigned:        false,
+				WantAssertionsSigned:       true,
+				AssertionConsumerService: samlEndpoint{
+					Binding:  samlBindingHTTPPost,
+					Location: c.acsURL.String(),
+				},
+			},
+		}
+		if c.nameIDFormat != "" {
+			md.SPSSODescriptor.NameIDFormats = []string{c.nameIDFormat}
+		}
+
+		b, err := xml.MarshalIndent(md, "", "  ")
+		if err != nil {
+			log.Errorf("Unable to marshal SAML metadata: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", samlMetadataContentType)
+		w.Write([]byte(xml.Header))
+		w.Write(b)
+	}
+}
+
+func (c *SAMLConnector) handleACSFunc(lf LoginFunc, errorURL url.URL) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.Header().Set("Allow", "POST")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		q := url.Values{}
+		if err := r.ParseForm(); err != nil {
+			q.Set("error", oauth2.ErrorInvalidRequest)
+			q.Set("error_description", "unable to parse form")
+			redirectError(w, errorURL, q)
+			return
+		}
+
+		resp := r.PostForm.Get("SAMLResponse")
+		if resp == "" {
+			q.Set("error", oauth2.ErrorInvalidRequest)
+			q.Set("error_description", "SAMLResponse must be set")
+			redirectError(w, errorURL, q)
+			return
+		}
+		sessionKey := r.PostForm.Get("RelayState")
+
+		ident, groups, err := c.identity(resp, sessionKey)
+		if err == errSAMLAuthnFailed {
+			log.Errorf("IdP did not authenticate the user")
+			q.Set("error", oauth2.ErrorAccessDenied)
+			q.Set("error_description", "authentication failed at the issuer")
+			redirectError(w, errorURL, q)
+			return
+		}
+		if err != nil {
+			log.Errorf("Unable to verify SAML response: %v", err)
+			q.Set("error", oauth2.ErrorInvalidRequest)
+			q.Set("error_description", "unable to verify SAML response")
+			redirectError(w, errorURL, q)
+			return
+		}
+
+		redirectURL, err := lf(ident, groups, sessionKey)
+		if err != nil {
+			log.Errorf("Unable to log in %#v: %v", ident, err)
+			q.Set("error", oauth2.ErrorAccessDenied)
+			q.Set("error_description", "login failed")
+			redirectError(w, errorURL, q)
+			return
+		}
+		w.Header().Set("Location", redirectURL)
+		w.WriteHeader(http.StatusFound)
+	}
+}
+
+var errSAMLAuthnFailed = errors.New("IdP returned an unsuccessful status")
+
+// identity verifies a base64 encoded SAML response to the AuthnRequest made
+// for the session key, and returns the identity and, if a groups attribute is
+// configured, the groups it asserts.
+func (c *SAMLConnector) identity(encoded, sessionKey string) (oidc.Identity, []string, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return oidc.Identity{}, nil, fmt.Errorf("malformed SAMLResponse: %v", err)
+	}
+	root, err := xmldsig.Parse(data)
+	if err != nil {
+		return oidc.Identity{}, nil, err
+	}
+	if root.Space != samlProtocolNamespace || root.Local != "Response" {
+		return oidc.Identity{}, nil, errors.New("not a SAML response")
+	}
+	if len(root.FindChildren(samlAssertionNamespace, "EncryptedAssertion")) != 0 {
+		return oidc.Identity{}, nil, errors.New("encrypted assertions are not supported")
+	}
+	assertions := root.FindChildren(samlAssertionNamespace, "Assertion")
+
+	// Only data covered by a signature is used: either the response is
+	// signed, or else its assertion must be. The status of the response is
+	// checked either way, since it needn't have an assertion if it's
+	// unsuccessful.
+	var resp samlResponse
+	signed, err := xmldsig.Verify(root, c.idpCerts)
+	switch err {
+	case nil:
+		if err := xml.Unmarshal(signed, &resp); err != nil {
+			return oidc.Identity{}, nil, err
+		}
+	case xmldsig.ErrMissingSignature:
+		if err := xml.Unmarshal(data, &resp); err != nil {
+			return oidc.Identity{}, nil, err
+		}
+		if resp.Status.StatusCode.Value != samlStatusSuccess {
+			break
+		}
+		if len(assertions) != 1 {
+			return oidc.Identity{}, nil, errors.New("response must contain exactly one assertion")
+		}
+		signed, err = xmldsig.Verify(assertions[0], c.idpCerts)
+		if err != nil {
+			return oidc.Identity{}, nil, fmt.Errorf("assertion: %v", err)
+		}
+		resp.Assertion = &samlAssertion{}
+		if err := xml.Unmarshal(signed, resp.Assertion); err != nil {
+			return oidc.Identity{}, nil, err
+		}
+	default:
+		return oidc.Identity{}, nil, err
+	}
+
+	if resp.Status.StatusCode.Value != samlStatusSuccess {
+		return oidc.Identity{}, nil, errSAMLAuthnFailed
+	}
+	if len(assertions) != 1 || resp.Assertion == nil {
+		return oidc.Identity{}, nil, errors.New("response must contain exactly one assertion")
+	}
+
+	requestID := samlRequestID(sessionKey)
+	if resp.Destination != "" && resp.Destination != c.acsURL.String() {
+		return oidc.Identity{}, nil, fmt.Errorf("response destination %q is not the ACS URL", resp.Destination)
+	}
+	if resp.Issuer != nil && resp.Issuer.Value != c.idpEntityID {
+		return oidc.Identity{}, nil, fmt.Errorf("response issuer %q is not the IdP", resp.Issuer.Value)
+	}
+	if resp.InResponseTo != "" && resp.InResponseTo != requestID {
+		return oidc.Identity{}, nil, errors.New("response is not for this session")
+	}
+
+	a := resp.Assertion
+	if err := c.verifyAssertion(a, requestID); err != nil {
+		return oidc.Identity{}, nil, err
+	}
+
+	ident := oidc.Identity{
+		ID: a.Subject.NameID.Value,
+	}
+	if c.nameAttribute != "" {
+		ident.Name = a.attributeValue(c.nameAttribute)
+	}
+	if c.emailAttribute != "" {
+		ident.Email = a.attributeValue(c.emailAttribute)
+	}
+	if ident.Email == "" && a.Subject.NameID.Format == samlNameIDFormatEmail {
+		ident.Email = a.Subject.NameID.Value
+	}
+
+	var groups []string
+	if c.groupsAttribute != "" {
+		groups = a.attributeValues(c.groupsAttribute)
+		sort.Strings(groups)
+	}
+	return ident, groups, nil
+}
+
+// verifyAssertion checks that the assertion is from the IdP, is currently
+// valid, is meant for dex, and answers the request with the given ID.
+func (c *SAMLConnector) verifyAssertion(a *samlAssertion, requestID string) error {
+	now := c.clock.Now()
+
+	if a.Issuer.Value != c.idpEntityID {
+		return fmt.Errorf("assertion issuer %q is not the IdP", a.Issuer.Value)
+	}
+
+	// The bearer profile requires an audience restriction, without which
+	// an assertion for another SP could be used here.
+	cond := a.Conditions
+	if cond == nil || len(cond.AudienceRestrictions) == 0 {
+		return errors.New("assertion has no audience restriction")
+	}
+	if !cond.NotBefore.IsZero() && now.Add(samlAllowedClockSkew).Before(cond.NotBefore) {
+		return errors.New("assertion is not yet valid")
+	}
+	if !cond.NotOnOrAfter.IsZero() && !now.Add(-samlAllowedClockSkew).Before(cond.NotOnOrAfter) {
+		return errors.New("assertion has expired")
+	}
+	for _, ar := range cond.AudienceRestrictions {
+		if !containsString(ar.Audiences, c.entityID) {
+			return fmt.Errorf("assertion is not for audience %q", c.entityID)
+		}
+	}
+
+	if a.Subject.NameID.Value == "" {
+		return errors.New("assertion has no NameID")
+	}
+	if a.Subject.NameID.Format == samlNameIDFormatTransient {
+		return errors.New("transient NameIDs cannot identify users across logins")
+	}
+
+	for _, sc := range a.Subject.SubjectConfirmations {
+		if sc.Method != samlSubjectConfirmBearer {
+			continue
+		}
+		d := sc.SubjectConfirmationData
+		if d.Recipient != c.acsURL.String() {
+			continue
+		}
+		if d.NotOnOrAfter.IsZero() || !now.Add(-samlAllowedClockSkew).Before(d.NotOnOrAfter) {
+			continue
+		}
+		if d.InResponseTo != requestID {
+			continue
+		}
+		return nil
+	}
+	return errors.New("assertion has no valid bearer subject confirmation")
+}
+
+// samlRequestID derives the ID of the AuthnRequest for a session from its
+// key, so that responses can be tied to the session without keeping state.
+func samlRequestID(sessionKey string) string {
+	sum := sha256.Sum256([]byte(sessionKey))
+	// IDs must be XML names, which cannot start with a digit.
+	return "_" + hex.EncodeToString(sum[:])
+}
+
+func containsString(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+type samlIdPMetadata struct {
+	entityID string
+	ssoURL   string
+	certs    []*x509.Certificate
+}
+
+// parseSAMLIdPMetadata reads the entity ID, HTTP-Redirect single sign-on
+// URL and signing certificates from an IdP's metadata.
+func parseSAMLIdPMetadata(data []byte) (*samlIdPMetadata, error) {
+	var ed struct {
+		EntityID         string `xml:"entityID,attr"`
+		IDPSSODescriptor *struct {
+			KeyDescriptors []struct {
+				Use          string   `xml:"use,attr"`
+				Certificates []string `xml:"KeyInfo>X509Data>X509Certificate"`
+			} `xml:"KeyDescriptor"`
+			SingleSignOnServices []samlEndpoint `xml:"SingleSignOnService"`
+		} `xml:"IDPSSODescriptor"`
+	}
+	if err := xml.Unmarshal(data, &ed); err != nil {
+		return nil, err
+	}
+	if ed.IDPSSODescriptor == nil {
+		return nil, errors.New("no IDPSSODescriptor in metadata")
+	}
+
+	md := &samlIdPMetadata{entityID: ed.EntityID}
+	for _, sso := range ed.IDPSSODescriptor.SingleSignOnServices {
+		if sso.Binding == samlBindingHTTPRedirect {
+			md.ssoURL = sso.Location
+			break
+		}
+	}
+	for _, kd := range ed.IDPSSODescriptor.KeyDescriptors {
+		if kd.Use != "" && kd.Use != "signing" {
+			continue
+		}
+		for _, c := range kd.Certificates {
+			der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(c), ""))
+			if err != nil {
+				return nil, fmt.Errorf("malformed certificate: %v", err)
+			}
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				return nil, err
+			}
+			md.certs = append(md.certs, cert)
+		}
+	}
+	return md, nil
+}
+
+func parsePEMCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no certificates found")
+	}
+	return certs, nil
+}
+
+type samlIssuer struct {
+	XMLName xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	Value   string   `xml:",chardata"`
+}
+
+type samlNameIDPolicy struct {
+	XMLName     xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:protocol NameIDPolicy"`
+	Format      string   `xml:",attr,omitempty"`
+	AllowCreate bool     `xml:",attr"`
+}
+
+type samlAuthnRequest struct {
+	XMLName                     xml.Name          `xml:"urn:oasis:names:tc:SAML:2.0:protocol AuthnRequest"`
+	ID                          string            `xml:",attr"`
+	Version                     string            `xml:",attr"`
+	IssueInstant                time.Time         `xml:",attr"`
+	Destination                 string            `xml:",attr"`
+	ProtocolBinding             string            `xml:",attr"`
+	AssertionConsumerServiceURL string            `xml:",attr"`
+	ForceAuthn                  bool              `xml:",attr,omitempty"`
+	Issuer                      samlIssuer        `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	NameIDPolicy                *samlNameIDPolicy `xml:"urn:oasis:names:tc:SAML:2.0:protocol NameIDPolicy"`
+}
+
+type samlEndpoint struct {
+	Binding  string `xml:",attr"`
+	Location string `xml:",attr"`
+}
+
+type samlSPSSODescriptor struct {
+	ProtocolSupportEnumeration string       `xml:"protocolSupportEnumeration,attr"`
+	AuthnRequestsSigned        bool         `xml:",attr"`
+	WantAssertionsSigned       bool         `xml:",attr"`
+	NameIDFormats              []string     `xml:"NameIDFormat"`
+	AssertionConsumerService   samlEndpoint `xml:"AssertionConsumerService"`
+}
+
+type samlSPMetadata struct {
+	XMLName         xml.Name            `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntityDescriptor"`
+	EntityID        string              `xml:"entityID,attr"`
+	SPSSODescriptor samlSPSSODescriptor `xml:"SPSSODescriptor"`
+}
+
+type samlResponse struct {
+	XMLName      xml.Name    `xml:"urn:oasis:names:tc:SAML:2.0:protocol Response"`
+	Destination  string      `xml:",attr"`
+	InResponseTo string      `xml:",attr"`
+	Issuer       *samlIssuer `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	Status       struct {
+		StatusCode struct {
+			Value string `xml:",attr"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:protocol StatusCode"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:protocol Status"`
+	Assertion *samlAssertion `xml:"urn:oasis:names:tc:SAML:2.0:assertion Assertion"`
+}
+
+type samlAssertion struct {
+	XMLName xml.Name   `xml:"urn:oasis:names:tc:SAML:2.0:assertion Assertion"`
+	Issuer  samlIssuer `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	Subject struct {
+		NameID struct {
+			Format string `xml:",attr"`
+			Value  string `xml:",chardata"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:assertion NameID"`
+		SubjectConfirmations []struct {
+			Method                  string `xml:",attr"`
+			SubjectConfirmationData struct {
+				Recipient    string    `xml:",attr"`
+				NotOnOrAfter time.Time `xml:",attr"`
+				InResponseTo string    `xml:",attr"`
+			} `xml:"urn:oasis:names:tc:SAML:2.0:assertion SubjectConfirmationData"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:assertion SubjectConfirmation"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:assertion Subject"`
+	Conditions *struct {
+		NotBefore            time.Time `xml:",attr"`
+		NotOnOrAfter         time.Time `xml:",attr"`
+		AudienceRestrictions []struct {
+			Audiences []string `xml:"urn:oasis:names:tc:SAML:2.0:assertion Audience"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:assertion AudienceRestriction"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:assertion Conditions"`
+	Attributes []struct {
+		Name   string   `xml:",attr"`
+		Values []string `xml:"urn:oasis:names:tc:SAML:2.0:assertion AttributeValue"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:assertion AttributeStatement>Attribute"`
+}
+
+// attributeValues returns the values of the attributes with the given name.
+func (a *samlAssertion) attributeValues(name string) []string {
+	var values []string
+	for _, attr := range a.Attributes {
+		if attr.Name == name {
+			for _, v := range attr.Values {
+				if v = strings.TrimSpace(v); v != "" {
+					values = append(values, v)
+				}
+			}
+		}
+	}
+	return values
+}
+
+// attributeValue returns the first value of the attribute with the given
+// name, or "" if there is none.
+func (a *samlAssertion) attributeValue(name string) string {
+	values := a.attributeValues(name)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
@@ -0,0 +1,564 @@
+package connector
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"encoding/xml"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/dex/pkg/xmldsig"
+	"github.com/coreos/go-oidc/oidc"
+	"github.com/jonboulle/clockwork"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+const (
+	samlTestIdP        = "https://idp.example.com"
+	samlTestSessionKey = "abc123"
+)
+
+func newSAMLTestKey(t *testing.T) (*rsa.PrivateKey, *x509.Certificate) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, cert
+}
+
+func newSAMLTestConnector(t *testing.T, cert *x509.Certificate) *SAMLConnector {
+	f, err := ioutil.TempFile("", "dex-saml-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	pem.Encode(f, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	f.Close()
+
+	cfg := SAMLConnectorConfig{
+		ID:              "saml",
+		IdPEntityID:     samlTestIdP,
+		IdPSSOURL:       "https://idp.example.com/sso?tenant=1",
+		IdPCertFile:     f.Name(),
+		NameAttribute:   "displayName",
+		GroupsAttribute: "groups",
+	}
+	ns, _ := url.Parse("http://dex.example.com/auth/saml")
+	conn, err := cfg.Connector(*ns, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := conn.(*SAMLConnector)
+	c.clock = clockwork.NewFakeClock()
+	return c
+}
+
+// samlTestResponse holds the parts of a SAML response which tests vary.
+type samlTestResponse struct {
+	status       string
+	issuer       string
+	destination  string
+	recipient    string
+	audience     string
+	inResponseTo string
+	notOnOrAfter time.Time
+	nameIDFormat string
+	nameID       string
+
+	// noConditions leaves out the Conditions element; an empty audience
+	// leaves out its AudienceRestriction.
+	noConditions bool
+}
+
+func newSAMLTestResponse(c *SAMLConnector) samlTestResponse {
+	return samlTestResponse{
+		status:       samlStatusSuccess,
+		issuer:       samlTestIdP,
+		destination:  c.acsURL.String(),
+		recipient:    c.acsURL.String(),
+		audience:     c.entityID,
+		inResponseTo: samlRequestID(samlTestSessionKey),
+		notOnOrAfter: c.clock.Now().Add(5 * time.Minute),
+		nameIDFormat: "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent",
+		nameID:       "jane",
+	}
+}
+
+// assertion returns an assertion with the given ID, with a placeholder for
+// its Signature element.
+func (r samlTestResponse) assertion(id string) string {
+	esc := func(s string) string {
+		var buf bytes.Buffer
+		xml.EscapeText(&buf, []byte(s))
+		return buf.String()
+	}
+	var conditions string
+	if !r.noConditions {
+		conditions = `<saml:Conditions NotOnOrAfter="` + r.notOnOrAfter.UTC().Format(time.RFC3339) + `">`
+		if r.audience != "" {
+			conditions += `<saml:AudienceRestriction><saml:Audience>` + esc(r.audience) + `</saml:Audience></saml:AudienceRestriction>`
+		}
+		conditions += `</saml:Conditions>`
+	}
+	return `<saml:Assertion ID="` + id + `" Version="2.0">` +
+		`<saml:Issuer>` + esc(r.issuer) + `</saml:Issuer>` + samlSignaturePlaceholder(id) +
+		`<saml:Subject><saml:NameID Format="` + esc(r.nameIDFormat) + `">` + esc(r.nameID) + `</saml:NameID>` +
+		`<saml:SubjectConfirmation Method="` + samlSubjectConfirmBearer + `">` +
+		`<saml:SubjectConfirmationData Recipient="` + esc(r.recipient) + `" InResponseTo="` + esc(r.inResponseTo) +
+		`" NotOnOrAfter="` + r.notOnOrAfter.UTC().Format(time.RFC3339) + `"/>` +
+		`</saml:SubjectConfirmation></saml:Subject>` +
+		conditions +
+		`<saml:AttributeStatement>` +
+		`<saml:Attribute Name="displayName"><saml:AttributeValue>Jane Doe</saml:AttributeValue></saml:Attribute>` +
+		`<saml:Attribute Name="groups"><saml:AttributeValue>staff</saml:AttributeValue><saml:AttributeValue>admins</saml:AttributeValue></saml:Attribute>` +
+		`</saml:AttributeStatement>` +
+		`</saml:Assertion>`
+}
+
+// response returns a response with the given assertions, with a placeholder
+// for its Signature element.
+func (r samlTestResponse) response(assertions ...string) string {
+	return `<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion"` +
+		` ID="_response" Version="2.0" Destination="` + r.destination + `" InResponseTo="` + r.inResponseTo + `">` +
+		`<saml:Issuer>` + r.issuer + `</saml:Issuer>` + samlSignaturePlaceholder("_response") +
+		`<samlp:Status><samlp:StatusCode Value="` + r.status + `"/></samlp:Status>` +
+		strings.Join(assertions, "") +
+		`</samlp:Response>`
+}
+
+func samlSignaturePlaceholder(id string) string {
+	return "<!--signature:" + id + "-->"
+}
+
+var samlSignaturePlaceholderRegexp = regexp.MustCompile(`<!--signature:[^-]*-->`)
+
+// samlSign signs the element with the given ID in doc, putting the signature
+// in its placeholder, and removes all placeholders.
+func samlSign(t *testing.T, key *rsa.PrivateKey, doc, id string) string {
+	fill := func(sig string) string {
+		doc := strings.Replace(doc, samlSignaturePlaceholder(id), sig, 1)
+		return samlSignaturePlaceholderRegexp.ReplaceAllString(doc, "")
+	}
+
+	root, err := xmldsig.Parse([]byte(fill("")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var signed *xmldsig.Element
+	var find func(e *xmldsig.Element)
+	find = func(e *xmldsig.Element) {
+		if e.AttrValue("ID") == id {
+			signed = e
+		}
+		for _, c := range e.ChildElements() {
+			find(c)
+		}
+	}
+	find(root)
+	digest := sha256.Sum256(xmldsig.Canonicalize(signed, nil, nil))
+
+	signedInfo := `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#">` +
+		`<ds:CanonicalizationMethod Algorithm="` + xmldsig.AlgExcC14N + `"/>` +
+		`<ds:SignatureMethod Algorithm="` + xmldsig.AlgRSASHA256 + `"/>` +
+		`<ds:Reference URI="#` + id + `"><ds:Transforms>` +
+		`<ds:Transform Algorithm="` + xmldsig.AlgEnvelopedSignature + `"/>` +
+		`<ds:Transform Algorithm="` + xmldsig.AlgExcC14N + `"/>` +
+		`</ds:Transforms><ds:DigestMethod Algorithm="` + xmldsig.AlgSHA256 + `"/>` +
+		`<ds:DigestValue>` + base64.StdEncoding.EncodeToString(digest[:]) + `</ds:DigestValue>` +
+		`</ds:Reference></ds:SignedInfo>`
+	si, err := xmldsig.Parse([]byte(signedInfo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashed := sha256.Sum256(xmldsig.Canonicalize(si, nil, nil))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return fill(`<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#">` +
+		strings.Replace(signedInfo, ` xmlns:ds="http://www.w3.org/2000/09/xmldsig#"`, "", 1) +
+		`<ds:SignatureValue>` + base64.StdEncoding.EncodeToString(sig) + `</ds:SignatureValue></ds:Signature>`)
+}
+
+func TestSAMLIdentity(t *testing.T) {
+	key, cert := newSAMLTestKey(t)
+	otherKey, _ := newSAMLTestKey(t)
+	c := newSAMLTestConnector(t, cert)
+
+	valid := newSAMLTestResponse(c)
+
+	// signAssertion returns r's response with its assertion signed by k.
+	signAssertion := func(r samlTestResponse, k *rsa.PrivateKey) string {
+		return samlSign(t, k, r.response(r.assertion("_a1")), "_a1")
+	}
+	modify := func(f func(r *samlTestResponse)) samlTestResponse {
+		r := valid
+		f(&r)
+		return r
+	}
+
+	tests := []struct {
+		resp       string
+		sessionKey string
+		wantErr    bool
+		want       oidc.Identity
+		wantGroups []string
+	}{
+		// Signed assertion.
+		{
+			resp: signAssertion(valid, key),
+			want: oidc.Identity{
+				ID:   "jane",
+				Name: "Jane Doe",
+			},
+			wantGroups: []string{"admins", "staff"},
+		},
+		// Signed response.
+		{
+			resp: samlSign(t, key, valid.response(valid.assertion("_a1")), "_response"),
+			want: oidc.Identity{
+				ID:   "jane",
+				Name: "Jane Doe",
+			},
+			wantGroups: []string{"admins", "staff"},
+		},
+		// The NameID is used as the email if it's an email address.
+		{
+			resp: signAssertion(modify(func(r *samlTestResponse) {
+				r.nameIDFormat = samlNameIDFormatEmail
+				r.nameID = "jane@example.com"
+			}), key),
+			want: oidc.Identity{
+				ID:    "jane@example.com",
+				Name:  "Jane Doe",
+				Email: "jane@example.com",
+			},
+			wantGroups: []string{"admins", "staff"},
+		},
+		// Not signed.
+		{
+			resp:    valid.response(valid.assertion("_a1")),
+			wantErr: true,
+		},
+		// Signed by another key.
+		{
+			resp:    signAssertion(valid, otherKey),
+			wantErr: true,
+		},
+		// Modified after signing.
+		{
+			resp:    strings.Replace(signAssertion(valid, key), ">jane<", ">john<", 1),
+			wantErr: true,
+		},
+		// An unsigned assertion is smuggled in with a signed one.
+		{
+			resp:    samlSign(t, key, valid.response(valid.assertion("_a1"), strings.Replace(valid.assertion("_a2"), ">jane<", ">john<", 1)), "_a1"),
+			wantErr: true,
+		},
+		// Response to another session.
+		{
+			resp:       signAssertion(valid, key),
+			sessionKey: "xyz789",
+			wantErr:    true,
+		},
+		{
+			resp: signAssertion(modify(func(r *samlTestResponse) {
+				r.issuer = "https://evil.example.com"
+			}), key),
+			wantErr: true,
+		},
+		{
+			resp: signAssertion(modify(func(r *samlTestResponse) {
+				r.audience = "https://other.example.com"
+			}), key),
+			wantErr: true,
+		},
+		// Assertions without an audience restriction could be for any SP.
+		{
+			resp: signAssertion(modify(func(r *samlTestResponse) {
+				r.noConditions = true
+			}), key),
+			wantErr: true,
+		},
+		{
+			resp: signAssertion(modify(func(r *samlTestResponse) {
+				r.audience = ""
+			}), key),
+			wantErr: true,
+		},
+		{
+			resp: signAssertion(modify(func(r *samlTestResponse) {
+				r.recipient = "https://other.example.com/acs"
+			}), key),
+			wantErr: true,
+		},
+		{
+			resp: signAssertion(modify(func(r *samlTestResponse) {
+				r.destination = "https://other.example.com/acs"
+			}), key),
+			wantErr: true,
+		},
+		// Expired.
+		{
+			resp: signAssertion(modify(func(r *samlTestResponse) {
+				r.notOnOrAfter = c.clock.Now().Add(-5 * time.Minute)
+			}), key),
+			wantErr: true,
+		},
+		{
+			resp: signAssertion(modify(func(r *samlTestResponse) {
+				r.nameIDFormat = samlNameIDFormatTransient
+			}), key),
+			wantErr: true,
+		},
+		// Authentication failed at the IdP.
+		{
+			resp: modify(func(r *samlTestResponse) {
+				r.status = "urn:oasis:names:tc:SAML:2.0:status:Responder"
+			}).response(),
+			wantErr: true,
+		},
+	}
+
+	for i, tt := range tests {
+		sessionKey := tt.sessionKey
+		if sessionKey == "" {
+			sessionKey = samlTestSessionKey
+		}
+		ident, groups, err := c.identity(base64.StdEncoding.EncodeToString([]byte(tt.resp)), sessionKey)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("case %d: expected an error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if diff := pretty.Compare(tt.want, ident); diff != "" {
+			t.Errorf("case %d: Compare(want, got) = %v", i, diff)
+		}
+		if diff := pretty.Compare(tt.wantGroups, groups); diff != "" {
+			t.Errorf("case %d: Compare(wantGroups, gotGroups) = %v", i, diff)
+		}
+	}
+}
+
+func TestSAMLLoginURL(t *testing.T) {
+	_, cert := newSAMLTestKey(t)
+	c := newSAMLTestConnector(t, cert)
+
+	for _, prompt := range []string{"", "login"} {
+		loginURL, err := c.LoginURL(samlTestSessionKey, prompt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		u, err := url.Parse(loginURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q := u.Query()
+		if u.Host != "idp.example.com" || u.Path != "/sso" || q.Get("tenant") != "1" {
+			t.Errorf("unexpected login URL %s", loginURL)
+		}
+		if got := q.Get("RelayState"); got != samlTestSessionKey {
+			t.Errorf("want RelayState=%q, got=%q", samlTestSessionKey, got)
+		}
+
+		compressed, err := base64.StdEncoding.DecodeString(q.Get("SAMLRequest"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(compressed)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var req samlAuthnRequest
+		if err := xml.Unmarshal(data, &req); err != nil {
+			t.Fatal(err)
+		}
+		if req.ID != samlRequestID(samlTestSessionKey) {
+			t.Errorf("want ID=%q, got=%q", samlRequestID(samlTestSessionKey), req.ID)
+		}
+		if req.AssertionConsumerServiceURL != "http://dex.example.com/auth/saml/callback" {
+			t.Errorf("unexpected ACS URL %q", req.AssertionConsumerServiceURL)
+		}
+		if req.Issuer.Value != c.entityID {
+			t.Errorf("want Issuer=%q, got=%q", c.entityID, req.Issuer.Value)
+		}
+		if req.ForceAuthn != (prompt == "login") {
+			t.Errorf("prompt=%q: unexpected ForceAuthn=%t", prompt, req.ForceAuthn)
+		}
+	}
+}
+
+func TestSAMLHandleACS(t *testing.T) {
+	key, cert := newSAMLTestKey(t)
+	c := newSAMLTestConnector(t, cert)
+	r := newSAMLTestResponse(c)
+	resp := samlSign(t, key, r.response(r.assertion("_a1")), "_a1")
+
+	var loggedIn oidc.Identity
+	lf := func(ident oidc.Identity, groups []string, sessionKey string) (string, error) {
+		if sessionKey != samlTestSessionKey {
+			t.Errorf("want sessionKey=%q, got=%q", samlTestSessionKey, sessionKey)
+		}
+		loggedIn = ident
+		return "http://client.example.com/callback?code=xyz", nil
+	}
+	errorURL, _ := url.Parse("http://dex.example.com/login")
+	hdlr := c.handleACSFunc(lf, *errorURL)
+
+	tests := []struct {
+		form         url.Values
+		wantLocation string
+	}{
+		{
+			form: url.Values{
+				"SAMLResponse": {base64.StdEncoding.EncodeToString([]byte(resp))},
+				"RelayState":   {samlTestSessionKey},
+			},
+			wantLocation: "http://client.example.com/callback?code=xyz",
+		},
+		{
+			form: url.Values{
+				"SAMLResponse": {base64.StdEncoding.EncodeToString([]byte(strings.Replace(resp, ">jane<", ">john<", 1)))},
+				"RelayState":   {samlTestSessionKey},
+			},
+			wantLocation: "http://dex.example.com/login?error=invalid_request&error_description=unable+to+verify+SAML+response",
+		},
+		{
+			form: url.Values{
+				"RelayState": {samlTestSessionKey},
+			},
+			wantLocation: "http://dex.example.com/login?error=invalid_request&error_description=SAMLResponse+must+be+set",
+		},
+	}
+
+	for i, tt := range tests {
+		loggedIn = oidc.Identity{}
+		req, err := http.NewRequest("POST", "http://dex.example.com/auth/saml/callback", strings.NewReader(tt.form.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		hdlr(w, req)
+
+		if got := w.HeaderMap.Get("Location"); got != tt.wantLocation {
+			t.Errorf("case %d: want Location=%q, got=%q", i, tt.wantLocation, got)
+		}
+		if i == 0 && loggedIn.ID != "jane" {
+			t.Errorf("case %d: want identity jane to be logged in, got %#v", i, loggedIn)
+		}
+	}
+}
+
+func TestSAMLMetadata(t *testing.T) {
+	_, cert := newSAMLTestKey(t)
+	c := newSAMLTestConnector(t, cert)
+
+	req, err := http.NewRequest("GET", "http://dex.example.com/auth/saml/metadata", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	c.handleMetadataFunc()(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("want status=%d, got=%d", http.StatusOK, w.Code)
+	}
+	if ct := w.HeaderMap.Get("Content-Type"); ct != samlMetadataContentType {
+		t.Errorf("want Content-Type=%q, got=%q", samlMetadataContentType, ct)
+	}
+	var md struct {
+		EntityID string `xml:"entityID,attr"`
+		ACS      struct {
+			Binding  string `xml:",attr"`
+			Location string `xml:",attr"`
+		} `xml:"SPSSODescriptor>AssertionConsumerService"`
+	}
+	if err := xml.Unmarshal(w.Body.Bytes(), &md); err != nil {
+		t.Fatal(err)
+	}
+	if md.EntityID != "http://dex.example.com/auth/saml/metadata" {
+		t.Errorf("unexpected entityID %q", md.EntityID)
+	}
+	if md.ACS.Binding != samlBindingHTTPPost || md.ACS.Location != "http://dex.example.com/auth/saml/callback" {
+		t.Errorf("unexpected AssertionConsumerService %#v", md.ACS)
+	}
+}
+
+func TestParseSAMLIdPMetadata(t *testing.T) {
+	_, cert := newSAMLTestKey(t)
+	_, encCert := newSAMLTestKey(t)
+
+	data := `<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata" xmlns:ds="http://www.w3.org/2000/09/xmldsig#" entityID="https://idp.example.com">
+  <md:IDPSSODescriptor protocolSupportEnumeration="urn:oasis:names:tc:SAML:2.0:protocol">
+    <md:KeyDescriptor use="signing"><ds:KeyInfo><ds:X509Data><ds:X509Certificate>
+` + base64.StdEncoding.EncodeToString(cert.Raw) + `
+    </ds:X509Certificate></ds:X509Data></ds:KeyInfo></md:KeyDescriptor>
+    <md:KeyDescriptor use="encryption"><ds:KeyInfo><ds:X509Data><ds:X509Certificate>` + base64.StdEncoding.EncodeToString(encCert.Raw) + `</ds:X509Certificate></ds:X509Data></ds:KeyInfo></md:KeyDescriptor>
+    <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST" Location="https://idp.example.com/sso/post"/>
+    <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect" Location="https://idp.example.com/sso/redirect"/>
+  </md:IDPSSODescriptor>
+</md:EntityDescriptor>`
+
+	md, err := parseSAMLIdPMetadata([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.entityID != "https://idp.example.com" {
+		t.Errorf("unexpected entityID %q", md.entityID)
+	}
+	if md.ssoURL != "https://idp.example.com/sso/redirect" {
+		t.Errorf("unexpected SSO URL %q", md.ssoURL)
+	}
+	if len(md.certs) != 1 || !md.certs[0].Equal(cert) {
+		t.Errorf("want only the signing certificate, got %d certificates", len(md.certs))
+	}
+}
+
+func TestSAMLConnectorConfigMissingCerts(t *testing.T) {
+	cc := SAMLConnectorConfig{
+		ID:          "saml",
+		IdPEntityID: samlTestIdP,
+		IdPSSOURL:   "https://idp.example.com/sso",
+	}
+
+	if _, err := cc.Connector(ns, lf, templates); err == nil {
+		t.Fatal("Expected SAMLConnector initialization to fail when the IdP's certificates are not configured.")
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"net/http"
 	"net/url"
 
+	"github.com/coreos/dex/lockout"
+	"github.com/coreos/dex/mfa"
 	"github.com/coreos/dex/repo"
 	"github.com/coreos/go-oidc/oidc"
 	"github.com/coreos/pkg/health"
@@ -13,6 +15,12 @@ import (
 
 var ErrorNotFound = errors.New("connector not found in repository")
 
+// LoginFunc is called by connectors once they identified a user, along with
+// the names of the user's upstream groups if the connector knows them. It
+// associates the identity with the session of the given key, and returns the
+// URL to send the user-agent to next.
+type LoginFunc func(ident oidc.Identity, groups []string, sessionKey string) (redirectURL string, err error)
+
 type Connector interface {
 	// ID returns the ID of the ConnectorConfig used to create the Connector.
 	ID() string
@@ -40,6 +48,37 @@ type Connector interface {
 	health.Checkable
 }
 
+// AuthParamsConnector is implemented by connectors which can pass parameters
+// of the client's authentication request on to their upstream provider.
+type AuthParamsConnector interface {
+	Connector
+
+	// LoginURLWithParams is like LoginURL, but is also given the prompt,
+	// login_hint and acr_values parameters of the client's request, as far
+	// as they were set. Connectors pass on the ones they are configured to.
+	LoginURLWithParams(sessionKey, prompt string, params url.Values) (string, error)
+}
+
+// PasswordConnector is implemented by connectors which check the passwords of
+// users themselves, and so must guard against brute-force attacks.
+type PasswordConnector interface {
+	Connector
+
+	// SetLoginGuard sets the guard which limits failed logins. It must be
+	// called before Register.
+	SetLoginGuard(g *lockout.Guard)
+}
+
+// MFAConnector is implemented by connectors which can ask their users for a
+// second factor after the password.
+type MFAConnector interface {
+	Connector
+
+	// SetMFA sets the authenticator which checks second factors. It must be
+	// called before Register.
+	SetMFA(a *mfa.Authenticator)
+}
+
 //go:generate genconfig -o config.go connector Connector
 type ConnectorConfig interface {
 	// ConnectorID returns a unique end user facing identifier. For example "google".
@@ -53,11 +92,13 @@ type ConnectorConfig interface {
 	// loginFunc is used to associate remote identies with dex session keys.
 	//
 	// The returned Connector must call loginFunc once upon successful
-	// identification of a user.
+	// identification of a user. Connectors which know the groups users
+	// belong to upstream pass them along; the groups are synced to dex every
+	// time a user logs in.
 	//
 	// Additional templates are passed for connectors that require rendering HTML
 	// pages, such as the "local" connector.
-	Connector(ns url.URL, loginFunc oidc.LoginFunc, tpls *template.Template) (Connector, error)
+	Connector(ns url.URL, loginFunc LoginFunc, tpls *template.Template) (Connector, error)
 }
 
 type ConnectorConfigRepo interface {
@@ -67,5 +108,7 @@ type ConnectorConfigRepo interface {
 }
 
 type IdentityProvider interface {
-	Identity(email, password string) (*oidc.Identity, error)
+	// Identity checks the password of the user, and returns their identity
+	// and the names of their upstream groups, if the provider knows them.
+	Identity(email, password string) (*oidc.Identity, []string, error)
 }
@@ -5,7 +5,10 @@ import (
 	"html/template"
 	"net/http"
 	"net/url"
+	"strings"
 
+	"github.com/coreos/dex/lockout"
+	"github.com/coreos/dex/mfa"
 	phttp "github.com/coreos/dex/pkg/http"
 	"github.com/coreos/dex/pkg/log"
 	"github.com/coreos/go-oidc/oauth2"
@@ -18,12 +21,39 @@ func redirectPostError(w http.ResponseWriter, errorURL url.URL, q url.Values) {
 	w.WriteHeader(http.StatusSeeOther)
 }
 
-func handleLoginFunc(lf oidc.LoginFunc, tpl *template.Template, idp IdentityProvider, localErrorPath string, errorURL url.URL) http.HandlerFunc {
+// MFAPage is the data of the template asking for a second factor.
+type MFAPage struct {
+	PostURL    string
+	SessionKey string
+
+	// Challenge is the sealed mfa.Challenge of the login.
+	Challenge string
+
+	// Enroll is set when the user is enrolling, and Secret and KeyURI are
+	// the secret to add to their authenticator app.
+	Enroll bool
+	Secret string
+	KeyURI string
+
+	// RecoveryCodes are shown once after enrolling, with a link to
+	// ContinueURL to complete the login.
+	RecoveryCodes []string
+	ContinueURL   string
+
+	Error   bool
+	Message string
+}
+
+// handleLoginFunc handles logins with a username and password, checked by
+// the identity provider. If guard is non-nil, it limits failed logins. If
+// mfaAuth is non-nil, users who enrolled a second factor, or who need one,
+// are asked for a code before the login completes.
+func handleLoginFunc(lf LoginFunc, tpl *template.Template, idp IdentityProvider, guard *lockout.Guard, mfaAuth *mfa.Authenticator, mfaTpl *template.Template, connectorID, localErrorPath string, errorURL url.URL) http.HandlerFunc {
 	handleGET := func(w http.ResponseWriter, r *http.Request, errMsg string) {
 		q := r.URL.Query()
 		sessionKey := q.Get("session_key")
 
-		p := &Page{PostURL: r.URL.String(), Name: "Local", SessionKey: sessionKey}
+		p := &Page{PostURL: r.URL.String(), Name: "Local", SessionKey: sessionKey, MFA: mfaAuth != nil}
 		if errMsg != "" {
 			p.Error = true
 			p.Message = errMsg
@@ -34,6 +64,146 @@ func handleLoginFunc(lf oidc.LoginFunc, tpl *template.Template, idp IdentityProv
 		}
 	}
 
+	renderMFA := func(w http.ResponseWriter, r *http.Request, c *mfa.Challenge, errMsg string) {
+		if mfaTpl == nil {
+			log.Errorf("Unable to ask for a second factor: missing template")
+			handleGET(w, r, "login failed")
+			return
+		}
+		sealed, err := mfaAuth.Seal(c)
+		if err != nil {
+			log.Errorf("Unable to seal MFA challenge: %v", err)
+			handleGET(w, r, "login failed")
+			return
+		}
+
+		p := &MFAPage{PostURL: r.URL.String(), SessionKey: c.SessionKey, Challenge: sealed}
+		if c.Enrolling() {
+			p.Enroll = true
+			p.Secret = mfa.EncodeSecret(c.Secret)
+			p.KeyURI = mfaAuth.KeyURI(c)
+		}
+		if errMsg != "" {
+			p.Error = true
+			p.Message = errMsg
+		}
+
+		if err := mfaTpl.Execute(w, p); err != nil {
+			phttp.WriteError(w, http.StatusInternalServerError, err.Error())
+		}
+	}
+
+	// checkGuard returns the message to show if the login must not be
+	// attempted, or an empty string.
+	checkGuard := func(account, ip string) string {
+		if guard == nil {
+			return ""
+		}
+		switch err := guard.Check(connectorID, account, ip); err {
+		case nil:
+			return ""
+		case lockout.ErrorLocked:
+			return "too many failed login attempts, try again later"
+		case lockout.ErrorTooSoon:
+			return "please wait a moment before trying again"
+		default:
+			log.Errorf("Unable to check failed logins: %v", err)
+			return "login failed"
+		}
+	}
+
+	failed := func(account, ip string) {
+		if guard == nil {
+			return
+		}
+		if err := guard.Failed(connectorID, account, ip); err != nil {
+			log.Errorf("Unable to record failed login: %v", err)
+		}
+	}
+
+	// login completes the login of ident, and returns the URL to send the
+	// user-agent to.
+	login := func(w http.ResponseWriter, r *http.Request, ident oidc.Identity, groups []string, account, sessionKey string, amr []string) (string, bool) {
+		if guard != nil {
+			if err := guard.Succeeded(connectorID, account); err != nil {
+				log.Errorf("Unable to clear failed logins: %v", err)
+			}
+		}
+
+		q := r.URL.Query()
+		if mfaAuth != nil {
+			if err := mfaAuth.SetAuthMethods(sessionKey, amr); err != nil {
+				log.Errorf("Unable to record authentication methods of %#v: %v", ident, err)
+				q.Set("error", oauth2.ErrorAccessDenied)
+				q.Set("error_description", "login failed")
+				redirectPostError(w, errorURL, q)
+				return "", false
+			}
+		}
+
+		redirectURL, err := lf(ident, groups, sessionKey)
+		if err != nil {
+			log.Errorf("Unable to log in %#v: %v", ident, err)
+			q.Set("error", oauth2.ErrorAccessDenied)
+			q.Set("error_description", "login failed")
+			redirectPostError(w, errorURL, q)
+			return "", false
+		}
+		return redirectURL, true
+	}
+
+	handleMFAPOST := func(w http.ResponseWriter, r *http.Request, sealed string) {
+		if mfaAuth == nil {
+			phttp.WriteError(w, http.StatusBadRequest, "unexpected MFA challenge")
+			return
+		}
+		c, err := mfaAuth.Open(sealed)
+		if err != nil || c.SessionKey != r.FormValue("session_key") {
+			handleGET(w, r, "your login has expired, please log in again")
+			return
+		}
+
+		ip := phttp.RemoteIP(r)
+		if msg := checkGuard(c.Account, ip); msg != "" {
+			renderMFA(w, r, c, msg)
+			return
+		}
+
+		code := strings.TrimSpace(r.PostForm.Get("code"))
+		if code == "" {
+			renderMFA(w, r, c, "missing code")
+			return
+		}
+
+		recoveryCodes, err := mfaAuth.Verify(c, code)
+		if err == mfa.ErrorInvalidCode {
+			failed(c.Account, ip)
+			renderMFA(w, r, c, "invalid code")
+			return
+		}
+		if err != nil {
+			log.Errorf("Unable to verify MFA code: %v", err)
+			renderMFA(w, r, c, "login failed")
+			return
+		}
+
+		redirectURL, ok := login(w, r, c.Identity, c.Groups, c.Account, c.SessionKey, []string{mfa.AMRMFA, mfa.AMROTP, mfa.AMRPassword})
+		if !ok {
+			return
+		}
+
+		if len(recoveryCodes) != 0 {
+			p := &MFAPage{RecoveryCodes: recoveryCodes, ContinueURL: redirectURL}
+			if err := mfaTpl.Execute(w, p); err != nil {
+				phttp.WriteError(w, http.StatusInternalServerError, err.Error())
+			}
+			return
+		}
+
+		w.Header().Set("Location", redirectURL)
+		w.WriteHeader(http.StatusFound)
+	}
+
 	handlePOST := func(w http.ResponseWriter, r *http.Request) {
 		if err := r.ParseForm(); err != nil {
 			msg := fmt.Sprintf("unable to parse form from body: %v", err)
@@ -41,6 +211,11 @@ func handleLoginFunc(lf oidc.LoginFunc, tpl *template.Template, idp IdentityProv
 			return
 		}
 
+		if sealed := r.PostForm.Get("mfa_challenge"); sealed != "" {
+			handleMFAPOST(w, r, sealed)
+			return
+		}
+
 		userid := r.PostForm.Get("userid")
 		if userid == "" {
 			handleGET(w, r, "missing email address")
@@ -53,10 +228,17 @@ func handleLoginFunc(lf oidc.LoginFunc, tpl *template.Template, idp IdentityProv
 			return
 		}
 
-		ident, err := idp.Identity(userid, password)
+		ip := phttp.RemoteIP(r)
+		if msg := checkGuard(userid, ip); msg != "" {
+			handleGET(w, r, msg)
+			return
+		}
+
+		ident, groups, err := idp.Identity(userid, password)
 		log.Errorf("IDENTITY: err: %v", err)
 
 		if ident == nil || err != nil {
+			failed(userid, ip)
 			handleGET(w, r, "invalid login")
 			return
 		}
@@ -70,12 +252,37 @@ func handleLoginFunc(lf oidc.LoginFunc, tpl *template.Template, idp IdentityProv
 			return
 		}
 
-		redirectURL, err := lf(*ident, sessionKey)
-		if err != nil {
-			log.Errorf("Unable to log in %#v: %v", *ident, err)
-			q.Set("error", oauth2.ErrorAccessDenied)
-			q.Set("error_description", "login failed")
-			redirectPostError(w, errorURL, q)
+		if mfaAuth != nil {
+			// The failed logins of the account are only cleared once the
+			// second factor has been checked too, so that codes can't be
+			// guessed by logging in again and again.
+			enrolled, err := mfaAuth.Enrolled(ident.ID)
+			if err != nil {
+				log.Errorf("Unable to look up MFA enrollment: %v", err)
+				handleGET(w, r, "login failed")
+				return
+			}
+			required, err := mfaAuth.MFARequired(sessionKey)
+			if err != nil {
+				log.Errorf("Unable to determine whether MFA is required: %v", err)
+				handleGET(w, r, "login failed")
+				return
+			}
+			if enrolled || required || r.PostForm.Get("enroll_mfa") != "" {
+				c, err := mfaAuth.NewChallenge(*ident, userid, sessionKey, !enrolled)
+				if err != nil {
+					log.Errorf("Unable to create MFA challenge: %v", err)
+					handleGET(w, r, "login failed")
+					return
+				}
+				c.Groups = groups
+				renderMFA(w, r, c, "")
+				return
+			}
+		}
+
+		redirectURL, ok := login(w, r, *ident, groups, userid, sessionKey, []string{mfa.AMRPassword})
+		if !ok {
 			return
 		}
 
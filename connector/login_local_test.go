@@ -0,0 +1,175 @@
+package connector
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/kylelemons/godebug/pretty"
+
+	"github.com/coreos/dex/mfa"
+	"github.com/coreos/go-oidc/oidc"
+)
+
+type fakeIdentityProvider map[string]oidc.Identity
+
+func (p fakeIdentityProvider) Identity(email, password string) (*oidc.Identity, []string, error) {
+	ident, ok := p[email]
+	if !ok || password != "password" {
+		return nil, nil, nil
+	}
+	return &ident, []string{"staff"}, nil
+}
+
+type memEnrollmentRepo map[string]mfa.Enrollment
+
+func (r memEnrollmentRepo) Get(userID string) (*mfa.Enrollment, error) {
+	e, ok := r[userID]
+	if !ok {
+		return nil, mfa.ErrorNotFound
+	}
+	return &e, nil
+}
+
+func (r memEnrollmentRepo) Set(e mfa.Enrollment) error {
+	r[e.UserID] = e
+	return nil
+}
+
+func (r memEnrollmentRepo) Delete(userID string) error {
+	delete(r, userID)
+	return nil
+}
+
+type fakeMFAPolicy struct {
+	required bool
+	amr      []string
+}
+
+func (p *fakeMFAPolicy) MFARequired(sessionKey string) (bool, error) {
+	return p.required, nil
+}
+
+func (p *fakeMFAPolicy) SetAuthMethods(sessionKey string, amr []string) error {
+	p.amr = amr
+	return nil
+}
+
+func TestHandleLoginFuncMFA(t *testing.T) {
+	idp := fakeIdentityProvider{
+		"elroy@example.com": oidc.Identity{ID: "elroy-id", Email: "elroy@example.com"},
+	}
+	loginTpl := template.Must(template.New("login").Parse(`login:{{ .Message }}`))
+	mfaTpl := template.Must(template.New("mfa").Parse(
+		`mfa|{{ .Challenge }}|{{ .Message }}|{{ range .RecoveryCodes }}{{ . }} {{ end }}|{{ .ContinueURL }}`))
+
+	var loggedIn []string
+	lf := func(ident oidc.Identity, groups []string, sessionKey string) (string, error) {
+		loggedIn = append(loggedIn, ident.ID+" "+strings.Join(groups, ","))
+		return "https://client.example.com/callback?code=" + sessionKey, nil
+	}
+
+	clock := clockwork.NewFakeClock()
+	repo := memEnrollmentRepo{}
+	policy := &fakeMFAPolicy{}
+	auth := &mfa.Authenticator{
+		Repo:    repo,
+		Policy:  policy,
+		Clock:   clock,
+		Secrets: [][]byte{make([]byte, 32)},
+	}
+	errorURL := url.URL{Scheme: "https", Host: "dex.example.com", Path: "/error"}
+	h := handleLoginFunc(lf, loginTpl, idp, nil, auth, mfaTpl, "local", "/auth/local/login", errorURL)
+
+	post := func(form url.Values) *httptest.ResponseRecorder {
+		form.Set("session_key", "session-key")
+		r, err := http.NewRequest("POST", "/auth/local/login", strings.NewReader(form.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		h(w, r)
+		return w
+	}
+	// challenge returns the sealed challenge of an MFA page.
+	challenge := func(w *httptest.ResponseRecorder) string {
+		parts := strings.Split(w.Body.String(), "|")
+		if parts[0] != "mfa" {
+			t.Fatalf("want the MFA page, got %q", w.Body.String())
+		}
+		return parts[1]
+	}
+	password := url.Values{"userid": {"elroy@example.com"}, "password": {"password"}}
+
+	// Users who haven't enrolled log in with their password alone.
+	w := post(password)
+	if w.Code != http.StatusFound {
+		t.Fatalf("want status=%d, got=%d: %s", http.StatusFound, w.Code, w.Body.String())
+	}
+	if diff := pretty.Compare([]string{mfa.AMRPassword}, policy.amr); diff != "" {
+		t.Errorf("Compare(want, got) = %v", diff)
+	}
+
+	// Unless they choose to enroll.
+	enroll := url.Values{"userid": {"elroy@example.com"}, "password": {"password"}, "enroll_mfa": {"1"}}
+	sealed := challenge(post(enroll))
+	c, err := auth.Open(sealed)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	w = post(url.Values{"mfa_challenge": {sealed}, "code": {mfa.Code(c.Secret, clock.Now())}})
+	parts := strings.Split(w.Body.String(), "|")
+	if parts[0] != "mfa" || len(strings.Fields(parts[3])) != 10 {
+		t.Fatalf("want recovery codes, got %q", w.Body.String())
+	}
+	if want := "https://client.example.com/callback?code=session-key"; parts[4] != want {
+		t.Errorf("want continue URL=%q, got=%q", want, parts[4])
+	}
+	if diff := pretty.Compare([]string{mfa.AMRMFA, mfa.AMROTP, mfa.AMRPassword}, policy.amr); diff != "" {
+		t.Errorf("Compare(want, got) = %v", diff)
+	}
+	if len(repo) != 1 {
+		t.Fatalf("want the user enrolled")
+	}
+
+	// Enrolled users must enter a code.
+	clock.Advance(30 * time.Second)
+	loggedIn = nil
+	sealed = challenge(post(password))
+	if len(loggedIn) != 0 {
+		t.Fatalf("want no login before the code, got %v", loggedIn)
+	}
+	w = post(url.Values{"mfa_challenge": {sealed}, "code": {"000000"}})
+	if !strings.Contains(w.Body.String(), "|invalid code|") {
+		t.Errorf("want invalid code, got %q", w.Body.String())
+	}
+	w = post(url.Values{"mfa_challenge": {"bogus"}, "code": {"000000"}})
+	if !strings.HasPrefix(w.Body.String(), "login:") {
+		t.Errorf("want the login page for a bogus challenge, got %q", w.Body.String())
+	}
+	w = post(url.Values{"mfa_challenge": {sealed}, "code": {mfa.Code(repo["elroy-id"].Secret, clock.Now())}})
+	if w.Code != http.StatusFound {
+		t.Fatalf("want status=%d, got=%d: %s", http.StatusFound, w.Code, w.Body.String())
+	}
+	// The groups of the user are passed on once the code is checked.
+	if diff := pretty.Compare([]string{"elroy-id staff"}, loggedIn); diff != "" {
+		t.Errorf("Compare(want, got) = %v", diff)
+	}
+
+	// Users of clients which require a second factor must enroll.
+	delete(repo, "elroy-id")
+	policy.required = true
+	c, err = auth.Open(challenge(post(password)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !c.Enrolling() {
+		t.Errorf("want an enrolling challenge")
+	}
+}
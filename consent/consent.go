@@ -0,0 +1,64 @@
+// Package consent records the scopes users granted to clients, so that users
+// are only asked for their consent when a client requests scopes it wasn't
+// granted before.
+package consent
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrorNotFound = errors.New("consent grant not found")
+
+// Grant is the set of scopes a user consented to a client requesting.
+type Grant struct {
+	UserID   string
+	ClientID string
+	Scope    []string
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Missing returns the scopes which haven't been granted, in the order they
+// were requested.
+func (g *Grant) Missing(scope []string) []string {
+	var missing []string
+	for _, s := range scope {
+		if !contains(g.Scope, s) {
+			missing = append(missing, s)
+		}
+	}
+	return missing
+}
+
+// Add grants the given scopes in addition to those granted before.
+func (g *Grant) Add(scope []string) {
+	for _, s := range scope {
+		if !contains(g.Scope, s) {
+			g.Scope = append(g.Scope, s)
+		}
+	}
+}
+
+func contains(scope []string, s string) bool {
+	for _, t := range scope {
+		if t == s {
+			return true
+		}
+	}
+	return false
+}
+
+type GrantRepo interface {
+	// Get returns the grant of a user to a client, or ErrorNotFound.
+	Get(userID, clientID string) (*Grant, error)
+
+	// Set stores a grant, replacing the one the user gave the client
+	// before, if any.
+	Set(Grant) error
+
+	// Delete removes the grant of a user to a client, so that the user is
+	// asked for consent again.
+	Delete(userID, clientID string) error
+}
@@ -0,0 +1,49 @@
+package consent
+
+import (
+	"testing"
+
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestGrantMissing(t *testing.T) {
+	g := Grant{Scope: []string{"openid", "email"}}
+
+	tests := []struct {
+		scope []string
+		want  []string
+	}{
+		{
+			scope: []string{"openid"},
+			want:  nil,
+		},
+		{
+			scope: []string{"email", "openid"},
+			want:  nil,
+		},
+		{
+			scope: []string{"openid", "groups", "email", "offline_access"},
+			want:  []string{"groups", "offline_access"},
+		},
+	}
+
+	for i, tt := range tests {
+		if diff := pretty.Compare(tt.want, g.Missing(tt.scope)); diff != "" {
+			t.Errorf("case %d: Compare(want, got) = %v", i, diff)
+		}
+	}
+}
+
+func TestGrantAdd(t *testing.T) {
+	g := Grant{}
+	g.Add([]string{"openid", "email"})
+	g.Add([]string{"email", "groups"})
+
+	want := []string{"openid", "email", "groups"}
+	if diff := pretty.Compare(want, g.Scope); diff != "" {
+		t.Errorf("Compare(want, got) = %v", diff)
+	}
+	if missing := g.Missing(want); len(missing) != 0 {
+		t.Errorf("want no missing scopes, got %v", missing)
+	}
+}
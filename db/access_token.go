@@ -0,0 +1,182 @@
+package db
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/go-gorp/gorp"
+	"github.com/jonboulle/clockwork"
+
+	"github.com/coreos/dex/access"
+	"github.com/coreos/dex/pkg/log"
+)
+
+const (
+	accessTokenTableName = "access_token"
+)
+
+func init() {
+	register(table{
+		name:    accessTokenTableName,
+		model:   accessTokenModel{},
+		autoinc: false,
+		pkey:    []string{"id"},
+	})
+}
+
+type accessTokenModel struct {
+	// ID is the hex encoded SHA-256 hash of the token. Access tokens carry
+	// enough entropy that a slow hash, as used for refresh tokens, isn't
+	// needed; a fast one keeps token lookups cheap.
+	ID        string `db:"id"`
+	UserID    string `db:"user_id"`
+	ClientID  string `db:"client_id"`
+	Scope     string `db:"scope"`
+	Audience  string `db:"audience"`
+	CreatedAt int64  `db:"created_at"`
+	ExpiresAt int64  `db:"expires_at"`
+	Claims    string `db:"claims"`
+}
+
+func (m *accessTokenModel) accessToken() *access.AccessToken {
+	return &access.AccessToken{
+		UserID:    m.UserID,
+		ClientID:  m.ClientID,
+		Scope:     strings.Fields(m.Scope),
+		Audience:  m.Audience,
+		CreatedAt: time.Unix(m.CreatedAt, 0).UTC(),
+		ExpiresAt: time.Unix(m.ExpiresAt, 0).UTC(),
+		Claims:    strings.Fields(m.Claims),
+	}
+}
+
+func hashAccessToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+type accessTokenRepo struct {
+	*db
+	tokenGenerator access.AccessTokenGenerator
+	clock          clockwork.Clock
+}
+
+func NewAccessTokenRepo(dbm *gorp.DbMap) access.AccessTokenRepo {
+	return NewAccessTokenRepoWithGenerator(dbm, access.DefaultAccessTokenGenerator)
+}
+
+func NewAccessTokenRepoWithGenerator(dbm *gorp.DbMap, gen access.AccessTokenGenerator) access.AccessTokenRepo {
+	return newAccessTokenRepo(dbm, gen, clockwork.NewRealClock())
+}
+
+func newAccessTokenRepo(dbm *gorp.DbMap, gen access.AccessTokenGenerator, clock clockwork.Clock) *accessTokenRepo {
+	return &accessTokenRepo{
+		db:             &db{dbm},
+		tokenGenerator: gen,
+		clock:          clock,
+	}
+}
+
+func (r *accessTokenRepo) Create(at access.AccessToken) (string, error) {
+	if at.UserID == "" {
+		return "", access.ErrorInvalidUserID
+	}
+	if at.ClientID == "" {
+		return "", access.ErrorInvalidClientID
+	}
+
+	token, err := r.tokenGenerator.Generate()
+	if err != nil {
+		return "", err
+	}
+
+	record := &accessTokenModel{
+		ID:        hashAccessToken(token),
+		UserID:    at.UserID,
+		ClientID:  at.ClientID,
+		Scope:     strings.Join(at.Scope, " "),
+		Audience:  at.Audience,
+		CreatedAt: at.CreatedAt.Unix(),
+		ExpiresAt: at.ExpiresAt.Unix(),
+		Claims:    strings.Join(at.Claims, " "),
+	}
+
+	if err := r.executor(nil).Insert(record); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func (r *accessTokenRepo) Get(token string) (*access.AccessToken, error) {
+	if token == "" {
+		return nil, access.ErrorInvalidToken
+	}
+
+	m, err := r.executor(nil).Get(accessTokenModel{}, hashAccessToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, access.ErrorInvalidToken
+	}
+
+	record, ok := m.(*accessTokenModel)
+	if !ok {
+		log.Errorf("expected accessTokenModel but found %v", reflect.TypeOf(m))
+		return nil, errors.New("unrecognized model")
+	}
+
+	at := record.accessToken()
+	if !at.ExpiresAt.After(r.clock.Now()) {
+		return nil, access.ErrorInvalidToken
+	}
+	return at, nil
+}
+
+func (r *accessTokenRepo) Revoke(token string) error {
+	if token == "" {
+		return access.ErrorInvalidToken
+	}
+
+	qt := r.quote(accessTokenTableName)
+	q := fmt.Sprintf("DELETE FROM %s WHERE id = $1", qt)
+	res, err := r.executor(nil).Exec(q, hashAccessToken(token))
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return access.ErrorInvalidToken
+	}
+	return nil
+}
+
+func (r *accessTokenRepo) purge() error {
+	qt := r.quote(accessTokenTableName)
+	q := fmt.Sprintf("DELETE FROM %s WHERE expires_at < $1", qt)
+	res, err := r.executor(nil).Exec(q, r.clock.Now().Unix())
+	if err != nil {
+		return err
+	}
+
+	d := "unknown # of"
+	if n, err := res.RowsAffected(); err == nil {
+		gcPurgedRows.WithLabelValues(accessTokenTableName).Add(float64(n))
+		if n == 0 {
+			return nil
+		}
+		d = fmt.Sprintf("%d", n)
+	}
+
+	log.Infof("Deleted %s stale row(s) from %s table", d, accessTokenTableName)
+	return nil
+}
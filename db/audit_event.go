@@ -0,0 +1,194 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-gorp/gorp"
+	"github.com/jonboulle/clockwork"
+
+	"github.com/coreos/dex/audit"
+	"github.com/coreos/dex/pkg/log"
+)
+
+const (
+	auditEventTableName = "audit_event"
+
+	// DefaultAuditEventRetention is how long audit events are kept, unless
+	// configured otherwise.
+	DefaultAuditEventRetention = 90 * 24 * time.Hour
+)
+
+func init() {
+	register(table{
+		name:    auditEventTableName,
+		model:   auditEventModel{},
+		autoinc: false,
+		pkey:    []string{"id"},
+	})
+}
+
+type auditEventModel struct {
+	ID          string `db:"id"`
+	Type        string `db:"type"`
+	CreatedAt   int64  `db:"created_at"`
+	UserID      string `db:"user_id"`
+	ClientID    string `db:"client_id"`
+	ConnectorID string `db:"connector_id"`
+	IP          string `db:"ip"`
+	Details     string `db:"details"`
+}
+
+func newAuditEventModel(e audit.Event) (*auditEventModel, error) {
+	m := &auditEventModel{
+		ID:          e.ID,
+		Type:        e.Type,
+		CreatedAt:   e.Time.Unix(),
+		UserID:      e.UserID,
+		ClientID:    e.ClientID,
+		ConnectorID: e.ConnectorID,
+		IP:          e.IP,
+	}
+	if len(e.Details) != 0 {
+		b, err := json.Marshal(e.Details)
+		if err != nil {
+			return nil, err
+		}
+		m.Details = string(b)
+	}
+	return m, nil
+}
+
+func (m *auditEventModel) event() (audit.Event, error) {
+	e := audit.Event{
+		ID:          m.ID,
+		Type:        m.Type,
+		Time:        time.Unix(m.CreatedAt, 0).UTC(),
+		UserID:      m.UserID,
+		ClientID:    m.ClientID,
+		ConnectorID: m.ConnectorID,
+		IP:          m.IP,
+	}
+	if m.Details != "" {
+		if err := json.Unmarshal([]byte(m.Details), &e.Details); err != nil {
+			return audit.Event{}, err
+		}
+	}
+	return e, nil
+}
+
+type auditEventRepo struct {
+	*db
+	retention time.Duration
+	clock     clockwork.Clock
+}
+
+func NewAuditEventRepo(dbm *gorp.DbMap) audit.EventRepo {
+	return newAuditEventRepo(dbm, DefaultAuditEventRetention, clockwork.NewRealClock())
+}
+
+func newAuditEventRepo(dbm *gorp.DbMap, retention time.Duration, clock clockwork.Clock) *auditEventRepo {
+	return &auditEventRepo{
+		db:        &db{dbm},
+		retention: retention,
+		clock:     clock,
+	}
+}
+
+func (r *auditEventRepo) Write(e audit.Event) error {
+	m, err := newAuditEventModel(e)
+	if err != nil {
+		return err
+	}
+	return r.executor(nil).Insert(m)
+}
+
+func (r *auditEventRepo) List(filter audit.EventFilter, maxResults int, nextPageToken string) ([]audit.Event, string, error) {
+	var offset int
+	if nextPageToken != "" {
+		var err error
+		filter, maxResults, offset, err = audit.DecodeNextPageToken(nextPageToken)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	var conds []string
+	var args []interface{}
+	for _, c := range []struct {
+		column string
+		value  string
+	}{
+		{"type", filter.Type},
+		{"user_id", filter.UserID},
+		{"client_id", filter.ClientID},
+	} {
+		if c.value == "" {
+			continue
+		}
+		args = append(args, c.value)
+		conds = append(conds, fmt.Sprintf("%s = $%d", c.column, len(args)))
+	}
+	var where string
+	if len(conds) != 0 {
+		where = "WHERE " + strings.Join(conds, " AND ")
+	}
+
+	// Ask for one more than needed so we know if there's more results, and
+	// hence, whether a nextPageToken is necessary.
+	args = append(args, maxResults+1, offset)
+	q := fmt.Sprintf("SELECT * FROM %s %s ORDER BY created_at DESC, id LIMIT $%d OFFSET $%d",
+		r.quote(auditEventTableName), where, len(args)-1, len(args))
+	var ms []auditEventModel
+	if _, err := r.executor(nil).Select(&ms, q, args...); err != nil {
+		return nil, "", err
+	}
+
+	var more bool
+	if len(ms) > maxResults {
+		ms = ms[:maxResults]
+		more = true
+	}
+
+	events := make([]audit.Event, len(ms))
+	for i := range ms {
+		e, err := ms[i].event()
+		if err != nil {
+			return nil, "", err
+		}
+		events[i] = e
+	}
+
+	var tok string
+	if more {
+		var err error
+		tok, err = audit.EncodeNextPageToken(filter, maxResults, offset+maxResults)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	return events, tok, nil
+}
+
+func (r *auditEventRepo) purge() error {
+	qt := r.quote(auditEventTableName)
+	q := fmt.Sprintf("DELETE FROM %s WHERE created_at < $1", qt)
+	res, err := r.executor(nil).Exec(q, r.clock.Now().Add(-r.retention).Unix())
+	if err != nil {
+		return err
+	}
+
+	d := "unknown # of"
+	if n, err := res.RowsAffected(); err == nil {
+		gcPurgedRows.WithLabelValues(auditEventTableName).Add(float64(n))
+		if n == 0 {
+			return nil
+		}
+		d = fmt.Sprintf("%d", n)
+	}
+
+	log.Infof("Deleted %s stale row(s) from %s table", d, auditEventTableName)
+	return nil
+}
@@ -0,0 +1,156 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-gorp/gorp"
+	"github.com/jonboulle/clockwork"
+
+	"github.com/coreos/dex/pkg/log"
+	"github.com/coreos/dex/session"
+	"github.com/coreos/go-oidc/oidc"
+)
+
+const (
+	browserSessionTableName = "browser_session"
+)
+
+func init() {
+	register(table{
+		name:    browserSessionTableName,
+		model:   browserSessionModel{},
+		autoinc: false,
+		pkey:    []string{"id"},
+	})
+}
+
+type browserSessionModel struct {
+	ID          string `db:"id"`
+	ConnectorID string `db:"connector_id"`
+	Identity    string `db:"identity"`
+	UserID      string `db:"user_id"`
+	AuthTime    int64  `db:"auth_time"`
+	ExpiresAt   int64  `db:"expires_at"`
+	AMR         string `db:"amr"`
+}
+
+func newBrowserSessionModel(s *session.BrowserSession) (*browserSessionModel, error) {
+	b, err := json.Marshal(s.Identity)
+	if err != nil {
+		return nil, err
+	}
+
+	return &browserSessionModel{
+		ID:          s.ID,
+		ConnectorID: s.ConnectorID,
+		Identity:    string(b),
+		UserID:      s.UserID,
+		AuthTime:    s.AuthTime.Unix(),
+		ExpiresAt:   s.ExpiresAt.Unix(),
+		AMR:         strings.Join(s.AMR, " "),
+	}, nil
+}
+
+func (m *browserSessionModel) browserSession() (*session.BrowserSession, error) {
+	var ident oidc.Identity
+	if err := json.Unmarshal([]byte(m.Identity), &ident); err != nil {
+		return nil, err
+	}
+	if ident.ExpiresAt.IsZero() {
+		ident.ExpiresAt = time.Time{}
+	}
+
+	return &session.BrowserSession{
+		ID:          m.ID,
+		ConnectorID: m.ConnectorID,
+		Identity:    ident,
+		UserID:      m.UserID,
+		AuthTime:    time.Unix(m.AuthTime, 0).UTC(),
+		ExpiresAt:   time.Unix(m.ExpiresAt, 0).UTC(),
+		AMR:         strings.Fields(m.AMR),
+	}, nil
+}
+
+func NewBrowserSessionRepo(dbm *gorp.DbMap) session.BrowserSessionRepo {
+	return newBrowserSessionRepo(dbm, clockwork.NewRealClock())
+}
+
+func NewBrowserSessionRepoWithClock(dbm *gorp.DbMap, clock clockwork.Clock) session.BrowserSessionRepo {
+	return newBrowserSessionRepo(dbm, clock)
+}
+
+func newBrowserSessionRepo(dbm *gorp.DbMap, clock clockwork.Clock) *browserSessionRepo {
+	return &browserSessionRepo{db: &db{dbm}, clock: clock}
+}
+
+type browserSessionRepo struct {
+	*db
+	clock clockwork.Clock
+}
+
+func (r *browserSessionRepo) Get(id string) (*session.BrowserSession, error) {
+	m, err := r.executor(nil).Get(browserSessionModel{}, id)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, session.ErrorBrowserSessionNotFound
+	}
+
+	bsm, ok := m.(*browserSessionModel)
+	if !ok {
+		return nil, fmt.Errorf("expected browserSessionModel but found %T", m)
+	}
+
+	bs, err := bsm.browserSession()
+	if err != nil {
+		return nil, err
+	}
+	if !bs.ExpiresAt.After(r.clock.Now()) {
+		return nil, session.ErrorBrowserSessionNotFound
+	}
+	return bs, nil
+}
+
+func (r *browserSessionRepo) Create(s session.BrowserSession) error {
+	m, err := newBrowserSessionModel(&s)
+	if err != nil {
+		return err
+	}
+	return r.executor(nil).Insert(m)
+}
+
+func (r *browserSessionRepo) Delete(id string) error {
+	n, err := r.executor(nil).Delete(&browserSessionModel{ID: id})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return session.ErrorBrowserSessionNotFound
+	}
+	return nil
+}
+
+func (r *browserSessionRepo) purge() error {
+	qt := r.quote(browserSessionTableName)
+	q := fmt.Sprintf("DELETE FROM %s WHERE expires_at < $1", qt)
+	res, err := r.executor(nil).Exec(q, r.clock.Now().Unix())
+	if err != nil {
+		return err
+	}
+
+	d := "unknown # of"
+	if n, err := res.RowsAffected(); err == nil {
+		gcPurgedRows.WithLabelValues(browserSessionTableName).Add(float64(n))
+		if n == 0 {
+			return nil
+		}
+		d = fmt.Sprintf("%d", n)
+	}
+
+	log.Infof("Deleted %s stale row(s) from %s table", d, browserSessionTableName)
+	return nil
+}
@@ -5,7 +5,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
 	"reflect"
+	"strings"
+	"time"
 
 	"github.com/coreos/go-oidc/oidc"
 	"github.com/go-gorp/gorp"
@@ -42,20 +45,82 @@ func newClientModel(cli client.Client) (*clientModel, error) {
 	}
 
 	cim := clientModel{
-		ID:       cli.Credentials.ID,
-		Secret:   hashed,
-		Metadata: string(bmeta),
-		DexAdmin: cli.Admin,
+		ID:         cli.Credentials.ID,
+		Secret:     hashed,
+		Metadata:   string(bmeta),
+		DexAdmin:   cli.Admin,
+		Public:     cli.Public,
+		RequireMFA: cli.RequireMFA,
+		FirstParty: cli.FirstParty,
 	}
+	cim.setLogoutMetadata(cli)
 
 	return &cim, nil
 }
 
 type clientModel struct {
-	ID       string `db:"id"`
-	Secret   []byte `db:"secret"`
-	Metadata string `db:"metadata"`
-	DexAdmin bool   `db:"dex_admin"`
+	ID         string `db:"id"`
+	Secret     []byte `db:"secret"`
+	Metadata   string `db:"metadata"`
+	DexAdmin   bool   `db:"dex_admin"`
+	Public     bool   `db:"public"`
+	RequireMFA bool   `db:"require_mfa"`
+	FirstParty bool   `db:"first_party"`
+
+	// PreviousSecret is the hash of the secret replaced by the last
+	// rotation, which stays valid until PreviousSecretExpiresAt.
+	PreviousSecret          []byte `db:"previous_secret"`
+	PreviousSecretExpiresAt int64  `db:"previous_secret_expires_at"`
+
+	// RegistrationToken is the hash of the registration access token of a
+	// dynamically registered client.
+	RegistrationToken []byte `db:"registration_token"`
+
+	// PostLogoutRedirectURIs are space separated.
+	PostLogoutRedirectURIs string `db:"post_logout_redirect_uris"`
+	FrontChannelLogoutURI  string `db:"frontchannel_logout_uri"`
+	BackChannelLogoutURI   string `db:"backchannel_logout_uri"`
+}
+
+func (m *clientModel) setLogoutMetadata(cli client.Client) {
+	uris := make([]string, len(cli.PostLogoutRedirectURIs))
+	for i, u := range cli.PostLogoutRedirectURIs {
+		uris[i] = u.String()
+	}
+	m.PostLogoutRedirectURIs = strings.Join(uris, " ")
+	m.FrontChannelLogoutURI = ""
+	if cli.FrontChannelLogoutURI != nil {
+		m.FrontChannelLogoutURI = cli.FrontChannelLogoutURI.String()
+	}
+	m.BackChannelLogoutURI = ""
+	if cli.BackChannelLogoutURI != nil {
+		m.BackChannelLogoutURI = cli.BackChannelLogoutURI.String()
+	}
+}
+
+func (m *clientModel) logoutMetadata(cli *client.Client) error {
+	for _, s := range strings.Fields(m.PostLogoutRedirectURIs) {
+		u, err := url.Parse(s)
+		if err != nil {
+			return err
+		}
+		cli.PostLogoutRedirectURIs = append(cli.PostLogoutRedirectURIs, *u)
+	}
+	if m.FrontChannelLogoutURI != "" {
+		u, err := url.Parse(m.FrontChannelLogoutURI)
+		if err != nil {
+			return err
+		}
+		cli.FrontChannelLogoutURI = u
+	}
+	if m.BackChannelLogoutURI != "" {
+		u, err := url.Parse(m.BackChannelLogoutURI)
+		if err != nil {
+			return err
+		}
+		cli.BackChannelLogoutURI = u
+	}
+	return nil
 }
 
 func (m *clientModel) Client() (*client.Client, error) {
@@ -63,12 +128,18 @@ func (m *clientModel) Client() (*client.Client, error) {
 		Credentials: oidc.ClientCredentials{
 			ID: m.ID,
 		},
-		Admin: m.DexAdmin,
+		Admin:      m.DexAdmin,
+		Public:     m.Public,
+		RequireMFA: m.RequireMFA,
+		FirstParty: m.FirstParty,
 	}
 
 	if err := json.Unmarshal([]byte(m.Metadata), &ci.Metadata); err != nil {
 		return nil, err
 	}
+	if err := m.logoutMetadata(&ci); err != nil {
+		return nil, err
+	}
 
 	return &ci, nil
 }
@@ -134,6 +205,86 @@ func (r *clientRepo) Update(tx repo.Transaction, cli client.Client) error {
 	return nil
 }
 
+func (r *clientRepo) Delete(tx repo.Transaction, clientID string) error {
+	ex := r.executor(tx)
+
+	// Revoke the tokens issued to the client in the same transaction, so that
+	// they can't outlive it.
+	for _, table := range []string{accessTokenTableName, refreshTokenTableName} {
+		q := fmt.Sprintf("DELETE FROM %s WHERE client_id = $1", r.quote(table))
+		if _, err := ex.Exec(q, clientID); err != nil {
+			return err
+		}
+	}
+
+	deleted, err := ex.Delete(&clientModel{ID: clientID})
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return client.ErrorNotFound
+	}
+	return nil
+}
+
+func (r *clientRepo) SetSecret(tx repo.Transaction, clientID, secret string, previousExpiresAt time.Time) error {
+	cm, err := r.getModel(tx, clientID)
+	if err != nil {
+		return err
+	}
+	hashed, err := client.HashSecret(oidc.ClientCredentials{ID: clientID, Secret: secret})
+	if err != nil {
+		return err
+	}
+
+	if previousExpiresAt.IsZero() {
+		cm.PreviousSecret = nil
+		cm.PreviousSecretExpiresAt = 0
+	} else {
+		cm.PreviousSecret = cm.Secret
+		cm.PreviousSecretExpiresAt = previousExpiresAt.Unix()
+	}
+	cm.Secret = hashed
+
+	_, err = r.executor(tx).Update(cm)
+	return err
+}
+
+func (r *clientRepo) GetPreviousSecret(tx repo.Transaction, clientID string) ([]byte, time.Time, error) {
+	cm, err := r.getModel(tx, clientID)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if cm.PreviousSecret == nil {
+		return nil, time.Time{}, nil
+	}
+	return cm.PreviousSecret, time.Unix(cm.PreviousSecretExpiresAt, 0).UTC(), nil
+}
+
+func (r *clientRepo) SetRegistrationToken(tx repo.Transaction, clientID, token string) error {
+	cm, err := r.getModel(tx, clientID)
+	if err != nil {
+		return err
+	}
+
+	if token == "" {
+		cm.RegistrationToken = nil
+	} else {
+		cm.RegistrationToken = client.HashRegistrationToken(token)
+	}
+
+	_, err = r.executor(tx).Update(cm)
+	return err
+}
+
+func (r *clientRepo) GetRegistrationToken(tx repo.Transaction, clientID string) ([]byte, error) {
+	cm, err := r.getModel(tx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	return cm.RegistrationToken, nil
+}
+
 var alreadyExistsCheckers []func(err error) bool
 
 func registerAlreadyExistsChecker(f func(err error) bool) {
@@ -233,12 +384,24 @@ func (r *clientRepo) getModel(tx repo.Transaction, clientID string) (*clientMode
 	return cm, nil
 }
 
+// update stores the metadata and settings of cli, leaving the secrets of the
+// stored client as they are.
 func (r *clientRepo) update(tx repo.Transaction, cli client.Client) error {
-	ex := r.executor(tx)
-	cm, err := newClientModel(cli)
+	cm, err := r.getModel(tx, cli.Credentials.ID)
+	if err != nil {
+		return err
+	}
+	bmeta, err := json.Marshal(&cli.Metadata)
 	if err != nil {
 		return err
 	}
-	_, err = ex.Update(cm)
+	cm.Metadata = string(bmeta)
+	cm.DexAdmin = cli.Admin
+	cm.Public = cli.Public
+	cm.RequireMFA = cli.RequireMFA
+	cm.FirstParty = cli.FirstParty
+	cm.setLogoutMetadata(cli)
+
+	_, err = r.executor(tx).Update(cm)
 	return err
 }
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-gorp/gorp"
+
+	"github.com/coreos/dex/consent"
+)
+
+const (
+	consentGrantTableName = "consent_grant"
+)
+
+func init() {
+	register(table{
+		name:    consentGrantTableName,
+		model:   consentGrantModel{},
+		autoinc: false,
+		pkey:    []string{"user_id", "client_id"},
+	})
+}
+
+type consentGrantModel struct {
+	UserID    string `db:"user_id"`
+	ClientID  string `db:"client_id"`
+	Scope     string `db:"scope"`
+	CreatedAt int64  `db:"created_at"`
+	UpdatedAt int64  `db:"updated_at"`
+}
+
+func newConsentGrantModel(g *consent.Grant) *consentGrantModel {
+	return &consentGrantModel{
+		UserID:    g.UserID,
+		ClientID:  g.ClientID,
+		Scope:     strings.Join(g.Scope, " "),
+		CreatedAt: g.CreatedAt.Unix(),
+		UpdatedAt: g.UpdatedAt.Unix(),
+	}
+}
+
+func (m *consentGrantModel) grant() *consent.Grant {
+	return &consent.Grant{
+		UserID:    m.UserID,
+		ClientID:  m.ClientID,
+		Scope:     strings.Fields(m.Scope),
+		CreatedAt: time.Unix(m.CreatedAt, 0).UTC(),
+		UpdatedAt: time.Unix(m.UpdatedAt, 0).UTC(),
+	}
+}
+
+func NewConsentGrantRepo(dbm *gorp.DbMap) consent.GrantRepo {
+	return &consentGrantRepo{db: &db{dbm}}
+}
+
+type consentGrantRepo struct {
+	*db
+}
+
+func (r *consentGrantRepo) Get(userID, clientID string) (*consent.Grant, error) {
+	m, err := r.executor(nil).Get(consentGrantModel{}, userID, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, consent.ErrorNotFound
+	}
+
+	gm, ok := m.(*consentGrantModel)
+	if !ok {
+		return nil, fmt.Errorf("expected consentGrantModel but found %T", m)
+	}
+	return gm.grant(), nil
+}
+
+func (r *consentGrantRepo) Set(g consent.Grant) error {
+	if g.UserID == "" || g.ClientID == "" {
+		return errors.New("consent grants must have a user ID and client ID")
+	}
+	m := newConsentGrantModel(&g)
+
+	tx, err := r.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ex := r.executor(tx)
+	existing, err := ex.Get(consentGrantModel{}, g.UserID, g.ClientID)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		err = ex.Insert(m)
+	} else {
+		_, err = ex.Update(m)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *consentGrantRepo) Delete(userID, clientID string) error {
+	n, err := r.executor(nil).Delete(&consentGrantModel{UserID: userID, ClientID: clientID})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return consent.ErrorNotFound
+	}
+	return nil
+}
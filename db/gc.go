@@ -6,8 +6,11 @@ import (
 	"github.com/go-gorp/gorp"
 	"github.com/jonboulle/clockwork"
 
+	"github.com/coreos/dex/access"
+	"github.com/coreos/dex/client"
 	"github.com/coreos/dex/pkg/log"
 	ptime "github.com/coreos/dex/pkg/time"
+	"github.com/coreos/dex/refresh"
 )
 
 type purger interface {
@@ -19,9 +22,23 @@ type namedPurger struct {
 	purger
 }
 
-func NewGarbageCollector(dbm *gorp.DbMap, ival time.Duration) *GarbageCollector {
+// NewGarbageCollector returns a GarbageCollector purging expired rows every
+// ival. Audit events are kept for auditEventRetention, or
+// DefaultAuditEventRetention if it's zero. Refresh tokens expire as set by
+// refreshOpts, which should match the options the workers use.
+func NewGarbageCollector(dbm *gorp.DbMap, ival, auditEventRetention time.Duration, refreshOpts refresh.RepoOptions) *GarbageCollector {
+	if auditEventRetention == 0 {
+		auditEventRetention = DefaultAuditEventRetention
+	}
+
 	sRepo := NewSessionRepo(dbm)
 	skRepo := NewSessionKeyRepo(dbm)
+	atRepo := newAccessTokenRepo(dbm, access.DefaultAccessTokenGenerator, clockwork.NewRealClock())
+	laRepo := newLoginAttemptRepo(dbm, clockwork.NewRealClock())
+	iatRepo := newInitialAccessTokenRepo(dbm, client.DefaultInitialAccessTokenGenerator, clockwork.NewRealClock())
+	aeRepo := newAuditEventRepo(dbm, auditEventRetention, clockwork.NewRealClock())
+	bsRepo := newBrowserSessionRepo(dbm, clockwork.NewRealClock())
+	rtRepo := newRefreshTokenRepo(dbm, refresh.DefaultRefreshTokenGenerator, refreshOpts, clockwork.NewRealClock())
 
 	purgers := []namedPurger{
 		namedPurger{
@@ -32,6 +49,30 @@ func NewGarbageCollector(dbm *gorp.DbMap, ival time.Duration) *GarbageCollector
 			name:   "session_key",
 			purger: skRepo,
 		},
+		namedPurger{
+			name:   "access_token",
+			purger: atRepo,
+		},
+		namedPurger{
+			name:   "login_attempt",
+			purger: laRepo,
+		},
+		namedPurger{
+			name:   "initial_access_token",
+			purger: iatRepo,
+		},
+		namedPurger{
+			name:   "audit_event",
+			purger: aeRepo,
+		},
+		namedPurger{
+			name:   "browser_session",
+			purger: bsRepo,
+		},
+		namedPurger{
+			name:   "refresh_token",
+			purger: rtRepo,
+		},
 	}
 
 	gc := GarbageCollector{
@@ -65,9 +106,11 @@ func (gc *GarbageCollector) Run() chan struct{} {
 					} else {
 						next = ptime.ExpBackoff(next, time.Minute)
 					}
+					gcRuns.WithLabelValues("failure").Inc()
 					log.Errorf("Failed garbage collection, retrying in %v", next)
 					break
 				}
+				gcRuns.WithLabelValues("success").Inc()
 				failing = false
 				next = gc.interval
 				log.Infof("Garbage collection complete, running again in %v", next)
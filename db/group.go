@@ -0,0 +1,237 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/go-gorp/gorp"
+
+	"github.com/coreos/dex/pkg/log"
+	"github.com/coreos/dex/repo"
+	"github.com/coreos/dex/user"
+)
+
+const (
+	groupTableName       = "user_group"
+	groupMemberTableName = "user_group_member"
+)
+
+func init() {
+	register(table{
+		name:    groupTableName,
+		model:   groupModel{},
+		autoinc: false,
+		pkey:    []string{"id"},
+		unique:  []string{"name"},
+	})
+
+	register(table{
+		name:    groupMemberTableName,
+		model:   groupMemberModel{},
+		autoinc: false,
+		pkey:    []string{"group_id", "user_id", "connector_id"},
+	})
+}
+
+type groupModel struct {
+	ID        string `db:"id"`
+	Name      string `db:"name"`
+	CreatedAt int64  `db:"created_at"`
+}
+
+func (m *groupModel) group() user.Group {
+	g := user.Group{
+		ID:   m.ID,
+		Name: m.Name,
+	}
+	if m.CreatedAt != 0 {
+		g.CreatedAt = time.Unix(m.CreatedAt, 0).UTC()
+	}
+	return g
+}
+
+func newGroupModel(g *user.Group) *groupModel {
+	m := groupModel{
+		ID:   g.ID,
+		Name: g.Name,
+	}
+	if !g.CreatedAt.IsZero() {
+		m.CreatedAt = g.CreatedAt.Unix()
+	}
+	return &m
+}
+
+type groupMemberModel struct {
+	GroupID     string `db:"group_id"`
+	UserID      string `db:"user_id"`
+	ConnectorID string `db:"connector_id"`
+}
+
+func NewGroupRepo(dbm *gorp.DbMap) user.GroupRepo {
+	return &groupRepo{
+		db: &db{dbm},
+	}
+}
+
+type groupRepo struct {
+	*db
+}
+
+func (r *groupRepo) Get(tx repo.Transaction, id string) (user.Group, error) {
+	m, err := r.executor(tx).Get(groupModel{}, id)
+	if err != nil {
+		return user.Group{}, err
+	}
+	if m == nil {
+		return user.Group{}, user.ErrorGroupNotFound
+	}
+
+	gm, ok := m.(*groupModel)
+	if !ok {
+		log.Errorf("expected groupModel but found %v", reflect.TypeOf(m))
+		return user.Group{}, errors.New("unrecognized model")
+	}
+	return gm.group(), nil
+}
+
+func (r *groupRepo) GetByName(tx repo.Transaction, name string) (user.Group, error) {
+	var gm groupModel
+	q := fmt.Sprintf("SELECT * FROM %s WHERE name = $1", r.quote(groupTableName))
+	if err := r.executor(tx).SelectOne(&gm, q, name); err != nil {
+		if err == sql.ErrNoRows {
+			return user.Group{}, user.ErrorGroupNotFound
+		}
+		return user.Group{}, err
+	}
+	return gm.group(), nil
+}
+
+func (r *groupRepo) List(tx repo.Transaction) ([]user.Group, error) {
+	q := fmt.Sprintf("SELECT * FROM %s ORDER BY name", r.quote(groupTableName))
+	return r.selectGroups(tx, q)
+}
+
+func (r *groupRepo) Create(tx repo.Transaction, g user.Group) error {
+	if g.ID == "" {
+		return user.ErrorInvalidID
+	}
+	if !user.ValidGroupName(g.Name) {
+		return user.ErrorInvalidGroupName
+	}
+
+	if _, err := r.GetByName(tx, g.Name); err == nil {
+		return user.ErrorDuplicateGroupName
+	} else if err != user.ErrorGroupNotFound {
+		return err
+	}
+
+	return r.executor(tx).Insert(newGroupModel(&g))
+}
+
+func (r *groupRepo) Delete(tx repo.Transaction, id string) error {
+	ex := r.executor(tx)
+	q := fmt.Sprintf("DELETE FROM %s WHERE group_id = $1", r.quote(groupMemberTableName))
+	if _, err := ex.Exec(q, id); err != nil {
+		return err
+	}
+
+	deleted, err := ex.Delete(&groupModel{ID: id})
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return user.ErrorGroupNotFound
+	}
+	return nil
+}
+
+func (r *groupRepo) AddMember(tx repo.Transaction, groupID, userID, connectorID string) error {
+	if userID == "" {
+		return user.ErrorInvalidID
+	}
+	if _, err := r.Get(tx, groupID); err != nil {
+		return err
+	}
+
+	ex := r.executor(tx)
+	m := &groupMemberModel{GroupID: groupID, UserID: userID, ConnectorID: connectorID}
+	existing, err := ex.Get(groupMemberModel{}, groupID, userID, connectorID)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return nil
+	}
+	return ex.Insert(m)
+}
+
+func (r *groupRepo) RemoveMember(tx repo.Transaction, groupID, userID, connectorID string) error {
+	deleted, err := r.executor(tx).Delete(&groupMemberModel{GroupID: groupID, UserID: userID, ConnectorID: connectorID})
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return user.ErrorNotGroupMember
+	}
+	return nil
+}
+
+func (r *groupRepo) GetMembers(tx repo.Transaction, groupID string) ([]string, error) {
+	if _, err := r.Get(tx, groupID); err != nil {
+		return nil, err
+	}
+
+	var userIDs []string
+	q := fmt.Sprintf("SELECT DISTINCT user_id FROM %s WHERE group_id = $1 ORDER BY user_id", r.quote(groupMemberTableName))
+	if _, err := r.executor(tx).Select(&userIDs, q, groupID); err != nil {
+		return nil, err
+	}
+	return userIDs, nil
+}
+
+func (r *groupRepo) GetGroupsForUser(tx repo.Transaction, userID string) ([]user.Group, error) {
+	q := `SELECT g.* FROM %s AS g WHERE g.id IN
+	(SELECT m.group_id FROM %s AS m WHERE m.user_id = $1) ORDER BY g.name`
+	q = fmt.Sprintf(q, r.quote(groupTableName), r.quote(groupMemberTableName))
+	return r.selectGroups(tx, q, userID)
+}
+
+func (r *groupRepo) SetConnectorGroups(tx repo.Transaction, userID, connectorID string, groupIDs []string) error {
+	if userID == "" {
+		return user.ErrorInvalidID
+	}
+
+	ex := r.executor(tx)
+	q := fmt.Sprintf("DELETE FROM %s WHERE user_id = $1 AND connector_id = $2", r.quote(groupMemberTableName))
+	if _, err := ex.Exec(q, userID, connectorID); err != nil {
+		return err
+	}
+
+	for _, groupID := range groupIDs {
+		if err := r.AddMember(tx, groupID, userID, connectorID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *groupRepo) selectGroups(tx repo.Transaction, q string, args ...interface{}) ([]user.Group, error) {
+	gms, err := r.executor(tx).Select(&groupModel{}, q, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]user.Group, len(gms))
+	for i, m := range gms {
+		gm, ok := m.(*groupModel)
+		if !ok {
+			log.Errorf("expected groupModel but found %v", reflect.TypeOf(m))
+			return nil, errors.New("unrecognized model")
+		}
+		groups[i] = gm.group()
+	}
+	return groups, nil
+}
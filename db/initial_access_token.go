@@ -0,0 +1,166 @@
+package db
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-gorp/gorp"
+	"github.com/jonboulle/clockwork"
+
+	"github.com/coreos/dex/client"
+	"github.com/coreos/dex/pkg/log"
+)
+
+const (
+	initialAccessTokenTableName = "initial_access_token"
+)
+
+func init() {
+	register(table{
+		name:    initialAccessTokenTableName,
+		model:   initialAccessTokenModel{},
+		autoinc: false,
+		pkey:    []string{"id"},
+	})
+}
+
+type initialAccessTokenModel struct {
+	// ID is the hex encoded SHA-256 hash of the token.
+	ID        string `db:"id"`
+	CreatedAt int64  `db:"created_at"`
+	ExpiresAt int64  `db:"expires_at"`
+	MaxUses   int    `db:"max_uses"`
+	Uses      int    `db:"uses"`
+}
+
+func (m *initialAccessTokenModel) initialAccessToken() client.InitialAccessToken {
+	return client.InitialAccessToken{
+		ID:        m.ID,
+		CreatedAt: time.Unix(m.CreatedAt, 0).UTC(),
+		ExpiresAt: time.Unix(m.ExpiresAt, 0).UTC(),
+		MaxUses:   m.MaxUses,
+		Uses:      m.Uses,
+	}
+}
+
+func hashInitialAccessToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+type initialAccessTokenRepo struct {
+	*db
+	tokenGenerator client.InitialAccessTokenGenerator
+	clock          clockwork.Clock
+}
+
+func NewInitialAccessTokenRepo(dbm *gorp.DbMap) client.InitialAccessTokenRepo {
+	return NewInitialAccessTokenRepoWithGenerator(dbm, client.DefaultInitialAccessTokenGenerator)
+}
+
+func NewInitialAccessTokenRepoWithGenerator(dbm *gorp.DbMap, gen client.InitialAccessTokenGenerator) client.InitialAccessTokenRepo {
+	return newInitialAccessTokenRepo(dbm, gen, clockwork.NewRealClock())
+}
+
+func newInitialAccessTokenRepo(dbm *gorp.DbMap, gen client.InitialAccessTokenGenerator, clock clockwork.Clock) *initialAccessTokenRepo {
+	return &initialAccessTokenRepo{
+		db:             &db{dbm},
+		tokenGenerator: gen,
+		clock:          clock,
+	}
+}
+
+func (r *initialAccessTokenRepo) Create(iat client.InitialAccessToken) (string, string, error) {
+	if iat.MaxUses < 0 {
+		return "", "", errors.New("negative maximum uses")
+	}
+
+	token, err := r.tokenGenerator.Generate()
+	if err != nil {
+		return "", "", err
+	}
+
+	record := &initialAccessTokenModel{
+		ID:        hashInitialAccessToken(token),
+		CreatedAt: iat.CreatedAt.Unix(),
+		ExpiresAt: iat.ExpiresAt.Unix(),
+		MaxUses:   iat.MaxUses,
+	}
+	if err := r.executor(nil).Insert(record); err != nil {
+		return "", "", err
+	}
+
+	return token, record.ID, nil
+}
+
+func (r *initialAccessTokenRepo) All() ([]client.InitialAccessToken, error) {
+	q := fmt.Sprintf("SELECT * FROM %s ORDER BY created_at", r.quote(initialAccessTokenTableName))
+	var ms []initialAccessTokenModel
+	if _, err := r.executor(nil).Select(&ms, q); err != nil {
+		return nil, err
+	}
+
+	iats := make([]client.InitialAccessToken, len(ms))
+	for i := range ms {
+		iats[i] = ms[i].initialAccessToken()
+	}
+	return iats, nil
+}
+
+func (r *initialAccessTokenRepo) Use(token string) error {
+	if token == "" {
+		return client.ErrorInvalidInitialAccessToken
+	}
+
+	// Checking and counting the use in a single statement keeps concurrent
+	// registrations from exceeding the maximum uses.
+	q := fmt.Sprintf("UPDATE %s SET uses = uses + 1 WHERE id = $1 AND expires_at > $2 AND (max_uses = 0 OR uses < max_uses)",
+		r.quote(initialAccessTokenTableName))
+	res, err := r.executor(nil).Exec(q, hashInitialAccessToken(token), r.clock.Now().Unix())
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return client.ErrorInvalidInitialAccessToken
+	}
+	return nil
+}
+
+func (r *initialAccessTokenRepo) Delete(id string) error {
+	deleted, err := r.executor(nil).Delete(&initialAccessTokenModel{ID: id})
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return client.ErrorNotFound
+	}
+	return nil
+}
+
+func (r *initialAccessTokenRepo) purge() error {
+	qt := r.quote(initialAccessTokenTableName)
+	q := fmt.Sprintf("DELETE FROM %s WHERE expires_at < $1", qt)
+	res, err := r.executor(nil).Exec(q, r.clock.Now().Unix())
+	if err != nil {
+		return err
+	}
+
+	d := "unknown # of"
+	if n, err := res.RowsAffected(); err == nil {
+		gcPurgedRows.WithLabelValues(initialAccessTokenTableName).Add(float64(n))
+		if n == 0 {
+			return nil
+		}
+		d = fmt.Sprintf("%d", n)
+	}
+
+	log.Infof("Deleted %s stale row(s) from %s table", d, initialAccessTokenTableName)
+	return nil
+}
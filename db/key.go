@@ -88,13 +88,8 @@ type privateKeySetBlob struct {
 }
 
 func NewPrivateKeySetRepo(dbm *gorp.DbMap, useOldFormat bool, secrets ...[]byte) (*PrivateKeySetRepo, error) {
-	if len(secrets) == 0 {
-		return nil, errors.New("must provide at least one key secret")
-	}
-	for i, secret := range secrets {
-		if len(secret) != 32 {
-			return nil, fmt.Errorf("key secret %d: expected 32-byte secret", i)
-		}
+	if err := validateSecrets(secrets); err != nil {
+		return nil, err
 	}
 
 	r := &PrivateKeySetRepo{
@@ -155,7 +150,11 @@ func (r *PrivateKeySetRepo) Set(ks key.KeySet) error {
 	if err := exec.Insert(b); err != nil {
 		return err
 	}
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	keyRotations.Inc()
+	return nil
 }
 
 func (r *PrivateKeySetRepo) Get() (key.KeySet, error) {
@@ -206,6 +205,20 @@ func (r *PrivateKeySetRepo) Get() (key.KeySet, error) {
 	return key.KeySet(pks), nil
 }
 
+// validateSecrets checks there's at least one key secret, and that all of
+// them are 32 bytes long.
+func validateSecrets(secrets [][]byte) error {
+	if len(secrets) == 0 {
+		return errors.New("must provide at least one key secret")
+	}
+	for i, secret := range secrets {
+		if len(secret) != 32 {
+			return fmt.Errorf("key secret %d: expected 32-byte secret", i)
+		}
+	}
+	return nil
+}
+
 func (r *PrivateKeySetRepo) active() []byte {
 	return r.secrets[0]
 }
@@ -0,0 +1,182 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/go-gorp/gorp"
+	"github.com/jonboulle/clockwork"
+
+	"github.com/coreos/dex/lockout"
+	"github.com/coreos/dex/pkg/log"
+)
+
+const (
+	loginAttemptTableName = "login_attempt"
+
+	// loginAttemptRetention is how long failed login attempts are kept after
+	// the last one, once they no longer lock anything out. It's well beyond
+	// any sensible lockout duration.
+	loginAttemptRetention = 24 * time.Hour
+)
+
+func init() {
+	register(table{
+		name:    loginAttemptTableName,
+		model:   loginAttemptModel{},
+		autoinc: false,
+		pkey:    []string{"id"},
+	})
+}
+
+type loginAttemptModel struct {
+	ID            string `db:"id"`
+	Kind          string `db:"kind"`
+	ConnectorID   string `db:"connector_id"`
+	Subject       string `db:"subject"`
+	Failures      int    `db:"failures"`
+	DelayMillis   int64  `db:"delay_millis"`
+	LastFailureAt int64  `db:"last_failure_at"`
+	LockedUntil   int64  `db:"locked_until"`
+}
+
+func (m *loginAttemptModel) attempts() *lockout.Attempts {
+	a := &lockout.Attempts{
+		ID:            m.ID,
+		Kind:          m.Kind,
+		ConnectorID:   m.ConnectorID,
+		Subject:       m.Subject,
+		Failures:      m.Failures,
+		Delay:         time.Duration(m.DelayMillis) * time.Millisecond,
+		LastFailureAt: time.Unix(m.LastFailureAt, 0).UTC(),
+	}
+	if m.LockedUntil != 0 {
+		a.LockedUntil = time.Unix(m.LockedUntil, 0).UTC()
+	}
+	return a
+}
+
+func newLoginAttemptModel(a *lockout.Attempts) *loginAttemptModel {
+	m := &loginAttemptModel{
+		ID:            a.ID,
+		Kind:          a.Kind,
+		ConnectorID:   a.ConnectorID,
+		Subject:       a.Subject,
+		Failures:      a.Failures,
+		DelayMillis:   int64(a.Delay / time.Millisecond),
+		LastFailureAt: a.LastFailureAt.Unix(),
+	}
+	if !a.LockedUntil.IsZero() {
+		m.LockedUntil = a.LockedUntil.Unix()
+	}
+	return m
+}
+
+type loginAttemptRepo struct {
+	*db
+	clock clockwork.Clock
+}
+
+func NewLoginAttemptRepo(dbm *gorp.DbMap) lockout.LoginAttemptRepo {
+	return newLoginAttemptRepo(dbm, clockwork.NewRealClock())
+}
+
+func newLoginAttemptRepo(dbm *gorp.DbMap, clock clockwork.Clock) *loginAttemptRepo {
+	return &loginAttemptRepo{
+		db:    &db{dbm},
+		clock: clock,
+	}
+}
+
+func (r *loginAttemptRepo) Get(id string) (*lockout.Attempts, error) {
+	m, err := r.executor(nil).Get(loginAttemptModel{}, id)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, lockout.ErrorNotFound
+	}
+
+	am, ok := m.(*loginAttemptModel)
+	if !ok {
+		log.Errorf("expected loginAttemptModel but found %v", reflect.TypeOf(m))
+		return nil, errors.New("unrecognized model")
+	}
+	return am.attempts(), nil
+}
+
+func (r *loginAttemptRepo) Set(a lockout.Attempts) error {
+	if a.ID == "" {
+		return errors.New("login attempts must have an ID")
+	}
+
+	tx, err := r.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ex := r.executor(tx)
+	m := newLoginAttemptModel(&a)
+	existing, err := ex.Get(loginAttemptModel{}, a.ID)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		err = ex.Insert(m)
+	} else {
+		_, err = ex.Update(m)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *loginAttemptRepo) Delete(id string) error {
+	deleted, err := r.executor(nil).Delete(&loginAttemptModel{ID: id})
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return lockout.ErrorNotFound
+	}
+	return nil
+}
+
+func (r *loginAttemptRepo) Locked(now time.Time) ([]lockout.Attempts, error) {
+	q := fmt.Sprintf("SELECT * FROM %s WHERE locked_until > $1 ORDER BY locked_until", r.quote(loginAttemptTableName))
+	var ms []loginAttemptModel
+	if _, err := r.executor(nil).Select(&ms, q, now.Unix()); err != nil {
+		return nil, err
+	}
+
+	locked := make([]lockout.Attempts, len(ms))
+	for i := range ms {
+		locked[i] = *ms[i].attempts()
+	}
+	return locked, nil
+}
+
+func (r *loginAttemptRepo) purge() error {
+	now := r.clock.Now()
+	q := fmt.Sprintf("DELETE FROM %s WHERE last_failure_at < $1 AND locked_until < $2", r.quote(loginAttemptTableName))
+	res, err := r.executor(nil).Exec(q, now.Add(-loginAttemptRetention).Unix(), now.Unix())
+	if err != nil {
+		return err
+	}
+
+	d := "unknown # of"
+	if n, err := res.RowsAffected(); err == nil {
+		gcPurgedRows.WithLabelValues(loginAttemptTableName).Add(float64(n))
+		if n == 0 {
+			return nil
+		}
+		d = fmt.Sprintf("%d", n)
+	}
+
+	log.Infof("Deleted %s stale row(s) from %s table", d, loginAttemptTableName)
+	return nil
+}
@@ -0,0 +1,52 @@
+package db
+
+import (
+	"github.com/go-gorp/gorp"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	gcRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dex_gc_runs_total",
+		Help: "Garbage collection runs, by result.",
+	}, []string{"result"})
+	gcPurgedRows = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dex_gc_purged_rows_total",
+		Help: "Stale rows deleted by garbage collection, by table.",
+	}, []string{"table"})
+	keyRotations = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "dex_key_rotations_total",
+		Help: "Signing key sets written to the database.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(gcRuns, gcPurgedRows, keyRotations)
+}
+
+// RegisterPoolMetrics exposes the connection pool statistics of dbm through
+// the default Prometheus registry. It must be called at most once.
+func RegisterPoolMetrics(dbm *gorp.DbMap) {
+	prometheus.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "dex_db_open_connections",
+			Help: "Established database connections, both in use and idle.",
+		}, func() float64 { return float64(dbm.Db.Stats().OpenConnections) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "dex_db_in_use_connections",
+			Help: "Database connections currently in use.",
+		}, func() float64 { return float64(dbm.Db.Stats().InUse) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "dex_db_idle_connections",
+			Help: "Idle database connections.",
+		}, func() float64 { return float64(dbm.Db.Stats().Idle) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "dex_db_wait_count",
+			Help: "Total number of times a database connection was waited for.",
+		}, func() float64 { return float64(dbm.Db.Stats().WaitCount) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "dex_db_wait_duration_seconds",
+			Help: "Total time spent waiting for a database connection.",
+		}, func() float64 { return dbm.Db.Stats().WaitDuration.Seconds() }),
+	)
+}
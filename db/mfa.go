@@ -0,0 +1,151 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"time"
+
+	"github.com/go-gorp/gorp"
+
+	"github.com/coreos/dex/mfa"
+	pcrypto "github.com/coreos/dex/pkg/crypto"
+	"github.com/coreos/dex/pkg/log"
+)
+
+const (
+	mfaEnrollmentTableName = "mfa_enrollment"
+)
+
+var (
+	ErrorCannotDecryptMFAEnrollment = errors.New("Cannot Decrypt MFA Enrollment")
+)
+
+func init() {
+	register(table{
+		name:    mfaEnrollmentTableName,
+		model:   mfaEnrollmentModel{},
+		autoinc: false,
+		pkey:    []string{"user_id"},
+	})
+}
+
+// mfaEnrollmentModel stores the secrets of an enrollment encrypted with the
+// key secrets.
+type mfaEnrollmentModel struct {
+	UserID    string `db:"user_id"`
+	Value     []byte `db:"value"`
+	CreatedAt int64  `db:"created_at"`
+}
+
+type mfaEnrollmentValue struct {
+	Secret        []byte   `json:"secret"`
+	RecoveryCodes []string `json:"recoveryCodes"`
+	LastStep      int64    `json:"lastStep"`
+}
+
+func NewMFAEnrollmentRepo(dbm *gorp.DbMap, secrets ...[]byte) (mfa.EnrollmentRepo, error) {
+	if err := validateSecrets(secrets); err != nil {
+		return nil, err
+	}
+	return &mfaEnrollmentRepo{
+		db:      &db{dbm},
+		secrets: secrets,
+	}, nil
+}
+
+type mfaEnrollmentRepo struct {
+	*db
+	secrets [][]byte
+}
+
+func (r *mfaEnrollmentRepo) Get(userID string) (*mfa.Enrollment, error) {
+	m, err := r.executor(nil).Get(mfaEnrollmentModel{}, userID)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, mfa.ErrorNotFound
+	}
+
+	em, ok := m.(*mfaEnrollmentModel)
+	if !ok {
+		log.Errorf("expected mfaEnrollmentModel but found %v", reflect.TypeOf(m))
+		return nil, errors.New("unrecognized model")
+	}
+
+	for _, secret := range r.secrets {
+		j, err := pcrypto.Decrypt(em.Value, secret)
+		if err != nil {
+			continue
+		}
+		var v mfaEnrollmentValue
+		if err := json.Unmarshal(j, &v); err != nil {
+			continue
+		}
+		return &mfa.Enrollment{
+			UserID:        em.UserID,
+			Secret:        v.Secret,
+			RecoveryCodes: v.RecoveryCodes,
+			LastStep:      v.LastStep,
+			CreatedAt:     time.Unix(em.CreatedAt, 0).UTC(),
+		}, nil
+	}
+	return nil, ErrorCannotDecryptMFAEnrollment
+}
+
+func (r *mfaEnrollmentRepo) Set(e mfa.Enrollment) error {
+	if e.UserID == "" {
+		return errors.New("MFA enrollments must have a user ID")
+	}
+
+	j, err := json.Marshal(mfaEnrollmentValue{
+		Secret:        e.Secret,
+		RecoveryCodes: e.RecoveryCodes,
+		LastStep:      e.LastStep,
+	})
+	if err != nil {
+		return err
+	}
+	v, err := pcrypto.Encrypt(j, r.secrets[0])
+	if err != nil {
+		return err
+	}
+	m := &mfaEnrollmentModel{
+		UserID:    e.UserID,
+		Value:     v,
+		CreatedAt: e.CreatedAt.Unix(),
+	}
+
+	tx, err := r.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ex := r.executor(tx)
+	existing, err := ex.Get(mfaEnrollmentModel{}, e.UserID)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		err = ex.Insert(m)
+	} else {
+		_, err = ex.Update(m)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *mfaEnrollmentRepo) Delete(userID string) error {
+	deleted, err := r.executor(nil).Delete(&mfaEnrollmentModel{UserID: userID})
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return mfa.ErrorNotFound
+	}
+	return nil
+}
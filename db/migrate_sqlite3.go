@@ -2,6 +2,17 @@ package db
 
 // SQLite3 is a test only database. There is only one migration because we do not support migrations.
 const sqlite3Migration = `
+CREATE TABLE access_token (
+    id text NOT NULL UNIQUE,
+    user_id text,
+    client_id text,
+    scope text,
+    audience text,
+    created_at integer,
+    expires_at integer,
+    claims text
+);
+
 CREATE TABLE authd_user (
     id text NOT NULL UNIQUE,
     email text,
@@ -16,7 +27,16 @@ CREATE TABLE client_identity (
     id text NOT NULL UNIQUE,
     secret blob,
     metadata text,
-    dex_admin integer
+    dex_admin integer,
+    public integer,
+    require_mfa integer,
+    previous_secret blob,
+    previous_secret_expires_at integer,
+    registration_token blob,
+    post_logout_redirect_uris text,
+    frontchannel_logout_uri text,
+    backchannel_logout_uri text,
+    first_party integer
 );
 
 CREATE TABLE connector_config (
@@ -32,14 +52,20 @@ CREATE TABLE key (
 CREATE TABLE password_info (
     user_id text NOT NULL UNIQUE,
     password text,
-    password_expires bigint
+    password_expires bigint,
+    password_history text
 );
 
 CREATE TABLE refresh_token (
     id integer PRIMARY KEY,
     payload_hash blob,
     user_id text,
-    client_id text
+    client_id text,
+    family_id integer,
+    created_at integer,
+    family_created_at integer,
+    retired integer,
+    scope text
 );
 
 CREATE TABLE remote_identity_mapping (
@@ -61,7 +87,17 @@ CREATE TABLE session (
     user_id text,
     register integer,
     nonce text,
-    scope text
+    scope text,
+    response_type text,
+    code_challenge text,
+    code_challenge_method text,
+    claims_request text,
+    amr text,
+    remote_ip text,
+    auth_time bigint,
+    browser_session_id text,
+    prompt_consent integer,
+    remote_groups text
 );
 
 CREATE TABLE session_key (
@@ -70,4 +106,72 @@ CREATE TABLE session_key (
     expires_at bigint,
     stale integer
 );
+
+CREATE TABLE user_group (
+    id text NOT NULL UNIQUE,
+    name text NOT NULL UNIQUE,
+    created_at bigint
+);
+
+CREATE TABLE user_group_member (
+    group_id text NOT NULL,
+    user_id text NOT NULL,
+    connector_id text NOT NULL,
+    PRIMARY KEY (group_id, user_id, connector_id)
+);
+
+CREATE TABLE login_attempt (
+    id text NOT NULL UNIQUE,
+    kind text NOT NULL,
+    connector_id text NOT NULL,
+    subject text NOT NULL,
+    failures integer NOT NULL,
+    delay_millis bigint NOT NULL,
+    last_failure_at bigint NOT NULL,
+    locked_until bigint NOT NULL
+);
+
+CREATE TABLE mfa_enrollment (
+    user_id text NOT NULL UNIQUE,
+    value blob,
+    created_at bigint
+);
+
+CREATE TABLE initial_access_token (
+    id text NOT NULL UNIQUE,
+    created_at bigint NOT NULL,
+    expires_at bigint NOT NULL,
+    max_uses integer NOT NULL,
+    uses integer NOT NULL
+);
+
+CREATE TABLE audit_event (
+    id text NOT NULL UNIQUE,
+    type text NOT NULL,
+    created_at bigint NOT NULL,
+    user_id text,
+    client_id text,
+    connector_id text,
+    ip text,
+    details text
+);
+
+CREATE TABLE browser_session (
+    id text NOT NULL UNIQUE,
+    connector_id text NOT NULL,
+    identity text,
+    user_id text NOT NULL,
+    auth_time bigint NOT NULL,
+    expires_at bigint NOT NULL,
+    amr text
+);
+
+CREATE TABLE consent_grant (
+    user_id text NOT NULL,
+    client_id text NOT NULL,
+    scope text,
+    created_at bigint,
+    updated_at bigint,
+    PRIMARY KEY (user_id, client_id)
+);
 `
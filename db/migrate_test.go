@@ -205,3 +205,45 @@ func TestMigrationNumber11(t *testing.T) {
 		}
 	}
 }
+
+func TestMigrationNumber20(t *testing.T) {
+	dsn := os.Getenv("DEX_TEST_DSN")
+	if dsn == "" {
+		t.Skip("Test will not run without DEX_TEST_DSN environment variable.")
+		return
+	}
+	dbMap := initDB(dsn)
+
+	nMigrations := 19
+	n, err := MigrateMaxMigrations(dbMap, nMigrations)
+	if err != nil {
+		t.Fatalf("failed to perform initial migration: %v", err)
+	}
+	if n != nMigrations {
+		t.Fatalf("expected to perform %d migrations, got %d", nMigrations, n)
+	}
+
+	// Passwords set before the migration have no history.
+	if _, err := dbMap.Exec(`INSERT INTO password_info (user_id, password, password_expires) VALUES ('ID-1', 'hash', 0);`); err != nil {
+		t.Fatalf("failed to insert password info: %v", err)
+	}
+
+	n, err = MigrateMaxMigrations(dbMap, 1)
+	if err != nil {
+		t.Fatalf("failed to perform migration: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("expected to perform 1 migration, got %d", n)
+	}
+
+	pw, err := NewPasswordInfoRepo(dbMap).Get(nil, "ID-1")
+	if err != nil {
+		t.Fatalf("failed to get password info: %v", err)
+	}
+	if string(pw.Password) != "hash" {
+		t.Errorf("want password=%q, got=%q", "hash", pw.Password)
+	}
+	if len(pw.History) != 0 {
+		t.Errorf("want no password history, got %q", pw.History)
+	}
+}
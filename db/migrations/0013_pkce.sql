@@ -0,0 +1,7 @@
+-- +migrate Up
+ALTER TABLE session ADD COLUMN "code_challenge" text;
+ALTER TABLE session ADD COLUMN "code_challenge_method" text;
+
+ALTER TABLE client_identity ADD COLUMN "public" boolean;
+
+UPDATE "client_identity" SET "public" = false;
@@ -0,0 +1,13 @@
+-- +migrate Up
+CREATE TABLE access_token (
+    id text NOT NULL,
+    user_id text,
+    client_id text,
+    scope text,
+    audience text,
+    created_at bigint,
+    expires_at bigint
+);
+
+ALTER TABLE ONLY access_token
+    ADD CONSTRAINT access_token_pkey PRIMARY KEY (id);
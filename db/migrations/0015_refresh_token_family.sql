@@ -0,0 +1,16 @@
+-- +migrate Up
+ALTER TABLE refresh_token ADD COLUMN "family_id" bigint;
+ALTER TABLE refresh_token ADD COLUMN "created_at" bigint;
+ALTER TABLE refresh_token ADD COLUMN "family_created_at" bigint;
+ALTER TABLE refresh_token ADD COLUMN "retired" boolean;
+
+-- Families are revoked and garbage collected as a whole.
+CREATE INDEX refresh_token_family_id ON refresh_token (family_id);
+
+-- Existing tokens each start their own family. Their lifetimes are counted
+-- from the migration, as when they were issued wasn't recorded.
+UPDATE refresh_token SET
+    "family_id" = "id",
+    "created_at" = extract(epoch from now())::bigint,
+    "family_created_at" = extract(epoch from now())::bigint,
+    "retired" = false;
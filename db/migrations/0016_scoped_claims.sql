@@ -0,0 +1,8 @@
+-- +migrate Up
+ALTER TABLE session ADD COLUMN "claims_request" text;
+ALTER TABLE access_token ADD COLUMN "claims" text;
+ALTER TABLE refresh_token ADD COLUMN "scope" text;
+
+-- Existing tokens were issued before claims were released by scope, when
+-- every token carried the user's name and email.
+UPDATE refresh_token SET "scope" = 'openid profile email offline_access';
@@ -0,0 +1,23 @@
+-- +migrate Up
+CREATE TABLE user_group (
+    id text NOT NULL,
+    name text NOT NULL,
+    created_at bigint
+);
+
+ALTER TABLE ONLY user_group
+    ADD CONSTRAINT user_group_pkey PRIMARY KEY (id);
+
+ALTER TABLE ONLY user_group
+    ADD CONSTRAINT user_group_name_key UNIQUE (name);
+
+-- Memberships synced from a connector record its ID; those managed through
+-- the admin API have an empty connector_id.
+CREATE TABLE user_group_member (
+    group_id text NOT NULL,
+    user_id text NOT NULL,
+    connector_id text NOT NULL
+);
+
+ALTER TABLE ONLY user_group_member
+    ADD CONSTRAINT user_group_member_pkey PRIMARY KEY (group_id, user_id, connector_id);
@@ -0,0 +1,14 @@
+-- +migrate Up
+CREATE TABLE login_attempt (
+    id text NOT NULL,
+    kind text NOT NULL,
+    connector_id text NOT NULL,
+    subject text NOT NULL,
+    failures integer NOT NULL,
+    delay_millis bigint NOT NULL,
+    last_failure_at bigint NOT NULL,
+    locked_until bigint NOT NULL
+);
+
+ALTER TABLE ONLY login_attempt
+    ADD CONSTRAINT login_attempt_pkey PRIMARY KEY (id);
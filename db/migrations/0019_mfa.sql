@@ -0,0 +1,15 @@
+-- +migrate Up
+CREATE TABLE mfa_enrollment (
+    user_id text NOT NULL,
+    value bytea,
+    created_at bigint
+);
+
+ALTER TABLE ONLY mfa_enrollment
+    ADD CONSTRAINT mfa_enrollment_pkey PRIMARY KEY (user_id);
+
+ALTER TABLE client_identity ADD COLUMN "require_mfa" boolean;
+
+UPDATE "client_identity" SET "require_mfa" = false;
+
+ALTER TABLE session ADD COLUMN "amr" text;
@@ -0,0 +1,4 @@
+-- +migrate Up
+ALTER TABLE password_info ADD COLUMN "password_history" text;
+
+UPDATE "password_info" SET "password_history" = '';
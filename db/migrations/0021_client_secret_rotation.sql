@@ -0,0 +1,5 @@
+-- +migrate Up
+ALTER TABLE client_identity ADD COLUMN "previous_secret" bytea;
+ALTER TABLE client_identity ADD COLUMN "previous_secret_expires_at" bigint;
+
+UPDATE "client_identity" SET "previous_secret_expires_at" = 0;
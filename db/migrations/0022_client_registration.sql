@@ -0,0 +1,13 @@
+-- +migrate Up
+ALTER TABLE client_identity ADD COLUMN "registration_token" bytea;
+
+CREATE TABLE initial_access_token (
+    id text NOT NULL,
+    created_at bigint NOT NULL,
+    expires_at bigint NOT NULL,
+    max_uses integer NOT NULL,
+    uses integer NOT NULL
+);
+
+ALTER TABLE ONLY initial_access_token
+    ADD CONSTRAINT initial_access_token_pkey PRIMARY KEY (id);
@@ -0,0 +1,18 @@
+-- +migrate Up
+ALTER TABLE session ADD COLUMN "remote_ip" text;
+
+CREATE TABLE audit_event (
+    id text NOT NULL,
+    type text NOT NULL,
+    created_at bigint NOT NULL,
+    user_id text,
+    client_id text,
+    connector_id text,
+    ip text,
+    details text
+);
+
+ALTER TABLE ONLY audit_event
+    ADD CONSTRAINT audit_event_pkey PRIMARY KEY (id);
+
+CREATE INDEX audit_event_created_at ON audit_event (created_at);
@@ -0,0 +1,16 @@
+-- +migrate Up
+ALTER TABLE session ADD COLUMN "auth_time" bigint;
+ALTER TABLE session ADD COLUMN "browser_session_id" text;
+
+CREATE TABLE browser_session (
+    id text NOT NULL,
+    connector_id text NOT NULL,
+    identity text,
+    user_id text NOT NULL,
+    auth_time bigint NOT NULL,
+    expires_at bigint NOT NULL,
+    amr text
+);
+
+ALTER TABLE ONLY browser_session
+    ADD CONSTRAINT browser_session_pkey PRIMARY KEY (id);
@@ -0,0 +1,6 @@
+-- +migrate Up
+ALTER TABLE client_identity ADD COLUMN "post_logout_redirect_uris" text;
+ALTER TABLE client_identity ADD COLUMN "frontchannel_logout_uri" text;
+ALTER TABLE client_identity ADD COLUMN "backchannel_logout_uri" text;
+
+UPDATE "client_identity" SET "post_logout_redirect_uris" = '', "frontchannel_logout_uri" = '', "backchannel_logout_uri" = '';
@@ -0,0 +1,17 @@
+-- +migrate Up
+CREATE TABLE consent_grant (
+    user_id text NOT NULL,
+    client_id text NOT NULL,
+    scope text,
+    created_at bigint,
+    updated_at bigint
+);
+
+ALTER TABLE ONLY consent_grant
+    ADD CONSTRAINT consent_grant_pkey PRIMARY KEY (user_id, client_id);
+
+ALTER TABLE client_identity ADD COLUMN "first_party" boolean;
+
+UPDATE "client_identity" SET "first_party" = false;
+
+ALTER TABLE session ADD COLUMN "prompt_consent" boolean;
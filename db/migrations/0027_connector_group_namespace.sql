@@ -0,0 +1,5 @@
+-- +migrate Up
+-- Upstream groups are synced to groups named in the namespace of their
+-- connector. Memberships synced before could be in groups managed through the
+-- admin API, so they're dropped; connectors sync them again on the next login.
+DELETE FROM user_group_member WHERE connector_id <> '';
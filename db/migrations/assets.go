@@ -72,5 +72,107 @@ var PostgresMigrations migrate.MigrationSource = &migrate.MemoryMigrationSource{
 				"-- +migrate Up\n\n-- This migration is a fix for a bug that allowed duplicate emails if they used different cases (see #338).\n-- When migrating, dex will not take the liberty of deleting rows for duplicate cases. Instead it will\n-- raise an exception and call for an admin to remove duplicates manually.\n\nCREATE OR REPLACE FUNCTION raise_exp() RETURNS VOID AS $$\nBEGIN\n     RAISE EXCEPTION 'Found duplicate emails when using case insensitive comparision, cannot perform migration.';\nEND;\n$$ LANGUAGE plpgsql;\n\nSELECT LOWER(email),\n    COUNT(email),\n    CASE\n        WHEN COUNT(email) > 1 THEN raise_exp()\n        ELSE NULL\n    END\nFROM authd_user\nGROUP BY LOWER(email);\n\nUPDATE authd_user SET email = LOWER(email);\n",
 			},
 		},
+		{
+			Id: "0012_session_response_type.sql",
+			Up: []string{
+				"-- +migrate Up\nALTER TABLE session ADD COLUMN \"response_type\" text;\n",
+			},
+		},
+		{
+			Id: "0013_pkce.sql",
+			Up: []string{
+				"-- +migrate Up\nALTER TABLE session ADD COLUMN \"code_challenge\" text;\nALTER TABLE session ADD COLUMN \"code_challenge_method\" text;\n\nALTER TABLE client_identity ADD COLUMN \"public\" boolean;\n\nUPDATE \"client_identity\" SET \"public\" = false;\n",
+			},
+		},
+		{
+			Id: "0014_access_token.sql",
+			Up: []string{
+				"-- +migrate Up\nCREATE TABLE access_token (\n    id text NOT NULL,\n    user_id text,\n    client_id text,\n    scope text,\n    audience text,\n    created_at bigint,\n    expires_at bigint\n);\n\nALTER TABLE ONLY access_token\n    ADD CONSTRAINT access_token_pkey PRIMARY KEY (id);\n",
+			},
+		},
+		{
+			Id: "0015_refresh_token_family.sql",
+			Up: []string{
+				"-- +migrate Up\nALTER TABLE refresh_token ADD COLUMN \"family_id\" bigint;\nALTER TABLE refresh_token ADD COLUMN \"created_at\" bigint;\nALTER TABLE refresh_token ADD COLUMN \"family_created_at\" bigint;\nALTER TABLE refresh_token ADD COLUMN \"retired\" boolean;\n\n-- Families are revoked and garbage collected as a whole.\nCREATE INDEX refresh_token_family_id ON refresh_token (family_id);\n\n-- Existing tokens each start their own family. Their lifetimes are counted\n-- from the migration, as when they were issued wasn't recorded.\nUPDATE refresh_token SET\n    \"family_id\" = \"id\",\n    \"created_at\" = extract(epoch from now())::bigint,\n    \"family_created_at\" = extract(epoch from now())::bigint,\n    \"retired\" = false;\n",
+			},
+		},
+		{
+			Id: "0016_scoped_claims.sql",
+			Up: []string{
+				"-- +migrate Up\nALTER TABLE session ADD COLUMN \"claims_request\" text;\nALTER TABLE access_token ADD COLUMN \"claims\" text;\nALTER TABLE refresh_token ADD COLUMN \"scope\" text;\n\n-- Existing tokens were issued before claims were released by scope, when\n-- every token carried the user's name and email.\nUPDATE refresh_token SET \"scope\" = 'openid profile email offline_access';\n",
+			},
+		},
+		{
+			Id: "0017_user_group.sql",
+			Up: []string{
+				"-- +migrate Up\nCREATE TABLE user_group (\n    id text NOT NULL,\n    name text NOT NULL,\n    created_at bigint\n);\n\nALTER TABLE ONLY user_group\n    ADD CONSTRAINT user_group_pkey PRIMARY KEY (id);\n\nALTER TABLE ONLY user_group\n    ADD CONSTRAINT user_group_name_key UNIQUE (name);\n\n-- Memberships synced from a connector record its ID; those managed through\n-- the admin API have an empty connector_id.\nCREATE TABLE user_group_member (\n    group_id text NOT NULL,\n    user_id text NOT NULL,\n    connector_id text NOT NULL\n);\n\nALTER TABLE ONLY user_group_member\n    ADD CONSTRAINT user_group_member_pkey PRIMARY KEY (group_id, user_id, connector_id);\n",
+			},
+		},
+		{
+			Id: "0018_login_attempt.sql",
+			Up: []string{
+				"-- +migrate Up\nCREATE TABLE login_attempt (\n    id text NOT NULL,\n    kind text NOT NULL,\n    connector_id text NOT NULL,\n    subject text NOT NULL,\n    failures integer NOT NULL,\n    delay_millis bigint NOT NULL,\n    last_failure_at bigint NOT NULL,\n    locked_until bigint NOT NULL\n);\n\nALTER TABLE ONLY login_attempt\n    ADD CONSTRAINT login_attempt_pkey PRIMARY KEY (id);\n",
+			},
+		},
+		{
+			Id: "0019_mfa.sql",
+			Up: []string{
+				"-- +migrate Up\nCREATE TABLE mfa_enrollment (\n    user_id text NOT NULL,\n    value bytea,\n    created_at bigint\n);\n\nALTER TABLE ONLY mfa_enrollment\n    ADD CONSTRAINT mfa_enrollment_pkey PRIMARY KEY (user_id);\n\nALTER TABLE client_identity ADD COLUMN \"require_mfa\" boolean;\n\nUPDATE \"client_identity\" SET \"require_mfa\" = false;\n\nALTER TABLE session ADD COLUMN \"amr\" text;\n",
+			},
+		},
+		{
+			Id: "0020_password_history.sql",
+			Up: []string{
+				"-- +migrate Up\nALTER TABLE password_info ADD COLUMN \"password_history\" text;\n\nUPDATE \"password_info\" SET \"password_history\" = '';\n",
+			},
+		},
+		{
+			Id: "0021_client_secret_rotation.sql",
+			Up: []string{
+				"-- +migrate Up\nALTER TABLE client_identity ADD COLUMN \"previous_secret\" bytea;\nALTER TABLE client_identity ADD COLUMN \"previous_secret_expires_at\" bigint;\n\nUPDATE \"client_identity\" SET \"previous_secret_expires_at\" = 0;\n",
+			},
+		},
+		{
+			Id: "0022_client_registration.sql",
+			Up: []string{
+				"-- +migrate Up\nALTER TABLE client_identity ADD COLUMN \"registration_token\" bytea;\n\nCREATE TABLE initial_access_token (\n    id text NOT NULL,\n    created_at bigint NOT NULL,\n    expires_at bigint NOT NULL,\n    max_uses integer NOT NULL,\n    uses integer NOT NULL\n);\n\nALTER TABLE ONLY initial_access_token\n    ADD CONSTRAINT initial_access_token_pkey PRIMARY KEY (id);\n",
+			},
+		},
+		{
+			Id: "0023_audit_event.sql",
+			Up: []string{
+				"-- +migrate Up\nALTER TABLE session ADD COLUMN \"remote_ip\" text;\n\nCREATE TABLE audit_event (\n    id text NOT NULL,\n    type text NOT NULL,\n    created_at bigint NOT NULL,\n    user_id text,\n    client_id text,\n    connector_id text,\n    ip text,\n    details text\n);\n\nALTER TABLE ONLY audit_event\n    ADD CONSTRAINT audit_event_pkey PRIMARY KEY (id);\n\nCREATE INDEX audit_event_created_at ON audit_event (created_at);\n",
+			},
+		},
+		{
+			Id: "0024_browser_session.sql",
+			Up: []string{
+				"-- +migrate Up\nALTER TABLE session ADD COLUMN \"auth_time\" bigint;\nALTER TABLE session ADD COLUMN \"browser_session_id\" text;\n\nCREATE TABLE browser_session (\n    id text NOT NULL,\n    connector_id text NOT NULL,\n    identity text,\n    user_id text NOT NULL,\n    auth_time bigint NOT NULL,\n    expires_at bigint NOT NULL,\n    amr text\n);\n\nALTER TABLE ONLY browser_session\n    ADD CONSTRAINT browser_session_pkey PRIMARY KEY (id);\n",
+			},
+		},
+		{
+			Id: "0025_client_logout.sql",
+			Up: []string{
+				"-- +migrate Up\nALTER TABLE client_identity ADD COLUMN \"post_logout_redirect_uris\" text;\nALTER TABLE client_identity ADD COLUMN \"frontchannel_logout_uri\" text;\nALTER TABLE client_identity ADD COLUMN \"backchannel_logout_uri\" text;\n\nUPDATE \"client_identity\" SET \"post_logout_redirect_uris\" = '', \"frontchannel_logout_uri\" = '', \"backchannel_logout_uri\" = '';\n",
+			},
+		},
+		{
+			Id: "0026_consent.sql",
+			Up: []string{
+				"-- +migrate Up\nCREATE TABLE consent_grant (\n    user_id text NOT NULL,\n    client_id text NOT NULL,\n    scope text,\n    created_at bigint,\n    updated_at bigint\n);\n\nALTER TABLE ONLY consent_grant\n    ADD CONSTRAINT consent_grant_pkey PRIMARY KEY (user_id, client_id);\n\nALTER TABLE client_identity ADD COLUMN \"first_party\" boolean;\n\nUPDATE \"client_identity\" SET \"first_party\" = false;\n\nALTER TABLE session ADD COLUMN \"prompt_consent\" boolean;\n",
+			},
+		},
+		{
+			Id: "0027_connector_group_namespace.sql",
+			Up: []string{
+				"-- +migrate Up\n-- Upstream groups are synced to groups named in the namespace of their\n-- connector. Memberships synced before could be in groups managed through the\n-- admin API, so they're dropped; connectors sync them again on the next login.\nDELETE FROM user_group_member WHERE connector_id <> '';\n",
+			},
+		},
+		{
+			Id: "0028_session_remote_groups.sql",
+			Up: []string{
+				"-- +migrate Up\nALTER TABLE session ADD COLUMN \"remote_groups\" text;\n",
+			},
+		},
 	},
 }
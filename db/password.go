@@ -1,6 +1,7 @@
 package db
 
 import (
+	"encoding/json"
 	"errors"
 	"reflect"
 	"time"
@@ -30,6 +31,7 @@ type passwordInfoModel struct {
 	UserID          string `db:"user_id"`
 	Password        string `db:"password"`
 	PasswordExpires int64  `db:"password_expires"`
+	PasswordHistory string `db:"password_history"`
 }
 
 func NewPasswordInfoRepo(dbm *gorp.DbMap) user.PasswordInfoRepo {
@@ -150,6 +152,16 @@ func (p *passwordInfoModel) passwordInfo() (user.PasswordInfo, error) {
 		pw.PasswordExpires = time.Unix(p.PasswordExpires, 0).UTC()
 	}
 
+	if p.PasswordHistory != "" {
+		var history []string
+		if err := json.Unmarshal([]byte(p.PasswordHistory), &history); err != nil {
+			return user.PasswordInfo{}, err
+		}
+		for _, h := range history {
+			pw.History = append(pw.History, user.Password(h))
+		}
+	}
+
 	return pw, nil
 }
 
@@ -163,5 +175,17 @@ func newPasswordInfoModel(p *user.PasswordInfo) (*passwordInfoModel, error) {
 		pw.PasswordExpires = p.PasswordExpires.Unix()
 	}
 
+	if len(p.History) != 0 {
+		history := make([]string, len(p.History))
+		for i, h := range p.History {
+			history[i] = string(h)
+		}
+		b, err := json.Marshal(history)
+		if err != nil {
+			return nil, err
+		}
+		pw.PasswordHistory = string(b)
+	}
+
 	return &pw, nil
 }
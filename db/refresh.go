@@ -7,8 +7,10 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-gorp/gorp"
+	"github.com/jonboulle/clockwork"
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/coreos/dex/client"
@@ -33,6 +35,8 @@ func init() {
 type refreshTokenRepo struct {
 	*db
 	tokenGenerator refresh.RefreshTokenGenerator
+	opts           refresh.RepoOptions
+	clock          clockwork.Clock
 }
 
 type refreshTokenModel struct {
@@ -42,6 +46,15 @@ type refreshTokenModel struct {
 	// data integrity.
 	UserID   string `db:"user_id"`
 	ClientID string `db:"client_id"`
+	Scope    string `db:"scope"`
+
+	// FamilyID is the ID of the first token of the family.
+	FamilyID        int64 `db:"family_id"`
+	CreatedAt       int64 `db:"created_at"`
+	FamilyCreatedAt int64 `db:"family_created_at"`
+	// Retired tokens have been exchanged for a new token; they are kept
+	// around to detect their reuse.
+	Retired bool `db:"retired"`
 }
 
 // buildToken combines the token ID and token payload to create a new token.
@@ -83,13 +96,23 @@ func NewRefreshTokenRepo(dbm *gorp.DbMap) refresh.RefreshTokenRepo {
 }
 
 func NewRefreshTokenRepoWithGenerator(dbm *gorp.DbMap, gen refresh.RefreshTokenGenerator) refresh.RefreshTokenRepo {
+	return NewRefreshTokenRepoWithOptions(dbm, gen, refresh.RepoOptions{})
+}
+
+func NewRefreshTokenRepoWithOptions(dbm *gorp.DbMap, gen refresh.RefreshTokenGenerator, opts refresh.RepoOptions) refresh.RefreshTokenRepo {
+	return newRefreshTokenRepo(dbm, gen, opts, clockwork.NewRealClock())
+}
+
+func newRefreshTokenRepo(dbm *gorp.DbMap, gen refresh.RefreshTokenGenerator, opts refresh.RepoOptions, clock clockwork.Clock) *refreshTokenRepo {
 	return &refreshTokenRepo{
 		db:             &db{dbm},
 		tokenGenerator: gen,
+		opts:           opts,
+		clock:          clock,
 	}
 }
 
-func (r *refreshTokenRepo) Create(userID, clientID string) (string, error) {
+func (r *refreshTokenRepo) Create(userID, clientID string, scope []string) (string, error) {
 	if userID == "" {
 		return "", refresh.ErrorInvalidUserID
 	}
@@ -97,28 +120,68 @@ func (r *refreshTokenRepo) Create(userID, clientID string) (string, error) {
 		return "", refresh.ErrorInvalidClientID
 	}
 
-	// TODO(yifan): Check the number of tokens given to the client-user pair.
-	tokenPayload, err := r.tokenGenerator.Generate()
+	tx, err := r.begin()
 	if err != nil {
 		return "", err
 	}
+	defer tx.Rollback()
 
-	payloadHash, err := bcrypt.GenerateFromPassword(tokenPayload, bcrypt.DefaultCost)
+	// TODO(yifan): Check the number of tokens given to the client-user pair.
+	now := r.clock.Now().Unix()
+	token, record, err := r.insert(tx, &refreshTokenModel{
+		UserID:          userID,
+		ClientID:        clientID,
+		Scope:           strings.Join(scope, " "),
+		FamilyCreatedAt: now,
+	})
 	if err != nil {
 		return "", err
 	}
 
-	record := &refreshTokenModel{
-		PayloadHash: payloadHash,
-		UserID:      userID,
-		ClientID:    clientID,
+	// The first token of a family gives the family its ID.
+	record.FamilyID = record.ID
+	if _, err := r.executor(tx).Update(record); err != nil {
+		return "", err
 	}
 
-	if err := r.executor(nil).Insert(record); err != nil {
+	if err := tx.Commit(); err != nil {
 		return "", err
 	}
+	return token, nil
+}
+
+// insert generates a new token for the given record and stores it.
+func (r *refreshTokenRepo) insert(tx repo.Transaction, record *refreshTokenModel) (string, *refreshTokenModel, error) {
+	tokenPayload, err := r.tokenGenerator.Generate()
+	if err != nil {
+		return "", nil, err
+	}
+
+	payloadHash, err := bcrypt.GenerateFromPassword(tokenPayload, bcrypt.DefaultCost)
+	if err != nil {
+		return "", nil, err
+	}
 
-	return buildToken(record.ID, tokenPayload), nil
+	record.PayloadHash = payloadHash
+	record.CreatedAt = r.clock.Now().Unix()
+	if err := r.executor(tx).Insert(record); err != nil {
+		return "", nil, err
+	}
+
+	return buildToken(record.ID, tokenPayload), record, nil
+}
+
+// expired reports whether the token has outlived the absolute lifetime of
+// its family or has been idle for too long.
+func (r *refreshTokenRepo) expired(record *refreshTokenModel) bool {
+	now := r.clock.Now()
+	if r.opts.AbsoluteLifetime != 0 && now.After(time.Unix(record.FamilyCreatedAt, 0).Add(r.opts.AbsoluteLifetime)) {
+		return true
+	}
+	if r.opts.IdleTimeout != 0 && now.After(time.Unix(record.CreatedAt, 0).Add(r.opts.IdleTimeout)) {
+		return true
+	}
+	return false
 }
 
 func (r *refreshTokenRepo) Verify(clientID, token string) (string, error) {
@@ -141,9 +204,100 @@ func (r *refreshTokenRepo) Verify(clientID, token string) (string, error) {
 		return "", err
 	}
 
+	if record.Retired || r.expired(record) {
+		return "", refresh.ErrorInvalidToken
+	}
+
 	return record.UserID, nil
 }
 
+func (r *refreshTokenRepo) Rotate(clientID, token string) (string, string, []string, error) {
+	tokenID, tokenPayload, err := parseToken(token)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	tx, err := r.begin()
+	if err != nil {
+		return "", "", nil, err
+	}
+	defer tx.Rollback()
+	exec := r.executor(tx)
+
+	record, err := r.get(tx, tokenID)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	if record.ClientID != clientID {
+		return "", "", nil, refresh.ErrorInvalidClientID
+	}
+
+	if err := checkTokenPayload(record.PayloadHash, tokenPayload); err != nil {
+		return "", "", nil, err
+	}
+
+	// A retired token is revoked along with its family even if it has
+	// expired since, as it may have been stolen.
+	if record.Retired {
+		return "", "", nil, r.revokeReused(tx, record)
+	}
+
+	if r.expired(record) {
+		return "", "", nil, refresh.ErrorInvalidToken
+	}
+
+	// Retiring the token only if it isn't already retired guards against
+	// the token being rotated concurrently.
+	q := fmt.Sprintf("UPDATE %s SET retired = $1 WHERE id = $2 AND retired = $3", r.quote(refreshTokenTableName))
+	res, err := exec.Exec(q, true, record.ID, false)
+	if err != nil {
+		return "", "", nil, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return "", "", nil, err
+	}
+	if n == 0 {
+		return "", "", nil, r.revokeReused(tx, record)
+	}
+
+	newToken, _, err := r.insert(tx, &refreshTokenModel{
+		UserID:          record.UserID,
+		ClientID:        record.ClientID,
+		Scope:           record.Scope,
+		FamilyID:        record.FamilyID,
+		FamilyCreatedAt: record.FamilyCreatedAt,
+	})
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", "", nil, err
+	}
+	return newToken, record.UserID, strings.Fields(record.Scope), nil
+}
+
+// revokeReused revokes the family of a reused retired token, commits tx and
+// returns refresh.ErrorTokenReused.
+func (r *refreshTokenRepo) revokeReused(tx repo.Transaction, record *refreshTokenModel) error {
+	log.Errorf("Retired refresh token %d of family %d reused, revoking the family", record.ID, record.FamilyID)
+	if err := r.revokeFamily(tx, record.FamilyID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return refresh.ErrorTokenReused
+}
+
+func (r *refreshTokenRepo) revokeFamily(tx repo.Transaction, familyID int64) error {
+	q := fmt.Sprintf("DELETE FROM %s WHERE family_id = $1", r.quote(refreshTokenTableName))
+	_, err := r.executor(tx).Exec(q, familyID)
+	return err
+}
+
 func (r *refreshTokenRepo) Revoke(userID, token string) error {
 	tokenID, tokenPayload, err := parseToken(token)
 	if err != nil {
@@ -155,7 +309,6 @@ func (r *refreshTokenRepo) Revoke(userID, token string) error {
 		return err
 	}
 	defer tx.Rollback()
-	exec := r.executor(tx)
 	record, err := r.get(tx, tokenID)
 	if err != nil {
 		return err
@@ -169,13 +322,9 @@ func (r *refreshTokenRepo) Revoke(userID, token string) error {
 		return err
 	}
 
-	deleted, err := exec.Delete(record)
-	if err != nil {
+	if err := r.revokeFamily(tx, record.FamilyID); err != nil {
 		return err
 	}
-	if deleted == 0 {
-		return refresh.ErrorInvalidToken
-	}
 
 	return tx.Commit()
 }
@@ -188,11 +337,11 @@ func (r *refreshTokenRepo) RevokeTokensForClient(userID, clientID string) error
 
 func (r *refreshTokenRepo) ClientsWithRefreshTokens(userID string) ([]client.Client, error) {
 	q := `SELECT c.* FROM %s as c
-	INNER JOIN %s as r ON c.id = r.client_id WHERE r.user_id = $1;`
+	INNER JOIN %s as r ON c.id = r.client_id WHERE r.user_id = $1 AND r.retired = $2;`
 	q = fmt.Sprintf(q, r.quote(clientTableName), r.quote(refreshTokenTableName))
 
 	var clients []clientModel
-	if _, err := r.executor(nil).Select(&clients, q, userID); err != nil {
+	if _, err := r.executor(nil).Select(&clients, q, userID, false); err != nil {
 		return nil, err
 	}
 
@@ -209,6 +358,43 @@ func (r *refreshTokenRepo) ClientsWithRefreshTokens(userID string) ([]client.Cli
 	return c, nil
 }
 
+// purge deletes the token families which can no longer be used: those past
+// their absolute lifetime, and those whose current token has been idle for
+// too long. Their retired tokens go with them; replaying one of those is
+// harmless once the family is gone.
+func (r *refreshTokenRepo) purge() error {
+	qt := r.quote(refreshTokenTableName)
+	now := r.clock.Now()
+
+	var n int64
+	if r.opts.AbsoluteLifetime != 0 {
+		q := fmt.Sprintf("DELETE FROM %s WHERE family_created_at < $1", qt)
+		res, err := r.executor(nil).Exec(q, now.Add(-r.opts.AbsoluteLifetime).Unix())
+		if err != nil {
+			return err
+		}
+		if c, err := res.RowsAffected(); err == nil {
+			n += c
+		}
+	}
+	if r.opts.IdleTimeout != 0 {
+		q := fmt.Sprintf("DELETE FROM %s WHERE family_id IN (SELECT family_id FROM %s WHERE retired = $1 AND created_at < $2)", qt, qt)
+		res, err := r.executor(nil).Exec(q, false, now.Add(-r.opts.IdleTimeout).Unix())
+		if err != nil {
+			return err
+		}
+		if c, err := res.RowsAffected(); err == nil {
+			n += c
+		}
+	}
+
+	gcPurgedRows.WithLabelValues(refreshTokenTableName).Add(float64(n))
+	if n != 0 {
+		log.Infof("Deleted %d stale row(s) from %s table", n, refreshTokenTableName)
+	}
+	return nil
+}
+
 func (r *refreshTokenRepo) get(tx repo.Transaction, tokenID int64) (*refreshTokenModel, error) {
 	ex := r.executor(tx)
 	result, err := ex.Get(refreshTokenModel{}, tokenID)
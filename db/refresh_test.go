@@ -3,6 +3,11 @@ package db
 import (
 	"bytes"
 	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+
+	"github.com/coreos/dex/refresh"
 )
 
 func TestBuildAndParseToken(t *testing.T) {
@@ -29,3 +34,141 @@ func TestBuildAndParseToken(t *testing.T) {
 		}
 	}
 }
+
+func TestRefreshTokenRepoLifetimes(t *testing.T) {
+	opts := refresh.RepoOptions{
+		AbsoluteLifetime: 24 * time.Hour,
+		IdleTimeout:      time.Hour,
+	}
+	gen := func() ([]byte, error) { return []byte("payload"), nil }
+
+	tests := []struct {
+		// rotations is the number of times the token is rotated, an
+		// interval apart, before it's verified after the same interval.
+		rotations int
+		interval  time.Duration
+		wantErr   error
+	}{
+		{rotations: 0, interval: 59 * time.Minute},
+		{rotations: 0, interval: 61 * time.Minute, wantErr: refresh.ErrorInvalidToken},
+		{rotations: 23, interval: 59 * time.Minute},
+		{rotations: 24, interval: 59 * time.Minute, wantErr: refresh.ErrorInvalidToken},
+	}
+
+	for i, tt := range tests {
+		clock := clockwork.NewFakeClock()
+		r := newRefreshTokenRepo(NewMemDB(), gen, opts, clock)
+
+		token, err := r.Create("user", "client", []string{"openid"})
+		if err != nil {
+			t.Fatalf("case %d: failed to create token: %v", i, err)
+		}
+		for j := 0; j < tt.rotations; j++ {
+			clock.Advance(tt.interval)
+			if token, _, _, err = r.Rotate("client", token); err != nil {
+				t.Fatalf("case %d: failed to rotate token: %v", i, err)
+			}
+		}
+
+		clock.Advance(tt.interval)
+		if _, err := r.Verify("client", token); err != tt.wantErr {
+			t.Errorf("case %d: want err=%v, got=%v", i, tt.wantErr, err)
+		}
+		if _, _, _, err := r.Rotate("client", token); err != tt.wantErr {
+			t.Errorf("case %d: want err=%v rotating, got=%v", i, tt.wantErr, err)
+		}
+	}
+}
+
+func TestRefreshTokenRepoRotateReusedAfterExpiry(t *testing.T) {
+	opts := refresh.RepoOptions{IdleTimeout: time.Hour}
+	gen := func() ([]byte, error) { return []byte("payload"), nil }
+	clock := clockwork.NewFakeClock()
+	r := newRefreshTokenRepo(NewMemDB(), gen, opts, clock)
+
+	retired, err := r.Create("user", "client", []string{"openid"})
+	if err != nil {
+		t.Fatalf("failed to create token: %v", err)
+	}
+	token, _, _, err := r.Rotate("client", retired)
+	if err != nil {
+		t.Fatalf("failed to rotate token: %v", err)
+	}
+
+	// The retired token is replayed once it would have expired anyway.
+	clock.Advance(2 * time.Hour)
+	if _, _, _, err := r.Rotate("client", retired); err != refresh.ErrorTokenReused {
+		t.Errorf("want err=%v, got=%v", refresh.ErrorTokenReused, err)
+	}
+
+	// The rest of the family is revoked.
+	tokenID, _, err := parseToken(token)
+	if err != nil {
+		t.Fatalf("failed to parse token: %v", err)
+	}
+	if _, err := r.get(nil, tokenID); err != refresh.ErrorInvalidToken {
+		t.Errorf("want err=%v getting the current token of the family, got=%v", refresh.ErrorInvalidToken, err)
+	}
+}
+
+func TestRefreshTokenRepoPurge(t *testing.T) {
+	opts := refresh.RepoOptions{
+		AbsoluteLifetime: 24 * time.Hour,
+		IdleTimeout:      time.Hour,
+	}
+	gen := func() ([]byte, error) { return []byte("payload"), nil }
+	clock := clockwork.NewFakeClock()
+	r := newRefreshTokenRepo(NewMemDB(), gen, opts, clock)
+
+	create := func(userID string) string {
+		token, err := r.Create(userID, "client", []string{"openid"})
+		if err != nil {
+			t.Fatalf("failed to create token: %v", err)
+		}
+		return token
+	}
+	rotate := func(token string) string {
+		token, _, _, err := r.Rotate("client", token)
+		if err != nil {
+			t.Fatalf("failed to rotate token: %v", err)
+		}
+		return token
+	}
+
+	// By the time of the purge, the family of old is past its absolute
+	// lifetime, the token of idle has been idle for too long, and the
+	// family of active is still in use.
+	old := create("old")
+	create("idle")
+	var active string
+	for i := 0; i < 24; i++ {
+		clock.Advance(59 * time.Minute)
+		old = rotate(old)
+		if i == 20 {
+			active = create("active")
+		} else if i > 20 {
+			active = rotate(active)
+		}
+	}
+	clock.Advance(59 * time.Minute)
+
+	if err := r.purge(); err != nil {
+		t.Fatalf("failed to purge: %v", err)
+	}
+
+	var left []refreshTokenModel
+	if _, err := r.executor(nil).Select(&left, "SELECT * FROM refresh_token"); err != nil {
+		t.Fatalf("failed to list tokens: %v", err)
+	}
+	for _, tok := range left {
+		if tok.UserID != "active" {
+			t.Errorf("want the tokens of %q purged, got token %d left", tok.UserID, tok.ID)
+		}
+	}
+	if len(left) != 4 {
+		t.Errorf("want the 4 tokens of the active family left, got %d", len(left))
+	}
+	if _, err := r.Verify("client", active); err != nil {
+		t.Errorf("want the active token valid after purging, got err=%v", err)
+	}
+}
@@ -31,19 +31,29 @@ func init() {
 }
 
 type sessionModel struct {
-	ID          string `db:"id"`
-	State       string `db:"state"`
-	CreatedAt   int64  `db:"created_at"`
-	ExpiresAt   int64  `db:"expires_at"`
-	ClientID    string `db:"client_id"`
-	ClientState string `db:"client_state"`
-	RedirectURL string `db:"redirect_url"`
-	Identity    string `db:"identity"`
-	ConnectorID string `db:"connector_id"`
-	UserID      string `db:"user_id"`
-	Register    bool   `db:"register"`
-	Nonce       string `db:"nonce"`
-	Scope       string `db:"scope"`
+	ID                  string `db:"id"`
+	State               string `db:"state"`
+	CreatedAt           int64  `db:"created_at"`
+	ExpiresAt           int64  `db:"expires_at"`
+	ClientID            string `db:"client_id"`
+	ClientState         string `db:"client_state"`
+	RedirectURL         string `db:"redirect_url"`
+	Identity            string `db:"identity"`
+	ConnectorID         string `db:"connector_id"`
+	UserID              string `db:"user_id"`
+	Register            bool   `db:"register"`
+	Nonce               string `db:"nonce"`
+	Scope               string `db:"scope"`
+	ResponseType        string `db:"response_type"`
+	CodeChallenge       string `db:"code_challenge"`
+	CodeChallengeMethod string `db:"code_challenge_method"`
+	ClaimsRequest       string `db:"claims_request"`
+	AMR                 string `db:"amr"`
+	RemoteIP            string `db:"remote_ip"`
+	AuthTime            int64  `db:"auth_time"`
+	BrowserSessionID    string `db:"browser_session_id"`
+	PromptConsent       bool   `db:"prompt_consent"`
+	RemoteGroups        string `db:"remote_groups"`
 }
 
 func (s *sessionModel) session() (*session.Session, error) {
@@ -62,18 +72,41 @@ func (s *sessionModel) session() (*session.Session, error) {
 		ident.ExpiresAt = time.Time{}
 	}
 
+	var cr session.ClaimsRequest
+	if s.ClaimsRequest != "" {
+		if err = json.Unmarshal([]byte(s.ClaimsRequest), &cr); err != nil {
+			return nil, err
+		}
+	}
+
+	var groups []string
+	if s.RemoteGroups != "" {
+		if err = json.Unmarshal([]byte(s.RemoteGroups), &groups); err != nil {
+			return nil, err
+		}
+	}
+
 	ses := session.Session{
-		ID:          s.ID,
-		State:       session.SessionState(s.State),
-		ClientID:    s.ClientID,
-		ClientState: s.ClientState,
-		RedirectURL: *ru,
-		Identity:    ident,
-		ConnectorID: s.ConnectorID,
-		UserID:      s.UserID,
-		Register:    s.Register,
-		Nonce:       s.Nonce,
-		Scope:       strings.Fields(s.Scope),
+		ID:                  s.ID,
+		State:               session.SessionState(s.State),
+		ClientID:            s.ClientID,
+		ClientState:         s.ClientState,
+		RedirectURL:         *ru,
+		Identity:            ident,
+		Groups:              groups,
+		ConnectorID:         s.ConnectorID,
+		UserID:              s.UserID,
+		Register:            s.Register,
+		Nonce:               s.Nonce,
+		Scope:               strings.Fields(s.Scope),
+		ResponseType:        s.ResponseType,
+		CodeChallenge:       s.CodeChallenge,
+		CodeChallengeMethod: s.CodeChallengeMethod,
+		ClaimsRequest:       cr,
+		AMR:                 strings.Fields(s.AMR),
+		RemoteIP:            s.RemoteIP,
+		BrowserSessionID:    s.BrowserSessionID,
+		PromptConsent:       s.PromptConsent,
 	}
 
 	if s.CreatedAt != 0 {
@@ -84,6 +117,10 @@ func (s *sessionModel) session() (*session.Session, error) {
 		ses.ExpiresAt = time.Unix(s.ExpiresAt, 0).UTC()
 	}
 
+	if s.AuthTime != 0 {
+		ses.AuthTime = time.Unix(s.AuthTime, 0).UTC()
+	}
+
 	return &ses, nil
 }
 
@@ -93,18 +130,39 @@ func newSessionModel(s *session.Session) (*sessionModel, error) {
 		return nil, err
 	}
 
+	cr, err := json.Marshal(s.ClaimsRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []byte
+	if s.Groups != nil {
+		if groups, err = json.Marshal(s.Groups); err != nil {
+			return nil, err
+		}
+	}
+
 	sm := sessionModel{
-		ID:          s.ID,
-		State:       string(s.State),
-		ClientID:    s.ClientID,
-		ClientState: s.ClientState,
-		RedirectURL: s.RedirectURL.String(),
-		Identity:    string(b),
-		ConnectorID: s.ConnectorID,
-		UserID:      s.UserID,
-		Register:    s.Register,
-		Nonce:       s.Nonce,
-		Scope:       strings.Join(s.Scope, " "),
+		ID:                  s.ID,
+		State:               string(s.State),
+		ClientID:            s.ClientID,
+		ClientState:         s.ClientState,
+		RedirectURL:         s.RedirectURL.String(),
+		Identity:            string(b),
+		ConnectorID:         s.ConnectorID,
+		UserID:              s.UserID,
+		Register:            s.Register,
+		Nonce:               s.Nonce,
+		Scope:               strings.Join(s.Scope, " "),
+		ResponseType:        s.ResponseType,
+		CodeChallenge:       s.CodeChallenge,
+		CodeChallengeMethod: s.CodeChallengeMethod,
+		ClaimsRequest:       string(cr),
+		AMR:                 strings.Join(s.AMR, " "),
+		RemoteIP:            s.RemoteIP,
+		BrowserSessionID:    s.BrowserSessionID,
+		PromptConsent:       s.PromptConsent,
+		RemoteGroups:        string(groups),
 	}
 
 	if !s.CreatedAt.IsZero() {
@@ -115,6 +173,10 @@ func newSessionModel(s *session.Session) (*sessionModel, error) {
 		sm.ExpiresAt = s.ExpiresAt.Unix()
 	}
 
+	if !s.AuthTime.IsZero() {
+		sm.AuthTime = s.AuthTime.Unix()
+	}
+
 	return &sm, nil
 }
 
@@ -191,6 +253,7 @@ func (r *SessionRepo) purge() error {
 
 	d := "unknown # of"
 	if n, err := res.RowsAffected(); err == nil {
+		gcPurgedRows.WithLabelValues(sessionTableName).Add(float64(n))
 		if n == 0 {
 			return nil
 		}
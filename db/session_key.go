@@ -56,24 +56,40 @@ func (r *SessionKeyRepo) Push(sk session.SessionKey, exp time.Duration) error {
 	return r.executor(nil).Insert(skm)
 }
 
-func (r *SessionKeyRepo) Pop(key string) (string, error) {
+func (r *SessionKeyRepo) get(key string) (*sessionKeyModel, error) {
 	m, err := r.executor(nil).Get(sessionKeyModel{}, key)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	if m == nil {
-		return "", errors.New("session key does not exist")
+		return nil, errors.New("session key does not exist")
 	}
 
 	skm, ok := m.(*sessionKeyModel)
 	if !ok {
 		log.Errorf("expected sessionKeyModel but found %v", reflect.TypeOf(m))
-		return "", errors.New("unrecognized model")
+		return nil, errors.New("unrecognized model")
 	}
 
 	if skm.Stale || skm.ExpiresAt < r.clock.Now().Unix() {
-		return "", errors.New("invalid session key")
+		return nil, errors.New("invalid session key")
+	}
+	return skm, nil
+}
+
+func (r *SessionKeyRepo) Peek(key string) (string, error) {
+	skm, err := r.get(key)
+	if err != nil {
+		return "", err
+	}
+	return skm.SessionID, nil
+}
+
+func (r *SessionKeyRepo) Pop(key string) (string, error) {
+	skm, err := r.get(key)
+	if err != nil {
+		return "", err
 	}
 
 	qt := r.quote(sessionKeyTableName)
@@ -103,6 +119,7 @@ func (r *SessionKeyRepo) purge() error {
 
 	d := "unknown # of"
 	if n, err := res.RowsAffected(); err == nil {
+		gcPurgedRows.WithLabelValues(sessionKeyTableName).Add(float64(n))
 		if n == 0 {
 			return nil
 		}
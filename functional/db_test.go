@@ -444,7 +444,7 @@ func TestDBRefreshRepoCreate(t *testing.T) {
 	}
 
 	for i, tt := range tests {
-		token, err := r.Create(tt.userID, tt.clientID)
+		token, err := r.Create(tt.userID, tt.clientID, []string{"openid"})
 		if err != nil {
 			if tt.err == nil {
 				t.Errorf("case %d: create failed: %v", i, err)
@@ -469,7 +469,7 @@ func TestDBRefreshRepoCreate(t *testing.T) {
 func TestDBRefreshRepoVerify(t *testing.T) {
 	r := db.NewRefreshTokenRepo(connect(t))
 
-	token, err := r.Create("user-foo", "client-foo")
+	token, err := r.Create("user-foo", "client-foo", []string{"openid"})
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
@@ -553,7 +553,7 @@ func TestDBRefreshRepoVerify(t *testing.T) {
 func TestDBRefreshRepoRevoke(t *testing.T) {
 	r := db.NewRefreshTokenRepo(connect(t))
 
-	token, err := r.Create("user-foo", "client-foo")
+	token, err := r.Create("user-foo", "client-foo", []string{"openid"})
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
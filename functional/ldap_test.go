@@ -4,14 +4,19 @@ import (
 	"fmt"
 	"html/template"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
+	"reflect"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/coreos/dex/connector"
+	"github.com/coreos/go-oidc/oidc"
 	"golang.org/x/net/context"
 	"gopkg.in/ldap.v2"
 )
@@ -180,3 +185,215 @@ func TestLDAPPoolHighWatermarkAndLockContention(t *testing.T) {
 		t.Errorf("expected %v connections, got alive=%v killed=%v", ldapPool.MaxIdleConn, alive, killed)
 	}
 }
+
+type ldapEntry struct {
+	dn    string
+	attrs map[string][]string
+}
+
+var ldapGroupEntries = []ldapEntry{
+	{"ou=People,dc=example,dc=org", map[string][]string{
+		"objectClass": {"organizationalUnit"},
+		"ou":          {"People"},
+	}},
+	{"uid=jane,ou=People,dc=example,dc=org", map[string][]string{
+		"objectClass":  {"inetOrgPerson"},
+		"uid":          {"jane"},
+		"cn":           {"Jane Doe"},
+		"sn":           {"Doe"},
+		"mail":         {"jane@example.org"},
+		"userPassword": {"janespassword"},
+	}},
+	{"ou=Groups,dc=example,dc=org", map[string][]string{
+		"objectClass": {"organizationalUnit"},
+		"ou":          {"Groups"},
+	}},
+	{"cn=developers,ou=Groups,dc=example,dc=org", map[string][]string{
+		"objectClass": {"groupOfNames"},
+		"cn":          {"developers"},
+		"member":      {"uid=jane,ou=People,dc=example,dc=org"},
+	}},
+	{"cn=engineering,ou=Groups,dc=example,dc=org", map[string][]string{
+		"objectClass": {"groupOfNames"},
+		"cn":          {"engineering"},
+		"member":      {"cn=developers,ou=Groups,dc=example,dc=org"},
+	}},
+	{"cn=admins,ou=Groups,dc=example,dc=org", map[string][]string{
+		"objectClass": {"groupOfNames"},
+		"cn":          {"admins"},
+		"member":      {"cn=admin,dc=example,dc=org"},
+	}},
+}
+
+// setupLDAPGroups adds a user and the groups it's a member of to the
+// directory, and returns a function which removes them again.
+func setupLDAPGroups(t *testing.T, server LDAPServer) func() {
+	l, err := ldap.Dial("tcp", fmt.Sprintf("%s:%d", server.Host, server.Port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = l.Bind(server.BindDN, server.BindPw); err != nil {
+		t.Fatal(err)
+	}
+
+	cleanup := func() {
+		for i := len(ldapGroupEntries) - 1; i >= 0; i-- {
+			l.Del(ldap.NewDelRequest(ldapGroupEntries[i].dn, nil))
+		}
+	}
+	// Remove leftovers of earlier runs.
+	cleanup()
+
+	for _, e := range ldapGroupEntries {
+		req := ldap.NewAddRequest(e.dn)
+		for attr, vals := range e.attrs {
+			req.Attribute(attr, vals)
+		}
+		if err := l.Add(req); err != nil {
+			cleanup()
+			l.Close()
+			t.Fatalf("failed to add %s: %v", e.dn, err)
+		}
+	}
+	return func() {
+		cleanup()
+		l.Close()
+	}
+}
+
+func TestConnectorLDAPGroups(t *testing.T) {
+	server := ldapServer(t)
+	defer setupLDAPGroups(t, server)()
+
+	tests := []struct {
+		config     connector.LDAPConnectorConfig
+		wantGroups []string
+	}{
+		{
+			config: connector.LDAPConnectorConfig{
+				GroupSearchBaseDN: "ou=Groups,dc=example,dc=org",
+			},
+			wantGroups: []string{"developers"},
+		},
+		{
+			config: connector.LDAPConnectorConfig{
+				GroupSearchBaseDN: "ou=Groups,dc=example,dc=org",
+				NestedGroups:      true,
+			},
+			wantGroups: []string{"developers", "engineering"},
+		},
+		{
+			config: connector.LDAPConnectorConfig{
+				GroupSearchBaseDN: "ou=Groups,dc=example,dc=org",
+				GroupSearchFilter: "(cn=eng*)",
+				NestedGroups:      true,
+			},
+			wantGroups: nil,
+		},
+	}
+	for i, tt := range tests {
+		tt.config.ID = "ldap"
+		tt.config.ServerHost = server.Host
+		tt.config.ServerPort = server.Port
+		tt.config.BaseDN = "ou=People,dc=example,dc=org"
+		tt.config.SearchBindDN = server.BindDN
+		tt.config.SearchBindPw = server.BindPw
+
+		var loggedIn bool
+		var groups []string
+		lf := func(ident oidc.Identity, g []string, sessionKey string) (string, error) {
+			loggedIn, groups = true, g
+			return "http://client.example.com/callback", nil
+		}
+		templates := template.New(connector.LDAPLoginPageTemplateName)
+		c, err := tt.config.Connector(url.URL{Path: "/auth/ldap"}, lf, templates)
+		if err != nil {
+			t.Errorf("case %d: failed to create connector: %v", i, err)
+			continue
+		}
+		mux := http.NewServeMux()
+		c.Register(mux, url.URL{})
+
+		form := url.Values{
+			"userid":      {"jane"},
+			"password":    {"janespassword"},
+			"session_key": {"key"},
+		}
+		r, err := http.NewRequest("POST", "/auth/ldap/callback/login", strings.NewReader(form.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		mux.ServeHTTP(httptest.NewRecorder(), r)
+
+		if !loggedIn {
+			t.Errorf("case %d: want login", i)
+			continue
+		}
+		if !reflect.DeepEqual(tt.wantGroups, groups) {
+			t.Errorf("case %d: want groups %v, got %v", i, tt.wantGroups, groups)
+		}
+	}
+}
+
+func TestConnectorLDAPRequiredGroups(t *testing.T) {
+	server := ldapServer(t)
+	defer setupLDAPGroups(t, server)()
+
+	tests := []struct {
+		requiredGroups []string
+		wantLogin      bool
+	}{
+		{
+			requiredGroups: []string{"admins"},
+			wantLogin:      false,
+		},
+		{
+			requiredGroups: []string{"admins", "engineering"},
+			wantLogin:      true,
+		},
+	}
+	for i, tt := range tests {
+		var loggedIn bool
+		lf := func(ident oidc.Identity, groups []string, sessionKey string) (string, error) {
+			loggedIn = true
+			return "http://client.example.com/callback", nil
+		}
+
+		config := connector.LDAPConnectorConfig{
+			ID:                "ldap",
+			ServerHost:        server.Host,
+			ServerPort:        server.Port,
+			BaseDN:            "ou=People,dc=example,dc=org",
+			SearchBindDN:      server.BindDN,
+			SearchBindPw:      server.BindPw,
+			GroupSearchBaseDN: "ou=Groups,dc=example,dc=org",
+			NestedGroups:      true,
+			RequiredGroups:    tt.requiredGroups,
+		}
+		templates := template.New(connector.LDAPLoginPageTemplateName)
+		c, err := config.Connector(url.URL{Path: "/auth/ldap"}, lf, templates)
+		if err != nil {
+			t.Errorf("case %d: failed to create connector: %v", i, err)
+			continue
+		}
+		mux := http.NewServeMux()
+		c.Register(mux, url.URL{})
+
+		form := url.Values{
+			"userid":      {"jane"},
+			"password":    {"janespassword"},
+			"session_key": {"key"},
+		}
+		r, err := http.NewRequest("POST", "/auth/ldap/callback/login", strings.NewReader(form.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		mux.ServeHTTP(httptest.NewRecorder(), r)
+
+		if loggedIn != tt.wantLogin {
+			t.Errorf("case %d: want login=%v, got=%v", i, tt.wantLogin, loggedIn)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package repo
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-gorp/gorp"
+	"github.com/kylelemons/godebug/pretty"
+
+	"github.com/coreos/dex/access"
+	"github.com/coreos/dex/db"
+)
+
+func newAccessTokenRepo(t *testing.T) access.AccessTokenRepo {
+	var dbMap *gorp.DbMap
+	if dsn := os.Getenv("DEX_TEST_DSN"); dsn == "" {
+		dbMap = db.NewMemDB()
+	} else {
+		dbMap = connect(t)
+	}
+	return db.NewAccessTokenRepo(dbMap)
+}
+
+func TestAccessTokenRepoCreateGet(t *testing.T) {
+	now := time.Now().Truncate(time.Second).UTC()
+	tests := []struct {
+		at      access.AccessToken
+		wantErr error
+	}{
+		{
+			at: access.AccessToken{
+				UserID:    "user1",
+				ClientID:  "client1",
+				Scope:     []string{"openid", "email"},
+				Audience:  "https://api.example.com",
+				CreatedAt: now,
+				ExpiresAt: now.Add(time.Hour),
+			},
+		},
+		{
+			at: access.AccessToken{
+				ClientID:  "client1",
+				CreatedAt: now,
+				ExpiresAt: now.Add(time.Hour),
+			},
+			wantErr: access.ErrorInvalidUserID,
+		},
+		{
+			at: access.AccessToken{
+				UserID:    "user1",
+				CreatedAt: now,
+				ExpiresAt: now.Add(time.Hour),
+			},
+			wantErr: access.ErrorInvalidClientID,
+		},
+	}
+
+	for i, tt := range tests {
+		repo := newAccessTokenRepo(t)
+		token, err := repo.Create(tt.at)
+		if err != tt.wantErr {
+			t.Errorf("case %d: want err=%v, got=%v", i, tt.wantErr, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		got, err := repo.Get(token)
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if diff := pretty.Compare(tt.at, got); diff != "" {
+			t.Errorf("case %d: Compare(want, got) = %v", i, diff)
+		}
+	}
+}
+
+func TestAccessTokenRepoGetInvalid(t *testing.T) {
+	now := time.Now()
+	repo := newAccessTokenRepo(t)
+
+	expired, err := repo.Create(access.AccessToken{
+		UserID:    "user1",
+		ClientID:  "client1",
+		CreatedAt: now.Add(-2 * time.Hour),
+		ExpiresAt: now.Add(-time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for i, token := range []string{"", "bogus", expired} {
+		if _, err := repo.Get(token); err != access.ErrorInvalidToken {
+			t.Errorf("case %d: want err=%v, got=%v", i, access.ErrorInvalidToken, err)
+		}
+	}
+}
+
+func TestAccessTokenRepoRevoke(t *testing.T) {
+	now := time.Now()
+	repo := newAccessTokenRepo(t)
+
+	token, err := repo.Create(access.AccessToken{
+		UserID:    "user1",
+		ClientID:  "client1",
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := repo.Revoke(token); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := repo.Get(token); err != access.ErrorInvalidToken {
+		t.Errorf("Want err=%v after revoking the token, got=%v", access.ErrorInvalidToken, err)
+	}
+	if err := repo.Revoke(token); err != access.ErrorInvalidToken {
+		t.Errorf("Want err=%v when revoking the token twice, got=%v", access.ErrorInvalidToken, err)
+	}
+}
@@ -0,0 +1,130 @@
+package repo
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-gorp/gorp"
+	"github.com/kylelemons/godebug/pretty"
+
+	"github.com/coreos/dex/audit"
+	"github.com/coreos/dex/db"
+)
+
+var testAuditEvents = []audit.Event{
+	{
+		ID:          "event-1",
+		Type:        audit.EventLoginFailed,
+		Time:        time.Unix(1460000000, 0).UTC(),
+		ConnectorID: "local",
+		IP:          "10.0.0.1",
+		Details:     map[string]string{"account": "elroy@example.com"},
+	},
+	{
+		ID:          "event-2",
+		Type:        audit.EventLoginSucceeded,
+		Time:        time.Unix(1460000001, 0).UTC(),
+		UserID:      "elroy",
+		ClientID:    "XXX",
+		ConnectorID: "local",
+		IP:          "10.0.0.1",
+	},
+	{
+		ID:       "event-3",
+		Type:     audit.EventTokenIssued,
+		Time:     time.Unix(1460000002, 0).UTC(),
+		UserID:   "elroy",
+		ClientID: "XXX",
+		Details:  map[string]string{"grant_type": "authorization_code"},
+	},
+	{
+		ID:       "event-4",
+		Type:     audit.EventAdminClientDeleted,
+		Time:     time.Unix(1460000003, 0).UTC(),
+		ClientID: "XXX",
+	},
+}
+
+func newAuditEventRepo(t *testing.T) audit.EventRepo {
+	var dbMap *gorp.DbMap
+	if dsn := os.Getenv("DEX_TEST_DSN"); dsn == "" {
+		dbMap = db.NewMemDB()
+	} else {
+		dbMap = connect(t)
+	}
+	repo := db.NewAuditEventRepo(dbMap)
+	for _, e := range testAuditEvents {
+		if err := repo.Write(e); err != nil {
+			t.Fatalf("Unable to write audit event: %v", err)
+		}
+	}
+	return repo
+}
+
+func TestAuditEventRepoList(t *testing.T) {
+	tests := []struct {
+		filter audit.EventFilter
+		want   []audit.Event
+	}{
+		{
+			filter: audit.EventFilter{},
+			want:   []audit.Event{testAuditEvents[3], testAuditEvents[2], testAuditEvents[1], testAuditEvents[0]},
+		},
+		{
+			filter: audit.EventFilter{UserID: "elroy"},
+			want:   []audit.Event{testAuditEvents[2], testAuditEvents[1]},
+		},
+		{
+			filter: audit.EventFilter{Type: audit.EventLoginFailed},
+			want:   []audit.Event{testAuditEvents[0]},
+		},
+		{
+			filter: audit.EventFilter{UserID: "elroy", ClientID: "XXX", Type: audit.EventTokenIssued},
+			want:   []audit.Event{testAuditEvents[2]},
+		},
+		{
+			filter: audit.EventFilter{UserID: "nobody"},
+			want:   []audit.Event{},
+		},
+	}
+
+	for i, tt := range tests {
+		repo := newAuditEventRepo(t)
+		got, tok, err := repo.List(tt.filter, 10, "")
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if tok != "" {
+			t.Errorf("case %d: want empty nextPageToken, got %q", i, tok)
+		}
+		if diff := pretty.Compare(tt.want, got); diff != "" {
+			t.Errorf("case %d: Compare(want, got) = %v", i, diff)
+		}
+	}
+}
+
+func TestAuditEventRepoListPages(t *testing.T) {
+	repo := newAuditEventRepo(t)
+	want := [][]audit.Event{
+		{testAuditEvents[3], testAuditEvents[2], testAuditEvents[1]},
+		{testAuditEvents[0]},
+	}
+
+	var tok string
+	for i := range want {
+		var got []audit.Event
+		var err error
+		got, tok, err = repo.List(audit.EventFilter{}, 3, tok)
+		if err != nil {
+			t.Fatalf("page %d: unexpected error: %v", i, err)
+		}
+		if diff := pretty.Compare(want[i], got); diff != "" {
+			t.Errorf("page %d: Compare(want, got) = %v", i, diff)
+		}
+		if last := i == len(want)-1; last != (tok == "") {
+			t.Errorf("page %d: want last=%t, got nextPageToken %q", i, last, tok)
+		}
+	}
+}
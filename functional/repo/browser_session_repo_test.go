@@ -0,0 +1,93 @@
+package repo
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-gorp/gorp"
+	"github.com/jonboulle/clockwork"
+	"github.com/kylelemons/godebug/pretty"
+
+	"github.com/coreos/dex/db"
+	"github.com/coreos/dex/session"
+	"github.com/coreos/go-oidc/oidc"
+)
+
+var (
+	testBrowserSessionNow = time.Unix(1460000000, 0).UTC()
+
+	testBrowserSessions = []session.BrowserSession{
+		{
+			ID:          "browser-session-1",
+			ConnectorID: "local",
+			Identity:    oidc.Identity{ID: "elroy", Name: "Elroy", Email: "elroy@example.com"},
+			UserID:      "ID-1",
+			AuthTime:    time.Unix(1459990000, 0).UTC(),
+			ExpiresAt:   time.Unix(1460010000, 0).UTC(),
+			AMR:         []string{"pwd", "mfa"},
+		},
+		{
+			ID:          "browser-session-2",
+			ConnectorID: "oidc",
+			Identity:    oidc.Identity{ID: "judy"},
+			UserID:      "ID-2",
+			AuthTime:    time.Unix(1459900000, 0).UTC(),
+			ExpiresAt:   time.Unix(1459990000, 0).UTC(),
+		},
+	}
+)
+
+func newBrowserSessionRepo(t *testing.T) session.BrowserSessionRepo {
+	var dbMap *gorp.DbMap
+	if dsn := os.Getenv("DEX_TEST_DSN"); dsn == "" {
+		dbMap = db.NewMemDB()
+	} else {
+		dbMap = connect(t)
+	}
+	clock := clockwork.NewFakeClock()
+	clock.Advance(testBrowserSessionNow.Sub(clock.Now()))
+	repo := db.NewBrowserSessionRepoWithClock(dbMap, clock)
+	for _, bs := range testBrowserSessions {
+		if err := repo.Create(bs); err != nil {
+			t.Fatalf("Unable to create browser session: %v", err)
+		}
+	}
+	return repo
+}
+
+func TestBrowserSessionRepoGet(t *testing.T) {
+	repo := newBrowserSessionRepo(t)
+
+	got, err := repo.Get(testBrowserSessions[0].ID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := pretty.Compare(testBrowserSessions[0], *got); diff != "" {
+		t.Errorf("Compare(want, got) = %v", diff)
+	}
+
+	// expired
+	if _, err := repo.Get(testBrowserSessions[1].ID); err != session.ErrorBrowserSessionNotFound {
+		t.Errorf("want %v, got %v", session.ErrorBrowserSessionNotFound, err)
+	}
+
+	if _, err := repo.Get("nonexistent"); err != session.ErrorBrowserSessionNotFound {
+		t.Errorf("want %v, got %v", session.ErrorBrowserSessionNotFound, err)
+	}
+}
+
+func TestBrowserSessionRepoDelete(t *testing.T) {
+	repo := newBrowserSessionRepo(t)
+
+	id := testBrowserSessions[0].ID
+	if err := repo.Delete(id); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := repo.Get(id); err != session.ErrorBrowserSessionNotFound {
+		t.Errorf("want %v, got %v", session.ErrorBrowserSessionNotFound, err)
+	}
+	if err := repo.Delete(id); err != session.ErrorBrowserSessionNotFound {
+		t.Errorf("want %v, got %v", session.ErrorBrowserSessionNotFound, err)
+	}
+}
@@ -0,0 +1,86 @@
+package repo
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-gorp/gorp"
+	"github.com/kylelemons/godebug/pretty"
+
+	"github.com/coreos/dex/consent"
+	"github.com/coreos/dex/db"
+)
+
+var testGrant = consent.Grant{
+	UserID:    "ID-1",
+	ClientID:  "client1",
+	Scope:     []string{"openid", "email"},
+	CreatedAt: time.Unix(1460000000, 0).UTC(),
+	UpdatedAt: time.Unix(1460000000, 0).UTC(),
+}
+
+func newConsentGrantRepo(t *testing.T) consent.GrantRepo {
+	var dbMap *gorp.DbMap
+	if dsn := os.Getenv("DEX_TEST_DSN"); dsn == "" {
+		dbMap = db.NewMemDB()
+	} else {
+		dbMap = connect(t)
+	}
+	return db.NewConsentGrantRepo(dbMap)
+}
+
+func TestConsentGrantRepoSetGet(t *testing.T) {
+	repo := newConsentGrantRepo(t)
+
+	if _, err := repo.Get(testGrant.UserID, testGrant.ClientID); err != consent.ErrorNotFound {
+		t.Errorf("want err=%v, got=%v", consent.ErrorNotFound, err)
+	}
+
+	if err := repo.Set(testGrant); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got, err := repo.Get(testGrant.UserID, testGrant.ClientID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := pretty.Compare(testGrant, *got); diff != "" {
+		t.Errorf("Compare(want, got) = %v", diff)
+	}
+
+	updated := testGrant
+	updated.Scope = []string{"openid", "email", "groups"}
+	updated.UpdatedAt = time.Unix(1460001000, 0).UTC()
+	if err := repo.Set(updated); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got, err = repo.Get(testGrant.UserID, testGrant.ClientID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := pretty.Compare(updated, *got); diff != "" {
+		t.Errorf("Compare(want, got) = %v", diff)
+	}
+
+	// Grants to other clients are separate.
+	if _, err := repo.Get(testGrant.UserID, "client2"); err != consent.ErrorNotFound {
+		t.Errorf("want err=%v, got=%v", consent.ErrorNotFound, err)
+	}
+}
+
+func TestConsentGrantRepoDelete(t *testing.T) {
+	repo := newConsentGrantRepo(t)
+	if err := repo.Set(testGrant); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := repo.Delete(testGrant.UserID, testGrant.ClientID); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := repo.Get(testGrant.UserID, testGrant.ClientID); err != consent.ErrorNotFound {
+		t.Errorf("want err=%v, got=%v", consent.ErrorNotFound, err)
+	}
+	if err := repo.Delete(testGrant.UserID, testGrant.ClientID); err != consent.ErrorNotFound {
+		t.Errorf("want err=%v, got=%v", consent.ErrorNotFound, err)
+	}
+}
@@ -0,0 +1,160 @@
+package repo
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-gorp/gorp"
+	"github.com/kylelemons/godebug/pretty"
+
+	"github.com/coreos/dex/db"
+	"github.com/coreos/dex/user"
+)
+
+var testGroups = []user.Group{
+	{
+		ID:        "group-1",
+		Name:      "admins",
+		CreatedAt: time.Unix(1460000000, 0).UTC(),
+	},
+	{
+		ID:        "group-2",
+		Name:      "developers",
+		CreatedAt: time.Unix(1460000000, 0).UTC(),
+	},
+}
+
+func newGroupRepo(t *testing.T) user.GroupRepo {
+	var dbMap *gorp.DbMap
+	if dsn := os.Getenv("DEX_TEST_DSN"); dsn == "" {
+		dbMap = db.NewMemDB()
+	} else {
+		dbMap = connect(t)
+	}
+	repo := db.NewGroupRepo(dbMap)
+	for _, g := range testGroups {
+		if err := repo.Create(nil, g); err != nil {
+			t.Fatalf("Unable to create group: %v", err)
+		}
+	}
+	return repo
+}
+
+func TestGroupRepoCreate(t *testing.T) {
+	tests := []struct {
+		group   user.Group
+		wantErr error
+	}{
+		{
+			group: user.Group{
+				ID:        "group-3",
+				Name:      "operators",
+				CreatedAt: time.Unix(1460000000, 0).UTC(),
+			},
+		},
+		{
+			group: user.Group{
+				ID:   "group-3",
+				Name: "admins",
+			},
+			wantErr: user.ErrorDuplicateGroupName,
+		},
+		{
+			group: user.Group{
+				Name: "operators",
+			},
+			wantErr: user.ErrorInvalidID,
+		},
+		{
+			group: user.Group{
+				ID: "group-3",
+			},
+			wantErr: user.ErrorInvalidGroupName,
+		},
+	}
+
+	for i, tt := range tests {
+		repo := newGroupRepo(t)
+		err := repo.Create(nil, tt.group)
+		if err != tt.wantErr {
+			t.Errorf("case %d: want err=%v, got=%v", i, tt.wantErr, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		got, err := repo.GetByName(nil, tt.group.Name)
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if diff := pretty.Compare(tt.group, got); diff != "" {
+			t.Errorf("case %d: Compare(want, got) = %v", i, diff)
+		}
+	}
+}
+
+func TestGroupRepoMembers(t *testing.T) {
+	repo := newGroupRepo(t)
+
+	members := []struct {
+		groupID, userID, connectorID string
+	}{
+		{"group-1", "user-1", ""},
+		{"group-2", "user-1", "ldap"},
+		{"group-2", "user-1", ""},
+		{"group-2", "user-2", "ldap"},
+	}
+	for _, m := range members {
+		if err := repo.AddMember(nil, m.groupID, m.userID, m.connectorID); err != nil {
+			t.Fatalf("Unable to add member: %v", err)
+		}
+	}
+
+	if err := repo.AddMember(nil, "group-3", "user-1", ""); err != user.ErrorGroupNotFound {
+		t.Errorf("want err=%v, got=%v", user.ErrorGroupNotFound, err)
+	}
+
+	gotMembers, err := repo.GetMembers(nil, "group-2")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := pretty.Compare([]string{"user-1", "user-2"}, gotMembers); diff != "" {
+		t.Errorf("Compare(want, got) = %v", diff)
+	}
+
+	// Replace user-1's groups from ldap; the admin managed memberships stay.
+	if err := repo.SetConnectorGroups(nil, "user-1", "ldap", []string{"group-1"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := repo.RemoveMember(nil, "group-2", "user-1", ""); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := repo.RemoveMember(nil, "group-2", "user-1", ""); err != user.ErrorNotGroupMember {
+		t.Errorf("want err=%v, got=%v", user.ErrorNotGroupMember, err)
+	}
+
+	groups, err := repo.GetGroupsForUser(nil, "user-1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := pretty.Compare([]string{"admins"}, user.GroupNames(groups)); diff != "" {
+		t.Errorf("Compare(want, got) = %v", diff)
+	}
+
+	if err := repo.Delete(nil, "group-2"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	groups, err = repo.GetGroupsForUser(nil, "user-2")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(groups) != 0 {
+		t.Errorf("want no groups for deleted group's member, got %v", groups)
+	}
+	if _, err := repo.GetMembers(nil, "group-2"); err != user.ErrorGroupNotFound {
+		t.Errorf("want err=%v, got=%v", user.ErrorGroupNotFound, err)
+	}
+}
@@ -0,0 +1,140 @@
+package repo
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-gorp/gorp"
+	"github.com/kylelemons/godebug/pretty"
+
+	"github.com/coreos/dex/client"
+	"github.com/coreos/dex/db"
+)
+
+func newInitialAccessTokenRepo(t *testing.T) client.InitialAccessTokenRepo {
+	var dbMap *gorp.DbMap
+	if dsn := os.Getenv("DEX_TEST_DSN"); dsn == "" {
+		dbMap = db.NewMemDB()
+	} else {
+		dbMap = connect(t)
+	}
+	return db.NewInitialAccessTokenRepo(dbMap)
+}
+
+func TestInitialAccessTokenRepoCreateAll(t *testing.T) {
+	now := time.Now().Truncate(time.Second).UTC()
+	repo := newInitialAccessTokenRepo(t)
+
+	want := []client.InitialAccessToken{
+		{CreatedAt: now.Add(-time.Minute), ExpiresAt: now.Add(time.Hour), MaxUses: 1},
+		{CreatedAt: now, ExpiresAt: now.Add(24 * time.Hour)},
+	}
+	tokens := map[string]bool{}
+	for i := range want {
+		token, id, err := repo.Create(want[i])
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		if token == "" || id == "" || id == token {
+			t.Fatalf("case %d: want distinct token and ID, got token=%q id=%q", i, token, id)
+		}
+		if tokens[token] {
+			t.Fatalf("case %d: token %q issued twice", i, token)
+		}
+		tokens[token] = true
+		want[i].ID = id
+	}
+
+	got, err := repo.All()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff := pretty.Compare(want, got); diff != "" {
+		t.Errorf("Compare(want, got) = %v", diff)
+	}
+
+	if _, _, err := repo.Create(client.InitialAccessToken{ExpiresAt: now.Add(time.Hour), MaxUses: -1}); err == nil {
+		t.Errorf("want non-nil error for negative maximum uses")
+	}
+}
+
+func TestInitialAccessTokenRepoUse(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		iat      client.InitialAccessToken
+		wantUses int
+	}{
+		{
+			iat:      client.InitialAccessToken{CreatedAt: now, ExpiresAt: now.Add(time.Hour), MaxUses: 2},
+			wantUses: 2,
+		},
+		{
+			// Tokens without maximum uses keep working.
+			iat:      client.InitialAccessToken{CreatedAt: now, ExpiresAt: now.Add(time.Hour)},
+			wantUses: 3,
+		},
+		{
+			iat:      client.InitialAccessToken{CreatedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour)},
+			wantUses: 0,
+		},
+	}
+
+	for i, tt := range tests {
+		repo := newInitialAccessTokenRepo(t)
+		token, _, err := repo.Create(tt.iat)
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+
+		var uses int
+		for j := 0; j < 3; j++ {
+			err := repo.Use(token)
+			if err == client.ErrorInvalidInitialAccessToken {
+				break
+			}
+			if err != nil {
+				t.Fatalf("case %d: unexpected error: %v", i, err)
+			}
+			uses++
+		}
+		if uses != tt.wantUses {
+			t.Errorf("case %d: want %d uses, got %d", i, tt.wantUses, uses)
+		}
+
+		iats, err := repo.All()
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		if iats[0].Uses != tt.wantUses {
+			t.Errorf("case %d: want recorded uses=%d, got=%d", i, tt.wantUses, iats[0].Uses)
+		}
+	}
+
+	repo := newInitialAccessTokenRepo(t)
+	for _, token := range []string{"", "unknown"} {
+		if err := repo.Use(token); err != client.ErrorInvalidInitialAccessToken {
+			t.Errorf("token %q: want err=%v, got=%v", token, client.ErrorInvalidInitialAccessToken, err)
+		}
+	}
+}
+
+func TestInitialAccessTokenRepoDelete(t *testing.T) {
+	now := time.Now()
+	repo := newInitialAccessTokenRepo(t)
+	token, id, err := repo.Create(client.InitialAccessToken{CreatedAt: now, ExpiresAt: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := repo.Delete(id); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := repo.Use(token); err != client.ErrorInvalidInitialAccessToken {
+		t.Errorf("want err=%v, got=%v", client.ErrorInvalidInitialAccessToken, err)
+	}
+	if err := repo.Delete(id); err != client.ErrorNotFound {
+		t.Errorf("want err=%v, got=%v", client.ErrorNotFound, err)
+	}
+}
@@ -0,0 +1,130 @@
+package repo
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-gorp/gorp"
+	"github.com/kylelemons/godebug/pretty"
+
+	"github.com/coreos/dex/db"
+	"github.com/coreos/dex/lockout"
+)
+
+var (
+	testLockedUntil = time.Unix(1460003600, 0).UTC()
+
+	testAttempts = []lockout.Attempts{
+		{
+			ID:            lockout.AttemptsID(lockout.KindAccount, "local", "elroy@example.com"),
+			Kind:          lockout.KindAccount,
+			ConnectorID:   "local",
+			Subject:       "elroy@example.com",
+			Failures:      5,
+			Delay:         16 * time.Second,
+			LastFailureAt: time.Unix(1460000000, 0).UTC(),
+			LockedUntil:   testLockedUntil,
+		},
+		{
+			ID:            lockout.AttemptsID(lockout.KindIP, "", "10.0.0.1"),
+			Kind:          lockout.KindIP,
+			Subject:       "10.0.0.1",
+			Failures:      2,
+			Delay:         2 * time.Second,
+			LastFailureAt: time.Unix(1460000000, 0).UTC(),
+		},
+	}
+)
+
+func newLoginAttemptRepo(t *testing.T) lockout.LoginAttemptRepo {
+	var dbMap *gorp.DbMap
+	if dsn := os.Getenv("DEX_TEST_DSN"); dsn == "" {
+		dbMap = db.NewMemDB()
+	} else {
+		dbMap = connect(t)
+	}
+	repo := db.NewLoginAttemptRepo(dbMap)
+	for _, a := range testAttempts {
+		if err := repo.Set(a); err != nil {
+			t.Fatalf("Unable to set login attempts: %v", err)
+		}
+	}
+	return repo
+}
+
+func TestLoginAttemptRepoSetGet(t *testing.T) {
+	repo := newLoginAttemptRepo(t)
+
+	for i, want := range testAttempts {
+		got, err := repo.Get(want.ID)
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if diff := pretty.Compare(want, *got); diff != "" {
+			t.Errorf("case %d: Compare(want, got) = %v", i, diff)
+		}
+	}
+
+	updated := testAttempts[1]
+	updated.Failures = 3
+	updated.Delay = 4 * time.Second
+	if err := repo.Set(updated); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got, err := repo.Get(updated.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := pretty.Compare(updated, *got); diff != "" {
+		t.Errorf("Compare(want, got) = %v", diff)
+	}
+
+	if _, err := repo.Get("nope"); err != lockout.ErrorNotFound {
+		t.Errorf("want err=%v, got=%v", lockout.ErrorNotFound, err)
+	}
+}
+
+func TestLoginAttemptRepoDelete(t *testing.T) {
+	repo := newLoginAttemptRepo(t)
+
+	id := testAttempts[0].ID
+	if err := repo.Delete(id); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := repo.Get(id); err != lockout.ErrorNotFound {
+		t.Errorf("want err=%v, got=%v", lockout.ErrorNotFound, err)
+	}
+	if err := repo.Delete(id); err != lockout.ErrorNotFound {
+		t.Errorf("want err=%v, got=%v", lockout.ErrorNotFound, err)
+	}
+}
+
+func TestLoginAttemptRepoLocked(t *testing.T) {
+	tests := []struct {
+		now  time.Time
+		want []lockout.Attempts
+	}{
+		{
+			now:  testLockedUntil.Add(-time.Minute),
+			want: testAttempts[:1],
+		},
+		{
+			now:  testLockedUntil,
+			want: []lockout.Attempts{},
+		},
+	}
+
+	for i, tt := range tests {
+		repo := newLoginAttemptRepo(t)
+		got, err := repo.Locked(tt.now)
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if diff := pretty.Compare(tt.want, got); diff != "" {
+			t.Errorf("case %d: Compare(want, got) = %v", i, diff)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package repo
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-gorp/gorp"
+	"github.com/kylelemons/godebug/pretty"
+
+	"github.com/coreos/dex/db"
+	"github.com/coreos/dex/mfa"
+)
+
+var (
+	testMFASecret      = []byte("0123456789abcdef0123456789abcdef")
+	testOtherMFASecret = []byte("fedcba9876543210fedcba9876543210")
+
+	testEnrollment = mfa.Enrollment{
+		UserID:        "ID-1",
+		Secret:        []byte("12345678901234567890"),
+		RecoveryCodes: []string{"hash-1", "hash-2"},
+		LastStep:      48666666,
+		CreatedAt:     time.Unix(1460000000, 0).UTC(),
+	}
+)
+
+func newMFAEnrollmentDB(t *testing.T) *gorp.DbMap {
+	if dsn := os.Getenv("DEX_TEST_DSN"); dsn != "" {
+		return connect(t)
+	}
+	return db.NewMemDB()
+}
+
+func TestMFAEnrollmentRepoSetGet(t *testing.T) {
+	repo, err := db.NewMFAEnrollmentRepo(newMFAEnrollmentDB(t), testMFASecret)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err := repo.Get(testEnrollment.UserID); err != mfa.ErrorNotFound {
+		t.Errorf("want err=%v, got=%v", mfa.ErrorNotFound, err)
+	}
+
+	if err := repo.Set(testEnrollment); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got, err := repo.Get(testEnrollment.UserID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := pretty.Compare(testEnrollment, *got); diff != "" {
+		t.Errorf("Compare(want, got) = %v", diff)
+	}
+
+	updated := testEnrollment
+	updated.RecoveryCodes = []string{"hash-2"}
+	updated.LastStep++
+	if err := repo.Set(updated); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got, err = repo.Get(testEnrollment.UserID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := pretty.Compare(updated, *got); diff != "" {
+		t.Errorf("Compare(want, got) = %v", diff)
+	}
+}
+
+func TestMFAEnrollmentRepoSecrets(t *testing.T) {
+	dbMap := newMFAEnrollmentDB(t)
+	repo, err := db.NewMFAEnrollmentRepo(dbMap, testMFASecret)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := repo.Set(testEnrollment); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The old secret still decrypts enrollments after a new one is added.
+	rotated, err := db.NewMFAEnrollmentRepo(dbMap, testOtherMFASecret, testMFASecret)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := rotated.Get(testEnrollment.UserID); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	other, err := db.NewMFAEnrollmentRepo(dbMap, testOtherMFASecret)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := other.Get(testEnrollment.UserID); err != db.ErrorCannotDecryptMFAEnrollment {
+		t.Errorf("want err=%v, got=%v", db.ErrorCannotDecryptMFAEnrollment, err)
+	}
+
+	if _, err := db.NewMFAEnrollmentRepo(dbMap, []byte("short")); err == nil {
+		t.Errorf("Expected an error for a short secret")
+	}
+}
+
+func TestMFAEnrollmentRepoDelete(t *testing.T) {
+	repo, err := db.NewMFAEnrollmentRepo(newMFAEnrollmentDB(t), testMFASecret)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := repo.Set(testEnrollment); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := repo.Delete(testEnrollment.UserID); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := repo.Get(testEnrollment.UserID); err != mfa.ErrorNotFound {
+		t.Errorf("want err=%v, got=%v", mfa.ErrorNotFound, err)
+	}
+	if err := repo.Delete(testEnrollment.UserID); err != mfa.ErrorNotFound {
+		t.Errorf("want err=%v, got=%v", mfa.ErrorNotFound, err)
+	}
+}
@@ -110,6 +110,14 @@ func TestUpdatePasswordInfo(t *testing.T) {
 			},
 			err: nil,
 		},
+		{
+			pw: user.PasswordInfo{
+				UserID:   "ID-1",
+				Password: user.Password("newer_pass"),
+				History:  []user.Password{user.Password("new_pass"), user.Password("hi.")},
+			},
+			err: nil,
+		},
 		{
 			pw: user.PasswordInfo{
 				UserID:          "ID-2",
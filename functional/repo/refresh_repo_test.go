@@ -67,7 +67,7 @@ func TestRefreshTokenRepo(t *testing.T) {
 	}
 
 	repo := newRefreshRepo(t, users, clients)
-	tok, err := repo.Create(userID, clientID)
+	tok, err := repo.Create(userID, clientID, []string{"openid"})
 	if err != nil {
 		t.Fatalf("failed to create refresh token: %v", err)
 	}
@@ -93,3 +93,79 @@ func TestRefreshTokenRepo(t *testing.T) {
 		t.Errorf("Token which should have been revoked was verified")
 	}
 }
+
+func TestRefreshTokenRepoRotate(t *testing.T) {
+	clientID := "client1"
+	userID := "user1"
+	clients := []client.Client{
+		{
+			Credentials: oidc.ClientCredentials{
+				ID:     clientID,
+				Secret: base64.URLEncoding.EncodeToString([]byte("secret-2")),
+			},
+			Metadata: oidc.ClientMetadata{
+				RedirectURIs: []url.URL{
+					url.URL{Scheme: "https", Host: "client1.example.com", Path: "/callback"},
+				},
+			},
+		},
+	}
+	users := []user.UserWithRemoteIdentities{
+		{
+			User: user.User{
+				ID:        userID,
+				Email:     "Email-1@example.com",
+				CreatedAt: time.Now().Truncate(time.Second),
+			},
+		},
+	}
+
+	repo := newRefreshRepo(t, users, clients)
+	scope := []string{"openid", "email", "offline_access"}
+	tok1, err := repo.Create(userID, clientID, scope)
+	if err != nil {
+		t.Fatalf("failed to create refresh token: %v", err)
+	}
+	// An unrelated family which must survive the revocation below.
+	other, err := repo.Create(userID, clientID, scope)
+	if err != nil {
+		t.Fatalf("failed to create refresh token: %v", err)
+	}
+
+	if _, _, _, err := repo.Rotate("client2", tok1); err != refresh.ErrorInvalidClientID {
+		t.Errorf("Want err=%v rotating another client's token, got=%v", refresh.ErrorInvalidClientID, err)
+	}
+
+	tok2, tokUserID, tokScope, err := repo.Rotate(clientID, tok1)
+	if err != nil {
+		t.Fatalf("failed to rotate refresh token: %v", err)
+	}
+	if tokUserID != userID {
+		t.Errorf("Rotated token returned wrong user id, want=%s, got=%s", userID, tokUserID)
+	}
+	if diff := pretty.Compare(scope, tokScope); diff != "" {
+		t.Errorf("Rotated token returned wrong scope: Compare(want, got) = %v", diff)
+	}
+	if _, err := repo.Verify(clientID, tok1); err != refresh.ErrorInvalidToken {
+		t.Errorf("Want err=%v verifying a retired token, got=%v", refresh.ErrorInvalidToken, err)
+	}
+	if _, err := repo.Verify(clientID, tok2); err != nil {
+		t.Errorf("Could not verify rotated token: %v", err)
+	}
+
+	tok3, _, _, err := repo.Rotate(clientID, tok2)
+	if err != nil {
+		t.Fatalf("failed to rotate refresh token: %v", err)
+	}
+
+	// Reusing a retired token revokes the whole family.
+	if _, _, _, err := repo.Rotate(clientID, tok1); err != refresh.ErrorTokenReused {
+		t.Errorf("Want err=%v reusing a retired token, got=%v", refresh.ErrorTokenReused, err)
+	}
+	if _, err := repo.Verify(clientID, tok3); err == nil {
+		t.Errorf("Token of a revoked family was verified")
+	}
+	if _, err := repo.Verify(clientID, other); err != nil {
+		t.Errorf("Could not verify token of another family: %v", err)
+	}
+}
@@ -57,6 +57,32 @@ func TestSessionKeyRepoPushPop(t *testing.T) {
 	}
 }
 
+func TestSessionKeyRepoPeek(t *testing.T) {
+	r, _ := newSessionKeyRepo(t)
+
+	key := "123"
+	sessionID := "456"
+
+	r.Push(session.SessionKey{Key: key, SessionID: sessionID}, time.Second)
+
+	for i := 0; i < 2; i++ {
+		got, err := r.Peek(key)
+		if err != nil {
+			t.Fatalf("Expected nil error: %v", err)
+		}
+		if got != sessionID {
+			t.Fatalf("Incorrect sessionID: want=%s got=%s", sessionID, got)
+		}
+	}
+
+	if _, err := r.Pop(key); err != nil {
+		t.Fatalf("Expected nil error: %v", err)
+	}
+	if _, err := r.Peek(key); err == nil {
+		t.Fatalf("Expected error peeking a popped key, got nil")
+	}
+}
+
 func TestSessionKeyRepoExpired(t *testing.T) {
 	r, fc := newSessionKeyRepo(t)
 
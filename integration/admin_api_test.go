@@ -7,18 +7,23 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/coreos/go-oidc/oidc"
 	"github.com/kylelemons/godebug/pretty"
 	"google.golang.org/api/googleapi"
 
+	"github.com/coreos/dex/access"
 	"github.com/coreos/dex/admin"
+	"github.com/coreos/dex/audit"
 	"github.com/coreos/dex/client"
 	"github.com/coreos/dex/client/manager"
 	"github.com/coreos/dex/db"
+	"github.com/coreos/dex/refresh"
 	"github.com/coreos/dex/schema/adminschema"
 	"github.com/coreos/dex/server"
 	"github.com/coreos/dex/user"
+	usermanager "github.com/coreos/dex/user/manager"
 )
 
 const (
@@ -29,6 +34,8 @@ type adminAPITestFixtures struct {
 	ur       user.UserRepo
 	pwr      user.PasswordInfoRepo
 	cr       client.ClientRepo
+	rtr      refresh.RefreshTokenRepo
+	atr      access.AccessTokenRepo
 	adAPI    *admin.AdminAPI
 	adSrv    *server.AdminServer
 	hSrv     *httptest.Server
@@ -86,7 +93,9 @@ func makeAdminAPITestFixtures() *adminAPITestFixtures {
 
 	var cliCount int
 	secGen := func() ([]byte, error) {
-		return []byte(fmt.Sprintf("client_%v", cliCount)), nil
+		secret := []byte(fmt.Sprintf("client_%v", cliCount))
+		cliCount++
+		return secret, nil
 	}
 	cr := db.NewClientRepo(dbMap)
 	clientIDGenerator := func(hostport string) (string, error) {
@@ -94,11 +103,19 @@ func makeAdminAPITestFixtures() *adminAPITestFixtures {
 	}
 	cm := manager.NewClientManager(cr, db.TransactionFactory(dbMap), manager.ManagerOptions{SecretGenerator: secGen, ClientIDGenerator: clientIDGenerator})
 	ccr := db.NewConnectorConfigRepo(dbMap)
+	gm := usermanager.NewGroupManager(db.NewGroupRepo(dbMap), ur, db.TransactionFactory(dbMap))
 
 	f.cr = cr
 	f.ur = ur
 	f.pwr = pwr
-	f.adAPI = admin.NewAdminAPI(ur, pwr, cr, ccr, um, cm, "local")
+	mer, err := db.NewMFAEnrollmentRepo(dbMap, make([]byte, 32))
+	if err != nil {
+		panic(err)
+	}
+	f.rtr = db.NewRefreshTokenRepo(dbMap)
+	f.atr = db.NewAccessTokenRepo(dbMap)
+	aer := db.NewAuditEventRepo(dbMap)
+	f.adAPI = admin.NewAdminAPI(ur, pwr, cr, ccr, um, cm, gm, db.NewLoginAttemptRepo(dbMap), mer, db.NewInitialAccessTokenRepo(dbMap), audit.NewLogger(aer), aer, "local")
 	f.adSrv = server.NewAdminServer(f.adAPI, nil, adminAPITestSecret)
 	f.hSrv = httptest.NewServer(f.adSrv.HTTPHandler())
 	f.hc = &http.Client{
@@ -509,6 +526,137 @@ func TestCreateClient(t *testing.T) {
 	}
 }
 
+func TestManageClients(t *testing.T) {
+	f := makeAdminAPITestFixtures()
+	defer f.close()
+
+	created, err := f.adClient.Client.Create(&adminschema.ClientCreateRequest{
+		Client: &adminschema.Client{
+			RedirectURIs: []string{"https://auth.example.com/"},
+			ClientName:   "Example",
+		},
+	}).Do()
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+	id, secret := created.Client.Id, created.Client.Secret
+
+	wantCode := func(err error, code int) {
+		aErr, ok := err.(*googleapi.Error)
+		if !ok {
+			t.Errorf("want googleapi.Error with code %d, got %v", code, err)
+			return
+		}
+		if aErr.Code != code {
+			t.Errorf("want aErr.Code=%v, got %v", code, aErr.Code)
+		}
+	}
+
+	listed, err := f.adClient.Client.List().Do()
+	if err != nil {
+		t.Fatalf("unexpected error listing clients: %v", err)
+	}
+	want := &adminschema.ClientsResponse{
+		Clients: []*adminschema.Client{
+			{
+				Id:           id,
+				RedirectURIs: []string{"https://auth.example.com/"},
+				ClientName:   "Example",
+			},
+		},
+	}
+	if diff := pretty.Compare(want, listed); diff != "" {
+		t.Errorf("Compare(want, got) = %v", diff)
+	}
+
+	updated, err := f.adClient.Client.Update(id, &adminschema.Client{
+		Id:           "ignored",
+		Secret:       "ignored",
+		RedirectURIs: []string{"https://auth.example.com/", "https://auth2.example.com/"},
+		ClientName:   "Renamed",
+		RequireMFA:   true,
+		FirstParty:   true,
+	}).Do()
+	if err != nil {
+		t.Fatalf("unexpected error updating client: %v", err)
+	}
+	got, err := f.adClient.Client.Get(id).Do()
+	if err != nil {
+		t.Fatalf("unexpected error getting client: %v", err)
+	}
+	wantClient := &adminschema.Client{
+		Id:           id,
+		RedirectURIs: []string{"https://auth.example.com/", "https://auth2.example.com/"},
+		ClientName:   "Renamed",
+		RequireMFA:   true,
+		FirstParty:   true,
+	}
+	if diff := pretty.Compare(wantClient, updated); diff != "" {
+		t.Errorf("Compare(want, updated) = %v", diff)
+	}
+	if diff := pretty.Compare(wantClient, got); diff != "" {
+		t.Errorf("Compare(want, got) = %v", diff)
+	}
+
+	_, err = f.adClient.Client.Update(id, &adminschema.Client{}).Do()
+	wantCode(err, http.StatusBadRequest)
+	_, err = f.adClient.Client.Get("nonexistent").Do()
+	wantCode(err, http.StatusNotFound)
+
+	// The updated client still authenticates with its secret, and the
+	// secret survives its rotation until the overlap is over.
+	rotated, err := f.adClient.Client.RotateSecret(id, &adminschema.ClientSecretRotateRequest{OverlapSeconds: 3600}).Do()
+	if err != nil {
+		t.Fatalf("unexpected error rotating secret: %v", err)
+	}
+	if rotated.Id != id || rotated.Secret == secret || rotated.PreviousSecretExpiresAt == "" {
+		t.Errorf("unexpected rotation response: %#v", rotated)
+	}
+	cm := manager.NewClientManager(f.cr, nil, manager.ManagerOptions{})
+	for _, s := range []string{secret, rotated.Secret} {
+		if ok, _ := cm.Authenticate(oidc.ClientCredentials{ID: id, Secret: s}); !ok {
+			t.Errorf("want secret %q valid", s)
+		}
+	}
+
+	_, err = f.adClient.Client.RotateSecret(id, &adminschema.ClientSecretRotateRequest{OverlapSeconds: -1}).Do()
+	wantCode(err, http.StatusBadRequest)
+
+	rotatedAgain, err := f.adClient.Client.RotateSecret(id, &adminschema.ClientSecretRotateRequest{}).Do()
+	if err != nil {
+		t.Fatalf("unexpected error rotating secret: %v", err)
+	}
+	if rotatedAgain.PreviousSecretExpiresAt != "" {
+		t.Errorf("want no previous secret, got expiry %q", rotatedAgain.PreviousSecretExpiresAt)
+	}
+	if ok, _ := cm.Authenticate(oidc.ClientCredentials{ID: id, Secret: rotated.Secret}); ok {
+		t.Errorf("want replaced secret invalid")
+	}
+
+	// Deleting the client revokes its access and refresh tokens.
+	token, err := f.rtr.Create("ID-1", id, []string{"openid"})
+	if err != nil {
+		t.Fatalf("unexpected error creating refresh token: %v", err)
+	}
+	accessToken, err := f.atr.Create(access.AccessToken{UserID: "ID-1", ClientID: id, ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("unexpected error creating access token: %v", err)
+	}
+	if err := f.adClient.Client.Delete(id).Do(); err != nil {
+		t.Fatalf("unexpected error deleting client: %v", err)
+	}
+	if _, err := f.rtr.Verify(id, token); err == nil {
+		t.Errorf("want refresh token revoked")
+	}
+	if _, err := f.atr.Get(accessToken); err != access.ErrorInvalidToken {
+		t.Errorf("want access token revoked, got err=%v", err)
+	}
+	_, err = f.adClient.Client.Get(id).Do()
+	wantCode(err, http.StatusNotFound)
+	err = f.adClient.Client.Delete(id).Do()
+	wantCode(err, http.StatusNotFound)
+}
+
 func TestGetState(t *testing.T) {
 	tests := []struct {
 		addUsers []user.User
@@ -558,3 +706,44 @@ func TestGetState(t *testing.T) {
 	}
 
 }
+
+func TestRemoteIdentities(t *testing.T) {
+	f := makeAdminAPITestFixtures()
+	defer f.close()
+
+	// IDs with slashes are passed escaped, and taken as a whole.
+	rid := user.RemoteIdentity{ConnectorID: "local", ID: "cn=jane/doe,ou=people"}
+	if err := f.adClient.RemoteIdentities.Link("ID-1", rid.ConnectorID, rid.ID).Do(); err != nil {
+		t.Fatalf("err != nil: %v", err)
+	}
+	usr, err := f.ur.GetByRemoteIdentity(nil, rid)
+	if err != nil {
+		t.Fatalf("err != nil: %v", err)
+	}
+	if usr.ID != "ID-1" {
+		t.Errorf("want remote identity linked to %q, got %q", "ID-1", usr.ID)
+	}
+
+	got, err := f.adClient.RemoteIdentities.List("ID-1").Do()
+	if err != nil {
+		t.Fatalf("err != nil: %v", err)
+	}
+	want := &adminschema.RemoteIdentitiesResponse{
+		RemoteIdentities: []*adminschema.RemoteIdentity{{ConnectorID: rid.ConnectorID, Id: rid.ID}},
+	}
+	if diff := pretty.Compare(want, got); diff != "" {
+		t.Errorf("Compare(want, got) = %v", diff)
+	}
+
+	err = f.adClient.RemoteIdentities.Link("ID-2", rid.ConnectorID, rid.ID).Do()
+	if gErr, ok := err.(*googleapi.Error); !ok || gErr.Code != http.StatusBadRequest {
+		t.Errorf("want HTTP %d linking another user's identity, got %v", http.StatusBadRequest, err)
+	}
+
+	if err := f.adClient.RemoteIdentities.Unlink("ID-1", rid.ConnectorID, rid.ID).Do(); err != nil {
+		t.Fatalf("err != nil: %v", err)
+	}
+	if _, err := f.ur.GetByRemoteIdentity(nil, rid); err != user.ErrorNotFound {
+		t.Errorf("want err=%v, got=%v", user.ErrorNotFound, err)
+	}
+}
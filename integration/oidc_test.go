@@ -16,6 +16,7 @@ import (
 	phttp "github.com/coreos/dex/pkg/http"
 	"github.com/coreos/dex/refresh/refreshtest"
 	"github.com/coreos/dex/server"
+	"github.com/coreos/dex/session"
 	"github.com/coreos/dex/session/manager"
 	"github.com/coreos/dex/user"
 	"github.com/coreos/go-oidc/jose"
@@ -204,6 +205,7 @@ func TestHTTPExchangeTokenRefreshToken(t *testing.T) {
 		UserRepo:         userRepo,
 		PasswordInfoRepo: passwordInfoRepo,
 		RefreshTokenRepo: refreshTokenRepo,
+		AccessTokenRepo:  db.NewAccessTokenRepo(db.NewMemDB()),
 	}
 
 	if err = srv.AddConnector(cfg); err != nil {
@@ -241,11 +243,17 @@ func TestHTTPExchangeTokenRefreshToken(t *testing.T) {
 
 	// this will actually happen due to some interaction between the
 	// end-user and a remote identity provider
-	sessionID, err := sm.NewSession("bogus_idpc", ci.Credentials.ID, "bogus", url.URL{}, "", false, []string{"openid", "offline_access"})
+	sessionID, err := sm.NewSession(session.SessionRequest{
+		ConnectorID:  "bogus_idpc",
+		ClientID:     ci.Credentials.ID,
+		ClientState:  "bogus",
+		Scope:        []string{"openid", "profile", "offline_access"},
+		ResponseType: "code",
+	})
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
-	if _, err = sm.AttachRemoteIdentity(sessionID, passwordInfo.Identity()); err != nil {
+	if _, err = sm.AttachRemoteIdentity(sessionID, passwordInfo.Identity(), nil); err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
 
@@ -151,7 +151,7 @@ func makeUserAPITestFixtures() *userAPITestFixtures {
 
 	refreshRepo := db.NewRefreshTokenRepo(dbMap)
 	for _, user := range userUsers {
-		if _, err := refreshRepo.Create(user.User.ID, testClientID); err != nil {
+		if _, err := refreshRepo.Create(user.User.ID, testClientID, []string{"openid"}); err != nil {
 			panic("Failed to create refresh token: " + err.Error())
 		}
 	}
@@ -159,7 +159,7 @@ func makeUserAPITestFixtures() *userAPITestFixtures {
 	f.emailer = &testEmailer{}
 	um.Clock = clock
 
-	api := api.NewUsersAPI(um, clientManager, refreshRepo, f.emailer, "local")
+	api := api.NewUsersAPI(um, clientManager, refreshRepo, f.emailer, nil, func() string { return "local" })
 	usrSrv := server.NewUserMgmtServer(api, jwtvFactory, um, clientManager)
 	f.hSrv = httptest.NewServer(usrSrv.HTTPHandler())
 
@@ -0,0 +1,266 @@
+// Package lockout protects password logins against brute-force attacks.
+//
+// Failed logins are counted per account and per source IP. Every failure
+// doubles the delay before the next attempt is allowed, and after too many
+// failures the account or IP is locked out for a while.
+package lockout
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+
+	"github.com/coreos/dex/audit"
+	ptime "github.com/coreos/dex/pkg/time"
+)
+
+const (
+	KindAccount = "account"
+	KindIP      = "ip"
+
+	DefaultMaxAccountFailures = 5
+	DefaultMaxIPFailures      = 20
+	DefaultLockoutDuration    = 15 * time.Minute
+	DefaultMaxDelay           = 30 * time.Second
+)
+
+var (
+	ErrorNotFound = errors.New("login attempts not found")
+
+	// ErrorLocked is returned for logins to an account or from an IP which
+	// is locked out.
+	ErrorLocked = errors.New("too many failed login attempts")
+
+	// ErrorTooSoon is returned for logins attempted before the delay since
+	// the last failure has passed.
+	ErrorTooSoon = errors.New("login attempted too soon after a failure")
+)
+
+// Attempts records the recent failed logins to an account or from an IP.
+type Attempts struct {
+	// ID identifies the record, see AttemptsID.
+	ID string
+
+	// Kind is KindAccount or KindIP.
+	Kind string
+
+	// ConnectorID is the connector the account belongs to. It's empty for
+	// IPs, whose failures are counted across connectors.
+	ConnectorID string
+
+	// Subject is the account name as entered by the user, or the IP.
+	Subject string
+
+	Failures int
+
+	// Delay is how long after the last failure the next attempt is allowed.
+	Delay time.Duration
+
+	LastFailureAt time.Time
+
+	// LockedUntil is the end of the current lockout, if any.
+	LockedUntil time.Time
+}
+
+// Locked returns whether the account or IP is locked out at the given time.
+func (a Attempts) Locked(now time.Time) bool {
+	return now.Before(a.LockedUntil)
+}
+
+// AttemptsID returns the ID of the Attempts for a subject. Account names are
+// compared case-insensitively, as emails are.
+func AttemptsID(kind, connectorID, subject string) string {
+	if kind == KindAccount {
+		subject = strings.ToLower(subject)
+	}
+	sum := sha256.Sum256([]byte(kind + "\x00" + connectorID + "\x00" + subject))
+	return hex.EncodeToString(sum[:])
+}
+
+type LoginAttemptRepo interface {
+	// Get returns the Attempts with the given ID, or ErrorNotFound.
+	Get(id string) (*Attempts, error)
+
+	// Set creates or replaces the Attempts with the ID of a.
+	Set(a Attempts) error
+
+	// Delete removes the Attempts with the given ID, or returns
+	// ErrorNotFound.
+	Delete(id string) error
+
+	// Locked returns the Attempts which are locked out at the given time.
+	Locked(now time.Time) ([]Attempts, error)
+}
+
+// Guard applies the lockout policy to logins. Its zero-valued fields take
+// the defaults.
+type Guard struct {
+	Repo  LoginAttemptRepo
+	Clock clockwork.Clock
+
+	// MaxAccountFailures and MaxIPFailures are the numbers of consecutive
+	// failures after which an account or IP is locked out.
+	MaxAccountFailures int
+	MaxIPFailures      int
+
+	// LockoutDuration is how long lockouts last. Failures further apart
+	// than it aren't consecutive.
+	LockoutDuration time.Duration
+
+	// MaxDelay caps the delay between attempts.
+	MaxDelay time.Duration
+
+	// Audit records failed logins and lockouts.
+	Audit *audit.Logger
+
+	// mu serializes updates to the counters within this process.
+	mu sync.Mutex
+}
+
+func NewGuard(repo LoginAttemptRepo) *Guard {
+	return &Guard{
+		Repo:               repo,
+		Clock:              clockwork.NewRealClock(),
+		MaxAccountFailures: DefaultMaxAccountFailures,
+		MaxIPFailures:      DefaultMaxIPFailures,
+		LockoutDuration:    DefaultLockoutDuration,
+		MaxDelay:           DefaultMaxDelay,
+	}
+}
+
+// Check returns ErrorLocked or ErrorTooSoon if a login to the account of the
+// connector from the IP must not be attempted now. The password must not be
+// checked if it returns an error.
+func (g *Guard) Check(connectorID, account, ip string) error {
+	now := g.now()
+	for _, id := range g.ids(connectorID, account, ip) {
+		a, err := g.Repo.Get(id)
+		if err == ErrorNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if a.Locked(now) {
+			return ErrorLocked
+		}
+		if now.Before(a.LastFailureAt.Add(a.Delay)) {
+			return ErrorTooSoon
+		}
+	}
+	return nil
+}
+
+// Failed records a failed login to the account of the connector from the IP.
+func (g *Guard) Failed(connectorID, account, ip string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.Audit.Record(audit.Event{
+		Type:        audit.EventLoginFailed,
+		ConnectorID: connectorID,
+		IP:          ip,
+		Details:     map[string]string{"account": account},
+	})
+
+	if err := g.fail(KindAccount, connectorID, account); err != nil {
+		return err
+	}
+	if ip == "" {
+		return nil
+	}
+	return g.fail(KindIP, "", ip)
+}
+
+// Succeeded clears the failures of the account of the connector. Those of the
+// IP are kept, so that an attacker can't reset them by logging in to their
+// own account.
+func (g *Guard) Succeeded(connectorID, account string) error {
+	err := g.Repo.Delete(AttemptsID(KindAccount, connectorID, account))
+	if err == ErrorNotFound {
+		return nil
+	}
+	return err
+}
+
+func (g *Guard) fail(kind, connectorID, subject string) error {
+	now := g.now()
+	id := AttemptsID(kind, connectorID, subject)
+
+	a, err := g.Repo.Get(id)
+	switch {
+	case err == ErrorNotFound:
+		a = &Attempts{ID: id, Kind: kind, ConnectorID: connectorID, Subject: subject}
+	case err != nil:
+		return err
+	case now.Sub(a.LastFailureAt) > g.lockoutDuration() || (!a.LockedUntil.IsZero() && !a.Locked(now)):
+		// Start counting afresh after a lull or a lockout.
+		a = &Attempts{ID: id, Kind: kind, ConnectorID: connectorID, Subject: subject}
+	}
+
+	a.Failures++
+	a.Delay = ptime.ExpBackoff(a.Delay, g.maxDelay())
+	a.LastFailureAt = now
+
+	if a.Failures >= g.maxFailures(kind) && !a.Locked(now) {
+		a.LockedUntil = now.Add(g.lockoutDuration())
+		g.Audit.Record(audit.Event{
+			Type:        audit.EventLoginLockedOut,
+			ConnectorID: connectorID,
+			Details: map[string]string{
+				kind:           subject,
+				"failures":     strconv.Itoa(a.Failures),
+				"locked_until": a.LockedUntil.UTC().Format(time.RFC3339),
+			},
+		})
+	}
+	return g.Repo.Set(*a)
+}
+
+func (g *Guard) ids(connectorID, account, ip string) []string {
+	ids := []string{AttemptsID(KindAccount, connectorID, account)}
+	if ip != "" {
+		ids = append(ids, AttemptsID(KindIP, "", ip))
+	}
+	return ids
+}
+
+func (g *Guard) now() time.Time {
+	if g.Clock == nil {
+		return time.Now()
+	}
+	return g.Clock.Now()
+}
+
+func (g *Guard) maxFailures(kind string) int {
+	if kind == KindIP {
+		if g.MaxIPFailures <= 0 {
+			return DefaultMaxIPFailures
+		}
+		return g.MaxIPFailures
+	}
+	if g.MaxAccountFailures <= 0 {
+		return DefaultMaxAccountFailures
+	}
+	return g.MaxAccountFailures
+}
+
+func (g *Guard) lockoutDuration() time.Duration {
+	if g.LockoutDuration <= 0 {
+		return DefaultLockoutDuration
+	}
+	return g.LockoutDuration
+}
+
+func (g *Guard) maxDelay() time.Duration {
+	if g.MaxDelay <= 0 {
+		return DefaultMaxDelay
+	}
+	return g.MaxDelay
+}
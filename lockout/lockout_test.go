@@ -0,0 +1,224 @@
+package lockout
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/kylelemons/godebug/pretty"
+
+	"github.com/coreos/dex/audit"
+)
+
+type memLoginAttemptRepo map[string]Attempts
+
+func (r memLoginAttemptRepo) Get(id string) (*Attempts, error) {
+	a, ok := r[id]
+	if !ok {
+		return nil, ErrorNotFound
+	}
+	return &a, nil
+}
+
+func (r memLoginAttemptRepo) Set(a Attempts) error {
+	r[a.ID] = a
+	return nil
+}
+
+func (r memLoginAttemptRepo) Delete(id string) error {
+	if _, ok := r[id]; !ok {
+		return ErrorNotFound
+	}
+	delete(r, id)
+	return nil
+}
+
+func (r memLoginAttemptRepo) Locked(now time.Time) ([]Attempts, error) {
+	var locked []Attempts
+	for _, a := range r {
+		if a.Locked(now) {
+			locked = append(locked, a)
+		}
+	}
+	return locked, nil
+}
+
+func newTestGuard() (*Guard, clockwork.FakeClock, memLoginAttemptRepo) {
+	repo := memLoginAttemptRepo{}
+	clock := clockwork.NewFakeClock()
+	g := NewGuard(repo)
+	g.Clock = clock
+	g.MaxAccountFailures = 3
+	g.MaxIPFailures = 5
+	g.LockoutDuration = 10 * time.Minute
+	g.MaxDelay = 4 * time.Second
+	return g, clock, repo
+}
+
+func TestAttemptsIDIgnoresAccountCase(t *testing.T) {
+	if AttemptsID(KindAccount, "local", "Elroy@Example.com") != AttemptsID(KindAccount, "local", "elroy@example.com") {
+		t.Error("Expected account IDs to be case-insensitive.")
+	}
+	if AttemptsID(KindAccount, "local", "elroy") == AttemptsID(KindAccount, "ldap", "elroy") {
+		t.Error("Expected account IDs to differ between connectors.")
+	}
+	if AttemptsID(KindAccount, "", "10.0.0.1") == AttemptsID(KindIP, "", "10.0.0.1") {
+		t.Error("Expected account and IP IDs to differ.")
+	}
+}
+
+func TestGuardDelay(t *testing.T) {
+	g, clock, _ := newTestGuard()
+
+	wantDelays := []time.Duration{time.Second, 2 * time.Second}
+	for i, want := range wantDelays {
+		if err := g.Failed("local", "elroy", ""); err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		if err := g.Check("local", "elroy", ""); err != ErrorTooSoon {
+			t.Errorf("case %d: want err=%v, got=%v", i, ErrorTooSoon, err)
+		}
+		clock.Advance(want - time.Millisecond)
+		if err := g.Check("local", "elroy", ""); err != ErrorTooSoon {
+			t.Errorf("case %d: want err=%v, got=%v", i, ErrorTooSoon, err)
+		}
+		clock.Advance(time.Millisecond)
+		if err := g.Check("local", "elroy", ""); err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+		}
+	}
+
+	// Other accounts are unaffected.
+	g.Failed("local", "elroy", "")
+	if err := g.Check("local", "emily", ""); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestGuardLockout(t *testing.T) {
+	g, clock, repo := newTestGuard()
+
+	for i := 0; i < 3; i++ {
+		if err := g.Check("local", "elroy", "10.0.0.1"); err != nil {
+			t.Fatalf("attempt %d: unexpected error: %v", i, err)
+		}
+		if err := g.Failed("local", "Elroy", "10.0.0.1"); err != nil {
+			t.Fatalf("attempt %d: unexpected error: %v", i, err)
+		}
+		clock.Advance(g.MaxDelay)
+	}
+
+	if err := g.Check("local", "elroy", "10.0.0.2"); err != ErrorLocked {
+		t.Errorf("want err=%v, got=%v", ErrorLocked, err)
+	}
+	locked, _ := repo.Locked(clock.Now())
+	if len(locked) != 1 || locked[0].Kind != KindAccount {
+		t.Errorf("want the account locked, got=%v", locked)
+	}
+
+	// The lockout ends, and counting starts afresh.
+	clock.Advance(g.LockoutDuration)
+	if err := g.Check("local", "elroy", "10.0.0.2"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	g.Failed("local", "elroy", "10.0.0.2")
+	a, err := repo.Get(AttemptsID(KindAccount, "local", "elroy"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if a.Failures != 1 || a.Delay != time.Second || !a.LockedUntil.IsZero() {
+		t.Errorf("want a fresh count, got=%#v", a)
+	}
+}
+
+func TestGuardIPLockout(t *testing.T) {
+	g, clock, _ := newTestGuard()
+
+	accounts := []string{"a", "b", "c", "d", "e"}
+	for _, account := range accounts {
+		if err := g.Failed("local", account, "10.0.0.1"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	clock.Advance(g.MaxDelay)
+
+	if err := g.Check("ldap", "f", "10.0.0.1"); err != ErrorLocked {
+		t.Errorf("want err=%v, got=%v", ErrorLocked, err)
+	}
+	if err := g.Check("ldap", "f", "10.0.0.2"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestGuardSucceeded(t *testing.T) {
+	g, _, repo := newTestGuard()
+
+	g.Failed("local", "elroy", "10.0.0.1")
+	if err := g.Succeeded("local", "elroy"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := repo.Get(AttemptsID(KindAccount, "local", "elroy")); err != ErrorNotFound {
+		t.Errorf("want err=%v, got=%v", ErrorNotFound, err)
+	}
+	if _, err := repo.Get(AttemptsID(KindIP, "", "10.0.0.1")); err != nil {
+		t.Errorf("want the IP's failures kept, got err=%v", err)
+	}
+
+	// Succeeding without any failures is fine.
+	if err := g.Succeeded("local", "emily"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestGuardLull(t *testing.T) {
+	g, clock, repo := newTestGuard()
+
+	g.Failed("local", "elroy", "")
+	g.Failed("local", "elroy", "")
+	clock.Advance(g.LockoutDuration + time.Second)
+	g.Failed("local", "elroy", "")
+
+	a, err := repo.Get(AttemptsID(KindAccount, "local", "elroy"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if a.Failures != 1 || a.Locked(clock.Now()) {
+		t.Errorf("want failures before the lull forgotten, got=%#v", a)
+	}
+}
+
+type memSink []audit.Event
+
+func (s *memSink) Write(e audit.Event) error {
+	*s = append(*s, e)
+	return nil
+}
+
+func TestGuardAudit(t *testing.T) {
+	g, clock, _ := newTestGuard()
+	var events memSink
+	g.Audit = audit.NewLogger(&events)
+
+	for i := 0; i < 3; i++ {
+		if err := g.Failed("local", "elroy", "10.0.0.1"); err != nil {
+			t.Fatalf("attempt %d: unexpected error: %v", i, err)
+		}
+		clock.Advance(g.MaxDelay)
+	}
+
+	var types []string
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	want := []string{audit.EventLoginFailed, audit.EventLoginFailed, audit.EventLoginFailed, audit.EventLoginLockedOut}
+	if diff := pretty.Compare(want, types); diff != "" {
+		t.Fatalf("Compare(want, got) = %v", diff)
+	}
+
+	if e := events[0]; e.ConnectorID != "local" || e.IP != "10.0.0.1" || e.Details["account"] != "elroy" {
+		t.Errorf("unexpected failed login event: %#v", e)
+	}
+	if e := events[3]; e.ConnectorID != "local" || e.Details[KindAccount] != "elroy" || e.Details["failures"] != "3" {
+		t.Errorf("unexpected lockout event: %#v", e)
+	}
+}
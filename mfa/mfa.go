@@ -0,0 +1,345 @@
+// Package mfa implements multi-factor authentication for local users with
+// time-based one-time passwords (TOTP, RFC 6238) and recovery codes.
+//
+// A login which needs a second factor is suspended in a Challenge after the
+// password was checked. The challenge is sealed and handed to the
+// user-agent, so that any dex worker can complete the login once the user
+// entered a code.
+package mfa
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+
+	"github.com/coreos/dex/audit"
+	pcrypto "github.com/coreos/dex/pkg/crypto"
+	"github.com/coreos/go-oidc/oidc"
+)
+
+const (
+	// Authentication method references (RFC 8176) for the "amr" claim.
+	AMRPassword = "pwd"
+	AMROTP      = "otp"
+	AMRMFA      = "mfa"
+
+	// ACRMFA is the authentication context class reference for the "acr"
+	// claim of logins which used a second factor.
+	ACRMFA = "http://schemas.openid.net/pape/policies/2007/06/multi-factor"
+
+	// ChallengeValidity is how long users have to enter their code after
+	// entering their password.
+	ChallengeValidity = 5 * time.Minute
+
+	recoveryCodeCount = 10
+	recoveryCodeBytes = 6
+)
+
+var (
+	ErrorNotFound = errors.New("MFA enrollment not found")
+
+	// ErrorInvalidCode is returned for codes which are wrong, or have been
+	// used before.
+	ErrorInvalidCode = errors.New("invalid MFA code")
+
+	ErrorInvalidChallenge = errors.New("invalid or expired MFA challenge")
+)
+
+// Enrollment is a user's TOTP secret and recovery codes.
+type Enrollment struct {
+	UserID string
+	Secret []byte
+
+	// RecoveryCodes are the hashes of the recovery codes which haven't been
+	// used yet.
+	RecoveryCodes []string
+
+	// LastStep is the TOTP time step of the last code used. Codes of this
+	// and earlier steps aren't accepted anymore.
+	LastStep int64
+
+	CreatedAt time.Time
+}
+
+// Verify checks a TOTP code or recovery code, and marks it as used so that
+// it can't be used again. The caller must store the updated enrollment.
+func (e *Enrollment) Verify(c string, now time.Time) error {
+	c = strings.Replace(c, " ", "", -1)
+	if len(c) == totpDigits {
+		step, ok := validate(e.Secret, c, now)
+		if !ok || step <= e.LastStep {
+			return ErrorInvalidCode
+		}
+		e.LastStep = step
+		return nil
+	}
+
+	h := hashRecoveryCode(c)
+	for i, rc := range e.RecoveryCodes {
+		if hmac.Equal([]byte(rc), []byte(h)) {
+			e.RecoveryCodes = append(e.RecoveryCodes[:i], e.RecoveryCodes[i+1:]...)
+			return nil
+		}
+	}
+	return ErrorInvalidCode
+}
+
+// NewRecoveryCodes replaces the recovery codes of the enrollment, and
+// returns the new codes. Only their hashes are kept.
+func (e *Enrollment) NewRecoveryCodes() ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b, err := pcrypto.RandBytes(recoveryCodeBytes)
+		if err != nil {
+			return nil, err
+		}
+		c := strings.ToLower(strings.TrimRight(base32.StdEncoding.EncodeToString(b), "="))
+		codes[i] = c[:5] + "-" + c[5:]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	e.RecoveryCodes = hashes
+	return codes, nil
+}
+
+func hashRecoveryCode(c string) string {
+	c = strings.ToLower(strings.Replace(c, "-", "", -1))
+	sum := sha256.Sum256([]byte(c))
+	return hex.EncodeToString(sum[:])
+}
+
+type EnrollmentRepo interface {
+	// Get returns the enrollment of the user, or ErrorNotFound.
+	Get(userID string) (*Enrollment, error)
+
+	// Set creates or replaces the enrollment of the user.
+	Set(e Enrollment) error
+
+	// Delete removes the enrollment of the user, or returns ErrorNotFound.
+	Delete(userID string) error
+}
+
+// Policy is implemented by the server, which knows the client and session a
+// login belongs to.
+type Policy interface {
+	// MFARequired returns whether the client of the login with the session
+	// key requires a second factor.
+	MFARequired(sessionKey string) (bool, error)
+
+	// SetAuthMethods records the methods, "amr" values, the user of the
+	// login with the session key authenticated with.
+	SetAuthMethods(sessionKey string, amr []string) error
+}
+
+// Challenge is a login waiting for its second factor.
+type Challenge struct {
+	Identity oidc.Identity `json:"identity"`
+
+	// Groups are the upstream groups of the user, which the login passes on
+	// once the code is checked.
+	Groups []string `json:"groups,omitempty"`
+
+	// Account is the account name the user logged in with.
+	Account    string `json:"account"`
+	SessionKey string `json:"sessionKey"`
+
+	// Secret is the new TOTP secret of a user who is enrolling. It's only
+	// stored once the user entered a code for it.
+	Secret []byte `json:"secret,omitempty"`
+
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Enrolling returns whether the user is enrolling, rather than entering a
+// code for an existing enrollment.
+func (c *Challenge) Enrolling() bool {
+	return len(c.Secret) != 0
+}
+
+// Authenticator asks local users for a second factor.
+type Authenticator struct {
+	Repo   EnrollmentRepo
+	Policy Policy
+	Clock  clockwork.Clock
+
+	// Issuer names dex in authenticator apps.
+	Issuer string
+
+	// Required requires a second factor from all users, regardless of the
+	// client.
+	Required bool
+
+	// Secrets are the 32 byte keys challenges are sealed with. The first is
+	// used to seal challenges, and all of them to open them.
+	Secrets [][]byte
+
+	// Audit records enrollments and the use of recovery codes.
+	Audit *audit.Logger
+}
+
+// Enrolled returns whether the user has enrolled a second factor.
+func (a *Authenticator) Enrolled(userID string) (bool, error) {
+	_, err := a.Repo.Get(userID)
+	if err == ErrorNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// MFARequired returns whether the login with the session key needs a second
+// factor.
+func (a *Authenticator) MFARequired(sessionKey string) (bool, error) {
+	if a.Required || a.Policy == nil {
+		return a.Required, nil
+	}
+	return a.Policy.MFARequired(sessionKey)
+}
+
+// SetAuthMethods records the authentication methods of the login with the
+// session key.
+func (a *Authenticator) SetAuthMethods(sessionKey string, amr []string) error {
+	if a.Policy == nil {
+		return nil
+	}
+	return a.Policy.SetAuthMethods(sessionKey, amr)
+}
+
+// NewChallenge suspends the login of ident until the user entered a code.
+// If enroll is true, the user gets a new secret to enroll.
+func (a *Authenticator) NewChallenge(ident oidc.Identity, account, sessionKey string, enroll bool) (*Challenge, error) {
+	c := &Challenge{
+		Identity:   ident,
+		Account:    account,
+		SessionKey: sessionKey,
+		ExpiresAt:  a.now().Add(ChallengeValidity),
+	}
+	if enroll {
+		secret, err := GenerateSecret()
+		if err != nil {
+			return nil, err
+		}
+		c.Secret = secret
+	}
+	return c, nil
+}
+
+// KeyURI returns the otpauth URI of the secret the user of c is enrolling.
+func (a *Authenticator) KeyURI(c *Challenge) string {
+	account := c.Identity.Email
+	if account == "" {
+		account = c.Account
+	}
+	return KeyURI(a.Issuer, account, c.Secret)
+}
+
+// Verify checks the code the user entered for the challenge. If the user is
+// enrolling, the enrollment is stored and its recovery codes returned.
+func (a *Authenticator) Verify(c *Challenge, code string) ([]string, error) {
+	now := a.now()
+	userID := c.Identity.ID
+
+	if c.Enrolling() {
+		step, ok := validate(c.Secret, strings.Replace(code, " ", "", -1), now)
+		if !ok {
+			return nil, ErrorInvalidCode
+		}
+		e := Enrollment{
+			UserID:    userID,
+			Secret:    c.Secret,
+			LastStep:  step,
+			CreatedAt: now,
+		}
+		codes, err := e.NewRecoveryCodes()
+		if err != nil {
+			return nil, err
+		}
+		if err := a.Repo.Set(e); err != nil {
+			return nil, err
+		}
+		a.Audit.Record(audit.Event{Type: audit.EventMFAEnrolled, UserID: userID})
+		return codes, nil
+	}
+
+	e, err := a.Repo.Get(userID)
+	if err != nil {
+		return nil, err
+	}
+	unused := len(e.RecoveryCodes)
+	if err := e.Verify(code, now); err != nil {
+		return nil, err
+	}
+	if err := a.Repo.Set(*e); err != nil {
+		return nil, err
+	}
+	if len(e.RecoveryCodes) != unused {
+		a.Audit.Record(audit.Event{
+			Type:    audit.EventMFARecoveryCodeUsed,
+			UserID:  userID,
+			Details: map[string]string{"recovery_codes_left": strconv.Itoa(len(e.RecoveryCodes))},
+		})
+	}
+	return nil, nil
+}
+
+// Seal encrypts the challenge for the user-agent.
+func (a *Authenticator) Seal(c *Challenge) (string, error) {
+	if len(a.Secrets) == 0 {
+		return "", errors.New("no secrets to seal MFA challenges with")
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := pcrypto.Encrypt(b, challengeKey(a.Secrets[0]))
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a challenge sealed by Seal, and checks it hasn't expired.
+func (a *Authenticator) Open(token string) (*Challenge, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrorInvalidChallenge
+	}
+	for _, secret := range a.Secrets {
+		b, err := pcrypto.Decrypt(sealed, challengeKey(secret))
+		if err != nil {
+			continue
+		}
+		var c Challenge
+		if err := json.Unmarshal(b, &c); err != nil {
+			return nil, ErrorInvalidChallenge
+		}
+		if !a.now().Before(c.ExpiresAt) {
+			return nil, ErrorInvalidChallenge
+		}
+		return &c, nil
+	}
+	return nil, ErrorInvalidChallenge
+}
+
+// challengeKey derives the key challenges are sealed with from a secret, so
+// that the secret isn't used for two purposes.
+func challengeKey(secret []byte) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte("dex mfa challenge"))
+	return h.Sum(nil)
+}
+
+func (a *Authenticator) now() time.Time {
+	if a.Clock == nil {
+		return time.Now()
+	}
+	return a.Clock.Now()
+}
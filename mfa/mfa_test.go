@@ -0,0 +1,218 @@
+package mfa
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+
+	"github.com/coreos/go-oidc/oidc"
+)
+
+type memEnrollmentRepo map[string]Enrollment
+
+func (r memEnrollmentRepo) Get(userID string) (*Enrollment, error) {
+	e, ok := r[userID]
+	if !ok {
+		return nil, ErrorNotFound
+	}
+	e.RecoveryCodes = append([]string(nil), e.RecoveryCodes...)
+	return &e, nil
+}
+
+func (r memEnrollmentRepo) Set(e Enrollment) error {
+	r[e.UserID] = e
+	return nil
+}
+
+func (r memEnrollmentRepo) Delete(userID string) error {
+	if _, ok := r[userID]; !ok {
+		return ErrorNotFound
+	}
+	delete(r, userID)
+	return nil
+}
+
+type fakePolicy struct {
+	required bool
+	amr      map[string][]string
+}
+
+func (p *fakePolicy) MFARequired(sessionKey string) (bool, error) {
+	return p.required, nil
+}
+
+func (p *fakePolicy) SetAuthMethods(sessionKey string, amr []string) error {
+	p.amr[sessionKey] = amr
+	return nil
+}
+
+func newTestAuthenticator() (*Authenticator, clockwork.FakeClock, memEnrollmentRepo) {
+	repo := memEnrollmentRepo{}
+	clock := clockwork.NewFakeClock()
+	a := &Authenticator{
+		Repo:    repo,
+		Policy:  &fakePolicy{amr: map[string][]string{}},
+		Clock:   clock,
+		Issuer:  "dex",
+		Secrets: [][]byte{make([]byte, 32)},
+	}
+	return a, clock, repo
+}
+
+func TestEnrollmentVerify(t *testing.T) {
+	now := time.Unix(1460000000, 0)
+	e := &Enrollment{UserID: "elroy", Secret: []byte("12345678901234567890")}
+	codes, err := e.NewRecoveryCodes()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(codes) != recoveryCodeCount || len(e.RecoveryCodes) != recoveryCodeCount {
+		t.Fatalf("want %d recovery codes, got %d", recoveryCodeCount, len(codes))
+	}
+
+	tests := []struct {
+		code    string
+		at      time.Time
+		wantErr error
+	}{
+		{code: Code(e.Secret, now), at: now},
+		// Codes can't be replayed.
+		{code: Code(e.Secret, now), at: now, wantErr: ErrorInvalidCode},
+		// Nor can earlier ones be used.
+		{code: Code(e.Secret, now.Add(-30*time.Second)), at: now, wantErr: ErrorInvalidCode},
+		{code: Code(e.Secret, now.Add(30*time.Second)), at: now.Add(30 * time.Second)},
+		{code: "000000", at: now.Add(time.Minute), wantErr: ErrorInvalidCode},
+		// Recovery codes are case and dash insensitive, and single use.
+		{code: codes[0], at: now},
+		{code: codes[0], at: now, wantErr: ErrorInvalidCode},
+		{code: "  " + codes[1][:5] + codes[1][6:], at: now},
+		{code: "aaaaa-aaaaa", at: now, wantErr: ErrorInvalidCode},
+	}
+
+	for i, tt := range tests {
+		if err := e.Verify(tt.code, tt.at); err != tt.wantErr {
+			t.Errorf("case %d: want err=%v, got=%v", i, tt.wantErr, err)
+		}
+	}
+	if len(e.RecoveryCodes) != recoveryCodeCount-2 {
+		t.Errorf("want %d recovery codes left, got %d", recoveryCodeCount-2, len(e.RecoveryCodes))
+	}
+}
+
+func TestAuthenticatorEnroll(t *testing.T) {
+	a, clock, repo := newTestAuthenticator()
+	ident := oidc.Identity{ID: "elroy-id", Email: "elroy@example.com"}
+
+	c, err := a.NewChallenge(ident, "elroy@example.com", "session-key", true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !c.Enrolling() {
+		t.Fatal("want an enrolling challenge")
+	}
+
+	if _, err := a.Verify(c, "000000"); err != ErrorInvalidCode {
+		t.Errorf("want err=%v, got=%v", ErrorInvalidCode, err)
+	}
+	if enrolled, _ := a.Enrolled(ident.ID); enrolled {
+		t.Error("want no enrollment before a valid code")
+	}
+
+	codes, err := a.Verify(c, Code(c.Secret, clock.Now()))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(codes) != recoveryCodeCount {
+		t.Errorf("want %d recovery codes, got %d", recoveryCodeCount, len(codes))
+	}
+	if enrolled, _ := a.Enrolled(ident.ID); !enrolled {
+		t.Error("want the user enrolled")
+	}
+
+	// Logging in again needs a code of the next step, and returns no
+	// recovery codes.
+	c, err = a.NewChallenge(ident, "elroy@example.com", "session-key-2", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	secret := repo["elroy-id"].Secret
+	if _, err := a.Verify(c, Code(secret, clock.Now())); err != ErrorInvalidCode {
+		t.Errorf("want err=%v, got=%v", ErrorInvalidCode, err)
+	}
+	clock.Advance(30 * time.Second)
+	codes, err = a.Verify(c, Code(secret, clock.Now()))
+	if err != nil || codes != nil {
+		t.Errorf("want no error or recovery codes, got err=%v codes=%v", err, codes)
+	}
+}
+
+func TestAuthenticatorSealOpen(t *testing.T) {
+	a, clock, _ := newTestAuthenticator()
+	ident := oidc.Identity{ID: "elroy-id", Email: "elroy@example.com"}
+
+	c, err := a.NewChallenge(ident, "elroy@example.com", "session-key", true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sealed, err := a.Seal(c)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := a.Open(sealed)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Identity.ID != ident.ID || got.SessionKey != "session-key" || EncodeSecret(got.Secret) != EncodeSecret(c.Secret) {
+		t.Errorf("want challenge=%#v, got=%#v", c, got)
+	}
+
+	// Challenges sealed with older secrets can still be opened.
+	rotated := *a
+	rotated.Secrets = [][]byte{[]byte("0123456789abcdef0123456789abcdef"), a.Secrets[0]}
+	if _, err := rotated.Open(sealed); err != nil {
+		t.Errorf("unexpected error opening with rotated secrets: %v", err)
+	}
+
+	tampered := []byte(sealed)
+	tampered[len(tampered)/2] ^= 1
+	for i, token := range []string{string(tampered), "", "!!!", sealed[:8]} {
+		if _, err := a.Open(token); err != ErrorInvalidChallenge {
+			t.Errorf("case %d: want err=%v, got=%v", i, ErrorInvalidChallenge, err)
+		}
+	}
+
+	clock.Advance(ChallengeValidity)
+	if _, err := a.Open(sealed); err != ErrorInvalidChallenge {
+		t.Errorf("want expired challenge rejected, got err=%v", err)
+	}
+}
+
+func TestAuthenticatorMFARequired(t *testing.T) {
+	a, _, _ := newTestAuthenticator()
+	policy := a.Policy.(*fakePolicy)
+
+	tests := []struct {
+		required       bool
+		clientRequired bool
+		want           bool
+	}{
+		{want: false},
+		{required: true, want: true},
+		{clientRequired: true, want: true},
+	}
+
+	for i, tt := range tests {
+		a.Required = tt.required
+		policy.required = tt.clientRequired
+		got, err := a.MFARequired("session-key")
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("case %d: want=%t, got=%t", i, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package mfa
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	pcrypto "github.com/coreos/dex/pkg/crypto"
+)
+
+const (
+	// The TOTP parameters authenticator apps support universally: HMAC-SHA1,
+	// six digits and a 30 second period.
+	totpDigits  = 6
+	totpPeriod  = 30
+	totpModulus = 1000000
+
+	secretSize = 20
+)
+
+// GenerateSecret returns a new random TOTP secret.
+func GenerateSecret() ([]byte, error) {
+	return pcrypto.RandBytes(secretSize)
+}
+
+// EncodeSecret returns the secret in the unpadded base32 form users type
+// into authenticator apps.
+func EncodeSecret(secret []byte) string {
+	return strings.TrimRight(base32.StdEncoding.EncodeToString(secret), "=")
+}
+
+// KeyURI returns the otpauth URI authenticator apps enroll a secret with.
+// https://github.com/google/google-authenticator/wiki/Key-Uri-Format
+func KeyURI(issuer, account string, secret []byte) string {
+	q := url.Values{}
+	q.Set("secret", EncodeSecret(secret))
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprintf("%d", totpDigits))
+	q.Set("period", fmt.Sprintf("%d", totpPeriod))
+	label := account
+	if issuer != "" {
+		q.Set("issuer", issuer)
+		label = issuer + ":" + account
+	}
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + label,
+		RawQuery: q.Encode(),
+	}
+	return u.String()
+}
+
+// Code returns the TOTP (RFC 6238) code of the secret at the given time.
+func Code(secret []byte, t time.Time) string {
+	return code(secret, timeStep(t))
+}
+
+func timeStep(t time.Time) int64 {
+	return t.Unix() / totpPeriod
+}
+
+// code computes the HOTP (RFC 4226) value of the secret for a counter.
+func code(secret []byte, counter int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	h := hmac.New(sha1.New, secret)
+	h.Write(msg[:])
+	sum := h.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0xf
+	v := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, v%totpModulus)
+}
+
+// validate returns the time step a code is valid for at the given time,
+// allowing for the clocks of the user's device and dex to differ by a step.
+func validate(secret []byte, c string, t time.Time) (int64, bool) {
+	now := timeStep(t)
+	for step := now - 1; step <= now+1; step++ {
+		if hmac.Equal([]byte(code(secret, step)), []byte(c)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
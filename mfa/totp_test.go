@@ -0,0 +1,67 @@
+package mfa
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// The SHA1 test vectors of RFC 6238, truncated to six digits.
+func TestCode(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1111111111, want: "050471"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+		{unix: 20000000000, want: "353130"},
+	}
+
+	for i, tt := range tests {
+		if got := Code(secret, time.Unix(tt.unix, 0)); got != tt.want {
+			t.Errorf("case %d: want=%s, got=%s", i, tt.want, got)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	now := time.Unix(1111111111, 0)
+
+	tests := []struct {
+		at     time.Time
+		wantOK bool
+	}{
+		{at: now, wantOK: true},
+		{at: now.Add(-30 * time.Second), wantOK: true},
+		{at: now.Add(30 * time.Second), wantOK: true},
+		{at: now.Add(-90 * time.Second), wantOK: false},
+		{at: now.Add(90 * time.Second), wantOK: false},
+	}
+
+	for i, tt := range tests {
+		step, ok := validate(secret, Code(secret, tt.at), now)
+		if ok != tt.wantOK {
+			t.Errorf("case %d: want ok=%t, got=%t", i, tt.wantOK, ok)
+			continue
+		}
+		if ok && step != timeStep(tt.at) {
+			t.Errorf("case %d: want step=%d, got=%d", i, timeStep(tt.at), step)
+		}
+	}
+}
+
+func TestKeyURI(t *testing.T) {
+	got := KeyURI("dex", "elroy@example.com", []byte("12345678901234567890"))
+	want := "otpauth://totp/dex:elroy@example.com?algorithm=SHA1&digits=6&issuer=dex&period=30&secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	if got != want {
+		t.Errorf("want=%s, got=%s", want, got)
+	}
+	if strings.Contains(EncodeSecret([]byte("1")), "=") {
+		t.Errorf("want unpadded secret, got=%s", EncodeSecret([]byte("1")))
+	}
+}
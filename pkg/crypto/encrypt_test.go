@@ -126,3 +126,10 @@ func TestEncryptDecryptGCM(t *testing.T) {
 		}
 	}
 }
+
+func TestDecryptGCMShortCiphertext(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := Decrypt([]byte("short"), key); err == nil {
+		t.Errorf("Expected an error decrypting a ciphertext shorter than the nonce")
+	}
+}
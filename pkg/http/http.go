@@ -2,6 +2,7 @@ package http
 
 import (
 	"encoding/json"
+	"net"
 	"net/http"
 	"net/url"
 	"path"
@@ -45,3 +46,12 @@ func NewResourceLocation(reqURL *url.URL, id string) string {
 	u.Fragment = ""
 	return u.String()
 }
+
+// RemoteIP returns the IP a request came from.
+func RemoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,162 @@
+package xmldsig
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+)
+
+// Canonicalize returns the exclusive canonical form, without comments, of the
+// element and its descendants, leaving out the skip element if it's one of
+// them. Namespaces with the inclusive prefixes ("#default" for the default
+// namespace) are rendered on the element even if it doesn't use them.
+// https://www.w3.org/TR/xml-exc-c14n/
+func Canonicalize(e *Element, skip *Element, inclusive []string) []byte {
+	c := &canonicalizer{skip: skip, inclusive: make(map[string]bool)}
+	for _, p := range inclusive {
+		if p == "#default" {
+			p = ""
+		}
+		c.inclusive[p] = true
+	}
+	c.element(e, map[string]string{"": ""})
+	return c.buf.Bytes()
+}
+
+type canonicalizer struct {
+	buf       bytes.Buffer
+	skip      *Element
+	inclusive map[string]bool
+}
+
+// element writes the canonical form of e. rendered holds the namespace
+// declarations in effect in the output at e's parent.
+func (c *canonicalizer) element(e *Element, rendered map[string]string) {
+	// Exclusive canonicalization renders the namespaces the element and its
+	// attributes visibly use, and those named in the inclusive prefix list,
+	// unless the output already has them in effect.
+	used := map[string]bool{e.Prefix: true}
+	for _, a := range e.Attrs {
+		if a.Prefix != "" && a.Prefix != "xml" {
+			used[a.Prefix] = true
+		}
+	}
+	for p := range c.inclusive {
+		if _, ok := e.lookupNS(p); ok {
+			used[p] = true
+		}
+	}
+
+	var prefixes []string
+	for p := range used {
+		uri, _ := e.lookupNS(p)
+		if cur, ok := rendered[p]; ok && cur == uri {
+			continue
+		}
+		if p != "" && uri == "" {
+			continue
+		}
+		prefixes = append(prefixes, p)
+	}
+	// The default namespace has the empty prefix, so it sorts first.
+	sort.Strings(prefixes)
+
+	if len(prefixes) > 0 {
+		next := make(map[string]string, len(rendered)+len(prefixes))
+		for p, uri := range rendered {
+			next[p] = uri
+		}
+		for _, p := range prefixes {
+			next[p], _ = e.lookupNS(p)
+		}
+		rendered = next
+	}
+
+	c.buf.WriteByte('<')
+	c.buf.WriteString(qname(e.Prefix, e.Local))
+	for _, p := range prefixes {
+		if p == "" {
+			c.buf.WriteString(` xmlns="`)
+		} else {
+			c.buf.WriteString(` xmlns:` + p + `="`)
+		}
+		c.buf.WriteString(escapeAttr(rendered[p]))
+		c.buf.WriteByte('"')
+	}
+
+	attrs := make([]Attr, len(e.Attrs))
+	copy(attrs, e.Attrs)
+	sort.Sort(byNamespace(attrs))
+	for _, a := range attrs {
+		c.buf.WriteByte(' ')
+		c.buf.WriteString(qname(a.Prefix, a.Local))
+		c.buf.WriteString(`="`)
+		c.buf.WriteString(escapeAttr(a.Value))
+		c.buf.WriteByte('"')
+	}
+	c.buf.WriteByte('>')
+
+	for _, child := range e.Children {
+		switch ch := child.(type) {
+		case *Element:
+			if ch != c.skip {
+				c.element(ch, rendered)
+			}
+		case CharData:
+			c.buf.WriteString(escapeText(string(ch)))
+		case ProcInst:
+			c.buf.WriteString("<?" + ch.Target)
+			if ch.Inst != "" {
+				c.buf.WriteString(" " + ch.Inst)
+			}
+			c.buf.WriteString("?>")
+		}
+	}
+
+	c.buf.WriteString("</" + qname(e.Prefix, e.Local) + ">")
+}
+
+func qname(prefix, local string) string {
+	if prefix == "" {
+		return local
+	}
+	return prefix + ":" + local
+}
+
+// byNamespace sorts attributes by namespace URI, then local name, so that
+// attributes in no namespace come first.
+type byNamespace []Attr
+
+func (a byNamespace) Len() int      { return len(a) }
+func (a byNamespace) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byNamespace) Less(i, j int) bool {
+	if a[i].Space != a[j].Space {
+		return a[i].Space < a[j].Space
+	}
+	return a[i].Local < a[j].Local
+}
+
+var (
+	attrEscaper = strings.NewReplacer(
+		"&", "&amp;",
+		"<", "&lt;",
+		`"`, "&quot;",
+		"\t", "&#x9;",
+		"\n", "&#xA;",
+		"\r", "&#xD;",
+	)
+	textEscaper = strings.NewReplacer(
+		"&", "&amp;",
+		"<", "&lt;",
+		">", "&gt;",
+		"\r", "&#xD;",
+	)
+)
+
+func escapeAttr(s string) string {
+	return attrEscaper.Replace(s)
+}
+
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
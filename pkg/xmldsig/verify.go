@@ -0,0 +1,188 @@
+// Package xmldsig verifies enveloped XML signatures, as used by SAML.
+//
+// Only the subset of XML Signature used in practice by SAML identity
+// providers is supported: a single reference to the signed element by ID, the
+// enveloped signature transform, exclusive canonicalization, and RSA
+// signatures.
+// https://www.w3.org/TR/xmldsig-core/
+package xmldsig
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	// Register the hash functions signatures may use.
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+const (
+	Namespace = "http://www.w3.org/2000/09/xmldsig#"
+
+	AlgExcC14N             = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	AlgEnvelopedSignature  = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+	AlgSHA1                = "http://www.w3.org/2000/09/xmldsig#sha1"
+	AlgSHA256              = "http://www.w3.org/2001/04/xmlenc#sha256"
+	AlgSHA512              = "http://www.w3.org/2001/04/xmlenc#sha512"
+	AlgRSASHA1             = "http://www.w3.org/2000/09/xmldsig#rsa-sha1"
+	AlgRSASHA256           = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	AlgRSASHA512           = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha512"
+	excC14NNamespace       = AlgExcC14N
+	inclusiveNamespacesTag = "InclusiveNamespaces"
+)
+
+var (
+	ErrMissingSignature = errors.New("xmldsig: element is not signed")
+	ErrInvalidSignature = errors.New("xmldsig: invalid signature")
+
+	digestAlgorithms = map[string]crypto.Hash{
+		AlgSHA1:   crypto.SHA1,
+		AlgSHA256: crypto.SHA256,
+		AlgSHA512: crypto.SHA512,
+	}
+	signatureAlgorithms = map[string]crypto.Hash{
+		AlgRSASHA1:   crypto.SHA1,
+		AlgRSASHA256: crypto.SHA256,
+		AlgRSASHA512: crypto.SHA512,
+	}
+)
+
+// Verify checks the enveloped signature of the element, which must be a
+// Signature child of the element referencing it by its ID attribute, against
+// the given certificates. It returns the canonical form of the element without
+// the signature, which is what the signature covers; callers should only
+// trust the data in it.
+func Verify(e *Element, certs []*x509.Certificate) ([]byte, error) {
+	sigs := e.FindChildren(Namespace, "Signature")
+	switch len(sigs) {
+	case 0:
+		return nil, ErrMissingSignature
+	case 1:
+	default:
+		return nil, errors.New("xmldsig: element has multiple signatures")
+	}
+	sig := sigs[0]
+
+	signedInfo := sig.FindChild(Namespace, "SignedInfo")
+	if signedInfo == nil {
+		return nil, errors.New("xmldsig: missing SignedInfo")
+	}
+
+	cm := signedInfo.FindChild(Namespace, "CanonicalizationMethod")
+	if cm == nil || cm.AttrValue("Algorithm") != AlgExcC14N {
+		return nil, errors.New("xmldsig: unsupported canonicalization method")
+	}
+
+	sm := signedInfo.FindChild(Namespace, "SignatureMethod")
+	if sm == nil {
+		return nil, errors.New("xmldsig: missing SignatureMethod")
+	}
+	sigHash, ok := signatureAlgorithms[sm.AttrValue("Algorithm")]
+	if !ok {
+		return nil, fmt.Errorf("xmldsig: unsupported signature method %q", sm.AttrValue("Algorithm"))
+	}
+
+	refs := signedInfo.FindChildren(Namespace, "Reference")
+	if len(refs) != 1 {
+		return nil, errors.New("xmldsig: signature must have exactly one reference")
+	}
+	ref := refs[0]
+
+	// Only references to the parent of the signature are accepted, so that
+	// what was verified is what the caller goes on to use.
+	id := e.AttrValue("ID")
+	if id == "" || ref.AttrValue("URI") != "#"+id {
+		return nil, errors.New("xmldsig: signature does not reference the signed element")
+	}
+
+	var (
+		enveloped bool
+		canonical bool
+		inclusive []string
+	)
+	if transforms := ref.FindChild(Namespace, "Transforms"); transforms != nil {
+		for _, t := range transforms.FindChildren(Namespace, "Transform") {
+			switch alg := t.AttrValue("Algorithm"); alg {
+			case AlgEnvelopedSignature:
+				enveloped = true
+			case AlgExcC14N:
+				canonical = true
+				inclusive = inclusivePrefixes(t)
+			default:
+				return nil, fmt.Errorf("xmldsig: unsupported transform %q", alg)
+			}
+		}
+	}
+	if !enveloped || !canonical {
+		return nil, errors.New("xmldsig: reference must use the enveloped signature and exclusive canonicalization transforms")
+	}
+
+	dm := ref.FindChild(Namespace, "DigestMethod")
+	if dm == nil {
+		return nil, errors.New("xmldsig: missing DigestMethod")
+	}
+	digestHash, ok := digestAlgorithms[dm.AttrValue("Algorithm")]
+	if !ok {
+		return nil, fmt.Errorf("xmldsig: unsupported digest method %q", dm.AttrValue("Algorithm"))
+	}
+	dv := ref.FindChild(Namespace, "DigestValue")
+	if dv == nil {
+		return nil, errors.New("xmldsig: missing DigestValue")
+	}
+	wantDigest, err := decodeBase64(dv.Text())
+	if err != nil {
+		return nil, fmt.Errorf("xmldsig: malformed DigestValue: %v", err)
+	}
+
+	signed := Canonicalize(e, sig, inclusive)
+	h := digestHash.New()
+	h.Write(signed)
+	if subtle.ConstantTimeCompare(h.Sum(nil), wantDigest) != 1 {
+		return nil, ErrInvalidSignature
+	}
+
+	sv := sig.FindChild(Namespace, "SignatureValue")
+	if sv == nil {
+		return nil, errors.New("xmldsig: missing SignatureValue")
+	}
+	sigValue, err := decodeBase64(sv.Text())
+	if err != nil {
+		return nil, fmt.Errorf("xmldsig: malformed SignatureValue: %v", err)
+	}
+
+	h = sigHash.New()
+	h.Write(Canonicalize(signedInfo, nil, inclusivePrefixes(cm)))
+	hashed := h.Sum(nil)
+	for _, cert := range certs {
+		key, ok := cert.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			continue
+		}
+		if rsa.VerifyPKCS1v15(key, sigHash, hashed, sigValue) == nil {
+			return signed, nil
+		}
+	}
+	return nil, ErrInvalidSignature
+}
+
+// inclusivePrefixes returns the PrefixList of the InclusiveNamespaces child of
+// a canonicalization method or transform.
+func inclusivePrefixes(e *Element) []string {
+	in := e.FindChild(excC14NNamespace, inclusiveNamespacesTag)
+	if in == nil {
+		return nil
+	}
+	return strings.Fields(in.AttrValue("PrefixList"))
+}
+
+func decodeBase64(s string) ([]byte, error) {
+	// Base64 in XML is commonly wrapped across lines.
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+}
@@ -0,0 +1,212 @@
+package xmldsig
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const xmlNamespace = "http://www.w3.org/XML/1998/namespace"
+
+// Element is an element of a parsed XML document. Unlike encoding/xml, it
+// keeps the namespace prefixes and declarations of the document, which are
+// needed to canonicalize it.
+type Element struct {
+	Prefix string
+	// Space is the namespace URI the prefix resolves to.
+	Space string
+	Local string
+
+	// Attrs are the attributes of the element, without namespace
+	// declarations.
+	Attrs []Attr
+
+	// Children are the *Element, CharData and ProcInst children of the
+	// element, in document order. Comments are dropped.
+	Children []interface{}
+
+	Parent *Element
+
+	// ns maps the prefixes declared on the element to their namespace URIs,
+	// with "" for the default namespace.
+	ns map[string]string
+}
+
+type Attr struct {
+	Prefix string
+	Space  string
+	Local  string
+	Value  string
+}
+
+type CharData string
+
+type ProcInst struct {
+	Target string
+	Inst   string
+}
+
+// Parse parses an XML document and returns its root element. Documents with
+// a DTD are rejected.
+func Parse(data []byte) (*Element, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+
+	var root, cur *Element
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if cur == nil && root != nil {
+				return nil, errors.New("xmldsig: multiple root elements")
+			}
+			e, err := newElement(t, cur)
+			if err != nil {
+				return nil, err
+			}
+			if cur == nil {
+				root = e
+			} else {
+				cur.Children = append(cur.Children, e)
+			}
+			cur = e
+		case xml.EndElement:
+			if cur == nil || t.Name.Space != cur.Prefix || t.Name.Local != cur.Local {
+				return nil, fmt.Errorf("xmldsig: unexpected end element %q", t.Name.Local)
+			}
+			cur = cur.Parent
+		case xml.CharData:
+			if cur != nil {
+				cur.Children = append(cur.Children, CharData(t))
+			} else if len(bytes.TrimSpace(t)) > 0 {
+				return nil, errors.New("xmldsig: character data outside of the root element")
+			}
+		case xml.ProcInst:
+			if cur != nil {
+				cur.Children = append(cur.Children, ProcInst{t.Target, string(t.Inst)})
+			}
+		case xml.Directive:
+			return nil, errors.New("xmldsig: directives are not supported")
+		}
+	}
+
+	if root == nil || cur != nil {
+		return nil, errors.New("xmldsig: incomplete document")
+	}
+	return root, nil
+}
+
+func newElement(t xml.StartElement, parent *Element) (*Element, error) {
+	e := &Element{
+		Prefix: t.Name.Space,
+		Local:  t.Name.Local,
+		Parent: parent,
+		ns:     make(map[string]string),
+	}
+
+	for _, a := range t.Attr {
+		switch {
+		case a.Name.Space == "xmlns":
+			e.ns[a.Name.Local] = a.Value
+		case a.Name.Space == "" && a.Name.Local == "xmlns":
+			e.ns[""] = a.Value
+		default:
+			e.Attrs = append(e.Attrs, Attr{Prefix: a.Name.Space, Local: a.Name.Local, Value: a.Value})
+		}
+	}
+
+	var ok bool
+	if e.Space, ok = e.lookupNS(e.Prefix); !ok {
+		return nil, fmt.Errorf("xmldsig: undeclared namespace prefix %q", e.Prefix)
+	}
+	for i, a := range e.Attrs {
+		// Unprefixed attributes are in no namespace.
+		if a.Prefix == "" {
+			continue
+		}
+		if e.Attrs[i].Space, ok = e.lookupNS(a.Prefix); !ok {
+			return nil, fmt.Errorf("xmldsig: undeclared namespace prefix %q", a.Prefix)
+		}
+	}
+	return e, nil
+}
+
+// lookupNS returns the namespace URI the prefix is bound to in the scope of
+// the element.
+func (e *Element) lookupNS(prefix string) (string, bool) {
+	if prefix == "xml" {
+		return xmlNamespace, true
+	}
+	for el := e; el != nil; el = el.Parent {
+		if uri, ok := el.ns[prefix]; ok {
+			return uri, true
+		}
+	}
+	// The default namespace is empty unless declared.
+	return "", prefix == ""
+}
+
+// ChildElements returns the child elements of the element.
+func (e *Element) ChildElements() []*Element {
+	var children []*Element
+	for _, c := range e.Children {
+		if el, ok := c.(*Element); ok {
+			children = append(children, el)
+		}
+	}
+	return children
+}
+
+// FindChildren returns the child elements with the given namespace and local
+// name.
+func (e *Element) FindChildren(space, local string) []*Element {
+	var children []*Element
+	for _, el := range e.ChildElements() {
+		if el.Space == space && el.Local == local {
+			children = append(children, el)
+		}
+	}
+	return children
+}
+
+// FindChild returns the first child element with the given namespace and
+// local name, or nil if there is none.
+func (e *Element) FindChild(space, local string) *Element {
+	children := e.FindChildren(space, local)
+	if len(children) == 0 {
+		return nil
+	}
+	return children[0]
+}
+
+// AttrValue returns the value of the unprefixed attribute with the given
+// name, or "" if there is none.
+func (e *Element) AttrValue(local string) string {
+	for _, a := range e.Attrs {
+		if a.Prefix == "" && a.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// Text returns the character data directly inside the element, with leading
+// and trailing white space removed.
+func (e *Element) Text() string {
+	var text string
+	for _, c := range e.Children {
+		if cd, ok := c.(CharData); ok {
+			text += string(cd)
+		}
+	}
+	return strings.TrimSpace(text)
+}
@@ -0,0 +1,281 @@
+package xmldsig
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+const samlAssertionNamespace = "urn:oasis:names:tc:SAML:2.0:assertion"
+
+func loadCert(t *testing.T, file string) *x509.Certificate {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		t.Fatalf("no PEM data in %s", file)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestCanonicalize(t *testing.T) {
+	tests := []struct {
+		doc       string
+		inclusive []string
+		want      string
+	}{
+		{
+			// Attributes are sorted and escaped, empty elements expanded, and
+			// unused namespaces dropped.
+			doc:  `<a xmlns="urn:a" xmlns:unused="urn:u" z="1" b='x &amp; "y"&#9;'><b/></a>`,
+			want: `<a xmlns="urn:a" b="x &amp; &quot;y&quot;&#x9;" z="1"><b></b></a>`,
+		},
+		{
+			// Namespaced attributes sort by namespace URI after those in no
+			// namespace, and namespaces are declared where they're used.
+			doc:  `<x:a xmlns:x="urn:x" xmlns:y="urn:b" xmlns:z="urn:a" y:k="1" z:k="2" k="3"><y:b>t &gt; &lt;</y:b></x:a>`,
+			want: `<x:a xmlns:x="urn:x" xmlns:y="urn:b" xmlns:z="urn:a" k="3" z:k="2" y:k="1"><y:b>t &gt; &lt;</y:b></x:a>`,
+		},
+		{
+			// The default namespace is undeclared where it changes back.
+			doc:  `<a xmlns="urn:a"><b xmlns=""><c/></b></a>`,
+			want: `<a xmlns="urn:a"><b xmlns=""><c></c></b></a>`,
+		},
+		{
+			// Inclusive prefixes are rendered even if unused.
+			doc:       `<a xmlns:x="urn:x" xmlns:y="urn:y"><b/></a>`,
+			inclusive: []string{"y"},
+			want:      `<a xmlns:y="urn:y"><b></b></a>`,
+		},
+	}
+
+	for i, tt := range tests {
+		e, err := Parse([]byte(tt.doc))
+		if err != nil {
+			t.Errorf("case %d: failed to parse: %v", i, err)
+			continue
+		}
+		if got := string(Canonicalize(e, nil, tt.inclusive)); got != tt.want {
+			t.Errorf("case %d: want=%s, got=%s", i, tt.want, got)
+		}
+	}
+}
+
+func TestCanonicalizeSubtree(t *testing.T) {
+	doc := `<r:root xmlns:r="urn:r" xmlns:s="urn:s" xmlns="urn:d"><s:child a="1"><grandchild/></s:child></r:root>`
+	e, err := Parse([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<s:child xmlns:s="urn:s" a="1"><grandchild xmlns="urn:d"></grandchild></s:child>`
+	if got := string(Canonicalize(e.ChildElements()[0], nil, nil)); got != want {
+		t.Errorf("want=%s, got=%s", want, got)
+	}
+}
+
+func TestParseRejectsDTD(t *testing.T) {
+	doc := `<!DOCTYPE a [<!ENTITY e "x">]><a>&e;</a>`
+	if _, err := Parse([]byte(doc)); err == nil {
+		t.Fatal("Expected documents with a DTD to be rejected.")
+	}
+}
+
+// TestVerifyFixture verifies a response signed by an independent
+// implementation.
+func TestVerifyFixture(t *testing.T) {
+	cert := loadCert(t, "testdata/idp.crt")
+	doc, err := ioutil.ReadFile("testdata/response.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		doc     []byte
+		wantErr bool
+	}{
+		{
+			doc: doc,
+		},
+		{
+			doc:     bytes.Replace(doc, []byte("jane@example.com"), []byte("john@example.com"), 1),
+			wantErr: true,
+		},
+		{
+			doc:     bytes.Replace(doc, []byte("Jane Doe"), []byte("Jane Roe"), 1),
+			wantErr: true,
+		},
+	}
+
+	for i, tt := range tests {
+		root, err := Parse(tt.doc)
+		if err != nil {
+			t.Fatalf("case %d: failed to parse: %v", i, err)
+		}
+		assertion := root.FindChild(samlAssertionNamespace, "Assertion")
+		signed, err := Verify(assertion, []*x509.Certificate{cert})
+		if tt.wantErr {
+			if err != ErrInvalidSignature {
+				t.Errorf("case %d: want err=%v, got=%v", i, ErrInvalidSignature, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if bytes.Contains(signed, []byte("Signature")) {
+			t.Errorf("case %d: signed data contains the signature: %s", i, signed)
+		}
+		if !bytes.Contains(signed, []byte("jane@example.com")) {
+			t.Errorf("case %d: signed data is missing the NameID: %s", i, signed)
+		}
+	}
+}
+
+func newTestKey(t *testing.T) (*rsa.PrivateKey, *x509.Certificate) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, cert
+}
+
+// sign signs the element with the given ID in doc, where the %s verb marks
+// the place of the signature, and returns the signed document.
+func sign(t *testing.T, key *rsa.PrivateKey, doc, id, refURI string) string {
+	unsigned, err := Parse([]byte(fmt.Sprintf(doc, "")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var signed *Element
+	var find func(e *Element)
+	find = func(e *Element) {
+		if e.AttrValue("ID") == id {
+			signed = e
+		}
+		for _, c := range e.ChildElements() {
+			find(c)
+		}
+	}
+	find(unsigned)
+	digest := sha256.Sum256(Canonicalize(signed, nil, nil))
+
+	signedInfo := `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#">` +
+		`<ds:CanonicalizationMethod Algorithm="` + AlgExcC14N + `"/>` +
+		`<ds:SignatureMethod Algorithm="` + AlgRSASHA256 + `"/>` +
+		`<ds:Reference URI="` + refURI + `"><ds:Transforms>` +
+		`<ds:Transform Algorithm="` + AlgEnvelopedSignature + `"/>` +
+		`<ds:Transform Algorithm="` + AlgExcC14N + `"/>` +
+		`</ds:Transforms><ds:DigestMethod Algorithm="` + AlgSHA256 + `"/>` +
+		`<ds:DigestValue>` + base64.StdEncoding.EncodeToString(digest[:]) + `</ds:DigestValue>` +
+		`</ds:Reference></ds:SignedInfo>`
+	si, err := Parse([]byte(signedInfo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashed := sha256.Sum256(Canonicalize(si, nil, nil))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signature := `<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#">` +
+		strings.Replace(signedInfo, ` xmlns:ds="http://www.w3.org/2000/09/xmldsig#"`, "", 1) +
+		`<ds:SignatureValue>` + base64.StdEncoding.EncodeToString(sig) + `</ds:SignatureValue></ds:Signature>`
+	return fmt.Sprintf(doc, signature)
+}
+
+func TestVerify(t *testing.T) {
+	key, cert := newTestKey(t)
+	_, otherCert := newTestKey(t)
+
+	doc := `<a:Outer xmlns:a="urn:a" ID="outer"><a:Inner ID="inner">%s<a:Data>secret</a:Data></a:Inner></a:Outer>`
+
+	tests := []struct {
+		doc     string
+		certs   []*x509.Certificate
+		wantErr bool
+	}{
+		{
+			doc:   sign(t, key, doc, "inner", "#inner"),
+			certs: []*x509.Certificate{cert},
+		},
+		{
+			doc:   sign(t, key, doc, "inner", "#inner"),
+			certs: []*x509.Certificate{otherCert, cert},
+		},
+		// Signed by another key.
+		{
+			doc:     sign(t, key, doc, "inner", "#inner"),
+			certs:   []*x509.Certificate{otherCert},
+			wantErr: true,
+		},
+		// The signature must reference its parent.
+		{
+			doc:     sign(t, key, doc, "outer", "#outer"),
+			certs:   []*x509.Certificate{cert},
+			wantErr: true,
+		},
+		// Not signed at all.
+		{
+			doc:     fmt.Sprintf(doc, ""),
+			certs:   []*x509.Certificate{cert},
+			wantErr: true,
+		},
+	}
+
+	for i, tt := range tests {
+		root, err := Parse([]byte(tt.doc))
+		if err != nil {
+			t.Fatalf("case %d: failed to parse: %v", i, err)
+		}
+		inner := root.FindChild("urn:a", "Inner")
+		signed, err := Verify(inner, tt.certs)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("case %d: expected an error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		want := `<a:Inner xmlns:a="urn:a" ID="inner"><a:Data>secret</a:Data></a:Inner>`
+		if string(signed) != want {
+			t.Errorf("case %d: want=%s, got=%s", i, want, signed)
+		}
+	}
+}
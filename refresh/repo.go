@@ -3,6 +3,7 @@ package refresh
 import (
 	"crypto/rand"
 	"errors"
+	"time"
 
 	"github.com/coreos/dex/client"
 )
@@ -17,8 +18,24 @@ var (
 	ErrorInvalidClientID = errors.New("invalid client ID")
 
 	ErrorInvalidToken = errors.New("invalid token")
+
+	// ErrorTokenReused is returned when a refresh token which has already
+	// been exchanged for a new one is presented again. This suggests the
+	// token was stolen, so the whole token family is revoked.
+	ErrorTokenReused = errors.New("refresh token reused")
 )
 
+// RepoOptions bound how long refresh tokens can be used. A zero duration
+// means no limit.
+type RepoOptions struct {
+	// AbsoluteLifetime is how long a token family can be used for, counted
+	// from when the first token of the family was issued.
+	AbsoluteLifetime time.Duration
+
+	// IdleTimeout is how long a token stays valid without being used.
+	IdleTimeout time.Duration
+}
+
 type RefreshTokenGenerator func() ([]byte, error)
 
 func (g RefreshTokenGenerator) Generate() ([]byte, error) {
@@ -38,16 +55,28 @@ func DefaultRefreshTokenGenerator() ([]byte, error) {
 	return b, nil
 }
 
+// RefreshTokenRepo stores rotating refresh tokens: every time a refresh token
+// is used a new one is issued in its place, and the old one is retired. The
+// tokens descending from the same Create call form a token family.
 type RefreshTokenRepo interface {
-	// Create generates and returns a new refresh token for the given client-user pair.
+	// Create generates and returns a new refresh token for the given client-user pair,
+	// starting a new token family. The scope is the one the user granted the client,
+	// and is carried over to the rest of the family.
 	// On success the token will be return.
-	Create(userID, clientID string) (string, error)
+	Create(userID, clientID string, scope []string) (string, error)
 
 	// Verify verifies that a token belongs to the client, and returns the corresponding user ID.
+	// Retired and expired tokens are invalid.
 	// Note that this assumes the client validation is currently done in the application layer,
 	Verify(clientID, token string) (string, error)
 
-	// Revoke deletes the refresh token if the token belongs to the given userID.
+	// Rotate verifies the token like Verify, retires it and returns a new token of the
+	// same family along with the corresponding user ID and scope. If the token was already
+	// retired, the whole family is revoked and ErrorTokenReused is returned.
+	Rotate(clientID, token string) (newToken, userID string, scope []string, err error)
+
+	// Revoke deletes the refresh token, and the rest of its family, if the token belongs
+	// to the given userID.
 	Revoke(userID, token string) error
 
 	// RevokeTokensForClient revokes all tokens issued for the userID for the provided client.
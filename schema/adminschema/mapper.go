@@ -13,6 +13,7 @@ var (
 	ErrorInvalidRedirectURI = errors.New("Invalid Redirect URI")
 	ErrorInvalidLogoURI     = errors.New("Invalid Logo URI")
 	ErrorInvalidClientURI   = errors.New("Invalid Client URI")
+	ErrorInvalidLogoutURI   = errors.New("Invalid Logout URI")
 )
 
 func MapSchemaClientToClient(sc Client) (client.Client, error) {
@@ -56,7 +57,34 @@ func MapSchemaClientToClient(sc Client) (client.Client, error) {
 		c.Metadata.ClientURI = clientURI
 	}
 
+	for _, pu := range sc.PostLogoutRedirectURIs {
+		u, err := url.Parse(pu)
+		if err != nil || !client.ValidLogoutURI(*u) {
+			return client.Client{}, ErrorInvalidLogoutURI
+		}
+		c.PostLogoutRedirectURIs = append(c.PostLogoutRedirectURIs, *u)
+	}
+
+	if sc.FrontChannelLogoutURI != "" {
+		u, err := url.Parse(sc.FrontChannelLogoutURI)
+		if err != nil || !client.ValidLogoutURI(*u) {
+			return client.Client{}, ErrorInvalidLogoutURI
+		}
+		c.FrontChannelLogoutURI = u
+	}
+
+	if sc.BackChannelLogoutURI != "" {
+		u, err := url.Parse(sc.BackChannelLogoutURI)
+		if err != nil || !client.ValidLogoutURI(*u) {
+			return client.Client{}, ErrorInvalidLogoutURI
+		}
+		c.BackChannelLogoutURI = u
+	}
+
 	c.Admin = sc.IsAdmin
+	c.Public = sc.IsPublic
+	c.RequireMFA = sc.RequireMFA
+	c.FirstParty = sc.FirstParty
 	return c, nil
 }
 
@@ -78,6 +106,18 @@ func MapClientToSchemaClient(c client.Client) Client {
 	if c.Metadata.ClientURI != nil {
 		cl.ClientURI = c.Metadata.ClientURI.String()
 	}
+	for _, u := range c.PostLogoutRedirectURIs {
+		cl.PostLogoutRedirectURIs = append(cl.PostLogoutRedirectURIs, u.String())
+	}
+	if c.FrontChannelLogoutURI != nil {
+		cl.FrontChannelLogoutURI = c.FrontChannelLogoutURI.String()
+	}
+	if c.BackChannelLogoutURI != nil {
+		cl.BackChannelLogoutURI = c.BackChannelLogoutURI.String()
+	}
 	cl.IsAdmin = c.Admin
+	cl.IsPublic = c.Public
+	cl.RequireMFA = c.RequireMFA
+	cl.FirstParty = c.FirstParty
 	return cl
 }
@@ -43,6 +43,31 @@ func TestMapSchemaClientToClient(t *testing.T) {
 					ClientURI:  mustParseURL(t, "https://clientURI.example.com"),
 				},
 			},
+		}, {
+			sc: Client{
+				Id:                     "123",
+				Secret:                 "sec_123",
+				RedirectURIs:           []string{"https://client.example.com"},
+				PostLogoutRedirectURIs: []string{"https://client.example.com/logged-out"},
+				FrontChannelLogoutURI:  "https://client.example.com/frontchannel-logout",
+				BackChannelLogoutURI:   "https://client.example.com/backchannel-logout",
+			},
+			want: client.Client{
+				Credentials: oidc.ClientCredentials{
+					ID:     "123",
+					Secret: "sec_123",
+				},
+				Metadata: oidc.ClientMetadata{
+					RedirectURIs: []url.URL{
+						*mustParseURL(t, "https://client.example.com"),
+					},
+				},
+				PostLogoutRedirectURIs: []url.URL{
+					*mustParseURL(t, "https://client.example.com/logged-out"),
+				},
+				FrontChannelLogoutURI: mustParseURL(t, "https://client.example.com/frontchannel-logout"),
+				BackChannelLogoutURI:  mustParseURL(t, "https://client.example.com/backchannel-logout"),
+			},
 		}, {
 			sc: Client{
 				Id:     "123",
@@ -52,6 +77,22 @@ func TestMapSchemaClientToClient(t *testing.T) {
 				},
 			},
 			wantErr: true,
+		}, {
+			sc: Client{
+				Id:                    "123",
+				Secret:                "sec_123",
+				RedirectURIs:          []string{"https://client.example.com"},
+				FrontChannelLogoutURI: "ht.d://p * * *",
+			},
+			wantErr: true,
+		}, {
+			sc: Client{
+				Id:                     "123",
+				Secret:                 "sec_123",
+				RedirectURIs:           []string{"https://client.example.com"},
+				PostLogoutRedirectURIs: []string{"/logged-out"},
+			},
+			wantErr: true,
 		},
 	}
 
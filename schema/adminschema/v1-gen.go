@@ -46,8 +46,15 @@ func New(client *http.Client) (*Service, error) {
 	}
 	s := &Service{client: client, BasePath: basePath}
 	s.Admin = NewAdminService(s)
+	s.AuditEvents = NewAuditEventsService(s)
 	s.Client = NewClientService(s)
 	s.Connectors = NewConnectorsService(s)
+	s.GroupMembers = NewGroupMembersService(s)
+	s.Groups = NewGroupsService(s)
+	s.InitialAccessTokens = NewInitialAccessTokensService(s)
+	s.Lockouts = NewLockoutsService(s)
+	s.MFA = NewMFAService(s)
+	s.RemoteIdentities = NewRemoteIdentitiesService(s)
 	s.State = NewStateService(s)
 	return s, nil
 }
@@ -58,10 +65,24 @@ type Service struct {
 
 	Admin *AdminService
 
+	AuditEvents *AuditEventsService
+
 	Client *ClientService
 
 	Connectors *ConnectorsService
 
+	GroupMembers *GroupMembersService
+
+	Groups *GroupsService
+
+	InitialAccessTokens *InitialAccessTokensService
+
+	Lockouts *LockoutsService
+
+	MFA *MFAService
+
+	RemoteIdentities *RemoteIdentitiesService
+
 	State *StateService
 }
 
@@ -74,6 +95,15 @@ type AdminService struct {
 	s *Service
 }
 
+func NewAuditEventsService(s *Service) *AuditEventsService {
+	rs := &AuditEventsService{s: s}
+	return rs
+}
+
+type AuditEventsService struct {
+	s *Service
+}
+
 func NewClientService(s *Service) *ClientService {
 	rs := &ClientService{s: s}
 	return rs
@@ -92,6 +122,60 @@ type ConnectorsService struct {
 	s *Service
 }
 
+func NewGroupMembersService(s *Service) *GroupMembersService {
+	rs := &GroupMembersService{s: s}
+	return rs
+}
+
+type GroupMembersService struct {
+	s *Service
+}
+
+func NewGroupsService(s *Service) *GroupsService {
+	rs := &GroupsService{s: s}
+	return rs
+}
+
+type GroupsService struct {
+	s *Service
+}
+
+func NewInitialAccessTokensService(s *Service) *InitialAccessTokensService {
+	rs := &InitialAccessTokensService{s: s}
+	return rs
+}
+
+type InitialAccessTokensService struct {
+	s *Service
+}
+
+func NewLockoutsService(s *Service) *LockoutsService {
+	rs := &LockoutsService{s: s}
+	return rs
+}
+
+type LockoutsService struct {
+	s *Service
+}
+
+func NewMFAService(s *Service) *MFAService {
+	rs := &MFAService{s: s}
+	return rs
+}
+
+type MFAService struct {
+	s *Service
+}
+
+func NewRemoteIdentitiesService(s *Service) *RemoteIdentitiesService {
+	rs := &RemoteIdentitiesService{s: s}
+	return rs
+}
+
+type RemoteIdentitiesService struct {
+	s *Service
+}
+
 func NewStateService(s *Service) *StateService {
 	rs := &StateService{s: s}
 	return rs
@@ -109,7 +193,39 @@ type Admin struct {
 	Password string `json:"password,omitempty"`
 }
 
+type AuditEvent struct {
+	ClientID string `json:"clientID,omitempty"`
+
+	ConnectorID string `json:"connectorID,omitempty"`
+
+	// Details: Further information depending on the type of the event.
+	Details map[string]string `json:"details,omitempty"`
+
+	Id string `json:"id,omitempty"`
+
+	// Ip: The address the request causing the event came from, if known.
+	Ip string `json:"ip,omitempty"`
+
+	Time string `json:"time,omitempty"`
+
+	// Type: The type of the event, e.g. "login.failed" or
+	// "admin.client_deleted".
+	Type string `json:"type,omitempty"`
+
+	UserID string `json:"userID,omitempty"`
+}
+
+type AuditEventsResponse struct {
+	AuditEvents []*AuditEvent `json:"auditEvents,omitempty"`
+
+	NextPageToken string `json:"nextPageToken,omitempty"`
+}
+
 type Client struct {
+	// BackChannelLogoutURI: OPTIONAL. URL sent a logout token when the user
+	// logs out.
+	BackChannelLogoutURI string `json:"backChannelLogoutURI,omitempty"`
+
 	// ClientName: OPTIONAL. Name of the Client to be presented to the
 	// End-User. If desired, representation of this Claim in different
 	// languages and scripts is represented as described in Section 2.1 (
@@ -124,11 +240,24 @@ type Client struct {
 	// Languages and Scripts ) .
 	ClientURI string `json:"clientURI,omitempty"`
 
-	// Id: The client ID. Ignored in client create requests.
+	// FirstParty: Users logging in to first-party clients aren't asked to
+	// consent to the scopes the client requests.
+	FirstParty bool `json:"firstParty,omitempty"`
+
+	// FrontChannelLogoutURI: OPTIONAL. URL loaded in an iframe of the
+	// logout page, so that the client can clear the user's session.
+	FrontChannelLogoutURI string `json:"frontChannelLogoutURI,omitempty"`
+
+	// Id: The client ID. Ignored in client create and update requests.
 	Id string `json:"id,omitempty"`
 
 	IsAdmin bool `json:"isAdmin,omitempty"`
 
+	// IsPublic: Public clients, such as native and mobile apps, can't keep
+	// their secret confidential. They may exchange codes at the token
+	// endpoint without a secret, provided PKCE (RFC 7636) is used.
+	IsPublic bool `json:"isPublic,omitempty"`
+
 	// LogoURI: OPTIONAL. URL that references a logo for the Client
 	// application. If present, the server SHOULD display this image to the
 	// End-User during approval. The value of this field MUST point to a
@@ -137,6 +266,11 @@ type Client struct {
 	// Section 2.1 ( Metadata Languages and Scripts ) .
 	LogoURI string `json:"logoURI,omitempty"`
 
+	// PostLogoutRedirectURIs: OPTIONAL. URLs the client may ask the
+	// user-agent to be sent back to, with the post_logout_redirect_uri
+	// parameter, once the user logged out.
+	PostLogoutRedirectURIs []string `json:"postLogoutRedirectURIs,omitempty"`
+
 	// RedirectURIs: REQUIRED. Array of Redirection URI values used by the
 	// Client. One of these registered Redirection URI values MUST exactly
 	// match the redirect_uri parameter value used in each Authorization
@@ -146,7 +280,12 @@ type Client struct {
 	// 2005. ) (Simple String Comparison).
 	RedirectURIs []string `json:"redirectURIs,omitempty"`
 
-	// Secret: The client secret. Ignored in client create requests.
+	// RequireMFA: Users logging in to the client with a password of the
+	// local connector must use a second factor.
+	RequireMFA bool `json:"requireMFA,omitempty"`
+
+	// Secret: The client secret. Ignored in client create and update
+	// requests, and never returned when retrieving clients.
 	Secret string `json:"secret,omitempty"`
 }
 
@@ -158,6 +297,26 @@ type ClientCreateResponse struct {
 	Client *Client `json:"client,omitempty"`
 }
 
+type ClientSecretRotateRequest struct {
+	// OverlapSeconds: How long the replaced secret keeps working, in
+	// seconds. If zero, it stops working at once.
+	OverlapSeconds int64 `json:"overlapSeconds,omitempty"`
+}
+
+type ClientSecretRotateResponse struct {
+	Id string `json:"id,omitempty"`
+
+	// PreviousSecretExpiresAt: When the replaced secret stops working, in
+	// RFC 3339 format. Empty if it already has.
+	PreviousSecretExpiresAt string `json:"previousSecretExpiresAt,omitempty"`
+
+	Secret string `json:"secret,omitempty"`
+}
+
+type ClientsResponse struct {
+	Clients []*Client `json:"clients,omitempty"`
+}
+
 type Connector interface{}
 
 type ConnectorsGetResponse struct {
@@ -168,6 +327,91 @@ type ConnectorsSetRequest struct {
 	Connectors []interface{} `json:"connectors,omitempty"`
 }
 
+type Group struct {
+	Id string `json:"id,omitempty"`
+
+	Name string `json:"name,omitempty"`
+}
+
+type GroupMembersResponse struct {
+	Members []string `json:"members,omitempty"`
+}
+
+type GroupsResponse struct {
+	Groups []*Group `json:"groups,omitempty"`
+}
+
+type InitialAccessToken struct {
+	// CreatedAt: When the token was created, in RFC 3339 format.
+	CreatedAt string `json:"createdAt,omitempty"`
+
+	// ExpiresAt: When the token stops working, in RFC 3339 format.
+	ExpiresAt string `json:"expiresAt,omitempty"`
+
+	// Id: Identifies the token without revealing it.
+	Id string `json:"id,omitempty"`
+
+	// MaxUses: The number of clients the token can register. If zero, it
+	// can register any number of clients until it expires.
+	MaxUses int64 `json:"maxUses,omitempty"`
+
+	// Uses: The number of clients the token has registered.
+	Uses int64 `json:"uses,omitempty"`
+}
+
+type InitialAccessTokenCreateRequest struct {
+	// ExpiresInSeconds: How long the token works for, in seconds. If zero,
+	// it works for a day.
+	ExpiresInSeconds int64 `json:"expiresInSeconds,omitempty"`
+
+	// MaxUses: The number of clients the token can register. If zero, it
+	// can register any number of clients until it expires.
+	MaxUses int64 `json:"maxUses,omitempty"`
+}
+
+type InitialAccessTokenCreateResponse struct {
+	InitialAccessToken *InitialAccessToken `json:"initialAccessToken,omitempty"`
+
+	// Token: The token, to be passed as a bearer token to the registration
+	// endpoint. It is only ever returned in this response.
+	Token string `json:"token,omitempty"`
+}
+
+type InitialAccessTokensResponse struct {
+	InitialAccessTokens []*InitialAccessToken `json:"initialAccessTokens,omitempty"`
+}
+
+type Lockout struct {
+	// ConnectorID: The connector of a locked account; empty for IPs.
+	ConnectorID string `json:"connectorID,omitempty"`
+
+	Failures int64 `json:"failures,omitempty"`
+
+	Id string `json:"id,omitempty"`
+
+	// Kind: Either "account" or "ip".
+	Kind string `json:"kind,omitempty"`
+
+	LockedUntil string `json:"lockedUntil,omitempty"`
+
+	// Subject: The account name as entered by the user, or the IP.
+	Subject string `json:"subject,omitempty"`
+}
+
+type LockoutsResponse struct {
+	Lockouts []*Lockout `json:"lockouts,omitempty"`
+}
+
+type RemoteIdentitiesResponse struct {
+	RemoteIdentities []*RemoteIdentity `json:"remoteIdentities,omitempty"`
+}
+
+type RemoteIdentity struct {
+	ConnectorID string `json:"connectorID,omitempty"`
+
+	Id string `json:"id,omitempty"`
+}
+
 type State struct {
 	AdminUserCreated bool `json:"AdminUserCreated,omitempty"`
 }
@@ -313,6 +557,132 @@ func (c *AdminGetCall) Do() (*Admin, error) {
 
 }
 
+// method id "dex.admin.AuditEvent.List":
+
+type AuditEventsListCall struct {
+	s    *Service
+	opt_ map[string]interface{}
+}
+
+// List: Retrieve a page of audit events, newest first, optionally only
+// those of a type, user or client.
+func (r *AuditEventsService) List() *AuditEventsListCall {
+	c := &AuditEventsListCall{s: r.s, opt_: make(map[string]interface{})}
+	return c
+}
+
+// ClientID sets the optional parameter "clientID":
+func (c *AuditEventsListCall) ClientID(clientID string) *AuditEventsListCall {
+	c.opt_["clientID"] = clientID
+	return c
+}
+
+// MaxResults sets the optional parameter "maxResults":
+func (c *AuditEventsListCall) MaxResults(maxResults int64) *AuditEventsListCall {
+	c.opt_["maxResults"] = maxResults
+	return c
+}
+
+// NextPageToken sets the optional parameter "nextPageToken":
+func (c *AuditEventsListCall) NextPageToken(nextPageToken string) *AuditEventsListCall {
+	c.opt_["nextPageToken"] = nextPageToken
+	return c
+}
+
+// Type sets the optional parameter "type":
+func (c *AuditEventsListCall) Type(type_ string) *AuditEventsListCall {
+	c.opt_["type"] = type_
+	return c
+}
+
+// UserID sets the optional parameter "userID":
+func (c *AuditEventsListCall) UserID(userID string) *AuditEventsListCall {
+	c.opt_["userID"] = userID
+	return c
+}
+
+// Fields allows partial responses to be retrieved.
+// See https://developers.google.com/gdata/docs/2.0/basics#PartialResponse
+// for more information.
+func (c *AuditEventsListCall) Fields(s ...googleapi.Field) *AuditEventsListCall {
+	c.opt_["fields"] = googleapi.CombineFields(s)
+	return c
+}
+
+func (c *AuditEventsListCall) Do() (*AuditEventsResponse, error) {
+	var body io.Reader = nil
+	params := make(url.Values)
+	params.Set("alt", "json")
+	if v, ok := c.opt_["clientID"]; ok {
+		params.Set("clientID", fmt.Sprintf("%v", v))
+	}
+	if v, ok := c.opt_["maxResults"]; ok {
+		params.Set("maxResults", fmt.Sprintf("%v", v))
+	}
+	if v, ok := c.opt_["nextPageToken"]; ok {
+		params.Set("nextPageToken", fmt.Sprintf("%v", v))
+	}
+	if v, ok := c.opt_["type"]; ok {
+		params.Set("type", fmt.Sprintf("%v", v))
+	}
+	if v, ok := c.opt_["userID"]; ok {
+		params.Set("userID", fmt.Sprintf("%v", v))
+	}
+	if v, ok := c.opt_["fields"]; ok {
+		params.Set("fields", fmt.Sprintf("%v", v))
+	}
+	urls := googleapi.ResolveRelative(c.s.BasePath, "audit-events")
+	urls += "?" + params.Encode()
+	req, _ := http.NewRequest("GET", urls, body)
+	googleapi.SetOpaque(req.URL)
+	req.Header.Set("User-Agent", "google-api-go-client/0.5")
+	res, err := c.s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer googleapi.CloseBody(res)
+	if err := googleapi.CheckResponse(res); err != nil {
+		return nil, err
+	}
+	var ret *AuditEventsResponse
+	if err := json.NewDecoder(res.Body).Decode(&ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+	// {
+	//   "description": "Retrieve a page of audit events, newest first, optionally only those of a type, user or client.",
+	//   "httpMethod": "GET",
+	//   "id": "dex.admin.AuditEvent.List",
+	//   "parameters": {
+	//     "clientID": {
+	//       "location": "query",
+	//       "type": "string"
+	//     },
+	//     "maxResults": {
+	//       "location": "query",
+	//       "type": "integer"
+	//     },
+	//     "nextPageToken": {
+	//       "location": "query",
+	//       "type": "string"
+	//     },
+	//     "type": {
+	//       "location": "query",
+	//       "type": "string"
+	//     },
+	//     "userID": {
+	//       "location": "query",
+	//       "type": "string"
+	//     }
+	//   },
+	//   "path": "audit-events",
+	//   "response": {
+	//     "$ref": "AuditEventsResponse"
+	//   }
+	// }
+
+}
+
 // method id "dex.admin.Client.Create":
 
 type ClientCreateCall struct {
@@ -382,108 +752,1344 @@ func (c *ClientCreateCall) Do() (*ClientCreateResponse, error) {
 
 }
 
-// method id "dex.admin.Connector.Get":
+// method id "dex.admin.Client.Delete":
 
-type ConnectorsGetCall struct {
+type ClientDeleteCall struct {
 	s    *Service
+	id   string
 	opt_ map[string]interface{}
 }
 
-// Get: Return a list of the connectors for the dex system.
-func (r *ConnectorsService) Get() *ConnectorsGetCall {
-	c := &ConnectorsGetCall{s: r.s, opt_: make(map[string]interface{})}
+// Delete: Delete a client and revoke the access and refresh tokens issued to it. A
+// 204 status code indicates the action was successful.
+func (r *ClientService) Delete(id string) *ClientDeleteCall {
+	c := &ClientDeleteCall{s: r.s, opt_: make(map[string]interface{})}
+	c.id = id
 	return c
 }
 
 // Fields allows partial responses to be retrieved.
 // See https://developers.google.com/gdata/docs/2.0/basics#PartialResponse
 // for more information.
-func (c *ConnectorsGetCall) Fields(s ...googleapi.Field) *ConnectorsGetCall {
+func (c *ClientDeleteCall) Fields(s ...googleapi.Field) *ClientDeleteCall {
 	c.opt_["fields"] = googleapi.CombineFields(s)
 	return c
 }
 
-func (c *ConnectorsGetCall) Do() (*ConnectorsGetResponse, error) {
+func (c *ClientDeleteCall) Do() error {
 	var body io.Reader = nil
 	params := make(url.Values)
 	params.Set("alt", "json")
 	if v, ok := c.opt_["fields"]; ok {
 		params.Set("fields", fmt.Sprintf("%v", v))
 	}
-	urls := googleapi.ResolveRelative(c.s.BasePath, "connectors")
+	urls := googleapi.ResolveRelative(c.s.BasePath, "client/{id}")
 	urls += "?" + params.Encode()
-	req, _ := http.NewRequest("GET", urls, body)
-	googleapi.SetOpaque(req.URL)
+	req, _ := http.NewRequest("DELETE", urls, body)
+	googleapi.Expand(req.URL, map[string]string{
+		"id": c.id,
+	})
 	req.Header.Set("User-Agent", "google-api-go-client/0.5")
 	res, err := c.s.client.Do(req)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer googleapi.CloseBody(res)
 	if err := googleapi.CheckResponse(res); err != nil {
-		return nil, err
-	}
-	var ret *ConnectorsGetResponse
-	if err := json.NewDecoder(res.Body).Decode(&ret); err != nil {
-		return nil, err
+		return err
 	}
-	return ret, nil
+	return nil
 	// {
-	//   "description": "Return a list of the connectors for the dex system.",
-	//   "httpMethod": "GET",
-	//   "id": "dex.admin.Connector.Get",
-	//   "path": "connectors",
-	//   "response": {
-	//     "$ref": "ConnectorsGetResponse"
-	//   }
+	//   "description": "Delete a client and revoke the access and refresh tokens issued to it. A 204 status code indicates the action was successful.",
+	//   "httpMethod": "DELETE",
+	//   "id": "dex.admin.Client.Delete",
+	//   "parameterOrder": [
+	//     "id"
+	//   ],
+	//   "parameters": {
+	//     "id": {
+	//       "location": "path",
+	//       "required": true,
+	//       "type": "string"
+	//     }
+	//   },
+	//   "path": "client/{id}"
 	// }
 
 }
 
-// method id "dex.admin.Connector.Set":
+// method id "dex.admin.Client.Get":
 
-type ConnectorsSetCall struct {
-	s                    *Service
-	connectorssetrequest *ConnectorsSetRequest
-	opt_                 map[string]interface{}
+type ClientGetCall struct {
+	s    *Service
+	id   string
+	opt_ map[string]interface{}
 }
 
-// Set: Set the list of connectors for the dex system, overwriting all
-// previous connectors. A 200 status code indicates the action was
-// successful.
-func (r *ConnectorsService) Set(connectorssetrequest *ConnectorsSetRequest) *ConnectorsSetCall {
-	c := &ConnectorsSetCall{s: r.s, opt_: make(map[string]interface{})}
-	c.connectorssetrequest = connectorssetrequest
+// Get: Retrieve information about a client. Its secret is not returned.
+func (r *ClientService) Get(id string) *ClientGetCall {
+	c := &ClientGetCall{s: r.s, opt_: make(map[string]interface{})}
+	c.id = id
 	return c
 }
 
 // Fields allows partial responses to be retrieved.
 // See https://developers.google.com/gdata/docs/2.0/basics#PartialResponse
 // for more information.
-func (c *ConnectorsSetCall) Fields(s ...googleapi.Field) *ConnectorsSetCall {
+func (c *ClientGetCall) Fields(s ...googleapi.Field) *ClientGetCall {
 	c.opt_["fields"] = googleapi.CombineFields(s)
 	return c
 }
 
-func (c *ConnectorsSetCall) Do() error {
+func (c *ClientGetCall) Do() (*Client, error) {
 	var body io.Reader = nil
-	body, err := googleapi.WithoutDataWrapper.JSONReader(c.connectorssetrequest)
-	if err != nil {
-		return err
-	}
-	ctype := "application/json"
 	params := make(url.Values)
 	params.Set("alt", "json")
 	if v, ok := c.opt_["fields"]; ok {
 		params.Set("fields", fmt.Sprintf("%v", v))
 	}
-	urls := googleapi.ResolveRelative(c.s.BasePath, "connectors")
+	urls := googleapi.ResolveRelative(c.s.BasePath, "client/{id}")
 	urls += "?" + params.Encode()
-	req, _ := http.NewRequest("PUT", urls, body)
-	googleapi.SetOpaque(req.URL)
+	req, _ := http.NewRequest("GET", urls, body)
+	googleapi.Expand(req.URL, map[string]string{
+		"id": c.id,
+	})
+	req.Header.Set("User-Agent", "google-api-go-client/0.5")
+	res, err := c.s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer googleapi.CloseBody(res)
+	if err := googleapi.CheckResponse(res); err != nil {
+		return nil, err
+	}
+	var ret *Client
+	if err := json.NewDecoder(res.Body).Decode(&ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+	// {
+	//   "description": "Retrieve information about a client. Its secret is not returned.",
+	//   "httpMethod": "GET",
+	//   "id": "dex.admin.Client.Get",
+	//   "parameterOrder": [
+	//     "id"
+	//   ],
+	//   "parameters": {
+	//     "id": {
+	//       "location": "path",
+	//       "required": true,
+	//       "type": "string"
+	//     }
+	//   },
+	//   "path": "client/{id}",
+	//   "response": {
+	//     "$ref": "Client"
+	//   }
+	// }
+
+}
+
+// method id "dex.admin.Client.List":
+
+type ClientListCall struct {
+	s    *Service
+	opt_ map[string]interface{}
+}
+
+// List: List all clients. Their secrets are not returned.
+func (r *ClientService) List() *ClientListCall {
+	c := &ClientListCall{s: r.s, opt_: make(map[string]interface{})}
+	return c
+}
+
+// Fields allows partial responses to be retrieved.
+// See https://developers.google.com/gdata/docs/2.0/basics#PartialResponse
+// for more information.
+func (c *ClientListCall) Fields(s ...googleapi.Field) *ClientListCall {
+	c.opt_["fields"] = googleapi.CombineFields(s)
+	return c
+}
+
+func (c *ClientListCall) Do() (*ClientsResponse, error) {
+	var body io.Reader = nil
+	params := make(url.Values)
+	params.Set("alt", "json")
+	if v, ok := c.opt_["fields"]; ok {
+		params.Set("fields", fmt.Sprintf("%v", v))
+	}
+	urls := googleapi.ResolveRelative(c.s.BasePath, "client")
+	urls += "?" + params.Encode()
+	req, _ := http.NewRequest("GET", urls, body)
+	googleapi.SetOpaque(req.URL)
+	req.Header.Set("User-Agent", "google-api-go-client/0.5")
+	res, err := c.s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer googleapi.CloseBody(res)
+	if err := googleapi.CheckResponse(res); err != nil {
+		return nil, err
+	}
+	var ret *ClientsResponse
+	if err := json.NewDecoder(res.Body).Decode(&ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+	// {
+	//   "description": "List all clients. Their secrets are not returned.",
+	//   "httpMethod": "GET",
+	//   "id": "dex.admin.Client.List",
+	//   "path": "client",
+	//   "response": {
+	//     "$ref": "ClientsResponse"
+	//   }
+	// }
+
+}
+
+// method id "dex.admin.Client.RotateSecret":
+
+type ClientRotateSecretCall struct {
+	s                         *Service
+	id                        string
+	clientsecretrotaterequest *ClientSecretRotateRequest
+	opt_                      map[string]interface{}
+}
+
+// RotateSecret: Replace the secret of a client. The replaced secret
+// keeps working for the requested overlap, so the client can be moved
+// to the new one without downtime.
+func (r *ClientService) RotateSecret(id string, clientsecretrotaterequest *ClientSecretRotateRequest) *ClientRotateSecretCall {
+	c := &ClientRotateSecretCall{s: r.s, opt_: make(map[string]interface{})}
+	c.id = id
+	c.clientsecretrotaterequest = clientsecretrotaterequest
+	return c
+}
+
+// Fields allows partial responses to be retrieved.
+// See https://developers.google.com/gdata/docs/2.0/basics#PartialResponse
+// for more information.
+func (c *ClientRotateSecretCall) Fields(s ...googleapi.Field) *ClientRotateSecretCall {
+	c.opt_["fields"] = googleapi.CombineFields(s)
+	return c
+}
+
+func (c *ClientRotateSecretCall) Do() (*ClientSecretRotateResponse, error) {
+	var body io.Reader = nil
+	body, err := googleapi.WithoutDataWrapper.JSONReader(c.clientsecretrotaterequest)
+	if err != nil {
+		return nil, err
+	}
+	ctype := "application/json"
+	params := make(url.Values)
+	params.Set("alt", "json")
+	if v, ok := c.opt_["fields"]; ok {
+		params.Set("fields", fmt.Sprintf("%v", v))
+	}
+	urls := googleapi.ResolveRelative(c.s.BasePath, "client/{id}/secret")
+	urls += "?" + params.Encode()
+	req, _ := http.NewRequest("POST", urls, body)
+	googleapi.Expand(req.URL, map[string]string{
+		"id": c.id,
+	})
+	req.Header.Set("Content-Type", ctype)
+	req.Header.Set("User-Agent", "google-api-go-client/0.5")
+	res, err := c.s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer googleapi.CloseBody(res)
+	if err := googleapi.CheckResponse(res); err != nil {
+		return nil, err
+	}
+	var ret *ClientSecretRotateResponse
+	if err := json.NewDecoder(res.Body).Decode(&ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+	// {
+	//   "description": "Replace the secret of a client. The replaced secret keeps working for the requested overlap, so the client can be moved to the new one without downtime.",
+	//   "httpMethod": "POST",
+	//   "id": "dex.admin.Client.RotateSecret",
+	//   "parameterOrder": [
+	//     "id"
+	//   ],
+	//   "parameters": {
+	//     "id": {
+	//       "location": "path",
+	//       "required": true,
+	//       "type": "string"
+	//     }
+	//   },
+	//   "path": "client/{id}/secret",
+	//   "request": {
+	//     "$ref": "ClientSecretRotateRequest"
+	//   },
+	//   "response": {
+	//     "$ref": "ClientSecretRotateResponse"
+	//   }
+	// }
+
+}
+
+// method id "dex.admin.Client.Update":
+
+type ClientUpdateCall struct {
+	s      *Service
+	id     string
+	client *Client
+	opt_   map[string]interface{}
+}
+
+// Update: Replace the redirect URIs, metadata and settings of a client.
+// Its ID and secret are left alone.
+func (r *ClientService) Update(id string, client *Client) *ClientUpdateCall {
+	c := &ClientUpdateCall{s: r.s, opt_: make(map[string]interface{})}
+	c.id = id
+	c.client = client
+	return c
+}
+
+// Fields allows partial responses to be retrieved.
+// See https://developers.google.com/gdata/docs/2.0/basics#PartialResponse
+// for more information.
+func (c *ClientUpdateCall) Fields(s ...googleapi.Field) *ClientUpdateCall {
+	c.opt_["fields"] = googleapi.CombineFields(s)
+	return c
+}
+
+func (c *ClientUpdateCall) Do() (*Client, error) {
+	var body io.Reader = nil
+	body, err := googleapi.WithoutDataWrapper.JSONReader(c.client)
+	if err != nil {
+		return nil, err
+	}
+	ctype := "application/json"
+	params := make(url.Values)
+	params.Set("alt", "json")
+	if v, ok := c.opt_["fields"]; ok {
+		params.Set("fields", fmt.Sprintf("%v", v))
+	}
+	urls := googleapi.ResolveRelative(c.s.BasePath, "client/{id}")
+	urls += "?" + params.Encode()
+	req, _ := http.NewRequest("PUT", urls, body)
+	googleapi.Expand(req.URL, map[string]string{
+		"id": c.id,
+	})
+	req.Header.Set("Content-Type", ctype)
+	req.Header.Set("User-Agent", "google-api-go-client/0.5")
+	res, err := c.s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer googleapi.CloseBody(res)
+	if err := googleapi.CheckResponse(res); err != nil {
+		return nil, err
+	}
+	var ret *Client
+	if err := json.NewDecoder(res.Body).Decode(&ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+	// {
+	//   "description": "Replace the redirect URIs, metadata and settings of a client. Its ID and secret are left alone.",
+	//   "httpMethod": "PUT",
+	//   "id": "dex.admin.Client.Update",
+	//   "parameterOrder": [
+	//     "id"
+	//   ],
+	//   "parameters": {
+	//     "id": {
+	//       "location": "path",
+	//       "required": true,
+	//       "type": "string"
+	//     }
+	//   },
+	//   "path": "client/{id}",
+	//   "request": {
+	//     "$ref": "Client"
+	//   },
+	//   "response": {
+	//     "$ref": "Client"
+	//   }
+	// }
+
+}
+
+// method id "dex.admin.Connector.Get":
+
+type ConnectorsGetCall struct {
+	s    *Service
+	opt_ map[string]interface{}
+}
+
+// Get: Return a list of the connectors for the dex system.
+func (r *ConnectorsService) Get() *ConnectorsGetCall {
+	c := &ConnectorsGetCall{s: r.s, opt_: make(map[string]interface{})}
+	return c
+}
+
+// Fields allows partial responses to be retrieved.
+// See https://developers.google.com/gdata/docs/2.0/basics#PartialResponse
+// for more information.
+func (c *ConnectorsGetCall) Fields(s ...googleapi.Field) *ConnectorsGetCall {
+	c.opt_["fields"] = googleapi.CombineFields(s)
+	return c
+}
+
+func (c *ConnectorsGetCall) Do() (*ConnectorsGetResponse, error) {
+	var body io.Reader = nil
+	params := make(url.Values)
+	params.Set("alt", "json")
+	if v, ok := c.opt_["fields"]; ok {
+		params.Set("fields", fmt.Sprintf("%v", v))
+	}
+	urls := googleapi.ResolveRelative(c.s.BasePath, "connectors")
+	urls += "?" + params.Encode()
+	req, _ := http.NewRequest("GET", urls, body)
+	googleapi.SetOpaque(req.URL)
+	req.Header.Set("User-Agent", "google-api-go-client/0.5")
+	res, err := c.s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer googleapi.CloseBody(res)
+	if err := googleapi.CheckResponse(res); err != nil {
+		return nil, err
+	}
+	var ret *ConnectorsGetResponse
+	if err := json.NewDecoder(res.Body).Decode(&ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+	// {
+	//   "description": "Return a list of the connectors for the dex system.",
+	//   "httpMethod": "GET",
+	//   "id": "dex.admin.Connector.Get",
+	//   "path": "connectors",
+	//   "response": {
+	//     "$ref": "ConnectorsGetResponse"
+	//   }
+	// }
+
+}
+
+// method id "dex.admin.Connector.Set":
+
+type ConnectorsSetCall struct {
+	s                    *Service
+	connectorssetrequest *ConnectorsSetRequest
+	opt_                 map[string]interface{}
+}
+
+// Set: Set the list of connectors for the dex system, overwriting all
+// previous connectors. A 200 status code indicates the action was
+// successful.
+func (r *ConnectorsService) Set(connectorssetrequest *ConnectorsSetRequest) *ConnectorsSetCall {
+	c := &ConnectorsSetCall{s: r.s, opt_: make(map[string]interface{})}
+	c.connectorssetrequest = connectorssetrequest
+	return c
+}
+
+// Fields allows partial responses to be retrieved.
+// See https://developers.google.com/gdata/docs/2.0/basics#PartialResponse
+// for more information.
+func (c *ConnectorsSetCall) Fields(s ...googleapi.Field) *ConnectorsSetCall {
+	c.opt_["fields"] = googleapi.CombineFields(s)
+	return c
+}
+
+func (c *ConnectorsSetCall) Do() error {
+	var body io.Reader = nil
+	body, err := googleapi.WithoutDataWrapper.JSONReader(c.connectorssetrequest)
+	if err != nil {
+		return err
+	}
+	ctype := "application/json"
+	params := make(url.Values)
+	params.Set("alt", "json")
+	if v, ok := c.opt_["fields"]; ok {
+		params.Set("fields", fmt.Sprintf("%v", v))
+	}
+	urls := googleapi.ResolveRelative(c.s.BasePath, "connectors")
+	urls += "?" + params.Encode()
+	req, _ := http.NewRequest("PUT", urls, body)
+	googleapi.SetOpaque(req.URL)
+	req.Header.Set("Content-Type", ctype)
+	req.Header.Set("User-Agent", "google-api-go-client/0.5")
+	res, err := c.s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer googleapi.CloseBody(res)
+	if err := googleapi.CheckResponse(res); err != nil {
+		return err
+	}
+	return nil
+	// {
+	//   "description": "Set the list of connectors for the dex system, overwriting all previous connectors. A 200 status code indicates the action was successful.",
+	//   "httpMethod": "PUT",
+	//   "id": "dex.admin.Connector.Set",
+	//   "path": "connectors",
+	//   "request": {
+	//     "$ref": "ConnectorsSetRequest"
+	//   }
+	// }
+
+}
+
+// method id "dex.admin.GroupMember.Add":
+
+type GroupMembersAddCall struct {
+	s      *Service
+	id     string
+	userId string
+	opt_   map[string]interface{}
+}
+
+// Add: Add a user to a group. A 204 status code indicates the action
+// was successful.
+func (r *GroupMembersService) Add(id string, userId string) *GroupMembersAddCall {
+	c := &GroupMembersAddCall{s: r.s, opt_: make(map[string]interface{})}
+	c.id = id
+	c.userId = userId
+	return c
+}
+
+// Fields allows partial responses to be retrieved.
+// See https://developers.google.com/gdata/docs/2.0/basics#PartialResponse
+// for more information.
+func (c *GroupMembersAddCall) Fields(s ...googleapi.Field) *GroupMembersAddCall {
+	c.opt_["fields"] = googleapi.CombineFields(s)
+	return c
+}
+
+func (c *GroupMembersAddCall) Do() error {
+	var body io.Reader = nil
+	params := make(url.Values)
+	params.Set("alt", "json")
+	if v, ok := c.opt_["fields"]; ok {
+		params.Set("fields", fmt.Sprintf("%v", v))
+	}
+	urls := googleapi.ResolveRelative(c.s.BasePath, "groups/{id}/members/{userId}")
+	urls += "?" + params.Encode()
+	req, _ := http.NewRequest("PUT", urls, body)
+	googleapi.Expand(req.URL, map[string]string{
+		"id":     c.id,
+		"userId": c.userId,
+	})
+	req.Header.Set("User-Agent", "google-api-go-client/0.5")
+	res, err := c.s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer googleapi.CloseBody(res)
+	if err := googleapi.CheckResponse(res); err != nil {
+		return err
+	}
+	return nil
+	// {
+	//   "description": "Add a user to a group. A 204 status code indicates the action was successful.",
+	//   "httpMethod": "PUT",
+	//   "id": "dex.admin.GroupMember.Add",
+	//   "parameterOrder": [
+	//     "id",
+	//     "userId"
+	//   ],
+	//   "parameters": {
+	//     "id": {
+	//       "location": "path",
+	//       "required": true,
+	//       "type": "string"
+	//     },
+	//     "userId": {
+	//       "location": "path",
+	//       "required": true,
+	//       "type": "string"
+	//     }
+	//   },
+	//   "path": "groups/{id}/members/{userId}"
+	// }
+
+}
+
+// method id "dex.admin.GroupMember.List":
+
+type GroupMembersListCall struct {
+	s    *Service
+	id   string
+	opt_ map[string]interface{}
+}
+
+// List: List the IDs of the users in a group, including members synced
+// from connectors.
+func (r *GroupMembersService) List(id string) *GroupMembersListCall {
+	c := &GroupMembersListCall{s: r.s, opt_: make(map[string]interface{})}
+	c.id = id
+	return c
+}
+
+// Fields allows partial responses to be retrieved.
+// See https://developers.google.com/gdata/docs/2.0/basics#PartialResponse
+// for more information.
+func (c *GroupMembersListCall) Fields(s ...googleapi.Field) *GroupMembersListCall {
+	c.opt_["fields"] = googleapi.CombineFields(s)
+	return c
+}
+
+func (c *GroupMembersListCall) Do() (*GroupMembersResponse, error) {
+	var body io.Reader = nil
+	params := make(url.Values)
+	params.Set("alt", "json")
+	if v, ok := c.opt_["fields"]; ok {
+		params.Set("fields", fmt.Sprintf("%v", v))
+	}
+	urls := googleapi.ResolveRelative(c.s.BasePath, "groups/{id}/members")
+	urls += "?" + params.Encode()
+	req, _ := http.NewRequest("GET", urls, body)
+	googleapi.Expand(req.URL, map[string]string{
+		"id": c.id,
+	})
+	req.Header.Set("User-Agent", "google-api-go-client/0.5")
+	res, err := c.s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer googleapi.CloseBody(res)
+	if err := googleapi.CheckResponse(res); err != nil {
+		return nil, err
+	}
+	var ret *GroupMembersResponse
+	if err := json.NewDecoder(res.Body).Decode(&ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+	// {
+	//   "description": "List the IDs of the users in a group, including members synced from connectors.",
+	//   "httpMethod": "GET",
+	//   "id": "dex.admin.GroupMember.List",
+	//   "parameterOrder": [
+	//     "id"
+	//   ],
+	//   "parameters": {
+	//     "id": {
+	//       "location": "path",
+	//       "required": true,
+	//       "type": "string"
+	//     }
+	//   },
+	//   "path": "groups/{id}/members",
+	//   "response": {
+	//     "$ref": "GroupMembersResponse"
+	//   }
+	// }
+
+}
+
+// method id "dex.admin.GroupMember.Remove":
+
+type GroupMembersRemoveCall struct {
+	s      *Service
+	id     string
+	userId string
+	opt_   map[string]interface{}
+}
+
+// Remove: Remove a user added through this API from a group. Members
+// synced from connectors can't be removed. A 204 status code indicates
+// the action was successful.
+func (r *GroupMembersService) Remove(id string, userId string) *GroupMembersRemoveCall {
+	c := &GroupMembersRemoveCall{s: r.s, opt_: make(map[string]interface{})}
+	c.id = id
+	c.userId = userId
+	return c
+}
+
+// Fields allows partial responses to be retrieved.
+// See https://developers.google.com/gdata/docs/2.0/basics#PartialResponse
+// for more information.
+func (c *GroupMembersRemoveCall) Fields(s ...googleapi.Field) *GroupMembersRemoveCall {
+	c.opt_["fields"] = googleapi.CombineFields(s)
+	return c
+}
+
+func (c *GroupMembersRemoveCall) Do() error {
+	var body io.Reader = nil
+	params := make(url.Values)
+	params.Set("alt", "json")
+	if v, ok := c.opt_["fields"]; ok {
+		params.Set("fields", fmt.Sprintf("%v", v))
+	}
+	urls := googleapi.ResolveRelative(c.s.BasePath, "groups/{id}/members/{userId}")
+	urls += "?" + params.Encode()
+	req, _ := http.NewRequest("DELETE", urls, body)
+	googleapi.Expand(req.URL, map[string]string{
+		"id":     c.id,
+		"userId": c.userId,
+	})
+	req.Header.Set("User-Agent", "google-api-go-client/0.5")
+	res, err := c.s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer googleapi.CloseBody(res)
+	if err := googleapi.CheckResponse(res); err != nil {
+		return err
+	}
+	return nil
+	// {
+	//   "description": "Remove a user added through this API from a group. Members synced from connectors can't be removed. A 204 status code indicates the action was successful.",
+	//   "httpMethod": "DELETE",
+	//   "id": "dex.admin.GroupMember.Remove",
+	//   "parameterOrder": [
+	//     "id",
+	//     "userId"
+	//   ],
+	//   "parameters": {
+	//     "id": {
+	//       "location": "path",
+	//       "required": true,
+	//       "type": "string"
+	//     },
+	//     "userId": {
+	//       "location": "path",
+	//       "required": true,
+	//       "type": "string"
+	//     }
+	//   },
+	//   "path": "groups/{id}/members/{userId}"
+	// }
+
+}
+
+// method id "dex.admin.Group.Create":
+
+type GroupsCreateCall struct {
+	s     *Service
+	group *Group
+	opt_  map[string]interface{}
+}
+
+// Create: Create a new group.
+func (r *GroupsService) Create(group *Group) *GroupsCreateCall {
+	c := &GroupsCreateCall{s: r.s, opt_: make(map[string]interface{})}
+	c.group = group
+	return c
+}
+
+// Fields allows partial responses to be retrieved.
+// See https://developers.google.com/gdata/docs/2.0/basics#PartialResponse
+// for more information.
+func (c *GroupsCreateCall) Fields(s ...googleapi.Field) *GroupsCreateCall {
+	c.opt_["fields"] = googleapi.CombineFields(s)
+	return c
+}
+
+func (c *GroupsCreateCall) Do() (*Group, error) {
+	var body io.Reader = nil
+	body, err := googleapi.WithoutDataWrapper.JSONReader(c.group)
+	if err != nil {
+		return nil, err
+	}
+	ctype := "application/json"
+	params := make(url.Values)
+	params.Set("alt", "json")
+	if v, ok := c.opt_["fields"]; ok {
+		params.Set("fields", fmt.Sprintf("%v", v))
+	}
+	urls := googleapi.ResolveRelative(c.s.BasePath, "groups")
+	urls += "?" + params.Encode()
+	req, _ := http.NewRequest("POST", urls, body)
+	googleapi.SetOpaque(req.URL)
+	req.Header.Set("Content-Type", ctype)
+	req.Header.Set("User-Agent", "google-api-go-client/0.5")
+	res, err := c.s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer googleapi.CloseBody(res)
+	if err := googleapi.CheckResponse(res); err != nil {
+		return nil, err
+	}
+	var ret *Group
+	if err := json.NewDecoder(res.Body).Decode(&ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+	// {
+	//   "description": "Create a new group.",
+	//   "httpMethod": "POST",
+	//   "id": "dex.admin.Group.Create",
+	//   "path": "groups",
+	//   "request": {
+	//     "$ref": "Group"
+	//   },
+	//   "response": {
+	//     "$ref": "Group"
+	//   }
+	// }
+
+}
+
+// method id "dex.admin.Group.Delete":
+
+type GroupsDeleteCall struct {
+	s    *Service
+	id   string
+	opt_ map[string]interface{}
+}
+
+// Delete: Delete a group and all of its memberships. A 204 status code
+// indicates the action was successful.
+func (r *GroupsService) Delete(id string) *GroupsDeleteCall {
+	c := &GroupsDeleteCall{s: r.s, opt_: make(map[string]interface{})}
+	c.id = id
+	return c
+}
+
+// Fields allows partial responses to be retrieved.
+// See https://developers.google.com/gdata/docs/2.0/basics#PartialResponse
+// for more information.
+func (c *GroupsDeleteCall) Fields(s ...googleapi.Field) *GroupsDeleteCall {
+	c.opt_["fields"] = googleapi.CombineFields(s)
+	return c
+}
+
+func (c *GroupsDeleteCall) Do() error {
+	var body io.Reader = nil
+	params := make(url.Values)
+	params.Set("alt", "json")
+	if v, ok := c.opt_["fields"]; ok {
+		params.Set("fields", fmt.Sprintf("%v", v))
+	}
+	urls := googleapi.ResolveRelative(c.s.BasePath, "groups/{id}")
+	urls += "?" + params.Encode()
+	req, _ := http.NewRequest("DELETE", urls, body)
+	googleapi.Expand(req.URL, map[string]string{
+		"id": c.id,
+	})
+	req.Header.Set("User-Agent", "google-api-go-client/0.5")
+	res, err := c.s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer googleapi.CloseBody(res)
+	if err := googleapi.CheckResponse(res); err != nil {
+		return err
+	}
+	return nil
+	// {
+	//   "description": "Delete a group and all of its memberships. A 204 status code indicates the action was successful.",
+	//   "httpMethod": "DELETE",
+	//   "id": "dex.admin.Group.Delete",
+	//   "parameterOrder": [
+	//     "id"
+	//   ],
+	//   "parameters": {
+	//     "id": {
+	//       "location": "path",
+	//       "required": true,
+	//       "type": "string"
+	//     }
+	//   },
+	//   "path": "groups/{id}"
+	// }
+
+}
+
+// method id "dex.admin.Group.Get":
+
+type GroupsGetCall struct {
+	s    *Service
+	id   string
+	opt_ map[string]interface{}
+}
+
+// Get: Retrieve information about a group.
+func (r *GroupsService) Get(id string) *GroupsGetCall {
+	c := &GroupsGetCall{s: r.s, opt_: make(map[string]interface{})}
+	c.id = id
+	return c
+}
+
+// Fields allows partial responses to be retrieved.
+// See https://developers.google.com/gdata/docs/2.0/basics#PartialResponse
+// for more information.
+func (c *GroupsGetCall) Fields(s ...googleapi.Field) *GroupsGetCall {
+	c.opt_["fields"] = googleapi.CombineFields(s)
+	return c
+}
+
+func (c *GroupsGetCall) Do() (*Group, error) {
+	var body io.Reader = nil
+	params := make(url.Values)
+	params.Set("alt", "json")
+	if v, ok := c.opt_["fields"]; ok {
+		params.Set("fields", fmt.Sprintf("%v", v))
+	}
+	urls := googleapi.ResolveRelative(c.s.BasePath, "groups/{id}")
+	urls += "?" + params.Encode()
+	req, _ := http.NewRequest("GET", urls, body)
+	googleapi.Expand(req.URL, map[string]string{
+		"id": c.id,
+	})
+	req.Header.Set("User-Agent", "google-api-go-client/0.5")
+	res, err := c.s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer googleapi.CloseBody(res)
+	if err := googleapi.CheckResponse(res); err != nil {
+		return nil, err
+	}
+	var ret *Group
+	if err := json.NewDecoder(res.Body).Decode(&ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+	// {
+	//   "description": "Retrieve information about a group.",
+	//   "httpMethod": "GET",
+	//   "id": "dex.admin.Group.Get",
+	//   "parameterOrder": [
+	//     "id"
+	//   ],
+	//   "parameters": {
+	//     "id": {
+	//       "location": "path",
+	//       "required": true,
+	//       "type": "string"
+	//     }
+	//   },
+	//   "path": "groups/{id}",
+	//   "response": {
+	//     "$ref": "Group"
+	//   }
+	// }
+
+}
+
+// method id "dex.admin.Group.List":
+
+type GroupsListCall struct {
+	s    *Service
+	opt_ map[string]interface{}
+}
+
+// List: List all groups, ordered by name.
+func (r *GroupsService) List() *GroupsListCall {
+	c := &GroupsListCall{s: r.s, opt_: make(map[string]interface{})}
+	return c
+}
+
+// Fields allows partial responses to be retrieved.
+// See https://developers.google.com/gdata/docs/2.0/basics#PartialResponse
+// for more information.
+func (c *GroupsListCall) Fields(s ...googleapi.Field) *GroupsListCall {
+	c.opt_["fields"] = googleapi.CombineFields(s)
+	return c
+}
+
+func (c *GroupsListCall) Do() (*GroupsResponse, error) {
+	var body io.Reader = nil
+	params := make(url.Values)
+	params.Set("alt", "json")
+	if v, ok := c.opt_["fields"]; ok {
+		params.Set("fields", fmt.Sprintf("%v", v))
+	}
+	urls := googleapi.ResolveRelative(c.s.BasePath, "groups")
+	urls += "?" + params.Encode()
+	req, _ := http.NewRequest("GET", urls, body)
+	googleapi.SetOpaque(req.URL)
+	req.Header.Set("User-Agent", "google-api-go-client/0.5")
+	res, err := c.s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer googleapi.CloseBody(res)
+	if err := googleapi.CheckResponse(res); err != nil {
+		return nil, err
+	}
+	var ret *GroupsResponse
+	if err := json.NewDecoder(res.Body).Decode(&ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+	// {
+	//   "description": "List all groups, ordered by name.",
+	//   "httpMethod": "GET",
+	//   "id": "dex.admin.Group.List",
+	//   "path": "groups",
+	//   "response": {
+	//     "$ref": "GroupsResponse"
+	//   }
+	// }
+
+}
+
+// method id "dex.admin.InitialAccessToken.Create":
+
+type InitialAccessTokensCreateCall struct {
+	s                               *Service
+	initialaccesstokencreaterequest *InitialAccessTokenCreateRequest
+	opt_                            map[string]interface{}
+}
+
+// Create: Issue an initial access token, which allows registering
+// clients dynamically when the registration endpoint requires one.
+func (r *InitialAccessTokensService) Create(initialaccesstokencreaterequest *InitialAccessTokenCreateRequest) *InitialAccessTokensCreateCall {
+	c := &InitialAccessTokensCreateCall{s: r.s, opt_: make(map[string]interface{})}
+	c.initialaccesstokencreaterequest = initialaccesstokencreaterequest
+	return c
+}
+
+// Fields allows partial responses to be retrieved.
+// See https://developers.google.com/gdata/docs/2.0/basics#PartialResponse
+// for more information.
+func (c *InitialAccessTokensCreateCall) Fields(s ...googleapi.Field) *InitialAccessTokensCreateCall {
+	c.opt_["fields"] = googleapi.CombineFields(s)
+	return c
+}
+
+func (c *InitialAccessTokensCreateCall) Do() (*InitialAccessTokenCreateResponse, error) {
+	var body io.Reader = nil
+	body, err := googleapi.WithoutDataWrapper.JSONReader(c.initialaccesstokencreaterequest)
+	if err != nil {
+		return nil, err
+	}
+	ctype := "application/json"
+	params := make(url.Values)
+	params.Set("alt", "json")
+	if v, ok := c.opt_["fields"]; ok {
+		params.Set("fields", fmt.Sprintf("%v", v))
+	}
+	urls := googleapi.ResolveRelative(c.s.BasePath, "initial-access-tokens")
+	urls += "?" + params.Encode()
+	req, _ := http.NewRequest("POST", urls, body)
+	googleapi.SetOpaque(req.URL)
 	req.Header.Set("Content-Type", ctype)
 	req.Header.Set("User-Agent", "google-api-go-client/0.5")
 	res, err := c.s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer googleapi.CloseBody(res)
+	if err := googleapi.CheckResponse(res); err != nil {
+		return nil, err
+	}
+	var ret *InitialAccessTokenCreateResponse
+	if err := json.NewDecoder(res.Body).Decode(&ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+	// {
+	//   "description": "Issue an initial access token, which allows registering clients dynamically when the registration endpoint requires one.",
+	//   "httpMethod": "POST",
+	//   "id": "dex.admin.InitialAccessToken.Create",
+	//   "path": "initial-access-tokens",
+	//   "request": {
+	//     "$ref": "InitialAccessTokenCreateRequest"
+	//   },
+	//   "response": {
+	//     "$ref": "InitialAccessTokenCreateResponse"
+	//   }
+	// }
+
+}
+
+// method id "dex.admin.InitialAccessToken.Delete":
+
+type InitialAccessTokensDeleteCall struct {
+	s    *Service
+	id   string
+	opt_ map[string]interface{}
+}
+
+// Delete: Revoke an initial access token. Clients registered with it
+// are left alone. A 204 status code indicates the action was
+// successful.
+func (r *InitialAccessTokensService) Delete(id string) *InitialAccessTokensDeleteCall {
+	c := &InitialAccessTokensDeleteCall{s: r.s, opt_: make(map[string]interface{})}
+	c.id = id
+	return c
+}
+
+// Fields allows partial responses to be retrieved.
+// See https://developers.google.com/gdata/docs/2.0/basics#PartialResponse
+// for more information.
+func (c *InitialAccessTokensDeleteCall) Fields(s ...googleapi.Field) *InitialAccessTokensDeleteCall {
+	c.opt_["fields"] = googleapi.CombineFields(s)
+	return c
+}
+
+func (c *InitialAccessTokensDeleteCall) Do() error {
+	var body io.Reader = nil
+	params := make(url.Values)
+	params.Set("alt", "json")
+	if v, ok := c.opt_["fields"]; ok {
+		params.Set("fields", fmt.Sprintf("%v", v))
+	}
+	urls := googleapi.ResolveRelative(c.s.BasePath, "initial-access-tokens/{id}")
+	urls += "?" + params.Encode()
+	req, _ := http.NewRequest("DELETE", urls, body)
+	googleapi.Expand(req.URL, map[string]string{
+		"id": c.id,
+	})
+	req.Header.Set("User-Agent", "google-api-go-client/0.5")
+	res, err := c.s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer googleapi.CloseBody(res)
+	if err := googleapi.CheckResponse(res); err != nil {
+		return err
+	}
+	return nil
+	// {
+	//   "description": "Revoke an initial access token. Clients registered with it are left alone. A 204 status code indicates the action was successful.",
+	//   "httpMethod": "DELETE",
+	//   "id": "dex.admin.InitialAccessToken.Delete",
+	//   "parameterOrder": [
+	//     "id"
+	//   ],
+	//   "parameters": {
+	//     "id": {
+	//       "location": "path",
+	//       "required": true,
+	//       "type": "string"
+	//     }
+	//   },
+	//   "path": "initial-access-tokens/{id}"
+	// }
+
+}
+
+// method id "dex.admin.InitialAccessToken.List":
+
+type InitialAccessTokensListCall struct {
+	s    *Service
+	opt_ map[string]interface{}
+}
+
+// List: List the initial access tokens. The tokens themselves are not
+// returned.
+func (r *InitialAccessTokensService) List() *InitialAccessTokensListCall {
+	c := &InitialAccessTokensListCall{s: r.s, opt_: make(map[string]interface{})}
+	return c
+}
+
+// Fields allows partial responses to be retrieved.
+// See https://developers.google.com/gdata/docs/2.0/basics#PartialResponse
+// for more information.
+func (c *InitialAccessTokensListCall) Fields(s ...googleapi.Field) *InitialAccessTokensListCall {
+	c.opt_["fields"] = googleapi.CombineFields(s)
+	return c
+}
+
+func (c *InitialAccessTokensListCall) Do() (*InitialAccessTokensResponse, error) {
+	var body io.Reader = nil
+	params := make(url.Values)
+	params.Set("alt", "json")
+	if v, ok := c.opt_["fields"]; ok {
+		params.Set("fields", fmt.Sprintf("%v", v))
+	}
+	urls := googleapi.ResolveRelative(c.s.BasePath, "initial-access-tokens")
+	urls += "?" + params.Encode()
+	req, _ := http.NewRequest("GET", urls, body)
+	googleapi.SetOpaque(req.URL)
+	req.Header.Set("User-Agent", "google-api-go-client/0.5")
+	res, err := c.s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer googleapi.CloseBody(res)
+	if err := googleapi.CheckResponse(res); err != nil {
+		return nil, err
+	}
+	var ret *InitialAccessTokensResponse
+	if err := json.NewDecoder(res.Body).Decode(&ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+	// {
+	//   "description": "List the initial access tokens. The tokens themselves are not returned.",
+	//   "httpMethod": "GET",
+	//   "id": "dex.admin.InitialAccessToken.List",
+	//   "path": "initial-access-tokens",
+	//   "response": {
+	//     "$ref": "InitialAccessTokensResponse"
+	//   }
+	// }
+
+}
+
+// method id "dex.admin.Lockout.Delete":
+
+type LockoutsDeleteCall struct {
+	s    *Service
+	id   string
+	opt_ map[string]interface{}
+}
+
+// Delete: Unlock an account or IP, and clear its failed logins. A 204
+// status code indicates the action was successful.
+func (r *LockoutsService) Delete(id string) *LockoutsDeleteCall {
+	c := &LockoutsDeleteCall{s: r.s, opt_: make(map[string]interface{})}
+	c.id = id
+	return c
+}
+
+// Fields allows partial responses to be retrieved.
+// See https://developers.google.com/gdata/docs/2.0/basics#PartialResponse
+// for more information.
+func (c *LockoutsDeleteCall) Fields(s ...googleapi.Field) *LockoutsDeleteCall {
+	c.opt_["fields"] = googleapi.CombineFields(s)
+	return c
+}
+
+func (c *LockoutsDeleteCall) Do() error {
+	var body io.Reader = nil
+	params := make(url.Values)
+	params.Set("alt", "json")
+	if v, ok := c.opt_["fields"]; ok {
+		params.Set("fields", fmt.Sprintf("%v", v))
+	}
+	urls := googleapi.ResolveRelative(c.s.BasePath, "lockouts/{id}")
+	urls += "?" + params.Encode()
+	req, _ := http.NewRequest("DELETE", urls, body)
+	googleapi.Expand(req.URL, map[string]string{
+		"id": c.id,
+	})
+	req.Header.Set("User-Agent", "google-api-go-client/0.5")
+	res, err := c.s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer googleapi.CloseBody(res)
+	if err := googleapi.CheckResponse(res); err != nil {
+		return err
+	}
+	return nil
+	// {
+	//   "description": "Unlock an account or IP, and clear its failed logins. A 204 status code indicates the action was successful.",
+	//   "httpMethod": "DELETE",
+	//   "id": "dex.admin.Lockout.Delete",
+	//   "parameterOrder": [
+	//     "id"
+	//   ],
+	//   "parameters": {
+	//     "id": {
+	//       "location": "path",
+	//       "required": true,
+	//       "type": "string"
+	//     }
+	//   },
+	//   "path": "lockouts/{id}"
+	// }
+
+}
+
+// method id "dex.admin.Lockout.List":
+
+type LockoutsListCall struct {
+	s    *Service
+	opt_ map[string]interface{}
+}
+
+// List: List the accounts and IPs which are locked out after too many
+// failed logins.
+func (r *LockoutsService) List() *LockoutsListCall {
+	c := &LockoutsListCall{s: r.s, opt_: make(map[string]interface{})}
+	return c
+}
+
+// Fields allows partial responses to be retrieved.
+// See https://developers.google.com/gdata/docs/2.0/basics#PartialResponse
+// for more information.
+func (c *LockoutsListCall) Fields(s ...googleapi.Field) *LockoutsListCall {
+	c.opt_["fields"] = googleapi.CombineFields(s)
+	return c
+}
+
+func (c *LockoutsListCall) Do() (*LockoutsResponse, error) {
+	var body io.Reader = nil
+	params := make(url.Values)
+	params.Set("alt", "json")
+	if v, ok := c.opt_["fields"]; ok {
+		params.Set("fields", fmt.Sprintf("%v", v))
+	}
+	urls := googleapi.ResolveRelative(c.s.BasePath, "lockouts")
+	urls += "?" + params.Encode()
+	req, _ := http.NewRequest("GET", urls, body)
+	googleapi.SetOpaque(req.URL)
+	req.Header.Set("User-Agent", "google-api-go-client/0.5")
+	res, err := c.s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer googleapi.CloseBody(res)
+	if err := googleapi.CheckResponse(res); err != nil {
+		return nil, err
+	}
+	var ret *LockoutsResponse
+	if err := json.NewDecoder(res.Body).Decode(&ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+	// {
+	//   "description": "List the accounts and IPs which are locked out after too many failed logins.",
+	//   "httpMethod": "GET",
+	//   "id": "dex.admin.Lockout.List",
+	//   "path": "lockouts",
+	//   "response": {
+	//     "$ref": "LockoutsResponse"
+	//   }
+	// }
+
+}
+
+// method id "dex.admin.MFA.Reset":
+
+type MFAResetCall struct {
+	s      *Service
+	userId string
+	opt_   map[string]interface{}
+}
+
+// Reset: Remove a user's second factor enrollment, along with their
+// recovery codes. The user enrolls again at their next login if a
+// second factor is required. A 204 status code indicates the action was
+// successful.
+func (r *MFAService) Reset(userId string) *MFAResetCall {
+	c := &MFAResetCall{s: r.s, opt_: make(map[string]interface{})}
+	c.userId = userId
+	return c
+}
+
+// Fields allows partial responses to be retrieved.
+// See https://developers.google.com/gdata/docs/2.0/basics#PartialResponse
+// for more information.
+func (c *MFAResetCall) Fields(s ...googleapi.Field) *MFAResetCall {
+	c.opt_["fields"] = googleapi.CombineFields(s)
+	return c
+}
+
+func (c *MFAResetCall) Do() error {
+	var body io.Reader = nil
+	params := make(url.Values)
+	params.Set("alt", "json")
+	if v, ok := c.opt_["fields"]; ok {
+		params.Set("fields", fmt.Sprintf("%v", v))
+	}
+	urls := googleapi.ResolveRelative(c.s.BasePath, "users/{userId}/mfa")
+	urls += "?" + params.Encode()
+	req, _ := http.NewRequest("DELETE", urls, body)
+	googleapi.Expand(req.URL, map[string]string{
+		"userId": c.userId,
+	})
+	req.Header.Set("User-Agent", "google-api-go-client/0.5")
+	res, err := c.s.client.Do(req)
 	if err != nil {
 		return err
 	}
@@ -493,17 +2099,265 @@ func (c *ConnectorsSetCall) Do() error {
 	}
 	return nil
 	// {
-	//   "description": "Set the list of connectors for the dex system, overwriting all previous connectors. A 200 status code indicates the action was successful.",
+	//   "description": "Remove a user's second factor enrollment, along with their recovery codes. The user enrolls again at their next login if a second factor is required. A 204 status code indicates the action was successful.",
+	//   "httpMethod": "DELETE",
+	//   "id": "dex.admin.MFA.Reset",
+	//   "parameterOrder": [
+	//     "userId"
+	//   ],
+	//   "parameters": {
+	//     "userId": {
+	//       "location": "path",
+	//       "required": true,
+	//       "type": "string"
+	//     }
+	//   },
+	//   "path": "users/{userId}/mfa"
+	// }
+
+}
+
+// method id "dex.admin.RemoteIdentity.Link":
+
+type RemoteIdentitiesLinkCall struct {
+	s           *Service
+	userId      string
+	connectorId string
+	remoteId    string
+	opt_        map[string]interface{}
+}
+
+// Link: Link a remote identity to a user, who can log in with it from
+// then on. The identity can't be linked to another user. A 204 status
+// code indicates the action was successful.
+func (r *RemoteIdentitiesService) Link(userId string, connectorId string, remoteId string) *RemoteIdentitiesLinkCall {
+	c := &RemoteIdentitiesLinkCall{s: r.s, opt_: make(map[string]interface{})}
+	c.userId = userId
+	c.connectorId = connectorId
+	c.remoteId = remoteId
+	return c
+}
+
+// Fields allows partial responses to be retrieved.
+// See https://developers.google.com/gdata/docs/2.0/basics#PartialResponse
+// for more information.
+func (c *RemoteIdentitiesLinkCall) Fields(s ...googleapi.Field) *RemoteIdentitiesLinkCall {
+	c.opt_["fields"] = googleapi.CombineFields(s)
+	return c
+}
+
+func (c *RemoteIdentitiesLinkCall) Do() error {
+	var body io.Reader = nil
+	params := make(url.Values)
+	params.Set("alt", "json")
+	if v, ok := c.opt_["fields"]; ok {
+		params.Set("fields", fmt.Sprintf("%v", v))
+	}
+	urls := googleapi.ResolveRelative(c.s.BasePath, "users/{userId}/remote-identities/{connectorId}/{remoteId}")
+	urls += "?" + params.Encode()
+	req, _ := http.NewRequest("PUT", urls, body)
+	googleapi.Expand(req.URL, map[string]string{
+		"userId":      c.userId,
+		"connectorId": c.connectorId,
+		"remoteId":    c.remoteId,
+	})
+	req.Header.Set("User-Agent", "google-api-go-client/0.5")
+	res, err := c.s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer googleapi.CloseBody(res)
+	if err := googleapi.CheckResponse(res); err != nil {
+		return err
+	}
+	return nil
+	// {
+	//   "description": "Link a remote identity to a user, who can log in with it from then on. The identity can't be linked to another user. A 204 status code indicates the action was successful.",
 	//   "httpMethod": "PUT",
-	//   "id": "dex.admin.Connector.Set",
-	//   "path": "connectors",
-	//   "request": {
-	//     "$ref": "ConnectorsSetRequest"
+	//   "id": "dex.admin.RemoteIdentity.Link",
+	//   "parameterOrder": [
+	//     "userId",
+	//     "connectorId",
+	//     "remoteId"
+	//   ],
+	//   "parameters": {
+	//     "connectorId": {
+	//       "location": "path",
+	//       "required": true,
+	//       "type": "string"
+	//     },
+	//     "remoteId": {
+	//       "location": "path",
+	//       "required": true,
+	//       "type": "string"
+	//     },
+	//     "userId": {
+	//       "location": "path",
+	//       "required": true,
+	//       "type": "string"
+	//     }
+	//   },
+	//   "path": "users/{userId}/remote-identities/{connectorId}/{remoteId}"
+	// }
+
+}
+
+// method id "dex.admin.RemoteIdentity.List":
+
+type RemoteIdentitiesListCall struct {
+	s      *Service
+	userId string
+	opt_   map[string]interface{}
+}
+
+// List: List the remote identities a user can log in with.
+func (r *RemoteIdentitiesService) List(userId string) *RemoteIdentitiesListCall {
+	c := &RemoteIdentitiesListCall{s: r.s, opt_: make(map[string]interface{})}
+	c.userId = userId
+	return c
+}
+
+// Fields allows partial responses to be retrieved.
+// See https://developers.google.com/gdata/docs/2.0/basics#PartialResponse
+// for more information.
+func (c *RemoteIdentitiesListCall) Fields(s ...googleapi.Field) *RemoteIdentitiesListCall {
+	c.opt_["fields"] = googleapi.CombineFields(s)
+	return c
+}
+
+func (c *RemoteIdentitiesListCall) Do() (*RemoteIdentitiesResponse, error) {
+	var body io.Reader = nil
+	params := make(url.Values)
+	params.Set("alt", "json")
+	if v, ok := c.opt_["fields"]; ok {
+		params.Set("fields", fmt.Sprintf("%v", v))
+	}
+	urls := googleapi.ResolveRelative(c.s.BasePath, "users/{userId}/remote-identities")
+	urls += "?" + params.Encode()
+	req, _ := http.NewRequest("GET", urls, body)
+	googleapi.Expand(req.URL, map[string]string{
+		"userId": c.userId,
+	})
+	req.Header.Set("User-Agent", "google-api-go-client/0.5")
+	res, err := c.s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer googleapi.CloseBody(res)
+	if err := googleapi.CheckResponse(res); err != nil {
+		return nil, err
+	}
+	var ret *RemoteIdentitiesResponse
+	if err := json.NewDecoder(res.Body).Decode(&ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+	// {
+	//   "description": "List the remote identities a user can log in with.",
+	//   "httpMethod": "GET",
+	//   "id": "dex.admin.RemoteIdentity.List",
+	//   "parameterOrder": [
+	//     "userId"
+	//   ],
+	//   "parameters": {
+	//     "userId": {
+	//       "location": "path",
+	//       "required": true,
+	//       "type": "string"
+	//     }
+	//   },
+	//   "path": "users/{userId}/remote-identities",
+	//   "response": {
+	//     "$ref": "RemoteIdentitiesResponse"
 	//   }
 	// }
 
 }
 
+// method id "dex.admin.RemoteIdentity.Unlink":
+
+type RemoteIdentitiesUnlinkCall struct {
+	s           *Service
+	userId      string
+	connectorId string
+	remoteId    string
+	opt_        map[string]interface{}
+}
+
+// Unlink: Unlink a remote identity from a user, who can't log in with
+// it anymore. A 204 status code indicates the action was successful.
+func (r *RemoteIdentitiesService) Unlink(userId string, connectorId string, remoteId string) *RemoteIdentitiesUnlinkCall {
+	c := &RemoteIdentitiesUnlinkCall{s: r.s, opt_: make(map[string]interface{})}
+	c.userId = userId
+	c.connectorId = connectorId
+	c.remoteId = remoteId
+	return c
+}
+
+// Fields allows partial responses to be retrieved.
+// See https://developers.google.com/gdata/docs/2.0/basics#PartialResponse
+// for more information.
+func (c *RemoteIdentitiesUnlinkCall) Fields(s ...googleapi.Field) *RemoteIdentitiesUnlinkCall {
+	c.opt_["fields"] = googleapi.CombineFields(s)
+	return c
+}
+
+func (c *RemoteIdentitiesUnlinkCall) Do() error {
+	var body io.Reader = nil
+	params := make(url.Values)
+	params.Set("alt", "json")
+	if v, ok := c.opt_["fields"]; ok {
+		params.Set("fields", fmt.Sprintf("%v", v))
+	}
+	urls := googleapi.ResolveRelative(c.s.BasePath, "users/{userId}/remote-identities/{connectorId}/{remoteId}")
+	urls += "?" + params.Encode()
+	req, _ := http.NewRequest("DELETE", urls, body)
+	googleapi.Expand(req.URL, map[string]string{
+		"userId":      c.userId,
+		"connectorId": c.connectorId,
+		"remoteId":    c.remoteId,
+	})
+	req.Header.Set("User-Agent", "google-api-go-client/0.5")
+	res, err := c.s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer googleapi.CloseBody(res)
+	if err := googleapi.CheckResponse(res); err != nil {
+		return err
+	}
+	return nil
+	// {
+	//   "description": "Unlink a remote identity from a user, who can't log in with it anymore. A 204 status code indicates the action was successful.",
+	//   "httpMethod": "DELETE",
+	//   "id": "dex.admin.RemoteIdentity.Unlink",
+	//   "parameterOrder": [
+	//     "userId",
+	//     "connectorId",
+	//     "remoteId"
+	//   ],
+	//   "parameters": {
+	//     "connectorId": {
+	//       "location": "path",
+	//       "required": true,
+	//       "type": "string"
+	//     },
+	//     "remoteId": {
+	//       "location": "path",
+	//       "required": true,
+	//       "type": "string"
+	//     },
+	//     "userId": {
+	//       "location": "path",
+	//       "required": true,
+	//       "type": "string"
+	//     }
+	//   },
+	//   "path": "users/{userId}/remote-identities/{connectorId}/{remoteId}"
+	// }
+
+}
+
 // method id "dex.admin.State.Get":
 
 type StateGetCall struct {
@@ -57,15 +57,27 @@ const DiscoveryJSON = `{
       "properties": {
         "id": {
           "type": "string",
-          "description": "The client ID. Ignored in client create requests."
+          "description": "The client ID. Ignored in client create and update requests."
         },
         "secret": {
           "type": "string",
-          "description": "The client secret. Ignored in client create requests."
+          "description": "The client secret. Ignored in client create and update requests, and never returned when retrieving clients."
         },
         "isAdmin": {
           "type": "boolean"
         },
+        "isPublic": {
+          "type": "boolean",
+          "description": "Public clients, such as native and mobile apps, can't keep their secret confidential. They may exchange codes at the token endpoint without a secret, provided PKCE (RFC 7636) is used."
+        },
+        "requireMFA": {
+          "type": "boolean",
+          "description": "Users logging in to the client with a password of the local connector must use a second factor."
+        },
+        "firstParty": {
+          "type": "boolean",
+          "description": "Users logging in to first-party clients aren't asked to consent to the scopes the client requests."
+        },
         "redirectURIs": {
           "type": "array",
           "items": {
@@ -84,6 +96,21 @@ const DiscoveryJSON = `{
         "clientURI": {
           "type": "string",
           "description": "OPTIONAL. URL of the home page of the Client. The value of this field MUST point to a valid Web page. If present, the server SHOULD display this URL to the End-User in a followable fashion. If desired, representation of this Claim in different languages and scripts is represented as described in Section 2.1 ( Metadata Languages and Scripts ) ."
+        },
+        "postLogoutRedirectURIs": {
+          "type": "array",
+          "items": {
+            "type": "string"
+          },
+          "description": "OPTIONAL. URLs the client may ask the user-agent to be sent back to, with the post_logout_redirect_uri parameter, once the user logged out."
+        },
+        "frontChannelLogoutURI": {
+          "type": "string",
+          "description": "OPTIONAL. URL loaded in an iframe of the logout page, so that the client can clear the user's session."
+        },
+        "backChannelLogoutURI": {
+          "type": "string",
+          "description": "OPTIONAL. URL sent a logout token when the user logs out."
         }
       }
     },
@@ -107,6 +134,46 @@ const DiscoveryJSON = `{
         }
       }
     },
+    "ClientsResponse": {
+      "id": "ClientsResponse",
+      "type": "object",
+      "properties": {
+        "clients": {
+          "type": "array",
+          "items": {
+            "$ref": "Client"
+          }
+        }
+      }
+    },
+    "ClientSecretRotateRequest": {
+      "id": "ClientSecretRotateRequest",
+      "type": "object",
+      "properties": {
+        "overlapSeconds": {
+          "type": "integer",
+          "format": "int64",
+          "description": "How long the replaced secret keeps working, in seconds. If zero, it stops working at once."
+        }
+      }
+    },
+    "ClientSecretRotateResponse": {
+      "id": "ClientSecretRotateResponse",
+      "type": "object",
+      "description": "The new secret of the client. It is only ever returned in this response.",
+      "properties": {
+        "id": {
+          "type": "string"
+        },
+        "secret": {
+          "type": "string"
+        },
+        "previousSecretExpiresAt": {
+          "type": "string",
+          "description": "When the replaced secret stops working, in RFC 3339 format. Empty if it already has."
+        }
+      }
+    },
     "Connector": {
       "id": "Connector",
       "type": "any",
@@ -137,6 +204,229 @@ const DiscoveryJSON = `{
           }
         }
       }
+    },
+    "Group": {
+      "id": "Group",
+      "type": "object",
+      "properties": {
+        "id": {
+          "type": "string"
+        },
+        "name": {
+          "type": "string"
+        }
+      }
+    },
+    "GroupsResponse": {
+      "id": "GroupsResponse",
+      "type": "object",
+      "properties": {
+        "groups": {
+          "type": "array",
+          "items": {
+            "$ref": "Group"
+          }
+        }
+      }
+    },
+    "GroupMembersResponse": {
+      "id": "GroupMembersResponse",
+      "type": "object",
+      "properties": {
+        "members": {
+          "type": "array",
+          "items": {
+            "type": "string"
+          }
+        }
+      }
+    },
+    "RemoteIdentity": {
+      "id": "RemoteIdentity",
+      "type": "object",
+      "properties": {
+        "connectorID": {
+          "type": "string"
+        },
+        "id": {
+          "type": "string"
+        }
+      }
+    },
+    "RemoteIdentitiesResponse": {
+      "id": "RemoteIdentitiesResponse",
+      "type": "object",
+      "properties": {
+        "remoteIdentities": {
+          "type": "array",
+          "items": {
+            "$ref": "RemoteIdentity"
+          }
+        }
+      }
+    },
+    "Lockout": {
+      "id": "Lockout",
+      "type": "object",
+      "properties": {
+        "id": {
+          "type": "string"
+        },
+        "kind": {
+          "type": "string",
+          "description": "Either \"account\" or \"ip\"."
+        },
+        "connectorID": {
+          "type": "string",
+          "description": "The connector of a locked account; empty for IPs."
+        },
+        "subject": {
+          "type": "string",
+          "description": "The account name as entered by the user, or the IP."
+        },
+        "failures": {
+          "type": "integer"
+        },
+        "lockedUntil": {
+          "type": "string",
+          "format": "date-time"
+        }
+      }
+    },
+    "LockoutsResponse": {
+      "id": "LockoutsResponse",
+      "type": "object",
+      "properties": {
+        "lockouts": {
+          "type": "array",
+          "items": {
+            "$ref": "Lockout"
+          }
+        }
+      }
+    },
+    "InitialAccessToken": {
+      "id": "InitialAccessToken",
+      "type": "object",
+      "description": "An initial access token, which allows registering clients dynamically when the registration endpoint requires one.",
+      "properties": {
+        "id": {
+          "type": "string",
+          "description": "Identifies the token without revealing it."
+        },
+        "createdAt": {
+          "type": "string",
+          "description": "When the token was created, in RFC 3339 format."
+        },
+        "expiresAt": {
+          "type": "string",
+          "description": "When the token stops working, in RFC 3339 format."
+        },
+        "maxUses": {
+          "type": "integer",
+          "format": "int64",
+          "description": "The number of clients the token can register. If zero, it can register any number of clients until it expires."
+        },
+        "uses": {
+          "type": "integer",
+          "format": "int64",
+          "description": "The number of clients the token has registered."
+        }
+      }
+    },
+    "InitialAccessTokenCreateRequest": {
+      "id": "InitialAccessTokenCreateRequest",
+      "type": "object",
+      "properties": {
+        "expiresInSeconds": {
+          "type": "integer",
+          "format": "int64",
+          "description": "How long the token works for, in seconds. If zero, it works for a day."
+        },
+        "maxUses": {
+          "type": "integer",
+          "format": "int64",
+          "description": "The number of clients the token can register. If zero, it can register any number of clients until it expires."
+        }
+      }
+    },
+    "InitialAccessTokenCreateResponse": {
+      "id": "InitialAccessTokenCreateResponse",
+      "type": "object",
+      "properties": {
+        "token": {
+          "type": "string",
+          "description": "The token, to be passed as a bearer token to the registration endpoint. It is only ever returned in this response."
+        },
+        "initialAccessToken": {
+          "$ref": "InitialAccessToken"
+        }
+      }
+    },
+    "InitialAccessTokensResponse": {
+      "id": "InitialAccessTokensResponse",
+      "type": "object",
+      "properties": {
+        "initialAccessTokens": {
+          "type": "array",
+          "items": {
+            "$ref": "InitialAccessToken"
+          }
+        }
+      }
+    },
+    "AuditEvent": {
+      "id": "AuditEvent",
+      "type": "object",
+      "description": "A security-relevant event, such as a login or a change made through this API. Fields which don't apply to the type of event are empty.",
+      "properties": {
+        "id": {
+          "type": "string"
+        },
+        "type": {
+          "type": "string",
+          "description": "The type of the event, e.g. \"login.failed\" or \"admin.client_deleted\"."
+        },
+        "time": {
+          "type": "string",
+          "format": "date-time"
+        },
+        "userID": {
+          "type": "string"
+        },
+        "clientID": {
+          "type": "string"
+        },
+        "connectorID": {
+          "type": "string"
+        },
+        "ip": {
+          "type": "string",
+          "description": "The address the request causing the event came from, if known."
+        },
+        "details": {
+          "type": "object",
+          "description": "Further information depending on the type of the event.",
+          "additionalProperties": {
+            "type": "string"
+          }
+        }
+      }
+    },
+    "AuditEventsResponse": {
+      "id": "AuditEventsResponse",
+      "type": "object",
+      "properties": {
+        "auditEvents": {
+          "type": "array",
+          "items": {
+            "$ref": "AuditEvent"
+          }
+        },
+        "nextPageToken": {
+          "type": "string"
+        }
+      }
     }
   },
   "resources": {
@@ -190,6 +480,15 @@ const DiscoveryJSON = `{
     },
     "Client": {
       "methods": {
+        "List": {
+          "id": "dex.admin.Client.List",
+          "description": "List all clients. Their secrets are not returned.",
+          "httpMethod": "GET",
+          "path": "client",
+          "response": {
+            "$ref": "ClientsResponse"
+          }
+        },
         "Create": {
           "id": "dex.admin.Client.Create",
           "description": "Register an OpenID Connect client.",
@@ -201,6 +500,85 @@ const DiscoveryJSON = `{
           "response": {
             "$ref": "ClientCreateResponse"
           }
+        },
+        "Get": {
+          "id": "dex.admin.Client.Get",
+          "description": "Retrieve information about a client. Its secret is not returned.",
+          "httpMethod": "GET",
+          "path": "client/{id}",
+          "parameters": {
+            "id": {
+              "type": "string",
+              "required": true,
+              "location": "path"
+            }
+          },
+          "parameterOrder": [
+            "id"
+          ],
+          "response": {
+            "$ref": "Client"
+          }
+        },
+        "Update": {
+          "id": "dex.admin.Client.Update",
+          "description": "Replace the redirect URIs, metadata and settings of a client. Its ID and secret are left alone.",
+          "httpMethod": "PUT",
+          "path": "client/{id}",
+          "parameters": {
+            "id": {
+              "type": "string",
+              "required": true,
+              "location": "path"
+            }
+          },
+          "parameterOrder": [
+            "id"
+          ],
+          "request": {
+            "$ref": "Client"
+          },
+          "response": {
+            "$ref": "Client"
+          }
+        },
+        "Delete": {
+          "id": "dex.admin.Client.Delete",
+          "description": "Delete a client and revoke the access and refresh tokens issued to it. A 204 status code indicates the action was successful.",
+          "httpMethod": "DELETE",
+          "path": "client/{id}",
+          "parameters": {
+            "id": {
+              "type": "string",
+              "required": true,
+              "location": "path"
+            }
+          },
+          "parameterOrder": [
+            "id"
+          ]
+        },
+        "RotateSecret": {
+          "id": "dex.admin.Client.RotateSecret",
+          "description": "Replace the secret of a client. The replaced secret keeps working for the requested overlap, so the client can be moved to the new one without downtime.",
+          "httpMethod": "POST",
+          "path": "client/{id}/secret",
+          "parameters": {
+            "id": {
+              "type": "string",
+              "required": true,
+              "location": "path"
+            }
+          },
+          "parameterOrder": [
+            "id"
+          ],
+          "request": {
+            "$ref": "ClientSecretRotateRequest"
+          },
+          "response": {
+            "$ref": "ClientSecretRotateResponse"
+          }
         }
       }
     },
@@ -225,6 +603,337 @@ const DiscoveryJSON = `{
           }
         }
       }
+    },
+    "Groups": {
+      "methods": {
+        "List": {
+          "id": "dex.admin.Group.List",
+          "description": "List all groups, ordered by name.",
+          "httpMethod": "GET",
+          "path": "groups",
+          "response": {
+            "$ref": "GroupsResponse"
+          }
+        },
+        "Create": {
+          "id": "dex.admin.Group.Create",
+          "description": "Create a new group.",
+          "httpMethod": "POST",
+          "path": "groups",
+          "request": {
+            "$ref": "Group"
+          },
+          "response": {
+            "$ref": "Group"
+          }
+        },
+        "Get": {
+          "id": "dex.admin.Group.Get",
+          "description": "Retrieve information about a group.",
+          "httpMethod": "GET",
+          "path": "groups/{id}",
+          "parameters": {
+            "id": {
+              "type": "string",
+              "required": true,
+              "location": "path"
+            }
+          },
+          "parameterOrder": [
+            "id"
+          ],
+          "response": {
+            "$ref": "Group"
+          }
+        },
+        "Delete": {
+          "id": "dex.admin.Group.Delete",
+          "description": "Delete a group and all of its memberships. A 204 status code indicates the action was successful.",
+          "httpMethod": "DELETE",
+          "path": "groups/{id}",
+          "parameters": {
+            "id": {
+              "type": "string",
+              "required": true,
+              "location": "path"
+            }
+          },
+          "parameterOrder": [
+            "id"
+          ]
+        }
+      }
+    },
+    "GroupMembers": {
+      "methods": {
+        "List": {
+          "id": "dex.admin.GroupMember.List",
+          "description": "List the IDs of the users in a group, including members synced from connectors.",
+          "httpMethod": "GET",
+          "path": "groups/{id}/members",
+          "parameters": {
+            "id": {
+              "type": "string",
+              "required": true,
+              "location": "path"
+            }
+          },
+          "parameterOrder": [
+            "id"
+          ],
+          "response": {
+            "$ref": "GroupMembersResponse"
+          }
+        },
+        "Add": {
+          "id": "dex.admin.GroupMember.Add",
+          "description": "Add a user to a group. A 204 status code indicates the action was successful.",
+          "httpMethod": "PUT",
+          "path": "groups/{id}/members/{userId}",
+          "parameters": {
+            "id": {
+              "type": "string",
+              "required": true,
+              "location": "path"
+            },
+            "userId": {
+              "type": "string",
+              "required": true,
+              "location": "path"
+            }
+          },
+          "parameterOrder": [
+            "id",
+            "userId"
+          ]
+        },
+        "Remove": {
+          "id": "dex.admin.GroupMember.Remove",
+          "description": "Remove a user added through this API from a group. Members synced from connectors can't be removed. A 204 status code indicates the action was successful.",
+          "httpMethod": "DELETE",
+          "path": "groups/{id}/members/{userId}",
+          "parameters": {
+            "id": {
+              "type": "string",
+              "required": true,
+              "location": "path"
+            },
+            "userId": {
+              "type": "string",
+              "required": true,
+              "location": "path"
+            }
+          },
+          "parameterOrder": [
+            "id",
+            "userId"
+          ]
+        }
+      }
+    },
+    "Lockouts": {
+      "methods": {
+        "List": {
+          "id": "dex.admin.Lockout.List",
+          "description": "List the accounts and IPs which are locked out after too many failed logins.",
+          "httpMethod": "GET",
+          "path": "lockouts",
+          "response": {
+            "$ref": "LockoutsResponse"
+          }
+        },
+        "Delete": {
+          "id": "dex.admin.Lockout.Delete",
+          "description": "Unlock an account or IP, and clear its failed logins. A 204 status code indicates the action was successful.",
+          "httpMethod": "DELETE",
+          "path": "lockouts/{id}",
+          "parameters": {
+            "id": {
+              "type": "string",
+              "required": true,
+              "location": "path"
+            }
+          },
+          "parameterOrder": [
+            "id"
+          ]
+        }
+      }
+    },
+    "MFA": {
+      "methods": {
+        "Reset": {
+          "id": "dex.admin.MFA.Reset",
+          "description": "Remove a user's second factor enrollment, along with their recovery codes. The user enrolls again at their next login if a second factor is required. A 204 status code indicates the action was successful.",
+          "httpMethod": "DELETE",
+          "path": "users/{userId}/mfa",
+          "parameters": {
+            "userId": {
+              "type": "string",
+              "required": true,
+              "location": "path"
+            }
+          },
+          "parameterOrder": [
+            "userId"
+          ]
+        }
+      }
+    },
+    "RemoteIdentities": {
+      "methods": {
+        "List": {
+          "id": "dex.admin.RemoteIdentity.List",
+          "description": "List the remote identities a user can log in with.",
+          "httpMethod": "GET",
+          "path": "users/{userId}/remote-identities",
+          "parameters": {
+            "userId": {
+              "type": "string",
+              "required": true,
+              "location": "path"
+            }
+          },
+          "parameterOrder": [
+            "userId"
+          ],
+          "response": {
+            "$ref": "RemoteIdentitiesResponse"
+          }
+        },
+        "Link": {
+          "id": "dex.admin.RemoteIdentity.Link",
+          "description": "Link a remote identity to a user, who can log in with it from then on. The identity can't be linked to another user. A 204 status code indicates the action was successful.",
+          "httpMethod": "PUT",
+          "path": "users/{userId}/remote-identities/{connectorId}/{remoteId}",
+          "parameters": {
+            "userId": {
+              "type": "string",
+              "required": true,
+              "location": "path"
+            },
+            "connectorId": {
+              "type": "string",
+              "required": true,
+              "location": "path"
+            },
+            "remoteId": {
+              "type": "string",
+              "required": true,
+              "location": "path"
+            }
+          },
+          "parameterOrder": [
+            "userId",
+            "connectorId",
+            "remoteId"
+          ]
+        },
+        "Unlink": {
+          "id": "dex.admin.RemoteIdentity.Unlink",
+          "description": "Unlink a remote identity from a user, who can't log in with it anymore. A 204 status code indicates the action was successful.",
+          "httpMethod": "DELETE",
+          "path": "users/{userId}/remote-identities/{connectorId}/{remoteId}",
+          "parameters": {
+            "userId": {
+              "type": "string",
+              "required": true,
+              "location": "path"
+            },
+            "connectorId": {
+              "type": "string",
+              "required": true,
+              "location": "path"
+            },
+            "remoteId": {
+              "type": "string",
+              "required": true,
+              "location": "path"
+            }
+          },
+          "parameterOrder": [
+            "userId",
+            "connectorId",
+            "remoteId"
+          ]
+        }
+      }
+    },
+    "InitialAccessTokens": {
+      "methods": {
+        "List": {
+          "id": "dex.admin.InitialAccessToken.List",
+          "description": "List the initial access tokens. The tokens themselves are not returned.",
+          "httpMethod": "GET",
+          "path": "initial-access-tokens",
+          "response": {
+            "$ref": "InitialAccessTokensResponse"
+          }
+        },
+        "Create": {
+          "id": "dex.admin.InitialAccessToken.Create",
+          "description": "Issue an initial access token, which allows registering clients dynamically when the registration endpoint requires one.",
+          "httpMethod": "POST",
+          "path": "initial-access-tokens",
+          "request": {
+            "$ref": "InitialAccessTokenCreateRequest"
+          },
+          "response": {
+            "$ref": "InitialAccessTokenCreateResponse"
+          }
+        },
+        "Delete": {
+          "id": "dex.admin.InitialAccessToken.Delete",
+          "description": "Revoke an initial access token. Clients registered with it are left alone. A 204 status code indicates the action was successful.",
+          "httpMethod": "DELETE",
+          "path": "initial-access-tokens/{id}",
+          "parameters": {
+            "id": {
+              "type": "string",
+              "required": true,
+              "location": "path"
+            }
+          },
+          "parameterOrder": [
+            "id"
+          ]
+        }
+      }
+    },
+    "AuditEvents": {
+      "methods": {
+        "List": {
+          "id": "dex.admin.AuditEvent.List",
+          "description": "Retrieve a page of audit events, newest first, optionally only those of a type, user or client.",
+          "httpMethod": "GET",
+          "path": "audit-events",
+          "parameters": {
+            "type": {
+              "type": "string",
+              "location": "query"
+            },
+            "userID": {
+              "type": "string",
+              "location": "query"
+            },
+            "clientID": {
+              "type": "string",
+              "location": "query"
+            },
+            "nextPageToken": {
+              "type": "string",
+              "location": "query"
+            },
+            "maxResults": {
+              "type": "integer",
+              "location": "query"
+            }
+          },
+          "response": {
+            "$ref": "AuditEventsResponse"
+          }
+        }
+      }
     }
   }
 }
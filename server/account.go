@@ -0,0 +1,421 @@
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/coreos/dex/audit"
+	"github.com/coreos/dex/consent"
+	"github.com/coreos/dex/lockout"
+	phttp "github.com/coreos/dex/pkg/http"
+	"github.com/coreos/dex/pkg/log"
+	schema "github.com/coreos/dex/schema/workerschema"
+	"github.com/coreos/dex/session"
+	"github.com/coreos/dex/user"
+	usersapi "github.com/coreos/dex/user/api"
+	usermanager "github.com/coreos/dex/user/manager"
+)
+
+type accountTemplateData struct {
+	Error   string
+	Message string
+
+	// Success and FormError tell the user how the change they just made
+	// went.
+	Success   string
+	FormError string
+
+	DisplayName   string
+	Email         string
+	EmailVerified bool
+	HasPassword   bool
+	Identities    []accountIdentity
+	Clients       []*schema.RefreshClient
+
+	CSRFToken string
+	PostURL   string
+	LogoutURL string
+}
+
+type accountIdentity struct {
+	ConnectorID string
+	ID          string
+
+	// Removable is false for the identity the user is logged in with.
+	Removable bool
+}
+
+// accountFormError is a mistake the user made when changing their account,
+// which is shown to them on the account page.
+type accountFormError string
+
+func (e accountFormError) Error() string {
+	return string(e)
+}
+
+// accountPasswordChange changes the password of a user who proved they know
+// their current one.
+type accountPasswordChange struct {
+	userID   string
+	password user.Password
+}
+
+func (c accountPasswordChange) UserID() string {
+	return c.userID
+}
+
+func (c accountPasswordChange) Password() user.Password {
+	return c.password
+}
+
+func (c accountPasswordChange) Callback() *url.URL {
+	return nil
+}
+
+// handleAccount serves the account portal, where users logged in to dex can
+// change their profile and password, remove the remote identities linked to
+// their account and revoke the access of clients holding refresh tokens.
+// Users without a browser session are sent to log in with the account
+// client first.
+func (s *Server) handleAccount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "POST" {
+		w.Header().Set("Allow", "GET, POST")
+		phttp.WriteError(w, http.StatusMethodNotAllowed, "GET or POST only acceptable methods")
+		return
+	}
+
+	bs, err := s.accountBrowserSession(r)
+	if err != nil {
+		log.Errorf("Failed getting browser session: %v", err)
+		s.renderAccountError(w, http.StatusInternalServerError, "An error occurred. Please try again.")
+		return
+	}
+	if bs == nil {
+		http.Redirect(w, r, s.accountLoginURL(), http.StatusFound)
+		return
+	}
+	usr, err := s.UserRepo.Get(nil, bs.UserID)
+	if err != nil {
+		log.Errorf("Failed getting user %q: %v", bs.UserID, err)
+		s.renderAccountError(w, http.StatusInternalServerError, "An error occurred. Please try again.")
+		return
+	}
+
+	var success string
+	status := http.StatusOK
+	if r.Method == "POST" {
+		if !validAccountCSRFToken(bs, r.PostFormValue("csrf_token")) {
+			s.renderAccountError(w, http.StatusForbidden, "This page has expired. Please reload it and try again.")
+			return
+		}
+
+		switch r.PostFormValue("action") {
+		case "profile":
+			success, err = s.updateAccountProfile(r, usr)
+		case "password":
+			success, err = s.changeAccountPassword(r, usr)
+		case "remove-identity":
+			success, err = s.removeAccountIdentity(r, usr, bs)
+		case "revoke-client":
+			success, err = s.revokeAccountClient(r, usr)
+		default:
+			err = accountFormError("Unknown action.")
+		}
+	}
+
+	td, tdErr := s.accountPage(bs)
+	if tdErr != nil {
+		log.Errorf("Failed getting account of user %q: %v", bs.UserID, tdErr)
+		s.renderAccountError(w, http.StatusInternalServerError, "An error occurred. Please try again.")
+		return
+	}
+	switch err.(type) {
+	case nil:
+		td.Success = success
+	case accountFormError:
+		td.FormError = err.Error()
+		status = http.StatusBadRequest
+	default:
+		log.Errorf("Failed changing account of user %q: %v", bs.UserID, err)
+		td.FormError = "An error occurred. Please try again."
+		status = http.StatusInternalServerError
+	}
+	execTemplateWithStatus(w, s.AccountTemplate, td, status)
+}
+
+// handleAccountCallback is where the account client is sent back to once
+// the user logged in. The login left a browser session behind, which
+// identifies the user to the account portal, so the code isn't needed.
+// Logins proving the user owns an account they link another login to go
+// back to the link account page.
+func (s *Server) handleAccountCallback(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		log.Errorf("Account login failed: error=%s description=%s", e, q.Get("error_description"))
+		s.renderAccountError(w, http.StatusBadRequest, "You could not be logged in. Please try again.")
+		return
+	}
+	if code := q.Get("code"); code != "" {
+		if err := s.KillSession(code); err != nil {
+			log.Errorf("Failed killing account session: %v", err)
+		}
+	}
+	if q.Get("state") == linkAccountLoginState {
+		linkURL := s.absURL(httpPathLinkAccount)
+		http.Redirect(w, r, linkURL.String(), http.StatusSeeOther)
+		return
+	}
+	accountURL := s.absURL(httpPathAccount)
+	http.Redirect(w, r, accountURL.String(), http.StatusSeeOther)
+}
+
+// accountBrowserSession returns the browser session of the user-agent if it
+// can log its user in to the account client, and nil otherwise.
+func (s *Server) accountBrowserSession(r *http.Request) (*session.BrowserSession, error) {
+	cookie, err := r.Cookie(cookieBrowserSession)
+	if err != nil {
+		return nil, nil
+	}
+	return s.BrowserSession(cookie.Value, s.AccountClientID)
+}
+
+// accountLoginURL returns the URL of the authorization request which logs
+// the user in to the account client.
+func (s *Server) accountLoginURL() string {
+	return s.accountAuthURL(url.Values{})
+}
+
+// accountAuthURL returns the URL of an authorization request of the account
+// client, with the parameters in q added.
+func (s *Server) accountAuthURL(q url.Values) string {
+	callbackURL := s.absURL(httpPathAccountCallback)
+	u := s.absURL(httpPathAuth)
+	q.Set("response_type", "code")
+	q.Set("client_id", s.AccountClientID)
+	q.Set("redirect_uri", callbackURL.String())
+	q.Set("scope", "openid")
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// accountCSRFToken returns the token the forms of the account page post, so
+// that other sites can't make changes on the user's behalf. It's derived
+// from the browser session ID, which only the user-agent knows.
+func accountCSRFToken(bs *session.BrowserSession) string {
+	h := sha256.Sum256([]byte("account:" + bs.ID))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
+
+func validAccountCSRFToken(bs *session.BrowserSession, token string) bool {
+	return subtle.ConstantTimeCompare([]byte(accountCSRFToken(bs)), []byte(token)) == 1
+}
+
+func (s *Server) accountPage(bs *session.BrowserSession) (accountTemplateData, error) {
+	usr, err := s.UserRepo.Get(nil, bs.UserID)
+	if err != nil {
+		return accountTemplateData{}, err
+	}
+	postURL := s.absURL(httpPathAccount)
+	logoutURL := s.absURL(httpPathEndSession)
+	td := accountTemplateData{
+		DisplayName:   usr.DisplayName,
+		Email:         usr.Email,
+		EmailVerified: usr.EmailVerified,
+		CSRFToken:     accountCSRFToken(bs),
+		PostURL:       postURL.String(),
+		LogoutURL:     logoutURL.String(),
+	}
+
+	_, err = s.PasswordInfoRepo.Get(nil, usr.ID)
+	switch err {
+	case nil:
+		td.HasPassword = true
+	case user.ErrorNotFound:
+	default:
+		return accountTemplateData{}, err
+	}
+
+	rids, err := s.UserRepo.GetRemoteIdentities(nil, usr.ID)
+	if err != nil {
+		return accountTemplateData{}, err
+	}
+	for _, rid := range rids {
+		td.Identities = append(td.Identities, accountIdentity{
+			ConnectorID: rid.ConnectorID,
+			ID:          rid.ID,
+			Removable:   rid.ConnectorID != bs.ConnectorID || rid.ID != bs.Identity.ID,
+		})
+	}
+
+	td.Clients, err = s.usersAPI().ListClientsWithRefreshTokens(usersapi.Creds{User: usr}, usr.ID)
+	if err != nil {
+		return accountTemplateData{}, err
+	}
+	return td, nil
+}
+
+// updateAccountProfile changes the display name and email of the user. A
+// new email has to be verified again.
+func (s *Server) updateAccountProfile(r *http.Request, usr user.User) (string, error) {
+	usr.DisplayName = strings.TrimSpace(r.PostFormValue("display_name"))
+	email := strings.TrimSpace(r.PostFormValue("email"))
+	emailChanged := !strings.EqualFold(email, usr.Email)
+	if emailChanged {
+		usr.Email = email
+		usr.EmailVerified = false
+	}
+
+	switch err := s.UserRepo.Update(nil, usr); err {
+	case nil:
+	case user.ErrorInvalidEmail:
+		return "", accountFormError("Please enter a valid email address.")
+	case user.ErrorDuplicateEmail:
+		return "", accountFormError("That email address is used by another account.")
+	default:
+		return "", err
+	}
+	e := audit.Event{
+		Type:   audit.EventUserUpdated,
+		UserID: usr.ID,
+		IP:     phttp.RemoteIP(r),
+	}
+	if emailChanged {
+		e.Details = map[string]string{"email_changed": "true"}
+	}
+	s.Audit.Record(e)
+
+	if !emailChanged {
+		return "Your profile has been saved.", nil
+	}
+	accountURL := s.absURL(httpPathAccount)
+	if _, err := s.UserEmailer.SendEmailVerification(usr.ID, s.AccountClientID, accountURL); err != nil {
+		log.Errorf("Failed sending email verification to user %q: %v", usr.ID, err)
+	}
+	return "Your profile has been saved. Please check your email to verify your new address.", nil
+}
+
+// changeAccountPassword changes the local password of the user, who has to
+// enter their current one first. Wrong guesses count as failed logins.
+func (s *Server) changeAccountPassword(r *http.Request, usr user.User) (string, error) {
+	pwi, err := s.PasswordInfoRepo.Get(nil, usr.ID)
+	if err == user.ErrorNotFound {
+		return "", accountFormError("Your account has no password.")
+	}
+	if err != nil {
+		return "", err
+	}
+
+	plaintext := r.PostFormValue("password")
+	if plaintext != r.PostFormValue("password_confirm") {
+		return "", accountFormError("The new passwords don't match.")
+	}
+
+	connectorID := s.currentLocalConnectorID()
+	ip := phttp.RemoteIP(r)
+	if s.LoginGuard != nil {
+		switch err := s.LoginGuard.Check(connectorID, usr.Email, ip); err {
+		case nil:
+		case lockout.ErrorLocked:
+			return "", accountFormError("Too many failed attempts. Please try again later.")
+		case lockout.ErrorTooSoon:
+			return "", accountFormError("Please wait a moment before trying again.")
+		default:
+			return "", err
+		}
+	}
+	if err := user.ComparePassword(pwi.Password, r.PostFormValue("current_password")); err != nil {
+		if s.LoginGuard != nil {
+			if err := s.LoginGuard.Failed(connectorID, usr.Email, ip); err != nil {
+				log.Errorf("Unable to record failed login: %v", err)
+			}
+		}
+		return "", accountFormError("Your current password is incorrect.")
+	}
+	if s.LoginGuard != nil {
+		if err := s.LoginGuard.Succeeded(connectorID, usr.Email); err != nil {
+			log.Errorf("Unable to clear failed logins: %v", err)
+		}
+	}
+
+	_, err = s.UserManager.ChangePassword(accountPasswordChange{userID: usr.ID, password: pwi.Password}, plaintext)
+	if err == usermanager.ErrorPasswordAlreadyChanged {
+		return "", accountFormError("Your password was changed in the meantime. Please try again.")
+	}
+	if msg, ok := passwordPolicyMessage(err, s.UserManager.PasswordPolicy); ok {
+		return "", accountFormError(msg)
+	}
+	if err != nil {
+		return "", err
+	}
+	s.Audit.Record(audit.Event{
+		Type:        audit.EventUserPasswordChanged,
+		UserID:      usr.ID,
+		ConnectorID: connectorID,
+		IP:          ip,
+	})
+	return "Your password has been changed.", nil
+}
+
+// removeAccountIdentity unlinks a remote identity from the user, who can't
+// log in with it anymore. The identity the user is logged in with can't be
+// removed, so that users always keep one.
+func (s *Server) removeAccountIdentity(r *http.Request, usr user.User, bs *session.BrowserSession) (string, error) {
+	rid := user.RemoteIdentity{
+		ConnectorID: r.PostFormValue("connector_id"),
+		ID:          r.PostFormValue("identity_id"),
+	}
+	if rid.ConnectorID == bs.ConnectorID && rid.ID == bs.Identity.ID {
+		return "", accountFormError("You can't remove the account you're logged in with.")
+	}
+
+	switch err := s.UserRepo.RemoveRemoteIdentity(nil, usr.ID, rid); err {
+	case nil:
+	case user.ErrorNotFound, user.ErrorInvalidID:
+		return "", accountFormError("That account isn't linked to yours.")
+	default:
+		return "", err
+	}
+	s.Audit.Record(audit.Event{
+		Type:        audit.EventUserRemoteIdentityRemoved,
+		UserID:      usr.ID,
+		ConnectorID: rid.ConnectorID,
+		IP:          phttp.RemoteIP(r),
+	})
+	return "The account has been removed.", nil
+}
+
+// revokeAccountClient revokes the refresh tokens of a client, and the
+// consent the user gave it, so that the client has to ask the user to log
+// in again.
+func (s *Server) revokeAccountClient(r *http.Request, usr user.User) (string, error) {
+	clientID := r.PostFormValue("client_id")
+	if clientID == "" {
+		return "", accountFormError("Unknown application.")
+	}
+	if err := s.usersAPI().RevokeRefreshTokensForClient(usersapi.Creds{User: usr}, usr.ID, clientID); err != nil {
+		return "", err
+	}
+	if s.ConsentGrantRepo != nil {
+		if err := s.ConsentGrantRepo.Delete(usr.ID, clientID); err != nil && err != consent.ErrorNotFound {
+			return "", err
+		}
+	}
+	s.Audit.Record(audit.Event{
+		Type:     audit.EventUserClientRevoked,
+		UserID:   usr.ID,
+		ClientID: clientID,
+		IP:       phttp.RemoteIP(r),
+	})
+	return "The application's access has been revoked.", nil
+}
+
+func (s *Server) renderAccountError(w http.ResponseWriter, status int, msg string) {
+	execTemplateWithStatus(w, s.AccountTemplate, accountTemplateData{
+		Error:   "Unable to continue",
+		Message: msg,
+	}, status)
+}
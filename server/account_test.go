@@ -0,0 +1,268 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc/oidc"
+	"github.com/jonboulle/clockwork"
+	"github.com/kylelemons/godebug/pretty"
+
+	"github.com/coreos/dex/db"
+	"github.com/coreos/dex/session"
+	"github.com/coreos/dex/user"
+)
+
+// makeAccountTestFixtures returns fixtures with the account portal enabled,
+// and the browser session cookie of ID-1, who logged in as IDPC-1/RID-1.
+func makeAccountTestFixtures(t *testing.T) (*testFixtures, *http.Cookie) {
+	f, err := makeTestFixtures()
+	if err != nil {
+		t.Fatalf("error making test fixtures: %v", err)
+	}
+	f.srv.BrowserSessionRepo = db.NewBrowserSessionRepo(db.NewMemDB())
+	f.srv.AccountClientID = testClientID
+
+	key, err := f.srv.NewSession(session.SessionRequest{
+		ConnectorID:  "IDPC-1",
+		ClientID:     testClientID,
+		RedirectURL:  testRedirectURL,
+		Scope:        []string{"openid"},
+		ResponseType: "code",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating session: %v", err)
+	}
+	token, expiresAt, err := f.srv.StartBrowserSession(key)
+	if err != nil {
+		t.Fatalf("unexpected error starting browser session: %v", err)
+	}
+	if _, err := f.srv.Login(oidc.Identity{ID: "RID-1"}, nil, key); err != nil {
+		t.Fatalf("unexpected error logging in: %v", err)
+	}
+	return f, createBrowserSessionCookie(token, expiresAt)
+}
+
+func TestHandleAccountLogin(t *testing.T) {
+	f, _ := makeAccountTestFixtures(t)
+
+	// Users who aren't logged in are sent to log in with the account client.
+	req, err := http.NewRequest("GET", "http://server.example.com/account", nil)
+	if err != nil {
+		t.Fatalf("unable to form HTTP request: %v", err)
+	}
+	w := httptest.NewRecorder()
+	f.srv.handleAccount(w, req)
+	if w.Code != http.StatusFound {
+		t.Fatalf("want HTTP %d, got %d", http.StatusFound, w.Code)
+	}
+	if got, want := w.Header().Get("Location"), f.srv.accountLoginURL(); got != want {
+		t.Errorf("want Location %q, got %q", want, got)
+	}
+	u, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := u.Query().Get("client_id"); got != testClientID {
+		t.Errorf("want client_id %q, got %q", testClientID, got)
+	}
+
+	// The code the account client gets back is thrown away.
+	key, err := f.srv.NewSession(session.SessionRequest{
+		ConnectorID:  "IDPC-1",
+		ClientID:     testClientID,
+		RedirectURL:  testRedirectURL,
+		Scope:        []string{"openid"},
+		ResponseType: "code",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating session: %v", err)
+	}
+	req, err = http.NewRequest("GET", "http://server.example.com/account/callback?code="+url.QueryEscape(key), nil)
+	if err != nil {
+		t.Fatalf("unable to form HTTP request: %v", err)
+	}
+	w = httptest.NewRecorder()
+	f.srv.handleAccountCallback(w, req)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("want HTTP %d, got %d", http.StatusSeeOther, w.Code)
+	}
+	if got, want := w.Header().Get("Location"), "http://server.example.com/account"; got != want {
+		t.Errorf("want Location %q, got %q", want, got)
+	}
+	if _, err := f.srv.SessionManager.PeekKey(key); err == nil {
+		t.Errorf("want session key to be used up")
+	}
+
+	req, err = http.NewRequest("GET", "http://server.example.com/account/callback?error=access_denied", nil)
+	if err != nil {
+		t.Fatalf("unable to form HTTP request: %v", err)
+	}
+	w = httptest.NewRecorder()
+	f.srv.handleAccountCallback(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("want HTTP %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestHandleAccount(t *testing.T) {
+	f, cookie := makeAccountTestFixtures(t)
+
+	pw, err := user.NewPasswordFromPlaintext("password")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := f.srv.PasswordInfoRepo.Update(nil, user.PasswordInfo{UserID: "ID-1", Password: pw}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := f.userRepo.AddRemoteIdentity(nil, "ID-1", user.RemoteIdentity{ConnectorID: "IDPC-2", ID: "RID-3"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := f.srv.RefreshTokenRepo.Create("ID-1", testClientID, []string{"openid", "offline_access"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	req, err := http.NewRequest("GET", "http://server.example.com/account", nil)
+	if err != nil {
+		t.Fatalf("unable to form HTTP request: %v", err)
+	}
+	req.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	f.srv.handleAccount(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("want HTTP %d, got %d", http.StatusOK, w.Code)
+	}
+	for _, want := range []string{"email-1@example.com", "IDPC-1: RID-1", "IDPC-2: RID-3", `name="client_id" value="` + testClientID + `"`, `name="csrf_token"`} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("want account page to contain %q", want)
+		}
+	}
+	bs, err := f.srv.accountBrowserSession(req)
+	if err != nil || bs == nil {
+		t.Fatalf("want browser session, got %v, %v", bs, err)
+	}
+	csrfToken := accountCSRFToken(bs)
+
+	post := func(form url.Values) *httptest.ResponseRecorder {
+		if form.Get("csrf_token") == "" {
+			form.Set("csrf_token", csrfToken)
+		}
+		req, err := http.NewRequest("POST", "http://server.example.com/account", strings.NewReader(form.Encode()))
+		if err != nil {
+			t.Fatalf("unable to form HTTP request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		f.srv.handleAccount(w, req)
+		return w
+	}
+
+	tests := []struct {
+		form     url.Values
+		wantCode int
+	}{
+		{
+			form:     url.Values{"action": {"profile"}, "email": {"Email-1@example.com"}, "csrf_token": {"bogus"}},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			form:     url.Values{"action": {"bogus"}},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			form:     url.Values{"action": {"profile"}, "email": {"not-an-email"}},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			form:     url.Values{"action": {"profile"}, "email": {"Email-Verified@example.com"}},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			form:     url.Values{"action": {"password"}, "current_password": {"wrong"}, "password": {"new-password"}, "password_confirm": {"new-password"}},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			form:     url.Values{"action": {"password"}, "current_password": {"password"}, "password": {"new-password"}, "password_confirm": {"other-password"}},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			form:     url.Values{"action": {"password"}, "current_password": {"password"}, "password": {"short"}, "password_confirm": {"short"}},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			form:     url.Values{"action": {"remove-identity"}, "connector_id": {"IDPC-1"}, "identity_id": {"RID-1"}},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			form:     url.Values{"action": {"remove-identity"}, "connector_id": {"IDPC-1"}, "identity_id": {"RID-2"}},
+			wantCode: http.StatusBadRequest,
+		},
+	}
+	// Wrong guesses of the current password delay the next attempt.
+	clock := clockwork.NewFakeClock()
+	f.srv.LoginGuard.Clock = clock
+	for i, tt := range tests {
+		clock.Advance(time.Hour)
+		if w := post(tt.form); w.Code != tt.wantCode {
+			t.Errorf("case %d: want HTTP %d, got %d", i, tt.wantCode, w.Code)
+		}
+	}
+
+	// Nothing was changed so far.
+	usr, err := f.userRepo.Get(nil, "ID-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if usr.Email != "email-1@example.com" {
+		t.Errorf("want email to be unchanged, got %q", usr.Email)
+	}
+
+	if w := post(url.Values{"action": {"profile"}, "display_name": {"Jo"}, "email": {"jo@example.com"}}); w.Code != http.StatusOK {
+		t.Errorf("want HTTP %d, got %d", http.StatusOK, w.Code)
+	}
+	usr, err = f.userRepo.Get(nil, "ID-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if usr.DisplayName != "Jo" || usr.Email != "jo@example.com" || usr.EmailVerified {
+		t.Errorf("want user to be updated, got %#v", usr)
+	}
+
+	if w := post(url.Values{"action": {"password"}, "current_password": {"password"}, "password": {"new-password"}, "password_confirm": {"new-password"}}); w.Code != http.StatusOK {
+		t.Errorf("want HTTP %d, got %d", http.StatusOK, w.Code)
+	}
+	pwi, err := f.srv.PasswordInfoRepo.Get(nil, "ID-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := user.ComparePassword(pwi.Password, "new-password"); err != nil {
+		t.Errorf("want password to be changed: %v", err)
+	}
+
+	if w := post(url.Values{"action": {"remove-identity"}, "connector_id": {"IDPC-2"}, "identity_id": {"RID-3"}}); w.Code != http.StatusOK {
+		t.Errorf("want HTTP %d, got %d", http.StatusOK, w.Code)
+	}
+	rids, err := f.userRepo.GetRemoteIdentities(nil, "ID-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff := pretty.Compare([]user.RemoteIdentity{{ConnectorID: "IDPC-1", ID: "RID-1"}}, rids); diff != "" {
+		t.Errorf("Compare(want, got) = %v", diff)
+	}
+
+	if w := post(url.Values{"action": {"revoke-client"}, "client_id": {testClientID}}); w.Code != http.StatusOK {
+		t.Errorf("want HTTP %d, got %d", http.StatusOK, w.Code)
+	}
+	clients, err := f.srv.RefreshTokenRepo.ClientsWithRefreshTokens("ID-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(clients) != 0 {
+		t.Errorf("want no clients with refresh tokens, got %d", len(clients))
+	}
+}
@@ -5,14 +5,18 @@ import (
 	"encoding/json"
 	"net/http"
 	"path"
+	"strings"
 
 	"github.com/coreos/pkg/health"
 	"github.com/julienschmidt/httprouter"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"github.com/coreos/dex/admin"
+	"github.com/coreos/dex/audit"
 	"github.com/coreos/dex/connector"
 	"github.com/coreos/dex/pkg/log"
 	"github.com/coreos/dex/schema/adminschema"
+	"github.com/coreos/dex/user"
 	"github.com/coreos/go-oidc/key"
 )
 
@@ -26,7 +30,25 @@ var (
 	AdminCreateEndpoint       = addBasePath("/admin")
 	AdminGetStateEndpoint     = addBasePath("/state")
 	AdminCreateClientEndpoint = addBasePath("/client")
+	AdminClientEndpoint       = addBasePath("/client/:id")
+	AdminClientSecretEndpoint = addBasePath("/client/:id/secret")
 	AdminConnectorsEndpoint   = addBasePath("/connectors")
+	AdminGroupsEndpoint       = addBasePath("/groups")
+	AdminGroupEndpoint        = addBasePath("/groups/:id")
+	AdminGroupMembersEndpoint = addBasePath("/groups/:id/members")
+	AdminGroupMemberEndpoint  = addBasePath("/groups/:id/members/:userId")
+	AdminLockoutsEndpoint     = addBasePath("/lockouts")
+	AdminLockoutEndpoint      = addBasePath("/lockouts/:id")
+	AdminUserMFAEndpoint      = addBasePath("/users/:id/mfa")
+
+	// Remote identity IDs, such as LDAP DNs or SAML name IDs, may contain
+	// slashes, so the last segment catches the rest of the path.
+	AdminUserRemoteIdentitiesEndpoint = addBasePath("/users/:id/remote-identities")
+	AdminUserRemoteIdentityEndpoint   = addBasePath("/users/:id/remote-identities/:connectorId/*remoteId")
+
+	AdminInitialAccessTokensEndpoint = addBasePath("/initial-access-tokens")
+	AdminInitialAccessTokenEndpoint  = addBasePath("/initial-access-tokens/:id")
+	AdminAuditEventsEndpoint         = addBasePath("/audit-events")
 )
 
 // AdminServer serves the admin API.
@@ -54,12 +76,35 @@ func (s *AdminServer) HTTPHandler() http.Handler {
 	r.POST(AdminCreateEndpoint, s.createAdmin)
 	r.GET(AdminGetStateEndpoint, s.getState)
 	r.POST(AdminCreateClientEndpoint, s.createClient)
+	r.GET(AdminCreateClientEndpoint, s.listClients)
+	r.GET(AdminClientEndpoint, s.getClient)
+	r.PUT(AdminClientEndpoint, s.updateClient)
+	r.DELETE(AdminClientEndpoint, s.deleteClient)
+	r.POST(AdminClientSecretEndpoint, s.rotateClientSecret)
 	r.Handler("GET", httpPathHealth, s.checker)
 	r.HandlerFunc("GET", httpPathDebugVars, health.ExpvarHandler)
+	r.Handler("GET", httpPathMetrics, promhttp.Handler())
 	r.PUT(AdminConnectorsEndpoint, s.setConnectors)
 	r.GET(AdminConnectorsEndpoint, s.getConnectors)
+	r.GET(AdminGroupsEndpoint, s.listGroups)
+	r.POST(AdminGroupsEndpoint, s.createGroup)
+	r.GET(AdminGroupEndpoint, s.getGroup)
+	r.DELETE(AdminGroupEndpoint, s.deleteGroup)
+	r.GET(AdminGroupMembersEndpoint, s.listGroupMembers)
+	r.PUT(AdminGroupMemberEndpoint, s.addGroupMember)
+	r.DELETE(AdminGroupMemberEndpoint, s.removeGroupMember)
+	r.GET(AdminLockoutsEndpoint, s.listLockouts)
+	r.DELETE(AdminLockoutEndpoint, s.unlock)
+	r.DELETE(AdminUserMFAEndpoint, s.resetMFA)
+	r.GET(AdminUserRemoteIdentitiesEndpoint, s.listRemoteIdentities)
+	r.PUT(AdminUserRemoteIdentityEndpoint, s.linkRemoteIdentity)
+	r.DELETE(AdminUserRemoteIdentityEndpoint, s.unlinkRemoteIdentity)
+	r.GET(AdminInitialAccessTokensEndpoint, s.listInitialAccessTokens)
+	r.POST(AdminInitialAccessTokensEndpoint, s.createInitialAccessToken)
+	r.DELETE(AdminInitialAccessTokenEndpoint, s.deleteInitialAccessToken)
+	r.GET(AdminAuditEventsEndpoint, s.listAuditEvents)
 
-	return authorizer(r, s.secret, httpPathHealth, httpPathDebugVars)
+	return instrumentHandler("admin", authorizer(r, s.secret, httpPathHealth, httpPathDebugVars, httpPathMetrics))
 }
 
 func authorizer(h http.Handler, secret string, public ...string) http.Handler {
@@ -135,6 +180,62 @@ func (s *AdminServer) createClient(w http.ResponseWriter, r *http.Request, ps ht
 	writeResponseWithBody(w, http.StatusOK, &resp)
 }
 
+func (s *AdminServer) listClients(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	resp, err := s.adminAPI.ListClients()
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	writeResponseWithBody(w, http.StatusOK, &resp)
+}
+
+func (s *AdminServer) getClient(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	cli, err := s.adminAPI.GetClient(ps.ByName("id"))
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	writeResponseWithBody(w, http.StatusOK, cli)
+}
+
+func (s *AdminServer) updateClient(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	cli := adminschema.Client{}
+	if err := json.NewDecoder(r.Body).Decode(&cli); err != nil {
+		writeInvalidRequest(w, "cannot parse JSON body")
+		return
+	}
+
+	cli, err := s.adminAPI.UpdateClient(ps.ByName("id"), cli)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	writeResponseWithBody(w, http.StatusOK, cli)
+}
+
+func (s *AdminServer) deleteClient(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if err := s.adminAPI.DeleteClient(ps.ByName("id")); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *AdminServer) rotateClientSecret(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	req := adminschema.ClientSecretRotateRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalidRequest(w, "cannot parse JSON body")
+		return
+	}
+
+	resp, err := s.adminAPI.RotateClientSecret(ps.ByName("id"), req)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	writeResponseWithBody(w, http.StatusOK, &resp)
+}
+
 func (s *AdminServer) setConnectors(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	var req struct {
 		Connectors json.RawMessage `json:"connectors"`
@@ -170,6 +271,187 @@ func (s *AdminServer) getConnectors(w http.ResponseWriter, r *http.Request, ps h
 	writeResponseWithBody(w, http.StatusOK, &resp)
 }
 
+func (s *AdminServer) listGroups(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	resp, err := s.adminAPI.ListGroups()
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	writeResponseWithBody(w, http.StatusOK, &resp)
+}
+
+func (s *AdminServer) createGroup(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	grp := adminschema.Group{}
+	if err := json.NewDecoder(r.Body).Decode(&grp); err != nil {
+		writeInvalidRequest(w, "cannot parse JSON body")
+		return
+	}
+
+	id, err := s.adminAPI.CreateGroup(grp)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	grp.Id = id
+	w.Header().Set("Location", AdminGroupsEndpoint+"/"+id)
+	writeResponseWithBody(w, http.StatusOK, grp)
+}
+
+func (s *AdminServer) getGroup(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	grp, err := s.adminAPI.GetGroup(ps.ByName("id"))
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	writeResponseWithBody(w, http.StatusOK, grp)
+}
+
+func (s *AdminServer) deleteGroup(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if err := s.adminAPI.DeleteGroup(ps.ByName("id")); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *AdminServer) listGroupMembers(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	resp, err := s.adminAPI.ListGroupMembers(ps.ByName("id"))
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	writeResponseWithBody(w, http.StatusOK, &resp)
+}
+
+func (s *AdminServer) addGroupMember(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if err := s.adminAPI.AddGroupMember(ps.ByName("id"), ps.ByName("userId")); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *AdminServer) removeGroupMember(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if err := s.adminAPI.RemoveGroupMember(ps.ByName("id"), ps.ByName("userId")); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *AdminServer) listLockouts(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	resp, err := s.adminAPI.ListLockouts()
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	writeResponseWithBody(w, http.StatusOK, &resp)
+}
+
+func (s *AdminServer) unlock(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if err := s.adminAPI.Unlock(ps.ByName("id")); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *AdminServer) resetMFA(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if err := s.adminAPI.ResetMFA(ps.ByName("id")); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *AdminServer) listRemoteIdentities(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	resp, err := s.adminAPI.ListRemoteIdentities(ps.ByName("id"))
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	writeResponseWithBody(w, http.StatusOK, &resp)
+}
+
+func (s *AdminServer) linkRemoteIdentity(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if err := s.adminAPI.LinkRemoteIdentity(ps.ByName("id"), remoteIdentityParam(ps)); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *AdminServer) unlinkRemoteIdentity(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if err := s.adminAPI.UnlinkRemoteIdentity(ps.ByName("id"), remoteIdentityParam(ps)); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// remoteIdentityParam returns the remote identity in the path of a request
+// to AdminUserRemoteIdentityEndpoint.
+func remoteIdentityParam(ps httprouter.Params) user.RemoteIdentity {
+	return user.RemoteIdentity{
+		ConnectorID: ps.ByName("connectorId"),
+		ID:          strings.TrimPrefix(ps.ByName("remoteId"), "/"),
+	}
+}
+
+func (s *AdminServer) listInitialAccessTokens(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	resp, err := s.adminAPI.ListInitialAccessTokens()
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	writeResponseWithBody(w, http.StatusOK, &resp)
+}
+
+func (s *AdminServer) createInitialAccessToken(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	req := adminschema.InitialAccessTokenCreateRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalidRequest(w, "cannot parse JSON body")
+		return
+	}
+
+	resp, err := s.adminAPI.CreateInitialAccessToken(req)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	writeResponseWithBody(w, http.StatusOK, &resp)
+}
+
+func (s *AdminServer) deleteInitialAccessToken(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if err := s.adminAPI.DeleteInitialAccessToken(ps.ByName("id")); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *AdminServer) listAuditEvents(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	q := r.URL.Query()
+	maxResults, err := intFromQuery(q, "maxResults", defaultMaxResults)
+	if err != nil {
+		writeInvalidRequest(w, "maxResults must be an integer")
+		return
+	}
+	filter := audit.EventFilter{
+		Type:     q.Get("type"),
+		UserID:   q.Get("userID"),
+		ClientID: q.Get("clientID"),
+	}
+
+	resp, err := s.adminAPI.ListAuditEvents(filter, maxResults, q.Get("nextPageToken"))
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	writeResponseWithBody(w, http.StatusOK, &resp)
+}
+
 func (s *AdminServer) writeError(w http.ResponseWriter, err error) {
 	log.Errorf("Error calling admin API: %v: ", err)
 	if adminErr, ok := err.(admin.Error); ok {
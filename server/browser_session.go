@@ -0,0 +1,320 @@
+package server
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/coreos/go-oidc/jose"
+	"github.com/coreos/go-oidc/oidc"
+
+	"github.com/coreos/dex/audit"
+	"github.com/coreos/dex/mfa"
+	pcrypto "github.com/coreos/dex/pkg/crypto"
+	"github.com/coreos/dex/pkg/log"
+	"github.com/coreos/dex/session"
+	"github.com/coreos/dex/user"
+)
+
+// browserSessionIDLength is the number of random bytes in a browser session
+// ID.
+const browserSessionIDLength = 32
+
+// browserSessionTokenType is the "typ" claim of browser session tokens.
+// Other tokens dex signs, such as ID tokens, are signed with the same keys,
+// so the claim and an "aud" of the issuer tell browser session tokens apart.
+const browserSessionTokenType = "browser_session"
+
+var errInvalidBrowserSessionToken = errors.New("invalid browser session token")
+
+func (s *Server) browserSessionValidityWindow() time.Duration {
+	if s.BrowserSessionValidityWindow > 0 {
+		return s.BrowserSessionValidityWindow
+	}
+	return session.DefaultBrowserSessionValidityWindow
+}
+
+// StartBrowserSession assigns a new browser session to the session the key
+// belongs to and returns a signed token for it, which the user-agent keeps in
+// its pending browser session cookie until the session identifies a user.
+// Only then does the user-agent get its browser session cookie, which it
+// uses for single sign-on; see handleBrowserSession. If browser sessions
+// aren't enabled, the token is empty.
+func (s *Server) StartBrowserSession(sessionKey string) (string, time.Time, error) {
+	if s.BrowserSessionRepo == nil {
+		return "", time.Time{}, nil
+	}
+
+	sessionID, err := s.SessionManager.PeekKey(sessionKey)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	b, err := pcrypto.RandBytes(browserSessionIDLength)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	id := base64.RawURLEncoding.EncodeToString(b)
+	if _, err := s.SessionManager.SetBrowserSession(sessionID, id); err != nil {
+		return "", time.Time{}, err
+	}
+
+	expiresAt := time.Now().Add(s.browserSessionValidityWindow())
+	token, err := s.browserSessionToken(id, expiresAt)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// browserSessionToken returns a signed token referring to the browser
+// session with the given ID.
+func (s *Server) browserSessionToken(id string, expiresAt time.Time) (string, error) {
+	signer, err := s.KeyManager.Signer()
+	if err != nil {
+		return "", err
+	}
+	claims := jose.Claims{
+		"iss": s.IssuerURL.String(),
+		"aud": s.IssuerURL.String(),
+		"typ": browserSessionTokenType,
+		"sub": id,
+		"exp": expiresAt.Unix(),
+	}
+	jwt, err := jose.NewSignedJWT(claims, signer)
+	if err != nil {
+		return "", err
+	}
+	return jwt.Encode(), nil
+}
+
+// parseBrowserSessionToken verifies a browser session token and returns the
+// ID of the browser session it refers to.
+func (s *Server) parseBrowserSessionToken(token string) (string, error) {
+	jwt, err := jose.ParseJWT(token)
+	if err != nil {
+		return "", errInvalidBrowserSessionToken
+	}
+	keys, err := s.KeyManager.PublicKeys()
+	if err != nil {
+		return "", err
+	}
+	if ok, err := oidc.VerifySignature(jwt, keys); err != nil || !ok {
+		return "", errInvalidBrowserSessionToken
+	}
+
+	claims, err := jwt.Claims()
+	if err != nil {
+		return "", errInvalidBrowserSessionToken
+	}
+	if iss, _, _ := claims.StringClaim("iss"); iss != s.IssuerURL.String() {
+		return "", errInvalidBrowserSessionToken
+	}
+	if aud, _, _ := claims.StringClaim("aud"); aud != s.IssuerURL.String() {
+		return "", errInvalidBrowserSessionToken
+	}
+	if typ, _, _ := claims.StringClaim("typ"); typ != browserSessionTokenType {
+		return "", errInvalidBrowserSessionToken
+	}
+	if exp, ok, _ := claims.TimeClaim("exp"); !ok || !time.Now().Before(exp) {
+		return "", errInvalidBrowserSessionToken
+	}
+	id, ok, _ := claims.StringClaim("sub")
+	if !ok || id == "" {
+		return "", errInvalidBrowserSessionToken
+	}
+	return id, nil
+}
+
+// BrowserSession returns the browser session the token from a browser
+// session cookie refers to, if it can log its user in to the given client
+// without asking them to authenticate again. Otherwise it returns nil.
+func (s *Server) BrowserSession(token, clientID string) (*session.BrowserSession, error) {
+	if s.BrowserSessionRepo == nil || token == "" {
+		return nil, nil
+	}
+
+	id, err := s.parseBrowserSessionToken(token)
+	if err == errInvalidBrowserSessionToken {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	bs, err := s.BrowserSessionRepo.Get(id)
+	if err == session.ErrorBrowserSessionNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	usr, err := s.UserRepo.Get(nil, bs.UserID)
+	if err == user.ErrorNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if usr.Disabled {
+		return nil, nil
+	}
+
+	// The client may need a second factor the user didn't use.
+	missing, err := s.missingMFA(bs.ConnectorID, clientID, bs.HasAMR(mfa.AMRMFA))
+	if err != nil || missing {
+		return nil, err
+	}
+
+	return bs, nil
+}
+
+// BrowserLogin logs the user of a browser session in to the session the key
+// belongs to, which must have been created for the browser session's
+// connector, and returns the URL the user-agent is sent back to the client
+// with, or the URL of the consent page.
+func (s *Server) BrowserLogin(bs *session.BrowserSession, sessionKey string) (string, error) {
+	sessionID, err := s.SessionManager.ExchangeKey(sessionKey)
+	if err != nil {
+		return "", err
+	}
+
+	ses, err := s.SessionManager.AttachBrowserSession(sessionID, *bs)
+	if err != nil {
+		return "", err
+	}
+
+	ses, err = s.SessionManager.AttachUser(sessionID, bs.UserID)
+	if err != nil {
+		return "", err
+	}
+	log.Infof("Session %s user identified by browser session: clientID=%s user=%s", sessionID, ses.ClientID, bs.UserID)
+	s.Audit.Record(audit.Event{
+		Type:        audit.EventLoginSucceeded,
+		UserID:      bs.UserID,
+		ClientID:    ses.ClientID,
+		ConnectorID: ses.ConnectorID,
+		IP:          ses.RemoteIP,
+		Details:     map[string]string{"sso": "true"},
+	})
+
+	return s.consentRedirectURL(ses, "")
+}
+
+// saveBrowserSession stores the browser session assigned to a session which
+// just identified its user, so that the user-agent can use it for single
+// sign-on.
+func (s *Server) saveBrowserSession(ses *session.Session) error {
+	if s.BrowserSessionRepo == nil || ses.BrowserSessionID == "" {
+		return nil
+	}
+	bs := session.BrowserSession{
+		ID:          ses.BrowserSessionID,
+		ConnectorID: ses.ConnectorID,
+		Identity:    ses.Identity,
+		UserID:      ses.UserID,
+		AuthTime:    ses.AuthTime,
+		ExpiresAt:   ses.AuthTime.Add(s.browserSessionValidityWindow()),
+		AMR:         ses.AMR,
+	}
+	if err := s.BrowserSessionRepo.Create(bs); err != nil {
+		return fmt.Errorf("saving browser session: %v", err)
+	}
+	return nil
+}
+
+// finishLoginURL returns the URL the user-agent is sent to once the session
+// identified its user. If the session started a browser session, the
+// user-agent picks up its browser session cookie on the way; code, if set,
+// is a key of the session which may be used for the purpose.
+func (s *Server) finishLoginURL(ses *session.Session, code string) (string, error) {
+	if s.BrowserSessionRepo == nil || ses.BrowserSessionID == "" {
+		return s.consentRedirectURL(ses, code)
+	}
+
+	if code == "" {
+		var err error
+		if code, err = s.SessionManager.NewSessionKey(ses.ID); err != nil {
+			return "", err
+		}
+	}
+	u := s.absURL(httpPathBrowserSession)
+	q := u.Query()
+	q.Set("code", code)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// handleBrowserSession sets the browser session cookie of a session which
+// just identified its user, and sends the user-agent on to the client. The
+// cookie is only set if the user-agent started the login, as shown by its
+// pending browser session cookie. Setting it no earlier means users stay
+// signed in to their current browser session if they abandon a login.
+func (s *Server) handleBrowserSession(w http.ResponseWriter, r *http.Request) {
+	internalError := func(err error) {
+		log.Errorf("Failed setting browser session cookie: %v", err)
+		writeAPIError(w, http.StatusInternalServerError, newAPIError(errorServerError, ""))
+	}
+
+	sessionID, err := s.SessionManager.ExchangeKey(r.URL.Query().Get("code"))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, newAPIError(errorInvalidRequest, "This login has expired. Please log in again."))
+		return
+	}
+	ses, err := s.identifiedSession(sessionID)
+	if err != nil {
+		log.Errorf("Invalid browser session request: %v", err)
+		writeAPIError(w, http.StatusBadRequest, newAPIError(errorInvalidRequest, "This login has expired. Please log in again."))
+		return
+	}
+
+	var id string
+	if c, err := r.Cookie(cookiePendingBrowserSession); err == nil {
+		id, err = s.parseBrowserSessionToken(c.Value)
+		if err != nil && err != errInvalidBrowserSessionToken {
+			internalError(err)
+			return
+		}
+		http.SetCookie(w, createPendingBrowserSessionCookie("", time.Unix(0, 0)))
+	}
+	if id != "" && id == ses.BrowserSessionID {
+		bs, err := s.BrowserSessionRepo.Get(id)
+		if err != nil {
+			internalError(err)
+			return
+		}
+		token, err := s.browserSessionToken(bs.ID, bs.ExpiresAt)
+		if err != nil {
+			internalError(err)
+			return
+		}
+		http.SetCookie(w, createBrowserSessionCookie(token, bs.ExpiresAt))
+	} else {
+		log.Errorf("Session %s identified its user in another user-agent than it started in, not setting its browser session cookie", ses.ID)
+	}
+
+	ru, err := s.consentRedirectURL(ses, "")
+	if err != nil {
+		internalError(err)
+		return
+	}
+	w.Header().Set("Location", ru)
+	w.WriteHeader(http.StatusFound)
+}
+
+// moveBrowserSession assigns the browser session of ses to the session the
+// key belongs to, which replaces ses.
+func (s *Server) moveBrowserSession(ses *session.Session, sessionKey string) error {
+	if ses.BrowserSessionID == "" {
+		return nil
+	}
+	sessionID, err := s.SessionManager.PeekKey(sessionKey)
+	if err != nil {
+		return err
+	}
+	_, err = s.SessionManager.SetBrowserSession(sessionID, ses.BrowserSessionID)
+	return err
+}
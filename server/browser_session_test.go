@@ -0,0 +1,290 @@
+package server
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc/jose"
+	"github.com/coreos/go-oidc/oidc"
+
+	"github.com/coreos/dex/connector"
+	"github.com/coreos/dex/db"
+)
+
+// fakeSessionKeyConnector records the session key of the last login URL it
+// was asked for.
+type fakeSessionKeyConnector struct {
+	fakeConnector
+	id         string
+	sessionKey string
+}
+
+func (f *fakeSessionKeyConnector) ID() string {
+	return f.id
+}
+
+func (f *fakeSessionKeyConnector) LoginURL(sessionKey, prompt string) (string, error) {
+	f.sessionKey = sessionKey
+	return f.loginURL, nil
+}
+
+// finishBrowserLogin sends a user-agent with the given pending browser
+// session cookie to the URL Login returned, and returns the response.
+func finishBrowserLogin(t *testing.T, srv *Server, ru string, pending *http.Cookie) *httptest.ResponseRecorder {
+	if want := srv.absURL(httpPathBrowserSession); !strings.HasPrefix(ru, want.String()+"?") {
+		t.Fatalf("want redirect to %q, got %q", want.String(), ru)
+	}
+	req, err := http.NewRequest("GET", ru, nil)
+	if err != nil {
+		t.Fatalf("unable to form HTTP request: %v", err)
+	}
+	if pending != nil {
+		req.AddCookie(pending)
+	}
+	w := httptest.NewRecorder()
+	srv.handleBrowserSession(w, req)
+	if w.Code != http.StatusFound {
+		t.Fatalf("want HTTP %d, got %d", http.StatusFound, w.Code)
+	}
+	return w
+}
+
+func TestHandleAuthFuncBrowserSession(t *testing.T) {
+	f, err := makeTestFixtures()
+	if err != nil {
+		t.Fatalf("error making test fixtures: %v", err)
+	}
+	f.srv.BrowserSessionRepo = db.NewBrowserSessionRepo(db.NewMemDB())
+
+	idpc := &fakeSessionKeyConnector{fakeConnector: fakeConnector{loginURL: "http://fake.example.com"}, id: "IDPC-1"}
+	other := &fakeSessionKeyConnector{fakeConnector: fakeConnector{loginURL: "http://other.example.com"}, id: "other"}
+	hdlr := handleAuthFunc(f.srv, []connector.Connector{idpc, other}, nil, true)
+
+	authRequest := func(params url.Values, cookie *http.Cookie) *httptest.ResponseRecorder {
+		q := url.Values{
+			"response_type": {"code"},
+			"client_id":     {testClientID},
+			"scope":         {"openid"},
+		}
+		for k, v := range params {
+			q[k] = v
+		}
+		req, err := http.NewRequest("GET", "http://server.example.com/auth?"+q.Encode(), nil)
+		if err != nil {
+			t.Fatalf("unable to form HTTP request: %v", err)
+		}
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		hdlr.ServeHTTP(w, req)
+		return w
+	}
+
+	// Log in interactively, which starts the browser session. The
+	// user-agent only gets its cookie once the login completes.
+	w := authRequest(url.Values{"connector_id": {"IDPC-1"}}, nil)
+	if w.Code != http.StatusFound {
+		t.Fatalf("want HTTP %d, got %d", http.StatusFound, w.Code)
+	}
+	if responseCookie(w, cookieBrowserSession) != nil {
+		t.Errorf("want no browser session cookie before the login completes")
+	}
+	pending := responseCookie(w, cookiePendingBrowserSession)
+	if pending == nil {
+		t.Fatalf("want pending browser session cookie to be set")
+	}
+	if pending.Path != httpPathBrowserSession {
+		t.Errorf("want pending browser session cookie path %q, got %q", httpPathBrowserSession, pending.Path)
+	}
+	ru, err := f.srv.Login(oidc.Identity{ID: "RID-1"}, nil, idpc.sessionKey)
+	if err != nil {
+		t.Fatalf("unexpected error logging in: %v", err)
+	}
+	w = finishBrowserLogin(t, f.srv, ru, pending)
+	callback := testRedirectURL.String()
+	if got := w.Header().Get("Location"); !strings.HasPrefix(got, callback+"?code=") {
+		t.Errorf("want Location starting with %q, got %q", callback+"?code=", got)
+	}
+	cookie := responseCookie(w, cookieBrowserSession)
+	if cookie == nil {
+		t.Fatalf("want browser session cookie to be set")
+	}
+	if !cookie.HttpOnly {
+		t.Errorf("want browser session cookie to be HttpOnly")
+	}
+	if c := responseCookie(w, cookiePendingBrowserSession); c == nil || c.MaxAge >= 0 {
+		t.Errorf("want pending browser session cookie to be removed")
+	}
+
+	tests := []struct {
+		params       url.Values
+		cookie       *http.Cookie
+		wantLocation string
+	}{
+		// the browser session logs the user in
+		{
+			params:       url.Values{},
+			cookie:       cookie,
+			wantLocation: callback + "?code=",
+		},
+		{
+			params:       url.Values{"connector_id": {"IDPC-1"}, "max_age": {"3600"}},
+			cookie:       cookie,
+			wantLocation: callback + "?code=",
+		},
+		{
+			params:       url.Values{"prompt": {"none"}},
+			cookie:       cookie,
+			wantLocation: callback + "?code=",
+		},
+
+		// the client asks for a fresh authentication
+		{
+			params:       url.Values{"connector_id": {"IDPC-1"}, "prompt": {"login"}},
+			cookie:       cookie,
+			wantLocation: "http://fake.example.com",
+		},
+		{
+			params:       url.Values{"connector_id": {"IDPC-1"}, "max_age": {"0"}},
+			cookie:       cookie,
+			wantLocation: "http://fake.example.com",
+		},
+
+		// the client wants another connector
+		{
+			params:       url.Values{"connector_id": {"other"}},
+			cookie:       cookie,
+			wantLocation: "http://other.example.com",
+		},
+		{
+			params:       url.Values{"connector_id": {"other"}, "prompt": {"none"}},
+			cookie:       cookie,
+			wantLocation: callback + "?error=login_required",
+		},
+
+		// no usable browser session
+		{
+			params:       url.Values{"prompt": {"none"}},
+			wantLocation: callback + "?error=login_required",
+		},
+		{
+			params:       url.Values{"prompt": {"none"}},
+			cookie:       &http.Cookie{Name: cookieBrowserSession, Value: "garbage"},
+			wantLocation: callback + "?error=login_required",
+		},
+
+		// invalid requests
+		{
+			params:       url.Values{"prompt": {"none login"}},
+			cookie:       cookie,
+			wantLocation: callback + "?error=invalid_request",
+		},
+		{
+			params:       url.Values{"max_age": {"-1"}},
+			cookie:       cookie,
+			wantLocation: callback + "?error=invalid_request",
+		},
+	}
+
+	for i, tt := range tests {
+		w := authRequest(tt.params, tt.cookie)
+		if w.Code != http.StatusFound {
+			t.Errorf("case %d: want HTTP %d, got %d", i, http.StatusFound, w.Code)
+			continue
+		}
+		if got := w.Header().Get("Location"); !strings.HasPrefix(got, tt.wantLocation) {
+			t.Errorf("case %d: want Location starting with %q, got %q", i, tt.wantLocation, got)
+		}
+		// Starting another login leaves the browser session alone.
+		if responseCookie(w, cookieBrowserSession) != nil {
+			t.Errorf("case %d: want browser session cookie left alone", i)
+		}
+	}
+
+	// A login completed in another user-agent than it started in doesn't
+	// give that user-agent the browser session.
+	w = authRequest(url.Values{"connector_id": {"IDPC-1"}, "prompt": {"login"}}, cookie)
+	if ru, err = f.srv.Login(oidc.Identity{ID: "RID-1"}, nil, idpc.sessionKey); err != nil {
+		t.Fatalf("unexpected error logging in: %v", err)
+	}
+	w = finishBrowserLogin(t, f.srv, ru, nil)
+	if got := w.Header().Get("Location"); !strings.HasPrefix(got, callback+"?code=") {
+		t.Errorf("want Location starting with %q, got %q", callback+"?code=", got)
+	}
+	if responseCookie(w, cookieBrowserSession) != nil {
+		t.Errorf("want no browser session cookie for another user-agent")
+	}
+
+	// The ID token issued for a single sign-on carries the time the user
+	// originally authenticated.
+	w = authRequest(url.Values{}, cookie)
+	u, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("unexpected error parsing Location: %v", err)
+	}
+	creds := oidc.ClientCredentials{
+		ID:     testClientID,
+		Secret: base64.URLEncoding.EncodeToString([]byte("secret")),
+	}
+	tokens, err := f.srv.CodeToken(creds, u.Query().Get("code"), "")
+	if err != nil {
+		t.Fatalf("unexpected error exchanging code: %v", err)
+	}
+	claims, err := tokens.IDToken.Claims()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sub, _, _ := claims.StringClaim("sub"); sub != "ID-1" {
+		t.Errorf("want sub %q, got %q", "ID-1", sub)
+	}
+	if _, ok, _ := claims.TimeClaim("auth_time"); !ok {
+		t.Errorf("want auth_time claim")
+	}
+}
+
+func TestParseBrowserSessionToken(t *testing.T) {
+	f, cookie := makeAccountTestFixtures(t)
+	id, err := f.srv.parseBrowserSessionToken(cookie.Value)
+	if err != nil {
+		t.Fatalf("unexpected error parsing browser session token: %v", err)
+	}
+
+	signer, err := f.srv.KeyManager.Signer()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	claims := func(extra jose.Claims) jose.Claims {
+		c := jose.Claims{
+			"iss": f.srv.IssuerURL.String(),
+			"sub": id,
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+		for k, v := range extra {
+			c[k] = v
+		}
+		return c
+	}
+
+	tests := []jose.Claims{
+		// Other tokens signed with the same keys, such as ID tokens.
+		claims(jose.Claims{"aud": testClientID}),
+		claims(jose.Claims{"aud": f.srv.IssuerURL.String()}),
+		claims(jose.Claims{"typ": browserSessionTokenType}),
+		claims(jose.Claims{"aud": testClientID, "typ": browserSessionTokenType}),
+	}
+	for i, tt := range tests {
+		jwt, err := jose.NewSignedJWT(tt, signer)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		if _, err := f.srv.parseBrowserSessionToken(jwt.Encode()); err != errInvalidBrowserSessionToken {
+			t.Errorf("case %d: want err=%v, got=%v", i, errInvalidBrowserSessionToken, err)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/coreos/go-oidc/jose"
+
+	"github.com/coreos/dex/session"
+	"github.com/coreos/dex/user"
+)
+
+// supportedScopes are the scopes advertised in the discovery document; any
+// other scopes in authentication requests are ignored. The address and phone
+// scopes are accepted, but dex has no such claims to release.
+var supportedScopes = []string{
+	"openid",
+	"offline_access",
+	"profile",
+	"email",
+	"address",
+	"phone",
+	"groups",
+}
+
+func containsScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// supportedClaims are the claims dex can put in ID tokens and UserInfo
+// responses.
+var supportedClaims = []string{
+	"acr",
+	"amr",
+	"aud",
+	"auth_time",
+	"email",
+	"email_verified",
+	"exp",
+	"groups",
+	"iat",
+	"iss",
+	"name",
+	"sub",
+}
+
+// addGroupsClaim adds the names of the groups the user is a member of to the
+// given Claims, if they were requested by scope or by name. Users who aren't
+// a member of any group get an empty list.
+func addGroupsClaim(groupRepo user.GroupRepo, claims jose.Claims, userID string, scope, names []string) error {
+	if !user.ClaimRequested(scope, names, "groups") {
+		return nil
+	}
+	groups, err := groupRepo.GetGroupsForUser(nil, userID)
+	if err != nil {
+		return err
+	}
+	claims.Add("groups", user.GroupNames(groups))
+	return nil
+}
+
+// claimRequest is an individual claim request of the 'claims' parameter.
+// Essential claims and requested values make no difference to what dex
+// releases, but malformed requests are still rejected.
+type claimRequest struct {
+	Essential bool          `json:"essential"`
+	Value     interface{}   `json:"value"`
+	Values    []interface{} `json:"values"`
+}
+
+// parseClaimsRequest parses the 'claims' authentication request parameter,
+// keeping the names of the claims requested for the ID token and from the
+// UserInfo endpoint.
+// http://openid.net/specs/openid-connect-core-1_0.html#ClaimsParameter
+func parseClaimsRequest(s string) (session.ClaimsRequest, error) {
+	var cr session.ClaimsRequest
+	if s == "" {
+		return cr, nil
+	}
+
+	var req struct {
+		IDToken  map[string]*claimRequest `json:"id_token"`
+		UserInfo map[string]*claimRequest `json:"userinfo"`
+	}
+	if err := json.Unmarshal([]byte(s), &req); err != nil {
+		return cr, err
+	}
+
+	cr.IDToken = claimNames(req.IDToken)
+	cr.UserInfo = claimNames(req.UserInfo)
+	return cr, nil
+}
+
+func claimNames(m map[string]*claimRequest) []string {
+	if len(m) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// encodeClaimsRequest is the inverse of parseClaimsRequest, requesting each
+// of the claims by name only.
+func encodeClaimsRequest(cr session.ClaimsRequest) string {
+	req := make(map[string]map[string]*claimRequest)
+	for member, names := range map[string][]string{"id_token": cr.IDToken, "userinfo": cr.UserInfo} {
+		if len(names) == 0 {
+			continue
+		}
+		req[member] = make(map[string]*claimRequest)
+		for _, name := range names {
+			req[member][name] = nil
+		}
+	}
+	b, _ := json.Marshal(req)
+	return string(b)
+}
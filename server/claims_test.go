@@ -0,0 +1,75 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/kylelemons/godebug/pretty"
+
+	"github.com/coreos/dex/session"
+)
+
+func TestParseClaimsRequest(t *testing.T) {
+	tests := []struct {
+		claims  string
+		want    session.ClaimsRequest
+		wantErr bool
+	}{
+		{
+			claims: "",
+			want:   session.ClaimsRequest{},
+		},
+		{
+			claims: `{"userinfo":{"email":null,"name":{"essential":true}},"id_token":{"email_verified":{"value":true},"sub":{"values":["a","b"]}}}`,
+			want: session.ClaimsRequest{
+				IDToken:  []string{"email_verified", "sub"},
+				UserInfo: []string{"email", "name"},
+			},
+		},
+		// unknown members are ignored
+		{
+			claims: `{"userinfo":{"email":null},"foo":{"bar":null}}`,
+			want: session.ClaimsRequest{
+				UserInfo: []string{"email"},
+			},
+		},
+		{
+			claims:  `not json`,
+			wantErr: true,
+		},
+		{
+			claims:  `{"userinfo":["email"]}`,
+			wantErr: true,
+		},
+		{
+			claims:  `{"userinfo":{"email":"yes please"}}`,
+			wantErr: true,
+		},
+	}
+
+	for i, tt := range tests {
+		got, err := parseClaimsRequest(tt.claims)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("case %d: want non-nil error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if diff := pretty.Compare(tt.want, got); diff != "" {
+			t.Errorf("case %d: Compare(want, got) = %v", i, diff)
+		}
+
+		// Encoding the request again yields an equivalent one.
+		again, err := parseClaimsRequest(encodeClaimsRequest(got))
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if diff := pretty.Compare(got, again); diff != "" {
+			t.Errorf("case %d: Compare(got, again) = %v", i, diff)
+		}
+	}
+}
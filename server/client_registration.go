@@ -2,9 +2,16 @@ package server
 
 import (
 	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"net/url"
+	"strings"
 
+	"github.com/coreos/dex/audit"
 	"github.com/coreos/dex/client"
+	phttp "github.com/coreos/dex/pkg/http"
 	"github.com/coreos/dex/pkg/log"
 
 	"github.com/coreos/go-oidc/oauth2"
@@ -16,41 +23,444 @@ const (
 	invalidClientMetadata = "invalid_client_metadata"
 )
 
+// ClientRegistrationPolicy restricts the dynamic registration of clients,
+// on top of what the provider supports.
+type ClientRegistrationPolicy struct {
+	// RequireInitialAccessToken closes the registration endpoint to anyone
+	// without an initial access token issued by an admin.
+	RequireInitialAccessToken bool
+
+	// RedirectURISchemes lists the schemes redirect URIs may use. If empty,
+	// any scheme is allowed. Logout URIs are held to the same policy, as dex
+	// sends users and back-channel logout requests to them.
+	RedirectURISchemes []string
+
+	// RedirectURIHosts lists the hosts redirect URIs may point to. A host
+	// starting with "*." matches any of its subdomains. If empty, any host
+	// is allowed.
+	RedirectURIHosts []string
+}
+
+// Check returns an error if the redirect URIs of the given metadata aren't
+// allowed by the policy.
+func (p ClientRegistrationPolicy) Check(md oidc.ClientMetadata) error {
+	for _, u := range md.RedirectURIs {
+		if err := p.checkURI("redirect URI", u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckLogoutURIs returns an error if the post logout redirect URIs or the
+// front- or back-channel logout URI of the given client aren't allowed by
+// the policy.
+func (p ClientRegistrationPolicy) CheckLogoutURIs(cli client.Client) error {
+	for _, u := range cli.PostLogoutRedirectURIs {
+		if err := p.checkURI("post logout redirect URI", u); err != nil {
+			return err
+		}
+	}
+	if cli.FrontChannelLogoutURI != nil {
+		if err := p.checkURI("front-channel logout URI", *cli.FrontChannelLogoutURI); err != nil {
+			return err
+		}
+	}
+	if cli.BackChannelLogoutURI != nil {
+		if err := p.checkURI("back-channel logout URI", *cli.BackChannelLogoutURI); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p ClientRegistrationPolicy) checkURI(kind string, u url.URL) error {
+	if len(p.RedirectURISchemes) > 0 && !containsString(p.RedirectURISchemes, u.Scheme) {
+		return fmt.Errorf("%s scheme %q is not allowed", kind, u.Scheme)
+	}
+	if len(p.RedirectURIHosts) > 0 && !p.allowsHost(u.Host) {
+		return fmt.Errorf("%s host %q is not allowed", kind, u.Host)
+	}
+	return nil
+}
+
+func (p ClientRegistrationPolicy) allowsHost(hostport string) bool {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+
+	for _, allowed := range p.RedirectURIHosts {
+		allowed = strings.ToLower(allowed)
+		if strings.HasPrefix(allowed, "*.") {
+			if strings.HasSuffix(host, allowed[1:]) {
+				return true
+			}
+			continue
+		}
+		if host == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *Server) handleClientRegistration(w http.ResponseWriter, r *http.Request) {
-	resp, err := s.handleClientRegistrationRequest(r)
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		phttp.WriteError(w, http.StatusMethodNotAllowed, "POST only acceptable method")
+		return
+	}
+
+	var initialAccessToken string
+	if s.ClientRegistrationPolicy.RequireInitialAccessToken {
+		token, err := oidc.ExtractBearerToken(r)
+		if err != nil {
+			writeBearerTokenError(w, http.StatusUnauthorized, "")
+			return
+		}
+		initialAccessToken = token
+	}
+
+	resp, err := s.handleClientRegistrationRequest(r, initialAccessToken)
 	if err != nil {
-		code := http.StatusBadRequest
-		if err.Type == oauth2.ErrorServerError {
-			code = http.StatusInternalServerError
+		switch err.Type {
+		case errorInvalidToken:
+			writeBearerTokenError(w, http.StatusUnauthorized, errorInvalidToken)
+		case oauth2.ErrorServerError:
+			writeResponseWithBody(w, http.StatusInternalServerError, err)
+		default:
+			writeResponseWithBody(w, http.StatusBadRequest, err)
 		}
-		writeResponseWithBody(w, code, err)
 	} else {
+		w.Header().Set("Cache-Control", "no-store")
 		writeResponseWithBody(w, http.StatusCreated, resp)
 	}
 }
 
-func (s *Server) handleClientRegistrationRequest(r *http.Request) (*oidc.ClientRegistrationResponse, *apiError) {
+func (s *Server) handleClientRegistrationRequest(r *http.Request, initialAccessToken string) (*clientRegistrationResponse, *apiError) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, newAPIError(oauth2.ErrorInvalidRequest, "unable to read request body")
+	}
 	var clientMetadata oidc.ClientMetadata
-	if err := json.NewDecoder(r.Body).Decode(&clientMetadata); err != nil {
+	if err := json.Unmarshal(body, &clientMetadata); err != nil {
 		return nil, newAPIError(oauth2.ErrorInvalidRequest, err.Error())
 	}
-	if err := s.ProviderConfig().Supports(clientMetadata); err != nil {
-		return nil, newAPIError(invalidClientMetadata, err.Error())
+	if err := s.validateRegisteredClientMetadata(clientMetadata); err != nil {
+		return nil, err
+	}
+	var logoutMetadata clientLogoutMetadata
+	if err := json.Unmarshal(body, &logoutMetadata); err != nil {
+		return nil, newAPIError(oauth2.ErrorInvalidRequest, err.Error())
 	}
 
 	// metadata is guarenteed to have at least one redirect_uri by earlier validation.
 	cli := client.Client{
 		Metadata: clientMetadata,
+		Public:   clientMetadata.TokenEndpointAuthMethod == authMethodNone,
+	}
+	if err := s.applyClientLogoutMetadata(logoutMetadata, &cli); err != nil {
+		return nil, err
 	}
-	creds, err := s.ClientManager.New(cli)
+
+	// The initial access token is only used up once the client is known to
+	// be acceptable.
+	if s.ClientRegistrationPolicy.RequireInitialAccessToken {
+		if err := s.InitialAccessTokenRepo.Use(initialAccessToken); err != nil {
+			if err != client.ErrorInvalidInitialAccessToken {
+				log.Errorf("Failed to use initial access token: %v", err)
+				return nil, newAPIError(oauth2.ErrorServerError, "")
+			}
+			return nil, newAPIError(errorInvalidToken, "")
+		}
+	}
+
+	creds, token, err := s.ClientManager.Register(cli)
 	if err != nil {
 		log.Errorf("Failed to create new client identity: %v", err)
 		return nil, newAPIError(oauth2.ErrorServerError, "unable to save client metadata")
 	}
+	s.Audit.Record(audit.Event{
+		Type:     audit.EventClientRegistered,
+		ClientID: creds.ID,
+		IP:       phttp.RemoteIP(r),
+	})
 
-	return &oidc.ClientRegistrationResponse{
-		ClientID:       creds.ID,
-		ClientSecret:   creds.Secret,
-		ClientMetadata: clientMetadata,
+	return &clientRegistrationResponse{
+		ClientRegistrationResponse: oidc.ClientRegistrationResponse{
+			ClientID:                creds.ID,
+			ClientSecret:            creds.Secret,
+			RegistrationAccessToken: token,
+			RegistrationClientURI:   s.registrationClientURI(creds.ID),
+			ClientMetadata:          clientMetadata,
+		},
+		logout: newClientLogoutMetadata(cli),
 	}, nil
 }
+
+func (s *Server) validateRegisteredClientMetadata(md oidc.ClientMetadata) *apiError {
+	if err := s.ProviderConfig().Supports(md); err != nil {
+		return newAPIError(invalidClientMetadata, err.Error())
+	}
+	if err := s.ClientRegistrationPolicy.Check(md); err != nil {
+		return newAPIError(invalidRedirectURI, err.Error())
+	}
+	return nil
+}
+
+// applyClientLogoutMetadata validates the logout metadata of a registered
+// client against the registration policy and sets it on the client.
+func (s *Server) applyClientLogoutMetadata(m clientLogoutMetadata, cli *client.Client) *apiError {
+	if err := m.apply(cli); err != nil {
+		return err
+	}
+	if err := s.ClientRegistrationPolicy.CheckLogoutURIs(*cli); err != nil {
+		return newAPIError(invalidClientMetadata, err.Error())
+	}
+	return nil
+}
+
+func (s *Server) registrationClientURI(clientID string) string {
+	u := s.absURL(httpPathClientRegistration, clientID)
+	return u.String()
+}
+
+// handleClientConfiguration serves the client configuration endpoint of RFC
+// 7592, which dynamically registered clients read, update and delete their
+// registration through. Clients authenticate with the registration access
+// token they were issued at registration.
+func (s *Server) handleClientConfiguration(w http.ResponseWriter, r *http.Request) {
+	clientID := strings.TrimPrefix(r.URL.Path, httpPathClientRegistration+"/")
+	if clientID == "" || strings.Contains(clientID, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	token, err := oidc.ExtractBearerToken(r)
+	if err != nil {
+		writeBearerTokenError(w, http.StatusUnauthorized, "")
+		return
+	}
+
+	// Unknown clients are rejected like bad tokens, so as not to reveal
+	// which clients exist, see RFC 7592 Section 2.
+	ok, err := s.ClientManager.AuthenticateRegistrationToken(clientID, token)
+	if err != nil {
+		log.Errorf("Failed to authenticate registration access token of client %q: %v", clientID, err)
+		writeAPIError(w, http.StatusInternalServerError, newAPIError(errorServerError, ""))
+		return
+	}
+	if !ok {
+		writeBearerTokenError(w, http.StatusUnauthorized, errorInvalidToken)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		s.readClientConfiguration(w, clientID, token)
+	case "PUT":
+		s.updateClientConfiguration(w, r, clientID, token)
+	case "DELETE":
+		s.deleteClientConfiguration(w, r, clientID)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		phttp.WriteError(w, http.StatusMethodNotAllowed, "GET, PUT or DELETE only acceptable methods")
+	}
+}
+
+func (s *Server) readClientConfiguration(w http.ResponseWriter, clientID, token string) {
+	cli, err := s.ClientManager.Get(clientID)
+	if err != nil {
+		log.Errorf("Failed to get client %q: %v", clientID, err)
+		writeAPIError(w, http.StatusInternalServerError, newAPIError(errorServerError, ""))
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeResponseWithBody(w, http.StatusOK, s.clientConfiguration(cli, token))
+}
+
+func (s *Server) updateClientConfiguration(w http.ResponseWriter, r *http.Request, clientID, token string) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, newAPIError(errorInvalidRequest, "unable to read request body"))
+		return
+	}
+
+	// The request carries the client's credentials along with its metadata,
+	// see RFC 7592 Section 2.2.
+	var creds struct {
+		ClientID     string `json:"client_id"`
+		ClientSecret string `json:"client_secret"`
+	}
+	if err := json.Unmarshal(body, &creds); err != nil {
+		writeAPIError(w, http.StatusBadRequest, newAPIError(errorInvalidRequest, err.Error()))
+		return
+	}
+	if creds.ClientID != clientID {
+		writeAPIError(w, http.StatusBadRequest, newAPIError(errorInvalidRequest, "client_id does not match the client being updated"))
+		return
+	}
+	if creds.ClientSecret != "" {
+		ok, err := s.ClientManager.Authenticate(oidc.ClientCredentials{ID: clientID, Secret: creds.ClientSecret})
+		if err != nil || !ok {
+			writeAPIError(w, http.StatusBadRequest, newAPIError(errorInvalidRequest, "client_secret does not match the client being updated"))
+			return
+		}
+	}
+
+	var md oidc.ClientMetadata
+	if err := json.Unmarshal(body, &md); err != nil {
+		writeAPIError(w, http.StatusBadRequest, newAPIError(invalidClientMetadata, err.Error()))
+		return
+	}
+	if err := s.validateRegisteredClientMetadata(md); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	var logoutMetadata clientLogoutMetadata
+	if err := json.Unmarshal(body, &logoutMetadata); err != nil {
+		writeAPIError(w, http.StatusBadRequest, newAPIError(invalidClientMetadata, err.Error()))
+		return
+	}
+
+	cli, err := s.ClientManager.Get(clientID)
+	if err != nil {
+		log.Errorf("Failed to get client %q: %v", clientID, err)
+		writeAPIError(w, http.StatusInternalServerError, newAPIError(errorServerError, ""))
+		return
+	}
+	cli.Metadata = md
+	cli.Public = md.TokenEndpointAuthMethod == authMethodNone
+	if err := s.applyClientLogoutMetadata(logoutMetadata, &cli); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := s.ClientManager.Update(cli); err != nil {
+		log.Errorf("Failed to update client %q: %v", clientID, err)
+		writeAPIError(w, http.StatusInternalServerError, newAPIError(errorServerError, ""))
+		return
+	}
+	log.Infof("Client %q updated its registration", clientID)
+	s.Audit.Record(audit.Event{
+		Type:     audit.EventClientRegistrationUpdated,
+		ClientID: clientID,
+		IP:       phttp.RemoteIP(r),
+	})
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeResponseWithBody(w, http.StatusOK, s.clientConfiguration(cli, token))
+}
+
+func (s *Server) deleteClientConfiguration(w http.ResponseWriter, r *http.Request, clientID string) {
+	if err := s.ClientManager.Delete(clientID); err != nil {
+		log.Errorf("Failed to delete client %q: %v", clientID, err)
+		writeAPIError(w, http.StatusInternalServerError, newAPIError(errorServerError, ""))
+		return
+	}
+	log.Infof("Client %q deleted its registration", clientID)
+	s.Audit.Record(audit.Event{
+		Type:     audit.EventClientRegistrationDeleted,
+		ClientID: clientID,
+		IP:       phttp.RemoteIP(r),
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// clientConfiguration describes a client's registration. Its secret is only
+// stored hashed, so it's never included.
+func (s *Server) clientConfiguration(cli client.Client, token string) *clientRegistrationResponse {
+	return &clientRegistrationResponse{
+		ClientRegistrationResponse: oidc.ClientRegistrationResponse{
+			ClientID:                cli.Credentials.ID,
+			RegistrationAccessToken: token,
+			RegistrationClientURI:   s.registrationClientURI(cli.Credentials.ID),
+			ClientMetadata:          cli.Metadata,
+		},
+		logout: newClientLogoutMetadata(cli),
+	}
+}
+
+// clientLogoutMetadata is the client metadata of OpenID Connect
+// RP-Initiated, Front-Channel and Back-Channel Logout, which go-oidc doesn't
+// know about.
+type clientLogoutMetadata struct {
+	PostLogoutRedirectURIs []string `json:"post_logout_redirect_uris,omitempty"`
+	FrontChannelLogoutURI  string   `json:"frontchannel_logout_uri,omitempty"`
+	BackChannelLogoutURI   string   `json:"backchannel_logout_uri,omitempty"`
+}
+
+func newClientLogoutMetadata(cli client.Client) clientLogoutMetadata {
+	var m clientLogoutMetadata
+	for _, u := range cli.PostLogoutRedirectURIs {
+		m.PostLogoutRedirectURIs = append(m.PostLogoutRedirectURIs, u.String())
+	}
+	m.FrontChannelLogoutURI = uriToString(cli.FrontChannelLogoutURI)
+	m.BackChannelLogoutURI = uriToString(cli.BackChannelLogoutURI)
+	return m
+}
+
+// apply validates the logout metadata and sets it on the client.
+func (m clientLogoutMetadata) apply(cli *client.Client) *apiError {
+	parse := func(s string) (*url.URL, *apiError) {
+		u, err := url.Parse(s)
+		if err != nil || !client.ValidLogoutURI(*u) {
+			return nil, newAPIError(invalidClientMetadata, fmt.Sprintf("invalid logout URI %q", s))
+		}
+		return u, nil
+	}
+
+	cli.PostLogoutRedirectURIs = nil
+	for _, s := range m.PostLogoutRedirectURIs {
+		u, err := parse(s)
+		if err != nil {
+			return err
+		}
+		cli.PostLogoutRedirectURIs = append(cli.PostLogoutRedirectURIs, *u)
+	}
+
+	cli.FrontChannelLogoutURI = nil
+	if m.FrontChannelLogoutURI != "" {
+		u, err := parse(m.FrontChannelLogoutURI)
+		if err != nil {
+			return err
+		}
+		cli.FrontChannelLogoutURI = u
+	}
+
+	cli.BackChannelLogoutURI = nil
+	if m.BackChannelLogoutURI != "" {
+		u, err := parse(m.BackChannelLogoutURI)
+		if err != nil {
+			return err
+		}
+		cli.BackChannelLogoutURI = u
+	}
+	return nil
+}
+
+// clientRegistrationResponse is the response of the registration and client
+// configuration endpoints. It extends the response go-oidc understands with
+// the client's logout metadata.
+type clientRegistrationResponse struct {
+	oidc.ClientRegistrationResponse
+	logout clientLogoutMetadata
+}
+
+func (c *clientRegistrationResponse) MarshalJSON() ([]byte, error) {
+	b, err := json.Marshal(&c.ClientRegistrationResponse)
+	if err != nil {
+		return nil, err
+	}
+	return spliceJSON(b, c.logout)
+}
@@ -7,9 +7,13 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/coreos/dex/access"
+	"github.com/coreos/dex/client"
 	"github.com/coreos/go-oidc/oauth2"
 	"github.com/coreos/go-oidc/oidc"
 	"github.com/kylelemons/godebug/pretty"
@@ -159,3 +163,247 @@ func TestClientRegistration(t *testing.T) {
 		}
 	}
 }
+
+func TestClientRegistrationPolicyCheck(t *testing.T) {
+	policy := ClientRegistrationPolicy{
+		RedirectURISchemes: []string{"https", "com.example.app"},
+		RedirectURIHosts:   []string{"example.com", "*.apps.example.com"},
+	}
+	tests := []struct {
+		policy ClientRegistrationPolicy
+		uris   []string
+		ok     bool
+	}{
+		{ClientRegistrationPolicy{}, []string{"http://anything.example.org/cb"}, true},
+		{policy, []string{"https://example.com/cb"}, true},
+		{policy, []string{"https://example.com:8443/cb"}, true},
+		{policy, []string{"https://EXAMPLE.com/cb"}, true},
+		{policy, []string{"https://foo.apps.example.com/cb"}, true},
+		{policy, []string{"com.example.app://example.com/cb"}, true},
+		{policy, []string{"http://example.com/cb"}, false},
+		{policy, []string{"https://apps.example.com/cb"}, false},
+		{policy, []string{"https://evilexample.com/cb"}, false},
+		{policy, []string{"https://example.com/cb", "https://example.org/cb"}, false},
+	}
+
+	for i, tt := range tests {
+		var md oidc.ClientMetadata
+		for _, uri := range tt.uris {
+			u, err := url.Parse(uri)
+			if err != nil {
+				t.Fatal(err)
+			}
+			md.RedirectURIs = append(md.RedirectURIs, *u)
+		}
+		err := tt.policy.Check(md)
+		if tt.ok && err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+		}
+		if !tt.ok && err == nil {
+			t.Errorf("case %d: want non-nil error", i)
+		}
+	}
+}
+
+func TestClientRegistrationPolicy(t *testing.T) {
+	fixtures, err := makeTestFixtures()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixtures.srv.EnableClientRegistration = true
+	fixtures.srv.ClientRegistrationPolicy = ClientRegistrationPolicy{
+		RequireInitialAccessToken: true,
+		RedirectURIHosts:          []string{"client.example.org"},
+	}
+	handler := fixtures.srv.HTTPHandler()
+
+	now := time.Now()
+	token, _, err := fixtures.srv.InitialAccessTokenRepo.Create(client.InitialAccessToken{
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Hour),
+		MaxUses:   1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	allowed := `{"redirect_uris":["https://client.example.org/callback"]}`
+	forbidden := `{"redirect_uris":["https://other.example.org/callback"]}`
+	forbiddenLogout := []string{
+		`{"redirect_uris":["https://client.example.org/callback"],"post_logout_redirect_uris":["https://other.example.org/bye"]}`,
+		`{"redirect_uris":["https://client.example.org/callback"],"frontchannel_logout_uri":"https://other.example.org/logout"}`,
+		`{"redirect_uris":["https://client.example.org/callback"],"backchannel_logout_uri":"http://10.0.0.1/logout"}`,
+	}
+	tests := []struct {
+		token     string
+		body      string
+		wantCode  int
+		wantError string
+	}{
+		{"", allowed, http.StatusUnauthorized, ""},
+		{"bad-token", allowed, http.StatusUnauthorized, errorInvalidToken},
+		// Rejected clients don't use up the token.
+		{token, forbidden, http.StatusBadRequest, invalidRedirectURI},
+		{token, forbiddenLogout[0], http.StatusBadRequest, invalidClientMetadata},
+		{token, forbiddenLogout[1], http.StatusBadRequest, invalidClientMetadata},
+		{token, forbiddenLogout[2], http.StatusBadRequest, invalidClientMetadata},
+		{token, allowed, http.StatusCreated, ""},
+		{token, allowed, http.StatusUnauthorized, errorInvalidToken},
+	}
+
+	for i, tt := range tests {
+		req, err := http.NewRequest("POST", "/registration", strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != tt.wantCode {
+			t.Errorf("case %d: want code=%d, got=%d: %s", i, tt.wantCode, w.Code, w.Body)
+			continue
+		}
+		if tt.wantError != "" {
+			var aerr apiError
+			if err := json.Unmarshal(w.Body.Bytes(), &aerr); err != nil {
+				t.Errorf("case %d: failed to decode error: %v", i, err)
+				continue
+			}
+			if aerr.Type != tt.wantError {
+				t.Errorf("case %d: want error=%q, got=%q", i, tt.wantError, aerr.Type)
+			}
+		}
+	}
+}
+
+func TestClientConfiguration(t *testing.T) {
+	fixtures, err := makeTestFixtures()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixtures.srv.EnableClientRegistration = true
+	fixtures.srv.ClientRegistrationPolicy = ClientRegistrationPolicy{
+		RedirectURIHosts: []string{"client.example.org"},
+	}
+	handler := fixtures.srv.HTTPHandler()
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("POST", "/registration", "", `{"redirect_uris":["https://client.example.org/callback"]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("want code=%d, got=%d: %s", http.StatusCreated, w.Code, w.Body)
+	}
+	var reg oidc.ClientRegistrationResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &reg); err != nil {
+		t.Fatal(err)
+	}
+	if reg.RegistrationAccessToken == "" {
+		t.Fatalf("no registration_access_token in registration response")
+	}
+	uri, err := url.Parse(reg.RegistrationClientURI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := testIssuerURL.String() + "/registration/" + reg.ClientID; reg.RegistrationClientURI != want {
+		t.Fatalf("want registration_client_uri=%q, got=%q", want, reg.RegistrationClientURI)
+	}
+	token := reg.RegistrationAccessToken
+
+	// Reading the registration.
+	for i, tt := range []struct {
+		token    string
+		path     string
+		wantCode int
+	}{
+		{token, uri.Path, http.StatusOK},
+		{"", uri.Path, http.StatusUnauthorized},
+		{"bad-token", uri.Path, http.StatusUnauthorized},
+		{token, "/registration/unknown.example.org", http.StatusUnauthorized},
+	} {
+		if w := do("GET", tt.path, tt.token, ""); w.Code != tt.wantCode {
+			t.Errorf("case %d: want code=%d, got=%d", i, tt.wantCode, w.Code)
+		}
+	}
+	w = do("GET", uri.Path, token, "")
+	var got oidc.ClientRegistrationResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ClientSecret != "" {
+		t.Errorf("client secret must not be returned")
+	}
+	if diff := pretty.Compare(reg.ClientMetadata, got.ClientMetadata); diff != "" {
+		t.Errorf("Compare(registered, read) = %v", diff)
+	}
+
+	// Updating the registration.
+	for i, tt := range []struct {
+		body     string
+		wantCode int
+	}{
+		{`{"client_id":"other.example.org","redirect_uris":["https://client.example.org/cb2"]}`, http.StatusBadRequest},
+		{`{"client_id":"` + reg.ClientID + `","client_secret":"bad","redirect_uris":["https://client.example.org/cb2"]}`, http.StatusBadRequest},
+		{`{"client_id":"` + reg.ClientID + `"}`, http.StatusBadRequest},
+		{`{"client_id":"` + reg.ClientID + `","redirect_uris":["https://client.example.org/cb2"],"backchannel_logout_uri":"/logout"}`, http.StatusBadRequest},
+		{`{"client_id":"` + reg.ClientID + `","redirect_uris":["https://client.example.org/cb2"],"backchannel_logout_uri":"http://localhost:8080/logout"}`, http.StatusBadRequest},
+		{`{"client_id":"` + reg.ClientID + `","client_secret":"` + reg.ClientSecret + `","redirect_uris":["https://client.example.org/cb2"],"post_logout_redirect_uris":["https://client.example.org/bye"]}`, http.StatusOK},
+	} {
+		if w := do("PUT", uri.Path, token, tt.body); w.Code != tt.wantCode {
+			t.Errorf("case %d: want code=%d, got=%d: %s", i, tt.wantCode, w.Code, w.Body)
+		}
+	}
+	md, err := fixtures.clientManager.Metadata(reg.ClientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(md.RedirectURIs) != 1 || md.RedirectURIs[0].String() != "https://client.example.org/cb2" {
+		t.Errorf("want updated redirect URIs, got %v", md.RedirectURIs)
+	}
+	w = do("GET", uri.Path, token, "")
+	var logoutMetadata clientLogoutMetadata
+	if err := json.Unmarshal(w.Body.Bytes(), &logoutMetadata); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"https://client.example.org/bye"}; !reflect.DeepEqual(want, logoutMetadata.PostLogoutRedirectURIs) {
+		t.Errorf("want post_logout_redirect_uris=%v, got=%v", want, logoutMetadata.PostLogoutRedirectURIs)
+	}
+
+	// Deleting the registration revokes the client's access and refresh tokens.
+	rt, err := fixtures.srv.RefreshTokenRepo.Create("ID-1", reg.ClientID, []string{"openid", "offline_access"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	at, err := fixtures.srv.AccessTokenRepo.Create(access.AccessToken{UserID: "ID-1", ClientID: reg.ClientID, ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := do("DELETE", uri.Path, token, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("want code=%d, got=%d: %s", http.StatusNoContent, w.Code, w.Body)
+	}
+	if _, err := fixtures.clientManager.Get(reg.ClientID); err != client.ErrorNotFound {
+		t.Errorf("want err=%v, got=%v", client.ErrorNotFound, err)
+	}
+	if _, err := fixtures.srv.RefreshTokenRepo.Verify(reg.ClientID, rt); err == nil {
+		t.Errorf("want refresh token of deleted client revoked")
+	}
+	if _, err := fixtures.srv.AccessTokenRepo.Get(at); err != access.ErrorInvalidToken {
+		t.Errorf("want access token of deleted client revoked, got err=%v", err)
+	}
+	if w := do("GET", uri.Path, token, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("want code=%d after deletion, got=%d", http.StatusUnauthorized, w.Code)
+	}
+}
@@ -16,11 +16,16 @@ import (
 	"github.com/coreos/pkg/health"
 	"github.com/go-gorp/gorp"
 
+	"github.com/coreos/dex/audit"
 	"github.com/coreos/dex/client"
 	clientmanager "github.com/coreos/dex/client/manager"
 	"github.com/coreos/dex/connector"
 	"github.com/coreos/dex/db"
 	"github.com/coreos/dex/email"
+	"github.com/coreos/dex/lockout"
+	"github.com/coreos/dex/mfa"
+	pcrypto "github.com/coreos/dex/pkg/crypto"
+	"github.com/coreos/dex/refresh"
 	sessionmanager "github.com/coreos/dex/session/manager"
 	"github.com/coreos/dex/user"
 	useremail "github.com/coreos/dex/user/email"
@@ -38,6 +43,49 @@ type ServerConfig struct {
 	StateConfig              StateConfigurer
 	EnableRegistration       bool
 	EnableClientRegistration bool
+
+	// ClientRegistrationPolicy restricts the clients which can register
+	// dynamically.
+	ClientRegistrationPolicy ClientRegistrationPolicy
+
+	AccessTokenValidityWindow time.Duration
+	AccessTokenAudience       string
+
+	// BrowserSessionValidityWindow is how long users stay signed in to dex
+	// for single sign-on, see Server.BrowserSessionValidityWindow.
+	BrowserSessionValidityWindow time.Duration
+
+	// RefreshTokenLifetime and RefreshTokenIdleTimeout bound how long refresh
+	// tokens can be used, see refresh.RepoOptions.
+	RefreshTokenLifetime    time.Duration
+	RefreshTokenIdleTimeout time.Duration
+
+	// LoginMaxFailures, LoginMaxIPFailures and LoginLockoutDuration configure
+	// the lockout after failed password logins, see lockout.Guard.
+	LoginMaxFailures     int
+	LoginMaxIPFailures   int
+	LoginLockoutDuration time.Duration
+
+	// RequireMFA requires all local users to log in with a second factor.
+	RequireMFA bool
+
+	// PasswordPolicy is enforced when local users choose passwords;
+	// user.DefaultPasswordPolicy is used if it's nil.
+	PasswordPolicy *user.PasswordPolicy
+
+	// ConnectorReloadInterval is how often workers check for changed
+	// connectors, see Server.ConnectorReloadInterval.
+	ConnectorReloadInterval time.Duration
+
+	// Audit chooses where audit events are written to.
+	Audit audit.Config
+
+	// AccountClientID enables the account portal, see Server.AccountClientID.
+	AccountClientID string
+
+	// AutoLinkTrustedEmails links identities from trusted email providers to
+	// existing users, see Server.AutoLinkTrustedEmails.
+	AutoLinkTrustedEmails bool
 }
 
 type StateConfigurer interface {
@@ -78,6 +126,20 @@ func (cfg *ServerConfig) Server() (*Server, error) {
 
 		EnableRegistration:       cfg.EnableRegistration,
 		EnableClientRegistration: cfg.EnableClientRegistration,
+		ClientRegistrationPolicy: cfg.ClientRegistrationPolicy,
+
+		AccessTokenValidityWindow: cfg.AccessTokenValidityWindow,
+		AccessTokenAudience:       cfg.AccessTokenAudience,
+		ConnectorReloadInterval:   cfg.ConnectorReloadInterval,
+
+		BrowserSessionValidityWindow: cfg.BrowserSessionValidityWindow,
+		AccountClientID:              cfg.AccountClientID,
+		AutoLinkTrustedEmails:        cfg.AutoLinkTrustedEmails,
+
+		refreshTokenOptions: refresh.RepoOptions{
+			AbsoluteLifetime: cfg.RefreshTokenLifetime,
+			IdleTimeout:      cfg.RefreshTokenIdleTimeout,
+		},
 	}
 
 	err = cfg.StateConfig.Configure(&srv)
@@ -85,6 +147,35 @@ func (cfg *ServerConfig) Server() (*Server, error) {
 		return nil, err
 	}
 
+	srv.Audit, err = cfg.Audit.Logger(db.NewAuditEventRepo(srv.dbMap))
+	if err != nil {
+		return nil, err
+	}
+	srv.Audit.Sinks = append(srv.Audit.Sinks, auditMetrics{})
+
+	srv.LoginGuard = lockout.NewGuard(db.NewLoginAttemptRepo(srv.dbMap))
+	srv.LoginGuard.Audit = srv.Audit
+	if cfg.LoginMaxFailures > 0 {
+		srv.LoginGuard.MaxAccountFailures = cfg.LoginMaxFailures
+	}
+	if cfg.LoginMaxIPFailures > 0 {
+		srv.LoginGuard.MaxIPFailures = cfg.LoginMaxIPFailures
+	}
+	if cfg.LoginLockoutDuration > 0 {
+		srv.LoginGuard.LockoutDuration = cfg.LoginLockoutDuration
+	}
+
+	if cfg.PasswordPolicy != nil {
+		srv.UserManager.PasswordPolicy = *cfg.PasswordPolicy
+	}
+
+	if srv.MFA != nil {
+		srv.MFA.Policy = &srv
+		srv.MFA.Issuer = cfg.IssuerName
+		srv.MFA.Required = cfg.RequireMFA
+		srv.MFA.Audit = srv.Audit
+	}
+
 	err = setTemplates(&srv, tpl)
 	if err != nil {
 		return nil, err
@@ -154,10 +245,25 @@ func (cfg *SingleServerConfig) Configure(srv *Server) error {
 		return err
 	}
 
-	refTokRepo := db.NewRefreshTokenRepo(dbMap)
+	refTokRepo := db.NewRefreshTokenRepoWithOptions(dbMap, refresh.DefaultRefreshTokenGenerator, srv.refreshTokenOptions)
+	accTokRepo := db.NewAccessTokenRepo(dbMap)
+
+	groupRepo := db.NewGroupRepo(dbMap)
+
+	// Nothing outlives the process, so neither need the secret MFA
+	// enrollments are encrypted with.
+	mfaSecret, err := pcrypto.RandBytes(32)
+	if err != nil {
+		return err
+	}
+	mfaRepo, err := db.NewMFAEnrollmentRepo(dbMap, mfaSecret)
+	if err != nil {
+		return err
+	}
 
 	txnFactory := db.TransactionFactory(dbMap)
 	userManager := usermanager.NewUserManager(userRepo, pwiRepo, cfgRepo, txnFactory, usermanager.ManagerOptions{})
+	groupManager := usermanager.NewGroupManager(groupRepo, userRepo, txnFactory)
 	clientManager, err := clientmanager.NewClientManagerFromClients(clientRepo, db.TransactionFactory(dbMap), clients, clientmanager.ManagerOptions{})
 	if err != nil {
 		return fmt.Errorf("Failed to create client identity manager: %v", err)
@@ -168,9 +274,16 @@ func (cfg *SingleServerConfig) Configure(srv *Server) error {
 	srv.ConnectorConfigRepo = cfgRepo
 	srv.UserRepo = userRepo
 	srv.UserManager = userManager
+	srv.GroupRepo = groupRepo
+	srv.GroupManager = groupManager
 	srv.PasswordInfoRepo = pwiRepo
 	srv.SessionManager = sm
+	srv.BrowserSessionRepo = db.NewBrowserSessionRepo(dbMap)
+	srv.ConsentGrantRepo = db.NewConsentGrantRepo(dbMap)
 	srv.RefreshTokenRepo = refTokRepo
+	srv.AccessTokenRepo = accTokRepo
+	srv.InitialAccessTokenRepo = db.NewInitialAccessTokenRepo(dbMap)
+	srv.MFA = &mfa.Authenticator{Repo: mfaRepo, Secrets: [][]byte{mfaSecret}}
 	srv.HealthChecks = append(srv.HealthChecks, db.NewHealthChecker(dbMap))
 	srv.dbMap = dbMap
 	return nil
@@ -248,6 +361,7 @@ func (cfg *MultiServerConfig) Configure(srv *Server) error {
 	if _, ok := dbc.Dialect.(gorp.PostgresDialect); !ok {
 		return errors.New("only postgres backend supported for multi server configurations")
 	}
+	db.RegisterPoolMetrics(dbc)
 
 	kRepo, err := db.NewPrivateKeySetRepo(dbc, cfg.UseOldFormat, cfg.KeySecrets...)
 	if err != nil {
@@ -260,9 +374,17 @@ func (cfg *MultiServerConfig) Configure(srv *Server) error {
 	cfgRepo := db.NewConnectorConfigRepo(dbc)
 	userRepo := db.NewUserRepo(dbc)
 	pwiRepo := db.NewPasswordInfoRepo(dbc)
+	groupRepo := db.NewGroupRepo(dbc)
 	userManager := usermanager.NewUserManager(userRepo, pwiRepo, cfgRepo, db.TransactionFactory(dbc), usermanager.ManagerOptions{})
+	groupManager := usermanager.NewGroupManager(groupRepo, userRepo, db.TransactionFactory(dbc))
 	clientManager := clientmanager.NewClientManager(ciRepo, db.TransactionFactory(dbc), clientmanager.ManagerOptions{})
-	refreshTokenRepo := db.NewRefreshTokenRepo(dbc)
+	refreshTokenRepo := db.NewRefreshTokenRepoWithOptions(dbc, refresh.DefaultRefreshTokenGenerator, srv.refreshTokenOptions)
+	accessTokenRepo := db.NewAccessTokenRepo(dbc)
+	initialAccessTokenRepo := db.NewInitialAccessTokenRepo(dbc)
+	mfaRepo, err := db.NewMFAEnrollmentRepo(dbc, cfg.KeySecrets...)
+	if err != nil {
+		return fmt.Errorf("unable to create MFAEnrollmentRepo: %v", err)
+	}
 
 	sm := sessionmanager.NewSessionManager(sRepo, skRepo)
 
@@ -272,9 +394,16 @@ func (cfg *MultiServerConfig) Configure(srv *Server) error {
 	srv.ConnectorConfigRepo = cfgRepo
 	srv.UserRepo = userRepo
 	srv.UserManager = userManager
+	srv.GroupRepo = groupRepo
+	srv.GroupManager = groupManager
 	srv.PasswordInfoRepo = pwiRepo
 	srv.SessionManager = sm
+	srv.BrowserSessionRepo = db.NewBrowserSessionRepo(dbc)
+	srv.ConsentGrantRepo = db.NewConsentGrantRepo(dbc)
 	srv.RefreshTokenRepo = refreshTokenRepo
+	srv.AccessTokenRepo = accessTokenRepo
+	srv.InitialAccessTokenRepo = initialAccessTokenRepo
+	srv.MFA = &mfa.Authenticator{Repo: mfaRepo, Secrets: cfg.KeySecrets}
 	srv.HealthChecks = append(srv.HealthChecks, db.NewHealthChecker(dbc))
 	srv.dbMap = dbc
 	return nil
@@ -328,6 +457,30 @@ func setTemplates(srv *Server, tpls *template.Template) error {
 	}
 	srv.ResetPasswordTemplate = rpwtpl
 
+	lotpl, err := findTemplate(LogoutTemplateName, tpls)
+	if err != nil {
+		return err
+	}
+	srv.LogoutTemplate = lotpl
+
+	ctpl, err := findTemplate(ConsentTemplateName, tpls)
+	if err != nil {
+		return err
+	}
+	srv.ConsentTemplate = ctpl
+
+	atpl, err := findTemplate(AccountTemplateName, tpls)
+	if err != nil {
+		return err
+	}
+	srv.AccountTemplate = atpl
+
+	latpl, err := findTemplate(LinkAccountTemplateName, tpls)
+	if err != nil {
+		return err
+	}
+	srv.LinkAccountTemplate = latpl
+
 	return nil
 }
 
@@ -397,6 +550,7 @@ func setEmailer(srv *Server, issuerName, fromAddress, emailerConfigFile string,
 		srv.absURL(httpPathResetPassword),
 		srv.absURL(httpPathEmailVerify),
 		srv.absURL(httpPathAcceptInvitation),
+		srv.absURL(httpPathLinkAccount),
 	)
 
 	srv.UserEmailer = ue
@@ -0,0 +1,301 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/coreos/pkg/health"
+
+	"github.com/coreos/dex/connector"
+	"github.com/coreos/dex/pkg/log"
+)
+
+// connectors returns the connectors currently in use. The slice must not be
+// modified, as reloading replaces it rather than changing it.
+func (s *Server) connectors() []connector.Connector {
+	s.connectorsMu.RLock()
+	defer s.connectorsMu.RUnlock()
+	return s.Connectors
+}
+
+// currentLocalConnectorID returns the ID of the local connector currently in
+// use, if any.
+func (s *Server) currentLocalConnectorID() string {
+	s.connectorsMu.RLock()
+	defer s.connectorsMu.RUnlock()
+	return s.localConnectorID
+}
+
+// newConnector builds the connector for cfg and provides it with the
+// resources of the server it needs.
+func (s *Server) newConnector(cfg connector.ConnectorConfig) (connector.Connector, error) {
+	ns := s.IssuerURL
+	ns.Path = path.Join(ns.Path, httpPathAuth, cfg.ConnectorID())
+
+	idpc, err := cfg.Connector(ns, s.Login, s.Templates)
+	if err != nil {
+		return nil, err
+	}
+
+	// We handle the LocalConnector specially because it needs access to the
+	// UserRepo and the PasswordInfoRepo; if it turns out that other connectors
+	// need access to these resources we'll figure out how to provide it in a
+	// cleaner manner.
+	if localConn, ok := idpc.(*connector.LocalConnector); ok {
+		if s.UserRepo == nil {
+			return nil, errors.New("UserRepo cannot be nil")
+		}
+
+		if s.PasswordInfoRepo == nil {
+			return nil, errors.New("PasswordInfoRepo cannot be nil")
+		}
+
+		localConn.SetLocalIdentityProvider(&connector.LocalIdentityProvider{
+			UserRepo:         s.UserRepo,
+			PasswordInfoRepo: s.PasswordInfoRepo,
+		})
+	}
+
+	if pc, ok := idpc.(connector.PasswordConnector); ok && s.LoginGuard != nil {
+		pc.SetLoginGuard(s.LoginGuard)
+	}
+
+	if mc, ok := idpc.(connector.MFAConnector); ok && s.MFA != nil {
+		mc.SetMFA(s.MFA)
+	}
+
+	return idpc, nil
+}
+
+// connectorMux returns a mux serving the routes of the given connectors.
+func (s *Server) connectorMux(idpcs []connector.Connector) *http.ServeMux {
+	mux := http.NewServeMux()
+	pcfg := s.ProviderConfig()
+	for _, idpc := range idpcs {
+		errorURL, err := url.Parse(fmt.Sprintf("%s?connector_id=%s", pcfg.AuthEndpoint, idpc.ID()))
+		if err != nil {
+			log.Fatal(err)
+		}
+		idpc.Register(mux, *errorURL)
+	}
+	return mux
+}
+
+// ReloadConnectors replaces the connectors in use by those configured by
+// cfgs. Connectors whose configuration is unchanged are kept as they are;
+// the others are built anew, and the Sync loops of those replaced or removed
+// are stopped. If any connector can't be built, the connectors in use are
+// left alone and the error is reported by the server's health check until a
+// later reload succeeds.
+func (s *Server) ReloadConnectors(cfgs []connector.ConnectorConfig) error {
+	err := s.reloadConnectors(cfgs)
+	s.connectorsMu.Lock()
+	s.connectorReloadErr = err
+	s.connectorsMu.Unlock()
+	return err
+}
+
+func (s *Server) reloadConnectors(cfgs []connector.ConnectorConfig) error {
+	if len(cfgs) == 0 {
+		return errors.New("no connectors configured")
+	}
+
+	// Only one reload may build connectors at a time.
+	s.connectorsReloadMu.Lock()
+	defer s.connectorsReloadMu.Unlock()
+
+	s.connectorsMu.RLock()
+	current := make(map[string]connector.Connector)
+	for _, idpc := range s.Connectors {
+		current[idpc.ID()] = idpc
+	}
+	currentCfgs := s.connectorConfigs
+	s.connectorsMu.RUnlock()
+
+	var (
+		idpcs   []connector.Connector
+		built   []connector.Connector
+		localID string
+		newCfgs = make(map[string]connector.ConnectorConfig)
+		// kept are the IDs of the connectors which are in use already.
+		kept = make(map[string]bool)
+	)
+	for _, cfg := range cfgs {
+		id := cfg.ConnectorID()
+		if newCfgs[id] != nil {
+			return fmt.Errorf("duplicate connector ID %q", id)
+		}
+		newCfgs[id] = cfg
+
+		idpc, ok := current[id]
+		if ok && sameConnectorConfig(currentCfgs[id], cfg) {
+			kept[id] = true
+		} else {
+			var err error
+			if idpc, err = s.newConnector(cfg); err != nil {
+				return fmt.Errorf("connector %q: %v", id, err)
+			}
+			built = append(built, idpc)
+		}
+		if _, ok := idpc.(*connector.LocalConnector); ok {
+			localID = id
+		}
+		idpcs = append(idpcs, idpc)
+	}
+	sort.Sort(sortableIDPCs(idpcs))
+	mux := s.connectorMux(idpcs)
+
+	s.connectorsMu.Lock()
+	defer s.connectorsMu.Unlock()
+	s.Connectors = idpcs
+	s.connectorConfigs = newCfgs
+	s.connectorRoutes = mux
+	s.localConnectorID = localID
+	if s.connectorStops != nil {
+		// The server is running: stop the Sync loops of the connectors
+		// which were replaced or removed, and start those of the new ones.
+		for id, stop := range s.connectorStops {
+			if kept[id] {
+				continue
+			}
+			if stop != nil {
+				close(stop)
+			}
+			delete(s.connectorStops, id)
+		}
+		for _, idpc := range built {
+			s.connectorStops[idpc.ID()] = idpc.Sync()
+		}
+	}
+
+	for _, idpc := range built {
+		log.Infof("Loaded IdP connector: id=%s type=%s", idpc.ID(), newCfgs[idpc.ID()].ConnectorType())
+	}
+	for id := range current {
+		if newCfgs[id] == nil {
+			log.Infof("Removed IdP connector: id=%s", id)
+		}
+	}
+	return nil
+}
+
+// sameConnectorConfig reports whether a and b configure the same connector
+// in the same way.
+func sameConnectorConfig(a, b connector.ConnectorConfig) bool {
+	if a == nil || b == nil || a.ConnectorType() != b.ConnectorType() {
+		return false
+	}
+	ja, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	jb, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return string(ja) == string(jb)
+}
+
+// startConnectors starts the Sync loops of the connectors in use.
+func (s *Server) startConnectors() {
+	s.connectorsMu.Lock()
+	defer s.connectorsMu.Unlock()
+	s.connectorStops = make(map[string]chan struct{})
+	for _, idpc := range s.Connectors {
+		s.connectorStops[idpc.ID()] = idpc.Sync()
+	}
+}
+
+// stopConnectors stops the Sync loops of the connectors in use.
+func (s *Server) stopConnectors() {
+	s.connectorsMu.Lock()
+	defer s.connectorsMu.Unlock()
+	for _, stop := range s.connectorStops {
+		if stop != nil {
+			close(stop)
+		}
+	}
+	s.connectorStops = nil
+}
+
+// watchConnectors reloads the connectors from the ConnectorConfigRepo every
+// interval, until the returned channel is closed.
+func (s *Server) watchConnectors(interval time.Duration) chan struct{} {
+	stop := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-time.After(interval):
+			case <-stop:
+				return
+			}
+
+			cfgs, err := s.ConnectorConfigRepo.All()
+			if err != nil {
+				log.Errorf("Unable to load connectors: %v", err)
+				continue
+			}
+			if !s.connectorsChanged(cfgs) {
+				continue
+			}
+			if err := s.ReloadConnectors(cfgs); err != nil {
+				log.Errorf("Unable to reload connectors: %v", err)
+			}
+		}
+	}()
+	return stop
+}
+
+// connectorsChanged reports whether cfgs differ from the configuration of
+// the connectors in use.
+func (s *Server) connectorsChanged(cfgs []connector.ConnectorConfig) bool {
+	s.connectorsMu.RLock()
+	defer s.connectorsMu.RUnlock()
+	if len(cfgs) != len(s.connectorConfigs) {
+		return true
+	}
+	for _, cfg := range cfgs {
+		if !sameConnectorConfig(s.connectorConfigs[cfg.ConnectorID()], cfg) {
+			return true
+		}
+	}
+	return false
+}
+
+// serveConnectors serves the routes of the connectors currently in use.
+func (s *Server) serveConnectors(w http.ResponseWriter, r *http.Request) {
+	s.connectorsMu.RLock()
+	mux := s.connectorRoutes
+	s.connectorsMu.RUnlock()
+	if mux == nil {
+		http.NotFound(w, r)
+		return
+	}
+	mux.ServeHTTP(w, r)
+}
+
+// connectorsHealth checks the connectors currently in use, and that the
+// last attempt to reload them succeeded.
+type connectorsHealth struct {
+	s *Server
+}
+
+func (c connectorsHealth) Healthy() error {
+	c.s.connectorsMu.RLock()
+	idpcs, err := c.s.Connectors, c.s.connectorReloadErr
+	c.s.connectorsMu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("reloading connectors failed: %v", err)
+	}
+	checks := make([]health.Checkable, len(idpcs))
+	for i, idpc := range idpcs {
+		checks[i] = idpc
+	}
+	return health.Check(checks)
+}
@@ -0,0 +1,283 @@
+package server
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/kylelemons/godebug/pretty"
+
+	"github.com/coreos/dex/connector"
+	schema "github.com/coreos/dex/schema/workerschema"
+	"github.com/coreos/dex/user"
+	usersapi "github.com/coreos/dex/user/api"
+)
+
+// fakeSyncConnectorConfig configures a fakeSyncConnector. Connectors with
+// different Settings are configured differently.
+type fakeSyncConnectorConfig struct {
+	ID       string `json:"id"`
+	Settings string `json:"settings"`
+	Invalid  bool   `json:"invalid"`
+}
+
+func (cfg *fakeSyncConnectorConfig) ConnectorID() string {
+	return cfg.ID
+}
+
+func (cfg *fakeSyncConnectorConfig) ConnectorType() string {
+	return "fake-sync"
+}
+
+func (cfg *fakeSyncConnectorConfig) Connector(ns url.URL, lf connector.LoginFunc, tpls *template.Template) (connector.Connector, error) {
+	if cfg.Invalid {
+		return nil, errInvalidFakeConnector
+	}
+	return &fakeSyncConnector{
+		fakeConnector: fakeConnector{loginURL: "http://fake.example.com"},
+		id:            cfg.ID,
+		path:          ns.Path + "/callback",
+	}, nil
+}
+
+var errInvalidFakeConnector = errors.New("invalid fake connector")
+
+// fakeSyncConnector serves a callback route, and records whether its Sync
+// loop is running.
+type fakeSyncConnector struct {
+	fakeConnector
+	id   string
+	path string
+	sync chan struct{}
+}
+
+func (c *fakeSyncConnector) ID() string {
+	return c.id
+}
+
+func (c *fakeSyncConnector) Register(mux *http.ServeMux, errorURL url.URL) {
+	mux.HandleFunc(c.path, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(c.id))
+	})
+}
+
+func (c *fakeSyncConnector) Sync() chan struct{} {
+	c.sync = make(chan struct{})
+	return c.sync
+}
+
+func (c *fakeSyncConnector) syncing() bool {
+	if c.sync == nil {
+		return false
+	}
+	select {
+	case <-c.sync:
+		return false
+	default:
+		return true
+	}
+}
+
+func connectorIDs(idpcs []connector.Connector) []string {
+	var ids []string
+	for _, idpc := range idpcs {
+		ids = append(ids, idpc.ID())
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestReloadConnectors(t *testing.T) {
+	f, err := makeTestFixtures()
+	if err != nil {
+		t.Fatalf("error making test fixtures: %v", err)
+	}
+	srv := f.srv
+	err = srv.ReloadConnectors([]connector.ConnectorConfig{
+		&fakeSyncConnectorConfig{ID: "a", Settings: "1"},
+		&fakeSyncConnectorConfig{ID: "b", Settings: "1"},
+		&fakeSyncConnectorConfig{ID: "c", Settings: "1"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	h := srv.HTTPHandler()
+	srv.startConnectors()
+	defer srv.stopConnectors()
+
+	get := func(path string) (int, string) {
+		r, err := http.NewRequest("GET", testIssuerURL.String()+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code, w.Body.String()
+	}
+
+	before := make(map[string]*fakeSyncConnector)
+	for _, idpc := range srv.connectors() {
+		c := idpc.(*fakeSyncConnector)
+		if !c.syncing() {
+			t.Errorf("want connector %q syncing", c.id)
+		}
+		before[c.id] = c
+	}
+
+	// Keep a, reconfigure b, drop c and add d.
+	err = srv.ReloadConnectors([]connector.ConnectorConfig{
+		&fakeSyncConnectorConfig{ID: "a", Settings: "1"},
+		&fakeSyncConnectorConfig{ID: "b", Settings: "2"},
+		&fakeSyncConnectorConfig{ID: "d", Settings: "1"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff := pretty.Compare([]string{"a", "b", "d"}, connectorIDs(srv.connectors())); diff != "" {
+		t.Errorf("Compare(want, got) = %v", diff)
+	}
+	after := make(map[string]*fakeSyncConnector)
+	for _, idpc := range srv.connectors() {
+		c := idpc.(*fakeSyncConnector)
+		if !c.syncing() {
+			t.Errorf("want connector %q syncing", c.id)
+		}
+		after[c.id] = c
+	}
+	if after["a"] != before["a"] {
+		t.Errorf("want unchanged connector kept")
+	}
+	if after["b"] == before["b"] {
+		t.Errorf("want reconfigured connector replaced")
+	}
+	if before["b"].syncing() || before["c"].syncing() {
+		t.Errorf("want replaced and removed connectors stopped")
+	}
+
+	tests := []struct {
+		path     string
+		wantCode int
+	}{
+		{"/auth/a/callback", http.StatusOK},
+		{"/auth/b/callback", http.StatusOK},
+		{"/auth/c/callback", http.StatusNotFound},
+		{"/auth/d/callback", http.StatusOK},
+	}
+	for i, tt := range tests {
+		if code, _ := get(tt.path); code != tt.wantCode {
+			t.Errorf("case %d: want status=%d, got=%d", i, tt.wantCode, code)
+		}
+	}
+
+	// A failed reload leaves the connectors alone, and is reported by the
+	// health check until a reload succeeds.
+	err = srv.ReloadConnectors([]connector.ConnectorConfig{
+		&fakeSyncConnectorConfig{ID: "a", Settings: "1"},
+		&fakeSyncConnectorConfig{ID: "e", Invalid: true},
+	})
+	if err == nil {
+		t.Fatalf("want non-nil error")
+	}
+	if diff := pretty.Compare([]string{"a", "b", "d"}, connectorIDs(srv.connectors())); diff != "" {
+		t.Errorf("Compare(want, got) = %v", diff)
+	}
+	if code, _ := get(httpPathHealth); code != http.StatusInternalServerError {
+		t.Errorf("want unhealthy after failed reload, got status=%d", code)
+	}
+
+	duplicates := []connector.ConnectorConfig{
+		&fakeSyncConnectorConfig{ID: "a", Settings: "1"},
+		&fakeSyncConnectorConfig{ID: "a", Settings: "2"},
+	}
+	if err := srv.ReloadConnectors(duplicates); err == nil {
+		t.Errorf("want non-nil error for duplicate IDs")
+	}
+	if err := srv.ReloadConnectors(nil); err == nil {
+		t.Errorf("want non-nil error for no connectors")
+	}
+
+	err = srv.ReloadConnectors([]connector.ConnectorConfig{
+		&fakeSyncConnectorConfig{ID: "a", Settings: "1"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if code, body := get(httpPathHealth); code != http.StatusOK {
+		t.Errorf("want healthy, got status=%d: %s", code, body)
+	}
+}
+
+func TestWatchConnectors(t *testing.T) {
+	f, err := makeTestFixtures()
+	if err != nil {
+		t.Fatalf("error making test fixtures: %v", err)
+	}
+	h := f.srv.HTTPHandler()
+	stop := f.srv.watchConnectors(time.Millisecond)
+	defer close(stop)
+
+	cfgs := []connector.ConnectorConfig{
+		&connector.LocalConnectorConfig{ID: "local"},
+		&connector.LocalConnectorConfig{ID: "local-2"},
+	}
+	if err := f.srv.ConnectorConfigRepo.Set(cfgs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{"local", "local-2"}
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(5 * time.Millisecond) {
+		if pretty.Compare(want, connectorIDs(f.srv.connectors())) == "" {
+			break
+		}
+	}
+	if diff := pretty.Compare(want, connectorIDs(f.srv.connectors())); diff != "" {
+		t.Fatalf("Compare(want, got) = %v", diff)
+	}
+
+	r, err := http.NewRequest("GET", "http://server.example.com/auth/local-2/login?session_key=foo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code == http.StatusNotFound {
+		t.Errorf("want the new connector's login page routed")
+	}
+}
+
+func TestUsersAPIFollowsReloadedLocalConnector(t *testing.T) {
+	f, err := makeTestFixtures()
+	if err != nil {
+		t.Fatalf("error making test fixtures: %v", err)
+	}
+	// Like the users API served by HTTPHandler, api outlives the reload.
+	api := f.srv.usersAPI()
+
+	cfgs := []connector.ConnectorConfig{
+		&connector.LocalConnectorConfig{ID: "local-2"},
+	}
+	if err := f.srv.ConnectorConfigRepo.Set(cfgs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := f.srv.ReloadConnectors(cfgs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	creds := usersapi.Creds{ClientID: testClientID, User: user.User{Admin: true}}
+	resp, err := api.CreateUser(creds, schema.User{Email: "reloaded@example.com"}, testRedirectURL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	usr, err := f.srv.UserRepo.GetByRemoteIdentity(nil, user.RemoteIdentity{ConnectorID: "local-2", ID: resp.User.Id})
+	if err != nil {
+		t.Fatalf("want user created with the reloaded local connector: %v", err)
+	}
+	if usr.ID != resp.User.Id {
+		t.Errorf("want user %q, got %q", resp.User.Id, usr.ID)
+	}
+}
@@ -0,0 +1,282 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/coreos/go-oidc/oauth2"
+
+	"github.com/coreos/dex/audit"
+	"github.com/coreos/dex/consent"
+	phttp "github.com/coreos/dex/pkg/http"
+	"github.com/coreos/dex/pkg/log"
+	"github.com/coreos/dex/session"
+	"github.com/coreos/dex/user"
+)
+
+var errSessionNotIdentified = errors.New("session hasn't identified a user")
+
+// scopeDescriptions tell users what they consent to when a client requests
+// a scope.
+var scopeDescriptions = map[string]string{
+	"openid":         "Know who you are",
+	"profile":        "View your name",
+	"email":          "View your email address",
+	"groups":         "View the groups you belong to",
+	"address":        "View your address",
+	"phone":          "View your phone number",
+	"offline_access": "Keep access to your account when you're not using it",
+}
+
+type consentTemplateData struct {
+	Error   string
+	Message string
+
+	ClientName string
+	LogoURI    string
+	ClientURI  string
+	PolicyURI  string
+	Scopes     []string
+
+	Code    string
+	PostURL string
+}
+
+// ConsentRequired reports whether the user has to consent to the client
+// requesting the scopes, because the client isn't a first-party client and
+// the user didn't grant it all of them before. Users are never asked for
+// consent if the server has no ConsentGrantRepo.
+func (s *Server) ConsentRequired(userID, clientID string, scope []string) (bool, error) {
+	if s.ConsentGrantRepo == nil {
+		return false, nil
+	}
+	cli, err := s.ClientRepo.Get(nil, clientID)
+	if err != nil {
+		return false, err
+	}
+	if cli.FirstParty {
+		return false, nil
+	}
+
+	g, err := s.ConsentGrantRepo.Get(userID, clientID)
+	if err == consent.ErrorNotFound {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return len(g.Missing(scope)) != 0, nil
+}
+
+// consentScopes returns the scopes the user consents to when a client
+// requests the scopes and claims: the scopes, and the scopes which request
+// the claims asked for by name.
+func consentScopes(scope []string, cr session.ClaimsRequest) []string {
+	scopes := append([]string(nil), scope...)
+	names := append(append([]string(nil), cr.IDToken...), cr.UserInfo...)
+	for _, s := range user.ClaimScopes(names) {
+		if !containsString(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// SetSessionPromptConsent records that the user of the session the key
+// belongs to must be asked for consent, as the client sent prompt=consent.
+func (s *Server) SetSessionPromptConsent(key string) error {
+	sessionID, err := s.SessionManager.PeekKey(key)
+	if err != nil {
+		return err
+	}
+	_, err = s.SessionManager.SetPromptConsent(sessionID)
+	return err
+}
+
+// consentRedirectURL returns the URL of the consent page if the user of the
+// session has to consent to the client's scopes first, and the URL the
+// user-agent is sent back to the client with otherwise. The code, if given,
+// is used as the session key of the consent page or as the authorization
+// code.
+func (s *Server) consentRedirectURL(ses *session.Session, code string) (string, error) {
+	ask := ses.PromptConsent && s.ConsentGrantRepo != nil
+	if !ask {
+		var err error
+		if ask, err = s.ConsentRequired(ses.UserID, ses.ClientID, consentScopes(ses.Scope, ses.ClaimsRequest)); err != nil {
+			return "", err
+		}
+	}
+	if !ask {
+		return s.clientRedirectURL(ses, code)
+	}
+
+	if code == "" {
+		var err error
+		if code, err = s.SessionManager.NewSessionKey(ses.ID); err != nil {
+			return "", err
+		}
+	}
+	u := s.absURL(httpPathConsent)
+	q := u.Query()
+	q.Set("code", code)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// handleConsent asks the user whether the client may have the scopes it
+// requested. If the user allows it, the grant is stored and the user-agent
+// is sent back to the client as if the user had just logged in; otherwise
+// the client gets the access_denied error.
+func (s *Server) handleConsent(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		code := r.URL.Query().Get("code")
+		sessionID, err := s.SessionManager.PeekKey(code)
+		if err != nil {
+			s.renderConsentError(w, http.StatusBadRequest, "This login has expired. Please log in again.")
+			return
+		}
+		ses, err := s.identifiedSession(sessionID)
+		if err != nil {
+			log.Errorf("Invalid consent request: %v", err)
+			s.renderConsentError(w, http.StatusBadRequest, "This login has expired. Please log in again.")
+			return
+		}
+
+		cli, err := s.ClientManager.Get(ses.ClientID)
+		if err != nil {
+			log.Errorf("Failed getting client %q: %v", ses.ClientID, err)
+			s.renderConsentError(w, http.StatusInternalServerError, "An error occurred. Please try again.")
+			return
+		}
+		postURL := s.absURL(httpPathConsent)
+		td := consentTemplateData{
+			ClientName: cli.Metadata.ClientName,
+			Code:       code,
+			PostURL:    postURL.String(),
+		}
+		if td.ClientName == "" {
+			td.ClientName = cli.Credentials.ID
+		}
+		if cli.Metadata.LogoURI != nil {
+			td.LogoURI = cli.Metadata.LogoURI.String()
+		}
+		if cli.Metadata.ClientURI != nil {
+			td.ClientURI = cli.Metadata.ClientURI.String()
+		}
+		if cli.Metadata.PolicyURI != nil {
+			td.PolicyURI = cli.Metadata.PolicyURI.String()
+		}
+		// Scopes without a description are listed by name, so users never
+		// consent to something they weren't shown.
+		for _, scope := range consentScopes(ses.Scope, ses.ClaimsRequest) {
+			desc, ok := scopeDescriptions[scope]
+			if !ok {
+				desc = scope
+			}
+			td.Scopes = append(td.Scopes, desc)
+		}
+		execTemplate(w, s.ConsentTemplate, td)
+
+	case "POST":
+		sessionID, err := s.SessionManager.ExchangeKey(r.PostFormValue("code"))
+		if err != nil {
+			s.renderConsentError(w, http.StatusBadRequest, "This login has expired. Please log in again.")
+			return
+		}
+		ses, err := s.identifiedSession(sessionID)
+		if err != nil {
+			log.Errorf("Invalid consent request: %v", err)
+			s.renderConsentError(w, http.StatusBadRequest, "This login has expired. Please log in again.")
+			return
+		}
+
+		authError := redirectAuthError
+		if ses.ResponseType != "" && ses.ResponseType != oauth2.ResponseTypeCode {
+			authError = fragmentRedirectAuthError
+		}
+
+		if r.PostFormValue("approve") != "true" {
+			if _, err := s.SessionManager.Kill(sessionID); err != nil {
+				log.Errorf("Failed killing session %s: %v", sessionID, err)
+			}
+			log.Infof("Session %s consent denied: clientID=%s user=%s", sessionID, ses.ClientID, ses.UserID)
+			s.Audit.Record(audit.Event{
+				Type:     audit.EventConsentDenied,
+				UserID:   ses.UserID,
+				ClientID: ses.ClientID,
+				IP:       ses.RemoteIP,
+			})
+			authError(w, oauth2.NewError(oauth2.ErrorAccessDenied), ses.ClientState, ses.RedirectURL)
+			return
+		}
+
+		if err := s.grantConsent(ses); err != nil {
+			log.Errorf("Failed storing consent grant: %v", err)
+			authError(w, oauth2.NewError(oauth2.ErrorServerError), ses.ClientState, ses.RedirectURL)
+			return
+		}
+		log.Infof("Session %s consent granted: clientID=%s user=%s scope=%v", sessionID, ses.ClientID, ses.UserID, ses.Scope)
+		s.Audit.Record(audit.Event{
+			Type:     audit.EventConsentGranted,
+			UserID:   ses.UserID,
+			ClientID: ses.ClientID,
+			IP:       ses.RemoteIP,
+		})
+
+		ru, err := s.clientRedirectURL(ses, "")
+		if err != nil {
+			log.Errorf("Failed creating client redirect URL: %v", err)
+			authError(w, oauth2.NewError(oauth2.ErrorServerError), ses.ClientState, ses.RedirectURL)
+			return
+		}
+		w.Header().Set("Location", ru)
+		w.WriteHeader(http.StatusSeeOther)
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		phttp.WriteError(w, http.StatusMethodNotAllowed, "GET or POST only acceptable methods")
+	}
+}
+
+func (s *Server) renderConsentError(w http.ResponseWriter, status int, msg string) {
+	execTemplateWithStatus(w, s.ConsentTemplate, consentTemplateData{
+		Error:   "Unable to continue",
+		Message: msg,
+	}, status)
+}
+
+// identifiedSession returns the session, if it identified its user.
+func (s *Server) identifiedSession(sessionID string) (*session.Session, error) {
+	ses, err := s.SessionManager.Get(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if ses.State != session.SessionStateIdentified {
+		return nil, errSessionNotIdentified
+	}
+	return ses, nil
+}
+
+// grantConsent adds the scopes of the session, including those which request
+// the claims it asked for by name, to those its user granted its client
+// before.
+func (s *Server) grantConsent(ses *session.Session) error {
+	now := time.Now()
+	g, err := s.ConsentGrantRepo.Get(ses.UserID, ses.ClientID)
+	switch err {
+	case nil:
+	case consent.ErrorNotFound:
+		g = &consent.Grant{
+			UserID:    ses.UserID,
+			ClientID:  ses.ClientID,
+			CreatedAt: now,
+		}
+	default:
+		return err
+	}
+	g.Add(consentScopes(ses.Scope, ses.ClaimsRequest))
+	g.UpdatedAt = now
+	return s.ConsentGrantRepo.Set(*g)
+}
@@ -0,0 +1,252 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/coreos/go-oidc/oidc"
+	"github.com/kylelemons/godebug/pretty"
+
+	"github.com/coreos/dex/client"
+	"github.com/coreos/dex/connector"
+	"github.com/coreos/dex/db"
+	"github.com/coreos/dex/session"
+)
+
+func TestConsent(t *testing.T) {
+	f, err := makeTestFixtures()
+	if err != nil {
+		t.Fatalf("error making test fixtures: %v", err)
+	}
+	f.srv.ConsentGrantRepo = db.NewConsentGrantRepo(db.NewMemDB())
+
+	firstPartyCreds, err := f.clientManager.New(client.Client{
+		Metadata: oidc.ClientMetadata{
+			RedirectURIs: []url.URL{{Scheme: "https", Host: "first-party.example.com", Path: "/callback"}},
+		},
+		FirstParty: true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+
+	loginWithClaims := func(clientID string, scope []string, cr session.ClaimsRequest, promptConsent bool) string {
+		key, err := f.srv.NewSession(session.SessionRequest{
+			ConnectorID:   "IDPC-1",
+			ClientID:      clientID,
+			ClientState:   "bogus",
+			RedirectURL:   testRedirectURL,
+			Scope:         scope,
+			ResponseType:  "code",
+			ClaimsRequest: cr,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error creating session: %v", err)
+		}
+		if promptConsent {
+			if err := f.srv.SetSessionPromptConsent(key); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		ru, err := f.srv.Login(oidc.Identity{ID: "RID-1"}, nil, key)
+		if err != nil {
+			t.Fatalf("unexpected error logging in: %v", err)
+		}
+		return ru
+	}
+	login := func(clientID string, scope []string, promptConsent bool) string {
+		return loginWithClaims(clientID, scope, session.ClaimsRequest{}, promptConsent)
+	}
+	consentCode := func(ru string) string {
+		consentURL := f.srv.absURL(httpPathConsent)
+		if !strings.HasPrefix(ru, consentURL.String()+"?") {
+			t.Fatalf("want redirect to the consent page, got %q", ru)
+		}
+		u, err := url.Parse(ru)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return u.Query().Get("code")
+	}
+	post := func(code string, approve bool) *httptest.ResponseRecorder {
+		form := url.Values{"code": {code}}
+		if approve {
+			form.Set("approve", "true")
+		}
+		req, err := http.NewRequest("POST", "http://server.example.com/consent", strings.NewReader(form.Encode()))
+		if err != nil {
+			t.Fatalf("unable to form HTTP request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		f.srv.handleConsent(w, req)
+		return w
+	}
+	wantGrant := func(scope []string) {
+		g, err := f.srv.ConsentGrantRepo.Get("ID-1", testClientID)
+		if err != nil {
+			t.Fatalf("unexpected error getting grant: %v", err)
+		}
+		if diff := pretty.Compare(scope, g.Scope); diff != "" {
+			t.Errorf("Compare(want, got) = %v", diff)
+		}
+	}
+	callback := testRedirectURL.String()
+
+	// The user is asked for consent the first time.
+	code := consentCode(login(testClientID, []string{"openid", "email"}, false))
+	req, err := http.NewRequest("GET", "http://server.example.com/consent?code="+url.QueryEscape(code), nil)
+	if err != nil {
+		t.Fatalf("unable to form HTTP request: %v", err)
+	}
+	w := httptest.NewRecorder()
+	f.srv.handleConsent(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("want HTTP %d, got %d", http.StatusOK, w.Code)
+	}
+	for _, want := range []string{testClientID, scopeDescriptions["email"], `name="code" value="` + code + `"`} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("want consent page to contain %q", want)
+		}
+	}
+
+	w = post(code, true)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("want HTTP %d, got %d", http.StatusSeeOther, w.Code)
+	}
+	if got := w.Header().Get("Location"); !strings.HasPrefix(got, callback+"?code=") {
+		t.Errorf("want Location starting with %q, got %q", callback+"?code=", got)
+	}
+	wantGrant([]string{"openid", "email"})
+
+	// The code of the consent page can't be used twice.
+	if w = post(code, true); w.Code != http.StatusBadRequest {
+		t.Errorf("want HTTP %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	// Scopes granted before need no consent.
+	if ru := login(testClientID, []string{"openid"}, false); !strings.HasPrefix(ru, callback+"?code=") {
+		t.Errorf("want redirect to the client, got %q", ru)
+	}
+
+	// New scopes do.
+	code = consentCode(login(testClientID, []string{"openid", "email", "groups"}, false))
+	if w = post(code, true); w.Code != http.StatusSeeOther {
+		t.Fatalf("want HTTP %d, got %d", http.StatusSeeOther, w.Code)
+	}
+	wantGrant([]string{"openid", "email", "groups"})
+
+	// So does prompt=consent, and the client is told if the user denies it.
+	code = consentCode(login(testClientID, []string{"openid"}, true))
+	w = post(code, false)
+	if w.Code != http.StatusFound {
+		t.Fatalf("want HTTP %d, got %d", http.StatusFound, w.Code)
+	}
+	if got, want := w.Header().Get("Location"), callback+"?error=access_denied&state=bogus"; got != want {
+		t.Errorf("want Location %q, got %q", want, got)
+	}
+	wantGrant([]string{"openid", "email", "groups"})
+
+	// Claims requested by name need consent to the scopes which request
+	// them, and scopes without a description are shown by name.
+	code = consentCode(loginWithClaims(testClientID, []string{"openid", "custom"}, session.ClaimsRequest{UserInfo: []string{"phone_number"}}, false))
+	req, err = http.NewRequest("GET", "http://server.example.com/consent?code="+url.QueryEscape(code), nil)
+	if err != nil {
+		t.Fatalf("unable to form HTTP request: %v", err)
+	}
+	w = httptest.NewRecorder()
+	f.srv.handleConsent(w, req)
+	for _, want := range []string{scopeDescriptions["phone"], "<li>custom</li>"} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("want consent page to contain %q", want)
+		}
+	}
+	if w = post(code, true); w.Code != http.StatusSeeOther {
+		t.Fatalf("want HTTP %d, got %d", http.StatusSeeOther, w.Code)
+	}
+	wantGrant([]string{"openid", "email", "groups", "custom", "phone"})
+	if ru := loginWithClaims(testClientID, []string{"openid"}, session.ClaimsRequest{IDToken: []string{"phone_number"}}, false); !strings.HasPrefix(ru, callback+"?code=") {
+		t.Errorf("want redirect to the client, got %q", ru)
+	}
+	// The name claim isn't covered by any scope granted so far.
+	consentCode(loginWithClaims(testClientID, []string{"openid"}, session.ClaimsRequest{IDToken: []string{"name"}}, false))
+
+	// First-party clients are pre-consented.
+	if ru := login(firstPartyCreds.ID, []string{"openid", "email"}, false); !strings.HasPrefix(ru, callback+"?code=") {
+		t.Errorf("want redirect to the client, got %q", ru)
+	}
+}
+
+func TestHandleAuthFuncConsentRequired(t *testing.T) {
+	f, err := makeTestFixtures()
+	if err != nil {
+		t.Fatalf("error making test fixtures: %v", err)
+	}
+	f.srv.BrowserSessionRepo = db.NewBrowserSessionRepo(db.NewMemDB())
+	f.srv.ConsentGrantRepo = db.NewConsentGrantRepo(db.NewMemDB())
+
+	idpc := &fakeSessionKeyConnector{fakeConnector: fakeConnector{loginURL: "http://fake.example.com"}, id: "IDPC-1"}
+	hdlr := handleAuthFunc(f.srv, []connector.Connector{idpc}, nil, true)
+	authRequest := func(params url.Values, cookie *http.Cookie) *httptest.ResponseRecorder {
+		q := url.Values{
+			"response_type": {"code"},
+			"client_id":     {testClientID},
+			"scope":         {"openid"},
+		}
+		for k, v := range params {
+			q[k] = v
+		}
+		req, err := http.NewRequest("GET", "http://server.example.com/auth?"+q.Encode(), nil)
+		if err != nil {
+			t.Fatalf("unable to form HTTP request: %v", err)
+		}
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		hdlr.ServeHTTP(w, req)
+		return w
+	}
+
+	w := authRequest(url.Values{"connector_id": {"IDPC-1"}}, nil)
+	ru, err := f.srv.Login(oidc.Identity{ID: "RID-1"}, nil, idpc.sessionKey)
+	if err != nil {
+		t.Fatalf("unexpected error logging in: %v", err)
+	}
+	w = finishBrowserLogin(t, f.srv, ru, responseCookie(w, cookiePendingBrowserSession))
+	cookie := responseCookie(w, cookieBrowserSession)
+	if cookie == nil {
+		t.Fatalf("want browser session cookie to be set")
+	}
+
+	// The user hasn't consented yet, and can't be asked to.
+	callback := testRedirectURL.String()
+	w = authRequest(url.Values{"prompt": {"none"}}, cookie)
+	if got, want := w.Header().Get("Location"), callback+"?error=consent_required"; !strings.HasPrefix(got, want) {
+		t.Errorf("want Location starting with %q, got %q", want, got)
+	}
+
+	// Single sign-on takes the user to the consent page instead.
+	w = authRequest(url.Values{}, cookie)
+	consentURL := f.srv.absURL(httpPathConsent)
+	if got := w.Header().Get("Location"); !strings.HasPrefix(got, consentURL.String()+"?code=") {
+		t.Errorf("want Location starting with %q, got %q", consentURL.String(), got)
+	}
+
+	if err := f.srv.grantConsent(&session.Session{UserID: "ID-1", ClientID: testClientID, Scope: []string{"openid"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	w = authRequest(url.Values{"prompt": {"none"}}, cookie)
+	if got, want := w.Header().Get("Location"), callback+"?code="; !strings.HasPrefix(got, want) {
+		t.Errorf("want Location starting with %q, got %q", want, got)
+	}
+
+	// The client may still ask for the user's consent.
+	w = authRequest(url.Values{"prompt": {"consent"}}, cookie)
+	if got := w.Header().Get("Location"); !strings.HasPrefix(got, consentURL.String()+"?code=") {
+		t.Errorf("want Location starting with %q, got %q", consentURL.String(), got)
+	}
+}
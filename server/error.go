@@ -1,6 +1,7 @@
 package server
 
 import (
+	"fmt"
 	"net/http"
 	"net/url"
 
@@ -12,6 +13,17 @@ const (
 	errorInvalidRequest        = "invalid_request"
 	errorServerError           = "server_error"
 	errorAccessDenied          = "access_denied"
+
+	// Token revocation error, RFC 7009 Section 2.2.1.
+	errorUnsupportedTokenType = "unsupported_token_type"
+
+	// Bearer token errors, RFC 6750 Section 3.1.
+	errorInvalidToken      = "invalid_token"
+	errorInsufficientScope = "insufficient_scope"
+
+	// Authentication errors, OpenID Connect Core 1.0 Section 3.1.2.6.
+	errorLoginRequired   = "login_required"
+	errorConsentRequired = "consent_required"
 )
 
 type apiError struct {
@@ -60,6 +72,19 @@ func writeTokenError(w http.ResponseWriter, err error, state string) {
 	writeResponseWithBody(w, status, oerr)
 }
 
+// writeBearerTokenError rejects a request to a resource protected by a bearer
+// token, as described in RFC 6750 Section 3. Requests which carry no token at
+// all are rejected without an error type.
+func writeBearerTokenError(w http.ResponseWriter, code int, typ string) {
+	if typ == "" {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		w.WriteHeader(code)
+		return
+	}
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf("Bearer error=%q", typ))
+	writeResponseWithBody(w, code, newAPIError(typ, ""))
+}
+
 func writeAuthError(w http.ResponseWriter, err error, state string) {
 	oerr, ok := err.(*oauth2.Error)
 	if !ok {
@@ -83,3 +108,21 @@ func redirectAuthError(w http.ResponseWriter, err error, state string, redirectU
 	w.Header().Set("Location", redirectURL.String())
 	w.WriteHeader(http.StatusFound)
 }
+
+// fragmentRedirectAuthError is like redirectAuthError, but passes the error
+// in the fragment of the redirect URL, as required for implicit and hybrid
+// response types.
+func fragmentRedirectAuthError(w http.ResponseWriter, err error, state string, redirectURL url.URL) {
+	oerr, ok := err.(*oauth2.Error)
+	if !ok {
+		oerr = oauth2.NewError(oauth2.ErrorServerError)
+	}
+
+	v := url.Values{}
+	v.Set("error", oerr.Type)
+	v.Set("state", state)
+	redirectURL.Fragment = ""
+
+	w.Header().Set("Location", redirectURL.String()+"#"+v.Encode())
+	w.WriteHeader(http.StatusFound)
+}
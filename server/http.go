@@ -2,11 +2,13 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,10 +19,13 @@ import (
 	"github.com/coreos/pkg/health"
 	"github.com/jonboulle/clockwork"
 
+	"github.com/coreos/dex/access"
 	"github.com/coreos/dex/client"
 	"github.com/coreos/dex/connector"
 	phttp "github.com/coreos/dex/pkg/http"
 	"github.com/coreos/dex/pkg/log"
+	"github.com/coreos/dex/session"
+	"github.com/coreos/dex/user"
 )
 
 const (
@@ -31,6 +36,9 @@ const (
 var (
 	httpPathDiscovery          = "/.well-known/openid-configuration"
 	httpPathToken              = "/token"
+	httpPathUserInfo           = "/userinfo"
+	httpPathRevoke             = "/revoke"
+	httpPathIntrospect         = "/introspect"
 	httpPathKeys               = "/keys"
 	httpPathAuth               = "/auth"
 	httpPathHealth             = "/health"
@@ -42,13 +50,87 @@ var (
 	httpPathResetPassword      = "/reset-password"
 	httpPathAcceptInvitation   = "/accept-invitation"
 	httpPathDebugVars          = "/debug/vars"
+	httpPathMetrics            = "/metrics"
 	httpPathClientRegistration = "/registration"
+	httpPathEndSession         = "/logout"
+	httpPathConsent            = "/consent"
+	httpPathAccount            = "/account"
+	httpPathAccountCallback    = "/account/callback"
+	httpPathLinkAccount        = "/link-account"
+	httpPathBrowserSession     = "/browser-session"
 
 	cookieLastSeen                 = "LastSeen"
 	cookieShowEmailVerifiedMessage = "ShowEmailVerifiedMessage"
+	cookieBrowserSession           = "BrowserSession"
+	cookiePendingBrowserSession    = "PendingBrowserSession"
+	cookieLinkAccount              = "LinkAccount"
 )
 
-func handleDiscoveryFunc(cfg oidc.ProviderConfig) http.HandlerFunc {
+// providerMetadata is the discovery document served by dex. It extends the
+// provider config go-oidc understands with the metadata of the endpoints
+// go-oidc doesn't know about.
+type providerMetadata struct {
+	oidc.ProviderConfig
+
+	// RFC 7009 and RFC 7662 endpoints, see RFC 8414 Section 2.
+	RevocationEndpoint               *url.URL
+	RevocationEndpointAuthMethods    []string
+	IntrospectionEndpoint            *url.URL
+	IntrospectionEndpointAuthMethods []string
+
+	// OpenID Connect RP-Initiated, Front-Channel and Back-Channel Logout.
+	EndSessionEndpoint          *url.URL
+	FrontChannelLogoutSupported bool
+	BackChannelLogoutSupported  bool
+}
+
+func (m *providerMetadata) MarshalJSON() ([]byte, error) {
+	b, err := json.Marshal(&m.ProviderConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	extra := struct {
+		RevocationEndpoint               string   `json:"revocation_endpoint,omitempty"`
+		RevocationEndpointAuthMethods    []string `json:"revocation_endpoint_auth_methods_supported,omitempty"`
+		IntrospectionEndpoint            string   `json:"introspection_endpoint,omitempty"`
+		IntrospectionEndpointAuthMethods []string `json:"introspection_endpoint_auth_methods_supported,omitempty"`
+		EndSessionEndpoint               string   `json:"end_session_endpoint,omitempty"`
+		FrontChannelLogoutSupported      bool     `json:"frontchannel_logout_supported,omitempty"`
+		BackChannelLogoutSupported       bool     `json:"backchannel_logout_supported,omitempty"`
+	}{
+		RevocationEndpoint:               uriToString(m.RevocationEndpoint),
+		RevocationEndpointAuthMethods:    m.RevocationEndpointAuthMethods,
+		IntrospectionEndpoint:            uriToString(m.IntrospectionEndpoint),
+		IntrospectionEndpointAuthMethods: m.IntrospectionEndpointAuthMethods,
+		EndSessionEndpoint:               uriToString(m.EndSessionEndpoint),
+		FrontChannelLogoutSupported:      m.FrontChannelLogoutSupported,
+		BackChannelLogoutSupported:       m.BackChannelLogoutSupported,
+	}
+	return spliceJSON(b, extra)
+}
+
+// spliceJSON adds the fields of extra to the JSON object b, keeping the order
+// of b's fields.
+func spliceJSON(b []byte, extra interface{}) ([]byte, error) {
+	e, err := json.Marshal(extra)
+	if err != nil {
+		return nil, err
+	}
+	if len(e) <= len("{}") {
+		return b, nil
+	}
+	return append(append(b[:len(b)-1], ','), e[1:]...), nil
+}
+
+func uriToString(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	return u.String()
+}
+
+func handleDiscoveryFunc(cfg providerMetadata) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "GET" {
 			w.Header().Set("Allow", "GET")
@@ -255,7 +337,9 @@ func renderLoginPage(w http.ResponseWriter, r *http.Request, srv OIDCServer, idp
 
 		v := r.URL.Query()
 		v.Set("connector_id", idpc.ID())
-		v.Set("response_type", "code")
+		if v.Get("response_type") == "" {
+			v.Set("response_type", oauth2.ResponseTypeCode)
+		}
 		link.URL = httpPathAuth + "?" + v.Encode()
 		td.Links = append(td.Links, link)
 	}
@@ -263,6 +347,23 @@ func renderLoginPage(w http.ResponseWriter, r *http.Request, srv OIDCServer, idp
 	execTemplate(w, tpl, td)
 }
 
+// containsResponseType reports whether responseType is equal to one of
+// the given response types, ignoring the order of space-separated values.
+func containsResponseType(responseTypes []string, responseType string) bool {
+	for _, rt := range responseTypes {
+		if oauth2.ResponseTypesEqual(rt, responseType) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleAuth serves the authorization endpoint with the connectors currently
+// in use.
+func (s *Server) handleAuth(w http.ResponseWriter, r *http.Request) {
+	handleAuthFunc(s, s.connectors(), s.LoginTemplate, s.EnableRegistration)(w, r)
+}
+
 func handleAuthFunc(srv OIDCServer, idpcs []connector.Connector, tpl *template.Template, registrationEnabled bool) http.HandlerFunc {
 	idx := makeConnectorMap(idpcs)
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -286,7 +387,12 @@ func handleAuthFunc(srv OIDCServer, idpcs []connector.Connector, tpl *template.T
 
 		connectorID := q.Get("connector_id")
 		idpc, ok := idx[connectorID]
-		if !ok {
+		prompt := strings.Fields(q.Get("prompt"))
+		promptNone := containsString(prompt, "none")
+		// Without a connector, the user chooses one on the login page, unless
+		// they can be logged in with their browser session.
+		bsCookie, _ := r.Cookie(cookieBrowserSession)
+		if !ok && !promptNone && bsCookie == nil {
 			renderLoginPage(w, r, srv, idpcs, register, tpl)
 			return
 		}
@@ -334,12 +440,45 @@ func handleAuthFunc(srv OIDCServer, idpcs []connector.Connector, tpl *template.T
 			}
 		}
 
-		if acr.ResponseType != oauth2.ResponseTypeCode {
+		if !containsResponseType(supportedResponseTypes, acr.ResponseType) {
 			log.Errorf("unexpected ResponseType: %v: ", acr.ResponseType)
 			redirectAuthError(w, oauth2.NewError(oauth2.ErrorUnsupportedResponseType), acr.State, redirectURL)
 			return
 		}
 
+		// Errors for implicit and hybrid response types must be returned in
+		// the fragment, as the client may never see the query.
+		authError := redirectAuthError
+		if acr.ResponseType != oauth2.ResponseTypeCode {
+			authError = fragmentRedirectAuthError
+		}
+
+		if !containsResponseType(cm.Defaults().ResponseTypes, acr.ResponseType) {
+			log.Errorf("Client %q is not registered for ResponseType: %v", acr.ClientID, acr.ResponseType)
+			authError(w, oauth2.NewError(oauth2.ErrorUnauthorizedClient), acr.State, redirectURL)
+			return
+		}
+
+		nonce := q.Get("nonce")
+		if acr.ResponseType != oauth2.ResponseTypeCode && nonce == "" {
+			log.Errorf("Invalid auth request: 'nonce' is required for ResponseType %v", acr.ResponseType)
+			authError(w, oauth2.NewError(oauth2.ErrorInvalidRequest), acr.State, redirectURL)
+			return
+		}
+
+		codeChallenge := q.Get("code_challenge")
+		codeChallengeMethod := q.Get("code_challenge_method")
+		if codeChallenge != "" {
+			if codeChallengeMethod == "" {
+				codeChallengeMethod = codeChallengeMethodPlain
+			}
+			if !validPKCEValue(codeChallenge) || (codeChallengeMethod != codeChallengeMethodPlain && codeChallengeMethod != codeChallengeMethodS256) {
+				log.Errorf("Invalid auth request: bad code challenge or unsupported method %q", codeChallengeMethod)
+				authError(w, oauth2.NewError(oauth2.ErrorInvalidRequest), acr.State, redirectURL)
+				return
+			}
+		}
+
 		// Check scopes.
 		var scopes []string
 		foundOpenIDScope := false
@@ -350,14 +489,20 @@ func handleAuthFunc(srv OIDCServer, idpcs []connector.Connector, tpl *template.T
 				scopes = append(scopes, scope)
 			case "offline_access":
 				// According to the spec, for offline_access scope, the client must
-				// use a response_type value that would result in an Authorization Code.
-				// Currently oauth2.ResponseTypeCode is the only supported response type,
-				// and it's been checked above, so we don't need to check it again here.
-				//
-				// TODO(yifan): Verify that 'consent' should be in 'prompt'.
+				// use a response_type value that would result in an Authorization Code,
+				// otherwise the scope is ignored. The user consents to it on the
+				// consent page like to any other scope.
+				if !containsResponseType(strings.Fields(acr.ResponseType), oauth2.ResponseTypeCode) {
+					log.Infof("Ignoring 'offline_access' scope for ResponseType %v", acr.ResponseType)
+					continue
+				}
 				scopes = append(scopes, scope)
 			default:
-				// Pass all other scopes.
+				// Unknown scopes are ignored, as the spec recommends.
+				if !containsScope(supportedScopes, scope) {
+					log.Debugf("Ignoring unsupported scope %q", scope)
+					continue
+				}
 				scopes = append(scopes, scope)
 			}
 		}
@@ -368,15 +513,128 @@ func handleAuthFunc(srv OIDCServer, idpcs []connector.Connector, tpl *template.T
 			return
 		}
 
-		nonce := q.Get("nonce")
+		claimsRequest, err := parseClaimsRequest(q.Get("claims"))
+		if err != nil {
+			log.Errorf("Invalid auth request: bad 'claims' parameter: %v", err)
+			authError(w, oauth2.NewError(oauth2.ErrorInvalidRequest), acr.State, redirectURL)
+			return
+		}
 
-		key, err := srv.NewSession(connectorID, acr.ClientID, acr.State, redirectURL, nonce, register, acr.Scope)
+		if promptNone && len(prompt) > 1 {
+			log.Errorf("Invalid auth request: 'prompt' combines 'none' with other values")
+			authError(w, oauth2.NewError(oauth2.ErrorInvalidRequest), acr.State, redirectURL)
+			return
+		}
+		maxAge := -1
+		if v := q.Get("max_age"); v != "" {
+			if maxAge, err = strconv.Atoi(v); err != nil || maxAge < 0 {
+				log.Errorf("Invalid auth request: bad 'max_age' %q", v)
+				authError(w, oauth2.NewError(oauth2.ErrorInvalidRequest), acr.State, redirectURL)
+				return
+			}
+		}
+
+		// The user's browser session logs them in without authenticating
+		// again, unless the client asks for a fresh authentication, the
+		// authentication is older than max_age or the client wants the user
+		// to use another connector.
+		var bs *session.BrowserSession
+		if bsCookie != nil && !containsString(prompt, "login") && !register {
+			bs, err = srv.BrowserSession(bsCookie.Value, acr.ClientID)
+			if err != nil {
+				log.Errorf("Error getting browser session: %v", err)
+				authError(w, err, acr.State, redirectURL)
+				return
+			}
+			if bs != nil {
+				_, known := idx[bs.ConnectorID]
+				tooOld := maxAge >= 0 && time.Since(bs.AuthTime) > time.Duration(maxAge)*time.Second
+				if !known || tooOld || (ok && connectorID != bs.ConnectorID) {
+					bs = nil
+				}
+			}
+		}
+		if bs == nil {
+			if promptNone {
+				authError(w, oauth2.NewError(errorLoginRequired), acr.State, redirectURL)
+				return
+			}
+			if !ok {
+				renderLoginPage(w, r, srv, idpcs, register, tpl)
+				return
+			}
+		} else {
+			connectorID = bs.ConnectorID
+		}
+
+		// Without interacting with the user, they can't be asked for their
+		// consent either.
+		if bs != nil && promptNone {
+			required, err := srv.ConsentRequired(bs.UserID, acr.ClientID, consentScopes(scopes, claimsRequest))
+			if err != nil {
+				log.Errorf("Error checking consent: %v", err)
+				authError(w, err, acr.State, redirectURL)
+				return
+			}
+			if required {
+				authError(w, oauth2.NewError(errorConsentRequired), acr.State, redirectURL)
+				return
+			}
+		}
+
+		key, err := srv.NewSession(session.SessionRequest{
+			ConnectorID:         connectorID,
+			ClientID:            acr.ClientID,
+			ClientState:         acr.State,
+			RedirectURL:         redirectURL,
+			Nonce:               nonce,
+			Register:            register,
+			Scope:               scopes,
+			ResponseType:        acr.ResponseType,
+			CodeChallenge:       codeChallenge,
+			CodeChallengeMethod: codeChallengeMethod,
+			ClaimsRequest:       claimsRequest,
+		})
 		if err != nil {
 			log.Errorf("Error creating new session: %v: ", err)
-			redirectAuthError(w, err, acr.State, redirectURL)
+			authError(w, err, acr.State, redirectURL)
+			return
+		}
+		if err := srv.SetSessionRemoteIP(key, phttp.RemoteIP(r)); err != nil {
+			log.Errorf("Error recording remote IP of session: %v", err)
+			authError(w, err, acr.State, redirectURL)
+			return
+		}
+		if containsString(prompt, "consent") {
+			if err := srv.SetSessionPromptConsent(key); err != nil {
+				log.Errorf("Error recording prompt of session: %v", err)
+				authError(w, err, acr.State, redirectURL)
+				return
+			}
+		}
+
+		if bs != nil {
+			ru, err := srv.BrowserLogin(bs, key)
+			if err != nil {
+				log.Errorf("Error logging in with browser session: %v", err)
+				authError(w, err, acr.State, redirectURL)
+				return
+			}
+			w.Header().Set("Location", ru)
+			w.WriteHeader(http.StatusFound)
 			return
 		}
 
+		token, expiresAt, err := srv.StartBrowserSession(key)
+		if err != nil {
+			log.Errorf("Error starting browser session: %v", err)
+			authError(w, err, acr.State, redirectURL)
+			return
+		}
+		if token != "" {
+			http.SetCookie(w, createPendingBrowserSessionCookie(token, expiresAt))
+		}
+
 		if register {
 			_, ok := idpc.(*connector.LocalConnector)
 			if ok {
@@ -396,10 +654,21 @@ func handleAuthFunc(srv OIDCServer, idpcs []connector.Connector, tpl *template.T
 		if shouldReprompt(r) || register {
 			p = "select_account"
 		}
-		lu, err := idpc.LoginURL(key, p)
+		var lu string
+		if apc, ok := idpc.(connector.AuthParamsConnector); ok {
+			params := url.Values{}
+			for _, name := range []string{"prompt", "login_hint", "acr_values"} {
+				if v := q.Get(name); v != "" {
+					params.Set(name, v)
+				}
+			}
+			lu, err = apc.LoginURLWithParams(key, p, params)
+		} else {
+			lu, err = idpc.LoginURL(key, p)
+		}
 		if err != nil {
 			log.Errorf("Connector.LoginURL failed: %v", err)
-			redirectAuthError(w, err, acr.State, redirectURL)
+			authError(w, err, acr.State, redirectURL)
 			return
 		}
 
@@ -426,33 +695,19 @@ func handleTokenFunc(srv OIDCServer) http.HandlerFunc {
 		}
 
 		state := r.PostForm.Get("state")
+		grantType := r.PostForm.Get("grant_type")
 
-		user, password, ok := r.BasicAuth()
-		if !ok {
-			log.Errorf("error parsing basic auth")
-			writeTokenError(w, oauth2.NewError(oauth2.ErrorInvalidClient), state)
-			return
-		}
-
-		decodedUser, err := url.QueryUnescape(user)
-		if err != nil {
-			log.Errorf("error decoding user: %v", err)
-			writeTokenError(w, oauth2.NewError(oauth2.ErrorInvalidClient), state)
-			return
-		}
-
-		decodedPassword, err := url.QueryUnescape(password)
+		// Public clients identify themselves without a secret; CodeToken
+		// only allows this for clients using PKCE, and RefreshToken for
+		// the refresh tokens issued to them.
+		creds, err := clientCredentialsFromRequest(r, grantType == oauth2.GrantTypeAuthCode || grantType == oauth2.GrantTypeRefreshToken)
 		if err != nil {
-			log.Errorf("error decoding password: %v", err)
+			log.Errorf("error parsing client credentials: %v", err)
 			writeTokenError(w, oauth2.NewError(oauth2.ErrorInvalidClient), state)
 			return
 		}
 
-		creds := oidc.ClientCredentials{ID: decodedUser, Secret: decodedPassword}
-
-		var jwt *jose.JWT
-		var refreshToken string
-		grantType := r.PostForm.Get("grant_type")
+		var tokens *IssuedTokens
 
 		switch grantType {
 		case oauth2.GrantTypeAuthCode:
@@ -462,26 +717,29 @@ func handleTokenFunc(srv OIDCServer) http.HandlerFunc {
 				writeTokenError(w, oauth2.NewError(oauth2.ErrorInvalidRequest), state)
 				return
 			}
-			jwt, refreshToken, err = srv.CodeToken(creds, code)
+			tokens, err = srv.CodeToken(creds, code, r.PostForm.Get("code_verifier"))
 			if err != nil {
 				log.Errorf("couldn't exchange code for token: %v", err)
 				writeTokenError(w, err, state)
 				return
 			}
 		case oauth2.GrantTypeClientCreds:
-			jwt, err = srv.ClientCredsToken(creds)
+			jwt, err := srv.ClientCredsToken(creds)
 			if err != nil {
 				log.Errorf("couldn't creds for token: %v", err)
 				writeTokenError(w, err, state)
 				return
 			}
+			// Client tokens are used as bearer tokens for dex's own APIs,
+			// which expect a JWT.
+			tokens = &IssuedTokens{IDToken: jwt, AccessToken: jwt.Encode()}
 		case oauth2.GrantTypeRefreshToken:
 			token := r.PostForm.Get("refresh_token")
 			if token == "" {
 				writeTokenError(w, oauth2.NewError(oauth2.ErrorInvalidRequest), state)
 				return
 			}
-			jwt, err = srv.RefreshToken(creds, token)
+			tokens, err = srv.RefreshToken(creds, token)
 			if err != nil {
 				writeTokenError(w, err, state)
 				return
@@ -493,10 +751,11 @@ func handleTokenFunc(srv OIDCServer) http.HandlerFunc {
 		}
 
 		t := oAuth2Token{
-			AccessToken:  jwt.Encode(),
-			IDToken:      jwt.Encode(),
+			AccessToken:  tokens.AccessToken,
+			IDToken:      tokens.IDToken.Encode(),
 			TokenType:    "bearer",
-			RefreshToken: refreshToken,
+			ExpiresIn:    int(tokens.AccessTokenExpiresIn.Seconds()),
+			RefreshToken: tokens.RefreshToken,
 		}
 
 		b, err := json.Marshal(t)
@@ -522,9 +781,96 @@ type oAuth2Token struct {
 	AccessToken  string `json:"access_token"`
 	IDToken      string `json:"id_token"`
 	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in,omitempty"`
 	RefreshToken string `json:"refresh_token,omitempty"`
 }
 
+// clientCredentialsFromRequest reads the credentials a client presents to the
+// token, revocation and introspection endpoints using the Basic HTTP
+// authentication scheme. If allowClientID is set, clients without a secret
+// may instead identify themselves with the client_id form field; it is up to
+// the caller to decide whether such a public client is acceptable.
+// The request's form must already have been parsed.
+func clientCredentialsFromRequest(r *http.Request, allowClientID bool) (oidc.ClientCredentials, error) {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		if !allowClientID || r.PostForm.Get("client_id") == "" {
+			return oidc.ClientCredentials{}, errors.New("missing basic auth")
+		}
+		return oidc.ClientCredentials{ID: r.PostForm.Get("client_id")}, nil
+	}
+
+	decodedUser, err := url.QueryUnescape(user)
+	if err != nil {
+		return oidc.ClientCredentials{}, fmt.Errorf("error decoding user: %v", err)
+	}
+
+	decodedPassword, err := url.QueryUnescape(password)
+	if err != nil {
+		return oidc.ClientCredentials{}, fmt.Errorf("error decoding password: %v", err)
+	}
+
+	return oidc.ClientCredentials{ID: decodedUser, Secret: decodedPassword}, nil
+}
+
+func handleUserInfoFunc(atRepo access.AccessTokenRepo, userRepo user.UserRepo, groupRepo user.GroupRepo) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "POST" {
+			w.Header().Set("Allow", "GET, POST")
+			phttp.WriteError(w, http.StatusMethodNotAllowed, "GET or POST only acceptable methods")
+			return
+		}
+
+		token, err := oidc.ExtractBearerToken(r)
+		if err != nil {
+			log.Errorf("Failed to extract bearer token: %v", err)
+			writeBearerTokenError(w, http.StatusUnauthorized, "")
+			return
+		}
+
+		at, err := atRepo.Get(token)
+		if err != nil {
+			if err != access.ErrorInvalidToken {
+				log.Errorf("Failed to fetch access token: %v", err)
+			}
+			writeBearerTokenError(w, http.StatusUnauthorized, errorInvalidToken)
+			return
+		}
+
+		var openid bool
+		for _, scope := range at.Scope {
+			if scope == "openid" {
+				openid = true
+				break
+			}
+		}
+		if !openid {
+			writeBearerTokenError(w, http.StatusForbidden, errorInsufficientScope)
+			return
+		}
+
+		usr, err := userRepo.Get(nil, at.UserID)
+		if err != nil || usr.Disabled {
+			if err != nil && err != user.ErrorNotFound {
+				log.Errorf("Failed to fetch user %q from repo: %v", at.UserID, err)
+			}
+			writeBearerTokenError(w, http.StatusUnauthorized, errorInvalidToken)
+			return
+		}
+
+		claims := jose.Claims{"sub": usr.ID}
+		usr.AddScopedClaims(claims, at.Scope, at.Claims)
+		if err := addGroupsClaim(groupRepo, claims, usr.ID, at.Scope, at.Claims); err != nil {
+			log.Errorf("Failed to fetch groups of user %q: %v", usr.ID, err)
+			writeAPIError(w, http.StatusInternalServerError, newAPIError(errorServerError, ""))
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		writeResponseWithBody(w, http.StatusOK, claims)
+	}
+}
+
 func createLastSeenCookie() *http.Cookie {
 	now := time.Now()
 	return &http.Cookie{
@@ -536,6 +882,30 @@ func createLastSeenCookie() *http.Cookie {
 	}
 }
 
+// createBrowserSessionCookie returns the cookie holding the token of the
+// user-agent's browser session.
+func createBrowserSessionCookie(token string, expiresAt time.Time) *http.Cookie {
+	return &http.Cookie{
+		HttpOnly: true,
+		Name:     cookieBrowserSession,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(expiresAt.Sub(time.Now()).Seconds()),
+		// For old IE, ignored by most browsers.
+		Expires: expiresAt,
+	}
+}
+
+// createPendingBrowserSessionCookie returns the cookie holding the token of
+// the browser session of a login in progress, which is only sent to
+// httpPathBrowserSession once the login completes.
+func createPendingBrowserSessionCookie(token string, expiresAt time.Time) *http.Cookie {
+	c := createBrowserSessionCookie(token, expiresAt)
+	c.Name = cookiePendingBrowserSession
+	c.Path = httpPathBrowserSession
+	return c
+}
+
 // shouldReprompt determines if user should be re-prompted for login based on existence of a cookie.
 func shouldReprompt(r *http.Request) bool {
 	_, err := r.Cookie(cookieLastSeen)
@@ -16,14 +16,17 @@ import (
 
 	"github.com/jonboulle/clockwork"
 
+	"github.com/coreos/dex/access"
 	"github.com/coreos/dex/client"
 	clientmanager "github.com/coreos/dex/client/manager"
 	"github.com/coreos/dex/connector"
 	"github.com/coreos/dex/db"
+	"github.com/coreos/dex/session"
 	"github.com/coreos/dex/session/manager"
 	"github.com/coreos/go-oidc/jose"
 	"github.com/coreos/go-oidc/oauth2"
 	"github.com/coreos/go-oidc/oidc"
+	"github.com/kylelemons/godebug/pretty"
 )
 
 type fakeConnector struct {
@@ -52,6 +55,16 @@ func (c *fakeConnector) TrustedEmailProvider() bool {
 	return false
 }
 
+type fakeAuthParamsConnector struct {
+	fakeConnector
+	params url.Values
+}
+
+func (f *fakeAuthParamsConnector) LoginURLWithParams(sessionKey, prompt string, params url.Values) (string, error) {
+	f.params = params
+	return f.loginURL, nil
+}
+
 func TestHandleAuthFuncMethodNotAllowed(t *testing.T) {
 	for _, m := range []string{"POST", "PUT", "DELETE"} {
 		hdlr := handleAuthFunc(nil, nil, nil, true)
@@ -89,6 +102,18 @@ func TestHandleAuthFuncResponsesSingleRedirectURL(t *testing.T) {
 				},
 			},
 		},
+		client.Client{
+			Credentials: oidc.ClientCredentials{
+				ID:     "implicit.example.com",
+				Secret: base64.URLEncoding.EncodeToString([]byte("secret")),
+			},
+			Metadata: oidc.ClientMetadata{
+				RedirectURIs: []url.URL{
+					url.URL{Scheme: "http", Host: "implicit.example.com", Path: "/callback"},
+				},
+				ResponseTypes: []string{"id_token", "code id_token"},
+			},
+		},
 	}
 
 	clientIDGenerator := func(hostport string) (string, error) {
@@ -175,6 +200,73 @@ func TestHandleAuthFuncResponsesSingleRedirectURL(t *testing.T) {
 			wantLocation: "http://client.example.com/callback?error=unsupported_response_type&state=",
 		},
 
+		// response type the client is not registered for, redirects back to client with error in fragment
+		{
+			query: url.Values{
+				"response_type": []string{"id_token"},
+				"client_id":     []string{"client.example.com"},
+				"connector_id":  []string{"fake"},
+				"scope":         []string{"openid"},
+				"nonce":         []string{"noncey"},
+			},
+			wantCode:     http.StatusFound,
+			wantLocation: "http://client.example.com/callback#error=unauthorized_client&state=",
+		},
+
+		// implicit response type without nonce, redirects back to client with error in fragment
+		{
+			query: url.Values{
+				"response_type": []string{"id_token"},
+				"client_id":     []string{"implicit.example.com"},
+				"connector_id":  []string{"fake"},
+				"scope":         []string{"openid"},
+				"state":         []string{"foo"},
+			},
+			wantCode:     http.StatusFound,
+			wantLocation: "http://implicit.example.com/callback#error=invalid_request&state=foo",
+		},
+
+		// unsupported code challenge method, redirects back to client
+		{
+			query: url.Values{
+				"response_type":         []string{"code"},
+				"client_id":             []string{"client.example.com"},
+				"connector_id":          []string{"fake"},
+				"scope":                 []string{"openid"},
+				"code_challenge":        []string{"E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"},
+				"code_challenge_method": []string{"S512"},
+			},
+			wantCode:     http.StatusFound,
+			wantLocation: "http://client.example.com/callback?error=invalid_request&state=",
+		},
+
+		// valid code challenge
+		{
+			query: url.Values{
+				"response_type":         []string{"code"},
+				"client_id":             []string{"client.example.com"},
+				"connector_id":          []string{"fake"},
+				"scope":                 []string{"openid"},
+				"code_challenge":        []string{"E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"},
+				"code_challenge_method": []string{"S256"},
+			},
+			wantCode:     http.StatusFound,
+			wantLocation: "http://fake.example.com",
+		},
+
+		// hybrid response type with nonce, in any order
+		{
+			query: url.Values{
+				"response_type": []string{"id_token code"},
+				"client_id":     []string{"implicit.example.com"},
+				"connector_id":  []string{"fake"},
+				"scope":         []string{"openid"},
+				"nonce":         []string{"noncey"},
+			},
+			wantCode:     http.StatusFound,
+			wantLocation: "http://fake.example.com",
+		},
+
 		// no 'openid' in scope
 		{
 			query: url.Values{
@@ -185,6 +277,32 @@ func TestHandleAuthFuncResponsesSingleRedirectURL(t *testing.T) {
 			},
 			wantCode: http.StatusBadRequest,
 		},
+		// claims requested individually, along with an unknown scope
+		{
+			query: url.Values{
+				"response_type": []string{"code"},
+				"redirect_uri":  []string{"http://client.example.com/callback"},
+				"client_id":     []string{"client.example.com"},
+				"connector_id":  []string{"fake"},
+				"scope":         []string{"openid email unknown"},
+				"claims":        []string{`{"id_token":{"name":{"essential":true}}}`},
+			},
+			wantCode:     http.StatusFound,
+			wantLocation: "http://fake.example.com",
+		},
+		// malformed claims request
+		{
+			query: url.Values{
+				"response_type": []string{"code"},
+				"redirect_uri":  []string{"http://client.example.com/callback"},
+				"client_id":     []string{"client.example.com"},
+				"connector_id":  []string{"fake"},
+				"scope":         []string{"openid"},
+				"claims":        []string{`{"id_token":["name"]}`},
+			},
+			wantCode:     http.StatusFound,
+			wantLocation: "http://client.example.com/callback?error=invalid_request&state=",
+		},
 		// empty response_type
 		{
 			query: url.Values{
@@ -351,6 +469,71 @@ func TestHandleAuthFuncResponsesMultipleRedirectURLs(t *testing.T) {
 	}
 }
 
+func TestHandleAuthFuncForwardsParams(t *testing.T) {
+	idpc := &fakeAuthParamsConnector{fakeConnector: fakeConnector{loginURL: "http://fake.example.com"}}
+	dbm := db.NewMemDB()
+	clients := []client.Client{
+		client.Client{
+			Credentials: oidc.ClientCredentials{
+				ID:     "client.example.com",
+				Secret: base64.URLEncoding.EncodeToString([]byte("secret")),
+			},
+			Metadata: oidc.ClientMetadata{
+				RedirectURIs: []url.URL{
+					url.URL{Scheme: "http", Host: "client.example.com", Path: "/callback"},
+				},
+			},
+		},
+	}
+	clientIDGenerator := func(hostport string) (string, error) {
+		return hostport, nil
+	}
+	secGen := func() ([]byte, error) {
+		return []byte("secret"), nil
+	}
+	clientRepo := db.NewClientRepo(dbm)
+	clientManager, err := clientmanager.NewClientManagerFromClients(clientRepo, db.TransactionFactory(dbm), clients, clientmanager.ManagerOptions{ClientIDGenerator: clientIDGenerator, SecretGenerator: secGen})
+	if err != nil {
+		t.Fatalf("Failed to create client identity manager: %v", err)
+	}
+	srv := &Server{
+		IssuerURL:      url.URL{Scheme: "http", Host: "server.example.com"},
+		SessionManager: manager.NewSessionManager(db.NewSessionRepo(db.NewMemDB()), db.NewSessionKeyRepo(db.NewMemDB())),
+		ClientRepo:     clientRepo,
+		ClientManager:  clientManager,
+	}
+
+	query := url.Values{
+		"response_type": {"code"},
+		"client_id":     {"client.example.com"},
+		"connector_id":  {"fake"},
+		"scope":         {"openid"},
+		"prompt":        {"login"},
+		"login_hint":    {"elroy@example.com"},
+		"acr_values":    {"mfa"},
+		"display":       {"popup"},
+	}
+	hdlr := handleAuthFunc(srv, []connector.Connector{idpc}, nil, true)
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "http://server.example.com?"+query.Encode(), nil)
+	if err != nil {
+		t.Fatalf("unable to form HTTP request: %v", err)
+	}
+	hdlr.ServeHTTP(w, req)
+	if w.Code != http.StatusFound {
+		t.Fatalf("HTTP code mismatch: want=%d got=%d", http.StatusFound, w.Code)
+	}
+
+	want := url.Values{
+		"prompt":     {"login"},
+		"login_hint": {"elroy@example.com"},
+		"acr_values": {"mfa"},
+	}
+	if diff := pretty.Compare(want, idpc.params); diff != "" {
+		t.Errorf("Compare(want, got) = %v", diff)
+	}
+}
+
 func TestHandleTokenFunc(t *testing.T) {
 
 	fx, err := makeTestFixtures()
@@ -407,6 +590,17 @@ func TestHandleTokenFunc(t *testing.T) {
 			wantCode: http.StatusUnauthorized,
 		},
 
+		// no basic auth, client ID of a client that isn't public
+		{
+			query: url.Values{
+				"grant_type":    []string{"authorization_code"},
+				"code":          []string{"code-2"},
+				"client_id":     []string{testClientID},
+				"code_verifier": []string{"dBjftJeZ4CVP-mJ92K9c_bOL0ZQ1Nq5kPZ6e1TqjWgA"},
+			},
+			wantCode: http.StatusUnauthorized,
+		},
+
 		// bad code
 		{
 			query: url.Values{
@@ -440,16 +634,25 @@ func TestHandleTokenFunc(t *testing.T) {
 			continue
 		}
 		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-		req.SetBasicAuth(tt.user, tt.passwd)
+		if tt.user != "" {
+			req.SetBasicAuth(tt.user, tt.passwd)
+		}
 
 		// need to create session in order to exchange the code (generated by the NewSessionKey func) for token
 		setSession := func() error {
-			sid, err := fx.sessionManager.NewSession("local", testClientID, "", testRedirectURL, "", true, []string{"openid"})
+			sid, err := fx.sessionManager.NewSession(session.SessionRequest{
+				ConnectorID:  "local",
+				ClientID:     testClientID,
+				RedirectURL:  testRedirectURL,
+				Register:     true,
+				Scope:        []string{"openid"},
+				ResponseType: "code",
+			})
 			if err != nil {
 				return fmt.Errorf("case %d: cannot create session, error=%v", i, err)
 			}
 
-			_, err = fx.sessionManager.AttachRemoteIdentity(sid, oidc.Identity{})
+			_, err = fx.sessionManager.AttachRemoteIdentity(sid, oidc.Identity{}, nil)
 			if err != nil {
 				return fmt.Errorf("case %d: cannot attach remoteID, error=%v", i, err)
 			}
@@ -529,9 +732,165 @@ func TestHandleTokenFuncState(t *testing.T) {
 	}
 }
 
+func TestHandleUserInfoFuncMethodNotAllowed(t *testing.T) {
+	for _, m := range []string{"PUT", "DELETE"} {
+		hdlr := handleUserInfoFunc(nil, nil, nil)
+		req, err := http.NewRequest(m, "http://example.com", nil)
+		if err != nil {
+			t.Errorf("case %s: unable to create HTTP request: %v", m, err)
+			continue
+		}
+
+		w := httptest.NewRecorder()
+		hdlr.ServeHTTP(w, req)
+
+		want := http.StatusMethodNotAllowed
+		got := w.Code
+		if want != got {
+			t.Errorf("case %s: expected HTTP %d, got %d", m, want, got)
+		}
+	}
+}
+
+func TestHandleUserInfoFunc(t *testing.T) {
+	fx, err := makeTestFixtures()
+	if err != nil {
+		t.Fatalf("could not run test fixtures: %v", err)
+	}
+
+	now := time.Now()
+	newToken := func(userID string, scope, claims []string, exp time.Time) string {
+		token, err := fx.srv.AccessTokenRepo.Create(access.AccessToken{
+			UserID:    userID,
+			ClientID:  testClientID,
+			Scope:     scope,
+			Claims:    claims,
+			CreatedAt: now,
+			ExpiresAt: exp,
+		})
+		if err != nil {
+			t.Fatalf("unable to create access token: %v", err)
+		}
+		return token
+	}
+
+	tests := []struct {
+		authorization string
+		wantCode      int
+		wantError     string
+		wantClaims    jose.Claims
+	}{
+		// OK
+		{
+			authorization: "Bearer " + newToken("ID-Verified", []string{"openid", "profile", "email"}, nil, now.Add(time.Hour)),
+			wantCode:      http.StatusOK,
+			wantClaims: jose.Claims{
+				"sub":            "ID-Verified",
+				"name":           "",
+				"email":          "email-verified@example.com",
+				"email_verified": true,
+			},
+		},
+		// claims are released by scope
+		{
+			authorization: "Bearer " + newToken("ID-Verified", []string{"openid", "email"}, nil, now.Add(time.Hour)),
+			wantCode:      http.StatusOK,
+			wantClaims: jose.Claims{
+				"sub":            "ID-Verified",
+				"email":          "email-verified@example.com",
+				"email_verified": true,
+			},
+		},
+		{
+			authorization: "Bearer " + newToken("ID-Verified", []string{"openid"}, nil, now.Add(time.Hour)),
+			wantCode:      http.StatusOK,
+			wantClaims: jose.Claims{
+				"sub": "ID-Verified",
+			},
+		},
+		// or requested individually
+		{
+			authorization: "Bearer " + newToken("ID-Verified", []string{"openid"}, []string{"email", "picture"}, now.Add(time.Hour)),
+			wantCode:      http.StatusOK,
+			wantClaims: jose.Claims{
+				"sub":   "ID-Verified",
+				"email": "email-verified@example.com",
+			},
+		},
+		// no token
+		{
+			wantCode: http.StatusUnauthorized,
+		},
+		// unknown token
+		{
+			authorization: "Bearer bogus",
+			wantCode:      http.StatusUnauthorized,
+			wantError:     "invalid_token",
+		},
+		// expired token
+		{
+			authorization: "Bearer " + newToken("ID-Verified", []string{"openid"}, nil, now.Add(-time.Minute)),
+			wantCode:      http.StatusUnauthorized,
+			wantError:     "invalid_token",
+		},
+		// token for a user that doesn't exist
+		{
+			authorization: "Bearer " + newToken("ID-Unknown", []string{"openid"}, nil, now.Add(time.Hour)),
+			wantCode:      http.StatusUnauthorized,
+			wantError:     "invalid_token",
+		},
+		// token not granted the openid scope
+		{
+			authorization: "Bearer " + newToken("ID-Verified", []string{"email"}, nil, now.Add(time.Hour)),
+			wantCode:      http.StatusForbidden,
+			wantError:     "insufficient_scope",
+		},
+	}
+
+	for i, tt := range tests {
+		hdlr := handleUserInfoFunc(fx.srv.AccessTokenRepo, fx.userRepo, fx.srv.GroupRepo)
+		req, err := http.NewRequest("GET", "http://example.com/userinfo", nil)
+		if err != nil {
+			t.Errorf("case %d: unable to create HTTP request: %v", i, err)
+			continue
+		}
+		if tt.authorization != "" {
+			req.Header.Set("Authorization", tt.authorization)
+		}
+
+		w := httptest.NewRecorder()
+		hdlr.ServeHTTP(w, req)
+
+		if tt.wantCode != w.Code {
+			t.Errorf("case %d: expected HTTP %d, got %d", i, tt.wantCode, w.Code)
+			continue
+		}
+
+		if tt.wantCode != http.StatusOK {
+			wantHeader := "Bearer"
+			if tt.wantError != "" {
+				wantHeader = fmt.Sprintf("Bearer error=%q", tt.wantError)
+			}
+			if got := w.Header().Get("WWW-Authenticate"); got != wantHeader {
+				t.Errorf("case %d: expected WWW-Authenticate %q, got %q", i, wantHeader, got)
+			}
+			continue
+		}
+
+		var claims jose.Claims
+		if err := json.Unmarshal(w.Body.Bytes(), &claims); err != nil {
+			t.Errorf("case %d: unable to unmarshal claims: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(tt.wantClaims, claims) {
+			t.Errorf("case %d: want claims=%v, got=%v", i, tt.wantClaims, claims)
+		}
+	}
+}
+
 func TestHandleDiscoveryFuncMethodNotAllowed(t *testing.T) {
 	for _, m := range []string{"POST", "PUT", "DELETE"} {
-		hdlr := handleDiscoveryFunc(oidc.ProviderConfig{})
+		hdlr := handleDiscoveryFunc(providerMetadata{})
 		req, err := http.NewRequest(m, "http://example.com", nil)
 		if err != nil {
 			t.Errorf("case %s: unable to create HTTP request: %v", m, err)
@@ -575,7 +934,7 @@ func TestHandleDiscoveryFunc(t *testing.T) {
 	}
 
 	w := httptest.NewRecorder()
-	hdlr := handleDiscoveryFunc(cfg)
+	hdlr := handleDiscoveryFunc(providerMetadata{ProviderConfig: cfg})
 	hdlr.ServeHTTP(w, req)
 
 	if w.Code != http.StatusOK {
@@ -601,6 +960,46 @@ func TestHandleDiscoveryFunc(t *testing.T) {
 	}
 }
 
+func TestProviderMetadataMarshalJSON(t *testing.T) {
+	srv := &Server{IssuerURL: url.URL{Scheme: "http", Host: "server.example.com"}}
+	md := srv.providerMetadata()
+
+	b, err := json.Marshal(&md)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := map[string]interface{}{
+		"issuer":                 "http://server.example.com",
+		"token_endpoint":         "http://server.example.com/token",
+		"revocation_endpoint":    "http://server.example.com/revoke",
+		"introspection_endpoint": "http://server.example.com/introspect",
+		"end_session_endpoint":   "http://server.example.com/logout",
+
+		"frontchannel_logout_supported": true,
+		"backchannel_logout_supported":  true,
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("Incorrect %s: want=%v got=%v", k, v, got[k])
+		}
+	}
+
+	// The document must still be understood by go-oidc.
+	var cfg oidc.ProviderConfig
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := pretty.Compare(srv.ProviderConfig(), cfg); diff != "" {
+		t.Errorf("Compare(want, got) = %v", diff)
+	}
+}
+
 func TestHandleKeysFuncMethodNotAllowed(t *testing.T) {
 	for _, m := range []string{"POST", "PUT", "DELETE"} {
 		hdlr := handleKeysFunc(nil, clockwork.NewRealClock())
@@ -0,0 +1,235 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/coreos/go-oidc/jose"
+	"github.com/coreos/go-oidc/oauth2"
+	"github.com/coreos/go-oidc/oidc"
+
+	"github.com/coreos/dex/access"
+	phttp "github.com/coreos/dex/pkg/http"
+	"github.com/coreos/dex/pkg/log"
+	"github.com/coreos/dex/refresh"
+	"github.com/coreos/dex/user"
+)
+
+// TokenIntrospection describes a token presented to the introspection
+// endpoint, RFC 7662 Section 2.2. Inactive tokens are described by Active
+// alone.
+type TokenIntrospection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	Audience  string `json:"aud,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+}
+
+var inactiveToken = &TokenIntrospection{Active: false}
+
+// IntrospectToken describes an access token, refresh token or ID token issued
+// by dex. Only confidential clients may introspect tokens. Access tokens and
+// ID tokens are typically presented by a resource server on behalf of another
+// client, so they are described to any client; refresh tokens only to the
+// client they were issued to.
+func (s *Server) IntrospectToken(creds oidc.ClientCredentials, token string) (*TokenIntrospection, error) {
+	if err := s.authenticateClient(creds, false); err != nil {
+		return nil, err
+	}
+
+	switch classifyToken(token) {
+	case tokenKindRefresh:
+		return s.introspectRefreshToken(creds, token)
+	case tokenKindJWT:
+		return s.introspectJWT(token)
+	default:
+		return s.introspectAccessToken(token)
+	}
+}
+
+func (s *Server) introspectAccessToken(token string) (*TokenIntrospection, error) {
+	at, err := s.AccessTokenRepo.Get(token)
+	switch err {
+	case nil:
+	case access.ErrorInvalidToken:
+		return inactiveToken, nil
+	default:
+		log.Errorf("Failed to fetch access token: %v", err)
+		return nil, oauth2.NewError(oauth2.ErrorServerError)
+	}
+
+	if active, err := s.userActive(at.UserID); err != nil {
+		return nil, err
+	} else if !active {
+		return inactiveToken, nil
+	}
+
+	return &TokenIntrospection{
+		Active:    true,
+		Scope:     strings.Join(at.Scope, " "),
+		ClientID:  at.ClientID,
+		TokenType: "bearer",
+		ExpiresAt: at.ExpiresAt.Unix(),
+		IssuedAt:  at.CreatedAt.Unix(),
+		Subject:   at.UserID,
+		Audience:  at.Audience,
+		Issuer:    s.IssuerURL.String(),
+	}, nil
+}
+
+func (s *Server) introspectRefreshToken(creds oidc.ClientCredentials, token string) (*TokenIntrospection, error) {
+	userID, err := s.RefreshTokenRepo.Verify(creds.ID, token)
+	switch err {
+	case nil:
+	case refresh.ErrorInvalidToken, refresh.ErrorInvalidClientID:
+		return inactiveToken, nil
+	default:
+		log.Errorf("Failed to verify refresh token: %v", err)
+		return nil, oauth2.NewError(oauth2.ErrorServerError)
+	}
+
+	if active, err := s.userActive(userID); err != nil {
+		return nil, err
+	} else if !active {
+		return inactiveToken, nil
+	}
+
+	return &TokenIntrospection{
+		Active:   true,
+		ClientID: creds.ID,
+		Subject:  userID,
+		Issuer:   s.IssuerURL.String(),
+	}, nil
+}
+
+func (s *Server) introspectJWT(token string) (*TokenIntrospection, error) {
+	jwt, err := jose.ParseJWT(token)
+	if err != nil {
+		return inactiveToken, nil
+	}
+	claims, err := jwt.Claims()
+	if err != nil {
+		return inactiveToken, nil
+	}
+	aud, ok, err := claims.StringClaim("aud")
+	if err != nil || !ok {
+		return inactiveToken, nil
+	}
+
+	if !isIDToken(claims, s.IssuerURL.String()) {
+		return inactiveToken, nil
+	}
+
+	verifier := s.JWTVerifierFactory()(aud)
+	if err := verifier.Verify(jwt); err != nil {
+		log.Debugf("Introspected JWT failed verification: %v", err)
+		return inactiveToken, nil
+	}
+
+	ti := &TokenIntrospection{
+		Active:   true,
+		ClientID: aud,
+		Audience: aud,
+		Issuer:   s.IssuerURL.String(),
+	}
+	ti.Subject, _, _ = claims.StringClaim("sub")
+	if exp, ok, err := claims.TimeClaim("exp"); err == nil && ok {
+		ti.ExpiresAt = exp.Unix()
+	}
+	if iat, ok, err := claims.TimeClaim("iat"); err == nil && ok {
+		ti.IssuedAt = iat.Unix()
+	}
+	return ti, nil
+}
+
+// emailLinkClaims are the claims of the tokens dex sends users in emails.
+var emailLinkClaims = []string{
+	user.ClaimPasswordResetPassword,
+	user.ClaimPasswordResetCallback,
+	user.ClaimEmailVerificationEmail,
+	user.ClaimEmailVerificationCallback,
+	user.ClaimInvitationCallback,
+	user.ClaimAccountLinkConnectorID,
+	user.ClaimAccountLinkRemoteID,
+}
+
+// isIDToken reports whether the claims are those of an ID token, as opposed
+// to the other JWTs dex signs with the same keys: browser session tokens,
+// which are typed and meant for dex itself, logout tokens, which carry
+// events, and the tokens of email links.
+func isIDToken(claims jose.Claims, issuer string) bool {
+	if _, ok := claims["typ"]; ok {
+		return false
+	}
+	if _, ok := claims["events"]; ok {
+		return false
+	}
+	if aud, _, _ := claims.StringClaim("aud"); aud == issuer {
+		return false
+	}
+	for _, name := range emailLinkClaims {
+		if _, ok := claims[name]; ok {
+			return false
+		}
+	}
+	return true
+}
+
+// userActive reports whether the user a token was issued on behalf of still
+// exists and is enabled.
+func (s *Server) userActive(userID string) (bool, error) {
+	usr, err := s.UserRepo.Get(nil, userID)
+	switch err {
+	case nil:
+		return !usr.Disabled, nil
+	case user.ErrorNotFound:
+		return false, nil
+	default:
+		log.Errorf("Failed to fetch user %q from repo: %v", userID, err)
+		return false, oauth2.NewError(oauth2.ErrorServerError)
+	}
+}
+
+func handleIntrospectFunc(srv OIDCServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.Header().Set("Allow", "POST")
+			phttp.WriteError(w, http.StatusMethodNotAllowed, "POST only acceptable method")
+			return
+		}
+
+		err := r.ParseForm()
+		if err != nil {
+			log.Errorf("error parsing request: %v", err)
+			writeTokenError(w, oauth2.NewError(oauth2.ErrorInvalidRequest), "")
+			return
+		}
+
+		creds, err := clientCredentialsFromRequest(r, false)
+		if err != nil {
+			log.Errorf("error parsing client credentials: %v", err)
+			writeTokenError(w, oauth2.NewError(oauth2.ErrorInvalidClient), "")
+			return
+		}
+
+		token := r.PostForm.Get("token")
+		if token == "" {
+			writeTokenError(w, oauth2.NewError(oauth2.ErrorInvalidRequest), "")
+			return
+		}
+
+		ti, err := srv.IntrospectToken(creds, token)
+		if err != nil {
+			writeTokenError(w, err, "")
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		writeResponseWithBody(w, http.StatusOK, ti)
+	}
+}
@@ -0,0 +1,252 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc/jose"
+	"github.com/coreos/go-oidc/oauth2"
+	"github.com/coreos/go-oidc/oidc"
+	"github.com/kylelemons/godebug/pretty"
+
+	"github.com/coreos/dex/user"
+)
+
+func TestServerIntrospectToken(t *testing.T) {
+	fx := makeTokenTestFixtures(t)
+	issuer := fx.srv.IssuerURL.String()
+
+	jwt, err := fx.srv.ClientCredsToken(testOtherCreds)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	accessToken := newTestAccessToken(t, fx, testOtherCreds.ID)
+	refreshToken := newTestRefreshToken(t, fx, testOtherCreds.ID)
+
+	// Other JWTs dex signs aren't described, even if they'd verify as ID
+	// tokens of a client.
+	signer, err := fx.srv.KeyManager.Signer()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	now := time.Now()
+	otherJWT := func(aud string, extra jose.Claims) string {
+		claims := oidc.NewClaims(issuer, "ID-Verified", aud, now, now.Add(time.Hour))
+		for k, v := range extra {
+			claims[k] = v
+		}
+		jwt, err := jose.NewSignedJWT(claims, signer)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return jwt.Encode()
+	}
+	browserSessionToken, err := fx.srv.browserSessionToken("bs-id", now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		creds   oidc.ClientCredentials
+		token   string
+		want    *TokenIntrospection
+		wantErr string
+	}{
+		// access tokens are described to any client
+		{
+			creds: testCreds,
+			token: accessToken,
+			want: &TokenIntrospection{
+				Active:    true,
+				Scope:     "openid",
+				ClientID:  testOtherCreds.ID,
+				TokenType: "bearer",
+				Subject:   "ID-Verified",
+				Audience:  issuer,
+				Issuer:    issuer,
+			},
+		},
+		{
+			creds: testCreds,
+			token: jwt.Encode(),
+			want: &TokenIntrospection{
+				Active:   true,
+				ClientID: testOtherCreds.ID,
+				Subject:  testOtherCreds.ID,
+				Audience: testOtherCreds.ID,
+				Issuer:   issuer,
+			},
+		},
+		// refresh tokens only to the client holding them
+		{
+			creds: testOtherCreds,
+			token: refreshToken,
+			want: &TokenIntrospection{
+				Active:   true,
+				ClientID: testOtherCreds.ID,
+				Subject:  "ID-Verified",
+				Issuer:   issuer,
+			},
+		},
+		{
+			creds: testCreds,
+			token: refreshToken,
+			want:  inactiveToken,
+		},
+		{
+			creds: testCreds,
+			token: "bogus",
+			want:  inactiveToken,
+		},
+		{
+			creds: testCreds,
+			token: jwt.Encode() + "bogus",
+			want:  inactiveToken,
+		},
+		// JWTs which aren't ID tokens
+		{
+			creds: testCreds,
+			token: browserSessionToken,
+			want:  inactiveToken,
+		},
+		{
+			creds: testCreds,
+			token: otherJWT(testOtherCreds.ID, jose.Claims{"typ": browserSessionTokenType}),
+			want:  inactiveToken,
+		},
+		{
+			creds: testCreds,
+			token: otherJWT(testOtherCreds.ID, jose.Claims{"events": map[string]interface{}{backChannelLogoutEvent: map[string]interface{}{}}}),
+			want:  inactiveToken,
+		},
+		{
+			creds: testCreds,
+			token: otherJWT(issuer, nil),
+			want:  inactiveToken,
+		},
+		{
+			creds: testCreds,
+			token: otherJWT(testOtherCreds.ID, jose.Claims{user.ClaimPasswordResetPassword: "hash"}),
+			want:  inactiveToken,
+		},
+		// public clients can't introspect tokens
+		{
+			creds:   testPublicCreds,
+			token:   accessToken,
+			wantErr: oauth2.ErrorInvalidClient,
+		},
+		{
+			creds:   oidc.ClientCredentials{ID: testClientID, Secret: "bad"},
+			token:   accessToken,
+			wantErr: oauth2.ErrorInvalidClient,
+		},
+	}
+
+	for i, tt := range tests {
+		got, err := fx.srv.IntrospectToken(tt.creds, tt.token)
+		if tt.wantErr != "" {
+			oerr, ok := err.(*oauth2.Error)
+			if !ok || oerr.Type != tt.wantErr {
+				t.Errorf("case %d: want err %q, got %v", i, tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+
+		if got.Active && (got.ExpiresAt == 0 || got.IssuedAt == 0) && tt.token != refreshToken {
+			t.Errorf("case %d: expected exp and iat to be set, got %#v", i, got)
+		}
+		got.ExpiresAt, got.IssuedAt = 0, 0
+		if diff := pretty.Compare(tt.want, got); diff != "" {
+			t.Errorf("case %d: Compare(want, got) = %v", i, diff)
+		}
+	}
+}
+
+func TestHandleIntrospectFunc(t *testing.T) {
+	fx := makeTokenTestFixtures(t)
+	accessToken := newTestAccessToken(t, fx, testClientID)
+
+	tests := []struct {
+		method     string
+		form       url.Values
+		user       string
+		passwd     string
+		wantCode   int
+		wantActive bool
+	}{
+		{
+			method:     "POST",
+			form:       url.Values{"token": {accessToken}, "token_type_hint": {"access_token"}},
+			user:       testCreds.ID,
+			passwd:     testCreds.Secret,
+			wantCode:   http.StatusOK,
+			wantActive: true,
+		},
+		{
+			method:   "POST",
+			form:     url.Values{"token": {"bogus"}},
+			user:     testCreds.ID,
+			passwd:   testCreds.Secret,
+			wantCode: http.StatusOK,
+		},
+		// missing token
+		{
+			method:   "POST",
+			form:     url.Values{},
+			user:     testCreds.ID,
+			passwd:   testCreds.Secret,
+			wantCode: http.StatusBadRequest,
+		},
+		// client_id isn't accepted in place of credentials
+		{
+			method:   "POST",
+			form:     url.Values{"token": {accessToken}, "client_id": {testPublicCreds.ID}},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			method:   "GET",
+			wantCode: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for i, tt := range tests {
+		hdlr := handleIntrospectFunc(fx.srv)
+		req, err := http.NewRequest(tt.method, "http://example.com/introspect", strings.NewReader(tt.form.Encode()))
+		if err != nil {
+			t.Errorf("case %d: unable to create HTTP request: %v", i, err)
+			continue
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if tt.user != "" {
+			req.SetBasicAuth(tt.user, tt.passwd)
+		}
+
+		w := httptest.NewRecorder()
+		hdlr.ServeHTTP(w, req)
+		if tt.wantCode != w.Code {
+			t.Errorf("case %d: expected HTTP %d, got %d", i, tt.wantCode, w.Code)
+			continue
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+
+		var ti TokenIntrospection
+		if err := json.Unmarshal(w.Body.Bytes(), &ti); err != nil {
+			t.Errorf("case %d: unable to unmarshal response: %v", i, err)
+			continue
+		}
+		if ti.Active != tt.wantActive {
+			t.Errorf("case %d: want active=%t, got active=%t", i, tt.wantActive, ti.Active)
+		}
+	}
+}
@@ -0,0 +1,418 @@
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/coreos/go-oidc/oauth2"
+
+	"github.com/coreos/dex/audit"
+	phttp "github.com/coreos/dex/pkg/http"
+	"github.com/coreos/dex/pkg/log"
+	"github.com/coreos/dex/session"
+	"github.com/coreos/dex/user"
+)
+
+// linkAccountLoginState is the state of the account client's authorization
+// request which logs the user in to their existing account, to prove they
+// own it. The account callback sends such logins back to the link account
+// page.
+const linkAccountLoginState = "link-account"
+
+// The ways users prove they own the existing account their remote identity
+// is linked to, as recorded in the audit log.
+const (
+	linkProofTrustedEmail = "trusted_email"
+	linkProofEmail        = "email"
+	linkProofLogin        = "login"
+)
+
+var errSessionNotRemoteAttached = errors.New("session has no remote identity waiting to be linked")
+
+type linkAccountTemplateData struct {
+	Error   string
+	Message string
+
+	// FormError tells the user why the action they just took failed, and
+	// EmailSent that the email proving they own the account is on its way.
+	FormError string
+	EmailSent bool
+
+	// ConnectorID is the connector the user logged in with, and Email the
+	// email of the existing account its identity is linked to.
+	ConnectorID string
+	Email       string
+
+	// Proven is true once the user proved they own the existing account,
+	// with Token if it was sent to them by email. Until then, they can log
+	// in to the existing account with one of Connectors, or ask for an
+	// email.
+	Proven     bool
+	Token      string
+	Connectors []string
+
+	Code    string
+	PostURL string
+}
+
+// existingUserByEmail returns the user with the email, which a remote
+// identity logging in for the first time may be linked to.
+func (s *Server) existingUserByEmail(email string) (user.User, error) {
+	if email == "" {
+		return user.User{}, user.ErrorNotFound
+	}
+	return s.UserRepo.GetByEmail(nil, email)
+}
+
+// canAutoLink reports whether the remote identity of the session may be
+// linked to the existing user with the same email without asking the user,
+// as both the connector and the user's verification vouch for the email.
+func (s *Server) canAutoLink(ses *session.Session, usr user.User) bool {
+	if !s.AutoLinkTrustedEmails || !usr.EmailVerified {
+		return false
+	}
+	idpc, ok := makeConnectorMap(s.connectors())[ses.ConnectorID]
+	return ok && idpc.TrustedEmailProvider()
+}
+
+// linkRemoteIdentity links the remote identity of the session to the user,
+// who proved they own it as the proof says.
+func (s *Server) linkRemoteIdentity(ses *session.Session, usr user.User, proof string) error {
+	rid := user.RemoteIdentity{
+		ConnectorID: ses.ConnectorID,
+		ID:          ses.Identity.ID,
+	}
+	if err := s.UserManager.LinkRemoteIdentity(usr.ID, rid); err != nil {
+		return err
+	}
+	log.Infof("Session %s remote identity linked: user=%s connectorID=%s proof=%s", ses.ID, usr.ID, rid.ConnectorID, proof)
+	s.Audit.Record(audit.Event{
+		Type:        audit.EventUserRemoteIdentityLinked,
+		UserID:      usr.ID,
+		ClientID:    ses.ClientID,
+		ConnectorID: rid.ConnectorID,
+		IP:          ses.RemoteIP,
+		Details:     map[string]string{"proof": proof},
+	})
+	return nil
+}
+
+// linkAccountURL returns the URL of the link account page for the session,
+// whose remote identity belongs to no user yet, but whose email does.
+func (s *Server) linkAccountURL(ses *session.Session) (string, error) {
+	code, err := s.SessionManager.NewSessionKey(ses.ID)
+	if err != nil {
+		return "", err
+	}
+	u := s.absURL(httpPathLinkAccount)
+	q := u.Query()
+	q.Set("code", code)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// handleLinkAccount asks users who logged in with a remote identity for the
+// first time, but whose email belongs to an existing user, to prove they own
+// that user's account. They either log in to it again through one of its
+// connectors, or follow a link sent to its email. Once they did, the remote
+// identity is linked to the existing user, and the login continues as that
+// user.
+//
+// The code of the login is swapped for a session key kept in a cookie, so
+// that only the browser the login started in can finish it.
+func (s *Server) handleLinkAccount(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		key := r.URL.Query().Get("code")
+		if key == "" {
+			if c, err := r.Cookie(cookieLinkAccount); err == nil {
+				key = c.Value
+			}
+		}
+		sessionID, err := s.SessionManager.ExchangeKey(key)
+		if err != nil {
+			s.renderLinkAccountError(w, http.StatusBadRequest, "This login has expired. Please log in again.")
+			return
+		}
+		ses, usr, err := s.pendingLink(sessionID)
+		if err != nil {
+			log.Errorf("Invalid link account request: %v", err)
+			s.renderLinkAccountError(w, http.StatusBadRequest, "This login has expired. Please log in again.")
+			return
+		}
+
+		code, err := s.SessionManager.NewSessionKey(sessionID)
+		if err != nil {
+			log.Errorf("Failed creating session key: %v", err)
+			s.renderLinkAccountError(w, http.StatusInternalServerError, "An error occurred. Please try again.")
+			return
+		}
+		http.SetCookie(w, createLinkAccountCookie(code))
+		s.renderLinkAccountPage(w, r, ses, usr, code, linkAccountTemplateData{}, http.StatusOK)
+
+	case "POST":
+		c, err := r.Cookie(cookieLinkAccount)
+		if err != nil || subtle.ConstantTimeCompare([]byte(c.Value), []byte(r.PostFormValue("code"))) != 1 {
+			s.renderLinkAccountError(w, http.StatusForbidden, "This page has expired. Please log in again.")
+			return
+		}
+		sessionID, err := s.SessionManager.PeekKey(c.Value)
+		if err != nil {
+			s.renderLinkAccountError(w, http.StatusBadRequest, "This login has expired. Please log in again.")
+			return
+		}
+		ses, usr, err := s.pendingLink(sessionID)
+		if err != nil {
+			log.Errorf("Invalid link account request: %v", err)
+			s.renderLinkAccountError(w, http.StatusBadRequest, "This login has expired. Please log in again.")
+			return
+		}
+
+		switch r.PostFormValue("action") {
+		case "email":
+			s.sendLinkAccountEmail(w, r, ses, usr, c.Value)
+		case "login":
+			s.linkAccountLogin(w, r, ses, usr, c.Value)
+		case "link":
+			s.linkAccount(w, r, ses, usr, c.Value)
+		case "cancel":
+			s.cancelLinkAccount(w, ses, c.Value)
+		default:
+			s.renderLinkAccountPage(w, r, ses, usr, c.Value, linkAccountTemplateData{FormError: "Unknown action."}, http.StatusBadRequest)
+		}
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		phttp.WriteError(w, http.StatusMethodNotAllowed, "GET or POST only acceptable methods")
+	}
+}
+
+// pendingLink returns the session, whose remote identity is waiting to be
+// linked, and the existing user it's linked to.
+func (s *Server) pendingLink(sessionID string) (*session.Session, user.User, error) {
+	ses, err := s.SessionManager.Get(sessionID)
+	if err != nil {
+		return nil, user.User{}, err
+	}
+	if ses.State != session.SessionStateRemoteAttached {
+		return nil, user.User{}, errSessionNotRemoteAttached
+	}
+	usr, err := s.existingUserByEmail(ses.Identity.Email)
+	if err != nil {
+		return nil, user.User{}, err
+	}
+	return ses, usr, nil
+}
+
+// linkProof returns how the user proved they own the existing account: by
+// following the link sent to its email, or by logging in to it since the
+// session began. It's empty if they didn't.
+func (s *Server) linkProof(r *http.Request, ses *session.Session, usr user.User) (string, error) {
+	if token := r.FormValue("token"); token != "" {
+		keys, err := s.KeyManager.PublicKeys()
+		if err != nil {
+			return "", err
+		}
+		link, err := user.ParseAndVerifyAccountLinkToken(token, s.IssuerURL, keys)
+		rid := user.RemoteIdentity{ConnectorID: ses.ConnectorID, ID: ses.Identity.ID}
+		if err == nil && link.UserID() == usr.ID && link.RemoteIdentity() == rid {
+			return linkProofEmail, nil
+		}
+		log.Errorf("Invalid account link token for session %s: %v", ses.ID, err)
+	}
+
+	if s.AccountClientID == "" {
+		return "", nil
+	}
+	bs, err := s.accountBrowserSession(r)
+	if err != nil {
+		return "", err
+	}
+	// Auth times are stored with a precision of seconds.
+	if bs != nil && bs.UserID == usr.ID && !bs.AuthTime.Before(ses.CreatedAt.Truncate(time.Second)) {
+		return linkProofLogin, nil
+	}
+	return "", nil
+}
+
+// linkLoginConnectors returns the connectors the user can log in to the
+// existing account with. Logging in goes through the account client, so
+// there are none if the account portal is disabled.
+func (s *Server) linkLoginConnectors(usr user.User) ([]string, error) {
+	if s.AccountClientID == "" || s.BrowserSessionRepo == nil {
+		return nil, nil
+	}
+	rids, err := s.UserRepo.GetRemoteIdentities(nil, usr.ID)
+	if err != nil {
+		return nil, err
+	}
+	idx := makeConnectorMap(s.connectors())
+	var ids []string
+	for _, rid := range rids {
+		if _, ok := idx[rid.ConnectorID]; ok && !containsString(ids, rid.ConnectorID) {
+			ids = append(ids, rid.ConnectorID)
+		}
+	}
+	return ids, nil
+}
+
+// linkLoginURL returns the URL of the authorization request which logs the
+// user in to the existing account through the connector, asking them to
+// authenticate again.
+func (s *Server) linkLoginURL(connectorID string) string {
+	return s.accountAuthURL(url.Values{
+		"connector_id": {connectorID},
+		"prompt":       {"login"},
+		"state":        {linkAccountLoginState},
+	})
+}
+
+func (s *Server) sendLinkAccountEmail(w http.ResponseWriter, r *http.Request, ses *session.Session, usr user.User, code string) {
+	td := linkAccountTemplateData{EmailSent: true}
+	status := http.StatusOK
+	rid := user.RemoteIdentity{ConnectorID: ses.ConnectorID, ID: ses.Identity.ID}
+	if _, err := s.UserEmailer.SendAccountLinkEmail(usr.ID, rid, ses.ClientID); err != nil {
+		log.Errorf("Failed sending account link email to user %q: %v", usr.ID, err)
+		td = linkAccountTemplateData{FormError: "The email could not be sent. Please try again."}
+		status = http.StatusInternalServerError
+	}
+	s.renderLinkAccountPage(w, r, ses, usr, code, td, status)
+}
+
+func (s *Server) linkAccountLogin(w http.ResponseWriter, r *http.Request, ses *session.Session, usr user.User, code string) {
+	connectorID := r.PostFormValue("connector_id")
+	connectors, err := s.linkLoginConnectors(usr)
+	if err != nil {
+		log.Errorf("Failed getting connectors of user %q: %v", usr.ID, err)
+		s.renderLinkAccountError(w, http.StatusInternalServerError, "An error occurred. Please try again.")
+		return
+	}
+	if !containsString(connectors, connectorID) {
+		s.renderLinkAccountPage(w, r, ses, usr, code, linkAccountTemplateData{FormError: "Unknown login method."}, http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, s.linkLoginURL(connectorID), http.StatusSeeOther)
+}
+
+// linkAccount links the remote identity of the session to the existing
+// user, once the user proved they own it, and logs them in as that user.
+func (s *Server) linkAccount(w http.ResponseWriter, r *http.Request, ses *session.Session, usr user.User, code string) {
+	proof, err := s.linkProof(r, ses, usr)
+	if err != nil {
+		log.Errorf("Failed checking account link of session %s: %v", ses.ID, err)
+		s.renderLinkAccountError(w, http.StatusInternalServerError, "An error occurred. Please try again.")
+		return
+	}
+	if proof == "" {
+		s.renderLinkAccountPage(w, r, ses, usr, code, linkAccountTemplateData{FormError: "Please prove that you own the account first."}, http.StatusForbidden)
+		return
+	}
+
+	switch err := s.linkRemoteIdentity(ses, usr, proof); err {
+	case nil:
+	case user.ErrorDuplicateRemoteIdentity:
+		s.renderLinkAccountError(w, http.StatusBadRequest, "This login is already linked to another account.")
+		return
+	default:
+		log.Errorf("Failed linking remote identity of session %s: %v", ses.ID, err)
+		s.renderLinkAccountError(w, http.StatusInternalServerError, "An error occurred. Please try again.")
+		return
+	}
+
+	// The page can't be used again.
+	if _, err := s.SessionManager.ExchangeKey(code); err != nil {
+		log.Errorf("Failed using session key: %v", err)
+	}
+	http.SetCookie(w, createLinkAccountCookie(""))
+
+	ru, err := s.loginUser(ses, usr)
+	if err != nil {
+		log.Errorf("Failed logging in session %s: %v", ses.ID, err)
+		e := oauth2.NewError(oauth2.ErrorServerError)
+		if err == user.ErrorNotFound {
+			e = oauth2.NewError(oauth2.ErrorAccessDenied)
+		}
+		sessionAuthError(ses)(w, e, ses.ClientState, ses.RedirectURL)
+		return
+	}
+	w.Header().Set("Location", ru)
+	w.WriteHeader(http.StatusSeeOther)
+}
+
+// cancelLinkAccount ends the session, and tells the client the user didn't
+// log in.
+func (s *Server) cancelLinkAccount(w http.ResponseWriter, ses *session.Session, code string) {
+	if _, err := s.SessionManager.ExchangeKey(code); err != nil {
+		log.Errorf("Failed using session key: %v", err)
+	}
+	if _, err := s.SessionManager.Kill(ses.ID); err != nil {
+		log.Errorf("Failed killing session %s: %v", ses.ID, err)
+	}
+	http.SetCookie(w, createLinkAccountCookie(""))
+	log.Infof("Session %s account link cancelled: clientID=%s connectorID=%s", ses.ID, ses.ClientID, ses.ConnectorID)
+	sessionAuthError(ses)(w, oauth2.NewError(oauth2.ErrorAccessDenied), ses.ClientState, ses.RedirectURL)
+}
+
+// renderLinkAccountPage renders the link account page over td, which holds
+// the outcome of the action the user took, if any.
+func (s *Server) renderLinkAccountPage(w http.ResponseWriter, r *http.Request, ses *session.Session, usr user.User, code string, td linkAccountTemplateData, status int) {
+	postURL := s.absURL(httpPathLinkAccount)
+	td.ConnectorID = ses.ConnectorID
+	td.Email = usr.Email
+	td.Code = code
+	td.PostURL = postURL.String()
+
+	proof, err := s.linkProof(r, ses, usr)
+	if err != nil {
+		log.Errorf("Failed checking account link of session %s: %v", ses.ID, err)
+		s.renderLinkAccountError(w, http.StatusInternalServerError, "An error occurred. Please try again.")
+		return
+	}
+	if proof != "" {
+		td.Proven = true
+		if proof == linkProofEmail {
+			td.Token = r.FormValue("token")
+		}
+	} else if td.Connectors, err = s.linkLoginConnectors(usr); err != nil {
+		log.Errorf("Failed getting connectors of user %q: %v", usr.ID, err)
+		s.renderLinkAccountError(w, http.StatusInternalServerError, "An error occurred. Please try again.")
+		return
+	}
+	execTemplateWithStatus(w, s.LinkAccountTemplate, td, status)
+}
+
+func (s *Server) renderLinkAccountError(w http.ResponseWriter, status int, msg string) {
+	execTemplateWithStatus(w, s.LinkAccountTemplate, linkAccountTemplateData{
+		Error:   "Unable to continue",
+		Message: msg,
+	}, status)
+}
+
+// createLinkAccountCookie returns the cookie holding the session key of the
+// link account page, which is removed if the key is empty.
+func createLinkAccountCookie(key string) *http.Cookie {
+	c := &http.Cookie{
+		HttpOnly: true,
+		Name:     cookieLinkAccount,
+		Value:    key,
+		Path:     httpPathLinkAccount,
+	}
+	if key == "" {
+		c.MaxAge = -1
+		// For old IE, ignored by most browsers.
+		c.Expires = time.Unix(0, 0)
+	}
+	return c
+}
+
+// sessionAuthError returns the function which sends errors back to the
+// client of the session, as its response type requires.
+func sessionAuthError(ses *session.Session) func(http.ResponseWriter, error, string, url.URL) {
+	if ses.ResponseType != "" && ses.ResponseType != oauth2.ResponseTypeCode {
+		return fragmentRedirectAuthError
+	}
+	return redirectAuthError
+}
@@ -0,0 +1,449 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc/oidc"
+
+	"github.com/coreos/dex/db"
+	"github.com/coreos/dex/session"
+	"github.com/coreos/dex/user"
+)
+
+// loginNewIdentity logs in with a remote identity no user has yet, and
+// returns where the user-agent is sent next.
+func loginNewIdentity(t *testing.T, f *testFixtures, connectorID string, ident oidc.Identity) string {
+	key, err := f.srv.NewSession(session.SessionRequest{
+		ConnectorID:  connectorID,
+		ClientID:     testClientID,
+		ClientState:  "bogus",
+		RedirectURL:  testRedirectURL,
+		Scope:        []string{"openid"},
+		ResponseType: "code",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating session: %v", err)
+	}
+	ru, err := f.srv.Login(ident, nil, key)
+	if err != nil {
+		t.Fatalf("unexpected error logging in: %v", err)
+	}
+	return ru
+}
+
+func linkAccountCode(t *testing.T, f *testFixtures, ru string) string {
+	linkURL := f.srv.absURL(httpPathLinkAccount)
+	if !strings.HasPrefix(ru, linkURL.String()+"?") {
+		t.Fatalf("want redirect to the link account page, got %q", ru)
+	}
+	u, err := url.Parse(ru)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return u.Query().Get("code")
+}
+
+func responseCookie(w *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, c := range w.Result().Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestLoginLinkAccount(t *testing.T) {
+	tests := []struct {
+		autoLink    bool
+		connectorID string
+		email       string
+
+		wantLinkPage   bool
+		wantRegister   bool
+		wantLinkedUser string
+	}{
+		{
+			connectorID:  "oidc",
+			email:        "email-1@example.com",
+			wantLinkPage: true,
+		},
+		{
+			connectorID:  "oidc",
+			email:        "nobody@example.com",
+			wantRegister: true,
+		},
+		{
+			connectorID:  "oidc",
+			wantRegister: true,
+		},
+		{
+			// Identities from connectors which aren't trusted email
+			// providers aren't linked without asking.
+			autoLink:     true,
+			connectorID:  "oidc",
+			email:        "email-verified@example.com",
+			wantLinkPage: true,
+		},
+		{
+			// Neither are identities of users whose email isn't verified.
+			autoLink:     true,
+			connectorID:  "oidc-trusted",
+			email:        "email-1@example.com",
+			wantLinkPage: true,
+		},
+		{
+			connectorID:  "oidc-trusted",
+			email:        "email-verified@example.com",
+			wantLinkPage: true,
+		},
+		{
+			autoLink:       true,
+			connectorID:    "oidc-trusted",
+			email:          "Email-Verified@example.com",
+			wantLinkedUser: "ID-Verified",
+		},
+	}
+
+	for i, tt := range tests {
+		f, err := makeTestFixtures()
+		if err != nil {
+			t.Fatalf("error making test fixtures: %v", err)
+		}
+		f.srv.AutoLinkTrustedEmails = tt.autoLink
+
+		rid := user.RemoteIdentity{ConnectorID: tt.connectorID, ID: "RID-new"}
+		ru := loginNewIdentity(t, f, tt.connectorID, oidc.Identity{ID: rid.ID, Email: tt.email})
+
+		linkURL := f.srv.absURL(httpPathLinkAccount)
+		if got := strings.HasPrefix(ru, linkURL.String()+"?code="); got != tt.wantLinkPage {
+			t.Errorf("case %d: want link account page %v, got %q", i, tt.wantLinkPage, ru)
+		}
+		u, err := url.Parse(ru)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		if got := u.Query().Get("register") == "1"; got != tt.wantRegister {
+			t.Errorf("case %d: want register %v, got %q", i, tt.wantRegister, ru)
+		}
+
+		usr, err := f.userRepo.GetByRemoteIdentity(nil, rid)
+		if tt.wantLinkedUser == "" {
+			if err != user.ErrorNotFound {
+				t.Errorf("case %d: want remote identity not to be linked, got %v, %v", i, usr.ID, err)
+			}
+			continue
+		}
+		if err != nil || usr.ID != tt.wantLinkedUser {
+			t.Errorf("case %d: want remote identity linked to %q, got %q, %v", i, tt.wantLinkedUser, usr.ID, err)
+		}
+		if !strings.HasPrefix(ru, testRedirectURL.String()+"?code=") {
+			t.Errorf("case %d: want redirect to the client, got %q", i, ru)
+		}
+	}
+}
+
+func TestHandleLinkAccountEmail(t *testing.T) {
+	f, err := makeTestFixtures()
+	if err != nil {
+		t.Fatalf("error making test fixtures: %v", err)
+	}
+	rid := user.RemoteIdentity{ConnectorID: "oidc", ID: "RID-new"}
+	code := linkAccountCode(t, f, loginNewIdentity(t, f, rid.ConnectorID, oidc.Identity{ID: rid.ID, Email: "email-1@example.com"}))
+
+	var cookie *http.Cookie
+	get := func(q url.Values) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", "http://server.example.com/link-account?"+q.Encode(), nil)
+		if err != nil {
+			t.Fatalf("unable to form HTTP request: %v", err)
+		}
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		f.srv.handleLinkAccount(w, req)
+		if c := responseCookie(w, cookieLinkAccount); c != nil {
+			cookie = c
+		}
+		return w
+	}
+	post := func(form url.Values) *httptest.ResponseRecorder {
+		if cookie != nil && form.Get("code") == "" {
+			form.Set("code", cookie.Value)
+		}
+		req, err := http.NewRequest("POST", "http://server.example.com/link-account", strings.NewReader(form.Encode()))
+		if err != nil {
+			t.Fatalf("unable to form HTTP request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		f.srv.handleLinkAccount(w, req)
+		return w
+	}
+
+	// The code is swapped for a key kept in a cookie.
+	w := get(url.Values{"code": {code}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("want HTTP %d, got %d", http.StatusOK, w.Code)
+	}
+	if cookie == nil || cookie.Value == "" {
+		t.Fatalf("want link account cookie to be set")
+	}
+	for _, want := range []string{"email-1@example.com", `value="email"`, `name="code" value="` + cookie.Value + `"`} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("want link account page to contain %q", want)
+		}
+	}
+	if w = get(url.Values{"code": {code}}); w.Code != http.StatusBadRequest {
+		t.Errorf("want HTTP %d reusing the code, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	// Forms need the key of the cookie, and the user has to prove they own
+	// the account before it's linked.
+	if w = post(url.Values{"action": {"link"}, "code": {"bogus"}}); w.Code != http.StatusForbidden {
+		t.Errorf("want HTTP %d, got %d", http.StatusForbidden, w.Code)
+	}
+	if w = post(url.Values{"action": {"link"}}); w.Code != http.StatusForbidden {
+		t.Errorf("want HTTP %d, got %d", http.StatusForbidden, w.Code)
+	}
+	if w = post(url.Values{"action": {"bogus"}}); w.Code != http.StatusBadRequest {
+		t.Errorf("want HTTP %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w = post(url.Values{"action": {"email"}}); w.Code != http.StatusOK {
+		t.Errorf("want HTTP %d, got %d", http.StatusOK, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "We sent an email") {
+		t.Errorf("want link account page to say the email was sent")
+	}
+
+	f.srv.UserEmailer.SetEmailer(nil)
+	linkURL, err := f.srv.UserEmailer.SendAccountLinkEmail("ID-1", rid, testClientID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	token := linkURL.Query().Get("token")
+	otherURL, err := f.srv.UserEmailer.SendAccountLinkEmail("ID-Verified", rid, testClientID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The link only works in the browser the login started in, and for the
+	// account it was sent for.
+	linkCookie := cookie
+	cookie = nil
+	if w = get(linkURL.Query()); w.Code != http.StatusBadRequest {
+		t.Errorf("want HTTP %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	cookie = linkCookie
+	if w = get(otherURL.Query()); w.Code != http.StatusOK || strings.Contains(w.Body.String(), `value="link"`) {
+		t.Errorf("want HTTP %d without link button, got %d", http.StatusOK, w.Code)
+	}
+	if w = post(url.Values{"action": {"link"}, "token": {otherURL.Query().Get("token")}}); w.Code != http.StatusForbidden {
+		t.Errorf("want HTTP %d, got %d", http.StatusForbidden, w.Code)
+	}
+
+	if w = get(linkURL.Query()); w.Code != http.StatusOK {
+		t.Fatalf("want HTTP %d, got %d", http.StatusOK, w.Code)
+	}
+	for _, want := range []string{`value="link"`, `name="token" value="` + token + `"`} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("want link account page to contain %q", want)
+		}
+	}
+
+	w = post(url.Values{"action": {"link"}, "token": {token}})
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("want HTTP %d, got %d", http.StatusSeeOther, w.Code)
+	}
+	if got := w.Header().Get("Location"); !strings.HasPrefix(got, testRedirectURL.String()+"?code=") {
+		t.Errorf("want redirect to the client, got %q", got)
+	}
+	if c := responseCookie(w, cookieLinkAccount); c == nil || c.MaxAge >= 0 {
+		t.Errorf("want link account cookie to be removed")
+	}
+	usr, err := f.userRepo.GetByRemoteIdentity(nil, rid)
+	if err != nil || usr.ID != "ID-1" {
+		t.Errorf("want remote identity linked to ID-1, got %q, %v", usr.ID, err)
+	}
+
+	// The page can't be used again.
+	if w = post(url.Values{"action": {"link"}, "token": {token}}); w.Code != http.StatusBadRequest {
+		t.Errorf("want HTTP %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestHandleLinkAccountLogin(t *testing.T) {
+	// ID-1 logged in through IDPC-1 an hour ago.
+	f, bsCookie := makeAccountTestFixtures(t)
+	bsID, err := f.srv.parseBrowserSessionToken(bsCookie.Value)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	bs, err := f.srv.BrowserSessionRepo.Get(bsID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	bs.AuthTime = bs.AuthTime.Add(-time.Hour)
+	if err := f.srv.BrowserSessionRepo.Delete(bsID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := f.srv.BrowserSessionRepo.Create(*bs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := f.userRepo.AddRemoteIdentity(nil, "ID-1", user.RemoteIdentity{ConnectorID: "local", ID: "ID-1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rid := user.RemoteIdentity{ConnectorID: "oidc", ID: "RID-new"}
+	code := linkAccountCode(t, f, loginNewIdentity(t, f, rid.ConnectorID, oidc.Identity{ID: rid.ID, Email: "email-1@example.com"}))
+
+	var cookie *http.Cookie
+	request := func(method string, form url.Values) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, "http://server.example.com/link-account?"+form.Encode(), nil)
+		if method == "POST" {
+			form.Set("code", cookie.Value)
+			req, err = http.NewRequest(method, "http://server.example.com/link-account", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		if err != nil {
+			t.Fatalf("unable to form HTTP request: %v", err)
+		}
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		req.AddCookie(bsCookie)
+		w := httptest.NewRecorder()
+		f.srv.handleLinkAccount(w, req)
+		if c := responseCookie(w, cookieLinkAccount); c != nil {
+			cookie = c
+		}
+		return w
+	}
+
+	// Logging in before the login which is linked proves nothing.
+	w := request("GET", url.Values{"code": {code}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("want HTTP %d, got %d", http.StatusOK, w.Code)
+	}
+	if strings.Contains(w.Body.String(), `value="link"`) {
+		t.Errorf("want no link button")
+	}
+	if !strings.Contains(w.Body.String(), `name="connector_id" value="local"`) {
+		t.Errorf("want link account page to offer logging in with the local connector")
+	}
+	if w = request("POST", url.Values{"action": {"link"}}); w.Code != http.StatusForbidden {
+		t.Errorf("want HTTP %d, got %d", http.StatusForbidden, w.Code)
+	}
+
+	// The user logs in again with the account client.
+	if w = request("POST", url.Values{"action": {"login"}, "connector_id": {"oidc"}}); w.Code != http.StatusBadRequest {
+		t.Errorf("want HTTP %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	w = request("POST", url.Values{"action": {"login"}, "connector_id": {"local"}})
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("want HTTP %d, got %d", http.StatusSeeOther, w.Code)
+	}
+	u, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	q := u.Query()
+	if q.Get("client_id") != testClientID || q.Get("connector_id") != "local" || q.Get("prompt") != "login" || q.Get("state") != linkAccountLoginState {
+		t.Errorf("want login to the account client through the local connector, got %q", u)
+	}
+
+	key, err := f.srv.NewSession(session.SessionRequest{
+		ConnectorID:  "local",
+		ClientID:     testClientID,
+		ClientState:  linkAccountLoginState,
+		RedirectURL:  testRedirectURL,
+		Scope:        []string{"openid"},
+		ResponseType: "code",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating session: %v", err)
+	}
+	token, expiresAt, err := f.srv.StartBrowserSession(key)
+	if err != nil {
+		t.Fatalf("unexpected error starting browser session: %v", err)
+	}
+	if _, err := f.srv.Login(oidc.Identity{ID: "ID-1"}, nil, key); err != nil {
+		t.Fatalf("unexpected error logging in: %v", err)
+	}
+	bsCookie = createBrowserSessionCookie(token, expiresAt)
+
+	req, err := http.NewRequest("GET", "http://server.example.com/account/callback?"+url.Values{"state": {linkAccountLoginState}}.Encode(), nil)
+	if err != nil {
+		t.Fatalf("unable to form HTTP request: %v", err)
+	}
+	w = httptest.NewRecorder()
+	f.srv.handleAccountCallback(w, req)
+	if got, want := w.Header().Get("Location"), f.srv.absURL(httpPathLinkAccount); got != want.String() {
+		t.Errorf("want Location %q, got %q", want.String(), got)
+	}
+
+	if w = request("GET", url.Values{}); w.Code != http.StatusOK {
+		t.Fatalf("want HTTP %d, got %d", http.StatusOK, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `value="link"`) {
+		t.Errorf("want link button")
+	}
+	w = request("POST", url.Values{"action": {"link"}})
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("want HTTP %d, got %d", http.StatusSeeOther, w.Code)
+	}
+	if got := w.Header().Get("Location"); !strings.HasPrefix(got, testRedirectURL.String()+"?code=") {
+		t.Errorf("want redirect to the client, got %q", got)
+	}
+	usr, err := f.userRepo.GetByRemoteIdentity(nil, rid)
+	if err != nil || usr.ID != "ID-1" {
+		t.Errorf("want remote identity linked to ID-1, got %q, %v", usr.ID, err)
+	}
+}
+
+func TestHandleLinkAccountCancel(t *testing.T) {
+	f, err := makeTestFixtures()
+	if err != nil {
+		t.Fatalf("error making test fixtures: %v", err)
+	}
+	f.srv.BrowserSessionRepo = db.NewBrowserSessionRepo(db.NewMemDB())
+	rid := user.RemoteIdentity{ConnectorID: "oidc", ID: "RID-new"}
+	code := linkAccountCode(t, f, loginNewIdentity(t, f, rid.ConnectorID, oidc.Identity{ID: rid.ID, Email: "email-1@example.com"}))
+
+	req, err := http.NewRequest("GET", "http://server.example.com/link-account?code="+url.QueryEscape(code), nil)
+	if err != nil {
+		t.Fatalf("unable to form HTTP request: %v", err)
+	}
+	w := httptest.NewRecorder()
+	f.srv.handleLinkAccount(w, req)
+	cookie := responseCookie(w, cookieLinkAccount)
+	if cookie == nil {
+		t.Fatalf("want link account cookie to be set")
+	}
+
+	form := url.Values{"action": {"cancel"}, "code": {cookie.Value}}
+	req, err = http.NewRequest("POST", "http://server.example.com/link-account", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatalf("unable to form HTTP request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	f.srv.handleLinkAccount(w, req)
+	if w.Code != http.StatusFound {
+		t.Fatalf("want HTTP %d, got %d", http.StatusFound, w.Code)
+	}
+	if got, want := w.Header().Get("Location"), testRedirectURL.String()+"?error=access_denied&state=bogus"; got != want {
+		t.Errorf("want Location %q, got %q", want, got)
+	}
+	if _, err := f.userRepo.GetByRemoteIdentity(nil, rid); err != user.ErrorNotFound {
+		t.Errorf("want remote identity not to be linked, got %v", err)
+	}
+}
@@ -0,0 +1,338 @@
+package server
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/jose"
+	"github.com/coreos/go-oidc/oidc"
+
+	"github.com/coreos/dex/audit"
+	"github.com/coreos/dex/client"
+	pcrypto "github.com/coreos/dex/pkg/crypto"
+	phttp "github.com/coreos/dex/pkg/http"
+	"github.com/coreos/dex/pkg/log"
+	"github.com/coreos/dex/session"
+)
+
+const (
+	backChannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+	// logoutTokenValidityWindow is how long clients accept a logout token
+	// for after it was issued.
+	logoutTokenValidityWindow = 2 * time.Minute
+)
+
+// backChannelLogoutClient sends logout tokens. Clients which don't respond
+// in time aren't waited for, so that the user isn't kept on the logout page.
+var backChannelLogoutClient = &http.Client{Timeout: 5 * time.Second}
+
+var (
+	errInvalidIDTokenHint = errors.New("invalid id_token_hint")
+
+	// errBrowserSessionOtherUser is returned by endBrowserSession if the
+	// browser session isn't the one of the user the client logs out.
+	errBrowserSessionOtherUser = errors.New("browser session of another user")
+)
+
+type logoutTemplateData struct {
+	Error   string
+	Message string
+
+	FrontChannelLogoutURIs []string
+	PostLogoutRedirectURI  string
+}
+
+// handleEndSession serves the end_session_endpoint of OpenID Connect
+// RP-Initiated Logout. It ends the user-agent's browser session, logs the
+// user out of the clients they're logged in to and sends the user-agent back
+// to the client if it asked for it with a registered post logout redirect
+// URI.
+func (s *Server) handleEndSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "POST" {
+		w.Header().Set("Allow", "GET, POST")
+		phttp.WriteError(w, http.StatusMethodNotAllowed, "GET or POST only acceptable methods")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		s.renderLogoutError(w, http.StatusBadRequest, "Invalid logout request.")
+		return
+	}
+
+	var userID, clientID string
+	if hint := r.Form.Get("id_token_hint"); hint != "" {
+		var err error
+		userID, clientID, err = s.parseIDTokenHint(hint)
+		if err != nil {
+			log.Errorf("Invalid logout request: %v", err)
+			s.renderLogoutError(w, http.StatusBadRequest, "The id_token_hint is invalid.")
+			return
+		}
+	}
+	if cid := r.Form.Get("client_id"); cid != "" {
+		if clientID != "" && cid != clientID {
+			s.renderLogoutError(w, http.StatusBadRequest, "The client_id doesn't match the id_token_hint.")
+			return
+		}
+		clientID = cid
+	}
+
+	var redirectURL *url.URL
+	if ru := r.Form.Get("post_logout_redirect_uri"); ru != "" {
+		u, err := s.postLogoutRedirectURL(clientID, ru)
+		if err != nil {
+			log.Errorf("Invalid logout request: %v", err)
+			s.renderLogoutError(w, http.StatusBadRequest, "The post_logout_redirect_uri is not registered for the client.")
+			return
+		}
+		if state := r.Form.Get("state"); state != "" {
+			q := u.Query()
+			q.Set("state", state)
+			u.RawQuery = q.Encode()
+		}
+		redirectURL = u
+	}
+
+	// Only the user of the browser session is logged out. ID tokens aren't
+	// secrets, so the hint only has to agree with the browser session.
+	userID, err := s.endBrowserSession(r, userID)
+	if err == errBrowserSessionOtherUser {
+		s.renderLogoutError(w, http.StatusBadRequest, "The id_token_hint is for another user than the one logged in.")
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to end browser session: %v", err)
+		s.renderLogoutError(w, http.StatusInternalServerError, "An error occurred logging you out.")
+		return
+	}
+	http.SetCookie(w, createBrowserSessionCookie("", time.Unix(0, 0)))
+
+	var frontChannelURIs []string
+	if userID != "" {
+		if frontChannelURIs, err = s.Logout(userID, clientID); err != nil {
+			log.Errorf("Failed to log user %q out: %v", userID, err)
+			s.renderLogoutError(w, http.StatusInternalServerError, "An error occurred logging you out.")
+			return
+		}
+		log.Infof("User logged out: user=%s clientID=%s", userID, clientID)
+		s.Audit.Record(audit.Event{
+			Type:     audit.EventLogout,
+			UserID:   userID,
+			ClientID: clientID,
+			IP:       phttp.RemoteIP(r),
+		})
+	}
+
+	if redirectURL != nil && len(frontChannelURIs) == 0 {
+		w.Header().Set("Location", redirectURL.String())
+		w.WriteHeader(http.StatusFound)
+		return
+	}
+
+	td := logoutTemplateData{
+		Message:                "You have been logged out.",
+		FrontChannelLogoutURIs: frontChannelURIs,
+	}
+	if redirectURL != nil {
+		td.PostLogoutRedirectURI = redirectURL.String()
+	}
+	execTemplate(w, s.LogoutTemplate, td)
+}
+
+func (s *Server) renderLogoutError(w http.ResponseWriter, status int, msg string) {
+	execTemplateWithStatus(w, s.LogoutTemplate, logoutTemplateData{
+		Error:   "Unable to log out",
+		Message: msg,
+	}, status)
+}
+
+// parseIDTokenHint verifies an ID token dex issued, and returns the user and
+// client it was issued for. The token may have expired.
+func (s *Server) parseIDTokenHint(token string) (userID, clientID string, err error) {
+	jwt, err := jose.ParseJWT(token)
+	if err != nil {
+		return "", "", errInvalidIDTokenHint
+	}
+	keys, err := s.KeyManager.PublicKeys()
+	if err != nil {
+		return "", "", err
+	}
+	if ok, err := oidc.VerifySignature(jwt, keys); err != nil || !ok {
+		return "", "", errInvalidIDTokenHint
+	}
+
+	claims, err := jwt.Claims()
+	if err != nil {
+		return "", "", errInvalidIDTokenHint
+	}
+	if iss, _, _ := claims.StringClaim("iss"); iss != s.IssuerURL.String() {
+		return "", "", errInvalidIDTokenHint
+	}
+	userID, ok, _ := claims.StringClaim("sub")
+	if !ok || userID == "" {
+		return "", "", errInvalidIDTokenHint
+	}
+	clientID, ok, _ = claims.StringClaim("aud")
+	if !ok || clientID == "" {
+		return "", "", errInvalidIDTokenHint
+	}
+	return userID, clientID, nil
+}
+
+// postLogoutRedirectURL returns the post logout redirect URI, if it's
+// registered for the client.
+func (s *Server) postLogoutRedirectURL(clientID, redirectURI string) (*url.URL, error) {
+	if clientID == "" {
+		return nil, errors.New("post_logout_redirect_uri without id_token_hint or client_id")
+	}
+	cli, err := s.ClientManager.Get(clientID)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return nil, err
+	}
+	ru, err := client.ValidRedirectURL(u, cli.PostLogoutRedirectURIs)
+	if err != nil {
+		return nil, err
+	}
+	return &ru, nil
+}
+
+// endBrowserSession deletes the browser session of the user-agent and returns
+// its user. If the browser session belongs to another user than the one
+// given, it's left alone and errBrowserSessionOtherUser is returned. If the
+// user-agent has no browser session, the user is empty.
+func (s *Server) endBrowserSession(r *http.Request, userID string) (string, error) {
+	cookie, err := r.Cookie(cookieBrowserSession)
+	if err != nil || s.BrowserSessionRepo == nil {
+		return "", nil
+	}
+	id, err := s.parseBrowserSessionToken(cookie.Value)
+	if err == errInvalidBrowserSessionToken {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	bs, err := s.BrowserSessionRepo.Get(id)
+	if err == session.ErrorBrowserSessionNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if userID != "" && bs.UserID != userID {
+		return "", errBrowserSessionOtherUser
+	}
+
+	if err := s.BrowserSessionRepo.Delete(id); err != nil && err != session.ErrorBrowserSessionNotFound {
+		return "", err
+	}
+	return bs.UserID, nil
+}
+
+// Logout logs the user out of the clients holding refresh tokens for them,
+// and of the client which asked for the logout, if any. That client's refresh
+// tokens for the user are revoked. Clients with a back-channel logout URI are
+// sent a logout token; the front-channel logout URIs are returned, for the
+// logout page to load.
+func (s *Server) Logout(userID, clientID string) ([]string, error) {
+	withTokens, err := s.RefreshTokenRepo.ClientsWithRefreshTokens(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// A client holds as many refresh tokens as the user granted it.
+	var clients []client.Client
+	seen := make(map[string]bool)
+	for _, cli := range withTokens {
+		if !seen[cli.Credentials.ID] {
+			seen[cli.Credentials.ID] = true
+			clients = append(clients, cli)
+		}
+	}
+	if clientID != "" && !seen[clientID] {
+		cli, err := s.ClientManager.Get(clientID)
+		switch err {
+		case nil:
+			clients = append(clients, cli)
+		case client.ErrorNotFound:
+		default:
+			return nil, err
+		}
+	}
+	if clientID != "" {
+		if err := s.RefreshTokenRepo.RevokeTokensForClient(userID, clientID); err != nil {
+			return nil, err
+		}
+	}
+
+	var frontChannelURIs []string
+	var wg sync.WaitGroup
+	for _, cli := range clients {
+		if cli.FrontChannelLogoutURI != nil {
+			frontChannelURIs = append(frontChannelURIs, cli.FrontChannelLogoutURI.String())
+		}
+		if cli.BackChannelLogoutURI != nil {
+			wg.Add(1)
+			go func(cli client.Client) {
+				defer wg.Done()
+				if err := s.sendBackChannelLogout(cli, userID); err != nil {
+					log.Errorf("Failed to send back-channel logout to client %q: %v", cli.Credentials.ID, err)
+				}
+			}(cli)
+		}
+	}
+	wg.Wait()
+
+	return frontChannelURIs, nil
+}
+
+// sendBackChannelLogout posts a logout token for the user to the client's
+// back-channel logout URI.
+func (s *Server) sendBackChannelLogout(cli client.Client, userID string) error {
+	signer, err := s.KeyManager.Signer()
+	if err != nil {
+		return err
+	}
+	jti, err := pcrypto.RandBytes(16)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	claims := jose.Claims{
+		"iss": s.IssuerURL.String(),
+		"aud": cli.Credentials.ID,
+		"sub": userID,
+		"iat": now.Unix(),
+		"exp": now.Add(logoutTokenValidityWindow).Unix(),
+		"jti": base64.RawURLEncoding.EncodeToString(jti),
+		"events": map[string]interface{}{
+			backChannelLogoutEvent: map[string]interface{}{},
+		},
+	}
+	jwt, err := jose.NewSignedJWT(claims, signer)
+	if err != nil {
+		return err
+	}
+
+	resp, err := backChannelLogoutClient.PostForm(cli.BackChannelLogoutURI.String(), url.Values{
+		"logout_token": {jwt.Encode()},
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.New(resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc/jose"
+	"github.com/coreos/go-oidc/oidc"
+
+	"github.com/coreos/dex/client"
+	"github.com/coreos/dex/db"
+	"github.com/coreos/dex/session"
+)
+
+func TestHandleEndSession(t *testing.T) {
+	var logoutTokens []string
+	backChannel := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logoutTokens = append(logoutTokens, r.PostFormValue("logout_token"))
+	}))
+	defer backChannel.Close()
+
+	f, err := makeTestFixtures()
+	if err != nil {
+		t.Fatalf("error making test fixtures: %v", err)
+	}
+	f.srv.BrowserSessionRepo = db.NewBrowserSessionRepo(db.NewMemDB())
+
+	mustParseURL := func(s string) *url.URL {
+		u, err := url.Parse(s)
+		if err != nil {
+			t.Fatalf("unexpected error parsing %q: %v", s, err)
+		}
+		return u
+	}
+	newClient := func(cli client.Client) string {
+		creds, err := f.clientManager.New(cli)
+		if err != nil {
+			t.Fatalf("unexpected error creating client: %v", err)
+		}
+		return creds.ID
+	}
+	logoutClientID := newClient(client.Client{
+		Metadata: oidc.ClientMetadata{
+			RedirectURIs: []url.URL{*mustParseURL("https://logout.example.com/callback")},
+		},
+		PostLogoutRedirectURIs: []url.URL{*mustParseURL("https://logout.example.com/bye")},
+		FrontChannelLogoutURI:  mustParseURL("https://logout.example.com/frontchannel-logout"),
+		BackChannelLogoutURI:   mustParseURL(backChannel.URL),
+	})
+	plainClientID := newClient(client.Client{
+		Metadata: oidc.ClientMetadata{
+			RedirectURIs: []url.URL{*mustParseURL("https://plain.example.com/callback")},
+		},
+		PostLogoutRedirectURIs: []url.URL{*mustParseURL("https://plain.example.com/bye")},
+	})
+
+	for _, clientID := range []string{logoutClientID, testClientID} {
+		if _, err := f.srv.RefreshTokenRepo.Create("ID-1", clientID, []string{"openid", "offline_access"}); err != nil {
+			t.Fatalf("unexpected error creating refresh token: %v", err)
+		}
+	}
+
+	// Log the users in, starting browser sessions.
+	logIn := func(remoteID string) string {
+		key, err := f.srv.NewSession(session.SessionRequest{
+			ConnectorID:  "IDPC-1",
+			ClientID:     testClientID,
+			RedirectURL:  testRedirectURL,
+			Scope:        []string{"openid"},
+			ResponseType: "code",
+		})
+		if err != nil {
+			t.Fatalf("unexpected error creating session: %v", err)
+		}
+		bsToken, _, err := f.srv.StartBrowserSession(key)
+		if err != nil {
+			t.Fatalf("unexpected error starting browser session: %v", err)
+		}
+		if _, err := f.srv.Login(oidc.Identity{ID: remoteID}, nil, key); err != nil {
+			t.Fatalf("unexpected error logging in: %v", err)
+		}
+		return bsToken
+	}
+	bsToken := logIn("RID-1")
+	cookie := &http.Cookie{Name: cookieBrowserSession, Value: bsToken}
+	otherBSToken := logIn("RID-2")
+	otherCookie := &http.Cookie{Name: cookieBrowserSession, Value: otherBSToken}
+
+	// Expired ID tokens are accepted as hints.
+	signer, err := f.srv.KeyManager.Signer()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	now := time.Now()
+	idToken, err := jose.NewSignedJWT(oidc.NewClaims(testIssuerURL.String(), "ID-1", logoutClientID, now.Add(-2*time.Hour), now.Add(-time.Hour)), signer)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	logout := func(q url.Values, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", "http://server.example.com/logout?"+q.Encode(), nil)
+		if err != nil {
+			t.Fatalf("unable to form HTTP request: %v", err)
+		}
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		f.srv.handleEndSession(w, req)
+		return w
+	}
+
+	// invalid requests
+	for i, q := range []url.Values{
+		{"post_logout_redirect_uri": {"https://logout.example.com/bye"}},
+		{"client_id": {logoutClientID}, "post_logout_redirect_uri": {"https://evil.example.com/bye"}},
+		{"client_id": {plainClientID}, "post_logout_redirect_uri": {"https://logout.example.com/bye"}},
+		{"id_token_hint": {"garbage"}},
+		{"id_token_hint": {idToken.Encode()}, "client_id": {plainClientID}},
+	} {
+		w := logout(q, cookie)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("case %d: want HTTP %d, got %d", i, http.StatusBadRequest, w.Code)
+		}
+	}
+	if len(logoutTokens) != 0 {
+		t.Fatalf("want no logout tokens sent for invalid requests, got %d", len(logoutTokens))
+	}
+
+	// Without front-channel logout URIs to load, the user-agent is sent back
+	// to the client at once.
+	w := logout(url.Values{
+		"client_id":                {plainClientID},
+		"post_logout_redirect_uri": {"https://plain.example.com/bye"},
+		"state":                    {"abc"},
+	}, nil)
+	if w.Code != http.StatusFound {
+		t.Fatalf("want HTTP %d, got %d", http.StatusFound, w.Code)
+	}
+	if got, want := w.Header().Get("Location"), "https://plain.example.com/bye?state=abc"; got != want {
+		t.Errorf("want Location %q, got %q", want, got)
+	}
+
+	// ID tokens aren't secrets: without a browser session of its user, the
+	// hint logs nobody out.
+	q := url.Values{
+		"id_token_hint":            {idToken.Encode()},
+		"post_logout_redirect_uri": {"https://logout.example.com/bye"},
+	}
+	w = logout(q, nil)
+	if w.Code != http.StatusFound {
+		t.Fatalf("want HTTP %d, got %d", http.StatusFound, w.Code)
+	}
+	w = logout(q, otherCookie)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("want HTTP %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	otherBSID, err := f.srv.parseBrowserSessionToken(otherBSToken)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := f.srv.BrowserSessionRepo.Get(otherBSID); err != nil {
+		t.Errorf("want browser session of another user to be kept, got %v", err)
+	}
+	if clients, err := f.srv.RefreshTokenRepo.ClientsWithRefreshTokens("ID-1"); err != nil || len(clients) != 2 {
+		t.Errorf("want refresh tokens to be kept, got %v, %v", clients, err)
+	}
+	if len(logoutTokens) != 0 {
+		t.Fatalf("want no logout tokens sent without a browser session of the user, got %d", len(logoutTokens))
+	}
+
+	w = logout(url.Values{
+		"id_token_hint":            {idToken.Encode()},
+		"post_logout_redirect_uri": {"https://logout.example.com/bye"},
+		"state":                    {"xyz"},
+	}, cookie)
+	if w.Code != http.StatusOK {
+		t.Fatalf("want HTTP %d, got %d", http.StatusOK, w.Code)
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		`<iframe src="https://logout.example.com/frontchannel-logout"`,
+		`<a href="https://logout.example.com/bye?state=xyz">`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("want logout page to contain %q", want)
+		}
+	}
+
+	var cleared bool
+	for _, c := range w.Result().Cookies() {
+		cleared = cleared || (c.Name == cookieBrowserSession && c.MaxAge < 0)
+	}
+	if !cleared {
+		t.Errorf("want browser session cookie to be cleared")
+	}
+	bsID, err := f.srv.parseBrowserSessionToken(bsToken)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := f.srv.BrowserSessionRepo.Get(bsID); err != session.ErrorBrowserSessionNotFound {
+		t.Errorf("want browser session to be deleted, got %v", err)
+	}
+
+	// The client which asked for the logout loses its refresh tokens.
+	clients, err := f.srv.RefreshTokenRepo.ClientsWithRefreshTokens("ID-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(clients) != 1 || clients[0].Credentials.ID != testClientID {
+		t.Errorf("want only %q to hold refresh tokens, got %v", testClientID, clients)
+	}
+
+	if len(logoutTokens) != 1 {
+		t.Fatalf("want 1 logout token, got %d", len(logoutTokens))
+	}
+	jwt, err := jose.ParseJWT(logoutTokens[0])
+	if err != nil {
+		t.Fatalf("unexpected error parsing logout token: %v", err)
+	}
+	verifier := f.srv.JWTVerifierFactory()(logoutClientID)
+	if err := verifier.Verify(jwt); err != nil {
+		t.Errorf("unexpected error verifying logout token: %v", err)
+	}
+	claims, err := jwt.Claims()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sub, _, _ := claims.StringClaim("sub"); sub != "ID-1" {
+		t.Errorf("want sub %q, got %q", "ID-1", sub)
+	}
+	events, _ := claims["events"].(map[string]interface{})
+	if _, ok := events[backChannelLogoutEvent]; !ok {
+		t.Errorf("want logout token to carry the %s event", backChannelLogoutEvent)
+	}
+	if _, ok := claims["nonce"]; ok {
+		t.Errorf("want logout token without a nonce")
+	}
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/coreos/dex/audit"
+)
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dex_http_requests_total",
+		Help: "HTTP requests served, by handler and status code.",
+	}, []string{"handler", "code"})
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dex_http_request_duration_seconds",
+		Help:    "HTTP request latencies, by handler.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"handler"})
+	logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dex_logins_total",
+		Help: "Login attempts, by connector and outcome.",
+	}, []string{"connector", "outcome"})
+	tokensIssued = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dex_tokens_issued_total",
+		Help: "Tokens issued, by grant type.",
+	}, []string{"grant_type"})
+)
+
+func init() {
+	prometheus.MustRegister(httpRequests, httpRequestDuration, logins, tokensIssued)
+}
+
+// statusRecorder remembers the status code written to a ResponseWriter.
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.code = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// instrumentHandler counts and times the requests served by h under the
+// given handler name.
+func instrumentHandler(name string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		h.ServeHTTP(rec, r)
+		httpRequests.WithLabelValues(name, strconv.Itoa(rec.code)).Inc()
+		httpRequestDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+	})
+}
+
+// instrumentMux is like instrumentHandler, but names each request after the
+// mux pattern it matches, so that the request's path doesn't leak into the
+// metric labels. Requests mux passes on to a nested mux, whose pattern
+// nested returns, are named after the pattern they match in it.
+func instrumentMux(mux *http.ServeMux, nested func(pattern string) *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+		if n := nested(pattern); n != nil {
+			if _, p := n.Handler(r); p != "" {
+				pattern = p
+			}
+		}
+		instrumentHandler(pattern, mux).ServeHTTP(w, r)
+	})
+}
+
+// auditMetrics is an audit.Sink deriving login and token metrics from the
+// audit events recorded by the server and the connectors.
+type auditMetrics struct{}
+
+func (auditMetrics) Write(e audit.Event) error {
+	switch e.Type {
+	case audit.EventLoginSucceeded:
+		logins.WithLabelValues(e.ConnectorID, "succeeded").Inc()
+	case audit.EventLoginFailed:
+		logins.WithLabelValues(e.ConnectorID, "failed").Inc()
+	case audit.EventLoginLockedOut:
+		logins.WithLabelValues(e.ConnectorID, "locked_out").Inc()
+	case audit.EventTokenIssued, audit.EventTokenRefreshed:
+		tokensIssued.WithLabelValues(e.Details["grant_type"]).Inc()
+	}
+	return nil
+}
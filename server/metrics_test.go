@@ -0,0 +1,77 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/coreos/dex/audit"
+)
+
+func TestInstrumentMux(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	})
+	mux.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {})
+	connectors := http.NewServeMux()
+	connectors.HandleFunc("/auth/local/login", func(w http.ResponseWriter, r *http.Request) {})
+	mux.Handle("/", connectors)
+	h := instrumentMux(mux, func(pattern string) *http.ServeMux {
+		if pattern == "/" {
+			return connectors
+		}
+		return nil
+	})
+
+	tests := []struct {
+		path    string
+		handler string
+		code    string
+	}{
+		{path: "/token", handler: "/token", code: "400"},
+		{path: "/api/v1/users/123", handler: "/api/", code: "200"},
+		{path: "/auth/local/login", handler: "/auth/local/login", code: "200"},
+		{path: "/nowhere", handler: "/", code: "404"},
+	}
+
+	for i, tt := range tests {
+		before := testutil.ToFloat64(httpRequests.WithLabelValues(tt.handler, tt.code))
+		r, err := http.NewRequest("GET", "http://example.com"+tt.path, nil)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), r)
+		if got := testutil.ToFloat64(httpRequests.WithLabelValues(tt.handler, tt.code)) - before; got != 1 {
+			t.Errorf("case %d: want 1 request counted, got %v", i, got)
+		}
+	}
+}
+
+func TestAuditMetrics(t *testing.T) {
+	events := []audit.Event{
+		{Type: audit.EventLoginSucceeded, ConnectorID: "metrics-test"},
+		{Type: audit.EventLoginFailed, ConnectorID: "metrics-test"},
+		{Type: audit.EventLoginFailed, ConnectorID: "metrics-test"},
+		{Type: audit.EventLoginLockedOut, ConnectorID: "metrics-test"},
+		{Type: audit.EventTokenIssued, Details: map[string]string{"grant_type": "metrics-test"}},
+		{Type: audit.EventTokenRefreshed, Details: map[string]string{"grant_type": "metrics-test"}},
+		{Type: audit.EventAdminClientDeleted, ClientID: "XXX"},
+	}
+
+	l := audit.NewLogger(auditMetrics{})
+	for _, e := range events {
+		l.Record(e)
+	}
+
+	for outcome, want := range map[string]float64{"succeeded": 1, "failed": 2, "locked_out": 1} {
+		if got := testutil.ToFloat64(logins.WithLabelValues("metrics-test", outcome)); got != want {
+			t.Errorf("outcome %s: want %v logins, got %v", outcome, want, got)
+		}
+	}
+	if got := testutil.ToFloat64(tokensIssued.WithLabelValues("metrics-test")); got != 2 {
+		t.Errorf("want 2 tokens issued, got %v", got)
+	}
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/coreos/dex/mfa"
+	"github.com/coreos/dex/session"
+)
+
+var errMFARequired = errors.New("a second factor is required but wasn't used")
+
+// MFARequired implements mfa.Policy. It returns whether the client of the
+// session the key belongs to requires a second factor.
+func (s *Server) MFARequired(sessionKey string) (bool, error) {
+	sessionID, err := s.SessionManager.PeekKey(sessionKey)
+	if err != nil {
+		return false, err
+	}
+	ses, err := s.SessionManager.Get(sessionID)
+	if err != nil {
+		return false, err
+	}
+	cli, err := s.ClientRepo.Get(nil, ses.ClientID)
+	if err != nil {
+		return false, err
+	}
+	return cli.RequireMFA, nil
+}
+
+// SetAuthMethods implements mfa.Policy.
+func (s *Server) SetAuthMethods(sessionKey string, amr []string) error {
+	sessionID, err := s.SessionManager.PeekKey(sessionKey)
+	if err != nil {
+		return err
+	}
+	_, err = s.SessionManager.SetAuthMethods(sessionID, amr)
+	return err
+}
+
+// checkMFA makes sure logins to the local connector which need a second
+// factor used one, in case the connector didn't ask for it.
+func (s *Server) checkMFA(ses *session.Session) error {
+	missing, err := s.missingMFA(ses.ConnectorID, ses.ClientID, ses.HasAMR(mfa.AMRMFA))
+	if err != nil {
+		return err
+	}
+	if missing {
+		return errMFARequired
+	}
+	return nil
+}
+
+// missingMFA reports whether a login to the client through the connector
+// needs a second factor, but didn't use one.
+func (s *Server) missingMFA(connectorID, clientID string, usedMFA bool) (bool, error) {
+	if s.MFA == nil || connectorID != s.currentLocalConnectorID() || usedMFA {
+		return false, nil
+	}
+	if s.MFA.Required {
+		return true, nil
+	}
+	cli, err := s.ClientRepo.Get(nil, clientID)
+	if err != nil {
+		return false, err
+	}
+	return cli.RequireMFA, nil
+}
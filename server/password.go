@@ -1,14 +1,17 @@
 package server
 
 import (
+	"fmt"
 	"html/template"
 	"net/http"
 	"net/url"
 
 	"github.com/coreos/go-oidc/key"
 
+	"github.com/coreos/dex/audit"
 	"github.com/coreos/dex/client"
 	clientmanager "github.com/coreos/dex/client/manager"
+	phttp "github.com/coreos/dex/pkg/http"
 	"github.com/coreos/dex/pkg/log"
 	sessionmanager "github.com/coreos/dex/session/manager"
 	"github.com/coreos/dex/user"
@@ -179,6 +182,7 @@ type ResetPasswordHandler struct {
 	issuerURL url.URL
 	um        *usermanager.UserManager
 	keysFunc  func() ([]key.PublicKey, error)
+	audit     *audit.Logger
 }
 
 type resetPasswordRequest struct {
@@ -231,26 +235,31 @@ func (r *resetPasswordRequest) handlePOST() {
 
 	plaintext := r.r.FormValue("password")
 	cbURL, err := r.h.um.ChangePassword(r.pwReset, plaintext)
+	if err == usermanager.ErrorPasswordAlreadyChanged {
+		r.data.Error = "Link Expired"
+		r.data.Message = "The link in your email is no longer valid. If you need to change your password, generate a new email."
+		r.data.DontShowForm = true
+		execTemplateWithStatus(r.w, r.h.tpl, r.data, http.StatusBadRequest)
+		return
+	}
+	if msg, ok := passwordPolicyMessage(err, r.h.um.PasswordPolicy); ok {
+		r.data.Error = "Invalid Password"
+		r.data.Message = msg
+		execTemplateWithStatus(r.w, r.h.tpl, r.data, http.StatusBadRequest)
+		return
+	}
 	if err != nil {
-		switch err {
-		case usermanager.ErrorPasswordAlreadyChanged:
-			r.data.Error = "Link Expired"
-			r.data.Message = "The link in your email is no longer valid. If you need to change your password, generate a new email."
-			r.data.DontShowForm = true
-			execTemplateWithStatus(r.w, r.h.tpl, r.data, http.StatusBadRequest)
-			return
-		case user.ErrorInvalidPassword:
-			r.data.Error = "Invalid Password"
-			r.data.Message = "Please choose a password which is at least six characters."
-			execTemplateWithStatus(r.w, r.h.tpl, r.data, http.StatusBadRequest)
-			return
-		default:
-			r.data.Error = "Error Processing Request"
-			r.data.Message = "Please try again later."
-			execTemplateWithStatus(r.w, r.h.tpl, r.data, http.StatusInternalServerError)
-			return
-		}
+		r.data.Error = "Error Processing Request"
+		r.data.Message = "Please try again later."
+		execTemplateWithStatus(r.w, r.h.tpl, r.data, http.StatusInternalServerError)
+		return
 	}
+	r.h.audit.Record(audit.Event{
+		Type:   audit.EventUserPasswordReset,
+		UserID: r.pwReset.UserID(),
+		IP:     phttp.RemoteIP(r.r),
+	})
+
 	if cbURL == nil {
 		r.data.Success = true
 		execTemplate(r.w, r.h.tpl, r.data)
@@ -260,6 +269,24 @@ func (r *resetPasswordRequest) handlePOST() {
 	http.Redirect(r.w, r.r, cbURL.String(), http.StatusSeeOther)
 }
 
+// passwordPolicyMessage explains to the user why the password policy rejected
+// their new password, if that's why err was returned.
+func passwordPolicyMessage(err error, policy user.PasswordPolicy) (string, bool) {
+	switch err {
+	case user.ErrorInvalidPassword:
+		return fmt.Sprintf("Please choose a password which is at least %d characters.", policy.MinLength), true
+	case user.ErrorPasswordTooLong:
+		return "Please choose a shorter password.", true
+	case user.ErrorPasswordTooSimple:
+		return "Please choose a password which mixes upper and lower case letters, digits and symbols.", true
+	case user.ErrorPasswordBreached:
+		return "That password has appeared in a data breach; please choose another.", true
+	case user.ErrorPasswordReused:
+		return "You have used that password before; please choose another.", true
+	}
+	return "", false
+}
+
 func (r *resetPasswordRequest) parseAndVerifyToken() bool {
 	keys, err := r.h.keysFunc()
 	if err != nil {
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+)
+
+// Code challenge methods defined by RFC 7636, Section 4.2.
+const (
+	codeChallengeMethodPlain = "plain"
+	codeChallengeMethodS256  = "S256"
+)
+
+// validPKCEValue reports whether v is a syntactically valid code verifier or
+// code challenge: 43 to 128 characters from the unreserved URI character set.
+func validPKCEValue(v string) bool {
+	if len(v) < 43 || len(v) > 128 {
+		return false
+	}
+	for _, c := range v {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9':
+		case c == '-', c == '.', c == '_', c == '~':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// verifyCodeVerifier reports whether verifier matches the code challenge
+// that was sent, using the given method, in the authentication request.
+func verifyCodeVerifier(challenge, method, verifier string) bool {
+	if !validPKCEValue(verifier) {
+		return false
+	}
+
+	var computed string
+	switch method {
+	case codeChallengeMethodPlain, "":
+		computed = verifier
+	case codeChallengeMethodS256:
+		sum := sha256.Sum256([]byte(verifier))
+		computed = base64.RawURLEncoding.EncodeToString(sum[:])
+	default:
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
@@ -0,0 +1,264 @@
+package server
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/coreos/go-oidc/oauth2"
+	"github.com/coreos/go-oidc/oidc"
+
+	"github.com/coreos/dex/client"
+	clientmanager "github.com/coreos/dex/client/manager"
+	"github.com/coreos/dex/db"
+	"github.com/coreos/dex/session"
+	"github.com/coreos/dex/session/manager"
+)
+
+const (
+	testCodeVerifier      = "dBjftJeZ4CVP-mJ92K9c_bOL0ZQ1Nq5kPZ6e1TqjWgA"
+	testCodeChallengeS256 = "CRYXOMj9aLRFroZpyASLws3ooTWJ5jeHjIHx8g2EBGw"
+)
+
+func TestVerifyCodeVerifier(t *testing.T) {
+	tests := []struct {
+		challenge string
+		method    string
+		verifier  string
+		want      bool
+	}{
+		{
+			challenge: testCodeChallengeS256,
+			method:    codeChallengeMethodS256,
+			verifier:  testCodeVerifier,
+			want:      true,
+		},
+		{
+			challenge: testCodeVerifier,
+			method:    codeChallengeMethodPlain,
+			verifier:  testCodeVerifier,
+			want:      true,
+		},
+		// no method means plain
+		{
+			challenge: testCodeVerifier,
+			method:    "",
+			verifier:  testCodeVerifier,
+			want:      true,
+		},
+		// S256 challenge compared as plain
+		{
+			challenge: testCodeChallengeS256,
+			method:    codeChallengeMethodPlain,
+			verifier:  testCodeVerifier,
+			want:      false,
+		},
+		// wrong verifier
+		{
+			challenge: testCodeChallengeS256,
+			method:    codeChallengeMethodS256,
+			verifier:  strings.Repeat("a", 43),
+			want:      false,
+		},
+		// verifier too short
+		{
+			challenge: "abc",
+			method:    codeChallengeMethodPlain,
+			verifier:  "abc",
+			want:      false,
+		},
+		// verifier with invalid characters
+		{
+			challenge: strings.Repeat("a", 42) + "+",
+			method:    codeChallengeMethodPlain,
+			verifier:  strings.Repeat("a", 42) + "+",
+			want:      false,
+		},
+		// unknown method
+		{
+			challenge: testCodeVerifier,
+			method:    "S512",
+			verifier:  testCodeVerifier,
+			want:      false,
+		},
+	}
+
+	for i, tt := range tests {
+		got := verifyCodeVerifier(tt.challenge, tt.method, tt.verifier)
+		if tt.want != got {
+			t.Errorf("case %d: want=%t got=%t", i, tt.want, got)
+		}
+	}
+}
+
+func TestServerCodeTokenPKCE(t *testing.T) {
+	confidential := client.Client{
+		Credentials: oidc.ClientCredentials{
+			ID:     "confidential.example.com",
+			Secret: clientTestSecret,
+		},
+		Metadata: oidc.ClientMetadata{
+			RedirectURIs: []url.URL{
+				url.URL{Scheme: "http", Host: "confidential.example.com", Path: "/callback"},
+			},
+		},
+	}
+	public := client.Client{
+		Credentials: oidc.ClientCredentials{
+			ID:     "public.example.com",
+			Secret: clientTestSecret,
+		},
+		Metadata: oidc.ClientMetadata{
+			RedirectURIs: []url.URL{
+				url.URL{Scheme: "http", Host: "public.example.com", Path: "/callback"},
+			},
+		},
+		Public: true,
+	}
+
+	dbm := db.NewMemDB()
+	clientIDGenerator := func(hostport string) (string, error) {
+		return hostport, nil
+	}
+	secGen := func() ([]byte, error) {
+		return []byte("secret"), nil
+	}
+	clientRepo := db.NewClientRepo(dbm)
+	clientManager, err := clientmanager.NewClientManagerFromClients(clientRepo, db.TransactionFactory(dbm), []client.Client{confidential, public}, clientmanager.ManagerOptions{ClientIDGenerator: clientIDGenerator, SecretGenerator: secGen})
+	if err != nil {
+		t.Fatalf("Failed to create client identity manager: %v", err)
+	}
+
+	userRepo, err := makeNewUserRepo()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	sm := manager.NewSessionManager(db.NewSessionRepo(db.NewMemDB()), db.NewSessionKeyRepo(db.NewMemDB()))
+	srv := &Server{
+		IssuerURL: url.URL{Scheme: "http", Host: "server.example.com"},
+		KeyManager: &StaticKeyManager{
+			signer: &StaticSigner{sig: []byte("beer"), err: nil},
+		},
+		SessionManager:  sm,
+		ClientRepo:      clientRepo,
+		ClientManager:   clientManager,
+		UserRepo:        userRepo,
+		AccessTokenRepo: db.NewAccessTokenRepo(db.NewMemDB()),
+	}
+
+	tests := []struct {
+		creds               oidc.ClientCredentials
+		codeChallenge       string
+		codeChallengeMethod string
+		codeVerifier        string
+		wantErr             string
+	}{
+		// confidential client using PKCE
+		{
+			creds:               confidential.Credentials,
+			codeChallenge:       testCodeChallengeS256,
+			codeChallengeMethod: codeChallengeMethodS256,
+			codeVerifier:        testCodeVerifier,
+		},
+		// confidential client with a wrong code verifier
+		{
+			creds:               confidential.Credentials,
+			codeChallenge:       testCodeChallengeS256,
+			codeChallengeMethod: codeChallengeMethodS256,
+			codeVerifier:        strings.Repeat("a", 43),
+			wantErr:             oauth2.ErrorInvalidGrant,
+		},
+		// confidential client omitting the code verifier
+		{
+			creds:               confidential.Credentials,
+			codeChallenge:       testCodeChallengeS256,
+			codeChallengeMethod: codeChallengeMethodS256,
+			wantErr:             oauth2.ErrorInvalidGrant,
+		},
+		// confidential client without a secret
+		{
+			creds:               oidc.ClientCredentials{ID: confidential.Credentials.ID},
+			codeChallenge:       testCodeChallengeS256,
+			codeChallengeMethod: codeChallengeMethodS256,
+			codeVerifier:        testCodeVerifier,
+			wantErr:             oauth2.ErrorInvalidClient,
+		},
+		// public client without a secret
+		{
+			creds:               oidc.ClientCredentials{ID: public.Credentials.ID},
+			codeChallenge:       testCodeChallengeS256,
+			codeChallengeMethod: codeChallengeMethodS256,
+			codeVerifier:        testCodeVerifier,
+		},
+		// public client using the plain method
+		{
+			creds:               oidc.ClientCredentials{ID: public.Credentials.ID},
+			codeChallenge:       testCodeVerifier,
+			codeChallengeMethod: codeChallengeMethodPlain,
+			codeVerifier:        testCodeVerifier,
+		},
+		// public client without a code verifier
+		{
+			creds:               oidc.ClientCredentials{ID: public.Credentials.ID},
+			codeChallenge:       testCodeChallengeS256,
+			codeChallengeMethod: codeChallengeMethodS256,
+			wantErr:             oauth2.ErrorInvalidClient,
+		},
+		// public client whose code was issued without a code challenge
+		{
+			creds:        oidc.ClientCredentials{ID: public.Credentials.ID},
+			codeVerifier: testCodeVerifier,
+			wantErr:      oauth2.ErrorInvalidGrant,
+		},
+		// unknown client without a secret
+		{
+			creds:               oidc.ClientCredentials{ID: "unknown.example.com"},
+			codeChallenge:       testCodeChallengeS256,
+			codeChallengeMethod: codeChallengeMethodS256,
+			codeVerifier:        testCodeVerifier,
+			wantErr:             oauth2.ErrorInvalidClient,
+		},
+	}
+
+	for i, tt := range tests {
+		sessionID, err := sm.NewSession(session.SessionRequest{
+			ConnectorID:         "bogus_idpc",
+			ClientID:            tt.creds.ID,
+			ClientState:         "bogus",
+			Scope:               []string{"openid"},
+			ResponseType:        "code",
+			CodeChallenge:       tt.codeChallenge,
+			CodeChallengeMethod: tt.codeChallengeMethod,
+		})
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		if _, err = sm.AttachRemoteIdentity(sessionID, oidc.Identity{}, nil); err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		if _, err = sm.AttachUser(sessionID, "testid-1"); err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		key, err := sm.NewSessionKey(sessionID)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+
+		tokens, err := srv.CodeToken(tt.creds, key, tt.codeVerifier)
+		if tt.wantErr != "" {
+			oerr, ok := err.(*oauth2.Error)
+			if !ok || oerr.Type != tt.wantErr {
+				t.Errorf("case %d: want err %q, got %v", i, tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if tokens.IDToken == nil {
+			t.Errorf("case %d: expect non-nil jwt", i)
+		}
+	}
+}
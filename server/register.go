@@ -48,6 +48,18 @@ var (
 			Field: "password",
 			Error: "Please enter a valid password",
 		},
+		user.ErrorPasswordTooLong: formError{
+			Field: "password",
+			Error: "Please choose a shorter password",
+		},
+		user.ErrorPasswordTooSimple: formError{
+			Field: "password",
+			Error: "Please choose a password which mixes upper and lower case letters, digits and symbols",
+		},
+		user.ErrorPasswordBreached: formError{
+			Field: "password",
+			Error: "That password has appeared in a data breach; please choose another.",
+		},
 		user.ErrorDuplicateEmail: formError{
 			Field: "email",
 			Error: "That email is already in use; please choose another.",
@@ -71,8 +83,6 @@ func handleRegisterFunc(s *Server, tpl Template) http.HandlerFunc {
 		errPage(w, "There was a problem processing your request.", "", http.StatusInternalServerError)
 	}
 
-	idx := makeConnectorMap(s.Connectors)
-
 	return func(w http.ResponseWriter, r *http.Request) {
 		err := r.ParseForm()
 		if err != nil {
@@ -108,19 +118,34 @@ func handleRegisterFunc(s *Server, tpl Template) http.HandlerFunc {
 
 		if exists {
 			// we have to create a new session to be able to run the server.Login function
-			newSessionKey, err := s.NewSession(ses.ConnectorID, ses.ClientID,
-				ses.ClientState, ses.RedirectURL, ses.Nonce, false, ses.Scope)
+			newSessionKey, err := s.NewSession(session.SessionRequest{
+				ConnectorID:         ses.ConnectorID,
+				ClientID:            ses.ClientID,
+				ClientState:         ses.ClientState,
+				RedirectURL:         ses.RedirectURL,
+				Nonce:               ses.Nonce,
+				Scope:               ses.Scope,
+				ResponseType:        ses.ResponseType,
+				CodeChallenge:       ses.CodeChallenge,
+				CodeChallengeMethod: ses.CodeChallengeMethod,
+				ClaimsRequest:       ses.ClaimsRequest,
+			})
 			if err != nil {
 				internalError(w, err)
 				return
 			}
+			// keep the browser session of the user-agent
+			if err = s.moveBrowserSession(ses, newSessionKey); err != nil {
+				internalError(w, err)
+				return
+			}
 			// make sure to clean up the old session
 			if err = s.KillSession(code); err != nil {
 				internalError(w, err)
 			}
 
 			// finally, we can create a valid redirect URL for them.
-			redirURL, err := s.Login(ses.Identity, newSessionKey)
+			redirURL, err := s.Login(ses.Identity, ses.Groups, newSessionKey)
 			if err != nil {
 				internalError(w, err)
 				return
@@ -141,7 +166,7 @@ func handleRegisterFunc(s *Server, tpl Template) http.HandlerFunc {
 
 		// determine whether or not this is a local or remote ID that is going
 		// to be registered.
-		idpc, ok := idx[ses.ConnectorID]
+		idpc, ok := makeConnectorMap(s.connectors())[ses.ConnectorID]
 		if !ok {
 			internalError(w, fmt.Errorf("no such IDPC: %v", ses.ConnectorID))
 			return
@@ -239,11 +264,20 @@ func handleRegisterFunc(s *Server, tpl Template) http.HandlerFunc {
 			internalError(w, err)
 			return
 		}
+		if err = s.syncGroups(ses, userID); err != nil {
+			internalError(w, err)
+			return
+		}
+
 		ses, err = s.SessionManager.AttachUser(sessionID, userID)
 		if err != nil {
 			internalError(w, err)
 			return
 		}
+		if err = s.saveBrowserSession(ses); err != nil {
+			internalError(w, err)
+			return
+		}
 
 		usr, err := s.UserRepo.Get(nil, userID)
 		if err != nil {
@@ -259,8 +293,12 @@ func handleRegisterFunc(s *Server, tpl Template) http.HandlerFunc {
 			}
 		}
 
-		w.Header().Set("Location", makeClientRedirectURL(
-			ses.RedirectURL, code, ses.ClientState).String())
+		redirURL, err := s.finishLoginURL(ses, code)
+		if err != nil {
+			internalError(w, err)
+			return
+		}
+		w.Header().Set("Location", redirURL)
 		w.WriteHeader(http.StatusSeeOther)
 		return
 	}
@@ -283,7 +321,7 @@ func registerFromLocalConnector(userManager *usermanager.UserManager, sessionMan
 
 	ses, err = sessionManager.AttachRemoteIdentity(ses.ID, oidc.Identity{
 		ID: userID,
-	})
+	}, nil)
 	if err != nil {
 		return "", err
 	}
@@ -352,6 +390,19 @@ func newLoginURLFromSession(issuer url.URL, ses *session.Session, register bool,
 	if len(ses.Scope) > 0 {
 		v.Set("scope", strings.Join(ses.Scope, " "))
 	}
+	if ses.Nonce != "" {
+		v.Set("nonce", ses.Nonce)
+	}
+	if ses.ResponseType != "" {
+		v.Set("response_type", ses.ResponseType)
+	}
+	if ses.CodeChallenge != "" {
+		v.Set("code_challenge", ses.CodeChallenge)
+		v.Set("code_challenge_method", ses.CodeChallengeMethod)
+	}
+	if len(ses.ClaimsRequest.IDToken) > 0 || len(ses.ClaimsRequest.UserInfo) > 0 {
+		v.Set("claims", encodeClaimsRequest(ses.ClaimsRequest))
+	}
 
 	loginURL.RawQuery = v.Encode()
 	return &loginURL
@@ -12,6 +12,7 @@ import (
 	"github.com/kylelemons/godebug/pretty"
 
 	"github.com/coreos/dex/pkg/html"
+	"github.com/coreos/dex/session"
 	"github.com/coreos/dex/user"
 	"github.com/coreos/go-oidc/oidc"
 )
@@ -105,11 +106,12 @@ func TestHandleRegister(t *testing.T) {
 						"state": []string{""},
 					}).String(),
 					Register: newURLWithParams(testIssuerAuth, url.Values{
-						"client_id":    []string{testClientID},
-						"redirect_uri": []string{testRedirectURL.String()},
-						"register":     []string{"1"},
-						"scope":        []string{"openid"},
-						"state":        []string{""},
+						"client_id":     []string{testClientID},
+						"redirect_uri":  []string{testRedirectURL.String()},
+						"register":      []string{"1"},
+						"response_type": []string{"code"},
+						"scope":         []string{"openid"},
+						"state":         []string{""},
 					}).String(),
 				},
 			},
@@ -295,7 +297,14 @@ func TestHandleRegister(t *testing.T) {
 				})
 		}
 
-		key, err := f.srv.NewSession(tt.connID, testClientID, "", f.redirectURL, "", true, []string{"openid"})
+		key, err := f.srv.NewSession(session.SessionRequest{
+			ConnectorID:  tt.connID,
+			ClientID:     testClientID,
+			RedirectURL:  f.redirectURL,
+			Register:     true,
+			Scope:        []string{"openid"},
+			ResponseType: "code",
+		})
 		t.Logf("case %d: key for NewSession: %v", i, key)
 
 		if tt.attachRemote {
@@ -311,7 +320,7 @@ func TestHandleRegister(t *testing.T) {
 			_, err = f.sessionManager.AttachRemoteIdentity(ses.ID, oidc.Identity{
 				ID:    "remoteID",
 				Email: tt.remoteIdentityEmail,
-			})
+			}, nil)
 
 			key, err := f.sessionManager.NewSessionKey(sesID)
 			if err != nil {
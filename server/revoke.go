@@ -0,0 +1,125 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/coreos/go-oidc/oauth2"
+	"github.com/coreos/go-oidc/oidc"
+
+	"github.com/coreos/dex/access"
+	phttp "github.com/coreos/dex/pkg/http"
+	"github.com/coreos/dex/pkg/log"
+	"github.com/coreos/dex/refresh"
+)
+
+type tokenKind int
+
+const (
+	tokenKindAccess tokenKind = iota
+	tokenKindRefresh
+	tokenKindJWT
+)
+
+// classifyToken tells the kinds of tokens dex issues apart by their format:
+// refresh tokens contain the refresh.TokenDelimer, JWTs are dot separated and
+// opaque access tokens, being unpadded base64url, contain neither. This makes
+// the token_type_hint parameter of the revocation and introspection
+// endpoints unnecessary, so it's ignored, as RFC 7009 and RFC 7662 allow.
+func classifyToken(token string) tokenKind {
+	switch {
+	case strings.Contains(token, refresh.TokenDelimer):
+		return tokenKindRefresh
+	case strings.Contains(token, "."):
+		return tokenKindJWT
+	default:
+		return tokenKindAccess
+	}
+}
+
+// RevokeToken revokes a refresh or access token issued to the client, as
+// described in RFC 7009. Unknown tokens and tokens issued to other clients
+// are ignored, so as not to tell the client anything about them.
+func (s *Server) RevokeToken(creds oidc.ClientCredentials, token string) error {
+	// Public clients may revoke their tokens too, RFC 7009 Section 5.
+	if err := s.authenticateClient(creds, true); err != nil {
+		return err
+	}
+
+	switch classifyToken(token) {
+	case tokenKindRefresh:
+		userID, err := s.RefreshTokenRepo.Verify(creds.ID, token)
+		switch err {
+		case nil:
+		case refresh.ErrorInvalidToken, refresh.ErrorInvalidClientID:
+			return nil
+		default:
+			log.Errorf("Failed to verify refresh token: %v", err)
+			return oauth2.NewError(oauth2.ErrorServerError)
+		}
+		if err := s.RefreshTokenRepo.Revoke(userID, token); err != nil && err != refresh.ErrorInvalidToken {
+			log.Errorf("Failed to revoke refresh token: %v", err)
+			return oauth2.NewError(oauth2.ErrorServerError)
+		}
+	case tokenKindAccess:
+		at, err := s.AccessTokenRepo.Get(token)
+		switch err {
+		case nil:
+		case access.ErrorInvalidToken:
+			return nil
+		default:
+			log.Errorf("Failed to fetch access token: %v", err)
+			return oauth2.NewError(oauth2.ErrorServerError)
+		}
+		if at.ClientID != creds.ID {
+			return nil
+		}
+		if err := s.AccessTokenRepo.Revoke(token); err != nil && err != access.ErrorInvalidToken {
+			log.Errorf("Failed to revoke access token: %v", err)
+			return oauth2.NewError(oauth2.ErrorServerError)
+		}
+	case tokenKindJWT:
+		// ID tokens and client credentials tokens are self-contained and
+		// remain valid until they expire.
+		return oauth2.NewError(errorUnsupportedTokenType)
+	}
+
+	log.Infof("Token revoked: clientID=%s", creds.ID)
+	return nil
+}
+
+func handleRevokeFunc(srv OIDCServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.Header().Set("Allow", "POST")
+			phttp.WriteError(w, http.StatusMethodNotAllowed, "POST only acceptable method")
+			return
+		}
+
+		err := r.ParseForm()
+		if err != nil {
+			log.Errorf("error parsing request: %v", err)
+			writeTokenError(w, oauth2.NewError(oauth2.ErrorInvalidRequest), "")
+			return
+		}
+
+		creds, err := clientCredentialsFromRequest(r, true)
+		if err != nil {
+			log.Errorf("error parsing client credentials: %v", err)
+			writeTokenError(w, oauth2.NewError(oauth2.ErrorInvalidClient), "")
+			return
+		}
+
+		token := r.PostForm.Get("token")
+		if token == "" {
+			writeTokenError(w, oauth2.NewError(oauth2.ErrorInvalidRequest), "")
+			return
+		}
+
+		if err := srv.RevokeToken(creds, token); err != nil {
+			writeTokenError(w, err, "")
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
@@ -0,0 +1,277 @@
+package server
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc/oauth2"
+	"github.com/coreos/go-oidc/oidc"
+
+	"github.com/coreos/dex/access"
+	"github.com/coreos/dex/client"
+	"github.com/coreos/dex/refresh"
+	"github.com/coreos/dex/refresh/refreshtest"
+)
+
+var (
+	testCreds = oidc.ClientCredentials{
+		ID:     testClientID,
+		Secret: base64.URLEncoding.EncodeToString([]byte("secret")),
+	}
+	testOtherCreds = oidc.ClientCredentials{
+		ID:     "other.example.com",
+		Secret: base64.URLEncoding.EncodeToString([]byte("secret")),
+	}
+	testPublicCreds = oidc.ClientCredentials{
+		ID: "public.example.com",
+	}
+)
+
+// makeTokenTestFixtures returns test fixtures with a refresh token repo and
+// two more clients, one of them public, to hold tokens.
+func makeTokenTestFixtures(t *testing.T) *testFixtures {
+	fx, err := makeTestFixtures()
+	if err != nil {
+		t.Fatalf("could not run test fixtures: %v", err)
+	}
+	fx.srv.RefreshTokenRepo = refreshtest.NewTestRefreshTokenRepo()
+
+	for _, cli := range []client.Client{
+		{
+			Credentials: testOtherCreds,
+			Metadata: oidc.ClientMetadata{
+				RedirectURIs: []url.URL{{Scheme: "http", Host: "other.example.com", Path: "/callback"}},
+			},
+		},
+		{
+			Credentials: oidc.ClientCredentials{
+				ID:     testPublicCreds.ID,
+				Secret: base64.URLEncoding.EncodeToString([]byte("unused")),
+			},
+			Metadata: oidc.ClientMetadata{
+				RedirectURIs: []url.URL{{Scheme: "http", Host: "public.example.com", Path: "/callback"}},
+			},
+			Public: true,
+		},
+	} {
+		if _, err := fx.clientRepo.New(nil, cli); err != nil {
+			t.Fatalf("could not create client %s: %v", cli.Credentials.ID, err)
+		}
+	}
+	return fx
+}
+
+func newTestAccessToken(t *testing.T, fx *testFixtures, clientID string) string {
+	now := time.Now()
+	token, err := fx.srv.AccessTokenRepo.Create(access.AccessToken{
+		UserID:    "ID-Verified",
+		ClientID:  clientID,
+		Scope:     []string{"openid"},
+		Audience:  fx.srv.IssuerURL.String(),
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("could not create access token: %v", err)
+	}
+	return token
+}
+
+func newTestRefreshToken(t *testing.T, fx *testFixtures, clientID string) string {
+	token, err := fx.srv.RefreshTokenRepo.Create("ID-Verified", clientID, []string{"openid", "offline_access"})
+	if err != nil {
+		t.Fatalf("could not create refresh token: %v", err)
+	}
+	return token
+}
+
+func TestServerRevokeToken(t *testing.T) {
+	tests := []struct {
+		creds oidc.ClientCredentials
+		// tokenOwner is the client the token is issued to.
+		tokenOwner  string
+		refresh     bool
+		wantErr     string
+		wantRevoked bool
+	}{
+		{
+			creds:       testCreds,
+			tokenOwner:  testClientID,
+			wantRevoked: true,
+		},
+		{
+			creds:       testCreds,
+			tokenOwner:  testClientID,
+			refresh:     true,
+			wantRevoked: true,
+		},
+		{
+			creds:       testPublicCreds,
+			tokenOwner:  testPublicCreds.ID,
+			refresh:     true,
+			wantRevoked: true,
+		},
+		// tokens held by other clients are left alone
+		{
+			creds:      testOtherCreds,
+			tokenOwner: testClientID,
+		},
+		{
+			creds:      testOtherCreds,
+			tokenOwner: testClientID,
+			refresh:    true,
+		},
+		// bad client credentials
+		{
+			creds:      oidc.ClientCredentials{ID: testClientID, Secret: "bad"},
+			tokenOwner: testClientID,
+			wantErr:    oauth2.ErrorInvalidClient,
+		},
+		// confidential client without a secret
+		{
+			creds:      oidc.ClientCredentials{ID: testClientID},
+			tokenOwner: testClientID,
+			wantErr:    oauth2.ErrorInvalidClient,
+		},
+	}
+
+	for i, tt := range tests {
+		fx := makeTokenTestFixtures(t)
+
+		var token string
+		if tt.refresh {
+			token = newTestRefreshToken(t, fx, tt.tokenOwner)
+		} else {
+			token = newTestAccessToken(t, fx, tt.tokenOwner)
+		}
+
+		err := fx.srv.RevokeToken(tt.creds, token)
+		if tt.wantErr != "" {
+			oerr, ok := err.(*oauth2.Error)
+			if !ok || oerr.Type != tt.wantErr {
+				t.Errorf("case %d: want err %q, got %v", i, tt.wantErr, err)
+			}
+		} else if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+
+		var revoked bool
+		if tt.refresh {
+			_, err = fx.srv.RefreshTokenRepo.Verify(tt.tokenOwner, token)
+			revoked = err == refresh.ErrorInvalidToken
+		} else {
+			_, err = fx.srv.AccessTokenRepo.Get(token)
+			revoked = err == access.ErrorInvalidToken
+		}
+		if revoked != tt.wantRevoked {
+			t.Errorf("case %d: want revoked=%t, got revoked=%t", i, tt.wantRevoked, revoked)
+		}
+	}
+}
+
+func TestServerRevokeTokenUnsupported(t *testing.T) {
+	fx := makeTokenTestFixtures(t)
+
+	jwt, err := fx.srv.ClientCredsToken(testCreds)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = fx.srv.RevokeToken(testCreds, jwt.Encode())
+	if oerr, ok := err.(*oauth2.Error); !ok || oerr.Type != errorUnsupportedTokenType {
+		t.Errorf("want err %q, got %v", errorUnsupportedTokenType, err)
+	}
+
+	// Unknown tokens are ignored.
+	if err := fx.srv.RevokeToken(testCreds, "bogus"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestHandleRevokeFunc(t *testing.T) {
+	fx := makeTokenTestFixtures(t)
+
+	tests := []struct {
+		method   string
+		form     url.Values
+		user     string
+		passwd   string
+		wantCode int
+	}{
+		{
+			method:   "POST",
+			form:     url.Values{"token": {newTestAccessToken(t, fx, testClientID)}},
+			user:     testCreds.ID,
+			passwd:   testCreds.Secret,
+			wantCode: http.StatusOK,
+		},
+		// public client
+		{
+			method: "POST",
+			form: url.Values{
+				"token":     {newTestRefreshToken(t, fx, testPublicCreds.ID)},
+				"client_id": {testPublicCreds.ID},
+			},
+			wantCode: http.StatusOK,
+		},
+		// unknown token
+		{
+			method:   "POST",
+			form:     url.Values{"token": {"bogus"}},
+			user:     testCreds.ID,
+			passwd:   testCreds.Secret,
+			wantCode: http.StatusOK,
+		},
+		// missing token
+		{
+			method:   "POST",
+			form:     url.Values{},
+			user:     testCreds.ID,
+			passwd:   testCreds.Secret,
+			wantCode: http.StatusBadRequest,
+		},
+		// no client credentials
+		{
+			method:   "POST",
+			form:     url.Values{"token": {"bogus"}},
+			wantCode: http.StatusUnauthorized,
+		},
+		// bad client credentials
+		{
+			method:   "POST",
+			form:     url.Values{"token": {"bogus"}},
+			user:     testCreds.ID,
+			passwd:   "bad",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			method:   "GET",
+			wantCode: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for i, tt := range tests {
+		hdlr := handleRevokeFunc(fx.srv)
+		req, err := http.NewRequest(tt.method, "http://example.com/revoke", strings.NewReader(tt.form.Encode()))
+		if err != nil {
+			t.Errorf("case %d: unable to create HTTP request: %v", i, err)
+			continue
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if tt.user != "" {
+			req.SetBasicAuth(tt.user, tt.passwd)
+		}
+
+		w := httptest.NewRecorder()
+		hdlr.ServeHTTP(w, req)
+		if tt.wantCode != w.Code {
+			t.Errorf("case %d: expected HTTP %d, got %d", i, tt.wantCode, w.Code)
+		}
+	}
+}
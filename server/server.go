@@ -1,13 +1,18 @@
 package server
 
 import (
-	"errors"
-	"fmt"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"hash"
 	"html/template"
 	"net/http"
 	"net/url"
 	"path"
 	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/coreos/go-oidc/jose"
@@ -17,10 +22,16 @@ import (
 	"github.com/coreos/pkg/health"
 	"github.com/go-gorp/gorp"
 	"github.com/jonboulle/clockwork"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
+	"github.com/coreos/dex/access"
+	"github.com/coreos/dex/audit"
 	"github.com/coreos/dex/client"
 	clientmanager "github.com/coreos/dex/client/manager"
 	"github.com/coreos/dex/connector"
+	"github.com/coreos/dex/consent"
+	"github.com/coreos/dex/lockout"
+	"github.com/coreos/dex/mfa"
 	"github.com/coreos/dex/pkg/log"
 	"github.com/coreos/dex/refresh"
 	"github.com/coreos/dex/session"
@@ -37,23 +48,71 @@ const (
 	VerifyEmailTemplateName            = "verify-email.html"
 	SendResetPasswordEmailTemplateName = "send-reset-password.html"
 	ResetPasswordTemplateName          = "reset-password.html"
+	LogoutTemplateName                 = "logout.html"
+	ConsentTemplateName                = "consent.html"
+	AccountTemplateName                = "account.html"
+	LinkAccountTemplateName            = "link-account.html"
 
 	APIVersion = "v1"
 )
 
+// authMethodNone is the token endpoint auth method of public clients, which
+// don't authenticate with a secret. It isn't advertised in the discovery
+// document, as go-oidc rejects provider configs listing it.
+const authMethodNone = "none"
+
+var supportedResponseTypes = []string{
+	oauth2.ResponseTypeCode,
+	oauth2.ResponseTypeIDToken,
+	oauth2.ResponseTypeIDTokenToken,
+	oauth2.ResponseTypeCodeIDToken,
+	oauth2.ResponseTypeCode + " " + oauth2.ResponseTypeToken,
+	oauth2.ResponseTypeCodeIDTokenToken,
+}
+
 type OIDCServer interface {
 	ClientMetadata(string) (*oidc.ClientMetadata, error)
-	NewSession(connectorID, clientID, clientState string, redirectURL url.URL, nonce string, register bool, scope []string) (string, error)
-	Login(oidc.Identity, string) (string, error)
-	// CodeToken exchanges a code for an ID token and a refresh token string on success.
-	CodeToken(creds oidc.ClientCredentials, sessionKey string) (*jose.JWT, string, error)
+	NewSession(req session.SessionRequest) (string, error)
+	// SetSessionRemoteIP records the address the user-agent of the session
+	// with the given key connects from, for auditing its login.
+	SetSessionRemoteIP(sessionKey, ip string) error
+	// StartBrowserSession, BrowserSession and BrowserLogin implement single
+	// sign-on with dex's browser sessions; see the Server methods.
+	StartBrowserSession(sessionKey string) (token string, expiresAt time.Time, err error)
+	BrowserSession(token, clientID string) (*session.BrowserSession, error)
+	BrowserLogin(bs *session.BrowserSession, sessionKey string) (string, error)
+	// ConsentRequired and SetSessionPromptConsent decide whether users are
+	// asked to consent to the scopes clients request; see the Server methods.
+	ConsentRequired(userID, clientID string, scope []string) (bool, error)
+	SetSessionPromptConsent(sessionKey string) error
+	Login(oidc.Identity, []string, string) (string, error)
+	// CodeToken exchanges a code for an ID token, an access token and, if offline
+	// access was requested, a refresh token.
+	// The code verifier is required if the code was issued with a PKCE code challenge.
+	CodeToken(creds oidc.ClientCredentials, sessionKey, codeVerifier string) (*IssuedTokens, error)
 	ClientCredsToken(creds oidc.ClientCredentials) (*jose.JWT, error)
-	// RefreshToken takes a previously generated refresh token and returns a new ID token
-	// if the token is valid.
-	RefreshToken(creds oidc.ClientCredentials, token string) (*jose.JWT, error)
+	// RefreshToken takes a previously generated refresh token and returns a new ID token,
+	// access token and refresh token if the token is valid. The old refresh token is retired.
+	RefreshToken(creds oidc.ClientCredentials, token string) (*IssuedTokens, error)
+	// RevokeToken revokes a refresh or access token held by the client.
+	RevokeToken(creds oidc.ClientCredentials, token string) error
+	// IntrospectToken describes a token issued by dex to the client.
+	IntrospectToken(creds oidc.ClientCredentials, token string) (*TokenIntrospection, error)
 	KillSession(string) error
 }
 
+// IssuedTokens are the tokens the token endpoint hands to a client.
+type IssuedTokens struct {
+	IDToken *jose.JWT
+
+	// AccessToken is an opaque token which can be presented to the UserInfo
+	// endpoint. It expires after AccessTokenExpiresIn.
+	AccessToken          string
+	AccessTokenExpiresIn time.Duration
+
+	RefreshToken string
+}
+
 type JWTVerifierFactory func(clientID string) oidc.JWTVerifier
 
 type Server struct {
@@ -69,19 +128,82 @@ type Server struct {
 	VerifyEmailTemplate            *template.Template
 	SendResetPasswordEmailTemplate *template.Template
 	ResetPasswordTemplate          *template.Template
+	LogoutTemplate                 *template.Template
+	ConsentTemplate                *template.Template
+	AccountTemplate                *template.Template
+	LinkAccountTemplate            *template.Template
 	HealthChecks                   []health.Checkable
 	Connectors                     []connector.Connector
 	UserRepo                       user.UserRepo
 	UserManager                    *usermanager.UserManager
+	GroupRepo                      user.GroupRepo
+	GroupManager                   *usermanager.GroupManager
 	ClientManager                  *clientmanager.ClientManager
 	PasswordInfoRepo               user.PasswordInfoRepo
 	RefreshTokenRepo               refresh.RefreshTokenRepo
+	AccessTokenRepo                access.AccessTokenRepo
 	UserEmailer                    *useremail.UserEmailer
+	LoginGuard                     *lockout.Guard
+	MFA                            *mfa.Authenticator
+	Audit                          *audit.Logger
 	EnableRegistration             bool
 	EnableClientRegistration       bool
 
-	dbMap            *gorp.DbMap
-	localConnectorID string
+	// BrowserSessionRepo holds the browser sessions used for single sign-on,
+	// which last for BrowserSessionValidityWindow, or
+	// session.DefaultBrowserSessionValidityWindow if it's zero. Single
+	// sign-on is disabled if BrowserSessionRepo is nil.
+	BrowserSessionRepo           session.BrowserSessionRepo
+	BrowserSessionValidityWindow time.Duration
+
+	// ClientRegistrationPolicy restricts dynamic client registration, and
+	// InitialAccessTokenRepo holds the initial access tokens it may require.
+	ClientRegistrationPolicy ClientRegistrationPolicy
+	InitialAccessTokenRepo   client.InitialAccessTokenRepo
+
+	// ConsentGrantRepo holds the scopes users consented to clients
+	// requesting. Users are only asked for consent if it's set.
+	ConsentGrantRepo consent.GrantRepo
+
+	// AccountClientID is the client the account portal logs users in with.
+	// The portal is only served if it's set and single sign-on is enabled,
+	// as it identifies users by their browser sessions.
+	AccountClientID string
+
+	// AutoLinkTrustedEmails links the remote identity a user logs in with to
+	// the existing user with the same email, without asking the user to
+	// prove they own that account, if the connector is a trusted email
+	// provider and the existing user's email is verified. Otherwise users
+	// link their accounts on the link account page.
+	AutoLinkTrustedEmails bool
+
+	// AccessTokenValidityWindow is the lifetime of issued access tokens. If
+	// zero, access.DefaultAccessTokenValidityWindow is used.
+	AccessTokenValidityWindow time.Duration
+
+	// AccessTokenAudience is the audience access tokens are issued for. If
+	// empty, the issuer URL is used.
+	AccessTokenAudience string
+
+	// ConnectorReloadInterval is how often the running server checks the
+	// ConnectorConfigRepo for changed connectors. If zero, connectors are
+	// only loaded at startup.
+	ConnectorReloadInterval time.Duration
+
+	// refreshTokenOptions configure the refresh token repo.
+	refreshTokenOptions refresh.RepoOptions
+
+	dbMap *gorp.DbMap
+
+	// connectorsMu guards Connectors and the state of the connectors below
+	// once the server is serving requests, as ReloadConnectors replaces them.
+	connectorsMu       sync.RWMutex
+	connectorsReloadMu sync.Mutex
+	localConnectorID   string
+	connectorConfigs   map[string]connector.ConnectorConfig
+	connectorRoutes    *http.ServeMux
+	connectorStops     map[string]chan struct{}
+	connectorReloadErr error
 }
 
 func (s *Server) Run() chan struct{} {
@@ -91,8 +213,9 @@ func (s *Server) Run() chan struct{} {
 		key.NewKeySetSyncer(s.KeySetRepo, s.KeyManager).Run(),
 	}
 
-	for _, idpc := range s.Connectors {
-		chans = append(chans, idpc.Sync())
+	s.startConnectors()
+	if s.ConnectorReloadInterval > 0 && s.ConnectorConfigRepo != nil {
+		chans = append(chans, s.watchConnectors(s.ConnectorReloadInterval))
 	}
 
 	go func() {
@@ -100,6 +223,7 @@ func (s *Server) Run() chan struct{} {
 		for _, ch := range chans {
 			close(ch)
 		}
+		s.stopConnectors()
 	}()
 
 	return stop
@@ -120,17 +244,22 @@ func (s *Server) ProviderConfig() oidc.ProviderConfig {
 	authEndpoint := s.absURL(httpPathAuth)
 	tokenEndpoint := s.absURL(httpPathToken)
 	keysEndpoint := s.absURL(httpPathKeys)
+	userInfoEndpoint := s.absURL(httpPathUserInfo)
 	cfg := oidc.ProviderConfig{
-		Issuer:        &s.IssuerURL,
-		AuthEndpoint:  &authEndpoint,
-		TokenEndpoint: &tokenEndpoint,
-		KeysEndpoint:  &keysEndpoint,
-
-		GrantTypesSupported:               []string{oauth2.GrantTypeAuthCode, oauth2.GrantTypeClientCreds},
-		ResponseTypesSupported:            []string{"code"},
+		Issuer:           &s.IssuerURL,
+		AuthEndpoint:     &authEndpoint,
+		TokenEndpoint:    &tokenEndpoint,
+		UserInfoEndpoint: &userInfoEndpoint,
+		KeysEndpoint:     &keysEndpoint,
+
+		GrantTypesSupported:               []string{oauth2.GrantTypeAuthCode, oauth2.GrantTypeImplicit, oauth2.GrantTypeClientCreds},
+		ResponseTypesSupported:            supportedResponseTypes,
 		SubjectTypesSupported:             []string{"public"},
 		IDTokenSigningAlgValues:           []string{"RS256"},
 		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic"},
+		ScopesSupported:                   supportedScopes,
+		ClaimsSupported:                   supportedClaims,
+		ClaimsParameterSupported:          true,
 	}
 
 	if s.EnableClientRegistration {
@@ -138,9 +267,32 @@ func (s *Server) ProviderConfig() oidc.ProviderConfig {
 		cfg.RegistrationEndpoint = &regEndpoint
 	}
 
+	if s.MFA != nil {
+		cfg.ACRValuesSupported = []string{mfa.ACRMFA}
+	}
+
 	return cfg
 }
 
+// providerMetadata returns the discovery document, which includes metadata
+// oidc.ProviderConfig has no fields for.
+func (s *Server) providerMetadata() providerMetadata {
+	revocationEndpoint := s.absURL(httpPathRevoke)
+	introspectionEndpoint := s.absURL(httpPathIntrospect)
+	endSessionEndpoint := s.absURL(httpPathEndSession)
+	return providerMetadata{
+		ProviderConfig: s.ProviderConfig(),
+
+		RevocationEndpoint:               &revocationEndpoint,
+		RevocationEndpointAuthMethods:    []string{"client_secret_basic", authMethodNone},
+		IntrospectionEndpoint:            &introspectionEndpoint,
+		IntrospectionEndpointAuthMethods: []string{"client_secret_basic"},
+		EndSessionEndpoint:               &endSessionEndpoint,
+		FrontChannelLogoutSupported:      true,
+		BackChannelLogoutSupported:       true,
+	}
+}
+
 func (s *Server) absURL(paths ...string) url.URL {
 	url := s.IssuerURL
 	paths = append([]string{url.Path}, paths...)
@@ -148,40 +300,27 @@ func (s *Server) absURL(paths ...string) url.URL {
 	return url
 }
 
+// AddConnector builds the connector configured by cfg and adds it to the
+// connectors in use. It's meant for setting up the server; use
+// ReloadConnectors to change the connectors of a running server.
 func (s *Server) AddConnector(cfg connector.ConnectorConfig) error {
 	connectorID := cfg.ConnectorID()
-	ns := s.IssuerURL
-	ns.Path = path.Join(ns.Path, httpPathAuth, connectorID)
-
-	idpc, err := cfg.Connector(ns, s.Login, s.Templates)
+	idpc, err := s.newConnector(cfg)
 	if err != nil {
 		return err
 	}
 
-	s.Connectors = append(s.Connectors, idpc)
-
-	sortable := sortableIDPCs(s.Connectors)
-	sort.Sort(sortable)
-
-	// We handle the LocalConnector specially because it needs access to the
-	// UserRepo and the PasswordInfoRepo; if it turns out that other connectors
-	// need access to these resources we'll figure out how to provide it in a
-	// cleaner manner.
-	localConn, ok := idpc.(*connector.LocalConnector)
-	if ok {
+	s.connectorsMu.Lock()
+	defer s.connectorsMu.Unlock()
+	idpcs := append(append([]connector.Connector{}, s.Connectors...), idpc)
+	sort.Sort(sortableIDPCs(idpcs))
+	s.Connectors = idpcs
+	if s.connectorConfigs == nil {
+		s.connectorConfigs = make(map[string]connector.ConnectorConfig)
+	}
+	s.connectorConfigs[connectorID] = cfg
+	if _, ok := idpc.(*connector.LocalConnector); ok {
 		s.localConnectorID = connectorID
-		if s.UserRepo == nil {
-			return errors.New("UserRepo cannot be nil")
-		}
-
-		if s.PasswordInfoRepo == nil {
-			return errors.New("PasswordInfoRepo cannot be nil")
-		}
-
-		localConn.SetLocalIdentityProvider(&connector.LocalIdentityProvider{
-			UserRepo:         s.UserRepo,
-			PasswordInfoRepo: s.PasswordInfoRepo,
-		})
 	}
 
 	log.Infof("Loaded IdP connector: id=%s type=%s", connectorID, cfg.ConnectorType())
@@ -191,17 +330,29 @@ func (s *Server) AddConnector(cfg connector.ConnectorConfig) error {
 func (s *Server) HTTPHandler() http.Handler {
 	checks := make([]health.Checkable, len(s.HealthChecks))
 	copy(checks, s.HealthChecks)
-	for _, idpc := range s.Connectors {
-		idpc := idpc
-		checks = append(checks, idpc)
-	}
+	checks = append(checks, connectorsHealth{s})
 
 	clock := clockwork.NewRealClock()
 	mux := http.NewServeMux()
-	mux.HandleFunc(httpPathDiscovery, handleDiscoveryFunc(s.ProviderConfig()))
-	mux.HandleFunc(httpPathAuth, handleAuthFunc(s, s.Connectors, s.LoginTemplate, s.EnableRegistration))
+	mux.HandleFunc(httpPathDiscovery, handleDiscoveryFunc(s.providerMetadata()))
+	mux.HandleFunc(httpPathAuth, s.handleAuth)
 	mux.HandleFunc(httpPathToken, handleTokenFunc(s))
+	mux.HandleFunc(httpPathUserInfo, handleUserInfoFunc(s.AccessTokenRepo, s.UserRepo, s.GroupRepo))
+	mux.HandleFunc(httpPathRevoke, handleRevokeFunc(s))
+	mux.HandleFunc(httpPathIntrospect, handleIntrospectFunc(s))
 	mux.HandleFunc(httpPathKeys, handleKeysFunc(s.KeyManager, clock))
+	mux.HandleFunc(httpPathEndSession, s.handleEndSession)
+	if s.ConsentGrantRepo != nil {
+		mux.HandleFunc(httpPathConsent, s.handleConsent)
+	}
+	if s.AccountClientID != "" && s.BrowserSessionRepo != nil {
+		mux.HandleFunc(httpPathAccount, s.handleAccount)
+		mux.HandleFunc(httpPathAccountCallback, s.handleAccountCallback)
+	}
+	mux.HandleFunc(httpPathLinkAccount, s.handleLinkAccount)
+	if s.BrowserSessionRepo != nil {
+		mux.HandleFunc(httpPathBrowserSession, s.handleBrowserSession)
+	}
 	mux.Handle(httpPathHealth, makeHealthHandler(checks))
 
 	if s.EnableRegistration {
@@ -229,6 +380,7 @@ func (s *Server) HTTPHandler() http.Handler {
 		issuerURL: s.IssuerURL,
 		um:        s.UserManager,
 		keysFunc:  s.KeyManager.PublicKeys,
+		audit:     s.Audit,
 	})
 
 	mux.Handle(httpPathAcceptInvitation, &InvitationHandler{
@@ -242,18 +394,18 @@ func (s *Server) HTTPHandler() http.Handler {
 
 	if s.EnableClientRegistration {
 		mux.HandleFunc(httpPathClientRegistration, s.handleClientRegistration)
+		mux.HandleFunc(httpPathClientRegistration+"/", s.handleClientConfiguration)
 	}
 
 	mux.HandleFunc(httpPathDebugVars, health.ExpvarHandler)
+	mux.Handle(httpPathMetrics, promhttp.Handler())
 
-	pcfg := s.ProviderConfig()
-	for _, idpc := range s.Connectors {
-		errorURL, err := url.Parse(fmt.Sprintf("%s?connector_id=%s", pcfg.AuthEndpoint, idpc.ID()))
-		if err != nil {
-			log.Fatal(err)
-		}
-		idpc.Register(mux, *errorURL)
-	}
+	// The connectors' routes aren't registered with mux, so that they can be
+	// replaced when the connectors are reloaded.
+	s.connectorsMu.Lock()
+	s.connectorRoutes = s.connectorMux(s.Connectors)
+	s.connectorsMu.Unlock()
+	mux.HandleFunc("/", s.serveConnectors)
 
 	apiBasePath := path.Join(httpPathAPI, APIVersion)
 	registerDiscoveryResource(apiBasePath, mux)
@@ -261,12 +413,22 @@ func (s *Server) HTTPHandler() http.Handler {
 	clientPath, clientHandler := registerClientResource(apiBasePath, s.ClientManager)
 	mux.Handle(path.Join(apiBasePath, clientPath), s.NewClientTokenAuthHandler(clientHandler))
 
-	usersAPI := usersapi.NewUsersAPI(s.UserManager, s.ClientManager, s.RefreshTokenRepo, s.UserEmailer, s.localConnectorID)
-	handler := NewUserMgmtServer(usersAPI, s.JWTVerifierFactory(), s.UserManager, s.ClientManager).HTTPHandler()
+	handler := NewUserMgmtServer(s.usersAPI(), s.JWTVerifierFactory(), s.UserManager, s.ClientManager).HTTPHandler()
 
 	mux.Handle(apiBasePath+"/", handler)
 
-	return http.Handler(mux)
+	return instrumentMux(mux, func(pattern string) *http.ServeMux {
+		if pattern != "/" {
+			return nil
+		}
+		s.connectorsMu.RLock()
+		defer s.connectorsMu.RUnlock()
+		return s.connectorRoutes
+	})
+}
+
+func (s *Server) usersAPI() *usersapi.UsersAPI {
+	return usersapi.NewUsersAPI(s.UserManager, s.ClientManager, s.RefreshTokenRepo, s.UserEmailer, s.Audit, s.currentLocalConnectorID)
 }
 
 // NewClientTokenAuthHandler returns the given handler wrapped in middleware which requires a Client Bearer token.
@@ -283,23 +445,33 @@ func (s *Server) ClientMetadata(clientID string) (*oidc.ClientMetadata, error) {
 	return s.ClientManager.Metadata(clientID)
 }
 
-func (s *Server) NewSession(ipdcID, clientID, clientState string, redirectURL url.URL, nonce string, register bool, scope []string) (string, error) {
-	sessionID, err := s.SessionManager.NewSession(ipdcID, clientID, clientState, redirectURL, nonce, register, scope)
+func (s *Server) NewSession(req session.SessionRequest) (string, error) {
+	sessionID, err := s.SessionManager.NewSession(req)
 	if err != nil {
 		return "", err
 	}
 
-	log.Infof("Session %s created: clientID=%s clientState=%s", sessionID, clientID, clientState)
+	log.Infof("Session %s created: clientID=%s clientState=%s", sessionID, req.ClientID, req.ClientState)
 	return s.SessionManager.NewSessionKey(sessionID)
 }
 
-func (s *Server) Login(ident oidc.Identity, key string) (string, error) {
+func (s *Server) SetSessionRemoteIP(key, ip string) error {
+	sessionID, err := s.SessionManager.PeekKey(key)
+	if err != nil {
+		return err
+	}
+	_, err = s.SessionManager.SetRemoteIP(sessionID, ip)
+	return err
+}
+
+// Login is the connector.LoginFunc of the server's connectors.
+func (s *Server) Login(ident oidc.Identity, groups []string, key string) (string, error) {
 	sessionID, err := s.SessionManager.ExchangeKey(key)
 	if err != nil {
 		return "", err
 	}
 
-	ses, err := s.SessionManager.AttachRemoteIdentity(sessionID, ident)
+	ses, err := s.SessionManager.AttachRemoteIdentity(sessionID, ident, groups)
 	if err != nil {
 		return "", err
 	}
@@ -325,45 +497,194 @@ func (s *Server) Login(ident oidc.Identity, key string) (string, error) {
 	})
 	if err == user.ErrorNotFound {
 		// Does the user have an existing account with a different connector?
-		if ses.Identity.Email != "" {
-			connID, err := getConnectorForUserByEmail(s.UserRepo, ses.Identity.Email)
-			if err == nil {
-				// Ask user to sign in through existing account.
-				u := newLoginURLFromSession(s.IssuerURL, ses, false, []string{connID}, "wrong-connector")
-				return u.String(), nil
-			}
+		usr, err = s.existingUserByEmail(ses.Identity.Email)
+		if err == user.ErrorNotFound {
+			// User doesn't have an existing account. Ask them to register.
+			u := newLoginURLFromSession(s.IssuerURL, ses, true, []string{ses.ConnectorID}, "register-maybe")
+			return u.String(), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if usr.Disabled {
+			return "", s.rejectDisabledUser(ses, usr)
 		}
 
-		// User doesn't have an existing account. Ask them to register.
-		u := newLoginURLFromSession(s.IssuerURL, ses, true, []string{ses.ConnectorID}, "register-maybe")
-		return u.String(), nil
+		if !s.canAutoLink(ses, usr) {
+			// Ask the user to prove they own the existing account first.
+			return s.linkAccountURL(ses)
+		}
+		if err = s.linkRemoteIdentity(ses, usr, linkProofTrustedEmail); err != nil {
+			return "", err
+		}
 	}
 	if err != nil {
 		return "", err
 	}
 
+	return s.loginUser(ses, usr)
+}
+
+// loginUser finishes the login of the user, whose remote identity is
+// attached to the session, and returns the URL the user-agent is sent to
+// next.
+func (s *Server) loginUser(ses *session.Session, usr user.User) (string, error) {
 	if usr.Disabled {
-		return "", user.ErrorNotFound
+		return "", s.rejectDisabledUser(ses, usr)
+	}
+
+	if err := s.checkMFA(ses); err != nil {
+		return "", err
 	}
 
-	ses, err = s.SessionManager.AttachUser(sessionID, usr.ID)
+	if err := s.syncGroups(ses, usr.ID); err != nil {
+		return "", err
+	}
+
+	ses, err := s.SessionManager.AttachUser(ses.ID, usr.ID)
 	if err != nil {
 		return "", err
 	}
-	log.Infof("Session %s user identified: clientID=%s user=%#v", sessionID, ses.ClientID, usr)
+	log.Infof("Session %s user identified: clientID=%s user=%#v", ses.ID, ses.ClientID, usr)
+	if err = s.saveBrowserSession(ses); err != nil {
+		return "", err
+	}
+	s.Audit.Record(audit.Event{
+		Type:        audit.EventLoginSucceeded,
+		UserID:      usr.ID,
+		ClientID:    ses.ClientID,
+		ConnectorID: ses.ConnectorID,
+		IP:          ses.RemoteIP,
+	})
+
+	return s.finishLoginURL(ses, "")
+}
+
+// rejectDisabledUser records the failed login of a disabled user, and
+// returns the error the login fails with.
+func (s *Server) rejectDisabledUser(ses *session.Session, usr user.User) error {
+	s.Audit.Record(audit.Event{
+		Type:        audit.EventLoginFailed,
+		UserID:      usr.ID,
+		ClientID:    ses.ClientID,
+		ConnectorID: ses.ConnectorID,
+		IP:          ses.RemoteIP,
+		Details:     map[string]string{"reason": "user disabled"},
+	})
+	return user.ErrorNotFound
+}
+
+// syncGroups syncs the upstream groups of the user the connector passed along
+// with the session's remote identity. Connectors which don't know upstream
+// groups pass none, so the user keeps no memberships attributed to them.
+func (s *Server) syncGroups(ses *session.Session, userID string) error {
+	if err := s.GroupManager.SyncConnectorGroups(userID, ses.ConnectorID, ses.Groups); err != nil {
+		return err
+	}
+	log.Infof("Session %s groups synced from connector %q: user=%s groups=%v", ses.ID, ses.ConnectorID, userID, ses.Groups)
+	return nil
+}
+
+// clientRedirectURL returns the URL the user-agent is sent back to once the
+// session has identified a user. For the "code" response type the code and
+// state are passed in the query; implicit and hybrid response types pass
+// everything, including any tokens, in the fragment. If the response type
+// requires a code and none is given, a new session key is generated.
+func (s *Server) clientRedirectURL(ses *session.Session, code string) (string, error) {
+	var err error
+	if code == "" && ses.HasResponseType(oauth2.ResponseTypeCode) {
+		if code, err = s.SessionManager.NewSessionKey(ses.ID); err != nil {
+			return "", err
+		}
+	}
+
+	if ses.ResponseType == "" || ses.ResponseType == oauth2.ResponseTypeCode {
+		return makeClientRedirectURL(ses.RedirectURL, code, ses.ClientState).String(), nil
+	}
+
+	v := url.Values{}
+	v.Set("state", ses.ClientState)
+	if ses.HasResponseType(oauth2.ResponseTypeCode) {
+		v.Set("code", code)
+	} else {
+		// No code will ever be exchanged for this session, so it ends here.
+		if _, err = s.SessionManager.Kill(ses.ID); err != nil {
+			return "", err
+		}
+	}
 
-	code, err := s.SessionManager.NewSessionKey(sessionID)
+	signer, err := s.KeyManager.Signer()
+	if err != nil {
+		return "", err
+	}
+
+	usr, err := s.UserRepo.Get(nil, ses.UserID)
 	if err != nil {
 		return "", err
 	}
 
+	var accessToken string
+	if ses.HasResponseType(oauth2.ResponseTypeToken) {
+		var expiresIn time.Duration
+		accessToken, expiresIn, err = s.newAccessToken(ses.UserID, ses.ClientID, ses.Scope, ses.ClaimsRequest.UserInfo)
+		if err != nil {
+			return "", err
+		}
+
+		v.Set("access_token", accessToken)
+		v.Set("token_type", "bearer")
+		v.Set("expires_in", strconv.Itoa(int(expiresIn.Seconds())))
+	}
+
+	if ses.HasResponseType(oauth2.ResponseTypeIDToken) {
+		claims := ses.Claims(s.IssuerURL.String())
+		usr.AddScopedClaims(claims, ses.Scope, ses.ClaimsRequest.IDToken)
+		if err = addGroupsClaim(s.GroupRepo, claims, usr.ID, ses.Scope, ses.ClaimsRequest.IDToken); err != nil {
+			return "", err
+		}
+		if accessToken != "" {
+			claims.Add("at_hash", tokenHash(signer.Alg(), accessToken))
+		}
+		if code != "" {
+			claims.Add("c_hash", tokenHash(signer.Alg(), code))
+		}
+
+		jwt, err := jose.NewSignedJWT(claims, signer)
+		if err != nil {
+			return "", err
+		}
+		v.Set("id_token", jwt.Encode())
+	}
+
+	log.Infof("Session %s tokens sent in fragment: clientID=%s responseType=%q", ses.ID, ses.ClientID, ses.ResponseType)
+	s.Audit.Record(audit.Event{
+		Type:     audit.EventTokenIssued,
+		UserID:   ses.UserID,
+		ClientID: ses.ClientID,
+		Details:  map[string]string{"grant_type": oauth2.GrantTypeImplicit, "response_type": ses.ResponseType},
+	})
+
 	ru := ses.RedirectURL
-	q := ru.Query()
-	q.Set("code", code)
-	q.Set("state", ses.ClientState)
-	ru.RawQuery = q.Encode()
+	ru.Fragment = ""
+	return ru.String() + "#" + v.Encode(), nil
+}
 
-	return ru.String(), nil
+// tokenHash computes the at_hash or c_hash value of a token: the base64url
+// encoded left-most half of the hash of the token, using the hash function
+// that matches the signing algorithm. Unknown algorithms fall back to SHA-256.
+func tokenHash(alg, token string) string {
+	var h hash.Hash
+	switch {
+	case strings.HasSuffix(alg, "384"):
+		h = sha512.New384()
+	case strings.HasSuffix(alg, "512"):
+		h = sha512.New()
+	default:
+		h = sha256.New()
+	}
+	h.Write([]byte(token))
+	sum := h.Sum(nil)
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
 }
 
 func (s *Server) ClientCredsToken(creds oidc.ClientCredentials) (*jose.JWT, error) {
@@ -394,54 +715,75 @@ func (s *Server) ClientCredsToken(creds oidc.ClientCredentials) (*jose.JWT, erro
 	}
 
 	log.Infof("Client token sent: clientID=%s", creds.ID)
+	s.Audit.Record(audit.Event{
+		Type:     audit.EventTokenIssued,
+		ClientID: creds.ID,
+		Details:  map[string]string{"grant_type": oauth2.GrantTypeClientCreds},
+	})
 
 	return jwt, nil
 }
 
-func (s *Server) CodeToken(creds oidc.ClientCredentials, sessionKey string) (*jose.JWT, string, error) {
-	ok, err := s.ClientManager.Authenticate(creds)
-	if err != nil {
-		log.Errorf("Failed fetching client %s from repo: %v", creds.ID, err)
-		return nil, "", oauth2.NewError(oauth2.ErrorServerError)
-	}
-	if !ok {
-		log.Errorf("Failed to Authenticate client %s", creds.ID)
-		return nil, "", oauth2.NewError(oauth2.ErrorInvalidClient)
+func (s *Server) CodeToken(creds oidc.ClientCredentials, sessionKey, codeVerifier string) (*IssuedTokens, error) {
+	// Public clients can't keep a secret, so they authenticate with
+	// just their ID and prove possession of the code with PKCE instead.
+	public := creds.Secret == ""
+	if err := s.authenticateClient(creds, codeVerifier != ""); err != nil {
+		return nil, err
 	}
 
 	sessionID, err := s.SessionManager.ExchangeKey(sessionKey)
 	if err != nil {
-		return nil, "", oauth2.NewError(oauth2.ErrorInvalidGrant)
+		return nil, oauth2.NewError(oauth2.ErrorInvalidGrant)
 	}
 
 	ses, err := s.SessionManager.Kill(sessionID)
 	if err != nil {
-		return nil, "", oauth2.NewError(oauth2.ErrorInvalidRequest)
+		return nil, oauth2.NewError(oauth2.ErrorInvalidRequest)
 	}
 
 	if ses.ClientID != creds.ID {
-		return nil, "", oauth2.NewError(oauth2.ErrorInvalidGrant)
+		return nil, oauth2.NewError(oauth2.ErrorInvalidGrant)
+	}
+
+	if !ses.HasResponseType(oauth2.ResponseTypeCode) {
+		log.Errorf("Session %s was not started with a code response type", sessionID)
+		return nil, oauth2.NewError(oauth2.ErrorInvalidGrant)
+	}
+
+	if ses.CodeChallenge != "" {
+		if !verifyCodeVerifier(ses.CodeChallenge, ses.CodeChallengeMethod, codeVerifier) {
+			log.Errorf("Session %s code verifier does not match code challenge", sessionID)
+			return nil, oauth2.NewError(oauth2.ErrorInvalidGrant)
+		}
+	} else if public {
+		log.Errorf("Session %s has no code challenge, required for public client %s", sessionID, creds.ID)
+		return nil, oauth2.NewError(oauth2.ErrorInvalidGrant)
 	}
 
 	signer, err := s.KeyManager.Signer()
 	if err != nil {
 		log.Errorf("Failed to generate ID token: %v", err)
-		return nil, "", oauth2.NewError(oauth2.ErrorServerError)
+		return nil, oauth2.NewError(oauth2.ErrorServerError)
 	}
 
 	user, err := s.UserRepo.Get(nil, ses.UserID)
 	if err != nil {
 		log.Errorf("Failed to fetch user %q from repo: %v: ", ses.UserID, err)
-		return nil, "", oauth2.NewError(oauth2.ErrorServerError)
+		return nil, oauth2.NewError(oauth2.ErrorServerError)
 	}
 
 	claims := ses.Claims(s.IssuerURL.String())
-	user.AddToClaims(claims)
+	user.AddScopedClaims(claims, ses.Scope, ses.ClaimsRequest.IDToken)
+	if err := addGroupsClaim(s.GroupRepo, claims, user.ID, ses.Scope, ses.ClaimsRequest.IDToken); err != nil {
+		log.Errorf("Failed to fetch groups of user %q: %v", user.ID, err)
+		return nil, oauth2.NewError(oauth2.ErrorServerError)
+	}
 
 	jwt, err := jose.NewSignedJWT(claims, signer)
 	if err != nil {
 		log.Errorf("Failed to generate ID token: %v", err)
-		return nil, "", oauth2.NewError(oauth2.ErrorServerError)
+		return nil, oauth2.NewError(oauth2.ErrorServerError)
 	}
 
 	// Generate refresh token when 'scope' contains 'offline_access'.
@@ -451,37 +793,86 @@ func (s *Server) CodeToken(creds oidc.ClientCredentials, sessionKey string) (*jo
 		if scope == "offline_access" {
 			log.Infof("Session %s requests offline access, will generate refresh token", sessionID)
 
-			refreshToken, err = s.RefreshTokenRepo.Create(ses.UserID, creds.ID)
+			refreshToken, err = s.RefreshTokenRepo.Create(ses.UserID, creds.ID, ses.Scope)
 			switch err {
 			case nil:
 				break
 			default:
 				log.Errorf("Failed to generate refresh token: %v", err)
-				return nil, "", oauth2.NewError(oauth2.ErrorServerError)
+				return nil, oauth2.NewError(oauth2.ErrorServerError)
 			}
 			break
 		}
 	}
 
+	accessToken, expiresIn, err := s.newAccessToken(ses.UserID, creds.ID, ses.Scope, ses.ClaimsRequest.UserInfo)
+	if err != nil {
+		log.Errorf("Failed to generate access token: %v", err)
+		return nil, oauth2.NewError(oauth2.ErrorServerError)
+	}
+
 	log.Infof("Session %s token sent: clientID=%s", sessionID, creds.ID)
-	return jwt, refreshToken, nil
+	s.Audit.Record(audit.Event{
+		Type:     audit.EventTokenIssued,
+		UserID:   ses.UserID,
+		ClientID: creds.ID,
+		Details:  map[string]string{"grant_type": oauth2.GrantTypeAuthCode, "refresh_token": strconv.FormatBool(refreshToken != "")},
+	})
+	return &IssuedTokens{
+		IDToken:              jwt,
+		AccessToken:          accessToken,
+		AccessTokenExpiresIn: expiresIn,
+		RefreshToken:         refreshToken,
+	}, nil
 }
 
-func (s *Server) RefreshToken(creds oidc.ClientCredentials, token string) (*jose.JWT, error) {
+// authenticateClient checks the credentials a client presented to one of the
+// token endpoints. Public clients, which present no secret, are only accepted
+// if allowPublic is set. Errors are *oauth2.Error values.
+func (s *Server) authenticateClient(creds oidc.ClientCredentials, allowPublic bool) error {
+	if creds.Secret == "" {
+		cli, err := s.ClientManager.Get(creds.ID)
+		if err != nil && err != client.ErrorNotFound {
+			log.Errorf("Failed fetching client %s from repo: %v", creds.ID, err)
+			return oauth2.NewError(oauth2.ErrorServerError)
+		}
+		if err == client.ErrorNotFound || !cli.Public || !allowPublic {
+			log.Errorf("Failed to Authenticate client %s without a secret", creds.ID)
+			return oauth2.NewError(oauth2.ErrorInvalidClient)
+		}
+		return nil
+	}
+
 	ok, err := s.ClientManager.Authenticate(creds)
 	if err != nil {
 		log.Errorf("Failed fetching client %s from repo: %v", creds.ID, err)
-		return nil, oauth2.NewError(oauth2.ErrorServerError)
+		return oauth2.NewError(oauth2.ErrorServerError)
 	}
 	if !ok {
 		log.Errorf("Failed to Authenticate client %s", creds.ID)
-		return nil, oauth2.NewError(oauth2.ErrorInvalidClient)
+		return oauth2.NewError(oauth2.ErrorInvalidClient)
+	}
+	return nil
+}
+
+// RefreshToken exchanges a refresh token for new tokens. Public clients
+// exchange the refresh tokens they got for a PKCE code without a secret; the
+// rotation of refresh tokens is what protects theirs.
+func (s *Server) RefreshToken(creds oidc.ClientCredentials, token string) (*IssuedTokens, error) {
+	if err := s.authenticateClient(creds, true); err != nil {
+		return nil, err
 	}
 
-	userID, err := s.RefreshTokenRepo.Verify(creds.ID, token)
+	// The token is rotated even if issuing the new tokens fails below;
+	// rotating last would let a concurrent request reuse the token
+	// undetected.
+	refreshToken, userID, scope, err := s.RefreshTokenRepo.Rotate(creds.ID, token)
 	switch err {
 	case nil:
 		break
+	case refresh.ErrorTokenReused:
+		log.Errorf("Refresh token reused by client %s, revoked its token family", creds.ID)
+		return nil, oauth2.NewError(oauth2.ErrorInvalidRequest)
 	case refresh.ErrorInvalidToken:
 		return nil, oauth2.NewError(oauth2.ErrorInvalidRequest)
 	case refresh.ErrorInvalidClientID:
@@ -508,7 +899,11 @@ func (s *Server) RefreshToken(creds oidc.ClientCredentials, token string) (*jose
 	expireAt := now.Add(session.DefaultSessionValidityWindow)
 
 	claims := oidc.NewClaims(s.IssuerURL.String(), user.ID, creds.ID, now, expireAt)
-	user.AddToClaims(claims)
+	user.AddScopedClaims(claims, scope, nil)
+	if err := addGroupsClaim(s.GroupRepo, claims, user.ID, scope, nil); err != nil {
+		log.Errorf("Failed to fetch groups of user %q: %v", user.ID, err)
+		return nil, oauth2.NewError(oauth2.ErrorServerError)
+	}
 
 	jwt, err := jose.NewSignedJWT(claims, signer)
 	if err != nil {
@@ -516,9 +911,55 @@ func (s *Server) RefreshToken(creds oidc.ClientCredentials, token string) (*jose
 		return nil, oauth2.NewError(oauth2.ErrorServerError)
 	}
 
+	accessToken, expiresIn, err := s.newAccessToken(user.ID, creds.ID, scope, nil)
+	if err != nil {
+		log.Errorf("Failed to generate access token: %v", err)
+		return nil, oauth2.NewError(oauth2.ErrorServerError)
+	}
+
 	log.Infof("New token sent: clientID=%s", creds.ID)
+	s.Audit.Record(audit.Event{
+		Type:     audit.EventTokenRefreshed,
+		UserID:   user.ID,
+		ClientID: creds.ID,
+		Details:  map[string]string{"grant_type": oauth2.GrantTypeRefreshToken},
+	})
 
-	return jwt, nil
+	return &IssuedTokens{
+		IDToken:              jwt,
+		AccessToken:          accessToken,
+		AccessTokenExpiresIn: expiresIn,
+		RefreshToken:         refreshToken,
+	}, nil
+}
+
+// newAccessToken issues an opaque access token to the given client on
+// behalf of the given user, returning the token and its lifetime. The claims
+// are those requested individually from the UserInfo endpoint.
+func (s *Server) newAccessToken(userID, clientID string, scope, claims []string) (string, time.Duration, error) {
+	window := s.AccessTokenValidityWindow
+	if window == 0 {
+		window = access.DefaultAccessTokenValidityWindow
+	}
+	aud := s.AccessTokenAudience
+	if aud == "" {
+		aud = s.IssuerURL.String()
+	}
+
+	now := time.Now()
+	token, err := s.AccessTokenRepo.Create(access.AccessToken{
+		UserID:    userID,
+		ClientID:  clientID,
+		Scope:     scope,
+		Claims:    claims,
+		Audience:  aud,
+		CreatedAt: now,
+		ExpiresAt: now.Add(window),
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	return token, window, nil
 }
 
 func (s *Server) JWTVerifierFactory() JWTVerifierFactory {
@@ -6,15 +6,21 @@ import (
 	"fmt"
 	"net/url"
 	"reflect"
+	"sort"
 	"testing"
 	"time"
 
+	"github.com/coreos/dex/access"
+	"github.com/coreos/dex/audit"
 	"github.com/coreos/dex/client"
 	clientmanager "github.com/coreos/dex/client/manager"
+	"github.com/coreos/dex/connector"
 	"github.com/coreos/dex/db"
 	"github.com/coreos/dex/refresh/refreshtest"
+	"github.com/coreos/dex/session"
 	"github.com/coreos/dex/session/manager"
 	"github.com/coreos/dex/user"
+	usermanager "github.com/coreos/dex/user/manager"
 	"github.com/coreos/go-oidc/jose"
 	"github.com/coreos/go-oidc/key"
 	"github.com/coreos/go-oidc/oauth2"
@@ -106,20 +112,29 @@ func makeNewUserRepo() (user.UserRepo, error) {
 	return userRepo, nil
 }
 
+func makeNewGroupManager(userRepo user.UserRepo) *usermanager.GroupManager {
+	dbm := db.NewMemDB()
+	return usermanager.NewGroupManager(db.NewGroupRepo(dbm), userRepo, db.TransactionFactory(dbm))
+}
+
 func TestServerProviderConfig(t *testing.T) {
 	srv := &Server{IssuerURL: url.URL{Scheme: "http", Host: "server.example.com"}}
 
 	want := oidc.ProviderConfig{
-		Issuer:        &url.URL{Scheme: "http", Host: "server.example.com"},
-		AuthEndpoint:  &url.URL{Scheme: "http", Host: "server.example.com", Path: "/auth"},
-		TokenEndpoint: &url.URL{Scheme: "http", Host: "server.example.com", Path: "/token"},
-		KeysEndpoint:  &url.URL{Scheme: "http", Host: "server.example.com", Path: "/keys"},
-
-		GrantTypesSupported:               []string{oauth2.GrantTypeAuthCode, oauth2.GrantTypeClientCreds},
-		ResponseTypesSupported:            []string{"code"},
+		Issuer:           &url.URL{Scheme: "http", Host: "server.example.com"},
+		AuthEndpoint:     &url.URL{Scheme: "http", Host: "server.example.com", Path: "/auth"},
+		TokenEndpoint:    &url.URL{Scheme: "http", Host: "server.example.com", Path: "/token"},
+		UserInfoEndpoint: &url.URL{Scheme: "http", Host: "server.example.com", Path: "/userinfo"},
+		KeysEndpoint:     &url.URL{Scheme: "http", Host: "server.example.com", Path: "/keys"},
+
+		GrantTypesSupported:               []string{oauth2.GrantTypeAuthCode, oauth2.GrantTypeImplicit, oauth2.GrantTypeClientCreds},
+		ResponseTypesSupported:            []string{"code", "id_token", "id_token token", "code id_token", "code token", "code id_token token"},
 		SubjectTypesSupported:             []string{"public"},
 		IDTokenSigningAlgValues:           []string{"RS256"},
 		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic"},
+		ScopesSupported:                   []string{"openid", "offline_access", "profile", "email", "address", "phone", "groups"},
+		ClaimsSupported:                   []string{"acr", "amr", "aud", "auth_time", "email", "email_verified", "exp", "groups", "iat", "iss", "name", "sub"},
+		ClaimsParameterSupported:          true,
 	}
 	got := srv.ProviderConfig()
 
@@ -152,7 +167,15 @@ func TestServerNewSession(t *testing.T) {
 		},
 	}
 
-	key, err := srv.NewSession("bogus_idpc", ci.Credentials.ID, state, ci.Metadata.RedirectURIs[0], nonce, false, []string{"openid"})
+	key, err := srv.NewSession(session.SessionRequest{
+		ConnectorID:  "bogus_idpc",
+		ClientID:     ci.Credentials.ID,
+		ClientState:  state,
+		RedirectURL:  ci.Metadata.RedirectURIs[0],
+		Nonce:        nonce,
+		Scope:        []string{"openid"},
+		ResponseType: "code",
+	})
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
@@ -162,7 +185,7 @@ func TestServerNewSession(t *testing.T) {
 		t.Fatalf("Session not retreivable: %v", err)
 	}
 
-	ses, err := sm.AttachRemoteIdentity(sessionID, oidc.Identity{})
+	ses, err := sm.AttachRemoteIdentity(sessionID, oidc.Identity{}, nil)
 	if err != nil {
 		t.Fatalf("Unable to add Identity to Session: %v", err)
 	}
@@ -214,7 +237,14 @@ func TestServerLogin(t *testing.T) {
 
 	sm := manager.NewSessionManager(db.NewSessionRepo(db.NewMemDB()), db.NewSessionKeyRepo(db.NewMemDB()))
 	sm.GenerateCode = staticGenerateCodeFunc("fakecode")
-	sessionID, err := sm.NewSession("test_connector_id", ci.Credentials.ID, "bogus", ci.Metadata.RedirectURIs[0], "", false, []string{"openid"})
+	sessionID, err := sm.NewSession(session.SessionRequest{
+		ConnectorID:  "test_connector_id",
+		ClientID:     ci.Credentials.ID,
+		ClientState:  "bogus",
+		RedirectURL:  ci.Metadata.RedirectURIs[0],
+		Scope:        []string{"openid"},
+		ResponseType: "code",
+	})
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
@@ -224,6 +254,7 @@ func TestServerLogin(t *testing.T) {
 		t.Fatalf("Unexpected error: %v", err)
 	}
 
+	var events memAuditSink
 	srv := &Server{
 		IssuerURL:      url.URL{Scheme: "http", Host: "server.example.com"},
 		KeyManager:     km,
@@ -231,6 +262,8 @@ func TestServerLogin(t *testing.T) {
 		ClientRepo:     clientRepo,
 		ClientManager:  clientManager,
 		UserRepo:       userRepo,
+		GroupManager:   makeNewGroupManager(userRepo),
+		Audit:          audit.NewLogger(&events),
 	}
 
 	ident := oidc.Identity{ID: "YYY", Name: "elroy", Email: "elroy@example.com"}
@@ -238,8 +271,11 @@ func TestServerLogin(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
+	if err := srv.SetSessionRemoteIP(key, "10.0.0.1"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
 
-	redirectURL, err := srv.Login(ident, key)
+	redirectURL, err := srv.Login(ident, nil, key)
 	if err != nil {
 		t.Fatalf("Unexpected err from Server.Login: %v", err)
 	}
@@ -248,6 +284,269 @@ func TestServerLogin(t *testing.T) {
 	if wantRedirectURL != redirectURL {
 		t.Fatalf("Unexpected redirectURL: want=%q, got=%q", wantRedirectURL, redirectURL)
 	}
+
+	if len(events) != 1 {
+		t.Fatalf("want 1 audit event, got %d", len(events))
+	}
+	e := events[0]
+	if e.Type != audit.EventLoginSucceeded || e.UserID != "testid-1" || e.ClientID != testClientID || e.ConnectorID != "test_connector_id" || e.IP != "10.0.0.1" {
+		t.Errorf("unexpected audit event: %#v", e)
+	}
+}
+
+type memAuditSink []audit.Event
+
+func (s *memAuditSink) Write(e audit.Event) error {
+	*s = append(*s, e)
+	return nil
+}
+
+func TestServerLoginSyncsGroups(t *testing.T) {
+	ci := client.Client{
+		Credentials: oidc.ClientCredentials{
+			ID:     testClientID,
+			Secret: clientTestSecret,
+		},
+		Metadata: oidc.ClientMetadata{
+			RedirectURIs: []url.URL{
+				url.URL{
+					Scheme: "http",
+					Host:   "client.example.com",
+					Path:   "/callback",
+				},
+			},
+		},
+	}
+
+	dbm := db.NewMemDB()
+	clientRepo := db.NewClientRepo(dbm)
+	clientManager, err := clientmanager.NewClientManagerFromClients(clientRepo, db.TransactionFactory(dbm), []client.Client{ci}, clientmanager.ManagerOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create client identity manager: %v", err)
+	}
+
+	sm := manager.NewSessionManager(db.NewSessionRepo(db.NewMemDB()), db.NewSessionKeyRepo(db.NewMemDB()))
+	sessionID, err := sm.NewSession(session.SessionRequest{
+		ConnectorID:  "test_connector_id",
+		ClientID:     ci.Credentials.ID,
+		ClientState:  "bogus",
+		RedirectURL:  ci.Metadata.RedirectURIs[0],
+		Scope:        []string{"openid", "groups"},
+		ResponseType: "code",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	userRepo, err := makeNewUserRepo()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	groupRepo := db.NewGroupRepo(dbm)
+
+	srv := &Server{
+		IssuerURL:      url.URL{Scheme: "http", Host: "server.example.com"},
+		KeyManager:     &StaticKeyManager{signer: &StaticSigner{sig: []byte("beer"), err: nil}},
+		SessionManager: sm,
+		ClientRepo:     clientRepo,
+		ClientManager:  clientManager,
+		UserRepo:       userRepo,
+		GroupRepo:      groupRepo,
+		GroupManager:   usermanager.NewGroupManager(groupRepo, userRepo, db.TransactionFactory(dbm)),
+		Connectors: []connector.Connector{
+			&fakeConnector{},
+		},
+	}
+
+	key, err := sm.NewSessionKey(sessionID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err = srv.Login(oidc.Identity{ID: "YYY"}, []string{"ops", "admins"}, key); err != nil {
+		t.Fatalf("Unexpected err from Server.Login: %v", err)
+	}
+
+	groups, err := groupRepo.GetGroupsForUser(nil, "testid-1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := pretty.Compare([]string{"test_connector_id:admins", "test_connector_id:ops"}, user.GroupNames(groups)); diff != "" {
+		t.Errorf("Compare(want, got) = %v", diff)
+	}
+}
+
+func TestServerLoginImplicit(t *testing.T) {
+	tests := []struct {
+		responseType string
+		wantParams   []string
+	}{
+		{
+			responseType: "id_token",
+			wantParams:   []string{"id_token", "state"},
+		},
+		{
+			responseType: "id_token token",
+			wantParams:   []string{"access_token", "expires_in", "id_token", "state", "token_type"},
+		},
+		{
+			responseType: "code id_token",
+			wantParams:   []string{"code", "id_token", "state"},
+		},
+		{
+			responseType: "code id_token token",
+			wantParams:   []string{"access_token", "code", "expires_in", "id_token", "state", "token_type"},
+		},
+	}
+
+	for i, tt := range tests {
+		ci := client.Client{
+			Credentials: oidc.ClientCredentials{
+				ID:     testClientID,
+				Secret: clientTestSecret,
+			},
+			Metadata: oidc.ClientMetadata{
+				RedirectURIs:  []url.URL{validRedirURL},
+				ResponseTypes: []string{tt.responseType},
+			},
+		}
+
+		dbm := db.NewMemDB()
+		clientRepo := db.NewClientRepo(dbm)
+		clientManager, err := clientmanager.NewClientManagerFromClients(clientRepo, db.TransactionFactory(dbm), []client.Client{ci}, clientmanager.ManagerOptions{})
+		if err != nil {
+			t.Fatalf("case %d: failed to create client identity manager: %v", i, err)
+		}
+
+		km := &StaticKeyManager{
+			signer: &StaticSigner{sig: []byte("beer"), err: nil},
+		}
+
+		sm := manager.NewSessionManager(db.NewSessionRepo(db.NewMemDB()), db.NewSessionKeyRepo(db.NewMemDB()))
+		sm.GenerateCode = staticGenerateCodeFunc("fakecode")
+		sessionID, err := sm.NewSession(session.SessionRequest{
+			ConnectorID:  "test_connector_id",
+			ClientID:     ci.Credentials.ID,
+			ClientState:  "bogus",
+			RedirectURL:  ci.Metadata.RedirectURIs[0],
+			Nonce:        "noncey",
+			Scope:        []string{"openid"},
+			ResponseType: tt.responseType,
+		})
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+
+		userRepo, err := makeNewUserRepo()
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+
+		srv := &Server{
+			IssuerURL:       url.URL{Scheme: "http", Host: "server.example.com"},
+			KeyManager:      km,
+			SessionManager:  sm,
+			ClientRepo:      clientRepo,
+			ClientManager:   clientManager,
+			UserRepo:        userRepo,
+			GroupManager:    makeNewGroupManager(userRepo),
+			AccessTokenRepo: db.NewAccessTokenRepo(db.NewMemDB()),
+		}
+
+		ident := oidc.Identity{ID: "YYY", Name: "elroy", Email: "elroy@example.com"}
+		key, err := sm.NewSessionKey(sessionID)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+
+		redirectURL, err := srv.Login(ident, nil, key)
+		if err != nil {
+			t.Fatalf("case %d: unexpected err from Server.Login: %v", i, err)
+		}
+
+		u, err := url.Parse(redirectURL)
+		if err != nil {
+			t.Fatalf("case %d: unable to parse redirect URL: %v", i, err)
+		}
+		if u.RawQuery != "" {
+			t.Errorf("case %d: expected empty query, got=%q", i, u.RawQuery)
+		}
+
+		v, err := url.ParseQuery(u.Fragment)
+		if err != nil {
+			t.Fatalf("case %d: unable to parse fragment: %v", i, err)
+		}
+		var gotParams []string
+		for k := range v {
+			gotParams = append(gotParams, k)
+		}
+		sort.Strings(gotParams)
+		if diff := pretty.Compare(tt.wantParams, gotParams); diff != "" {
+			t.Errorf("case %d: Compare(wantParams, gotParams) = %v", i, diff)
+		}
+
+		jwt, err := jose.ParseJWT(v.Get("id_token"))
+		if err != nil {
+			t.Fatalf("case %d: unable to parse ID token: %v", i, err)
+		}
+		claims, err := jwt.Claims()
+		if err != nil {
+			t.Fatalf("case %d: unable to get claims: %v", i, err)
+		}
+
+		wantClaims := map[string]string{
+			"nonce":   "noncey",
+			"sub":     "testid-1",
+			"at_hash": "",
+			"c_hash":  "",
+		}
+		if at := v.Get("access_token"); at != "" {
+			wantClaims["at_hash"] = tokenHash("static", at)
+		}
+		if code := v.Get("code"); code != "" {
+			wantClaims["c_hash"] = tokenHash("static", code)
+		}
+		for name, want := range wantClaims {
+			got, _, _ := claims.StringClaim(name)
+			if want != got {
+				t.Errorf("case %d: claim %q mismatch: want=%q got=%q", i, name, want, got)
+			}
+		}
+
+		ses, err := sm.Get(sessionID)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		wantDead := v.Get("code") == ""
+		if gotDead := ses.State == session.SessionStateDead; wantDead != gotDead {
+			t.Errorf("case %d: session dead mismatch: want=%t got=%t", i, wantDead, gotDead)
+		}
+	}
+}
+
+func TestTokenHash(t *testing.T) {
+	tests := []struct {
+		alg   string
+		token string
+		want  string
+	}{
+		// Example from OpenID Connect Core 1.0, Appendix A.4.
+		{
+			alg:   "RS256",
+			token: "jHkWEdUXMU1BwAsC4vtUsZwnNvTIxEl0z9K3vx5KF0Y",
+			want:  "77QmUPtjPfzWtF2AnpK9RQ",
+		},
+		{
+			alg:   "RS256",
+			token: "Qcb0Orv1zh30vL1MPRsbm-diHiMwcLyZvn1arpZv-Jxf_11jnpEX3Tgfvk",
+			want:  "LDktKdoQak3Pk0cnXxCltA",
+		},
+	}
+
+	for i, tt := range tests {
+		if got := tokenHash(tt.alg, tt.token); tt.want != got {
+			t.Errorf("case %d: want=%q got=%q", i, tt.want, got)
+		}
+	}
 }
 
 func TestServerLoginUnrecognizedSessionKey(t *testing.T) {
@@ -288,7 +587,7 @@ func TestServerLoginUnrecognizedSessionKey(t *testing.T) {
 	}
 
 	ident := oidc.Identity{ID: "YYY", Name: "elroy", Email: "elroy@example.com"}
-	code, err := srv.Login(ident, testClientID)
+	code, err := srv.Login(ident, nil, testClientID)
 	if err == nil {
 		t.Fatalf("Expected non-nil error")
 	}
@@ -329,7 +628,14 @@ func TestServerLoginDisabledUser(t *testing.T) {
 
 	sm := manager.NewSessionManager(db.NewSessionRepo(db.NewMemDB()), db.NewSessionKeyRepo(db.NewMemDB()))
 	sm.GenerateCode = staticGenerateCodeFunc("fakecode")
-	sessionID, err := sm.NewSession("test_connector_id", ci.Credentials.ID, "bogus", ci.Metadata.RedirectURIs[0], "", false, []string{"openid"})
+	sessionID, err := sm.NewSession(session.SessionRequest{
+		ConnectorID:  "test_connector_id",
+		ClientID:     ci.Credentials.ID,
+		ClientState:  "bogus",
+		RedirectURL:  ci.Metadata.RedirectURIs[0],
+		Scope:        []string{"openid"},
+		ResponseType: "code",
+	})
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
@@ -360,6 +666,7 @@ func TestServerLoginDisabledUser(t *testing.T) {
 		ClientRepo:     clientRepo,
 		ClientManager:  clientManager,
 		UserRepo:       userRepo,
+		GroupManager:   makeNewGroupManager(userRepo),
 	}
 
 	ident := oidc.Identity{ID: "disabled-connector-id", Name: "elroy", Email: "elroy@example.com"}
@@ -368,7 +675,7 @@ func TestServerLoginDisabledUser(t *testing.T) {
 		t.Fatalf("Unexpected error: %v", err)
 	}
 
-	_, err = srv.Login(ident, key)
+	_, err = srv.Login(ident, nil, key)
 	if err == nil {
 		t.Errorf("disabled user was allowed to log in")
 	}
@@ -411,6 +718,14 @@ func TestServerCodeToken(t *testing.T) {
 
 	refreshTokenRepo := refreshtest.NewTestRefreshTokenRepo()
 
+	groupRepo := db.NewGroupRepo(db.NewMemDB())
+	if err := groupRepo.Create(nil, user.Group{ID: "group-1", Name: "admins"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := groupRepo.AddMember(nil, "group-1", "testid-1", ""); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
 	srv := &Server{
 		IssuerURL:        url.URL{Scheme: "http", Host: "server.example.com"},
 		KeyManager:       km,
@@ -418,12 +733,17 @@ func TestServerCodeToken(t *testing.T) {
 		ClientRepo:       clientRepo,
 		ClientManager:    clientManager,
 		UserRepo:         userRepo,
+		GroupRepo:        groupRepo,
 		RefreshTokenRepo: refreshTokenRepo,
+		AccessTokenRepo:  db.NewAccessTokenRepo(db.NewMemDB()),
 	}
 
 	tests := []struct {
-		scope        []string
-		refreshToken string
+		scope         []string
+		claimsRequest session.ClaimsRequest
+		refreshToken  string
+		// wantClaims are the user claims expected in the ID token.
+		wantClaims []string
 	}{
 		// No 'offline_access' in scope, should get empty refresh token.
 		{
@@ -437,14 +757,40 @@ func TestServerCodeToken(t *testing.T) {
 			scope:        []string{"openid", "offline_access"},
 			refreshToken: fmt.Sprintf("1/%s", base64.URLEncoding.EncodeToString([]byte("refresh-1"))),
 		},
+		// User claims are released by scope,
+		{
+			scope:      []string{"openid", "email"},
+			wantClaims: []string{"email"},
+		},
+		// or requested individually.
+		{
+			scope: []string{"openid"},
+			claimsRequest: session.ClaimsRequest{
+				IDToken:  []string{"name"},
+				UserInfo: []string{"email"},
+			},
+			wantClaims: []string{"name"},
+		},
+		// Groups are released for the 'groups' scope.
+		{
+			scope:      []string{"openid", "groups"},
+			wantClaims: []string{"groups"},
+		},
 	}
 
 	for i, tt := range tests {
-		sessionID, err := sm.NewSession("bogus_idpc", ci.Credentials.ID, "bogus", url.URL{}, "", false, tt.scope)
+		sessionID, err := sm.NewSession(session.SessionRequest{
+			ConnectorID:   "bogus_idpc",
+			ClientID:      ci.Credentials.ID,
+			ClientState:   "bogus",
+			Scope:         tt.scope,
+			ResponseType:  "code",
+			ClaimsRequest: tt.claimsRequest,
+		})
 		if err != nil {
 			t.Fatalf("case %d: unexpected error: %v", i, err)
 		}
-		_, err = sm.AttachRemoteIdentity(sessionID, oidc.Identity{})
+		_, err = sm.AttachRemoteIdentity(sessionID, oidc.Identity{}, nil)
 		if err != nil {
 			t.Fatalf("case %d: unexpected error: %v", i, err)
 		}
@@ -459,15 +805,53 @@ func TestServerCodeToken(t *testing.T) {
 			t.Fatalf("case %d: unexpected error: %v", i, err)
 		}
 
-		jwt, token, err := srv.CodeToken(ci.Credentials, key)
+		tokens, err := srv.CodeToken(ci.Credentials, key, "")
 		if err != nil {
 			t.Fatalf("case %d: unexpected error: %v", i, err)
 		}
-		if jwt == nil {
+		if tokens.IDToken == nil {
 			t.Fatalf("case %d: expect non-nil jwt", i)
 		}
-		if token != tt.refreshToken {
-			t.Fatalf("case %d: expect refresh token %q, got %q", i, tt.refreshToken, token)
+		if tokens.RefreshToken != tt.refreshToken {
+			t.Fatalf("case %d: expect refresh token %q, got %q", i, tt.refreshToken, tokens.RefreshToken)
+		}
+
+		claims, err := tokens.IDToken.Claims()
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		var gotClaims []string
+		for _, name := range []string{"name", "email", "email_verified", "groups"} {
+			if _, ok := claims[name]; ok {
+				gotClaims = append(gotClaims, name)
+			}
+		}
+		if diff := pretty.Compare(tt.wantClaims, gotClaims); diff != "" {
+			t.Errorf("case %d: Compare(wantClaims, gotClaims) = %v", i, diff)
+		}
+		if groups, ok := claims["groups"]; ok {
+			if diff := pretty.Compare([]interface{}{"admins"}, groups); diff != "" {
+				t.Errorf("case %d: Compare(wantGroups, gotGroups) = %v", i, diff)
+			}
+		}
+
+		at, err := srv.AccessTokenRepo.Get(tokens.AccessToken)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		want := &access.AccessToken{
+			UserID:   "testid-1",
+			ClientID: ci.Credentials.ID,
+			Scope:    tt.scope,
+			Claims:   tt.claimsRequest.UserInfo,
+			Audience: srv.IssuerURL.String(),
+		}
+		at.CreatedAt, at.ExpiresAt = time.Time{}, time.Time{}
+		if diff := pretty.Compare(want, at); diff != "" {
+			t.Errorf("case %d: Compare(want, got) = %v", i, diff)
+		}
+		if tokens.AccessTokenExpiresIn != access.DefaultAccessTokenValidityWindow {
+			t.Errorf("case %d: expect access token to expire in %v, got %v", i, access.DefaultAccessTokenValidityWindow, tokens.AccessTokenExpiresIn)
 		}
 	}
 }
@@ -511,25 +895,28 @@ func TestServerTokenUnrecognizedKey(t *testing.T) {
 		ClientManager:  clientManager,
 	}
 
-	sessionID, err := sm.NewSession("connector_id", ci.Credentials.ID, "bogus", url.URL{}, "", false, []string{"openid", "offline_access"})
+	sessionID, err := sm.NewSession(session.SessionRequest{
+		ConnectorID:  "connector_id",
+		ClientID:     ci.Credentials.ID,
+		ClientState:  "bogus",
+		Scope:        []string{"openid", "offline_access"},
+		ResponseType: "code",
+	})
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
 
-	_, err = sm.AttachRemoteIdentity(sessionID, oidc.Identity{})
+	_, err = sm.AttachRemoteIdentity(sessionID, oidc.Identity{}, nil)
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
 
-	jwt, token, err := srv.CodeToken(ci.Credentials, "foo")
+	tokens, err := srv.CodeToken(ci.Credentials, "foo", "")
 	if err == nil {
 		t.Fatalf("Expected non-nil error")
 	}
-	if jwt != nil {
-		t.Fatalf("Expected nil jwt")
-	}
-	if token != "" {
-		t.Fatalf("Expected empty refresh token")
+	if tokens != nil {
+		t.Fatalf("Expected nil tokens")
 	}
 }
 
@@ -601,12 +988,18 @@ func TestServerTokenFail(t *testing.T) {
 		sm := manager.NewSessionManager(db.NewSessionRepo(db.NewMemDB()), db.NewSessionKeyRepo(db.NewMemDB()))
 		sm.GenerateCode = func() (string, error) { return keyFixture, nil }
 
-		sessionID, err := sm.NewSession("connector_id", ccFixture.ID, "bogus", url.URL{}, "", false, tt.scope)
+		sessionID, err := sm.NewSession(session.SessionRequest{
+			ConnectorID:  "connector_id",
+			ClientID:     ccFixture.ID,
+			ClientState:  "bogus",
+			Scope:        tt.scope,
+			ResponseType: "code",
+		})
 		if err != nil {
 			t.Fatalf("Unexpected error: %v", err)
 		}
 
-		_, err = sm.AttachRemoteIdentity(sessionID, oidc.Identity{})
+		_, err = sm.AttachRemoteIdentity(sessionID, oidc.Identity{}, nil)
 		if err != nil {
 			t.Errorf("case %d: unexpected error: %v", i, err)
 			continue
@@ -657,6 +1050,7 @@ func TestServerTokenFail(t *testing.T) {
 			ClientManager:    clientManager,
 			UserRepo:         userRepo,
 			RefreshTokenRepo: refreshTokenRepo,
+			AccessTokenRepo:  db.NewAccessTokenRepo(db.NewMemDB()),
 		}
 
 		_, err = sm.NewSessionKey(sessionID)
@@ -664,7 +1058,12 @@ func TestServerTokenFail(t *testing.T) {
 			t.Fatalf("Unexpected error: %v", err)
 		}
 
-		jwt, token, err := srv.CodeToken(tt.argCC, tt.argKey)
+		var token string
+		var jwt *jose.JWT
+		tokens, err := srv.CodeToken(tt.argCC, tt.argKey, "")
+		if tokens != nil {
+			token, jwt = tokens.RefreshToken, tokens.IDToken
+		}
 		if token != tt.refreshToken {
 			fmt.Printf("case %d: expect refresh token %q, got %q\n", i, tt.refreshToken, token)
 			t.Fatalf("case %d: expect refresh token %q, got %q", i, tt.refreshToken, token)
@@ -706,6 +1105,18 @@ func TestServerRefreshToken(t *testing.T) {
 			},
 		},
 	}
+	publicClient := client.Client{
+		Credentials: oidc.ClientCredentials{
+			ID:     "public.example.com",
+			Secret: clientTestSecret,
+		},
+		Metadata: oidc.ClientMetadata{
+			RedirectURIs: []url.URL{
+				url.URL{Scheme: "https", Host: "public.example.com", Path: "one/two/three"},
+			},
+		},
+		Public: true,
+	}
 
 	signerFixture := &StaticSigner{sig: []byte("beer"), err: nil}
 
@@ -798,6 +1209,22 @@ func TestServerRefreshToken(t *testing.T) {
 			&StaticSigner{sig: nil, err: errors.New("fail")},
 			oauth2.NewError(oauth2.ErrorServerError),
 		},
+		// Public client without a secret.
+		{
+			fmt.Sprintf("1/%s", base64.URLEncoding.EncodeToString([]byte("refresh-1"))),
+			publicClient.Credentials.ID,
+			oidc.ClientCredentials{ID: publicClient.Credentials.ID},
+			signerFixture,
+			nil,
+		},
+		// Public client presenting the token of another client.
+		{
+			fmt.Sprintf("1/%s", base64.URLEncoding.EncodeToString([]byte("refresh-1"))),
+			clientA.Credentials.ID,
+			oidc.ClientCredentials{ID: publicClient.Credentials.ID},
+			signerFixture,
+			oauth2.NewError(oauth2.ErrorInvalidClient),
+		},
 	}
 
 	for i, tt := range tests {
@@ -808,6 +1235,7 @@ func TestServerRefreshToken(t *testing.T) {
 		clients := []client.Client{
 			clientA,
 			clientB,
+			publicClient,
 		}
 
 		clientIDGenerator := func(hostport string) (string, error) {
@@ -836,18 +1264,24 @@ func TestServerRefreshToken(t *testing.T) {
 			ClientManager:    clientManager,
 			UserRepo:         userRepo,
 			RefreshTokenRepo: refreshTokenRepo,
+			AccessTokenRepo:  db.NewAccessTokenRepo(db.NewMemDB()),
 		}
 
-		if _, err := refreshTokenRepo.Create("testid-1", tt.clientID); err != nil {
+		scope := []string{"openid", "email", "offline_access"}
+		if _, err := refreshTokenRepo.Create("testid-1", tt.clientID, scope); err != nil {
 			t.Fatalf("Unexpected error: %v", err)
 		}
 
-		jwt, err := srv.RefreshToken(tt.creds, tt.token)
+		tokens, err := srv.RefreshToken(tt.creds, tt.token)
 		if !reflect.DeepEqual(err, tt.err) {
 			t.Errorf("Case %d: expect: %v, got: %v", i, tt.err, err)
 		}
 
-		if jwt != nil {
+		if tokens != nil {
+			if tokens.AccessToken == "" {
+				t.Errorf("Case %d: expect non-empty access token", i)
+			}
+			jwt := tokens.IDToken
 			if string(jwt.Signature) != "beer" {
 				t.Errorf("Case %d: expect signature: beer, got signature: %v", i, jwt.Signature)
 			}
@@ -855,9 +1289,31 @@ func TestServerRefreshToken(t *testing.T) {
 			if err != nil {
 				t.Errorf("Case %d: unexpected error: %v", i, err)
 			}
-			if claims["iss"] != issuerURL.String() || claims["sub"] != "testid-1" || claims["aud"] != testClientID {
+			if claims["iss"] != issuerURL.String() || claims["sub"] != "testid-1" || claims["aud"] != tt.clientID {
 				t.Errorf("Case %d: invalid claims: %v", i, claims)
 			}
+			// Claims are released by the scope the refresh token was granted with.
+			if _, ok := claims["name"]; ok || claims["email"] != "testname@example.com" {
+				t.Errorf("Case %d: invalid user claims: %v", i, claims)
+			}
+			at, err := srv.AccessTokenRepo.Get(tokens.AccessToken)
+			if err != nil {
+				t.Errorf("Case %d: unexpected error: %v", i, err)
+			} else if diff := pretty.Compare(scope, at.Scope); diff != "" {
+				t.Errorf("Case %d: Compare(want, got) = %v", i, diff)
+			}
+
+			// The refresh token is rotated.
+			wantToken := fmt.Sprintf("2/%s", base64.URLEncoding.EncodeToString([]byte("refresh-2")))
+			if tokens.RefreshToken != wantToken {
+				t.Errorf("Case %d: expect refresh token %q, got %q", i, wantToken, tokens.RefreshToken)
+			}
+			if _, err := srv.RefreshToken(tt.creds, tt.token); !reflect.DeepEqual(err, oauth2.NewError(oauth2.ErrorInvalidRequest)) {
+				t.Errorf("Case %d: expect reusing the old refresh token to fail, got: %v", i, err)
+			}
+			if _, err := srv.RefreshToken(tt.creds, tokens.RefreshToken); !reflect.DeepEqual(err, oauth2.NewError(oauth2.ErrorInvalidRequest)) {
+				t.Errorf("Case %d: expect the token family to be revoked after reuse, got: %v", i, err)
+			}
 		}
 	}
 
@@ -907,7 +1363,7 @@ func TestServerRefreshToken(t *testing.T) {
 		RefreshTokenRepo: refreshTokenRepo,
 	}
 
-	if _, err := refreshTokenRepo.Create("testid-2", clientA.Credentials.ID); err != nil {
+	if _, err := refreshTokenRepo.Create("testid-2", clientA.Credentials.ID, []string{"openid"}); err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
 
@@ -14,6 +14,8 @@ import (
 	"github.com/coreos/dex/connector"
 	"github.com/coreos/dex/db"
 	"github.com/coreos/dex/email"
+	"github.com/coreos/dex/lockout"
+	"github.com/coreos/dex/mfa"
 	sessionmanager "github.com/coreos/dex/session/manager"
 	"github.com/coreos/dex/user"
 	useremail "github.com/coreos/dex/user/email"
@@ -127,6 +129,9 @@ func makeTestFixtures() (*testFixtures, error) {
 
 	userManager := usermanager.NewUserManager(userRepo, pwRepo, connCfgRepo, db.TransactionFactory(dbMap), usermanager.ManagerOptions{})
 
+	groupRepo := db.NewGroupRepo(dbMap)
+	groupManager := usermanager.NewGroupManager(groupRepo, userRepo, db.TransactionFactory(dbMap))
+
 	sessionManager := sessionmanager.NewSessionManager(db.NewSessionRepo(db.NewMemDB()), db.NewSessionKeyRepo(db.NewMemDB()))
 	sessionManager.GenerateCode = sequentialGenerateCodeFunc()
 
@@ -169,6 +174,12 @@ func makeTestFixtures() (*testFixtures, error) {
 		return nil, err
 	}
 
+	mfaSecret := make([]byte, 32)
+	mfaRepo, err := db.NewMFAEnrollmentRepo(dbMap, mfaSecret)
+	if err != nil {
+		return nil, err
+	}
+
 	tpl, err := getTemplates("dex",
 		"https://coreos.com/assets/images/brand/coreos-mark-30px.png",
 		true, templatesLocation)
@@ -177,16 +188,25 @@ func makeTestFixtures() (*testFixtures, error) {
 	}
 
 	srv := &Server{
-		IssuerURL:        testIssuerURL,
-		SessionManager:   sessionManager,
-		ClientRepo:       clientRepo,
-		Templates:        tpl,
-		UserRepo:         userRepo,
-		PasswordInfoRepo: pwRepo,
-		UserManager:      userManager,
-		ClientManager:    clientManager,
-		KeyManager:       km,
-	}
+		IssuerURL:              testIssuerURL,
+		SessionManager:         sessionManager,
+		ClientRepo:             clientRepo,
+		ConnectorConfigRepo:    connCfgRepo,
+		Templates:              tpl,
+		UserRepo:               userRepo,
+		PasswordInfoRepo:       pwRepo,
+		UserManager:            userManager,
+		GroupRepo:              groupRepo,
+		GroupManager:           groupManager,
+		ClientManager:          clientManager,
+		KeyManager:             km,
+		AccessTokenRepo:        db.NewAccessTokenRepo(dbMap),
+		RefreshTokenRepo:       db.NewRefreshTokenRepo(dbMap),
+		InitialAccessTokenRepo: db.NewInitialAccessTokenRepo(dbMap),
+		LoginGuard:             lockout.NewGuard(db.NewLoginAttemptRepo(dbMap)),
+		MFA:                    &mfa.Authenticator{Repo: mfaRepo, Secrets: [][]byte{mfaSecret}},
+	}
+	srv.MFA.Policy = srv
 
 	err = setTemplates(srv, tpl)
 	if err != nil {
@@ -209,6 +229,7 @@ func makeTestFixtures() (*testFixtures, error) {
 		srv.absURL(httpPathResetPassword),
 		srv.absURL(httpPathEmailVerify),
 		srv.absURL(httpPathAcceptInvitation),
+		srv.absURL(httpPathLinkAccount),
 	)
 
 	return &testFixtures{
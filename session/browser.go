@@ -0,0 +1,41 @@
+package session
+
+import (
+	"errors"
+	"time"
+
+	"github.com/coreos/go-oidc/oidc"
+)
+
+// DefaultBrowserSessionValidityWindow is how long a user stays signed in to
+// dex after authenticating with a connector.
+const DefaultBrowserSessionValidityWindow = 24 * time.Hour
+
+var ErrorBrowserSessionNotFound = errors.New("browser session not found")
+
+// BrowserSession is dex's own single sign-on session. It is started when a
+// user authenticates with a connector and lets the same user-agent log in to
+// other clients without authenticating again until it expires.
+type BrowserSession struct {
+	ID          string
+	ConnectorID string
+	Identity    oidc.Identity
+	UserID      string
+
+	// AuthTime is when the user authenticated with the connector.
+	AuthTime  time.Time
+	ExpiresAt time.Time
+
+	// AMR lists the methods the user authenticated with, see Session.AMR.
+	AMR []string
+}
+
+// HasAMR reports whether the user authenticated with the given method.
+func (s *BrowserSession) HasAMR(amr string) bool {
+	for _, a := range s.AMR {
+		if a == amr {
+			return true
+		}
+	}
+	return false
+}
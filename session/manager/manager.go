@@ -5,7 +5,6 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
-	"net/url"
 	"time"
 
 	"github.com/jonboulle/clockwork"
@@ -46,7 +45,7 @@ type SessionManager struct {
 	keys           session.SessionKeyRepo
 }
 
-func (m *SessionManager) NewSession(connectorID, clientID, clientState string, redirectURL url.URL, nonce string, register bool, scope []string) (string, error) {
+func (m *SessionManager) NewSession(req session.SessionRequest) (string, error) {
 	sID, err := m.GenerateCode()
 	if err != nil {
 		return "", err
@@ -54,17 +53,21 @@ func (m *SessionManager) NewSession(connectorID, clientID, clientState string, r
 
 	now := m.Clock.Now()
 	s := session.Session{
-		ConnectorID: connectorID,
-		ID:          sID,
-		State:       session.SessionStateNew,
-		CreatedAt:   now,
-		ExpiresAt:   now.Add(m.ValidityWindow),
-		ClientID:    clientID,
-		ClientState: clientState,
-		RedirectURL: redirectURL,
-		Register:    register,
-		Nonce:       nonce,
-		Scope:       scope,
+		ConnectorID:         req.ConnectorID,
+		ID:                  sID,
+		State:               session.SessionStateNew,
+		CreatedAt:           now,
+		ExpiresAt:           now.Add(m.ValidityWindow),
+		ClientID:            req.ClientID,
+		ClientState:         req.ClientState,
+		RedirectURL:         req.RedirectURL,
+		Register:            req.Register,
+		Nonce:               req.Nonce,
+		Scope:               req.Scope,
+		ResponseType:        req.ResponseType,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		ClaimsRequest:       req.ClaimsRequest,
 	}
 
 	err = m.sessions.Create(s)
@@ -99,6 +102,12 @@ func (m *SessionManager) ExchangeKey(key string) (string, error) {
 	return m.keys.Pop(key)
 }
 
+// PeekKey returns the ID of the session a key belongs to, without using up
+// the key.
+func (m *SessionManager) PeekKey(key string) (string, error) {
+	return m.keys.Peek(key)
+}
+
 func (m *SessionManager) getSessionInState(sessionID string, state session.SessionState) (*session.Session, error) {
 	s, err := m.sessions.Get(sessionID)
 	if err != nil {
@@ -112,13 +121,109 @@ func (m *SessionManager) getSessionInState(sessionID string, state session.Sessi
 	return s, nil
 }
 
-func (m *SessionManager) AttachRemoteIdentity(sessionID string, ident oidc.Identity) (*session.Session, error) {
+// AttachRemoteIdentity records the identity and upstream groups of the user
+// the connector identified.
+func (m *SessionManager) AttachRemoteIdentity(sessionID string, ident oidc.Identity, groups []string) (*session.Session, error) {
 	s, err := m.getSessionInState(sessionID, session.SessionStateNew)
 	if err != nil {
 		return nil, err
 	}
 
 	s.Identity = ident
+	s.Groups = groups
+	s.State = session.SessionStateRemoteAttached
+
+	if err = m.sessions.Update(*s); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// SetAuthMethods records the methods the user of a session authenticated
+// with, before the connector attaches the remote identity.
+func (m *SessionManager) SetAuthMethods(sessionID string, amr []string) (*session.Session, error) {
+	s, err := m.getSessionInState(sessionID, session.SessionStateNew)
+	if err != nil {
+		return nil, err
+	}
+
+	s.AMR = amr
+
+	if err = m.sessions.Update(*s); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// SetRemoteIP records the address the user-agent of a new session connects
+// from.
+func (m *SessionManager) SetRemoteIP(sessionID, ip string) (*session.Session, error) {
+	s, err := m.getSessionInState(sessionID, session.SessionStateNew)
+	if err != nil {
+		return nil, err
+	}
+
+	s.RemoteIP = ip
+
+	if err = m.sessions.Update(*s); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// SetBrowserSession records the ID of the browser session a new session
+// starts once it identifies a user.
+func (m *SessionManager) SetBrowserSession(sessionID, browserSessionID string) (*session.Session, error) {
+	s, err := m.getSessionInState(sessionID, session.SessionStateNew)
+	if err != nil {
+		return nil, err
+	}
+
+	s.BrowserSessionID = browserSessionID
+
+	if err = m.sessions.Update(*s); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// SetPromptConsent records that the user of a new session must be asked for
+// consent, even if they consented to the client's scopes before.
+func (m *SessionManager) SetPromptConsent(sessionID string) (*session.Session, error) {
+	s, err := m.getSessionInState(sessionID, session.SessionStateNew)
+	if err != nil {
+		return nil, err
+	}
+
+	s.PromptConsent = true
+
+	if err = m.sessions.Update(*s); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// AttachBrowserSession resumes a browser session: the remote identity, the
+// authentication methods and the time of the browser session's
+// authentication are attached to the new session in its stead.
+func (m *SessionManager) AttachBrowserSession(sessionID string, bs session.BrowserSession) (*session.Session, error) {
+	s, err := m.getSessionInState(sessionID, session.SessionStateNew)
+	if err != nil {
+		return nil, err
+	}
+	if s.ConnectorID != bs.ConnectorID {
+		return nil, fmt.Errorf("session connector %q, browser session connector %q", s.ConnectorID, bs.ConnectorID)
+	}
+
+	s.Identity = bs.Identity
+	s.AMR = bs.AMR
+	s.AuthTime = bs.AuthTime
+	s.BrowserSessionID = bs.ID
 	s.State = session.SessionStateRemoteAttached
 
 	if err = m.sessions.Update(*s); err != nil {
@@ -128,6 +233,8 @@ func (m *SessionManager) AttachRemoteIdentity(sessionID string, ident oidc.Ident
 	return s, nil
 }
 
+// AttachUser identifies the user of a session. Unless the session was
+// resumed from a browser session, the user authenticated just now.
 func (m *SessionManager) AttachUser(sessionID string, userID string) (*session.Session, error) {
 	s, err := m.getSessionInState(sessionID, session.SessionStateRemoteAttached)
 	if err != nil {
@@ -136,6 +243,9 @@ func (m *SessionManager) AttachUser(sessionID string, userID string) (*session.S
 
 	s.UserID = userID
 	s.State = session.SessionStateIdentified
+	if s.AuthTime.IsZero() {
+		s.AuthTime = m.Clock.Now()
+	}
 
 	if err = m.sessions.Update(*s); err != nil {
 		return nil, err
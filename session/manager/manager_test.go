@@ -1,8 +1,8 @@
 package manager
 
 import (
-	"net/url"
 	"testing"
+	"time"
 
 	"github.com/coreos/dex/db"
 	"github.com/coreos/dex/session"
@@ -23,7 +23,13 @@ func newManager() *SessionManager {
 func TestSessionManagerNewSession(t *testing.T) {
 	sm := newManager()
 	sm.GenerateCode = staticGenerateCodeFunc("boo")
-	got, err := sm.NewSession("bogus_idpc", "XXX", "bogus", url.URL{}, "", false, []string{"openid"})
+	got, err := sm.NewSession(session.SessionRequest{
+		ConnectorID:  "bogus_idpc",
+		ClientID:     "XXX",
+		ClientState:  "bogus",
+		Scope:        []string{"openid"},
+		ResponseType: "code",
+	})
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
@@ -34,24 +40,36 @@ func TestSessionManagerNewSession(t *testing.T) {
 
 func TestSessionAttachRemoteIdentityTwice(t *testing.T) {
 	sm := newManager()
-	sessionID, err := sm.NewSession("bogus_idpc", "XXX", "bogus", url.URL{}, "", false, []string{"openid"})
+	sessionID, err := sm.NewSession(session.SessionRequest{
+		ConnectorID:  "bogus_idpc",
+		ClientID:     "XXX",
+		ClientState:  "bogus",
+		Scope:        []string{"openid"},
+		ResponseType: "code",
+	})
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
 
 	ident := oidc.Identity{ID: "YYY", Name: "elroy", Email: "elroy@example.com"}
-	if _, err := sm.AttachRemoteIdentity(sessionID, ident); err != nil {
+	if _, err := sm.AttachRemoteIdentity(sessionID, ident, nil); err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
 
-	if _, err := sm.AttachRemoteIdentity(sessionID, ident); err == nil {
+	if _, err := sm.AttachRemoteIdentity(sessionID, ident, nil); err == nil {
 		t.Fatalf("Expected non-nil error")
 	}
 }
 
 func TestSessionManagerExchangeKey(t *testing.T) {
 	sm := newManager()
-	sessionID, err := sm.NewSession("connector_id", "XXX", "bogus", url.URL{}, "", false, []string{"openid"})
+	sessionID, err := sm.NewSession(session.SessionRequest{
+		ConnectorID:  "connector_id",
+		ClientID:     "XXX",
+		ClientState:  "bogus",
+		Scope:        []string{"openid"},
+		ResponseType: "code",
+	})
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
@@ -87,7 +105,13 @@ func TestSessionManagerGetSessionInStateNoExist(t *testing.T) {
 
 func TestSessionManagerGetSessionInStateWrongState(t *testing.T) {
 	sm := newManager()
-	sessionID, err := sm.NewSession("connector_id", "XXX", "bogus", url.URL{}, "", false, []string{"openid"})
+	sessionID, err := sm.NewSession(session.SessionRequest{
+		ConnectorID:  "connector_id",
+		ClientID:     "XXX",
+		ClientState:  "bogus",
+		Scope:        []string{"openid"},
+		ResponseType: "code",
+	})
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
@@ -102,13 +126,19 @@ func TestSessionManagerGetSessionInStateWrongState(t *testing.T) {
 
 func TestSessionManagerKill(t *testing.T) {
 	sm := newManager()
-	sessionID, err := sm.NewSession("connector_id", "XXX", "bogus", url.URL{}, "", false, []string{"openid"})
+	sessionID, err := sm.NewSession(session.SessionRequest{
+		ConnectorID:  "connector_id",
+		ClientID:     "XXX",
+		ClientState:  "bogus",
+		Scope:        []string{"openid"},
+		ResponseType: "code",
+	})
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
 
 	ident := oidc.Identity{ID: "YYY", Name: "elroy", Email: "elroy@example.com"}
-	if _, err := sm.AttachRemoteIdentity(sessionID, ident); err != nil {
+	if _, err := sm.AttachRemoteIdentity(sessionID, ident, nil); err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
 
@@ -124,3 +154,77 @@ func TestSessionManagerKill(t *testing.T) {
 		t.Errorf("Unexpected Session: %#v", ses)
 	}
 }
+
+func TestSessionManagerAttachBrowserSession(t *testing.T) {
+	sm := newManager()
+	sessionID, err := sm.NewSession(session.SessionRequest{
+		ConnectorID:  "bogus_idpc",
+		ClientID:     "XXX",
+		ClientState:  "bogus",
+		Scope:        []string{"openid"},
+		ResponseType: "code",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	authTime := time.Unix(1460000000, 0).UTC()
+	bs := session.BrowserSession{
+		ID:          "browser-session",
+		ConnectorID: "other_idpc",
+		Identity:    oidc.Identity{ID: "YYY", Name: "elroy", Email: "elroy@example.com"},
+		UserID:      "ZZZ",
+		AuthTime:    authTime,
+	}
+	if _, err := sm.AttachBrowserSession(sessionID, bs); err == nil {
+		t.Fatalf("Expected non-nil error attaching browser session of another connector")
+	}
+
+	bs.ConnectorID = "bogus_idpc"
+	if _, err := sm.AttachBrowserSession(sessionID, bs); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ses, err := sm.AttachUser(sessionID, bs.UserID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !ses.AuthTime.Equal(authTime) {
+		t.Errorf("Incorrect AuthTime: want=%v got=%v", authTime, ses.AuthTime)
+	}
+	if ses.BrowserSessionID != bs.ID {
+		t.Errorf("Incorrect BrowserSessionID: want=%s got=%s", bs.ID, ses.BrowserSessionID)
+	}
+}
+
+func TestSessionManagerSetPromptConsent(t *testing.T) {
+	sm := newManager()
+	sessionID, err := sm.NewSession(session.SessionRequest{
+		ConnectorID:  "bogus_idpc",
+		ClientID:     "XXX",
+		ClientState:  "bogus",
+		Scope:        []string{"openid"},
+		ResponseType: "code",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err := sm.SetPromptConsent(sessionID); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ses, err := sm.Get(sessionID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !ses.PromptConsent {
+		t.Errorf("Expected PromptConsent to be set")
+	}
+
+	ident := oidc.Identity{ID: "YYY", Name: "elroy", Email: "elroy@example.com"}
+	if _, err := sm.AttachRemoteIdentity(sessionID, ident, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := sm.SetPromptConsent(sessionID); err == nil {
+		t.Fatalf("Expected non-nil error setting prompt of a session past the NEW state")
+	}
+}
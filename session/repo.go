@@ -11,4 +11,16 @@ type SessionRepo interface {
 type SessionKeyRepo interface {
 	Push(SessionKey, time.Duration) error
 	Pop(string) (string, error)
+
+	// Peek returns the session ID of a key like Pop, but leaves the key
+	// usable.
+	Peek(string) (string, error)
+}
+
+type BrowserSessionRepo interface {
+	// Get returns the browser session with the given ID, or
+	// ErrorBrowserSessionNotFound if there's none or it expired.
+	Get(string) (*BrowserSession, error)
+	Create(BrowserSession) error
+	Delete(string) error
 }
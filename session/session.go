@@ -2,8 +2,10 @@ package session
 
 import (
 	"net/url"
+	"strings"
 	"time"
 
+	"github.com/coreos/dex/mfa"
 	"github.com/coreos/go-oidc/jose"
 	"github.com/coreos/go-oidc/oidc"
 )
@@ -31,6 +33,25 @@ type SessionKey struct {
 	SessionID string
 }
 
+// SessionRequest holds the parameters of the authentication request a
+// Session is created for.
+type SessionRequest struct {
+	ConnectorID string
+	ClientID    string
+	ClientState string
+	RedirectURL url.URL
+
+	// Register indicates that the session is a registration flow.
+	Register bool
+
+	Nonce               string
+	Scope               []string
+	ResponseType        string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	ClaimsRequest       ClaimsRequest
+}
+
 type Session struct {
 	ConnectorID string
 	ID          string
@@ -43,6 +64,10 @@ type Session struct {
 	Identity    oidc.Identity
 	UserID      string
 
+	// Groups are the names of the upstream groups of the user, as the
+	// connector passed them along with Identity.
+	Groups []string
+
 	// Regsiter indicates that this session is a registration flow.
 	Register bool
 
@@ -51,6 +76,46 @@ type Session struct {
 
 	// Scope is the 'scope' field in the authentication request. Example scopes are 'openid', 'email', 'offline', etc.
 	Scope []string
+
+	// ResponseType is the 'response_type' field in the authentication request, e.g. 'code' or 'id_token token'.
+	// An empty value is treated as 'code'.
+	ResponseType string
+
+	// CodeChallenge and CodeChallengeMethod are the PKCE (RFC 7636) parameters of the authentication request.
+	// If set, the code can only be exchanged by presenting the matching code verifier.
+	CodeChallenge       string
+	CodeChallengeMethod string
+
+	// ClaimsRequest lists the claims requested individually with the 'claims' field in the
+	// authentication request, on top of those requested by Scope.
+	ClaimsRequest ClaimsRequest
+
+	// AMR lists the methods the user authenticated with, as "amr" values of
+	// RFC 8176, if the connector reports them.
+	AMR []string
+
+	// RemoteIP is the address the user-agent started the session from.
+	RemoteIP string
+
+	// AuthTime is when the user last authenticated with the connector. It is
+	// earlier than CreatedAt if the session was resumed from a BrowserSession.
+	AuthTime time.Time
+
+	// BrowserSessionID is the ID of the BrowserSession the user-agent will
+	// use for single sign-on once the session identifies a user.
+	BrowserSessionID string
+
+	// PromptConsent is set if the client asked for the user to be asked for
+	// consent with prompt=consent, even if they consented before.
+	PromptConsent bool
+}
+
+// ClaimsRequest holds the names of the claims requested for the ID token and from the
+// UserInfo endpoint by the 'claims' request parameter.
+// http://openid.net/specs/openid-connect-core-1_0.html#ClaimsParameter
+type ClaimsRequest struct {
+	IDToken  []string `json:"id_token,omitempty"`
+	UserInfo []string `json:"userinfo,omitempty"`
 }
 
 // Claims returns a new set of Claims for the current session.
@@ -61,5 +126,38 @@ func (s *Session) Claims(issuerURL string) jose.Claims {
 	if s.Nonce != "" {
 		claims["nonce"] = s.Nonce
 	}
+	if !s.AuthTime.IsZero() {
+		claims["auth_time"] = s.AuthTime.Unix()
+	}
+	if len(s.AMR) != 0 {
+		claims["amr"] = s.AMR
+		if s.HasAMR(mfa.AMRMFA) {
+			claims["acr"] = mfa.ACRMFA
+		}
+	}
 	return claims
 }
+
+// HasAMR reports whether the user authenticated with the given method.
+func (s *Session) HasAMR(amr string) bool {
+	for _, a := range s.AMR {
+		if a == amr {
+			return true
+		}
+	}
+	return false
+}
+
+// HasResponseType reports whether typ is one of the space-separated values
+// of the session's response type.
+func (s *Session) HasResponseType(typ string) bool {
+	if s.ResponseType == "" {
+		return typ == "code"
+	}
+	for _, t := range strings.Fields(s.ResponseType) {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
@@ -84,6 +84,70 @@ func TestSessionClaims(t *testing.T) {
 				"nonce": "oncenay",
 			},
 		},
+		// Authentication methods are propagated, and a second factor sets acr.
+		{
+			ses: Session{
+				CreatedAt: now,
+				ExpiresAt: now.Add(time.Hour),
+				ClientID:  "XXX",
+				Identity: oidc.Identity{
+					ID:    "YYY",
+					Name:  "elroy",
+					Email: "elroy@example.com",
+				},
+				UserID: "elroy-id",
+				AMR:    []string{"mfa", "otp", "pwd"},
+			},
+			want: jose.Claims{
+				"iss": issuerURL,
+				"sub": "elroy-id",
+				"aud": "XXX",
+				"iat": now.Unix(),
+				"exp": now.Add(time.Hour).Unix(),
+				"amr": []string{"mfa", "otp", "pwd"},
+				"acr": "http://schemas.openid.net/pape/policies/2007/06/multi-factor",
+			},
+		},
+		{
+			ses: Session{
+				CreatedAt: now,
+				ExpiresAt: now.Add(time.Hour),
+				ClientID:  "XXX",
+				Identity: oidc.Identity{
+					ID:    "YYY",
+					Name:  "elroy",
+					Email: "elroy@example.com",
+				},
+				UserID: "elroy-id",
+				AMR:    []string{"pwd"},
+			},
+			want: jose.Claims{
+				"iss": issuerURL,
+				"sub": "elroy-id",
+				"aud": "XXX",
+				"iat": now.Unix(),
+				"exp": now.Add(time.Hour).Unix(),
+				"amr": []string{"pwd"},
+			},
+		},
+		// The time the user authenticated is propagated.
+		{
+			ses: Session{
+				CreatedAt: now,
+				ExpiresAt: now.Add(time.Hour),
+				ClientID:  "XXX",
+				UserID:    "elroy-id",
+				AuthTime:  now.Add(-time.Hour),
+			},
+			want: jose.Claims{
+				"iss":       issuerURL,
+				"sub":       "elroy-id",
+				"aud":       "XXX",
+				"iat":       now.Unix(),
+				"exp":       now.Add(time.Hour).Unix(),
+				"auth_time": now.Add(-time.Hour).Unix(),
+			},
+		},
 	}
 
 	for i, tt := range tests {
@@ -0,0 +1,59 @@
+package user
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/coreos/go-oidc/jose"
+	"github.com/coreos/go-oidc/key"
+	"github.com/coreos/go-oidc/oidc"
+)
+
+// NewAccountLink creates an object which can be sent to a user in serialized
+// form to confirm that the remote identity, which they logged in with, may
+// be linked to their existing account.
+func NewAccountLink(user User, rid RemoteIdentity, issuer url.URL, clientID string, expires time.Duration) AccountLink {
+	claims := oidc.NewClaims(issuer.String(), user.ID, clientID, clock.Now(), clock.Now().Add(expires))
+	claims.Add(ClaimAccountLinkConnectorID, rid.ConnectorID)
+	claims.Add(ClaimAccountLinkRemoteID, rid.ID)
+	return AccountLink{claims}
+}
+
+// An AccountLink is a token that proves a user controls the email address
+// of an existing account, as they got it in an email sent there.
+type AccountLink struct {
+	Claims jose.Claims
+}
+
+// ParseAndVerifyAccountLinkToken parses a string into an AccountLink,
+// verifies the signature, and ensures that the required claims are present.
+func ParseAndVerifyAccountLinkToken(token string, issuer url.URL, keys []key.PublicKey) (AccountLink, error) {
+	tokenClaims, err := parseAndVerifyTokenClaims(token, issuer, keys)
+	if err != nil {
+		return AccountLink{}, err
+	}
+
+	for _, k := range []string{ClaimAccountLinkConnectorID, ClaimAccountLinkRemoteID} {
+		v, ok, err := tokenClaims.Claims.StringClaim(k)
+		if err != nil {
+			return AccountLink{}, err
+		}
+		if !ok || v == "" {
+			return AccountLink{}, fmt.Errorf("no %q claim", k)
+		}
+	}
+
+	return AccountLink{tokenClaims.Claims}, nil
+}
+
+func (l AccountLink) UserID() string {
+	return assertStringClaim(l.Claims, "sub")
+}
+
+func (l AccountLink) RemoteIdentity() RemoteIdentity {
+	return RemoteIdentity{
+		ConnectorID: assertStringClaim(l.Claims, ClaimAccountLinkConnectorID),
+		ID:          assertStringClaim(l.Claims, ClaimAccountLinkRemoteID),
+	}
+}
@@ -0,0 +1,90 @@
+package user
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/kylelemons/godebug/pretty"
+
+	"github.com/coreos/go-oidc/jose"
+	"github.com/coreos/go-oidc/key"
+)
+
+func TestAccountLinkParseAndVerify(t *testing.T) {
+	issuer, _ := url.Parse("http://example.com")
+	notIssuer, _ := url.Parse("http://other.com")
+	client := "myclient"
+	user := User{ID: "1234", Email: "user@example.com"}
+	rid := RemoteIdentity{ConnectorID: "github", ID: "5678"}
+	expires := time.Hour * 3
+	privKey, _ := key.GeneratePrivateKey()
+	signer := privKey.Signer()
+	publicKeys := []key.PublicKey{*key.NewPublicKey(privKey.JWK())}
+
+	tests := []struct {
+		link    AccountLink
+		wantErr bool
+	}{
+		{
+			link:    NewAccountLink(user, rid, *issuer, client, expires),
+			wantErr: false,
+		},
+		{
+			link:    NewAccountLink(user, rid, *issuer, client, -expires),
+			wantErr: true,
+		},
+		{
+			link:    NewAccountLink(user, rid, *notIssuer, client, expires),
+			wantErr: true,
+		},
+		{
+			link:    NewAccountLink(User{Email: "noid@noid.com"}, rid, *issuer, client, expires),
+			wantErr: true,
+		},
+		{
+			link:    NewAccountLink(user, RemoteIdentity{ConnectorID: "github"}, *issuer, client, expires),
+			wantErr: true,
+		},
+		{
+			link:    NewAccountLink(user, RemoteIdentity{ID: "5678"}, *issuer, client, expires),
+			wantErr: true,
+		},
+		{
+			link:    NewAccountLink(user, rid, *issuer, "", expires),
+			wantErr: true,
+		},
+	}
+
+	for i, tt := range tests {
+		jwt, err := jose.NewSignedJWT(tt.link.Claims, signer)
+		if err != nil {
+			t.Fatalf("case %d: failed to generate JWT, error: %v", i, err)
+		}
+		token := jwt.Encode()
+
+		parsed, err := ParseAndVerifyAccountLinkToken(token, *issuer, publicKeys)
+
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("case %d: want no-nil error, got nil", i)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+
+		if diff := pretty.Compare(tt.link, parsed); diff != "" {
+			t.Errorf("case %d: Compare(want, got): %v", i, diff)
+		}
+		if parsed.UserID() != user.ID {
+			t.Errorf("case %d: want UserID %q, got %q", i, user.ID, parsed.UserID())
+		}
+		if diff := pretty.Compare(rid, parsed.RemoteIdentity()); diff != "" {
+			t.Errorf("case %d: Compare(want, got): %v", i, diff)
+		}
+	}
+}
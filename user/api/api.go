@@ -9,6 +9,7 @@ import (
 	"net/url"
 	"time"
 
+	"github.com/coreos/dex/audit"
 	"github.com/coreos/dex/client"
 	clientmanager "github.com/coreos/dex/client/manager"
 	"github.com/coreos/dex/pkg/log"
@@ -87,10 +88,11 @@ func (e Error) Error() string {
 // admin app before calling.
 type UsersAPI struct {
 	userManager      *usermanager.UserManager
-	localConnectorID string
+	localConnectorID func() string
 	clientManager    *clientmanager.ClientManager
 	refreshRepo      refresh.RefreshTokenRepo
 	emailer          Emailer
+	audit            *audit.Logger
 }
 
 type Emailer interface {
@@ -102,14 +104,18 @@ type Creds struct {
 	User     user.User
 }
 
+// NewUsersAPI returns a UsersAPI creating users with the local connector whose
+// ID localConnectorID returns, which is called for every user created as the
+// connectors may be reloaded.
 // TODO(ericchiang): Don't pass a dbMap. See #385.
-func NewUsersAPI(userManager *usermanager.UserManager, clientManager *clientmanager.ClientManager, refreshRepo refresh.RefreshTokenRepo, emailer Emailer, localConnectorID string) *UsersAPI {
+func NewUsersAPI(userManager *usermanager.UserManager, clientManager *clientmanager.ClientManager, refreshRepo refresh.RefreshTokenRepo, emailer Emailer, auditLogger *audit.Logger, localConnectorID func() string) *UsersAPI {
 	return &UsersAPI{
 		userManager:      userManager,
 		refreshRepo:      refreshRepo,
 		clientManager:    clientManager,
 		localConnectorID: localConnectorID,
 		emailer:          emailer,
+		audit:            auditLogger,
 	}
 }
 
@@ -139,6 +145,17 @@ func (u *UsersAPI) DisableUser(creds Creds, userID string, disable bool) (schema
 		return schema.UserDisableResponse{}, mapError(err)
 	}
 
+	typ := audit.EventUserEnabled
+	if disable {
+		typ = audit.EventUserDisabled
+	}
+	u.audit.Record(audit.Event{
+		Type:     typ,
+		UserID:   userID,
+		ClientID: creds.ClientID,
+		Details:  map[string]string{"admin": creds.User.ID},
+	})
+
 	return schema.UserDisableResponse{
 		Ok: true,
 	}, nil
@@ -165,7 +182,7 @@ func (u *UsersAPI) CreateUser(creds Creds, usr schema.User, redirURL url.URL) (s
 		return schema.UserCreateResponse{}, ErrorInvalidRedirectURL
 	}
 
-	id, err := u.userManager.CreateUser(schemaUserToUser(usr), user.Password(hash), u.localConnectorID)
+	id, err := u.userManager.CreateUser(schemaUserToUser(usr), user.Password(hash), u.localConnectorID())
 	if err != nil {
 		return schema.UserCreateResponse{}, mapError(err)
 	}
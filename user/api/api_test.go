@@ -192,13 +192,13 @@ func makeTestFixtures() (*UsersAPI, *testEmailer) {
 	}
 	refreshRepo := db.NewRefreshTokenRepo(dbMap)
 	for _, token := range refreshTokens {
-		if _, err := refreshRepo.Create(token.userID, token.clientID); err != nil {
+		if _, err := refreshRepo.Create(token.userID, token.clientID, []string{"openid"}); err != nil {
 			panic("Failed to create refresh token: " + err.Error())
 		}
 	}
 
 	emailer := &testEmailer{}
-	api := NewUsersAPI(mgr, clientManager, refreshRepo, emailer, "local")
+	api := NewUsersAPI(mgr, clientManager, refreshRepo, emailer, nil, func() string { return "local" })
 	return api, emailer
 
 }
@@ -24,6 +24,7 @@ type UserEmailer struct {
 	passwordResetURL url.URL
 	verifyEmailURL   url.URL
 	invitationURL    url.URL
+	linkAccountURL   url.URL
 }
 
 // NewUserEmailer creates a new UserEmailer.
@@ -37,6 +38,7 @@ func NewUserEmailer(ur user.UserRepo,
 	passwordResetURL url.URL,
 	verifyEmailURL url.URL,
 	invitationURL url.URL,
+	linkAccountURL url.URL,
 ) *UserEmailer {
 	return &UserEmailer{
 		ur:                  ur,
@@ -49,6 +51,7 @@ func NewUserEmailer(ur user.UserRepo,
 		passwordResetURL:    passwordResetURL,
 		verifyEmailURL:      verifyEmailURL,
 		invitationURL:       invitationURL,
+		linkAccountURL:      linkAccountURL,
 	}
 }
 
@@ -205,6 +208,43 @@ func (u *UserEmailer) SendEmailVerification(userID, clientID string, redirectURL
 	return &verifyURL, nil
 }
 
+// SendAccountLinkEmail sends an email to the user with the given userID containing a link which proves they control the email address of their account, so that the remote identity can be linked to it.
+// The link only works in the browser in which the remote identity logged in.
+// If there is no emailer is configured, the URL of the aforementioned link is returned, otherwise nil is returned.
+func (u *UserEmailer) SendAccountLinkEmail(userID string, rid user.RemoteIdentity, clientID string) (*url.URL, error) {
+	usr, err := u.ur.Get(nil, userID)
+	if err != nil {
+		log.Errorf("Error getting user: %q", err)
+		return nil, err
+	}
+
+	link := user.NewAccountLink(usr, rid, u.issuerURL, clientID, u.tokenValidityWindow)
+
+	token, err := u.signedClaimsToken(link.Claims)
+	if err != nil {
+		return nil, err
+	}
+
+	linkURL := u.linkAccountURL
+	q := linkURL.Query()
+	q.Set("token", token)
+	linkURL.RawQuery = q.Encode()
+
+	if u.emailer != nil {
+		err = u.emailer.SendMail(u.fromAddress, "Link Your Accounts", "link-account",
+			map[string]interface{}{
+				"email":        usr.Email,
+				"link":         linkURL.String(),
+				"connector_id": rid.ConnectorID,
+			}, usr.Email)
+		if err != nil {
+			log.Errorf("error sending account link email %v: ", err)
+		}
+		return nil, err
+	}
+	return &linkURL, nil
+}
+
 func (u *UserEmailer) SetEmailer(emailer *email.TemplatizedEmailer) {
 	u.emailer = emailer
 }
@@ -24,6 +24,7 @@ var (
 	passwordResetURL    = url.URL{Host: "dex.example.com", Path: "passwordReset"}
 	verifyEmailURL      = url.URL{Host: "dex.example.com", Path: "verifyEmail"}
 	acceptInvitationURL = url.URL{Host: "dex.example.com", Path: "acceptInvitation"}
+	linkAccountURL      = url.URL{Host: "dex.example.com", Path: "linkAccount"}
 	redirURL            = url.URL{Host: "client.example.com", Path: "/redirURL"}
 	clientID            = "XXX"
 )
@@ -102,7 +103,8 @@ func makeTestFixtures() (*UserEmailer, *testEmailer, *key.PublicKey) {
 	}
 
 	textTemplateString := `{{define "password-reset.txt"}}{{.link}}{{end}}
-{{define "verify-email.txt"}}{{.link}}{{end}}"`
+{{define "verify-email.txt"}}{{.link}}{{end}}
+{{define "link-account.txt"}}{{.link}}{{end}}"`
 	textTemplates := template.New("text")
 	_, err = textTemplates.Parse(textTemplateString)
 	if err != nil {
@@ -114,7 +116,7 @@ func makeTestFixtures() (*UserEmailer, *testEmailer, *key.PublicKey) {
 	emailer := &testEmailer{}
 	tEmailer := email.NewTemplatizedEmailerFromTemplates(textTemplates, htmlTemplates, emailer)
 
-	userEmailer := NewUserEmailer(ur, pwr, signerFn, validityWindow, issuerURL, tEmailer, fromAddress, passwordResetURL, verifyEmailURL, acceptInvitationURL)
+	userEmailer := NewUserEmailer(ur, pwr, signerFn, validityWindow, issuerURL, tEmailer, fromAddress, passwordResetURL, verifyEmailURL, acceptInvitationURL, linkAccountURL)
 
 	return userEmailer, emailer, publicKey
 }
@@ -327,3 +329,92 @@ func TestSendEmailVerificationEmail(t *testing.T) {
 		}
 	}
 }
+
+func TestSendAccountLinkEmail(t *testing.T) {
+	rid := user.RemoteIdentity{ConnectorID: "github", ID: "1234"}
+	tests := []struct {
+		userID     string
+		hasEmailer bool
+
+		wantURL   bool
+		wantEmail bool
+		wantErr   bool
+	}{
+		{
+			// typical case with an emailer.
+			userID:     "ID-3",
+			hasEmailer: true,
+
+			wantEmail: true,
+		},
+		{
+			// typical case without an emailer.
+			userID:     "ID-3",
+			hasEmailer: false,
+
+			wantURL: true,
+		},
+		{
+			// no such user.
+			userID:     "ID-4",
+			hasEmailer: true,
+			wantErr:    true,
+		},
+	}
+
+	for i, tt := range tests {
+		ue, emailer, pubKey := makeTestFixtures()
+		if !tt.hasEmailer {
+			ue.SetEmailer(nil)
+		}
+		linkURL, err := ue.SendAccountLinkEmail(tt.userID, rid, clientID)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("case %d: want non-nil err.", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+
+		if tt.wantURL {
+			if linkURL == nil {
+				t.Errorf("case %d: want non-nil linkURL", i)
+				continue
+			}
+		} else if linkURL != nil {
+			t.Errorf("case %d: want linkURL==nil, got==%v", i, linkURL.String())
+			continue
+		}
+
+		if tt.wantEmail {
+			if !emailer.sent {
+				t.Errorf("case %d: want emailer.sent", i)
+				continue
+			}
+			if linkURL, err = url.Parse(emailer.text); err != nil {
+				t.Errorf("case %d: want nil err, got: %q", i, err)
+				continue
+			}
+			if diff := pretty.Compare([]string{"id3@example.com"}, emailer.to); diff != "" {
+				t.Errorf("case %d: Compare(want, got) = %v", i, diff)
+			}
+		} else if emailer.sent {
+			t.Errorf("case %d: want !emailer.sent", i)
+		}
+
+		link, err := user.ParseAndVerifyAccountLinkToken(linkURL.Query().Get("token"), issuerURL, []key.PublicKey{*pubKey})
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if link.UserID() != tt.userID {
+			t.Errorf("case %d: want==%v, got==%v", i, tt.userID, link.UserID())
+		}
+		if diff := pretty.Compare(rid, link.RemoteIdentity()); diff != "" {
+			t.Errorf("case %d: Compare(want, got) = %v", i, diff)
+		}
+	}
+}
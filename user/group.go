@@ -0,0 +1,99 @@
+package user
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/coreos/dex/repo"
+)
+
+var (
+	ErrorGroupNotFound      = errors.New("group not found in repository")
+	ErrorDuplicateGroupName = errors.New("group name not available")
+	ErrorInvalidGroupName   = errors.New("invalid group name")
+	ErrorNotGroupMember     = errors.New("user is not a member of the group")
+)
+
+// MaxGroupNameLength bounds the length of group names, which are released
+// verbatim in the "groups" claim.
+const MaxGroupNameLength = 200
+
+// Group is a named set of users. Its members are either managed through the
+// admin API, or synced from the upstream groups connectors supply on login.
+type Group struct {
+	// ID is the machine-generated, stable, unique identifier for this Group.
+	ID string
+
+	// Name is the unique name of the Group, as released in the "groups" claim.
+	Name string
+
+	CreatedAt time.Time
+}
+
+// ValidGroupName reports whether name can be used as a group name.
+func ValidGroupName(name string) bool {
+	return name != "" && len(name) <= MaxGroupNameLength
+}
+
+// ConnectorGroupName returns the name of the group an upstream group of the
+// given connector is synced to. Upstream groups are named in the namespace of
+// their connector, so a connector can't make users members of groups managed
+// through the admin API, or of the groups of other connectors.
+func ConnectorGroupName(connectorID, name string) string {
+	return connectorID + ":" + name
+}
+
+// ValidAdminGroupName reports whether name can be used for a group managed
+// through the admin API. Names containing ":" are reserved for the groups
+// synced from connectors.
+func ValidAdminGroupName(name string) bool {
+	return ValidGroupName(name) && !strings.Contains(name, ":")
+}
+
+// GroupRepo implementations maintain a persistent set of groups and their
+// members. Each membership is attributed to a connector, or to no connector
+// (an empty connector ID) if it's managed through the admin API, so that
+// syncing the upstream groups of a user leaves the other memberships alone.
+type GroupRepo interface {
+	Get(tx repo.Transaction, id string) (Group, error)
+
+	GetByName(tx repo.Transaction, name string) (Group, error)
+
+	// List returns all groups, ordered by name.
+	List(tx repo.Transaction) ([]Group, error)
+
+	Create(tx repo.Transaction, group Group) error
+
+	// Delete removes the group along with all of its memberships.
+	Delete(tx repo.Transaction, id string) error
+
+	// AddMember adds the user to the group on behalf of the given connector.
+	// Adding an existing member is not an error.
+	AddMember(tx repo.Transaction, groupID, userID, connectorID string) error
+
+	// RemoveMember removes the user's membership of the group attributed to the
+	// given connector.
+	RemoveMember(tx repo.Transaction, groupID, userID, connectorID string) error
+
+	// GetMembers returns the IDs of the users in the group, however they
+	// became members.
+	GetMembers(tx repo.Transaction, groupID string) ([]string, error)
+
+	// GetGroupsForUser returns the groups the user is a member of, ordered by
+	// name.
+	GetGroupsForUser(tx repo.Transaction, userID string) ([]Group, error)
+
+	// SetConnectorGroups replaces the memberships of the user attributed to the
+	// given connector with memberships of the given groups.
+	SetConnectorGroups(tx repo.Transaction, userID, connectorID string, groupIDs []string) error
+}
+
+// GroupNames returns the names of the given groups.
+func GroupNames(groups []Group) []string {
+	names := make([]string, len(groups))
+	for i, g := range groups {
+		names[i] = g.Name
+	}
+	return names
+}
@@ -0,0 +1,383 @@
+package user
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+
+	pcrypto "github.com/coreos/dex/pkg/crypto"
+)
+
+const (
+	hashSaltLength = 16
+	hashKeyLength  = 32
+
+	DefaultScryptLogN = 15
+	DefaultScryptR    = 8
+	DefaultScryptP    = 1
+
+	DefaultArgon2idTime    = 3
+	DefaultArgon2idMemory  = 64 * 1024
+	DefaultArgon2idThreads = 4
+)
+
+var (
+	ErrorUnknownHashAlgorithm = errors.New("unknown password hash algorithm")
+
+	errorMalformedHash = errors.New("malformed password hash")
+
+	// PasswordHashAlgorithm hashes new passwords. Passwords hashed by other
+	// algorithms, or with other parameters, are hashed again with it when
+	// their users log in.
+	PasswordHashAlgorithm HashAlgorithm = BcryptHashAlgorithm{Cost: bcryptHashCost}
+
+	// hashAlgorithms are the algorithms whose hashes can be checked. Their
+	// parameters don't matter, since hashes carry the ones they were made
+	// with.
+	hashAlgorithms = []HashAlgorithm{
+		BcryptHashAlgorithm{},
+		ScryptHashAlgorithm{},
+		Argon2idHashAlgorithm{},
+	}
+)
+
+// A HashAlgorithm makes and checks password hashes of one kind.
+type HashAlgorithm interface {
+	// Hash hashes plaintext with the algorithm's parameters.
+	Hash(plaintext string) (Password, error)
+
+	// Owns reports whether hash was made by the algorithm.
+	Owns(hash Password) bool
+
+	// Compare returns nil if hash is a hash of plaintext.
+	Compare(hash Password, plaintext string) error
+
+	// Outdated reports whether hash, which the algorithm owns, was made
+	// with parameters other than the algorithm's.
+	Outdated(hash Password) bool
+}
+
+// NewHashAlgorithm parses a hash algorithm from a spec of its name,
+// optionally followed by a colon and comma separated parameters, for
+// example "bcrypt:cost=12", "scrypt:ln=15,r=8,p=1" or
+// "argon2id:t=3,m=65536,p=4". Parameters which aren't given take their
+// default values.
+func NewHashAlgorithm(spec string) (HashAlgorithm, error) {
+	name, paramSpec := spec, ""
+	if i := strings.Index(spec, ":"); i >= 0 {
+		name, paramSpec = spec[:i], spec[i+1:]
+	}
+	params, err := parseHashParams(paramSpec)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		a     HashAlgorithm
+		known []string
+	)
+	switch name {
+	case "bcrypt":
+		h := BcryptHashAlgorithm{Cost: bcryptHashCost}
+		known = []string{"cost"}
+		if v, ok := params["cost"]; ok {
+			h.Cost = v
+		}
+		if h.Cost < bcrypt.MinCost || h.Cost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		a = h
+	case "scrypt":
+		h := ScryptHashAlgorithm{LogN: DefaultScryptLogN, R: DefaultScryptR, P: DefaultScryptP}
+		known = []string{"ln", "r", "p"}
+		if v, ok := params["ln"]; ok {
+			h.LogN = v
+		}
+		if v, ok := params["r"]; ok {
+			h.R = v
+		}
+		if v, ok := params["p"]; ok {
+			h.P = v
+		}
+		if h.LogN < 1 || h.LogN > 30 || h.R < 1 || h.P < 1 {
+			return nil, errors.New("scrypt parameters must be positive, and ln at most 30")
+		}
+		a = h
+	case "argon2id":
+		h := Argon2idHashAlgorithm{Time: DefaultArgon2idTime, Memory: DefaultArgon2idMemory, Threads: DefaultArgon2idThreads}
+		known = []string{"t", "m", "p"}
+		if v, ok := params["t"]; ok {
+			h.Time = uint32(v)
+		}
+		if v, ok := params["m"]; ok {
+			h.Memory = uint32(v)
+		}
+		if v, ok := params["p"]; ok {
+			if v > 255 {
+				return nil, errors.New("argon2id threads must be at most 255")
+			}
+			h.Threads = uint8(v)
+		}
+		if h.Time < 1 || h.Memory < 8*uint32(h.Threads) || h.Threads < 1 {
+			return nil, errors.New("argon2id parameters must be positive, and m at least 8 times p")
+		}
+		a = h
+	default:
+		return nil, ErrorUnknownHashAlgorithm
+	}
+
+	for k := range params {
+		if !containsString(known, k) {
+			return nil, fmt.Errorf("unknown %s parameter %q", name, k)
+		}
+	}
+	return a, nil
+}
+
+// ComparePassword returns nil if hash, which may have been made by any
+// known algorithm, is a hash of plaintext, and ErrorPasswordHashNoMatch
+// otherwise.
+func ComparePassword(hash Password, plaintext string) error {
+	a := hashAlgorithmOf(hash)
+	if a == nil || a.Compare(hash, plaintext) != nil {
+		return ErrorPasswordHashNoMatch
+	}
+	return nil
+}
+
+// hashOutdated reports whether hash needs to be made again with
+// PasswordHashAlgorithm.
+func hashOutdated(hash Password) bool {
+	if PasswordHashAlgorithm.Owns(hash) {
+		return PasswordHashAlgorithm.Outdated(hash)
+	}
+	return hashAlgorithmOf(hash) != nil
+}
+
+func hashAlgorithmOf(hash Password) HashAlgorithm {
+	for _, a := range hashAlgorithms {
+		if a.Owns(hash) {
+			return a
+		}
+	}
+	return nil
+}
+
+// BcryptHashAlgorithm hashes passwords with bcrypt. Since bcrypt ignores
+// all but the first 72 bytes of a password, longer ones are rejected by
+// the password policy.
+type BcryptHashAlgorithm struct {
+	Cost int
+}
+
+func (a BcryptHashAlgorithm) Hash(plaintext string) (Password, error) {
+	return bcrypt.GenerateFromPassword([]byte(plaintext), a.Cost)
+}
+
+func (a BcryptHashAlgorithm) Owns(hash Password) bool {
+	for _, prefix := range []string{"$2$", "$2a$", "$2b$", "$2y$"} {
+		if strings.HasPrefix(string(hash), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a BcryptHashAlgorithm) Compare(hash Password, plaintext string) error {
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(plaintext)); err != nil {
+		return ErrorPasswordHashNoMatch
+	}
+	return nil
+}
+
+func (a BcryptHashAlgorithm) Outdated(hash Password) bool {
+	cost, err := bcrypt.Cost(hash)
+	return err != nil || cost != a.Cost
+}
+
+// ScryptHashAlgorithm hashes passwords with scrypt. Its hashes are encoded
+// as "$scrypt$ln=<LogN>,r=<R>,p=<P>$<salt>$<key>".
+type ScryptHashAlgorithm struct {
+	// LogN is the base 2 logarithm of scrypt's CPU/memory cost N.
+	LogN int
+	R    int
+	P    int
+}
+
+func (a ScryptHashAlgorithm) Hash(plaintext string) (Password, error) {
+	salt, err := pcrypto.RandBytes(hashSaltLength)
+	if err != nil {
+		return nil, err
+	}
+	key, err := scrypt.Key([]byte(plaintext), salt, 1<<uint(a.LogN), a.R, a.P, hashKeyLength)
+	if err != nil {
+		return nil, err
+	}
+	return encodeHash("scrypt", "", fmt.Sprintf("ln=%d,r=%d,p=%d", a.LogN, a.R, a.P), salt, key), nil
+}
+
+func (a ScryptHashAlgorithm) Owns(hash Password) bool {
+	return strings.HasPrefix(string(hash), "$scrypt$")
+}
+
+func (a ScryptHashAlgorithm) Compare(hash Password, plaintext string) error {
+	h, salt, key, err := a.decode(hash)
+	if err != nil {
+		return err
+	}
+	got, err := scrypt.Key([]byte(plaintext), salt, 1<<uint(h.LogN), h.R, h.P, len(key))
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare(got, key) != 1 {
+		return ErrorPasswordHashNoMatch
+	}
+	return nil
+}
+
+func (a ScryptHashAlgorithm) Outdated(hash Password) bool {
+	h, _, _, err := a.decode(hash)
+	return err != nil || h != a
+}
+
+func (a ScryptHashAlgorithm) decode(hash Password) (ScryptHashAlgorithm, []byte, []byte, error) {
+	params, salt, key, err := decodeHash(hash, "scrypt", "")
+	if err != nil {
+		return ScryptHashAlgorithm{}, nil, nil, err
+	}
+	h := ScryptHashAlgorithm{LogN: params["ln"], R: params["r"], P: params["p"]}
+	if h.LogN < 1 || h.LogN > 30 || h.R < 1 || h.P < 1 {
+		return ScryptHashAlgorithm{}, nil, nil, errorMalformedHash
+	}
+	return h, salt, key, nil
+}
+
+// Argon2idHashAlgorithm hashes passwords with Argon2id. Its hashes are
+// encoded in the format of the reference implementation,
+// "$argon2id$v=19$m=<Memory>,t=<Time>,p=<Threads>$<salt>$<key>".
+type Argon2idHashAlgorithm struct {
+	Time uint32
+	// Memory is in KiB.
+	Memory  uint32
+	Threads uint8
+}
+
+func (a Argon2idHashAlgorithm) Hash(plaintext string) (Password, error) {
+	salt, err := pcrypto.RandBytes(hashSaltLength)
+	if err != nil {
+		return nil, err
+	}
+	key := argon2.IDKey([]byte(plaintext), salt, a.Time, a.Memory, a.Threads, hashKeyLength)
+	params := fmt.Sprintf("m=%d,t=%d,p=%d", a.Memory, a.Time, a.Threads)
+	return encodeHash("argon2id", fmt.Sprintf("v=%d", argon2.Version), params, salt, key), nil
+}
+
+func (a Argon2idHashAlgorithm) Owns(hash Password) bool {
+	return strings.HasPrefix(string(hash), "$argon2id$")
+}
+
+func (a Argon2idHashAlgorithm) Compare(hash Password, plaintext string) error {
+	h, salt, key, err := a.decode(hash)
+	if err != nil {
+		return err
+	}
+	got := argon2.IDKey([]byte(plaintext), salt, h.Time, h.Memory, h.Threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(got, key) != 1 {
+		return ErrorPasswordHashNoMatch
+	}
+	return nil
+}
+
+func (a Argon2idHashAlgorithm) Outdated(hash Password) bool {
+	h, _, _, err := a.decode(hash)
+	return err != nil || h != a
+}
+
+func (a Argon2idHashAlgorithm) decode(hash Password) (Argon2idHashAlgorithm, []byte, []byte, error) {
+	params, salt, key, err := decodeHash(hash, "argon2id", fmt.Sprintf("v=%d", argon2.Version))
+	if err != nil {
+		return Argon2idHashAlgorithm{}, nil, nil, err
+	}
+	if params["t"] < 1 || params["m"] < 1 || params["p"] < 1 || params["p"] > 255 {
+		return Argon2idHashAlgorithm{}, nil, nil, errorMalformedHash
+	}
+	h := Argon2idHashAlgorithm{Time: uint32(params["t"]), Memory: uint32(params["m"]), Threads: uint8(params["p"])}
+	return h, salt, key, nil
+}
+
+// encodeHash encodes a hash in the "$<id>[$<version>]$<params>$<salt>$<key>"
+// format shared by scrypt and Argon2id hashes.
+func encodeHash(id, version, params string, salt, key []byte) Password {
+	fields := []string{"", id}
+	if version != "" {
+		fields = append(fields, version)
+	}
+	fields = append(fields, params,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key))
+	return Password(strings.Join(fields, "$"))
+}
+
+// decodeHash returns the parameters, salt and key of a hash encoded by
+// encodeHash with the given id and version.
+func decodeHash(hash Password, id, version string) (map[string]int, []byte, []byte, error) {
+	parts := strings.Split(string(hash), "$")
+	if len(parts) > 2 && version != "" {
+		if parts[2] != version {
+			return nil, nil, nil, errorMalformedHash
+		}
+		parts = append(parts[:2], parts[3:]...)
+	}
+	if len(parts) != 5 || parts[0] != "" || parts[1] != id {
+		return nil, nil, nil, errorMalformedHash
+	}
+	params, err := parseHashParams(parts[2])
+	if err != nil {
+		return nil, nil, nil, errorMalformedHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return nil, nil, nil, errorMalformedHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil || len(key) == 0 {
+		return nil, nil, nil, errorMalformedHash
+	}
+	return params, salt, key, nil
+}
+
+// parseHashParams parses comma separated "<name>=<integer>" parameters.
+func parseHashParams(s string) (map[string]int, error) {
+	params := make(map[string]int)
+	if s == "" {
+		return params, nil
+	}
+	for _, param := range strings.Split(s, ",") {
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid hash parameter %q", param)
+		}
+		v, err := strconv.Atoi(kv[1])
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("invalid hash parameter %q", param)
+		}
+		params[kv[0]] = v
+	}
+	return params, nil
+}
+
+func containsString(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
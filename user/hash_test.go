@@ -0,0 +1,153 @@
+package user
+
+import (
+	"testing"
+
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestNewHashAlgorithm(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    HashAlgorithm
+		wantErr bool
+	}{
+		{spec: "bcrypt", want: BcryptHashAlgorithm{Cost: bcryptHashCost}},
+		{spec: "bcrypt:cost=12", want: BcryptHashAlgorithm{Cost: 12}},
+		{spec: "scrypt", want: ScryptHashAlgorithm{LogN: DefaultScryptLogN, R: DefaultScryptR, P: DefaultScryptP}},
+		{spec: "scrypt:ln=16", want: ScryptHashAlgorithm{LogN: 16, R: DefaultScryptR, P: DefaultScryptP}},
+		{spec: "argon2id", want: Argon2idHashAlgorithm{Time: DefaultArgon2idTime, Memory: DefaultArgon2idMemory, Threads: DefaultArgon2idThreads}},
+		{spec: "argon2id:t=1,m=32768,p=2", want: Argon2idHashAlgorithm{Time: 1, Memory: 32768, Threads: 2}},
+		{spec: "md5", wantErr: true},
+		{spec: "bcrypt:cost=99", wantErr: true},
+		{spec: "bcrypt:ln=4", wantErr: true},
+		{spec: "scrypt:r=0", wantErr: true},
+		{spec: "argon2id:p=256", wantErr: true},
+		{spec: "argon2id:m", wantErr: true},
+	}
+
+	for i, tt := range tests {
+		got, err := NewHashAlgorithm(tt.spec)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("case %d: want non-nil error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if diff := pretty.Compare(tt.want, got); diff != "" {
+			t.Errorf("case %d: Compare(want, got) = %v", i, diff)
+		}
+	}
+}
+
+func TestHashAlgorithms(t *testing.T) {
+	tests := []struct {
+		algorithm HashAlgorithm
+		// other differs from algorithm in its parameters only.
+		other HashAlgorithm
+	}{
+		{
+			algorithm: BcryptHashAlgorithm{Cost: 4},
+			other:     BcryptHashAlgorithm{Cost: 5},
+		},
+		{
+			algorithm: ScryptHashAlgorithm{LogN: 4, R: 8, P: 1},
+			other:     ScryptHashAlgorithm{LogN: 5, R: 8, P: 1},
+		},
+		{
+			algorithm: Argon2idHashAlgorithm{Time: 1, Memory: 64, Threads: 1},
+			other:     Argon2idHashAlgorithm{Time: 2, Memory: 64, Threads: 1},
+		},
+	}
+
+	for i, tt := range tests {
+		hash, err := tt.algorithm.Hash("password")
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if a := hashAlgorithmOf(hash); a == nil || !a.Owns(hash) || !tt.algorithm.Owns(hash) {
+			t.Errorf("case %d: hash %q not recognized", i, hash)
+		}
+		if err := ComparePassword(hash, "password"); err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+		}
+		if err := ComparePassword(hash, "Password"); err != ErrorPasswordHashNoMatch {
+			t.Errorf("case %d: want err=%v, got=%v", i, ErrorPasswordHashNoMatch, err)
+		}
+		if tt.algorithm.Outdated(hash) {
+			t.Errorf("case %d: want hash up to date", i)
+		}
+		if !tt.other.Outdated(hash) {
+			t.Errorf("case %d: want hash outdated for other parameters", i)
+		}
+
+		// Hashes of the same password differ by their salt.
+		again, err := tt.algorithm.Hash("password")
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if string(again) == string(hash) {
+			t.Errorf("case %d: want hashes salted", i)
+		}
+	}
+}
+
+func TestComparePasswordMalformed(t *testing.T) {
+	tests := []Password{
+		Password(""),
+		Password("password"),
+		Password("$scrypt$ln=4,r=8,p=1$c2FsdA"),
+		Password("$scrypt$ln=99,r=8,p=1$c2FsdA$a2V5"),
+		Password("$argon2id$v=16$m=64,t=1,p=1$c2FsdA$a2V5"),
+		Password("$argon2id$v=19$m=64,t=1,p=1$!!!$a2V5"),
+	}
+
+	for i, hash := range tests {
+		if err := ComparePassword(hash, "password"); err != ErrorPasswordHashNoMatch {
+			t.Errorf("case %d: want err=%v, got=%v", i, ErrorPasswordHashNoMatch, err)
+		}
+	}
+}
+
+func TestPasswordInfoRehash(t *testing.T) {
+	defer func(a HashAlgorithm) {
+		PasswordHashAlgorithm = a
+	}(PasswordHashAlgorithm)
+
+	PasswordHashAlgorithm = BcryptHashAlgorithm{Cost: 4}
+	bcryptHash, err := PasswordHashAlgorithm.Hash("password")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	PasswordHashAlgorithm = Argon2idHashAlgorithm{Time: 1, Memory: 64, Threads: 1}
+	pwi := PasswordInfo{UserID: "elroy-id", Password: bcryptHash}
+	if _, err := pwi.Authenticate("password"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rehashed, err := pwi.Rehash("password")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !rehashed || !PasswordHashAlgorithm.Owns(pwi.Password) {
+		t.Fatalf("want password rehashed with argon2id, got %q", pwi.Password)
+	}
+	if _, err := pwi.Authenticate("password"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// Up to date hashes are left alone.
+	hash := pwi.Password
+	if rehashed, err := pwi.Rehash("password"); err != nil || rehashed {
+		t.Errorf("want no rehash, got rehashed=%t err=%v", rehashed, err)
+	}
+	if string(pwi.Password) != string(hash) {
+		t.Errorf("want password unchanged")
+	}
+}
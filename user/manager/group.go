@@ -0,0 +1,193 @@
+package manager
+
+import (
+	"github.com/jonboulle/clockwork"
+
+	"github.com/coreos/dex/repo"
+	"github.com/coreos/dex/user"
+)
+
+// GroupManager performs group-related "business-logic" functions, such as
+// syncing the upstream groups of users, on top of the GroupRepo.
+type GroupManager struct {
+	Clock clockwork.Clock
+
+	groupRepo        user.GroupRepo
+	userRepo         user.UserRepo
+	begin            repo.TransactionFactory
+	groupIDGenerator user.UserIDGenerator
+}
+
+func NewGroupManager(groupRepo user.GroupRepo, userRepo user.UserRepo, txnFactory repo.TransactionFactory) *GroupManager {
+	return &GroupManager{
+		Clock: clockwork.NewRealClock(),
+
+		groupRepo:        groupRepo,
+		userRepo:         userRepo,
+		begin:            txnFactory,
+		groupIDGenerator: user.DefaultUserIDGenerator,
+	}
+}
+
+func (m *GroupManager) Get(id string) (user.Group, error) {
+	return m.groupRepo.Get(nil, id)
+}
+
+func (m *GroupManager) List() ([]user.Group, error) {
+	return m.groupRepo.List(nil)
+}
+
+func (m *GroupManager) GetMembers(groupID string) ([]string, error) {
+	return m.groupRepo.GetMembers(nil, groupID)
+}
+
+// GetGroupNamesForUser returns the names of the groups the user is a member
+// of, as released in the "groups" claim.
+func (m *GroupManager) GetGroupNamesForUser(userID string) ([]string, error) {
+	groups, err := m.groupRepo.GetGroupsForUser(nil, userID)
+	if err != nil {
+		return nil, err
+	}
+	return user.GroupNames(groups), nil
+}
+
+// CreateGroup creates a new group with the given name and returns its ID.
+func (m *GroupManager) CreateGroup(name string) (string, error) {
+	if !user.ValidAdminGroupName(name) {
+		return "", user.ErrorInvalidGroupName
+	}
+
+	tx, err := m.begin()
+	if err != nil {
+		return "", err
+	}
+
+	g, err := m.insertNewGroup(tx, name)
+	if err != nil {
+		rollback(tx)
+		return "", err
+	}
+
+	if err = tx.Commit(); err != nil {
+		rollback(tx)
+		return "", err
+	}
+	return g.ID, nil
+}
+
+func (m *GroupManager) DeleteGroup(id string) error {
+	tx, err := m.begin()
+	if err != nil {
+		return err
+	}
+
+	if err = m.groupRepo.Delete(tx, id); err != nil {
+		rollback(tx)
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		rollback(tx)
+		return err
+	}
+	return nil
+}
+
+// AddMember makes the user a member of the group. Memberships added this way
+// are left alone when upstream groups are synced.
+func (m *GroupManager) AddMember(groupID, userID string) error {
+	tx, err := m.begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err = m.userRepo.Get(tx, userID); err != nil {
+		rollback(tx)
+		return err
+	}
+
+	if err = m.groupRepo.AddMember(tx, groupID, userID, ""); err != nil {
+		rollback(tx)
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		rollback(tx)
+		return err
+	}
+	return nil
+}
+
+// RemoveMember removes a membership added by AddMember. Memberships synced
+// from a connector can't be removed, as they'd be restored on the next login.
+func (m *GroupManager) RemoveMember(groupID, userID string) error {
+	tx, err := m.begin()
+	if err != nil {
+		return err
+	}
+
+	if err = m.groupRepo.RemoveMember(tx, groupID, userID, ""); err != nil {
+		rollback(tx)
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		rollback(tx)
+		return err
+	}
+	return nil
+}
+
+// SyncConnectorGroups makes the user a member of exactly the given upstream
+// groups on behalf of the connector, creating any groups which don't exist
+// yet. The groups are named in the connector's namespace, see
+// user.ConnectorGroupName. Memberships attributed to other connectors, or
+// added through the admin API, are left alone.
+func (m *GroupManager) SyncConnectorGroups(userID, connectorID string, names []string) error {
+	tx, err := m.begin()
+	if err != nil {
+		return err
+	}
+
+	var groupIDs []string
+	for _, name := range names {
+		name = user.ConnectorGroupName(connectorID, name)
+		g, err := m.groupRepo.GetByName(tx, name)
+		if err == user.ErrorGroupNotFound {
+			g, err = m.insertNewGroup(tx, name)
+		}
+		if err != nil {
+			rollback(tx)
+			return err
+		}
+		groupIDs = append(groupIDs, g.ID)
+	}
+
+	if err = m.groupRepo.SetConnectorGroups(tx, userID, connectorID, groupIDs); err != nil {
+		rollback(tx)
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		rollback(tx)
+		return err
+	}
+	return nil
+}
+
+func (m *GroupManager) insertNewGroup(tx repo.Transaction, name string) (user.Group, error) {
+	groupID, err := m.groupIDGenerator()
+	if err != nil {
+		return user.Group{}, err
+	}
+
+	g := user.Group{
+		ID:        groupID,
+		Name:      name,
+		CreatedAt: m.Clock.Now(),
+	}
+	if err = m.groupRepo.Create(tx, g); err != nil {
+		return user.Group{}, err
+	}
+	return g, nil
+}
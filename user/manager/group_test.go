@@ -0,0 +1,123 @@
+package manager
+
+import (
+	"testing"
+
+	"github.com/kylelemons/godebug/pretty"
+
+	"github.com/coreos/dex/user"
+)
+
+func TestGroupAddMember(t *testing.T) {
+	tests := []struct {
+		groupID string
+		userID  string
+		wantErr error
+	}{
+		{
+			userID: "ID-1",
+		},
+		{
+			userID:  "ID-3",
+			wantErr: user.ErrorNotFound,
+		},
+		{
+			groupID: "no-such-group",
+			userID:  "ID-1",
+			wantErr: user.ErrorGroupNotFound,
+		},
+	}
+
+	for i, tt := range tests {
+		f := makeTestFixtures()
+		groupID, err := f.gm.CreateGroup("admins")
+		if err != nil {
+			t.Fatalf("case %d: unable to create group: %v", i, err)
+		}
+		if tt.groupID != "" {
+			groupID = tt.groupID
+		}
+
+		err = f.gm.AddMember(groupID, tt.userID)
+		if err != tt.wantErr {
+			t.Errorf("case %d: want err=%v, got=%v", i, tt.wantErr, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		members, err := f.gm.GetMembers(groupID)
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if diff := pretty.Compare([]string{tt.userID}, members); diff != "" {
+			t.Errorf("case %d: Compare(want, got) = %v", i, diff)
+		}
+	}
+}
+
+func TestSyncConnectorGroups(t *testing.T) {
+	f := makeTestFixtures()
+
+	devs, err := f.gm.CreateGroup("developers")
+	if err != nil {
+		t.Fatalf("Unable to create group: %v", err)
+	}
+	if err := f.gm.AddMember(devs, "ID-1"); err != nil {
+		t.Fatalf("Unable to add member: %v", err)
+	}
+
+	tests := []struct {
+		names      []string
+		wantGroups []string
+	}{
+		{
+			names:      []string{"ops", "admins"},
+			wantGroups: []string{"developers", "ldap:admins", "ldap:ops"},
+		},
+		{
+			// Groups dropped upstream are dropped, and an upstream group
+			// named like a group managed through the admin API is a group
+			// of its own.
+			names:      []string{"developers"},
+			wantGroups: []string{"developers", "ldap:developers"},
+		},
+		{
+			names:      nil,
+			wantGroups: []string{"developers"},
+		},
+	}
+
+	for i, tt := range tests {
+		if err := f.gm.SyncConnectorGroups("ID-1", "ldap", tt.names); err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+
+		got, err := f.gm.GetGroupNamesForUser("ID-1")
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if diff := pretty.Compare(tt.wantGroups, got); diff != "" {
+			t.Errorf("case %d: Compare(want, got) = %v", i, diff)
+		}
+	}
+
+	// Upstream groups are created once, and remain after being synced away.
+	groups, err := f.gm.List()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := pretty.Compare([]string{"developers", "ldap:admins", "ldap:developers", "ldap:ops"}, user.GroupNames(groups)); diff != "" {
+		t.Errorf("Compare(want, got) = %v", diff)
+	}
+
+	// Names in the namespaces of connectors can't be taken through the admin
+	// API.
+	if _, err := f.gm.CreateGroup("ldap:admins"); err != user.ErrorInvalidGroupName {
+		t.Errorf("want %v, got %v", user.ErrorInvalidGroupName, err)
+	}
+}
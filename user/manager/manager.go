@@ -22,6 +22,9 @@ var (
 type UserManager struct {
 	Clock clockwork.Clock
 
+	// PasswordPolicy is enforced when users choose passwords.
+	PasswordPolicy user.PasswordPolicy
+
 	userRepo        user.UserRepo
 	pwRepo          user.PasswordInfoRepo
 	connCfgRepo     connector.ConnectorConfigRepo
@@ -37,7 +40,8 @@ type ManagerOptions struct {
 
 func NewUserManager(userRepo user.UserRepo, pwRepo user.PasswordInfoRepo, connCfgRepo connector.ConnectorConfigRepo, txnFactory repo.TransactionFactory, options ManagerOptions) *UserManager {
 	return &UserManager{
-		Clock: clockwork.NewRealClock(),
+		Clock:          clockwork.NewRealClock(),
+		PasswordPolicy: user.DefaultPasswordPolicy,
 
 		userRepo:        userRepo,
 		pwRepo:          pwRepo,
@@ -120,6 +124,49 @@ func (m *UserManager) Disable(userID string, disabled bool) error {
 	return nil
 }
 
+// LinkRemoteIdentity attaches the remote identity to an existing user, who
+// can log in with it from then on. The identity can't belong to another
+// user, and its connector has to exist.
+func (m *UserManager) LinkRemoteIdentity(userID string, rid user.RemoteIdentity) error {
+	tx, err := m.begin()
+	if err != nil {
+		return err
+	}
+
+	if err := m.addRemoteIdentity(tx, userID, rid); err != nil {
+		rollback(tx)
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		rollback(tx)
+		return err
+	}
+
+	return nil
+}
+
+// UnlinkRemoteIdentity detaches the remote identity from the user, who can't
+// log in with it anymore.
+func (m *UserManager) UnlinkRemoteIdentity(userID string, rid user.RemoteIdentity) error {
+	tx, err := m.begin()
+	if err != nil {
+		return err
+	}
+
+	if err = m.userRepo.RemoveRemoteIdentity(tx, userID, rid); err != nil {
+		rollback(tx)
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		rollback(tx)
+		return err
+	}
+
+	return nil
+}
+
 // RegisterWithRemoteIdentity creates new user and attaches the given remote identity.
 func (m *UserManager) RegisterWithRemoteIdentity(email string, emailVerified bool, rid user.RemoteIdentity) (string, error) {
 	tx, err := m.begin()
@@ -163,9 +210,9 @@ func (m *UserManager) RegisterWithPassword(email, plaintext, connID string) (str
 		return "", err
 	}
 
-	if !user.ValidPassword(plaintext) {
+	if err := m.PasswordPolicy.Validate(plaintext); err != nil {
 		rollback(tx)
-		return "", user.ErrorInvalidPassword
+		return "", err
 	}
 
 	usr, err := m.insertNewUser(tx, email, false)
@@ -270,9 +317,9 @@ func (m *UserManager) ChangePassword(pwr PasswordChangeable, plaintext string) (
 		return nil, err
 	}
 
-	if !user.ValidPassword(plaintext) {
+	if err := m.PasswordPolicy.Validate(plaintext); err != nil {
 		rollback(tx)
-		return nil, user.ErrorInvalidPassword
+		return nil, err
 	}
 
 	pwi, err := m.pwRepo.Get(tx, pwr.UserID())
@@ -286,13 +333,18 @@ func (m *UserManager) ChangePassword(pwr PasswordChangeable, plaintext string) (
 		return nil, ErrorPasswordAlreadyChanged
 	}
 
+	if err := m.PasswordPolicy.CheckHistory(pwi, plaintext); err != nil {
+		rollback(tx)
+		return nil, err
+	}
+
 	newPass, err := user.NewPasswordFromPlaintext(plaintext)
 	if err != nil {
 		rollback(tx)
 		return nil, err
 	}
 
-	pwi.Password = newPass
+	m.PasswordPolicy.SetPassword(&pwi, newPass)
 	err = m.pwRepo.Update(tx, pwi)
 	if err != nil {
 		rollback(tx)
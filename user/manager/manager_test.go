@@ -19,6 +19,7 @@ type testFixtures struct {
 	pwr   user.PasswordInfoRepo
 	ccr   connector.ConnectorConfigRepo
 	mgr   *UserManager
+	gm    *GroupManager
 	clock clockwork.Clock
 }
 
@@ -90,6 +91,9 @@ func makeTestFixtures() *testFixtures {
 
 	f.mgr = NewUserManager(f.ur, f.pwr, f.ccr, db.TransactionFactory(dbMap), ManagerOptions{})
 	f.mgr.Clock = f.clock
+
+	f.gm = NewGroupManager(db.NewGroupRepo(dbMap), f.ur, db.TransactionFactory(dbMap))
+	f.gm.Clock = f.clock
 	return f
 }
 
@@ -255,6 +259,118 @@ func TestRegisterWithPassword(t *testing.T) {
 	}
 }
 
+func TestLinkRemoteIdentity(t *testing.T) {
+	tests := []struct {
+		userID string
+		rid    user.RemoteIdentity
+		err    error
+	}{
+		{
+			userID: "ID-1",
+			rid: user.RemoteIdentity{
+				ConnectorID: "local",
+				ID:          "1234",
+			},
+			err: nil,
+		},
+		{
+			userID: "ID-1",
+			rid: user.RemoteIdentity{
+				ConnectorID: "local",
+				ID:          "2",
+			},
+			err: user.ErrorDuplicateRemoteIdentity,
+		},
+		{
+			userID: "ID-1",
+			rid: user.RemoteIdentity{
+				ConnectorID: "idonotexist",
+				ID:          "1234",
+			},
+			err: connector.ErrorNotFound,
+		},
+		{
+			userID: "idonotexist",
+			rid: user.RemoteIdentity{
+				ConnectorID: "local",
+				ID:          "1234",
+			},
+			err: user.ErrorNotFound,
+		},
+	}
+
+	for i, tt := range tests {
+		f := makeTestFixtures()
+		err := f.mgr.LinkRemoteIdentity(tt.userID, tt.rid)
+		if tt.err != err {
+			t.Errorf("case %d: want=%q, got=%q", i, tt.err, err)
+		}
+
+		usr, err := f.ur.GetByRemoteIdentity(nil, tt.rid)
+		if tt.err != nil {
+			if err == nil && usr.ID == tt.userID {
+				t.Errorf("case %d: want remote identity not to be linked", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: err != nil: %q", i, err)
+			continue
+		}
+		if usr.ID != tt.userID {
+			t.Errorf("case %d: user.ID: want=%q, got=%q", i, tt.userID, usr.ID)
+		}
+	}
+}
+
+func TestUnlinkRemoteIdentity(t *testing.T) {
+	tests := []struct {
+		userID string
+		rid    user.RemoteIdentity
+		err    error
+	}{
+		{
+			userID: "ID-1",
+			rid: user.RemoteIdentity{
+				ConnectorID: "local",
+				ID:          "1",
+			},
+			err: nil,
+		},
+		{
+			userID: "ID-1",
+			rid: user.RemoteIdentity{
+				ConnectorID: "local",
+				ID:          "2",
+			},
+			err: user.ErrorNotFound,
+		},
+		{
+			userID: "ID-1",
+			rid: user.RemoteIdentity{
+				ConnectorID: "local",
+			},
+			err: user.ErrorInvalidID,
+		},
+	}
+
+	for i, tt := range tests {
+		f := makeTestFixtures()
+		err := f.mgr.UnlinkRemoteIdentity(tt.userID, tt.rid)
+		if tt.err != err {
+			t.Errorf("case %d: want=%q, got=%q", i, tt.err, err)
+			continue
+		}
+		if tt.err != nil {
+			continue
+		}
+
+		if _, err := f.ur.GetByRemoteIdentity(nil, tt.rid); err != user.ErrorNotFound {
+			t.Errorf("case %d: want=%q, got=%q", i, user.ErrorNotFound, err)
+		}
+	}
+}
+
 func TestVerifyEmail(t *testing.T) {
 	now := time.Now()
 	issuer, _ := url.Parse("http://example.com")
@@ -396,6 +512,54 @@ func TestChangePassword(t *testing.T) {
 	}
 }
 
+func TestChangePasswordPolicy(t *testing.T) {
+	f := makeTestFixtures()
+	f.mgr.PasswordPolicy = user.PasswordPolicy{MinLength: 8, HistorySize: 2}
+
+	// reset returns a password reset for the current password of ID-1.
+	reset := func() user.PasswordReset {
+		pwi, err := f.pwr.Get(nil, "ID-1")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return user.PasswordReset{Claims: jose.Claims{
+			"sub": "ID-1",
+			user.ClaimPasswordResetPassword: string(pwi.Password),
+		}}
+	}
+
+	tests := []struct {
+		newPassword string
+		wantErr     error
+	}{
+		{newPassword: "short", wantErr: user.ErrorInvalidPassword},
+		{newPassword: "new-password-1"},
+		{newPassword: "new-password-1", wantErr: user.ErrorPasswordReused},
+		{newPassword: "new-password-2"},
+		{newPassword: "new-password-1", wantErr: user.ErrorPasswordReused},
+		{newPassword: "new-password-3"},
+		// Only the last two passwords are remembered.
+		{newPassword: "new-password-1"},
+	}
+
+	for i, tt := range tests {
+		if _, err := f.mgr.ChangePassword(reset(), tt.newPassword); err != tt.wantErr {
+			t.Errorf("case %d: want err=%v, got=%v", i, tt.wantErr, err)
+		}
+	}
+
+	pwi, err := f.pwr.Get(nil, "ID-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pwi.History) != 1 {
+		t.Errorf("want 1 previous password, got %d", len(pwi.History))
+	}
+	if _, err := pwi.Authenticate("new-password-1"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
 func TestCreateUser(t *testing.T) {
 	tests := []struct {
 		usr      user.User
@@ -7,8 +7,6 @@ import (
 	"net/url"
 	"time"
 
-	"golang.org/x/crypto/bcrypt"
-
 	"github.com/coreos/go-oidc/jose"
 	"github.com/coreos/go-oidc/key"
 	"github.com/coreos/go-oidc/oidc"
@@ -36,12 +34,13 @@ var (
 
 type Hasher func(string) ([]byte, error)
 
+// DefaultPasswordHasher hashes passwords with PasswordHashAlgorithm.
 func DefaultPasswordHasher(s string) ([]byte, error) {
-	pwHash, err := bcrypt.GenerateFromPassword([]byte(s), bcryptHashCost)
+	pwHash, err := PasswordHashAlgorithm.Hash(s)
 	if err != nil {
 		return nil, err
 	}
-	return Password(pwHash), nil
+	return pwHash, nil
 }
 
 type Password []byte
@@ -56,10 +55,14 @@ type PasswordInfo struct {
 	Password Password `json:"passwordHash"`
 
 	PasswordExpires time.Time `json:"passwordExpires"`
+
+	// History holds the hashes of the user's previous passwords, most
+	// recent first, as far back as the password policy remembers them.
+	History []Password `json:"passwordHistory,omitempty"`
 }
 
 func (p PasswordInfo) Authenticate(plaintext string) (*oidc.Identity, error) {
-	if err := bcrypt.CompareHashAndPassword(p.Password, []byte(plaintext)); err != nil {
+	if err := ComparePassword(p.Password, plaintext); err != nil {
 		return nil, ErrorPasswordHashNoMatch
 	}
 
@@ -71,6 +74,22 @@ func (p PasswordInfo) Authenticate(plaintext string) (*oidc.Identity, error) {
 	return &ident, nil
 }
 
+// Rehash hashes plaintext again if the password was hashed by an algorithm
+// other than PasswordHashAlgorithm, or with other parameters, and reports
+// whether it did. It must only be called once Authenticate accepted
+// plaintext.
+func (p *PasswordInfo) Rehash(plaintext string) (bool, error) {
+	if !hashOutdated(p.Password) {
+		return false, nil
+	}
+	pw, err := NewPasswordFromPlaintext(plaintext)
+	if err != nil {
+		return false, err
+	}
+	p.Password = pw
+	return true, nil
+}
+
 func (p PasswordInfo) Identity() oidc.Identity {
 	return oidc.Identity{
 		ID: p.UserID,
@@ -85,10 +104,11 @@ type PasswordInfoRepo interface {
 
 func (u *PasswordInfo) UnmarshalJSON(data []byte) error {
 	var dec struct {
-		UserID            string    `json:"userId"`
-		PasswordHash      []byte    `json:"passwordHash"`
-		PasswordPlaintext string    `json:"passwordPlaintext"`
-		PasswordExpires   time.Time `json:"passwordExpires"`
+		UserID            string     `json:"userId"`
+		PasswordHash      []byte     `json:"passwordHash"`
+		PasswordPlaintext string     `json:"passwordPlaintext"`
+		PasswordExpires   time.Time  `json:"passwordExpires"`
+		PasswordHistory   []Password `json:"passwordHistory"`
 	}
 
 	err := json.Unmarshal(data, &dec)
@@ -97,6 +117,7 @@ func (u *PasswordInfo) UnmarshalJSON(data []byte) error {
 	}
 
 	u.UserID = dec.UserID
+	u.History = dec.PasswordHistory
 
 	if !dec.PasswordExpires.IsZero() {
 		u.PasswordExpires = dec.PasswordExpires
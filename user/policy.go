@@ -0,0 +1,150 @@
+package user
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	ErrorPasswordTooLong   = errors.New("password is too long")
+	ErrorPasswordTooSimple = errors.New("password doesn't use enough kinds of characters")
+	ErrorPasswordBreached  = errors.New("password is known from a data breach")
+	ErrorPasswordReused    = errors.New("password was used before")
+
+	// DefaultPasswordPolicy only requires passwords to be at least six
+	// characters long.
+	DefaultPasswordPolicy = PasswordPolicy{MinLength: 6}
+)
+
+// PasswordPolicy says which passwords users may choose. Passwords longer
+// than 72 bytes are always rejected, since bcrypt would ignore the rest.
+type PasswordPolicy struct {
+	// MinLength is the minimum number of characters of passwords.
+	MinLength int
+
+	// MinCharClasses is the number of kinds of characters passwords must
+	// use, out of lower case letters, upper case letters, digits and
+	// anything else.
+	MinCharClasses int
+
+	// Breached passwords may not be used.
+	Breached BreachedPasswords
+
+	// HistorySize is the number of a user's most recent passwords, counting
+	// the current one, which may not be used again.
+	HistorySize int
+}
+
+// Validate returns nil if the policy allows plaintext as a password.
+// Passwords which are too short are rejected with ErrorInvalidPassword.
+func (p PasswordPolicy) Validate(plaintext string) error {
+	if utf8.RuneCountInString(plaintext) < p.MinLength || plaintext == "" {
+		return ErrorInvalidPassword
+	}
+	if len(plaintext) > maxSecretLength {
+		return ErrorPasswordTooLong
+	}
+	if charClasses(plaintext) < p.MinCharClasses {
+		return ErrorPasswordTooSimple
+	}
+	if p.Breached.Contains(plaintext) {
+		return ErrorPasswordBreached
+	}
+	return nil
+}
+
+// CheckHistory returns ErrorPasswordReused if plaintext is the current
+// password of pwi, or one of the previous ones the policy remembers.
+func (p PasswordPolicy) CheckHistory(pwi PasswordInfo, plaintext string) error {
+	if p.HistorySize < 1 {
+		return nil
+	}
+	hashes := append([]Password{pwi.Password}, pwi.History...)
+	if len(hashes) > p.HistorySize {
+		hashes = hashes[:p.HistorySize]
+	}
+	for _, hash := range hashes {
+		if ComparePassword(hash, plaintext) == nil {
+			return ErrorPasswordReused
+		}
+	}
+	return nil
+}
+
+// SetPassword replaces the password of pwi, remembering the current one in
+// its history as far back as the policy requires.
+func (p PasswordPolicy) SetPassword(pwi *PasswordInfo, password Password) {
+	var history []Password
+	if p.HistorySize > 1 {
+		history = append([]Password{pwi.Password}, pwi.History...)
+		if len(history) > p.HistorySize-1 {
+			history = history[:p.HistorySize-1]
+		}
+	}
+	pwi.Password = password
+	pwi.History = history
+}
+
+func charClasses(s string) int {
+	var lower, upper, digit, other int
+	for _, r := range s {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+	return lower + upper + digit + other
+}
+
+// BreachedPasswords is a set of passwords known from data breaches, kept
+// as their SHA-1 hashes.
+type BreachedPasswords map[[sha1.Size]byte]struct{}
+
+// BreachedPasswordsFromReader reads breached passwords, one per line. Lines
+// may hold either a password, or the hex encoded SHA-1 hash of one
+// optionally followed by a colon and a count, as in the lists published by
+// Have I Been Pwned. Empty lines are skipped.
+func BreachedPasswordsFromReader(r io.Reader) (BreachedPasswords, error) {
+	b := make(BreachedPasswords)
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimRight(s.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		var sum [sha1.Size]byte
+		hash := line
+		if i := strings.Index(line, ":"); i == 2*sha1.Size {
+			hash = line[:i]
+		}
+		if len(hash) == 2*sha1.Size {
+			if _, err := hex.Decode(sum[:], []byte(hash)); err == nil {
+				b[sum] = struct{}{}
+				continue
+			}
+		}
+		b[sha1.Sum([]byte(line))] = struct{}{}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Contains reports whether plaintext is a breached password.
+func (b BreachedPasswords) Contains(plaintext string) bool {
+	_, ok := b[sha1.Sum([]byte(plaintext))]
+	return ok
+}
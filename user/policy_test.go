@@ -0,0 +1,110 @@
+package user
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	breached, err := BreachedPasswordsFromReader(strings.NewReader("letmein123\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	policy := PasswordPolicy{
+		MinLength:      8,
+		MinCharClasses: 2,
+		Breached:       breached,
+	}
+
+	tests := []struct {
+		plaintext string
+		wantErr   error
+	}{
+		{plaintext: "correct horse"},
+		{plaintext: "Tr0ub4dor"},
+		// Length is counted in characters.
+		{plaintext: "ünïcødé!"},
+		{plaintext: "", wantErr: ErrorInvalidPassword},
+		{plaintext: "short1", wantErr: ErrorInvalidPassword},
+		{plaintext: strings.Repeat("a1", 37), wantErr: ErrorPasswordTooLong},
+		{plaintext: "onlyletters", wantErr: ErrorPasswordTooSimple},
+		{plaintext: "12345678", wantErr: ErrorPasswordTooSimple},
+		{plaintext: "letmein123", wantErr: ErrorPasswordBreached},
+	}
+
+	for i, tt := range tests {
+		if err := policy.Validate(tt.plaintext); err != tt.wantErr {
+			t.Errorf("case %d: want err=%v, got=%v", i, tt.wantErr, err)
+		}
+	}
+}
+
+func TestPasswordPolicyHistory(t *testing.T) {
+	defer func(a HashAlgorithm) {
+		PasswordHashAlgorithm = a
+	}(PasswordHashAlgorithm)
+	PasswordHashAlgorithm = BcryptHashAlgorithm{Cost: 4}
+
+	policy := PasswordPolicy{HistorySize: 3}
+	pwi := PasswordInfo{UserID: "elroy-id"}
+	for _, plaintext := range []string{"password-1", "password-2", "password-3", "password-4"} {
+		pw, err := NewPasswordFromPlaintext(plaintext)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if pwi.Password == nil {
+			pwi.Password = pw
+			continue
+		}
+		policy.SetPassword(&pwi, pw)
+	}
+	if len(pwi.History) != policy.HistorySize-1 {
+		t.Fatalf("want %d previous passwords, got %d", policy.HistorySize-1, len(pwi.History))
+	}
+
+	tests := []struct {
+		plaintext string
+		wantErr   error
+	}{
+		{plaintext: "password-1"},
+		{plaintext: "password-2", wantErr: ErrorPasswordReused},
+		{plaintext: "password-3", wantErr: ErrorPasswordReused},
+		{plaintext: "password-4", wantErr: ErrorPasswordReused},
+		{plaintext: "password-5"},
+	}
+
+	for i, tt := range tests {
+		if err := policy.CheckHistory(pwi, tt.plaintext); err != tt.wantErr {
+			t.Errorf("case %d: want err=%v, got=%v", i, tt.wantErr, err)
+		}
+	}
+
+	// Without a history, even the current password may be chosen again.
+	if err := DefaultPasswordPolicy.CheckHistory(pwi, "password-4"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestBreachedPasswordsFromReader(t *testing.T) {
+	list := strings.Join([]string{
+		"hunter2",
+		"",
+		// The SHA-1 hash of "password", as listed by Have I Been Pwned.
+		"5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:3730471",
+		// The SHA-1 hash of "123456".
+		"7c4a8d09ca3762af61e59520943dc26494f8941b\r",
+	}, "\n")
+	b, err := BreachedPasswordsFromReader(strings.NewReader(list))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for i, plaintext := range []string{"hunter2", "password", "123456"} {
+		if !b.Contains(plaintext) {
+			t.Errorf("case %d: want %q breached", i, plaintext)
+		}
+	}
+	if b.Contains("correct horse battery staple") || b.Contains("") {
+		t.Errorf("want unlisted passwords not breached")
+	}
+}
@@ -39,6 +39,11 @@ const (
 
 	// Claim representing where a user should be sent after responding to an invitation
 	ClaimInvitationCallback = "http://coreos.com/invitation/callback"
+
+	// ClaimAccountLinkConnectorID and ClaimAccountLinkRemoteID represent the
+	// remote identity to be linked to the user.
+	ClaimAccountLinkConnectorID = "http://coreos.com/account-link/connector-id"
+	ClaimAccountLinkRemoteID    = "http://coreos.com/account-link/remote-id"
 )
 
 var (
@@ -103,6 +108,65 @@ func (u *User) AddToClaims(claims jose.Claims) {
 	}
 }
 
+// ScopeClaims maps the standard scopes, and the "groups" scope, to the
+// claims they request. dex only has data for some of them; the others are
+// never released.
+// http://openid.net/specs/openid-connect-core-1_0.html#ScopeClaims
+var ScopeClaims = map[string][]string{
+	"profile": {"name", "family_name", "given_name", "middle_name", "nickname",
+		"preferred_username", "profile", "picture", "website", "gender",
+		"birthdate", "zoneinfo", "locale", "updated_at"},
+	"email":   {"email", "email_verified"},
+	"address": {"address"},
+	"phone":   {"phone_number", "phone_number_verified"},
+	"groups":  {"groups"},
+}
+
+// ClaimRequested reports whether the claim is requested by the given scopes,
+// or by name.
+func ClaimRequested(scope, names []string, claim string) bool {
+	for _, s := range scope {
+		for _, name := range ScopeClaims[s] {
+			if name == claim {
+				return true
+			}
+		}
+	}
+	for _, name := range names {
+		if name == claim {
+			return true
+		}
+	}
+	return false
+}
+
+// ClaimScopes returns the scopes which request the claims of the given names,
+// in the order the names are given. Names no scope requests are skipped.
+func ClaimScopes(names []string) []string {
+	var scopes []string
+	for _, name := range names {
+		for s, claims := range ScopeClaims {
+			if !containsString(claims, name) || containsString(scopes, s) {
+				continue
+			}
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// AddScopedClaims adds the information about the user which the given scopes
+// request, or which is requested by claim name, to the given Claims.
+func (u *User) AddScopedClaims(claims jose.Claims, scope []string, names []string) {
+	all := jose.Claims{}
+	u.AddToClaims(all)
+	for name, value := range all {
+		if ClaimRequested(scope, names, name) {
+			claims[name] = value
+		}
+	}
+}
+
 // UserRepo implementations maintain a persistent set of users.
 // The following invariants must be maintained:
 //  * Users must have a unique Email and ID
@@ -167,8 +231,9 @@ func ValidEmail(email string) bool {
 	return address.Address == email
 }
 
+// ValidPassword reports whether DefaultPasswordPolicy allows plaintext.
 func ValidPassword(plaintext string) bool {
-	return len(plaintext) > 5
+	return DefaultPasswordPolicy.Validate(plaintext) == nil
 }
 
 type UserWithRemoteIdentities struct {
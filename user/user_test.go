@@ -55,6 +55,79 @@ func TestAddToClaims(t *testing.T) {
 	}
 }
 
+func TestAddScopedClaims(t *testing.T) {
+	usr := User{
+		DisplayName:   "Test User Name",
+		Email:         "verified@example.com",
+		EmailVerified: true,
+	}
+
+	tests := []struct {
+		scope        []string
+		names        []string
+		wantedClaims jose.Claims
+	}{
+		{
+			scope:        []string{"openid"},
+			wantedClaims: jose.Claims{},
+		},
+		{
+			scope: []string{"openid", "profile"},
+			wantedClaims: jose.Claims{
+				"name": "Test User Name",
+			},
+		},
+		{
+			scope: []string{"openid", "email"},
+			wantedClaims: jose.Claims{
+				"email":          "verified@example.com",
+				"email_verified": true,
+			},
+		},
+		{
+			scope: []string{"openid", "profile", "email", "address", "phone"},
+			wantedClaims: jose.Claims{
+				"name":           "Test User Name",
+				"email":          "verified@example.com",
+				"email_verified": true,
+			},
+		},
+		{
+			scope: []string{"openid"},
+			names: []string{"email", "phone_number"},
+			wantedClaims: jose.Claims{
+				"email": "verified@example.com",
+			},
+		},
+	}
+
+	for i, tt := range tests {
+		claims := jose.Claims{}
+		usr.AddScopedClaims(claims, tt.scope, tt.names)
+		if !reflect.DeepEqual(claims, tt.wantedClaims) {
+			t.Errorf("case %d: want=%#v, got=%#v", i, tt.wantedClaims, claims)
+		}
+	}
+}
+
+func TestClaimScopes(t *testing.T) {
+	tests := []struct {
+		names []string
+		want  []string
+	}{
+		{nil, nil},
+		{[]string{"sub"}, nil},
+		{[]string{"email"}, []string{"email"}},
+		{[]string{"groups", "email_verified", "email", "name"}, []string{"groups", "email", "profile"}},
+	}
+
+	for i, tt := range tests {
+		if got := ClaimScopes(tt.names); !reflect.DeepEqual(tt.want, got) {
+			t.Errorf("case %d: want=%v, got=%v", i, tt.want, got)
+		}
+	}
+}
+
 func TestValidEmail(t *testing.T) {
 	tests := []struct {
 		email string